@@ -1,5 +1,6 @@
-import React, { useState } from 'react'
-import { ladderService, SetScore, Player } from './grpc/ladderService'
+import React, { useEffect, useState } from 'react'
+import { ladderService, SetScore, Player, LadderRules } from './grpc/ladderService'
+import { validateScore } from './wasm/engine'
 
 interface AddMatchFormProps {
     players: Player[]
@@ -13,6 +14,11 @@ const AddMatchForm: React.FC<AddMatchFormProps> = ({ players, onMatchAdded }) =>
     const [scoreInput, setScoreInput] = useState('')
     const [loading, setLoading] = useState(false)
     const [error, setError] = useState<string | null>(null)
+    const [rules, setRules] = useState<LadderRules | undefined>()
+
+    useEffect(() => {
+        ladderService.getLadderRules().then(setRules).catch(() => setRules(undefined))
+    }, [])
 
     const handleSubmit = async (e: React.FormEvent) => {
         e.preventDefault()
@@ -37,6 +43,22 @@ const AddMatchForm: React.FC<AddMatchFormProps> = ({ players, onMatchAdded }) =>
 
             const setScores = parseScores(scoreInput)
 
+            // Check offline with the server's own rules when the engine is built
+            const check = await validateScore(setScores.map(s => s.toObject()), {
+                scoringFormat: rules?.getScoringFormat(),
+                players: players.map(p => p.toObject()),
+                challengerId,
+                defenderId,
+            })
+            if (check?.error) {
+                setError(check.error)
+                return
+            }
+            if (check && (check.winner === 1 ? challengerId : defenderId) !== winnerId) {
+                setError('The score does not match the selected winner')
+                return
+            }
+
             await ladderService.addMatchResult(challengerId, defenderId, winnerId, setScores)
 
             // Reset form
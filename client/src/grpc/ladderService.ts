@@ -16,6 +16,9 @@ import {
   ListRecentMatchesRequest,
   ListRecentMatchesResponse,
   MatchResult,
+  GetLadderRulesRequest,
+  GetLadderRulesResponse,
+  LadderRules,
 } from './ladder_pb'
 
 // Import generated gRPC-Web service client
@@ -30,6 +33,7 @@ export type {
   ListPlayersRequest,
   ListPlayersResponse,
   MatchResult,
+  LadderRules,
 }
 
 // Re-export classes
@@ -106,6 +110,22 @@ export const ladderService = {
     })
   },
 
+  getLadderRules: async (): Promise<LadderRules | undefined> => {
+    return new Promise((resolve, reject) => {
+      const request = new GetLadderRulesRequest()
+
+      client.getLadderRules(request, {}, (err: any, response: GetLadderRulesResponse) => {
+        if (err) {
+          reject(new Error(`gRPC error: ${err.message || 'Unknown error'}`))
+        } else if (response) {
+          resolve(response.getRules())
+        } else {
+          reject(new Error('No response received'))
+        }
+      })
+    })
+  },
+
   listRecentMatches: async (limit: number): Promise<MatchResult[]> => {
     return new Promise((resolve, reject) => {
       const request = new ListRecentMatchesRequest()
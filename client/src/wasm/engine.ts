@@ -0,0 +1,90 @@
+// Loads the server's scoring and replay engine, compiled to WebAssembly by
+// scripts/build_wasm.sh, so the client can check scores with exactly the
+// server's rules. Everything here degrades to "not available" when the build
+// has not been run, and callers fall back to the server's answer.
+
+interface WasmEngine {
+  validateScore(request: string): string
+  previewMatch(request: string): string
+}
+
+declare global {
+  interface Window {
+    Go?: new () => { importObject: WebAssembly.Imports; run(instance: WebAssembly.Instance): Promise<void> }
+    squashLadder?: WasmEngine
+  }
+}
+
+export interface SetScoreInput {
+  challengerPoints: number
+  defenderPoints: number
+  challengerDefault?: boolean
+  defenderDefault?: boolean
+}
+
+export interface ScoreCheck {
+  winner: 0 | 1 | 2 // 1 challenger, 2 defender
+  error?: string
+}
+
+let loading: Promise<WasmEngine | null> | null = null
+
+const loadScript = (src: string): Promise<void> =>
+  new Promise((resolve, reject) => {
+    const script = document.createElement('script')
+    script.src = src
+    script.onload = () => resolve()
+    script.onerror = () => reject(new Error(`failed to load ${src}`))
+    document.head.appendChild(script)
+  })
+
+// loadEngine starts the engine once and resolves to null when it is missing
+export const loadEngine = (): Promise<WasmEngine | null> => {
+  if (!loading) {
+    loading = (async () => {
+      try {
+        if (!window.Go) await loadScript('/wasm_exec.js')
+        const go = new window.Go!()
+        const { instance } = await WebAssembly.instantiateStreaming(fetch('/ladder.wasm'), go.importObject)
+        go.run(instance)
+        return window.squashLadder ?? null
+      } catch (err) {
+        console.warn('Offline score checks unavailable:', err)
+        return null
+      }
+    })()
+  }
+  return loading
+}
+
+// ScoreContext is what the server also uses to judge a score: the ladder's
+// scoring format (the ScoringFormat name or number, default when missing) and
+// the players, whose handicaps give each side's head start
+export interface ScoreContext {
+  scoringFormat?: string | number
+  players?: object[]
+  challengerId?: string
+  defenderId?: string
+}
+
+// validateScore checks set scores as the server would, or returns null without
+// the engine
+export const validateScore = async (setScores: SetScoreInput[], context: ScoreContext = {}): Promise<ScoreCheck | null> => {
+  const engine = await loadEngine()
+  if (!engine) return null
+  const resp = JSON.parse(engine.validateScore(JSON.stringify({ setScores, ...context })))
+  return { winner: resp.winner ?? 0, error: resp.error }
+}
+
+// previewMatch returns the players as they would stand after the match, in
+// protojson form, or null without the engine
+export const previewMatch = async (
+  players: object[],
+  challengerId: string,
+  defenderId: string,
+  winnerId: string,
+): Promise<{ players?: object[]; error?: string } | null> => {
+  const engine = await loadEngine()
+  if (!engine) return null
+  return JSON.parse(engine.previewMatch(JSON.stringify({ players, challengerId, defenderId, winnerId })))
+}
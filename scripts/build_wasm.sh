@@ -0,0 +1,40 @@
+#!/bin/bash
+set -e
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+NC='\033[0m' # No Color
+
+# Script directory
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+PROJECT_ROOT="$(cd "$SCRIPT_DIR/.." && pwd)"
+
+echo -e "${YELLOW}Building the ladder engine for WebAssembly...${NC}"
+
+# Check go
+if ! command -v go &> /dev/null; then
+    echo -e "${RED}Error: go is not installed${NC}"
+    exit 1
+fi
+
+DEST_DIR="$PROJECT_ROOT/client/public"
+mkdir -p "$DEST_DIR"
+
+cd "$PROJECT_ROOT/server"
+GOOS=js GOARCH=wasm go build -trimpath -ldflags="-s -w" -o "$DEST_DIR/ladder.wasm" ./cmd/wasm
+echo -e "${GREEN}  ✓ Built client/public/ladder.wasm${NC}"
+
+# The JS glue must come from the same Go release as the compiler
+GOROOT="$(go env GOROOT)"
+WASM_EXEC="$GOROOT/lib/wasm/wasm_exec.js"
+if [ ! -f "$WASM_EXEC" ]; then
+    WASM_EXEC="$GOROOT/misc/wasm/wasm_exec.js"
+fi
+if [ ! -f "$WASM_EXEC" ]; then
+    echo -e "${RED}  ✗ Could not find wasm_exec.js in $GOROOT${NC}"
+    exit 1
+fi
+cp -f "$WASM_EXEC" "$DEST_DIR/"
+echo -e "${GREEN}  ✓ Copied wasm_exec.js${NC}"
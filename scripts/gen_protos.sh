@@ -20,36 +20,11 @@ if ! command -v bazel &> /dev/null; then
     exit 1
 fi
 
-bazel build //client/src/grpc:ladder_proto_ts //client/src/grpc:ladder_grpc_web
+# The web client's TypeScript comes from server/cmd/gen, which lists its exports
+# from the proto; -check there tells whether it has drifted
+(cd server && go run ./cmd/gen)
 if [ $? -eq 0 ]; then
-    echo -e "${GREEN}  ✓ Proto files generated${NC}"
-    
-    # Copy generated files to client source
-    echo -e "  ℹ Copying generated files to client/src/grpc/..."
-    mkdir -p client/src/grpc
-    cp -f bazel-bin/client/src/grpc/ladder_proto_ts_pb/server/proto/ladder_pb.d.ts client/src/grpc/
-    cp -f bazel-bin/client/src/grpc/ladder_proto_ts_pb/server/proto/ladder_pb.js client/src/grpc/
-    cp -f bazel-bin/client/src/grpc/ladder_grpc_web_pb/server/proto/ladder_grpc_web_pb.d.ts client/src/grpc/
-    cp -f bazel-bin/client/src/grpc/ladder_grpc_web_pb/server/proto/ladder_grpc_web_pb.js client/src/grpc/
-    
-    # Make files writable
-    chmod +w client/src/grpc/*.js
-    
-    # Prepend 'var exports = {};' to make CJS compatible with browser
-    echo "var exports = {};" | cat - client/src/grpc/ladder_pb.js > temp && mv temp client/src/grpc/ladder_pb.js
-    echo "var exports = {};" | cat - client/src/grpc/ladder_grpc_web_pb.js > temp && mv temp client/src/grpc/ladder_grpc_web_pb.js
-
-    # Fix: Clone proto.ladder if it's frozen
-    sed -i '' 's/proto.ladder = require('\''\.\/ladder_pb.js'\'');/proto.ladder = require('\''\.\/ladder_pb.js'\''); if (!Object.isExtensible(proto.ladder)) { proto.ladder = Object.assign({}, proto.ladder); }/' client/src/grpc/ladder_grpc_web_pb.js
-
-    # Fix: Replace readStringRequireUtf8 (incompatibility between some versions of protobuf)
-    sed -i '' 's/readStringRequireUtf8/readString/g' client/src/grpc/ladder_pb.js
-
-    # Append ES exports
-    echo "export const { Player, ListPlayersRequest, ListPlayersResponse, AddPlayerRequest, AddPlayerResponse, RemovePlayerRequest, RemovePlayerResponse, SetScore, MatchResult, AddMatchResultRequest, AddMatchResultResponse, InvalidateMatchResultRequest, InvalidateMatchResultResponse, ListRecentMatchesRequest, ListRecentMatchesResponse } = proto.ladder;" >> client/src/grpc/ladder_pb.js
-    echo "export const { LadderServiceClient } = proto.ladder;" >> client/src/grpc/ladder_grpc_web_pb.js
-    
-    echo -e "${GREEN}  ✓ Generated files prepared${NC}"
+    echo -e "${GREEN}  ✓ Client files generated${NC}"
 
     # Generate Server Go files
     echo -e "${YELLOW}Generating proto files for server...${NC}"
@@ -111,6 +86,6 @@ if [ $? -eq 0 ]; then
         exit 1
     fi
 else
-    echo -e "${RED}  ✗ Failed to generate proto files${NC}"
+    echo -e "${RED}  ✗ Failed to generate client files${NC}"
     exit 1
 fi
@@ -0,0 +1,7 @@
+#!/bin/bash
+# Stamps release builds with the version, commit and build date, through the
+# x_defs of the Go binaries. Used by "bazel build --stamp" via .bazelrc.
+
+echo "STABLE_VERSION $(git describe --tags --always --dirty 2>/dev/null || echo dev)"
+echo "STABLE_GIT_COMMIT $(git rev-parse HEAD 2>/dev/null)"
+echo "STABLE_BUILD_DATE $(date -u +%Y-%m-%dT%H:%M:%SZ)"
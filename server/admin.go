@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// adminMethods lists the RPCs that require the admin token
+var adminMethods = map[string]bool{
+	"/ladder.LadderService/VerifyIntegrity":        true,
+	"/ladder.LadderService/VerifyChain":            true,
+	"/ladder.LadderService/ListTransactions":       true,
+	"/ladder.LadderService/GetTransaction":         true,
+	"/ladder.LadderService/UndoLastTransaction":    true,
+	"/ladder.LadderService/InvalidateMatchResults": true,
+	"/ladder.LadderService/SetLadderRules":         true,
+	"/ladder.LadderService/SetPlayerHandicap":      true,
+	"/ladder.LadderService/SetPlayerCategory":      true,
+	"/ladder.LadderService/SeedLadder":             true,
+	"/ladder.LadderService/CreateClub":             true,
+	"/ladder.LadderService/ListClubs":              true,
+	"/ladder.LadderService/GetUsage":               true,
+	"/ladder.LadderService/SyncNow":                true,
+	"/ladder.LadderService/SetMaintenanceMode":     true,
+	"/ladder.LadderService/ReloadConfig":           true,
+	"/ladder.LadderService/RestoreToTransaction":   true,
+	"/ladder.LadderService/ExportPlayerData":       true,
+	"/ladder.LadderService/ErasePlayer":            true,
+	"/ladder.LadderService/NormalizePlayerNames":   true,
+	"/ladder.LadderService/IssuePlayerToken":       true,
+	"/ladder.LadderService/OpenSession":            true,
+	"/ladder.LadderService/CloseSession":           true,
+	"/ladder.LadderService/RecordAttendance":       true,
+	"/ladder.LadderService/PromoteFromWaitingList": true,
+	"/ladder.LadderService/ListJoinRequests":       true,
+	"/ladder.LadderService/DecideJoinRequest":      true,
+	"/ladder.LadderService/SaveTeam":               true,
+	"/ladder.LadderService/RecordFixture":          true,
+	"/ladder.LadderService/CreateApiKey":           true,
+	"/ladder.LadderService/ListApiKeys":            true,
+	"/ladder.LadderService/RevokeApiKey":           true,
+	"/ladder.LadderService/ExportAuditTranscript":  true,
+}
+
+type adminKey struct{}
+
+// AsAdmin marks ctx as an admin's, for programs that call the service directly
+// rather than over the network
+func AsAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// isAdmin reports whether the request carries the admin token, for RPCs open to
+// everyone with options only an admin may use
+func isAdmin(ctx context.Context) bool {
+	v, _ := ctx.Value(adminKey{}).(bool)
+	return v
+}
+
+// adminUnaryInterceptor rejects admin RPCs unless the request carries
+// "authorization: Bearer <token>", or an admin API key from keys, which may be nil.
+// Admin RPCs are disabled when no token is configured.
+func adminUnaryInterceptor(token string, keys *APIKeys) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		admin := token != "" && hasBearerToken(ctx, token)
+		if !admin && token != "" {
+			if id, role := keys.identifyRPC(ctx); role == ladderpb.ApiKeyRole_API_KEY_ROLE_ADMIN {
+				admin = true
+				ctx = context.WithValue(ctx, apiKeyAuthKey{}, id)
+			}
+		}
+		if !adminMethods[info.FullMethod] {
+			if admin {
+				ctx = context.WithValue(ctx, adminKey{}, true)
+			}
+			return handler(ctx, req)
+		}
+		if token == "" {
+			return nil, status.Error(codes.PermissionDenied, "admin RPCs are disabled: no admin token configured")
+		}
+		if !admin {
+			return nil, status.Error(codes.Unauthenticated, "admin token required")
+		}
+		return handler(context.WithValue(ctx, adminKey{}, true), req)
+	}
+}
+
+func hasBearerToken(ctx context.Context, token string) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, v := range md.Get("authorization") {
+		got := strings.TrimPrefix(v, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBearerHeader is hasBearerToken for plain HTTP endpoints
+func hasBearerHeader(r *http.Request, token string) bool {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
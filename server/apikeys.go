@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyPrefix starts every API key, so a leaked key is easy to recognise
+const apiKeyPrefix = "lk_"
+
+// apiKeyRecord is a stored API key. Only a hash of the secret is kept.
+type apiKeyRecord struct {
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	Role      ladderpb.ApiKeyRole `json:"role"`
+	Hash      string              `json:"hash"` // Hex SHA-256 of the whole key
+	CreatedMs int64               `json:"created_ms"`
+	ExpiresMs int64               `json:"expires_ms,omitempty"`
+	RevokedMs int64               `json:"revoked_ms,omitempty"`
+}
+
+// APIKeys holds the revocable credentials given to integrations such as the kiosk,
+// a chat bot or the sheets mirror, so each can be cut off without changing the token
+// the others use. Keys are server-wide and kept in a JSON file.
+type APIKeys struct {
+	path string
+	now  func() time.Time
+
+	mu   sync.RWMutex
+	keys []*apiKeyRecord
+}
+
+// OpenAPIKeys loads the keys kept at path, which need not exist yet
+func OpenAPIKeys(path string) (*APIKeys, error) {
+	k := &APIKeys{path: path, now: time.Now}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &k.keys); err != nil {
+		return nil, fmt.Errorf("invalid API key file %s: %v", path, err)
+	}
+	return k, nil
+}
+
+// Create makes a key for name with role, expiring after ttl unless it is zero. It
+// returns the key, which is not stored and cannot be recovered.
+func (k *APIKeys) Create(name string, role ladderpb.ApiKeyRole, ttl time.Duration) (*ladderpb.ApiKey, string, error) {
+	if role != ladderpb.ApiKeyRole_API_KEY_ROLE_MEMBER && role != ladderpb.ApiKeyRole_API_KEY_ROLE_ADMIN {
+		return nil, "", status.Error(codes.InvalidArgument, "give the key a role")
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, "", status.Error(codes.InvalidArgument, "give the key a name")
+	}
+	if ttl < 0 {
+		return nil, "", status.Error(codes.InvalidArgument, "ttl_days cannot be negative")
+	}
+
+	id := make([]byte, 6)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	rec := &apiKeyRecord{
+		ID:        hex.EncodeToString(id),
+		Name:      strings.TrimSpace(name),
+		Role:      role,
+		CreatedMs: k.now().UnixMilli(),
+	}
+	key := apiKeyPrefix + rec.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	rec.Hash = hashAPIKey(key)
+	if ttl > 0 {
+		rec.ExpiresMs = k.now().Add(ttl).UnixMilli()
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append(k.keys, rec)
+	if err := k.saveLocked(); err != nil {
+		k.keys = k.keys[:len(k.keys)-1]
+		return nil, "", err
+	}
+	return rec.toProto(), key, nil
+}
+
+// List returns the keys, oldest first, leaving out revoked ones unless asked
+func (k *APIKeys) List(includeRevoked bool) []*ladderpb.ApiKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := []*ladderpb.ApiKey{}
+	for _, rec := range k.keys {
+		if rec.RevokedMs == 0 || includeRevoked {
+			keys = append(keys, rec.toProto())
+		}
+	}
+	return keys
+}
+
+// Revoke stops a key from working
+func (k *APIKeys) Revoke(id string) (*ladderpb.ApiKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, rec := range k.keys {
+		if rec.ID != id {
+			continue
+		}
+		if rec.RevokedMs != 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "API key %s is already revoked", id)
+		}
+		rec.RevokedMs = k.now().UnixMilli()
+		if err := k.saveLocked(); err != nil {
+			rec.RevokedMs = 0
+			return nil, err
+		}
+		return rec.toProto(), nil
+	}
+	return nil, status.Errorf(codes.NotFound, "API key %s not found", id)
+}
+
+// Role returns the role of a live key, or API_KEY_ROLE_UNSPECIFIED for anything else
+func (k *APIKeys) Role(key string) ladderpb.ApiKeyRole {
+	_, role := k.identify(key)
+	return role
+}
+
+// identify returns the ID and role of a live key, or API_KEY_ROLE_UNSPECIFIED
+func (k *APIKeys) identify(key string) (string, ladderpb.ApiKeyRole) {
+	if k == nil || !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	hash := hashAPIKey(key)
+	now := k.now().UnixMilli()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, rec := range k.keys {
+		if rec.ID != id || subtle.ConstantTimeCompare([]byte(rec.Hash), []byte(hash)) != 1 {
+			continue
+		}
+		if rec.RevokedMs != 0 || (rec.ExpiresMs != 0 && now >= rec.ExpiresMs) {
+			break
+		}
+		return rec.ID, rec.Role
+	}
+	return "", ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED
+}
+
+// roleOf returns the role of the API key sent as a bearer token on an RPC
+func (k *APIKeys) roleOf(ctx context.Context) ladderpb.ApiKeyRole {
+	_, role := k.identifyRPC(ctx)
+	return role
+}
+
+// identifyRPC returns the ID and role of the API key sent as a bearer token on an RPC
+func (k *APIKeys) identifyRPC(ctx context.Context) (string, ladderpb.ApiKeyRole) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if id, role := k.identify(strings.TrimPrefix(v, "Bearer ")); role != ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED {
+			return id, role
+		}
+	}
+	return "", ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED
+}
+
+// saveLocked writes the keys through a temporary file, so a crash leaves the old
+// file whole. The caller must hold k.mu.
+func (k *APIKeys) saveLocked() error {
+	data, err := json.MarshalIndent(k.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0755); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (rec *apiKeyRecord) toProto() *ladderpb.ApiKey {
+	return &ladderpb.ApiKey{
+		Id:        rec.ID,
+		Name:      rec.Name,
+		Role:      rec.Role,
+		CreatedMs: rec.CreatedMs,
+		ExpiresMs: rec.ExpiresMs,
+		RevokedMs: rec.RevokedMs,
+	}
+}
+
+type apiKeyAuthKey struct{}
+
+// viaAPIKey reports whether the request was let in by an API key rather than the
+// admin token
+func viaAPIKey(ctx context.Context) bool {
+	return apiKeyID(ctx) != ""
+}
+
+// apiKeyID returns the ID of the admin API key that let the request in, if any
+func apiKeyID(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyAuthKey{}).(string)
+	return id
+}
+
+// checkKeyManagement lets only the admin token itself manage keys, so a leaked
+// admin key cannot mint more
+func (h *LadderService) checkKeyManagement(ctx context.Context) error {
+	if h.apiKeys == nil {
+		return status.Error(codes.FailedPrecondition, "API keys are not enabled on this server")
+	}
+	if viaAPIKey(ctx) {
+		return status.Error(codes.PermissionDenied, "API keys cannot manage API keys; use the admin token")
+	}
+	return nil
+}
+
+// CreateApiKey creates a revocable credential for an integration
+func (h *LadderService) CreateApiKey(ctx context.Context, req *ladderpb.CreateApiKeyRequest) (*ladderpb.CreateApiKeyResponse, error) {
+	if err := h.checkKeyManagement(ctx); err != nil {
+		return nil, err
+	}
+	key, secret, err := h.apiKeys.Create(req.Name, req.Role, time.Duration(req.TtlDays)*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.CreateApiKeyResponse{ApiKey: key, Key: secret}, nil
+}
+
+// ListApiKeys lists the API keys without their secrets
+func (h *LadderService) ListApiKeys(ctx context.Context, req *ladderpb.ListApiKeysRequest) (*ladderpb.ListApiKeysResponse, error) {
+	if err := h.checkKeyManagement(ctx); err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListApiKeysResponse{ApiKeys: h.apiKeys.List(req.IncludeRevoked)}, nil
+}
+
+// RevokeApiKey stops a key from working
+func (h *LadderService) RevokeApiKey(ctx context.Context, req *ladderpb.RevokeApiKeyRequest) (*ladderpb.RevokeApiKeyResponse, error) {
+	if err := h.checkKeyManagement(ctx); err != nil {
+		return nil, err
+	}
+	key, err := h.apiKeys.Revoke(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.RevokeApiKeyResponse{ApiKey: key}, nil
+}
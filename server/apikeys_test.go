@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	keys, err := OpenAPIKeys(path)
+	if err != nil {
+		t.Fatalf("OpenAPIKeys failed: %v", err)
+	}
+	now := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	keys.now = func() time.Time { return now }
+
+	if _, _, err := keys.Create("kiosk", ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED, 0); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without a role, got %v", err)
+	}
+	kiosk, kioskKey, err := keys.Create("kiosk", ladderpb.ApiKeyRole_API_KEY_ROLE_MEMBER, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	_, botKey, err := keys.Create("slack bot", ladderpb.ApiKeyRole_API_KEY_ROLE_ADMIN, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if role := keys.Role(kioskKey); role != ladderpb.ApiKeyRole_API_KEY_ROLE_MEMBER {
+		t.Errorf("expected the kiosk key to be a member key, got %v", role)
+	}
+	if role := keys.Role(botKey); role != ladderpb.ApiKeyRole_API_KEY_ROLE_ADMIN {
+		t.Errorf("expected the bot key to be an admin key, got %v", role)
+	}
+	if role := keys.Role(kioskKey + "x"); role != ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED {
+		t.Errorf("expected a wrong key to have no role, got %v", role)
+	}
+
+	// Keys survive a restart
+	reopened, err := OpenAPIKeys(path)
+	if err != nil {
+		t.Fatalf("OpenAPIKeys failed: %v", err)
+	}
+	reopened.now = keys.now
+	if role := reopened.Role(botKey); role != ladderpb.ApiKeyRole_API_KEY_ROLE_ADMIN {
+		t.Errorf("expected the bot key after reopening, got %v", role)
+	}
+
+	now = now.Add(25 * time.Hour)
+	if role := keys.Role(botKey); role != ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED {
+		t.Errorf("expected the bot key to have expired, got %v", role)
+	}
+
+	if _, err := keys.Revoke(kiosk.Id); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if role := keys.Role(kioskKey); role != ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED {
+		t.Errorf("expected the revoked key to stop working, got %v", role)
+	}
+	if _, err := keys.Revoke(kiosk.Id); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition revoking twice, got %v", err)
+	}
+	if got := len(keys.List(false)); got != 1 {
+		t.Errorf("expected 1 live key, got %d", got)
+	}
+	if got := len(keys.List(true)); got != 2 {
+		t.Errorf("expected 2 keys with revoked ones, got %d", got)
+	}
+}
+
+func TestAdminUnaryInterceptor_APIKeys(t *testing.T) {
+	keys, err := OpenAPIKeys(filepath.Join(t.TempDir(), "api_keys.json"))
+	if err != nil {
+		t.Fatalf("OpenAPIKeys failed: %v", err)
+	}
+	_, adminKey, _ := keys.Create("slack bot", ladderpb.ApiKeyRole_API_KEY_ROLE_ADMIN, 0)
+	_, memberKey, _ := keys.Create("kiosk", ladderpb.ApiKeyRole_API_KEY_ROLE_MEMBER, 0)
+	service := &LadderService{apiKeys: keys}
+	intercept := adminUnaryInterceptor("secret", keys)
+	bearer := func(key string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+key))
+	}
+	list := func(ctx context.Context) error {
+		_, err := intercept(ctx, &ladderpb.ListApiKeysRequest{}, &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/ListApiKeys"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return service.ListApiKeys(ctx, req.(*ladderpb.ListApiKeysRequest))
+			})
+		return err
+	}
+
+	if err := list(bearer("secret")); err != nil {
+		t.Errorf("expected the admin token to list keys, got %v", err)
+	}
+	if err := list(bearer(memberKey)); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated for a member key, got %v", err)
+	}
+	// An admin key passes the interceptor but cannot manage keys itself
+	if err := list(bearer(adminKey)); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for an admin key, got %v", err)
+	}
+
+	_, err = intercept(bearer(adminKey), nil, &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/ListClubs"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !isAdmin(ctx) {
+				t.Error("expected an admin key to act as admin")
+			}
+			return nil, nil
+		})
+	if err != nil {
+		t.Errorf("expected an admin key to call admin RPCs, got %v", err)
+	}
+}
@@ -0,0 +1,408 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultMaxAttachmentBytes caps an uploaded file; a phone photo of a scoresheet
+	// is typically 2-5 MB
+	defaultMaxAttachmentBytes = 10 << 20
+	// defaultAttachmentURLTTL is how long a download link stays valid
+	defaultAttachmentURLTTL = time.Hour
+	maxAttachmentsPerMatch  = 5
+	attachmentPath          = "/api/attachments/"
+)
+
+// attachmentTypes are the content types accepted for upload, as sniffed from the file
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// Attachments stores files attached to matches, such as photos of scoresheets, and
+// serves them through signed, short-lived URLs. The files live in a BackupTarget (a
+// local directory or S3 bucket); the log only records that they are attached.
+type Attachments struct {
+	service    *LadderService
+	clubs      *ClubRegistry
+	domain     string
+	store      BackupTarget
+	tokens     signedTokens
+	ttl        time.Duration
+	maxBytes   int64
+	publicURL  string
+	adminToken string
+}
+
+// attachmentClaims is the signed payload of a download link
+type attachmentClaims struct {
+	ID          string `json:"a"`
+	ContentType string `json:"t"`
+	ExpiresMs   int64  `json:"e"`
+}
+
+func (c *attachmentClaims) expiresMs() int64 { return c.ExpiresMs }
+
+// NewAttachments creates an attachment store. publicURL is the externally visible base
+// URL of the server; when empty, download links are relative.
+func NewAttachments(service *LadderService, clubs *ClubRegistry, domain string, store BackupTarget, secret string, ttl time.Duration, maxBytes int64, publicURL, adminToken string) *Attachments {
+	return &Attachments{
+		service:    service,
+		clubs:      clubs,
+		domain:     domain,
+		store:      store,
+		tokens:     signedTokens{secret: []byte(secret), domain: "attachment", noun: "link"},
+		ttl:        orDefault(ttl, defaultAttachmentURLTTL),
+		maxBytes:   orDefault(maxBytes, defaultMaxAttachmentBytes),
+		publicURL:  strings.TrimSuffix(publicURL, "/"),
+		adminToken: adminToken,
+	}
+}
+
+// Sign returns a URL-safe token carrying the claims
+func (a *Attachments) Sign(claims attachmentClaims) string {
+	return a.tokens.sign(&claims)
+}
+
+// Verify checks a token's signature and expiry and returns its claims
+func (a *Attachments) Verify(token string) (*attachmentClaims, error) {
+	var claims attachmentClaims
+	if err := a.tokens.verify(token, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// URL returns a signed download link for an attachment and when it expires
+func (a *Attachments) URL(attachment *ladderpb.Attachment) (string, int64) {
+	claims := attachmentClaims{
+		ID:          attachment.Id,
+		ContentType: attachment.ContentType,
+		ExpiresMs:   time.Now().Add(a.ttl).UnixMilli(),
+	}
+	return a.publicURL + attachmentPath + a.Sign(claims), claims.ExpiresMs
+}
+
+// isAttachmentUpload reports whether r uploads an attachment, which may exceed the usual
+// request size limit
+func isAttachmentUpload(r *http.Request) bool {
+	return r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/api/matches/") && strings.HasSuffix(r.URL.Path, "/attachments")
+}
+
+// ServeHTTP routes uploads to POST /api/matches/<transaction_id>/attachments and
+// downloads from GET /api/attachments/<token>
+func (a *Attachments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case isAttachmentUpload(r):
+		matchID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/matches/"), "/attachments")
+		a.upload(w, r, matchID)
+	case strings.HasPrefix(r.URL.Path, attachmentPath) && r.Method == "GET":
+		a.download(w, r, strings.TrimPrefix(r.URL.Path, attachmentPath))
+	default:
+		writeRESTError(w, codes.NotFound, "not found", map[string]string{"path": r.URL.Path})
+	}
+}
+
+// upload stores the multipart "file" field of the request and attaches it to a match.
+// It needs the admin token, or the player token of one of the match's players.
+func (a *Attachments) upload(w http.ResponseWriter, r *http.Request, matchID string) {
+	ctx, err := clubHTTPContext(r, a.clubs, a.domain)
+	if err != nil {
+		writeRESTError(w, codes.NotFound, err.Error(), nil)
+		return
+	}
+	switch {
+	case a.adminToken != "" && hasBearerHeader(r, a.adminToken):
+		ctx = context.WithValue(ctx, adminKey{}, true)
+	case r.Header.Get(playerTokenHeader) != "" && a.service.playerAuth != nil:
+		claims, err := a.service.playerAuth.Verify(r.Header.Get(playerTokenHeader))
+		if err != nil {
+			writeRESTError(w, codes.Unauthenticated, err.Error(), nil)
+			return
+		}
+		ctx = context.WithValue(ctx, playerClaimsKey{}, claims)
+	default:
+		writeRESTError(w, codes.Unauthenticated, "an admin or player token is required", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.maxBytes+1<<20) // Room for the multipart framing
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeRESTError(w, codes.InvalidArgument, "expected a multipart form with a \"file\" field", nil)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, a.maxBytes+1))
+	if err != nil {
+		writeRESTError(w, codes.InvalidArgument, err.Error(), nil)
+		return
+	}
+	if int64(len(data)) > a.maxBytes {
+		writeRESTError(w, codes.InvalidArgument, fmt.Sprintf("attachments can be at most %d bytes", a.maxBytes), nil)
+		return
+	}
+
+	attachment, err := a.attach(ctx, matchID, data)
+	if err != nil {
+		writeRESTErr(w, err)
+		return
+	}
+	url, expires := a.URL(attachment)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachmentResponse{
+		ID:          attachment.Id,
+		ContentType: attachment.ContentType,
+		SizeBytes:   attachment.SizeBytes,
+		URL:         url,
+		ExpiresMs:   expires,
+	})
+}
+
+// attachmentResponse is the JSON body of a successful upload
+type attachmentResponse struct {
+	ID          string `json:"id"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	URL         string `json:"url"`        // Signed download link
+	ExpiresMs   int64  `json:"expires_ms"` // When url stops working
+}
+
+// attach stores data and records it as attached to a match, on behalf of the admin or
+// player the context identifies
+func (a *Attachments) attach(ctx context.Context, matchID string, data []byte) (*ladderpb.Attachment, error) {
+	var m *Model
+	var uploadedBy string
+	if isAdmin(ctx) {
+		m = a.service.modelFor(ctx)
+	} else {
+		var err error
+		if m, uploadedBy, err = a.service.currentPlayer(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	contentType := http.DetectContentType(data)
+	if !attachmentTypes[contentType] {
+		return nil, localizedStatusf(codes.InvalidArgument, "attachments must be a JPEG, PNG or WebP image or a PDF")
+	}
+
+	// The file is stored first so the log never refers to a missing one
+	id := m.newID()
+	if err := a.store.Put(ctx, id, data); err != nil {
+		log.Printf("Failed to store attachment %s: %v", id, err)
+		return nil, status.Error(codes.Unavailable, "failed to store the attachment")
+	}
+	attachment, err := m.AttachToMatch(id, matchID, contentType, int64(len(data)), uploadedBy)
+	if err != nil {
+		if err := a.store.Delete(ctx, id); err != nil {
+			log.Printf("Failed to delete unused attachment %s: %v", id, err)
+		}
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// download serves the attachment a signed link refers to
+func (a *Attachments) download(w http.ResponseWriter, r *http.Request, token string) {
+	claims, err := a.Verify(token)
+	if err != nil {
+		writeRESTError(w, codes.PermissionDenied, err.Error(), nil)
+		return
+	}
+	data, err := a.store.Get(r.Context(), claims.ID)
+	if err != nil {
+		log.Printf("Failed to read attachment %s: %v", claims.ID, err)
+		writeRESTError(w, codes.NotFound, "attachment not found", nil)
+		return
+	}
+	w.Header().Set("Content-Type", claims.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The link is the credential, so shared caches must not keep a copy
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(int64(a.ttl/time.Second), 10))
+	w.Write(data)
+}
+
+func attachmentFromStorage(t *storagepb.TransactionStorage) *ladderpb.Attachment {
+	p := t.GetAttachmentPayload()
+	return &ladderpb.Attachment{
+		Id:           t.Id,
+		ContentType:  p.GetContentType(),
+		SizeBytes:    p.GetSizeBytes(),
+		UploadedAtMs: t.TimestampMs,
+		UploadedBy:   p.GetUploadedBy(),
+	}
+}
+
+// matchAttachments returns the attachments of every match by its transaction ID,
+// oldest first, leaving out those that were undone
+func matchAttachments(txs []*storagepb.TransactionStorage) map[string][]*ladderpb.Attachment {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+	attachments := make(map[string][]*ladderpb.Attachment)
+	for _, t := range txs {
+		if p := t.GetAttachmentPayload(); p != nil && !invalidated[t.Id] {
+			attachments[p.MatchTransactionId] = append(attachments[p.MatchTransactionId], attachmentFromStorage(t))
+		}
+	}
+	return attachments
+}
+
+// AttachToMatch records that the file stored under id is attached to a match.
+// uploadedBy is the ID of the player attaching it, who must have played the match,
+// or empty for an admin.
+func (m *Model) AttachToMatch(id, matchID, contentType string, size int64, uploadedBy string) (*ladderpb.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	var match *storagepb.MatchResultStorage
+	for _, t := range txs {
+		if t.Id == matchID {
+			match = t.GetMatchResultPayload()
+		}
+		if inv := t.GetInvalidateMatchPayload(); inv != nil && slices.Contains(replay.InvalidatedIDs(inv), matchID) {
+			match = nil
+			break
+		}
+	}
+	if match == nil {
+		return nil, localizedStatusf(codes.NotFound, "match not found: %s", matchID)
+	}
+	if uploadedBy != "" && uploadedBy != match.ChallengerId && uploadedBy != match.DefenderId {
+		return nil, localizedStatusf(codes.PermissionDenied, "only the players of a match can attach files to it")
+	}
+	if len(matchAttachments(txs)[matchID]) >= maxAttachmentsPerMatch {
+		return nil, localizedStatusf(codes.FailedPrecondition, "a match can have at most %d attachments", maxAttachmentsPerMatch)
+	}
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	tx := &storagepb.TransactionStorage{
+		Id:          id,
+		Type:        storagepb.TransactionType_ATTACHMENT,
+		TimestampMs: m.now().UnixMilli(),
+		Payload: &storagepb.TransactionStorage_AttachmentPayload{AttachmentPayload: &storagepb.AttachmentStorage{
+			MatchTransactionId: matchID,
+			ContentType:        contentType,
+			SizeBytes:          size,
+			UploadedBy:         uploadedBy,
+		}},
+		PlayerList: ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+	return attachmentFromStorage(tx), nil
+}
+
+// playerAttachments returns the IDs of the files attached to a player's matches,
+// those of undone matches included
+func (m *Model) playerAttachments(playerID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	played := make(map[string]bool)
+	var ids []string
+	for _, t := range txs {
+		if mr := t.GetMatchResultPayload(); mr != nil && (mr.ChallengerId == playerID || mr.DefenderId == playerID) {
+			played[t.Id] = true
+		}
+		if p := t.GetAttachmentPayload(); p != nil && (played[p.MatchTransactionId] || p.UploadedBy == playerID) {
+			ids = append(ids, t.Id)
+		}
+	}
+	return ids, nil
+}
+
+// forget deletes the files attached to a player's matches. The log still records that
+// they were attached, but their links no longer work.
+func (a *Attachments) forget(ctx context.Context, m *Model, playerID string) error {
+	ids, err := m.playerAttachments(playerID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := a.store.Delete(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete attachment %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Attachment returns an attachment of a valid match on this ladder
+func (m *Model) Attachment(id string) (*ladderpb.Attachment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+	for matchID, attachments := range matchAttachments(txs) {
+		for _, a := range attachments {
+			if a.Id == id && !invalidated[matchID] {
+				return a, nil
+			}
+		}
+	}
+	return nil, localizedStatusf(codes.NotFound, "attachment not found: %s", id)
+}
+
+// GetAttachmentURL returns a signed download link for a match attachment
+func (h *LadderService) GetAttachmentURL(ctx context.Context, req *ladderpb.GetAttachmentURLRequest) (*ladderpb.GetAttachmentURLResponse, error) {
+	if h.attachments == nil {
+		return nil, status.Error(codes.FailedPrecondition, "attachments are not enabled on this server")
+	}
+	attachment, err := h.modelFor(ctx).Attachment(req.AttachmentId)
+	if err != nil {
+		return nil, err
+	}
+	url, expires := h.attachments.URL(attachment)
+	return &ladderpb.GetAttachmentURLResponse{Url: url, ExpiresAtMs: expires}, nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestAttachments(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	matchID, err := m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	if err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+
+	svc := NewLadderService(m)
+	svc.playerAuth = NewPlayerAuth("player-secret", nil)
+	attachments := NewAttachments(svc, nil, "", dirTarget(t.TempDir()), "secret", 0, 1024, "", "admin")
+	svc.attachments = attachments
+	srv := httptest.NewServer(attachments)
+	defer srv.Close()
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+	upload := func(playerID string, data []byte) *http.Response {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "scoresheet.png")
+		part.Write(data)
+		form.Close()
+		req, _ := http.NewRequest("POST", srv.URL+"/api/matches/"+matchID+"/attachments", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		if playerID != "" {
+			req.Header.Set(playerTokenHeader, svc.playerAuth.Sign(playerClaims{PlayerID: playerID, ExpiresMs: time.Now().Add(time.Hour).UnixMilli()}))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, tc := range []struct {
+		player string
+		data   []byte
+		want   int
+	}{
+		{"", png, http.StatusUnauthorized},
+		{"carol", png, http.StatusForbidden},
+		{"bob", []byte("just some text"), http.StatusBadRequest},
+		{"bob", append(png, bytes.Repeat([]byte{0}, 1024)...), http.StatusBadRequest},
+	} {
+		if resp := upload(tc.player, tc.data); resp.StatusCode != tc.want {
+			t.Errorf("upload by %q of %d bytes: expected %d, got %d", tc.player, len(tc.data), tc.want, resp.StatusCode)
+		}
+	}
+	if resp := upload("alice", png); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the upload to succeed, got %d", resp.StatusCode)
+	}
+
+	matches, _ := m.GetRecentMatches(1)
+	if len(matches[0].Attachments) != 1 || matches[0].Attachments[0].ContentType != "image/png" || matches[0].Attachments[0].UploadedBy != "alice" {
+		t.Fatalf("expected the photo on the match, got %v", matches[0].Attachments)
+	}
+
+	resp, err := svc.GetAttachmentURL(context.Background(), &ladderpb.GetAttachmentURLRequest{AttachmentId: matches[0].Attachments[0].Id})
+	if err != nil {
+		t.Fatalf("GetAttachmentURL failed: %v", err)
+	}
+	got, err := http.Get(srv.URL + resp.Url)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	data, _ := io.ReadAll(got.Body)
+	got.Body.Close()
+	if got.StatusCode != http.StatusOK || got.Header.Get("Content-Type") != "image/png" || !bytes.Equal(data, png) {
+		t.Errorf("expected the photo back, got %d %q with %d bytes", got.StatusCode, got.Header.Get("Content-Type"), len(data))
+	}
+	tampered, _ := http.Get(srv.URL + strings.Replace(resp.Url, ".", ".x", 1))
+	tampered.Body.Close()
+	if tampered.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a tampered link, got %d", tampered.StatusCode)
+	}
+
+	// Undoing the upload takes the attachment off the match
+	if _, _, err := m.UndoLastTransaction(context.Background()); err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	if matches, _ := m.GetRecentMatches(1); len(matches[0].Attachments) != 0 {
+		t.Errorf("expected no attachments after undo, got %v", matches[0].Attachments)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"sort"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/grpc/codes"
+)
+
+// RecordAttendance records players who came to a session, returning the transaction ID.
+// Players who played are counted anyway; this is for those who came and didn't.
+func (m *Model) RecordAttendance(sessionID string, playerIDs []string) (string, error) {
+	if len(playerIDs) == 0 {
+		return "", localizedStatusf(codes.InvalidArgument, "no players to record")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return "", err
+	}
+	if _, err := findSession(sessionSpans(txs), sessionID); err != nil || sessionID == "" {
+		return "", localizedStatusf(codes.NotFound, "session not found")
+	}
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", err
+	}
+	for _, id := range playerIDs {
+		if findPlayer(currentPlayers, id) == nil {
+			return "", localizedStatusf(codes.NotFound, "player %s is not on the ladder", id)
+		}
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_ATTENDANCE,
+		TimestampMs: m.now().UnixMilli(),
+		Payload: &storagepb.TransactionStorage_AttendancePayload{AttendancePayload: &storagepb.AttendanceStorage{
+			SessionId: sessionID,
+			PlayerIds: playerIDs,
+		}},
+		PlayerList: ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	return tx.Id, nil
+}
+
+// AttendanceStats counts every current player's sessions, most attended first
+func (m *Model) AttendanceStats() ([]*ladderpb.AttendanceStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	current := storageToLadder(txs[len(txs)-1].PlayerList)
+	stats := make(map[string]*ladderpb.AttendanceStats, len(current))
+	for _, p := range current {
+		stats[p.Id] = &ladderpb.AttendanceStats{PlayerId: p.Id, Name: p.Name}
+	}
+	active := lastActive(txs, invalidated)
+	for id, ms := range active {
+		if s, ok := stats[id]; ok {
+			s.LastActiveMs = ms
+		}
+	}
+	for _, span := range sessionSpans(txs) {
+		played := make(map[string]bool)
+		for _, t := range span.results(txs, invalidated) {
+			mr := t.GetMatchResultPayload()
+			played[mr.ChallengerId] = true
+			played[mr.DefenderId] = true
+		}
+		for id, s := range stats {
+			if played[id] {
+				s.SessionsPlayed++
+			}
+			if played[id] || span.attended[id] {
+				s.SessionsAttended++
+			}
+		}
+	}
+
+	result := make([]*ladderpb.AttendanceStats, 0, len(current))
+	for _, p := range current {
+		result = append(result, stats[p.Id])
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].SessionsAttended > result[j].SessionsAttended })
+	return result, nil
+}
+
+// lastActive returns when each player last played a valid match or came to a session.
+// Coming to a session counts even without a match, so an inactivity decay should look
+// at this rather than at matches alone.
+func lastActive(txs []*storagepb.TransactionStorage, invalidated map[string]bool) map[string]int64 {
+	active := make(map[string]int64)
+	seen := func(id string, ms int64) {
+		if ms > active[id] {
+			active[id] = ms
+		}
+	}
+	for _, t := range txs {
+		if mr := t.GetMatchResultPayload(); mr != nil && !invalidated[t.Id] {
+			seen(mr.ChallengerId, playedAtMs(t))
+			seen(mr.DefenderId, playedAtMs(t))
+		}
+	}
+	for _, span := range sessionSpans(txs) {
+		for id := range span.attended {
+			seen(id, span.session.OpenedAtMs)
+		}
+	}
+	return active
+}
+
+// RecordAttendance records who came to a club night
+func (h *LadderService) RecordAttendance(ctx context.Context, req *ladderpb.RecordAttendanceRequest) (*ladderpb.RecordAttendanceResponse, error) {
+	txID, err := h.modelFor(ctx).RecordAttendance(req.SessionId, req.PlayerIds)
+	if err != nil {
+		return &ladderpb.RecordAttendanceResponse{Success: false}, err
+	}
+	return &ladderpb.RecordAttendanceResponse{Success: true, TransactionId: txID}, nil
+}
+
+// GetAttendanceStats returns each player's attendance
+func (h *LadderService) GetAttendanceStats(ctx context.Context, req *ladderpb.GetAttendanceStatsRequest) (*ladderpb.GetAttendanceStatsResponse, error) {
+	stats, err := h.modelFor(ctx).AttendanceStats()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.GetAttendanceStatsResponse{Stats: stats}, nil
+}
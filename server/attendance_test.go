@@ -0,0 +1,66 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestModel_Attendance(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+	win := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+
+	first, _ := m.OpenSession("Tuesday club night")
+	m.AddMatchResult("bob", "alice", "bob", win)
+	if _, err := m.RecordAttendance(first.Id, []string{"charlie", "dave"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a player not on the ladder, got %v", err)
+	}
+	if _, err := m.RecordAttendance("missing", []string{"charlie"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a missing session, got %v", err)
+	}
+	// Charlie came but didn't play; Bob is recorded as well as playing
+	if _, err := m.RecordAttendance(first.Id, []string{"charlie", "bob"}); err != nil {
+		t.Fatalf("RecordAttendance failed: %v", err)
+	}
+	m.CloseSession(first.Id)
+
+	second, _ := m.OpenSession("Thursday club night")
+	m.AddMatchResult("charlie", "alice", "charlie", win)
+	m.CloseSession(second.Id)
+
+	summary, _ := m.GetSession(first.Id)
+	if len(summary.Attendance) != 3 {
+		t.Errorf("expected everyone at the first session, got %v", summary.Attendance)
+	}
+
+	stats, err := m.AttendanceStats()
+	if err != nil {
+		t.Fatalf("AttendanceStats failed: %v", err)
+	}
+	byID := make(map[string]*ladderpb.AttendanceStats)
+	for _, s := range stats {
+		byID[s.PlayerId] = s
+	}
+	if s := byID["charlie"]; s.SessionsAttended != 2 || s.SessionsPlayed != 1 {
+		t.Errorf("unexpected stats for Charlie %v", s)
+	}
+	if s := byID["bob"]; s.SessionsAttended != 1 || s.SessionsPlayed != 1 {
+		t.Errorf("unexpected stats for Bob %v", s)
+	}
+	if stats[len(stats)-1].PlayerId != "bob" {
+		t.Errorf("expected the least regular player last, got %v", stats)
+	}
+	if byID["charlie"].LastActiveMs == 0 || byID["bob"].LastActiveMs == 0 {
+		t.Errorf("expected every attendee to have been active, got %v", stats)
+	}
+}
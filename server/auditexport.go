@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// auditFormat names the transcript layout, so a verifier can refuse one it does not know
+const auditFormat = "squash-ladder-audit/1"
+
+// auditHeader is the first line of a transcript
+type auditHeader struct {
+	Format       string `json:"format"`
+	Club         string `json:"club,omitempty"`
+	FromMs       int64  `json:"from_ms"`
+	ToMs         int64  `json:"to_ms"`
+	ExportedAtMs int64  `json:"exported_at_ms"`
+	PublicKey    string `json:"public_key"`
+}
+
+// auditRecord is a match, or the invalidation of one, in a transcript
+type auditRecord struct {
+	Seq            int         `json:"seq"`
+	PrevHash       string      `json:"prev_hash"`
+	TransactionID  string      `json:"transaction_id"`
+	Type           string      `json:"type"`
+	RecordedAtMs   int64       `json:"recorded_at_ms"`
+	PlayedAtMs     int64       `json:"played_at_ms,omitempty"`
+	ChallengerID   string      `json:"challenger_id,omitempty"`
+	ChallengerName string      `json:"challenger_name,omitempty"`
+	DefenderID     string      `json:"defender_id,omitempty"`
+	DefenderName   string      `json:"defender_name,omitempty"`
+	WinnerID       string      `json:"winner_id,omitempty"`
+	Games          []auditGame `json:"games,omitempty"`
+	LateEntry      bool        `json:"late_entry,omitempty"`
+	InsertBeforeID string      `json:"insert_before_id,omitempty"`
+	Invalidates    []string    `json:"invalidates,omitempty"`
+}
+
+// auditGame is the score of one game, challenger first
+type auditGame struct {
+	Challenger        int32 `json:"challenger"`
+	Defender          int32 `json:"defender"`
+	ChallengerDefault bool  `json:"challenger_default,omitempty"`
+	DefenderDefault   bool  `json:"defender_default,omitempty"`
+}
+
+// GenerateAuditKeys returns a new Ed25519 key pair for signing audit transcripts: the
+// private key for the server's AuditSigningKey and the public key to give the league
+func GenerateAuditKeys() (privateKey, publicKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(priv.Seed()), enc.EncodeToString(pub), nil
+}
+
+// parseAuditKey decodes a private key made by GenerateAuditKeys
+func parseAuditKey(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid audit signing key: expected %d base64url bytes", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// auditRecords returns the matches played in [fromMs, toMs) and the invalidations of
+// them, in log order and without their hashes. Later results and invalidations are
+// recorded after the earlier ones, so a later export of a period starts with the
+// records of an earlier one unless the log was changed. Erasing a player renames them
+// in every record, so it changes the hashes too.
+func (m *Model) auditRecords(ctx context.Context, fromMs, toMs int64) ([]*auditRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := playerNames(txs)
+	included := make(map[string]bool)
+	records := []*auditRecord{}
+	for _, t := range txs {
+		rec := &auditRecord{TransactionID: t.Id, Type: t.Type.String(), RecordedAtMs: t.TimestampMs}
+		if p := t.GetMatchResultPayload(); p != nil {
+			if playedAtMs(t) < fromMs || playedAtMs(t) >= toMs {
+				continue
+			}
+			included[t.Id] = true
+			rec.PlayedAtMs = playedAtMs(t)
+			rec.ChallengerID, rec.ChallengerName = p.ChallengerId, names[p.ChallengerId]
+			rec.DefenderID, rec.DefenderName = p.DefenderId, names[p.DefenderId]
+			rec.WinnerID = p.WinnerId
+			rec.LateEntry = p.LateEntry
+			rec.InsertBeforeID = p.InsertBeforeId
+			for _, s := range p.SetScores {
+				rec.Games = append(rec.Games, auditGame{
+					Challenger:        s.ChallengerPoints,
+					Defender:          s.DefenderPoints,
+					ChallengerDefault: s.ChallengerDefault,
+					DefenderDefault:   s.DefenderDefault,
+				})
+			}
+			records = append(records, rec)
+			continue
+		}
+		if t.Type != storagepb.TransactionType_INVALIDATE_MATCH {
+			continue
+		}
+		for _, id := range replay.InvalidatedIDs(t.GetInvalidateMatchPayload()) {
+			if included[id] {
+				rec.Invalidates = append(rec.Invalidates, id)
+			}
+		}
+		if len(rec.Invalidates) > 0 {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+// writeAuditTranscript chains and signs the records. Every line but the last is the
+// hex SHA-256 of a JSON object, a space and the object itself. The first object is
+// the header; each record after it holds the hash of the line before as prev_hash.
+// The last line is "signature " and the base64url Ed25519 signature of the last hash.
+func writeAuditTranscript(key ed25519.PrivateKey, header auditHeader, records []*auditRecord) (string, string, error) {
+	var b strings.Builder
+	line := func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		b.WriteString(hash + " ")
+		b.Write(data)
+		b.WriteString("\n")
+		return hash, nil
+	}
+
+	head, err := line(header)
+	if err != nil {
+		return "", "", err
+	}
+	for i, rec := range records {
+		rec.Seq = i + 1
+		rec.PrevHash = head
+		if head, err = line(rec); err != nil {
+			return "", "", err
+		}
+	}
+	b.WriteString("signature " + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(head))) + "\n")
+	return b.String(), head, nil
+}
+
+// VerifyAuditTranscript checks a transcript from ExportAuditTranscript against the
+// club's public key: that every line hashes to its hash, that the records chain in
+// order and that the signature covers the last one. It returns the number of records.
+func VerifyAuditTranscript(transcript, publicKey string) (int, error) {
+	pub, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return 0, fmt.Errorf("invalid public key: expected %d base64url bytes", ed25519.PublicKeySize)
+	}
+
+	var head string
+	records := -1 // The header is not a record
+	scanner := bufio.NewScanner(strings.NewReader(transcript))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if sig, ok := strings.CutPrefix(text, "signature "); ok {
+			if head == "" {
+				return 0, fmt.Errorf("the transcript has no header")
+			}
+			raw, err := base64.RawURLEncoding.DecodeString(sig)
+			if err != nil || !ed25519.Verify(pub, []byte(head), raw) {
+				return 0, fmt.Errorf("the signature does not match the public key")
+			}
+			if scanner.Scan() {
+				return 0, fmt.Errorf("unexpected lines after the signature")
+			}
+			return records, nil
+		}
+
+		hash, data, _ := strings.Cut(text, " ")
+		sum := sha256.Sum256([]byte(data))
+		if hex.EncodeToString(sum[:]) != hash {
+			return 0, fmt.Errorf("line %d does not match its hash", records+2)
+		}
+		if head == "" {
+			var header auditHeader
+			if err := json.Unmarshal([]byte(data), &header); err != nil || header.Format != auditFormat {
+				return 0, fmt.Errorf("not a %s transcript", auditFormat)
+			}
+		} else {
+			var rec auditRecord
+			if err := json.Unmarshal([]byte(data), &rec); err != nil {
+				return 0, fmt.Errorf("line %d: %v", records+2, err)
+			}
+			if rec.PrevHash != head || rec.Seq != records+1 {
+				return 0, fmt.Errorf("record %d does not follow the one before it", records+1)
+			}
+		}
+		head = hash
+		records++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("the transcript is not signed")
+}
+
+// ExportAuditTranscript returns a signed, hash-chained transcript of the matches
+// played in a period
+func (h *LadderService) ExportAuditTranscript(ctx context.Context, req *ladderpb.ExportAuditTranscriptRequest) (*ladderpb.ExportAuditTranscriptResponse, error) {
+	if h.auditKey == nil {
+		return nil, status.Error(codes.FailedPrecondition, "audit exports need an audit signing key")
+	}
+	if req.FromMs >= req.ToMs {
+		return nil, status.Error(codes.InvalidArgument, "from_ms must be before to_ms")
+	}
+	m := h.modelFor(ctx)
+	records, err := m.auditRecords(ctx, req.FromMs, req.ToMs)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := base64.RawURLEncoding.EncodeToString(h.auditKey.Public().(ed25519.PublicKey))
+	header := auditHeader{
+		Format:       auditFormat,
+		Club:         h.clubIDFor(m),
+		FromMs:       req.FromMs,
+		ToMs:         req.ToMs,
+		ExportedAtMs: time.Now().UnixMilli(),
+		PublicKey:    publicKey,
+	}
+	transcript, head, err := writeAuditTranscript(h.auditKey, header, records)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ExportAuditTranscriptResponse{
+		Transcript:  transcript,
+		PublicKey:   publicKey,
+		RecordCount: int32(len(records)),
+		HeadHash:    head,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExportAuditTranscript(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	start := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	m.SetClock(NewSteppingClock(start, time.Minute))
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	first, _ := m.AddMatchResult("bob", "alice", "bob", threeLove)
+	m.AddMatchResultAt("carol", "bob", "carol", threeLove, start.AddDate(0, -1, 0), false, false)
+	m.AddMatchResult("carol", "alice", "carol", threeLove)
+	if err := m.InvalidateMatchResult(ctx, first); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+
+	s := NewLadderService(m)
+	req := &ladderpb.ExportAuditTranscriptRequest{FromMs: start.UnixMilli(), ToMs: start.AddDate(0, 1, 0).UnixMilli()}
+	if _, err := s.ExportAuditTranscript(ctx, req); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition without a signing key, got %v", err)
+	}
+
+	private, public, err := GenerateAuditKeys()
+	if err != nil {
+		t.Fatalf("GenerateAuditKeys failed: %v", err)
+	}
+	if s.auditKey, err = parseAuditKey(private); err != nil {
+		t.Fatalf("parseAuditKey failed: %v", err)
+	}
+	resp, err := s.ExportAuditTranscript(ctx, req)
+	if err != nil {
+		t.Fatalf("ExportAuditTranscript failed: %v", err)
+	}
+	// The two matches played in March and the invalidation of one; not last month's
+	if resp.RecordCount != 3 || resp.PublicKey != public {
+		t.Errorf("expected 3 records signed by %s, got %d by %s", public, resp.RecordCount, resp.PublicKey)
+	}
+	if n, err := VerifyAuditTranscript(resp.Transcript, public); err != nil || n != 3 {
+		t.Errorf("expected the transcript to verify with 3 records, got %d, %v", n, err)
+	}
+
+	lines := strings.SplitAfter(resp.Transcript, "\n")
+	tampered := map[string]string{
+		"edited score":   strings.Replace(resp.Transcript, `"challenger":11,"defender":5`, `"challenger":11,"defender":9`, 1),
+		"dropped record": strings.Join(append(append([]string{}, lines[:2]...), lines[3:]...), ""),
+		"no signature":   strings.Join(lines[:len(lines)-2], ""),
+	}
+	for name, transcript := range tampered {
+		if _, err := VerifyAuditTranscript(transcript, public); err == nil {
+			t.Errorf("%s: expected verification to fail", name)
+		}
+	}
+	_, otherPublic, _ := GenerateAuditKeys()
+	if _, err := VerifyAuditTranscript(resp.Transcript, otherPublic); err == nil {
+		t.Error("expected verification with another key to fail")
+	}
+}
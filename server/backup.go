@@ -0,0 +1,358 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	backupsTaken   = expvar.NewInt("backups_taken")
+	backupFailures = expvar.NewInt("backup_failures")
+)
+
+// defaultBackupKeep is how many backups of each ladder are kept when no retention is set
+const defaultBackupKeep = 14
+
+// backupTimeFormat is the timestamp in backup names; it sorts chronologically
+const backupTimeFormat = "20060102T150405Z"
+
+// BackupTarget is somewhere backups are stored
+type BackupTarget interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+	// List returns the names of all stored backups, in any order
+	List(ctx context.Context) ([]string, error)
+}
+
+// BackupConfig selects where backups go: a local directory, or an S3-compatible
+// bucket when S3Bucket is set
+type BackupConfig struct {
+	Dir string
+
+	S3Endpoint  string // Default "https://s3.<region>.amazonaws.com"
+	S3Bucket    string
+	S3Prefix    string
+	S3Region    string // Default "us-east-1"
+	S3AccessKey string
+	S3SecretKey string
+
+	// Keep is how many backups of each ladder to retain (default 14)
+	Keep int
+}
+
+// Target returns the configured backup target, or an error if none is configured
+func (c BackupConfig) Target() (BackupTarget, error) {
+	if c.S3Bucket != "" {
+		if c.S3AccessKey == "" || c.S3SecretKey == "" {
+			return nil, fmt.Errorf("S3 backups need an access key and secret key")
+		}
+		region := c.S3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint := c.S3Endpoint
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		return &s3Target{
+			endpoint:  endpoint,
+			bucket:    c.S3Bucket,
+			prefix:    c.S3Prefix,
+			region:    region,
+			accessKey: c.S3AccessKey,
+			secretKey: c.S3SecretKey,
+			client:    &http.Client{Timeout: 5 * time.Minute},
+		}, nil
+	}
+	if c.Dir != "" {
+		if err := os.MkdirAll(c.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create backup directory: %v", err)
+		}
+		return dirTarget(c.Dir), nil
+	}
+	return nil, fmt.Errorf("no backup directory or S3 bucket is configured")
+}
+
+// dirTarget stores backups as files in a local directory
+type dirTarget string
+
+func (d dirTarget) Put(ctx context.Context, name string, data []byte) error {
+	tmp, err := os.CreateTemp(string(d), name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(string(d), name))
+}
+
+func (d dirTarget) Get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.Base(name)))
+}
+
+func (d dirTarget) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(string(d), filepath.Base(name)))
+}
+
+func (d dirTarget) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".jsonl") {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// Snapshot returns a consistent copy of the log. Writes wait while it is read.
+func (m *Model) Snapshot() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, err := os.ReadFile(m.LogFilePath)
+	if os.IsNotExist(err) {
+		return []byte{}, nil
+	}
+	return data, err
+}
+
+// BackupJob copies the ladder's log, and every club's, to a BackupTarget on a
+// cron schedule, keeping only the newest few of each
+type BackupJob struct {
+	model    *Model
+	clubs    *ClubRegistry // nil unless hosting multiple clubs
+	target   BackupTarget
+	schedule *cronSchedule
+	keep     int
+}
+
+// NewBackupJob creates a job that runs on schedule, a cron expression such as
+// "0 3 * * *" (UTC). keep is the number of backups retained per ladder.
+func NewBackupJob(m *Model, clubs *ClubRegistry, target BackupTarget, schedule string, keep int) (*BackupJob, error) {
+	s, err := parseCron(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup schedule: %v", err)
+	}
+	if keep <= 0 {
+		keep = defaultBackupKeep
+	}
+	return &BackupJob{model: m, clubs: clubs, target: target, schedule: s, keep: keep}, nil
+}
+
+// Start runs the job in the background until stop is closed
+func (j *BackupJob) Start(stop <-chan struct{}) {
+	go func() {
+		for {
+			next := j.schedule.next(time.Now())
+			if next.IsZero() {
+				log.Printf("backup: schedule never fires; backups are disabled")
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+				if _, err := j.RunOnce(ctx); err != nil {
+					log.Printf("backup: %v", err)
+				}
+				cancel()
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// RunOnce backs up every ladder now, prunes old backups and returns the names written
+func (j *BackupJob) RunOnce(ctx context.Context) ([]string, error) {
+	stamp := time.Now().UTC().Format(backupTimeFormat)
+	ladders := map[string]*Model{"ladder": j.model}
+	if j.clubs != nil {
+		clubs, err := j.clubs.ListClubs()
+		if err != nil {
+			backupFailures.Add(1)
+			return nil, fmt.Errorf("failed to list clubs: %v", err)
+		}
+		for _, c := range clubs {
+			m, err := j.clubs.Model(c.Id)
+			if err != nil {
+				backupFailures.Add(1)
+				return nil, err
+			}
+			ladders["club-"+c.Id] = m
+		}
+	}
+
+	var written []string
+	var failed []string
+	for prefix, m := range ladders {
+		name := prefix + "-" + stamp + ".jsonl"
+		data, err := m.Snapshot()
+		if err == nil {
+			err = j.target.Put(ctx, name, data)
+		}
+		if err != nil {
+			backupFailures.Add(1)
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		backupsTaken.Add(1)
+		written = append(written, name)
+	}
+	sort.Strings(written)
+	log.Printf("backup: wrote %d backups", len(written))
+
+	if err := j.prune(ctx); err != nil {
+		log.Printf("backup: failed to prune old backups: %v", err)
+	}
+	if len(failed) > 0 {
+		return written, fmt.Errorf("failed to write %s", strings.Join(failed, "; "))
+	}
+	return written, nil
+}
+
+// prune deletes all but the newest j.keep backups of each ladder
+func (j *BackupJob) prune(ctx context.Context) error {
+	names, err := j.target.List(ctx)
+	if err != nil {
+		return err
+	}
+	byLadder := make(map[string][]string)
+	for _, name := range names {
+		if prefix, _, ok := parseBackupName(name); ok {
+			byLadder[prefix] = append(byLadder[prefix], name)
+		}
+	}
+	for _, group := range byLadder {
+		sort.Strings(group)
+		for len(group) > j.keep {
+			if err := j.target.Delete(ctx, group[0]); err != nil {
+				return err
+			}
+			group = group[1:]
+		}
+	}
+	return nil
+}
+
+// parseBackupName splits "club-north-20240101T030000Z.jsonl" into its ladder
+// prefix and time
+func parseBackupName(name string) (prefix string, at time.Time, ok bool) {
+	base, found := strings.CutSuffix(name, ".jsonl")
+	if !found {
+		return "", time.Time{}, false
+	}
+	i := strings.LastIndex(base, "-")
+	if i < 0 {
+		return "", time.Time{}, false
+	}
+	at, err := time.Parse(backupTimeFormat, base[i+1:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return base[:i], at, true
+}
+
+// ListBackups returns the backups in target, oldest first
+func ListBackups(ctx context.Context, target BackupTarget) ([]string, error) {
+	names, err := target.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, name := range names {
+		if _, _, ok := parseBackupName(name); ok {
+			backups = append(backups, name)
+		}
+	}
+	sort.Slice(backups, func(i, k int) bool {
+		_, ti, _ := parseBackupName(backups[i])
+		_, tk, _ := parseBackupName(backups[k])
+		if !ti.Equal(tk) {
+			return ti.Before(tk)
+		}
+		return backups[i] < backups[k]
+	})
+	return backups, nil
+}
+
+// RestoreBackup replaces the log at dataPath with a backup while the server is
+// stopped. name may be "latest" for the newest backup of the main ladder. The
+// current log is kept as "<dataPath>.before-restore-<time>". It returns the name
+// of the backup restored.
+func RestoreBackup(ctx context.Context, target BackupTarget, name, dataPath string) (string, error) {
+	if name == "latest" {
+		backups, err := ListBackups(ctx, target)
+		if err != nil {
+			return "", err
+		}
+		name = ""
+		for _, b := range backups {
+			if prefix, _, _ := parseBackupName(b); prefix == "ladder" {
+				name = b
+			}
+		}
+		if name == "" {
+			return "", fmt.Errorf("no backups found")
+		}
+	}
+
+	data, err := target.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup %s: %v", name, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		// Encrypted lines can only be checked by the server, which has the key
+		if _, err := decodeLogLine(scanner.Bytes(), nil); err != nil && err != errLogEncrypted {
+			return "", fmt.Errorf("backup %s is corrupt at line %d: %v", name, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("backup %s is unreadable: %v", name, err)
+	}
+
+	if _, err := os.Stat(dataPath); err == nil {
+		aside := dataPath + ".before-restore-" + time.Now().UTC().Format(backupTimeFormat)
+		if err := os.Rename(dataPath, aside); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
+		return "", err
+	}
+	if err := dirTarget(filepath.Dir(dataPath)).Put(ctx, filepath.Base(dataPath), data); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBackupJob_RetentionAndRestore(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	dir := t.TempDir()
+	target, err := BackupConfig{Dir: dir}.Target()
+	if err != nil {
+		t.Fatalf("Target failed: %v", err)
+	}
+	job, err := NewBackupJob(m, nil, target, "@daily", 2)
+	if err != nil {
+		t.Fatalf("NewBackupJob failed: %v", err)
+	}
+
+	// Older backups, one of them from another club which is pruned separately
+	for _, name := range []string{"ladder-20200101T000000Z.jsonl", "ladder-20200102T000000Z.jsonl", "club-north-20200101T000000Z.jsonl"} {
+		target.Put(context.Background(), name, []byte{})
+	}
+	written, err := job.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if len(written) != 1 || !strings.HasPrefix(written[0], "ladder-") {
+		t.Fatalf("unexpected backups written: %v", written)
+	}
+
+	backups, err := ListBackups(context.Background(), target)
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	want := []string{"club-north-20200101T000000Z.jsonl", "ladder-20200102T000000Z.jsonl", written[0]}
+	if strings.Join(backups, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v after pruning, got %v", want, backups)
+	}
+
+	// Restoring the latest backup over a changed log brings the players back
+	m.AddPlayer("Charlie", "charlie")
+	m.Close()
+	name, err := RestoreBackup(context.Background(), target, "latest", path)
+	if err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if name != written[0] {
+		t.Errorf("expected to restore %s, got %s", written[0], name)
+	}
+	matches, _ := filepath.Glob(path + ".before-restore-*")
+	if len(matches) != 1 {
+		t.Errorf("expected the previous log to be kept, found %v", matches)
+	}
+	for _, p := range matches {
+		os.Remove(p)
+	}
+
+	restored, err := NewModel(path)
+	if err != nil {
+		t.Fatalf("failed to open restored log: %v", err)
+	}
+	defer restored.Close()
+	if n := len(restored.ListPlayers()); n != 2 {
+		t.Errorf("expected 2 players after restore, got %d", n)
+	}
+
+	// A corrupt backup is refused and the log left alone
+	target.Put(context.Background(), "ladder-20200103T000000Z.jsonl", []byte("not a log\n"))
+	if _, err := RestoreBackup(context.Background(), target, "ladder-20200103T000000Z.jsonl", path); err == nil {
+		t.Error("expected a corrupt backup to be refused")
+	}
+}
+
+// fakeS3 is an in-memory bucket that only accepts signed requests
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") || r.Header.Get("x-amz-content-sha256") == "" {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/bucket":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		io.WriteString(w, "<ListBucketResult><IsTruncated>false</IsTruncated>")
+		for _, k := range keys {
+			io.WriteString(w, "<Contents><Key>"+k+"</Key></Contents>")
+		}
+		io.WriteString(w, "</ListBucketResult>")
+	case r.Method == "PUT":
+		f.objects[key], _ = io.ReadAll(r.Body)
+	case r.Method == "GET":
+		data, ok := f.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Target(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	target, err := BackupConfig{S3Endpoint: srv.URL, S3Bucket: "bucket", S3Prefix: "ladder/", S3AccessKey: "key", S3SecretKey: "secret"}.Target()
+	if err != nil {
+		t.Fatalf("Target failed: %v", err)
+	}
+	ctx := context.Background()
+	if err := target.Put(ctx, "ladder-20240101T000000Z.jsonl", []byte("data")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, ok := fake.objects["ladder/ladder-20240101T000000Z.jsonl"]; !ok {
+		t.Errorf("expected the object under the prefix, got %v", fake.objects)
+	}
+	names, err := target.List(ctx)
+	if err != nil || len(names) != 1 || names[0] != "ladder-20240101T000000Z.jsonl" {
+		t.Errorf("unexpected List result %v, %v", names, err)
+	}
+	data, err := target.Get(ctx, names[0])
+	if err != nil || string(data) != "data" {
+		t.Errorf("unexpected Get result %q, %v", data, err)
+	}
+	if err := target.Delete(ctx, names[0]); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if _, err := target.Get(ctx, names[0]); err == nil {
+		t.Error("expected Get of a deleted object to fail")
+	}
+}
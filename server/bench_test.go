@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// benchPlayers is the ladder size used when seeding benchmark logs
+const benchPlayers = 16
+
+var benchSizes = []int{1_000, 10_000, 100_000}
+
+// benchScores is a valid 3-0 win for whichever side is passed as the winner
+func benchScores(challengerWins bool) []*ladderpb.SetScore {
+	w, l := int32(11), int32(5)
+	if !challengerWins {
+		w, l = l, w
+	}
+	return []*ladderpb.SetScore{{ChallengerPoints: w, DefenderPoints: l}, {ChallengerPoints: w, DefenderPoints: l}, {ChallengerPoints: w, DefenderPoints: l}}
+}
+
+// seedBenchLog writes a log of n transactions (benchPlayers joins followed by matches)
+// straight to disk, bypassing the per-write file open so large logs seed quickly
+func seedBenchLog(b *testing.B, n int) string {
+	b.Helper()
+	f, err := os.CreateTemp("", "ladder_bench_*.log")
+	if err != nil {
+		b.Fatalf("failed to create temp file: %v", err)
+	}
+	defer f.Close()
+
+	m := &Model{}
+	w := bufio.NewWriter(f)
+	players := []*ladderpb.Player{}
+	ts := time.Now().Add(-time.Duration(n) * time.Minute).UnixMilli()
+	write := func(i int, t storagepb.TransactionType, payload interface{}, tx *storagepb.TransactionStorage) {
+		var err error
+		players, err = m.applyTransactionLogic(t, payload, players)
+		if err != nil {
+			b.Fatalf("seed transaction %d: %v", i, err)
+		}
+		tx.Id = fmt.Sprintf("tx-%d", i)
+		tx.Type = t
+		tx.TimestampMs = ts + int64(i)*60_000
+		tx.PlayerList = ladderToStorage(players)
+		data, err := proto.Marshal(tx)
+		if err != nil {
+			b.Fatalf("seed transaction %d: %v", i, err)
+		}
+		w.WriteString(base64.StdEncoding.EncodeToString(data) + "\n")
+	}
+
+	for i := 0; i < n; i++ {
+		if i < benchPlayers {
+			p := &storagepb.AddPlayerStorage{PlayerId: fmt.Sprintf("p%02d", i), Name: fmt.Sprintf("Player %d", i)}
+			write(i, storagepb.TransactionType_ADD_PLAYER, p, &storagepb.TransactionStorage{
+				Payload: &storagepb.TransactionStorage_AddPlayerPayload{AddPlayerPayload: p},
+			})
+			continue
+		}
+		// Neighbours play each other, and the challenger wins every other time
+		k := i % (benchPlayers - 1)
+		challenger, defender := players[k+1].Id, players[k].Id
+		winner := defender
+		if i%2 == 0 {
+			winner = challenger
+		}
+		sets := make([]*storagepb.SetScoreStorage, 0, 3)
+		for _, s := range benchScores(winner == challenger) {
+			sets = append(sets, &storagepb.SetScoreStorage{ChallengerPoints: s.ChallengerPoints, DefenderPoints: s.DefenderPoints})
+		}
+		p := &storagepb.MatchResultStorage{ChallengerId: challenger, DefenderId: defender, WinnerId: winner, SetScores: sets}
+		write(i, storagepb.TransactionType_MATCH_RESULT, p, &storagepb.TransactionStorage{
+			Payload: &storagepb.TransactionStorage_MatchResultPayload{MatchResultPayload: p},
+		})
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatalf("failed to write seed log: %v", err)
+	}
+	return f.Name()
+}
+
+// benchModel copies a seeded log so each run starts from the same state
+func benchModel(b *testing.B, seed string) *Model {
+	b.Helper()
+	src, err := os.Open(seed)
+	if err != nil {
+		b.Fatalf("failed to open seed log: %v", err)
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp("", "ladder_bench_*.log")
+	if err != nil {
+		b.Fatalf("failed to create temp file: %v", err)
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		b.Fatalf("failed to copy seed log: %v", err)
+	}
+	b.Cleanup(func() { os.Remove(dst.Name()) })
+
+	m, _ := NewModel(dst.Name())
+	return m
+}
+
+func runSizes(b *testing.B, fn func(b *testing.B, seed string)) {
+	for _, n := range benchSizes {
+		seed := seedBenchLog(b, n)
+		b.Run(fmt.Sprintf("tx=%d", n), func(b *testing.B) { fn(b, seed) })
+		os.Remove(seed)
+	}
+}
+
+func BenchmarkAddMatchResult(b *testing.B) {
+	runSizes(b, func(b *testing.B, seed string) {
+		m := benchModel(b, seed)
+		// Defenders always win, so the ladder order and these pairings stay fixed
+		players := m.ListPlayers()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			k := i % (len(players) - 1)
+			challenger, defender := players[k+1].Id, players[k].Id
+			if _, err := m.AddMatchResult(challenger, defender, defender, benchScores(false)); err != nil {
+				b.Fatalf("AddMatchResult failed: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkListPlayers(b *testing.B) {
+	runSizes(b, func(b *testing.B, seed string) {
+		m := benchModel(b, seed)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if got := m.ListPlayers(); len(got) != benchPlayers {
+				b.Fatalf("expected %d players, got %d", benchPlayers, len(got))
+			}
+		}
+	})
+}
+
+func BenchmarkGetRecentMatches(b *testing.B) {
+	runSizes(b, func(b *testing.B, seed string) {
+		m := benchModel(b, seed)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := m.GetRecentMatches(10); err != nil {
+				b.Fatalf("GetRecentMatches failed: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// SetPlayerCategory records a player's category, returning the transaction ID
+func (m *Model) SetPlayerCategory(playerID string, category ladderpb.PlayerCategory) (string, error) {
+	if _, ok := ladderpb.PlayerCategory_name[int32(category)]; !ok {
+		return "", fmt.Errorf("unknown category: %d", category)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", err
+	}
+
+	payload := &storagepb.SetCategoryStorage{PlayerId: playerID, Category: storagepb.PlayerCategoryStorage(category)}
+	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_SET_CATEGORY, payload, currentPlayers)
+	if err != nil {
+		return "", err
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_SET_CATEGORY,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_SetCategoryPayload{SetCategoryPayload: payload},
+		PlayerList:  ladderToStorage(newPlayers),
+	}
+
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	return tx.Id, nil
+}
+
+// filterByCategory returns the players in a category, in ladder order, with their
+// position within the category set. CATEGORY_NONE returns the whole ladder unchanged.
+func filterByCategory(players []*ladderpb.Player, category ladderpb.PlayerCategory) []*ladderpb.Player {
+	if category == ladderpb.PlayerCategory_CATEGORY_NONE {
+		return players
+	}
+
+	filtered := []*ladderpb.Player{}
+	for _, p := range players {
+		if p.Category != category {
+			continue
+		}
+		filtered = append(filtered, &ladderpb.Player{
+			Id:           p.Id,
+			Name:         p.Name,
+			Rank:         p.Rank,
+			Handicap:     p.Handicap,
+			Category:     p.Category,
+			CategoryRank: int32(len(filtered) + 1),
+
+			Provisional:                p.Provisional,
+			QualificationMatchesPlayed: p.QualificationMatchesPlayed,
+			ProtectedFromMs:            p.ProtectedFromMs,
+			ProtectedUntilMs:           p.ProtectedUntilMs,
+		})
+	}
+	return filtered
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"github.com/icza/backscanner"
+	"google.golang.org/protobuf/proto"
+)
+
+// Hash chain
+//
+// Every transaction written carries chain_hash, the SHA-256 of the previous
+// transaction's chain_hash followed by the transaction itself, deterministically
+// marshalled with its full player list and without chain_hash or player_list_delta.
+// Editing, removing or reordering a transaction then breaks every link after it.
+// Rewrites of the log (erasure, restores, repairs, key rotation) chain it again, so
+// they cannot be told from an edit by the chain alone; a head hash published before
+// one shows whether anything older changed.
+
+// chainHash returns the chain hash of tx following a transaction with chain hash prev
+func chainHash(prev []byte, tx *storagepb.TransactionStorage) ([]byte, error) {
+	c := proto.Clone(tx).(*storagepb.TransactionStorage)
+	c.ChainHash = nil
+	c.PlayerListDelta = nil
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// lastChainHash returns the chain hash of the last transaction in the first size
+// bytes of file
+func lastChainHash(file *os.File, size int64, c *logCipher) ([]byte, error) {
+	scanner := backscanner.New(file, int(size))
+	for {
+		line, _, err := scanner.Line()
+		if err != nil {
+			if err.Error() == "EOF" {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		t, err := decodeLogLine([]byte(line), c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode line: %v", err)
+		}
+		return t.ChainHash, nil
+	}
+}
+
+// ChainReport is the outcome of checking the hash chain through the log
+type ChainReport struct {
+	TransactionsChecked int
+	Unchained           int    // Transactions before the chain began, which it does not cover
+	HeadHash            []byte // Chain hash of the last transaction
+	BrokenIndex         int    // Zero-based position of the first broken link, or -1
+	BrokenID            string
+	Reason              string
+	CheckedAt           time.Time
+}
+
+// Intact reports whether every link of the chain held
+func (r *ChainReport) Intact() bool {
+	return r.BrokenIndex < 0
+}
+
+// checkChain follows the chain through txs, which must carry full player lists
+func checkChain(txs []*storagepb.TransactionStorage) (*ChainReport, error) {
+	report := &ChainReport{TransactionsChecked: len(txs), BrokenIndex: -1}
+	var prev []byte
+	for i, t := range txs {
+		if len(t.ChainHash) == 0 {
+			if prev != nil {
+				report.BrokenIndex, report.BrokenID = i, t.Id
+				report.Reason = "the transaction has no chain hash but the one before it has"
+				return report, nil
+			}
+			report.Unchained++
+			continue
+		}
+		want, err := chainHash(prev, t)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(want, t.ChainHash) {
+			report.BrokenIndex, report.BrokenID = i, t.Id
+			report.Reason = "the chain hash does not match the transaction and the one before it"
+			return report, nil
+		}
+		prev = t.ChainHash
+	}
+	report.HeadHash = prev
+	return report, nil
+}
+
+// VerifyChain checks the hash chain through the whole log
+func (m *Model) VerifyChain(ctx context.Context) (*ChainReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report, err := checkChain(txs)
+	if err != nil {
+		return nil, err
+	}
+	report.CheckedAt = m.now()
+	return report, nil
+}
+
+// VerifyChain checks the chain of hashes linking the transactions of the log
+func (h *LadderService) VerifyChain(ctx context.Context, req *ladderpb.VerifyChainRequest) (*ladderpb.VerifyChainResponse, error) {
+	report, err := h.modelFor(ctx).VerifyChain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &ladderpb.VerifyChainResponse{
+		Intact:              report.Intact(),
+		TransactionsChecked: int32(report.TransactionsChecked),
+		Unchained:           int32(report.Unchained),
+		HeadHash:            hex.EncodeToString(report.HeadHash),
+		CheckedAtMs:         report.CheckedAt.UnixMilli(),
+	}
+	if !report.Intact() {
+		resp.BrokenIndex = int32(report.BrokenIndex)
+		resp.BrokenTransactionId = report.BrokenID
+		resp.Reason = report.Reason
+	}
+	return resp, nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestModel_VerifyChain(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	m.AddMatchResult("bob", "alice", "bob", threeLove)
+	m.AddMatchResult("carol", "alice", "carol", threeLove)
+
+	report, err := m.VerifyChain(ctx)
+	if err != nil {
+		t.Fatalf("VerifyChain failed: %v", err)
+	}
+	if !report.Intact() || report.TransactionsChecked != 5 || report.Unchained != 0 {
+		t.Fatalf("expected an intact chain over 5 transactions, got %+v", report)
+	}
+	txs, _ := m.readTransactionsLocked()
+	if !bytes.Equal(report.HeadHash, txs[len(txs)-1].ChainHash) {
+		t.Error("expected the head hash to be the last transaction's chain hash")
+	}
+
+	// Rewrites chain the log again, leaving it intact
+	if _, _, err := m.ErasePlayer(ctx, "carol"); err != nil {
+		t.Fatalf("ErasePlayer failed: %v", err)
+	}
+	if report, _ := m.VerifyChain(ctx); !report.Intact() {
+		t.Fatalf("expected an intact chain after erasure, got %+v", report)
+	}
+
+	// Changing the winner of the first match in the file breaks the chain there
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	tx, err := decodeLogLine([]byte(lines[3]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.GetMatchResultPayload().WinnerId = "alice"
+	edited, _ := proto.Marshal(tx)
+	lines[3], _ = (*logCipher)(nil).seal(edited)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = m.VerifyChain(ctx)
+	if err != nil {
+		t.Fatalf("VerifyChain failed: %v", err)
+	}
+	if report.Intact() || report.BrokenIndex != 3 || report.BrokenID != tx.Id {
+		t.Errorf("expected the chain to break at transaction 3, got %+v", report)
+	}
+
+	// So does dropping a transaction
+	lines = append(lines[:2], lines[4:]...)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := m.VerifyChain(ctx); report.Intact() || report.BrokenIndex != 2 {
+		t.Errorf("expected the chain to break at transaction 2, got %+v", report)
+	}
+}
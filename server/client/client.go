@@ -0,0 +1,178 @@
+// Package client is the Go client for the ladder server's gRPC API. It wraps the
+// generated stubs with connection setup, credentials and club selection, retries
+// with backoff and typed errors, and adds helpers for everyday tasks such as
+// SubmitResult. The command-line tools and bots use it so they all behave alike.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+const (
+	defaultTimeout        = 10 * time.Second
+	defaultMaxAttempts    = 4
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 2 * time.Second
+)
+
+// Options configure a Client. The zero value connects in plaintext to the default
+// ladder with no credentials.
+type Options struct {
+	// ClubID selects the club on a server that hosts several
+	ClubID string
+	// AdminToken authorizes admin RPCs
+	AdminToken string
+	// PlayerToken identifies a player to player RPCs such as GetMyDashboard
+	PlayerToken string
+	// ClientType names the program on every transaction it writes, e.g. "cli"; the
+	// server records "grpc" when it is empty
+	ClientType string
+	// TLS connects with TLS, checking the server against the system roots.
+	// Plaintext is the default, for servers on the club network.
+	TLS bool
+	// Timeout bounds each attempt of an RPC whose context has no deadline; the
+	// default is 10s
+	Timeout time.Duration
+	// Retry controls how failed RPCs are retried
+	Retry RetryPolicy
+}
+
+// RetryPolicy retries RPCs that fail because the server is unavailable: restarting,
+// in maintenance mode or overloaded. Other errors are returned at once.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try; the default is 4 and 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled with jitter for each
+	// one after up to MaxBackoff. The defaults are 100ms and 2s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// RetryWrites also retries RPCs that change the ladder. A write whose reply was
+	// lost may then be applied twice, such as a result recorded twice, so only reads
+	// are retried by default.
+	RetryWrites bool
+}
+
+// Client is a connection to a ladder server. Every LadderService RPC can be called
+// on it directly, with the credentials and retries of its Options.
+type Client struct {
+	ladderpb.LadderServiceClient
+	conn *grpc.ClientConn
+	opts Options
+}
+
+// Dial connects to the gRPC server at addr, e.g. "localhost:9090". The connection
+// is made lazily, so a server that is down shows up as an error on the first RPC.
+func Dial(addr string, opts Options) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if opts.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	c := &Client{opts: withDefaults(opts)}
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(c.retryInterceptor, c.metadataInterceptor),
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.LadderServiceClient = ladderpb.NewLadderServiceClient(conn)
+	return c, nil
+}
+
+func withDefaults(opts Options) Options {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Retry.MaxAttempts == 0 {
+		opts.Retry.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Retry.InitialBackoff == 0 {
+		opts.Retry.InitialBackoff = defaultInitialBackoff
+	}
+	if opts.Retry.MaxBackoff == 0 {
+		opts.Retry.MaxBackoff = defaultMaxBackoff
+	}
+	return opts
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// metadataInterceptor sends the credentials, club and client type with every
+// attempt, and bounds it with the timeout
+func (c *Client) metadataInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+	var pairs []string
+	if c.opts.AdminToken != "" {
+		pairs = append(pairs, "authorization", "Bearer "+c.opts.AdminToken)
+	}
+	if c.opts.PlayerToken != "" {
+		pairs = append(pairs, "x-player-token", c.opts.PlayerToken)
+	}
+	if c.opts.ClubID != "" {
+		pairs = append(pairs, "x-club-id", c.opts.ClubID)
+	}
+	if c.opts.ClientType != "" {
+		pairs = append(pairs, "x-ladder-client", c.opts.ClientType)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, callOpts...)
+}
+
+// retryInterceptor retries unavailable errors with backoff and returns the final
+// error as an *Error
+func (c *Client) retryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+	policy := c.opts.Retry
+	attempts := policy.MaxAttempts
+	if !policy.RetryWrites && !isReadOnly(method) {
+		attempts = 1
+	}
+	backoff := policy.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = invoker(ctx, method, req, reply, cc, callOpts...)
+		if err == nil || attempt >= attempts || status.Code(err) != codes.Unavailable {
+			break
+		}
+		// Jitter keeps clients that failed together from retrying together
+		wait := time.Duration(rand.Int64N(int64(backoff))) + backoff/2
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return wrapError(method, err)
+		}
+		backoff = min(backoff*2, policy.MaxBackoff)
+	}
+	return wrapError(method, err)
+}
+
+// isReadOnly reports whether an RPC only reads, by the naming the service follows
+func isReadOnly(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+	for _, prefix := range []string{"List", "Get", "Export", "Diff", "Suggest"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return name == "VerifyChain"
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	"squash-ladder/server/servertest"
+)
+
+func TestClient(t *testing.T) {
+	srv := servertest.Start(t, servertest.WithAdminToken("secret"))
+	c, err := Dial(srv.GRPCAddr, Options{AdminToken: "secret", ClientType: "bot"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	for _, name := range []string{"Alice", "Bob"} {
+		if _, err := c.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: name}); err != nil {
+			t.Fatalf("AddPlayer failed: %v", err)
+		}
+	}
+	bob, err := c.FindPlayer(ctx, "bob")
+	if err != nil || bob.Name != "Bob" {
+		t.Fatalf("expected to find Bob, got %v, %v", bob, err)
+	}
+	alice, _ := c.FindPlayer(ctx, "Alice")
+	if _, err := c.SubmitResult(ctx, bob.Id, alice.Id, "11-5, 9-11 11-7 11-3"); err != nil {
+		t.Fatalf("SubmitResult failed: %v", err)
+	}
+
+	players, err := c.Players(ctx)
+	if err != nil || len(players) != 2 || players[0].Id != bob.Id {
+		t.Fatalf("expected Bob on top, got %v, %v", players, err)
+	}
+	matches, err := c.RecentMatches(ctx, 5)
+	if err != nil || len(matches) != 1 || matches[0].WinnerId != bob.Id || len(matches[0].SetScores) != 4 {
+		t.Fatalf("expected Bob's win, got %v, %v", matches, err)
+	}
+
+	// The transaction names the client
+	txs, err := c.ListTransactions(ctx, &ladderpb.ListTransactionsRequest{Limit: 1})
+	if err != nil || len(txs.Transactions) != 1 || txs.Transactions[0].ClientType != "bot" || txs.Transactions[0].ClientPrincipal != "admin" {
+		t.Errorf("expected the result to be recorded as the admin's via bot, got %v, %v", txs, err)
+	}
+
+	if _, err := c.FindPlayer(ctx, "Carol"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := c.SubmitResult(ctx, bob.Id, alice.Id, "eleven-five"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("expected ErrInvalidArgument for a bad score, got %v", err)
+	}
+
+	// Server errors are typed, and still carry their status
+	anonymous, _ := Dial(srv.GRPCAddr, Options{})
+	defer anonymous.Close()
+	_, err = anonymous.SetMaintenanceMode(ctx, &ladderpb.SetMaintenanceModeRequest{On: true})
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Method != "/ladder.LadderService/SetMaintenanceMode" || !errors.Is(err, ErrUnauthenticated) && !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+	if status.Code(err) != rpcErr.Code {
+		t.Errorf("expected status.Code to read %v, got %v", rpcErr.Code, status.Code(err))
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	c := &Client{opts: withDefaults(Options{Retry: RetryPolicy{InitialBackoff: time.Millisecond}})}
+	call := func(method string, failures int, code codes.Code) (int, error) {
+		calls := 0
+		err := c.retryInterceptor(context.Background(), method, nil, nil, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				calls++
+				if calls <= failures {
+					return status.Error(code, "try again")
+				}
+				return nil
+			})
+		return calls, err
+	}
+
+	if calls, err := call("/ladder.LadderService/ListPlayers", 2, codes.Unavailable); err != nil || calls != 3 {
+		t.Errorf("expected a read to succeed on its third try, got %d calls, %v", calls, err)
+	}
+	if calls, err := call("/ladder.LadderService/ListPlayers", 10, codes.Unavailable); !errors.Is(err, ErrUnavailable) || calls != defaultMaxAttempts {
+		t.Errorf("expected %d tries, got %d calls, %v", defaultMaxAttempts, calls, err)
+	}
+	if calls, err := call("/ladder.LadderService/ListPlayers", 1, codes.NotFound); !errors.Is(err, ErrNotFound) || calls != 1 {
+		t.Errorf("expected NotFound not to be retried, got %d calls, %v", calls, err)
+	}
+	if calls, _ := call("/ladder.LadderService/AddMatchResult", 2, codes.Unavailable); calls != 1 {
+		t.Errorf("expected a write not to be retried, got %d calls", calls)
+	}
+	c.opts.Retry.RetryWrites = true
+	if calls, err := call("/ladder.LadderService/AddMatchResult", 2, codes.Unavailable); err != nil || calls != 3 {
+		t.Errorf("expected a write to be retried when allowed, got %d calls, %v", calls, err)
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is an RPC that failed. It matches the sentinel errors below by code, so
+// callers can write errors.Is(err, client.ErrNotFound).
+type Error struct {
+	Method  string // Full method name, e.g. "/ladder.LadderService/AddMatchResult"
+	Code    codes.Code
+	Message string // The server's message, localized when the request had a language
+}
+
+func (e *Error) Error() string {
+	if e.Method == "" {
+		return e.Message
+	}
+	return e.Method[strings.LastIndex(e.Method, "/")+1:] + ": " + e.Message
+}
+
+// Is matches an *Error with the same code
+func (e *Error) Is(target error) bool {
+	var t *Error
+	return errors.As(target, &t) && t.Method == "" && t.Code == e.Code
+}
+
+// GRPCStatus lets status.Code and status.FromError read the error as before
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Message)
+}
+
+var (
+	ErrInvalidArgument    = &Error{Code: codes.InvalidArgument, Message: "invalid argument"}
+	ErrNotFound           = &Error{Code: codes.NotFound, Message: "not found"}
+	ErrAlreadyExists      = &Error{Code: codes.AlreadyExists, Message: "already exists"}
+	ErrPermissionDenied   = &Error{Code: codes.PermissionDenied, Message: "permission denied"}
+	ErrUnauthenticated    = &Error{Code: codes.Unauthenticated, Message: "unauthenticated"}
+	ErrFailedPrecondition = &Error{Code: codes.FailedPrecondition, Message: "failed precondition"}
+	ErrResourceExhausted  = &Error{Code: codes.ResourceExhausted, Message: "resource exhausted"}
+	ErrUnavailable        = &Error{Code: codes.Unavailable, Message: "unavailable"}
+	ErrDeadlineExceeded   = &Error{Code: codes.DeadlineExceeded, Message: "deadline exceeded"}
+)
+
+// wrapError returns err as an *Error, or nil
+func wrapError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	s := status.Convert(err)
+	return &Error{Method: method, Code: s.Code(), Message: s.Message()}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ParseScores reads set scores written from the challenger's side, such as
+// "11-5 9-11 11-7" or "11-5, 9-11, 11-7", and returns them with the number of sets
+// each side won. The server checks them against the ladder's scoring format.
+func ParseScores(s string) (sets []*ladderpb.SetScore, challengerSets, defenderSets int, err error) {
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	if len(fields) == 0 {
+		return nil, 0, 0, fmt.Errorf("no scores given")
+	}
+	for _, f := range fields {
+		c, d, ok := strings.Cut(f, "-")
+		challenger, err1 := strconv.Atoi(c)
+		defender, err2 := strconv.Atoi(d)
+		if !ok || err1 != nil || err2 != nil || challenger < 0 || defender < 0 {
+			return nil, 0, 0, fmt.Errorf("bad set %q, expected points like 11-5", f)
+		}
+		if challenger > defender {
+			challengerSets++
+		} else {
+			defenderSets++
+		}
+		sets = append(sets, &ladderpb.SetScore{ChallengerPoints: int32(challenger), DefenderPoints: int32(defender)})
+	}
+	return sets, challengerSets, defenderSets, nil
+}
+
+// SubmitResult records a match from its score, such as "11-5 11-7 11-3" written
+// from the challenger's side; the winner is whoever won more sets
+func (c *Client) SubmitResult(ctx context.Context, challengerID, defenderID, scores string) (*ladderpb.AddMatchResultResponse, error) {
+	sets, challengerSets, defenderSets, err := ParseScores(scores)
+	if err != nil {
+		return nil, &Error{Method: "SubmitResult", Code: codes.InvalidArgument, Message: err.Error()}
+	}
+	winner := challengerID
+	if defenderSets > challengerSets {
+		winner = defenderID
+	}
+	return c.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+		ChallengerId: challengerID,
+		DefenderId:   defenderID,
+		WinnerId:     winner,
+		SetScores:    sets,
+	})
+}
+
+// Players returns the ladder in rank order
+func (c *Client) Players(ctx context.Context) ([]*ladderpb.Player, error) {
+	resp, err := c.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Players, nil
+}
+
+// RecentMatches returns up to limit results, newest first
+func (c *Client) RecentMatches(ctx context.Context, limit int) ([]*ladderpb.MatchResult, error) {
+	resp, err := c.ListRecentMatches(ctx, &ladderpb.ListRecentMatchesRequest{Limit: int32(limit)})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// FindPlayer returns the player with an ID or name, ignoring case, for tools that
+// take names from people. A name several players share is an error.
+func (c *Client) FindPlayer(ctx context.Context, idOrName string) (*ladderpb.Player, error) {
+	players, err := c.Players(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found []*ladderpb.Player
+	for _, p := range players {
+		if p.Id == idOrName {
+			return p, nil
+		}
+		if strings.EqualFold(p.Name, strings.TrimSpace(idOrName)) {
+			found = append(found, p)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, &Error{Method: "FindPlayer", Code: codes.NotFound, Message: fmt.Sprintf("no player called %q", idOrName)}
+	case 1:
+		return found[0], nil
+	}
+	return nil, &Error{Method: "FindPlayer", Code: codes.InvalidArgument, Message: fmt.Sprintf("%d players are called %q", len(found), idOrName)}
+}
+
+// PlayerNames maps the IDs of the players on the ladder to their names
+func PlayerNames(players []*ladderpb.Player) map[string]string {
+	names := make(map[string]string, len(players))
+	for _, p := range players {
+		names[p.Id] = p.Name
+	}
+	return names
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// clientTypeHeader lets tools such as ladder-tui name themselves; RPCs without it
+// are "web" or "grpc" by transport
+const clientTypeHeader = "x-ladder-client"
+
+// Client types recorded on transactions
+const (
+	clientWeb        = "web"
+	clientGRPC       = "grpc"
+	clientSMS        = "sms"
+	clientTelegram   = "telegram"
+	clientConsole    = "console"
+	clientResultLink = "result-link"
+)
+
+var validClientType = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+type clientKey struct{}
+
+// contextWithClient attaches the client that made a request, for the transactions it writes
+func contextWithClient(ctx context.Context, c *storagepb.ClientStorage) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// clientFrom returns the client attached to ctx, or nil
+func clientFrom(ctx context.Context) *storagepb.ClientStorage {
+	c, _ := ctx.Value(clientKey{}).(*storagepb.ClientStorage)
+	return c
+}
+
+// withClient returns a handle on the same ladder that records c on the transactions
+// it writes
+func (m *Model) withClient(c *storagepb.ClientStorage) *Model {
+	if c == nil {
+		return m
+	}
+	return &Model{modelState: m.modelState, client: c}
+}
+
+// clientContext attaches a client to a request that did not come in over RPC. The
+// address is dropped unless client addresses are recorded.
+func (h *LadderService) clientContext(ctx context.Context, clientType, principal, addr string) context.Context {
+	c := &storagepb.ClientStorage{Principal: principal, ClientType: clientType}
+	if h.recordClientAddresses {
+		c.RemoteAddr = addr
+	}
+	return contextWithClient(ctx, c)
+}
+
+// clientUnaryInterceptor records who made each RPC and with what. It runs after the
+// admin, API key and player interceptors, whose results name the principal.
+func (h *LadderService) clientUnaryInterceptor(memberToken string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var addr string
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			addr = hostOnly(p.Addr.String())
+		}
+		return handler(h.clientContext(ctx, rpcClientType(ctx), h.rpcPrincipal(ctx, memberToken), addr), req)
+	}
+}
+
+// rpcPrincipal names the caller of an RPC, or returns "" for an anonymous one
+func (h *LadderService) rpcPrincipal(ctx context.Context, memberToken string) string {
+	if claims, ok := ctx.Value(playerClaimsKey{}).(*playerClaims); ok {
+		return "player:" + claims.PlayerID
+	}
+	if id, _ := h.apiKeys.identifyRPC(ctx); id != "" {
+		return "api-key:" + id
+	}
+	if isAdmin(ctx) {
+		return "admin"
+	}
+	if memberToken != "" && hasBearerToken(ctx, memberToken) {
+		return "member"
+	}
+	return ""
+}
+
+// rpcClientType returns the client type a caller sent, or else "web" for gRPC-Web
+// and "grpc" for everything else
+func rpcClientType(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(clientTypeHeader); len(v) > 0 && validClientType.MatchString(v[0]) {
+		return v[0]
+	}
+	if len(md.Get("x-grpc-web")) > 0 {
+		return clientWeb
+	}
+	for _, ua := range md.Get("x-user-agent") {
+		if strings.Contains(ua, "grpc-web") {
+			return clientWeb
+		}
+	}
+	return clientGRPC
+}
+
+// remoteHost returns the address an HTTP request came from, without its port
+func remoteHost(r *http.Request) string {
+	return hostOnly(r.RemoteAddr)
+}
+
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// describeClient formats a transaction's client for the console, as in
+// "player:p1 via web from 192.0.2.7"
+func describeClient(t *ladderpb.TransactionSummary) string {
+	s := t.ClientType
+	if t.ClientPrincipal != "" {
+		s = fmt.Sprintf("%s via %s", t.ClientPrincipal, s)
+	}
+	if t.ClientAddr != "" {
+		s += " from " + t.ClientAddr
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientUnaryInterceptor(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	svc := NewLadderService(m)
+
+	addPlayer := func(ctx context.Context, id string) {
+		t.Helper()
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.7"), Port: 51234}})
+		intercept := svc.clientUnaryInterceptor("member-secret")
+		_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/AddPlayer"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return svc.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: id, PlayerId: id})
+			})
+		if err != nil {
+			t.Fatalf("AddPlayer failed: %v", err)
+		}
+	}
+	addPlayer(metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-grpc-web", "1", "authorization", "Bearer member-secret")), "alice")
+	addPlayer(AsAdmin(metadata.NewIncomingContext(context.Background(), metadata.Pairs(clientTypeHeader, "cli"))), "bob")
+	addPlayer(metadata.NewIncomingContext(context.Background(), metadata.Pairs(clientTypeHeader, "Not A Client")), "carol")
+
+	// Addresses are only kept when configured
+	svc.recordClientAddresses = true
+	addPlayer(context.Background(), "dave")
+
+	txs, _, err := m.ListTransactions(context.Background(), 10, "", nil)
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	want := []struct{ principal, clientType, addr string }{
+		{"", "grpc", "192.0.2.7"},
+		{"", "grpc", ""},
+		{"admin", "cli", ""},
+		{"member", "web", ""},
+	}
+	if len(txs) != len(want) {
+		t.Fatalf("expected %d transactions, got %d", len(want), len(txs))
+	}
+	for i, w := range want {
+		if tx := txs[i]; tx.ClientPrincipal != w.principal || tx.ClientType != w.clientType || tx.ClientAddr != w.addr {
+			t.Errorf("transaction %d: expected %+v, got %q %q %q", i, w, tx.ClientPrincipal, tx.ClientType, tx.ClientAddr)
+		}
+	}
+	if got := describeClient(txs[2]); got != "admin via cli" {
+		t.Errorf("expected \"admin via cli\", got %q", got)
+	}
+
+	// Writes without a client, such as those made at startup, record none
+	m.AddPlayer("Erin", "erin")
+	txs, _, _ = m.ListTransactions(context.Background(), 1, "", nil)
+	if txs[0].ClientType != "" {
+		t.Errorf("expected no client on a direct write, got %q", txs[0].ClientType)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Clock tells a model the time. Tests and tools that need reproducible logs set
+// their own instead of the system clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator makes the IDs of transactions and of the records they create
+type IDGenerator interface {
+	NewID() string
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string { return uuid.New().String() }
+
+// SteppingClock starts at a fixed time and moves on by Step every time it is read.
+// It is safe for concurrent use.
+type SteppingClock struct {
+	mu   sync.Mutex
+	next time.Time
+	Step time.Duration
+}
+
+// NewSteppingClock returns a clock that reads start first
+func NewSteppingClock(start time.Time, step time.Duration) *SteppingClock {
+	return &SteppingClock{next: start, Step: step}
+}
+
+// Now returns the current reading and advances the clock
+func (c *SteppingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.next
+	c.next = c.next.Add(c.Step)
+	return now
+}
+
+// Set moves the clock to t
+func (c *SteppingClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next = t
+}
+
+// SequentialIDs numbers IDs from 1 after a fixed prefix, e.g. "tx-1", "tx-2". It is
+// safe for concurrent use.
+type SequentialIDs struct {
+	Prefix string
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewID returns the next ID in the sequence
+func (g *SequentialIDs) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	return fmt.Sprintf("%s%d", g.Prefix, g.n)
+}
+
+// SetClock replaces the system clock the model stamps transactions with; nil
+// restores it
+func (m *Model) SetClock(c Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = c
+}
+
+// SetIDGenerator replaces the random UUIDs the model gives transactions and new
+// records; nil restores them
+func (m *Model) SetIDGenerator(g IDGenerator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ids = g
+}
+
+// now reads the model's clock. The clock is only replaced before the model is in
+// use, so it is read without the lock.
+func (m *Model) now() time.Time {
+	if m.clock == nil {
+		return systemClock{}.Now()
+	}
+	return m.clock.Now()
+}
+
+// newID makes an ID with the model's generator
+func (m *Model) newID() string {
+	if m.ids == nil {
+		return uuidGenerator{}.NewID()
+	}
+	return m.ids.NewID()
+}
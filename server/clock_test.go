@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_ReproducibleLog(t *testing.T) {
+	start := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	write := func() []byte {
+		m, path := createTempModel(t)
+		defer os.Remove(path)
+		m.SetClock(NewSteppingClock(start, time.Minute))
+		m.SetIDGenerator(&SequentialIDs{Prefix: "tx-"})
+
+		m.AddPlayer("Alice", "")
+		m.AddPlayer("Bob", "")
+		players := m.ListPlayers()
+		if players[0].Id != "tx-1" || players[1].Id != "tx-3" {
+			t.Fatalf("expected sequential player IDs, got %v", players)
+		}
+		txID, err := m.AddMatchResult(players[1].Id, players[0].Id, players[1].Id, []*ladderpb.SetScore{
+			{ChallengerPoints: 11, DefenderPoints: 5},
+			{ChallengerPoints: 11, DefenderPoints: 5},
+			{ChallengerPoints: 11, DefenderPoints: 5},
+		})
+		if err != nil {
+			t.Fatalf("AddMatchResult failed: %v", err)
+		}
+		if err := m.InvalidateMatchResult(context.Background(), txID); err != nil {
+			t.Fatalf("InvalidateMatchResult failed: %v", err)
+		}
+
+		m.mu.RLock()
+		txs, err := m.readTransactionsLocked()
+		m.mu.RUnlock()
+		if err != nil {
+			t.Fatalf("readTransactionsLocked failed: %v", err)
+		}
+		for i, tx := range txs {
+			if want := start.Add(time.Duration(i) * time.Minute).UnixMilli(); tx.TimestampMs != want {
+				t.Errorf("transaction %d: expected timestamp %d, got %d", i, want, tx.TimestampMs)
+			}
+		}
+		m.Close()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read log: %v", err)
+		}
+		return data
+	}
+
+	if first, second := write(), write(); !bytes.Equal(first, second) {
+		t.Errorf("expected the same log twice, got\n%s\nand\n%s", first, second)
+	}
+}
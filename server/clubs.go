@@ -0,0 +1,332 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// clubHeader selects the club for a request; it takes precedence over the subdomain
+	clubHeader = "x-club-id"
+	// clubLogFile is the transaction log name inside each club's directory
+	clubLogFile = "transaction_log.jsonl"
+	// clubInfoFile holds the club's display name and creation time
+	clubInfoFile = "club.json"
+)
+
+var clubIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// clubModelKey is the context key under which the resolved club model is stored
+type clubModelKey struct{}
+
+type clubInfo struct {
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	CreatedMs int64               `json:"created_ms"`
+	Quota     *ladderpb.ClubQuota `json:"quota,omitempty"` // nil uses the registry default
+}
+
+// ClubRegistry hosts one isolated ladder per club, each stored in its own
+// directory under dir. Models are opened lazily on first use.
+type ClubRegistry struct {
+	dir                string
+	defaultQuota       *ladderpb.ClubQuota
+	checkpointInterval int              // Passed on to every club's model
+	maintenance        *maintenanceMode // Shared with the server's own ladder when set
+	encryptionKey      []byte           // Encrypts every club's log when set
+	clock              Clock            // Shared by every club's model when set
+	ids                IDGenerator      // Shared by every club's model when set
+
+	mu     sync.Mutex
+	models map[string]*Model
+	opened []func(id string, m *Model)
+}
+
+// NewClubRegistry creates a registry rooted at dir. Clubs created without their own
+// quota are limited by defaultQuota, which may be nil for no limits.
+func NewClubRegistry(dir string, defaultQuota *ladderpb.ClubQuota) (*ClubRegistry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create clubs directory: %v", err)
+	}
+	return &ClubRegistry{
+		dir:          dir,
+		defaultQuota: defaultQuota,
+		models:       make(map[string]*Model),
+	}, nil
+}
+
+// CreateClub registers a new club with an empty ladder. A nil quota uses the registry default.
+func (r *ClubRegistry) CreateClub(id, name string, quota *ladderpb.ClubQuota) (*ladderpb.Club, error) {
+	if !clubIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid club id %q: use lowercase letters, digits and dashes", id)
+	}
+	if strings.TrimSpace(name) == "" {
+		name = id
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clubDir := filepath.Join(r.dir, id)
+	if err := os.Mkdir(clubDir, 0755); err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("club %s already exists", id)
+		}
+		return nil, err
+	}
+
+	info := clubInfo{ID: id, Name: name, CreatedMs: time.Now().UnixMilli(), Quota: quota}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(clubDir, clubInfoFile), data, 0644); err != nil {
+		os.RemoveAll(clubDir)
+		return nil, err
+	}
+
+	return r.clubToProto(info), nil
+}
+
+// ListClubs returns every registered club, ordered by ID
+func (r *ClubRegistry) ListClubs() ([]*ladderpb.Club, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	clubs := []*ladderpb.Club{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := r.readInfo(e.Name())
+		if err != nil {
+			continue
+		}
+		clubs = append(clubs, r.clubToProto(info))
+	}
+	sort.Slice(clubs, func(i, j int) bool { return clubs[i].Id < clubs[j].Id })
+	return clubs, nil
+}
+
+// Model returns the ladder for a club, or an error if the club does not exist
+func (r *ClubRegistry) Model(id string) (*Model, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m, ok := r.models[id]; ok {
+		return m, nil
+	}
+	if !clubIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("club not found: %s", id)
+	}
+	info, err := r.readInfo(id)
+	if err != nil {
+		return nil, fmt.Errorf("club not found: %s", id)
+	}
+
+	m, err := NewModel(filepath.Join(r.dir, id, clubLogFile))
+	if err != nil {
+		return nil, err
+	}
+	m.SetQuota(r.quotaFor(info))
+	m.SetCheckpointInterval(r.checkpointInterval)
+	m.SetClock(r.clock)
+	m.SetIDGenerator(r.ids)
+	if r.maintenance != nil {
+		m.maintenance = r.maintenance
+	}
+	if r.encryptionKey != nil {
+		if err := m.SetEncryptionKey(r.encryptionKey); err != nil {
+			return nil, err
+		}
+		if n, err := m.EncryptLog(); err != nil {
+			return nil, fmt.Errorf("club %s: %v", id, err)
+		} else if n > 0 {
+			log.Printf("Encrypted %d log lines of club %s", n, id)
+		}
+	}
+	r.models[id] = m
+	for _, fn := range r.opened {
+		fn(id, m)
+	}
+	return m, nil
+}
+
+// OnOpen registers fn to be called with every club ladder as it is opened, so
+// listeners can be attached to it
+func (r *ClubRegistry) OnOpen(fn func(id string, m *Model)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.opened = append(r.opened, fn)
+}
+
+// Close flushes and closes the log of every club opened so far
+func (r *ClubRegistry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range r.models {
+		m.Close()
+	}
+}
+
+func (r *ClubRegistry) readInfo(id string) (clubInfo, error) {
+	var info clubInfo
+	data, err := os.ReadFile(filepath.Join(r.dir, id, clubInfoFile))
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+func (r *ClubRegistry) quotaFor(info clubInfo) *ladderpb.ClubQuota {
+	if info.Quota != nil {
+		return info.Quota
+	}
+	return r.defaultQuota
+}
+
+func (r *ClubRegistry) clubToProto(info clubInfo) *ladderpb.Club {
+	return &ladderpb.Club{Id: info.ID, Name: info.Name, CreatedMs: info.CreatedMs, Quota: r.quotaFor(info)}
+}
+
+// clubFromRequest picks the club ID from the x-club-id header, or from the
+// subdomain of host when it ends in domain (e.g. "riverside.ladder.example.org")
+func clubFromRequest(header, host, domain string) string {
+	if header != "" {
+		return header
+	}
+	if domain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	suffix := "." + strings.TrimPrefix(domain, ".")
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	return strings.TrimSuffix(host, suffix)
+}
+
+// clubHTTPContext resolves the club for a plain HTTP request the same way
+// clubUnaryInterceptor does for gRPC, also accepting a ?club= query parameter
+// for clients such as TV browsers that cannot set headers
+func clubHTTPContext(r *http.Request, registry *ClubRegistry, domain string) (context.Context, error) {
+	ctx := r.Context()
+	if registry == nil {
+		return ctx, nil
+	}
+	header := r.Header.Get(clubHeader)
+	if header == "" {
+		header = r.URL.Query().Get("club")
+	}
+	clubID := clubFromRequest(header, r.Host, domain)
+	if clubID == "" {
+		return ctx, nil
+	}
+	m, err := registry.Model(clubID)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, clubModelKey{}, m), nil
+}
+
+// clubContext resolves ctx to a club's ladder as if the request had named the club;
+// clubID is empty for the default ladder
+func (h *LadderService) clubContext(ctx context.Context, clubID string) (context.Context, error) {
+	if clubID == "" {
+		return ctx, nil
+	}
+	if h.clubs == nil {
+		return nil, fmt.Errorf("multi-club mode is not enabled")
+	}
+	m, err := h.clubs.Model(clubID)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, clubModelKey{}, m), nil
+}
+
+// clubUnaryInterceptor resolves the club for each request and stores its model in
+// the context. Requests that name no club use the default ladder.
+func clubUnaryInterceptor(registry *ClubRegistry, domain string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var header, host string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(clubHeader); len(v) > 0 {
+				header = v[0]
+			}
+			if v := md.Get(":authority"); len(v) > 0 {
+				host = v[0]
+			}
+		}
+
+		clubID := clubFromRequest(header, host, domain)
+		if clubID == "" {
+			return handler(ctx, req)
+		}
+
+		m, err := registry.Model(clubID)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		resp, err := handler(context.WithValue(ctx, clubModelKey{}, m), req)
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return resp, status.Error(codes.ResourceExhausted, quotaErr.Error())
+		}
+		return resp, err
+	}
+}
+
+// CreateClub registers a new club with its own isolated ladder
+func (h *LadderService) CreateClub(ctx context.Context, req *ladderpb.CreateClubRequest) (*ladderpb.CreateClubResponse, error) {
+	if h.clubs == nil {
+		return &ladderpb.CreateClubResponse{Success: false}, fmt.Errorf("multi-club mode is not enabled")
+	}
+	if err := h.model.maintenance.check(); err != nil {
+		return &ladderpb.CreateClubResponse{Success: false}, err
+	}
+	club, err := h.clubs.CreateClub(req.ClubId, req.Name, req.Quota)
+	if err != nil {
+		return &ladderpb.CreateClubResponse{Success: false}, err
+	}
+	return &ladderpb.CreateClubResponse{Success: true, Club: club}, nil
+}
+
+// ListClubs returns all clubs hosted by this server
+func (h *LadderService) ListClubs(ctx context.Context, req *ladderpb.ListClubsRequest) (*ladderpb.ListClubsResponse, error) {
+	if h.clubs == nil {
+		return &ladderpb.ListClubsResponse{Clubs: []*ladderpb.Club{}}, nil
+	}
+	clubs, err := h.clubs.ListClubs()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListClubsResponse{Clubs: clubs}, nil
+}
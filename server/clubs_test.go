@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestClubRegistry_CreateAndList(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ladder_clubs_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewClubRegistry(dir, nil)
+	if err != nil {
+		t.Fatalf("NewClubRegistry failed: %v", err)
+	}
+
+	if _, err := r.CreateClub("riverside", "Riverside SC", nil); err != nil {
+		t.Fatalf("CreateClub failed: %v", err)
+	}
+	if _, err := r.CreateClub("abbey", "", nil); err != nil {
+		t.Fatalf("CreateClub failed: %v", err)
+	}
+	if _, err := r.CreateClub("riverside", "Again", nil); err == nil {
+		t.Error("expected error for duplicate club")
+	}
+	if _, err := r.CreateClub("../etc", "Bad", nil); err == nil {
+		t.Error("expected error for invalid club id")
+	}
+
+	// A fresh registry sees clubs created earlier
+	r2, _ := NewClubRegistry(dir, nil)
+	clubs, err := r2.ListClubs()
+	if err != nil {
+		t.Fatalf("ListClubs failed: %v", err)
+	}
+	if len(clubs) != 2 || clubs[0].Id != "abbey" || clubs[0].Name != "abbey" || clubs[1].Name != "Riverside SC" {
+		t.Errorf("unexpected clubs: %+v", clubs)
+	}
+
+	if _, err := r2.Model("nowhere"); err == nil {
+		t.Error("expected error for unknown club")
+	}
+}
+
+func TestClubUnaryInterceptor_Isolation(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ladder_clubs_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	r, _ := NewClubRegistry(dir, nil)
+	r.CreateClub("riverside", "Riverside SC", nil)
+
+	svc := NewLadderService(m)
+	svc.clubs = r
+	interceptor := clubUnaryInterceptor(r, "ladder.example.org")
+	info := &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/AddPlayer"}
+	call := func(ctx context.Context, req *ladderpb.AddPlayerRequest) error {
+		_, err := interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return svc.AddPlayer(ctx, req.(*ladderpb.AddPlayerRequest))
+		})
+		return err
+	}
+
+	byHeader := metadata.NewIncomingContext(context.Background(), metadata.Pairs(clubHeader, "riverside"))
+	if err := call(byHeader, &ladderpb.AddPlayerRequest{Name: "Alice", PlayerId: "alice"}); err != nil {
+		t.Fatalf("AddPlayer via header failed: %v", err)
+	}
+	bySubdomain := metadata.NewIncomingContext(context.Background(), metadata.Pairs(":authority", "riverside.ladder.example.org:443"))
+	if err := call(bySubdomain, &ladderpb.AddPlayerRequest{Name: "Bob", PlayerId: "bob"}); err != nil {
+		t.Fatalf("AddPlayer via subdomain failed: %v", err)
+	}
+	if err := call(context.Background(), &ladderpb.AddPlayerRequest{Name: "Carol", PlayerId: "carol"}); err != nil {
+		t.Fatalf("AddPlayer on default ladder failed: %v", err)
+	}
+
+	unknown := metadata.NewIncomingContext(context.Background(), metadata.Pairs(clubHeader, "nowhere"))
+	if err := call(unknown, &ladderpb.AddPlayerRequest{Name: "Dan", PlayerId: "dan"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for unknown club, got %v", err)
+	}
+
+	club, _ := r.Model("riverside")
+	if got := club.ListPlayers(); len(got) != 2 || got[0].Id != "alice" || got[1].Id != "bob" {
+		t.Errorf("unexpected club ladder: %+v", got)
+	}
+	if got := m.ListPlayers(); len(got) != 1 || got[0].Id != "carol" {
+		t.Errorf("unexpected default ladder: %+v", got)
+	}
+}
+
+func TestClubFromRequest(t *testing.T) {
+	tests := []struct {
+		header, host, domain string
+		want                 string
+	}{
+		{"abbey", "riverside.ladder.example.org", "ladder.example.org", "abbey"},
+		{"", "riverside.ladder.example.org", "ladder.example.org", "riverside"},
+		{"", "riverside.ladder.example.org:8080", "ladder.example.org", "riverside"},
+		{"", "ladder.example.org", "ladder.example.org", ""},
+		{"", "riverside.other.org", "ladder.example.org", ""},
+		{"", "riverside.ladder.example.org", "", ""},
+	}
+	for _, tt := range tests {
+		if got := clubFromRequest(tt.header, tt.host, tt.domain); got != tt.want {
+			t.Errorf("clubFromRequest(%q, %q, %q) = %q, want %q", tt.header, tt.host, tt.domain, got, tt.want)
+		}
+	}
+}
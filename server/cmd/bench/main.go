@@ -0,0 +1,172 @@
+// Command bench load-tests a ladder server over gRPC. It seeds the log with a
+// number of transactions, then measures AddMatchResult throughput and the
+// latency of the read RPCs. Without -addr it starts a server in-process.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"squash-ladder/server"
+	"squash-ladder/server/client"
+	ladderpb "squash-ladder/server/gen/ladder"
+	"squash-ladder/server/version"
+)
+
+func main() {
+	addr := flag.String("addr", "", "gRPC address of the server under test; empty starts one in-process")
+	seed := flag.Int("seed", 1000, "transactions to write before measuring")
+	players := flag.Int("players", 16, "ladder size")
+	ops := flag.Int("ops", 1000, "operations per measured RPC")
+	concurrency := flag.Int("concurrency", 4, "concurrent clients")
+	logPath := flag.String("log", "", "keep the in-process server's log at this path instead of a temporary file")
+	reproducible := flag.Bool("reproducible", false, "stamp the in-process server's transactions with a fixed clock and sequential IDs, so the seeded log is the same every run")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("bench", version.String())
+		return
+	}
+
+	if *players < 2 || *seed < *players {
+		log.Fatalf("need at least 2 players and a seed of at least -players transactions")
+	}
+
+	target := *addr
+	if target == "" {
+		path := *logPath
+		if path == "" {
+			dir, err := os.MkdirTemp("", "ladder_bench_*")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path = filepath.Join(dir, "transaction_log.jsonl")
+		}
+		target = startServer(path, *reproducible)
+	}
+
+	// Retries would hide failures and stretch the latencies measured
+	c, err := client.Dial(target, client.Options{ClientType: "bench", Retry: client.RetryPolicy{MaxAttempts: 1}})
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	fmt.Printf("Seeding %d transactions (%d players)...\n", *seed, *players)
+	start := time.Now()
+	ids := make([]string, *players)
+	for i := range ids {
+		resp, err := c.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: fmt.Sprintf("Bench %d", i)})
+		if err != nil {
+			log.Fatalf("AddPlayer failed: %v", err)
+		}
+		ids[i] = resp.Player.Id
+	}
+	for i := *players; i < *seed; i++ {
+		if err := addMatch(ctx, c, ids, i); err != nil {
+			log.Fatalf("seeding failed: %v", err)
+		}
+	}
+	fmt.Printf("Seeded in %s\n\n", time.Since(start).Round(time.Millisecond))
+
+	report("AddMatchResult", *ops, *concurrency, func(i int) error {
+		return addMatch(ctx, c, ids, i)
+	})
+	report("ListPlayers", *ops, *concurrency, func(int) error {
+		_, err := c.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+		return err
+	})
+	report("ListRecentMatches", *ops, *concurrency, func(int) error {
+		_, err := c.ListRecentMatches(ctx, &ladderpb.ListRecentMatchesRequest{Limit: 10})
+		return err
+	})
+}
+
+// addMatch records a defender win between neighbours, which leaves the ladder order unchanged
+func addMatch(ctx context.Context, c ladderpb.LadderServiceClient, ids []string, i int) error {
+	k := i % (len(ids) - 1)
+	set := &ladderpb.SetScore{ChallengerPoints: 5, DefenderPoints: 11}
+	_, err := c.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+		ChallengerId: ids[k+1],
+		DefenderId:   ids[k],
+		WinnerId:     ids[k],
+		SetScores:    []*ladderpb.SetScore{set, set, set},
+	})
+	return err
+}
+
+// report runs fn ops times across concurrency workers and prints throughput and latency percentiles
+func report(name string, ops, concurrency int, fn func(i int) error) {
+	latencies := make([]time.Duration, ops)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	next := make(chan int)
+
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				t := time.Now()
+				if err := fn(i); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+				}
+				latencies[i] = time.Since(t)
+			}
+		}()
+	}
+	for i := 0; i < ops; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if firstErr != nil {
+		log.Fatalf("%s failed: %v", name, firstErr)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	pct := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))].Round(time.Microsecond)
+	}
+	fmt.Printf("%-18s %8.0f ops/s   p50 %-10s p95 %-10s p99 %s\n",
+		name, float64(ops)/elapsed.Seconds(), pct(0.50), pct(0.95), pct(0.99))
+}
+
+func startServer(dataPath string, reproducible bool) string {
+	addrs := make(chan net.Addr, 1)
+	go func() {
+		cfg := server.Config{
+			DataPath: dataPath,
+			HTTPAddr: "127.0.0.1:0",
+			GRPCAddr: "127.0.0.1:0",
+			OnListening: func(httpAddr, grpcAddr net.Addr) {
+				addrs <- grpcAddr
+			},
+		}
+		if reproducible {
+			cfg.Clock = server.NewSteppingClock(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), time.Minute)
+			cfg.IDs = &server.SequentialIDs{Prefix: "bench-"}
+		}
+		if err := server.Run(cfg); err != nil {
+			log.Fatalf("Server stopped: %v", err)
+		}
+	}()
+	return (<-addrs).String()
+}
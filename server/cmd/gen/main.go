@@ -0,0 +1,230 @@
+// Command gen regenerates the web client's gRPC-Web TypeScript from
+// proto/ladder.proto and checks that the client and the protos agree.
+//
+//	go run ./cmd/gen          # write client/src/grpc/ladder_pb.* and ladder_grpc_web_pb.*
+//	go run ./cmd/gen -check   # fail if they are stale, or the protos break compatibility
+//
+// Generating needs protoc with protoc-gen-js and protoc-gen-grpc-web on the PATH;
+// -check also needs buf. The ES exports the browser build imports are listed from
+// the proto itself, so a new message can no longer be missing from them.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"squash-ladder/server/version"
+)
+
+const (
+	protoDir  = "server/proto"
+	protoFile = "ladder.proto"
+	clientDir = "client/src/grpc"
+)
+
+// generated lists the files protoc writes for the web client
+var generated = []string{"ladder_pb.js", "ladder_pb.d.ts", "ladder_grpc_web_pb.js", "ladder_grpc_web_pb.d.ts"}
+
+func main() {
+	check := flag.Bool("check", false, "check the generated client and the protos instead of writing files")
+	against := flag.String("against", ".git#branch=main,subdir="+protoDir, "buf input the protos must stay compatible with, for -check")
+	root := flag.String("root", "", "repository root; found from the working directory when empty")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("gen", version.String())
+		return
+	}
+
+	dir := *root
+	if dir == "" {
+		var err error
+		if dir, err = findRoot(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	proto, err := os.ReadFile(filepath.Join(dir, protoDir, protoFile))
+	if err != nil {
+		log.Fatal(err)
+	}
+	types := protoTypes(proto)
+	files, err := generate(dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !*check {
+		for _, name := range generated {
+			if err := os.WriteFile(filepath.Join(dir, clientDir, name), files[name], 0o644); err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Printf("wrote %d files to %s\n", len(generated), clientDir)
+		return
+	}
+
+	var problems []string
+	for _, name := range generated {
+		existing, err := os.ReadFile(filepath.Join(dir, clientDir, name))
+		if os.IsNotExist(err) {
+			continue // Not generated here; bazel builds generate their own
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !bytes.Equal(existing, files[name]) {
+			problems = append(problems, fmt.Sprintf("%s/%s is stale; run go run ./cmd/gen", clientDir, name))
+		}
+	}
+	service, err := os.ReadFile(filepath.Join(dir, clientDir, "ladderService.ts"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range missingImports(service, types) {
+		problems = append(problems, fmt.Sprintf("%s/ladderService.ts imports %s, which %s does not define", clientDir, name, protoFile))
+	}
+	if err := breaking(dir, *against); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("client and protos are in sync")
+}
+
+// findRoot returns the repository root: the workspace under bazel run, otherwise
+// the nearest directory above the working directory with a MODULE.bazel
+func findRoot() (string, error) {
+	if dir := os.Getenv("BUILD_WORKSPACE_DIRECTORY"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "MODULE.bazel")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no MODULE.bazel above the working directory; pass -root")
+		}
+		dir = parent
+	}
+}
+
+// generate runs protoc into a temporary directory and returns the files ready for
+// the browser build, by name
+func generate(root string, exports []string) (map[string][]byte, error) {
+	out, err := os.MkdirTemp("", "ladder_gen_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(out)
+
+	cmd := exec.Command("protoc",
+		"-I", filepath.Join(root, protoDir),
+		"--js_out=import_style=commonjs,binary:"+out,
+		"--grpc-web_out=import_style=commonjs+dts,mode=grpcwebtext:"+out,
+		protoFile,
+	)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("protoc: %w (gen needs protoc, protoc-gen-js and protoc-gen-grpc-web on the PATH)", err)
+	}
+	files := make(map[string][]byte, len(generated))
+	for _, name := range generated {
+		src, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = prepare(name, src, exports)
+	}
+	return files, nil
+}
+
+// prepare makes protoc's CommonJS output loadable as an ES module in the browser
+func prepare(name string, src []byte, exports []string) []byte {
+	if !strings.HasSuffix(name, ".js") {
+		return src
+	}
+	s := string(src)
+	switch name {
+	case "ladder_pb.js":
+		// Some protobuf runtimes lack readStringRequireUtf8
+		s = strings.ReplaceAll(s, "readStringRequireUtf8", "readString")
+		s += "export const { " + strings.Join(exports, ", ") + " } = proto.ladder;\n"
+	case "ladder_grpc_web_pb.js":
+		// The bundler may hand back a frozen module, which the client can't extend
+		const req = "proto.ladder = require('./ladder_pb.js');"
+		s = strings.Replace(s, req, req+" if (!Object.isExtensible(proto.ladder)) { proto.ladder = Object.assign({}, proto.ladder); }", 1)
+		s += "export const { LadderServiceClient } = proto.ladder;\n"
+	}
+	return []byte("var exports = {};\n" + s)
+}
+
+// protoTypes returns the top-level messages and enums a proto file declares, in
+// order. Nested types are reached through their parents, so they aren't exported.
+func protoTypes(proto []byte) []string {
+	var names []string
+	depth := 0
+	for _, line := range strings.Split(string(proto), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		if depth == 0 && len(fields) >= 2 && (fields[0] == "message" || fields[0] == "enum") {
+			name, _, _ := strings.Cut(fields[1], "{")
+			names = append(names, name)
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+	}
+	return names
+}
+
+var pbImport = regexp.MustCompile(`(?s)import\s*(?:type\s*)?\{([^}]*)\}\s*from\s*'\./ladder_pb'`)
+
+// missingImports returns the names a TypeScript file imports from ladder_pb that
+// the proto doesn't declare, sorted
+func missingImports(ts []byte, types []string) []string {
+	declared := make(map[string]bool, len(types))
+	for _, t := range types {
+		declared[t] = true
+	}
+	var missing []string
+	for _, m := range pbImport.FindAllSubmatch(ts, -1) {
+		for _, name := range strings.Split(string(m[1]), ",") {
+			name, _, _ = strings.Cut(strings.TrimSpace(name), " as ")
+			if name != "" && !declared[name] {
+				missing = append(missing, name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// breaking runs buf's breaking-change check of the protos against an earlier
+// version of them
+func breaking(root, against string) error {
+	cmd := exec.Command("buf", "breaking", protoDir, "--against", against)
+	cmd.Dir = root
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("buf: %w", err)
+		}
+		return fmt.Errorf("%s breaks compatibility with %s:\n%s", protoFile, against, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
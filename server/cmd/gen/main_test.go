@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProtoTypes(t *testing.T) {
+	proto := `syntax = "proto3";
+package ladder;
+
+enum Side { SIDE_UNSPECIFIED = 0; } // message Commented {}
+
+message Outer {
+  message Inner { string id = 1; }
+  enum Kind {
+    KIND_UNSPECIFIED = 0;
+  }
+  Inner inner = 1;
+}
+
+message Empty{}
+`
+	if got, want := protoTypes([]byte(proto)), []string{"Side", "Outer", "Empty"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestClientImports checks the web client against the real proto, so a renamed or
+// removed message fails here before it fails in the browser build
+func TestClientImports(t *testing.T) {
+	proto, err := os.ReadFile("../../proto/ladder.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := os.ReadFile("../../../client/src/grpc/ladderService.ts")
+	if err != nil {
+		t.Skip("no web client in this tree")
+	}
+	types := protoTypes(proto)
+	if len(types) == 0 {
+		t.Fatal("expected types in ladder.proto")
+	}
+	if missing := missingImports(service, types); len(missing) > 0 {
+		t.Errorf("ladderService.ts imports types ladder.proto doesn't define: %v", missing)
+	}
+	if missing := missingImports([]byte("import {\n  Player,\n  Renamed as R,\n} from './ladder_pb'"), types); !reflect.DeepEqual(missing, []string{"Renamed"}) {
+		t.Errorf("expected Renamed to be missing, got %v", missing)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	pb := string(prepare("ladder_pb.js", []byte("x = reader.readStringRequireUtf8();\n"), []string{"Player", "SetScore"}))
+	if !strings.HasPrefix(pb, "var exports = {};\n") || strings.Contains(pb, "RequireUtf8") ||
+		!strings.HasSuffix(pb, "export const { Player, SetScore } = proto.ladder;\n") {
+		t.Errorf("unexpected ladder_pb.js:\n%s", pb)
+	}
+	web := string(prepare("ladder_grpc_web_pb.js", []byte("proto.ladder = require('./ladder_pb.js');\n"), nil))
+	if !strings.Contains(web, "Object.isExtensible(proto.ladder)") || !strings.HasSuffix(web, "export const { LadderServiceClient } = proto.ladder;\n") {
+		t.Errorf("unexpected ladder_grpc_web_pb.js:\n%s", web)
+	}
+	if dts := prepare("ladder_pb.d.ts", []byte("export class Player {}\n"), nil); string(dts) != "export class Player {}\n" {
+		t.Errorf("expected declarations to be left alone, got %q", dts)
+	}
+}
@@ -0,0 +1,327 @@
+// Command ladder-tui is a terminal dashboard for the clubhouse: it shows live
+// standings and recent results and lets players enter results from a keyboard.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"squash-ladder/server/client"
+	ladderpb "squash-ladder/server/gen/ladder"
+	"squash-ladder/server/version"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+	bold        = "\033[1m"
+	dim         = "\033[2m"
+	reset       = "\033[0m"
+	recentLimit = 8
+)
+
+type dashboard struct {
+	client *client.Client
+
+	mu      sync.Mutex
+	paused  bool // Set while the result form is on screen
+	status  string
+	players []*ladderpb.Player
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:9090", "gRPC address of the ladder server")
+	clubID := flag.String("club", "", "club ID when the server hosts several clubs")
+	refresh := flag.Duration("refresh", 5*time.Second, "how often to refresh the standings")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("ladder-tui", version.String())
+		return
+	}
+
+	c, err := client.Dial(*addr, client.Options{ClubID: *clubID, ClientType: "cli"})
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer c.Close()
+
+	d := &dashboard{client: c}
+	d.redraw()
+
+	// Commands are single keys, so a background redraw never clears a half-typed
+	// one. Without a terminal stty can drive, commands are read line by line and
+	// the screen is only repainted after each, as a redraw would clear the line.
+	term, err := newTerminal()
+	if err == nil {
+		defer term.lines()
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			term.lines()
+			os.Exit(1)
+		}()
+		go func() {
+			for range time.Tick(*refresh) {
+				d.redraw()
+			}
+		}()
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		command, err := readCommand(in, term)
+		if err != nil {
+			return
+		}
+		switch strings.ToLower(strings.TrimSpace(command)) {
+		case "q", "quit":
+			fmt.Print(clearScreen)
+			return
+		case "r", "result":
+			if term != nil {
+				term.lines()
+			}
+			d.resultForm(in)
+			if term != nil {
+				term.keys()
+			}
+		case "":
+		default:
+			if term != nil {
+				continue
+			}
+		}
+		d.redraw()
+	}
+}
+
+// readCommand reads one key from a terminal in key mode, otherwise one line
+func readCommand(in *bufio.Reader, term *terminal) (string, error) {
+	if term == nil {
+		return in.ReadString('\n')
+	}
+	b, err := in.ReadByte()
+	return string(b), err
+}
+
+// terminal switches standard input between line mode, for the result form, and
+// key-at-a-time mode without echo, for commands. It uses stty rather than a
+// terminal library to keep the dashboard free of dependencies.
+type terminal struct {
+	saved string // stty -g settings to return to for line mode
+}
+
+// newTerminal saves the terminal's settings and switches it to key mode. It fails
+// when standard input is not a terminal or stty is missing.
+func newTerminal() (*terminal, error) {
+	cmd := exec.Command("stty", "-g")
+	cmd.Stdin = os.Stdin
+	saved, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	t := &terminal{saved: strings.TrimSpace(string(saved))}
+	if err := t.keys(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *terminal) keys() error {
+	return stty("-icanon", "-echo", "min", "1")
+}
+
+func (t *terminal) lines() error {
+	return stty(t.saved)
+}
+
+func stty(args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+func (d *dashboard) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 5*time.Second)
+}
+
+// redraw fetches the ladder and recent results and repaints the whole screen
+func (d *dashboard) redraw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paused {
+		return
+	}
+
+	ctx, cancel := d.context()
+	defer cancel()
+
+	var sb strings.Builder
+	sb.WriteString(clearScreen)
+	fmt.Fprintf(&sb, "%sSQUASH LADDER%s  %s%s%s\n\n", bold, reset, dim, time.Now().Format("Mon 2 Jan 15:04:05"), reset)
+
+	players, err := d.client.Players(ctx)
+	if err != nil {
+		fmt.Fprintf(&sb, "Could not load the ladder: %v\n", err)
+	} else {
+		d.players = players
+		if len(d.players) == 0 {
+			sb.WriteString("The ladder is empty.\n")
+		}
+		for _, p := range d.players {
+			fmt.Fprintf(&sb, "%3d. %s\n", p.Rank, p.Name)
+		}
+	}
+
+	fmt.Fprintf(&sb, "\n%sRecent results%s\n", bold, reset)
+	recent, err := d.client.RecentMatches(ctx, recentLimit)
+	if err != nil {
+		fmt.Fprintf(&sb, "Could not load recent results: %v\n", err)
+	} else if len(recent) == 0 {
+		sb.WriteString("No results recorded yet.\n")
+	} else {
+		for _, mr := range recent {
+			sb.WriteString(d.describe(mr) + "\n")
+		}
+	}
+
+	if d.status != "" {
+		fmt.Fprintf(&sb, "\n%s\n", d.status)
+	}
+	fmt.Fprintf(&sb, "\n%s[r] enter result  [enter] refresh  [q] quit%s\n> ", dim, reset)
+	fmt.Print(sb.String())
+}
+
+func (d *dashboard) describe(mr *ladderpb.MatchResult) string {
+	name := func(id string) string {
+		for _, p := range d.players {
+			if p.Id == id {
+				return p.Name
+			}
+		}
+		return id
+	}
+	loser := mr.DefenderId
+	if mr.WinnerId == mr.DefenderId {
+		loser = mr.ChallengerId
+	}
+	sets := make([]string, len(mr.SetScores))
+	for i, s := range mr.SetScores {
+		sets[i] = fmt.Sprintf("%d-%d", s.ChallengerPoints, s.DefenderPoints)
+	}
+	return fmt.Sprintf("  %s beat %s (%s)", name(mr.WinnerId), name(loser), strings.Join(sets, ", "))
+}
+
+// resultForm prompts for a match result and submits it
+func (d *dashboard) resultForm(in *bufio.Reader) {
+	d.mu.Lock()
+	d.paused = true
+	players := d.players
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.paused = false
+		d.mu.Unlock()
+	}()
+
+	fmt.Print(clearScreen)
+	fmt.Printf("%sEnter result%s (leave blank to cancel)\n\n", bold, reset)
+	for _, p := range players {
+		fmt.Printf("%3d. %s\n", p.Rank, p.Name)
+	}
+	fmt.Println()
+
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		line, _ := in.ReadString('\n')
+		return strings.TrimSpace(line)
+	}
+	challengerRank := ask("Challenger (rank): ")
+	if challengerRank == "" {
+		d.setStatus("Result entry cancelled.")
+		return
+	}
+	defenderRank := ask("Defender (rank): ")
+	if defenderRank == "" {
+		d.setStatus("Result entry cancelled.")
+		return
+	}
+	scores := ask("Scores, challenger first (e.g. 11-5 9-11 11-7 11-3): ")
+	if scores == "" {
+		d.setStatus("Result entry cancelled.")
+		return
+	}
+	res, err := readResult(players, challengerRank, defenderRank, scores)
+	if err != nil {
+		d.setStatus(fmt.Sprintf("Could not read the result: %v", err))
+		return
+	}
+
+	ctx, cancel := d.context()
+	defer cancel()
+	if _, err := d.client.SubmitResult(ctx, res.challenger.Id, res.defender.Id, res.scores); err != nil {
+		d.setStatus(fmt.Sprintf("Could not record result: %v", err))
+		return
+	}
+	d.setStatus(fmt.Sprintf("Recorded: %s won.", res.winner.Name))
+}
+
+// result is a match typed into the result form
+type result struct {
+	challenger, defender, winner *ladderpb.Player
+	scores                       string
+}
+
+// readResult picks the players by the ranks typed into the result form and the
+// winner by the sets in scores, which are given challenger first
+func readResult(players []*ladderpb.Player, challengerRank, defenderRank, scores string) (*result, error) {
+	pick := func(text string) (*ladderpb.Player, error) {
+		rank, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a rank", text)
+		}
+		for _, p := range players {
+			if p.Rank == int32(rank) {
+				return p, nil
+			}
+		}
+		return nil, fmt.Errorf("nobody is ranked %d", rank)
+	}
+	challenger, err := pick(challengerRank)
+	if err != nil {
+		return nil, err
+	}
+	defender, err := pick(defenderRank)
+	if err != nil {
+		return nil, err
+	}
+	if defender.Id == challenger.Id {
+		return nil, fmt.Errorf("%s cannot play themselves", challenger.Name)
+	}
+	_, challengerSets, defenderSets, err := client.ParseScores(scores)
+	if err != nil {
+		return nil, err
+	}
+	winner := challenger
+	if defenderSets > challengerSets {
+		winner = defender
+	}
+	return &result{challenger: challenger, defender: defender, winner: winner, scores: scores}, nil
+}
+
+func (d *dashboard) setStatus(s string) {
+	d.mu.Lock()
+	d.status = s
+	d.mu.Unlock()
+}
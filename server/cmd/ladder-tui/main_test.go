@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestReadResult(t *testing.T) {
+	players := []*ladderpb.Player{
+		{Id: "a", Name: "Alice", Rank: 1},
+		{Id: "b", Name: "Bob", Rank: 2},
+		{Id: "c", Name: "Carol", Rank: 3},
+	}
+	for _, tc := range []struct {
+		name                   string
+		challenger, defender   string
+		scores                 string
+		wantChallenger, winner string
+		wantErr                bool
+	}{
+		{"challenger wins", "3", "2", "11-5 9-11 11-7 11-3", "c", "c", false},
+		{"defender wins", "2", "1", "5-11 11-9 7-11", "b", "a", false},
+		{"padded rank", " 2 ", "1", "11-5 11-7 11-3", "b", "b", false},
+		{"rank is not a number", "two", "1", "11-5 11-7 11-3", "", "", true},
+		{"nobody at rank", "4", "1", "11-5 11-7 11-3", "", "", true},
+		{"same player", "2", "2", "11-5 11-7 11-3", "", "", true},
+		{"bad scores", "3", "2", "11:5", "", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := readResult(players, tc.challenger, tc.defender, tc.scores)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.challenger.Id != tc.wantChallenger || res.winner.Id != tc.winner || res.scores != tc.scores {
+				t.Errorf("got challenger %s, winner %s, scores %q", res.challenger.Id, res.winner.Id, res.scores)
+			}
+		})
+	}
+}
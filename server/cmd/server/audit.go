@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"squash-ladder/server"
+)
+
+// runVerifyAudit checks a transcript from ExportAuditTranscript, for the league or
+// anyone else holding the club's public key
+func runVerifyAudit(args []string) {
+	fs := flag.NewFlagSet("verify-audit", flag.ExitOnError)
+	publicKey := fs.String("key", "", "the club's public audit key")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n"+
+			"  %[1]s verify-audit --key <public key> [transcript]\n\n"+
+			"Checks the hashes and signature of an audit transcript, read from stdin\n"+
+			"when no file is given.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *publicKey == "" || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	in := io.Reader(os.Stdin)
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", fs.Arg(0), err)
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		log.Fatalf("Failed to read the transcript: %v", err)
+	}
+	n, err := server.VerifyAuditTranscript(string(data), *publicKey)
+	if err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+	fmt.Printf("OK: %d records, signed by %s\n", n, *publicKey)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"squash-ladder/server"
+)
+
+// loadEnvFile sets the environment variables listed in path as NAME=value lines,
+// overriding the process environment. Blank lines and lines starting with # are
+// skipped, and a value may be quoted. Removing a line does not unset its variable.
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(strings.TrimPrefix(name, "export "))
+		if !ok || name == "" {
+			return fmt.Errorf("%s:%d: expected NAME=value", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	// Only apply a file that parsed completely
+	for name, value := range vars {
+		os.Setenv(name, value)
+	}
+	return nil
+}
+
+// reloadableFromEnv reads the settings that SIGHUP and ReloadConfig can change into cfg
+func reloadableFromEnv(cfg *server.Config) error {
+	cfg.IntegrityWebhookURL = os.Getenv("LADDER_INTEGRITY_WEBHOOK_URL")
+	cfg.GrowthWebhookURL = os.Getenv("LADDER_GROWTH_WEBHOOK_URL")
+	cfg.CORSOrigins = nil
+	for _, origin := range strings.Split(os.Getenv("LADDER_CORS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.CORSOrigins = append(cfg.CORSOrigins, origin)
+		}
+	}
+	for name, field := range map[string]*int64{
+		"LADDER_LOG_WARN_BYTES":        &cfg.LogWarnBytes,
+		"LADDER_LOG_WARN_TRANSACTIONS": &cfg.LogWarnTransactions,
+	} {
+		*field = 0
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s: %q", name, v)
+			}
+			*field = n
+		}
+	}
+	return nil
+}
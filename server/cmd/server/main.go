@@ -1,36 +1,315 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"net/netip"
 	"os"
+	"os/exec"
+	"strconv"
+	"time"
 
 	"squash-ladder/server"
+	"squash-ladder/server/version"
 )
 
 func main() {
-	// Get configuration from environment or use defaults
-	dataPath := os.Getenv("LADDER_DATA_FILE")
-	if dataPath == "" {
-		dataPath = "data/transaction_log.jsonl"
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestore(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		runVerifyAudit(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit-keys" {
+		private, public, err := server.GenerateAuditKeys()
+		if err != nil {
+			log.Fatalf("Failed to generate audit keys: %v", err)
+		}
+		fmt.Printf("LADDER_AUDIT_SIGNING_KEY=%s\n# Public key for verify-audit: %s\n", private, public)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		// For client generators and API portals; the running server serves the same
+		// document at /api/docs/openapi.json when LADDER_API_DOCS is set
+		doc, err := server.OpenAPIDocument(os.Getenv("LADDER_PUBLIC_URL"))
+		if err != nil {
+			log.Fatalf("Failed to generate the OpenAPI document: %v", err)
+		}
+		fmt.Println(string(doc))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "proto-check" {
+		runProtoCheck(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "vapid-keys" {
+		private, public, err := server.GenerateVAPIDKeys()
+		if err != nil {
+			log.Fatalf("Failed to generate VAPID keys: %v", err)
+		}
+		fmt.Printf("LADDER_VAPID_PRIVATE_KEY=%s\n# Public key (applicationServerKey): %s\n", private, public)
+		return
+	}
+
+	// LADDER_CONFIG_FILE holds more settings as NAME=value lines; on SIGHUP it is read
+	// again and the reloadable ones applied
+	configFile := os.Getenv("LADDER_CONFIG_FILE")
+	if configFile != "" {
+		if err := loadEnvFile(configFile); err != nil {
+			log.Fatalf("Failed to read LADDER_CONFIG_FILE: %v", err)
+		}
+	}
+
+	// Flags override the environment, which overrides the defaults
+	dataPath := flag.String("data", envOr("LADDER_DATA_FILE", "data/transaction_log.jsonl"), "path of the transaction log (env LADDER_DATA_FILE)")
+	httpPort := flag.String("http-port", envOr("PORT", "8080"), "port for gRPC-Web and HTTP (env PORT)")
+	grpcPort := flag.String("grpc-port", envOr("GRPC_PORT", "9090"), "port for plain gRPC; -grpc-port= disables it (env GRPC_PORT)")
+	httpAddr := flag.String("http-addr", os.Getenv("LADDER_HTTP_ADDR"), "full HTTP listen address, e.g. 127.0.0.1:8080; overrides -http-port (env LADDER_HTTP_ADDR)")
+	grpcAddr := flag.String("grpc-addr", os.Getenv("LADDER_GRPC_ADDR"), "full gRPC listen address or unix:/path; overrides -grpc-port (env LADDER_GRPC_ADDR)")
+	singlePort := flag.Bool("single-port", os.Getenv("LADDER_SINGLE_PORT") == "true", "serve gRPC, gRPC-Web and HTTP on the HTTP port only (env LADDER_SINGLE_PORT)")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("server", version.String())
+		return
+	}
+
+	var integrityInterval time.Duration
+	if v := os.Getenv("LADDER_INTEGRITY_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid LADDER_INTEGRITY_CHECK_INTERVAL: %v", err)
+		}
+		integrityInterval = d
 	}
 
-	httpPort := os.Getenv("PORT")
-	if httpPort == "" {
-		httpPort = "8080"
+	var resultLinkTTL time.Duration
+	if v := os.Getenv("LADDER_RESULT_LINK_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid LADDER_RESULT_LINK_TTL: %v", err)
+		}
+		resultLinkTTL = d
 	}
 
-	grpcPort := os.Getenv("GRPC_PORT")
-	if grpcPort == "" {
-		grpcPort = "9090"
+	var syncInterval time.Duration
+	if v := os.Getenv("LADDER_SYNC_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid LADDER_SYNC_INTERVAL: %v", err)
+		}
+		syncInterval = d
+	}
+
+	rpcTimeout := durationEnv("LADDER_RPC_TIMEOUT")
+	httpReadTimeout := durationEnv("LADDER_HTTP_READ_TIMEOUT")
+	httpWriteTimeout := durationEnv("LADDER_HTTP_WRITE_TIMEOUT")
+
+	clubMaxPlayers := intEnv("LADDER_CLUB_MAX_PLAYERS")
+	clubMaxMatches := intEnv("LADDER_CLUB_MAX_MATCHES_PER_MONTH")
+	clubMaxStorage := intEnv("LADDER_CLUB_MAX_STORAGE_BYTES")
+	checkpointInterval := intEnv("LADDER_LOG_CHECKPOINT_INTERVAL")
+	attachmentStore := server.BackupConfig{
+		Dir:         os.Getenv("LADDER_ATTACHMENT_DIR"),
+		S3Endpoint:  os.Getenv("LADDER_ATTACHMENT_S3_ENDPOINT"),
+		S3Bucket:    os.Getenv("LADDER_ATTACHMENT_S3_BUCKET"),
+		S3Prefix:    os.Getenv("LADDER_ATTACHMENT_S3_PREFIX"),
+		S3Region:    os.Getenv("LADDER_ATTACHMENT_S3_REGION"),
+		S3AccessKey: os.Getenv("LADDER_ATTACHMENT_S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("LADDER_ATTACHMENT_S3_SECRET_KEY"),
+	}
+
+	network := server.NetworkPolicy{
+		Allowed:        networksEnv("LADDER_ALLOWED_NETWORKS"),
+		Mutations:      networksEnv("LADDER_MUTATION_NETWORKS"),
+		TrustedProxies: networksEnv("LADDER_TRUSTED_PROXIES"),
 	}
 
 	cfg := server.Config{
-		DataPath: dataPath,
-		HTTPPort: httpPort,
-		GRPCPort: grpcPort,
+		DataPath:           *dataPath,
+		HTTPPort:           *httpPort,
+		GRPCPort:           *grpcPort,
+		HTTPAddr:           *httpAddr,
+		GRPCAddr:           *grpcAddr,
+		SinglePort:         *singlePort,
+		VerifyLogOnStartup: os.Getenv("LADDER_VERIFY_LOG") == "true",
+		RepairLogOnStartup: os.Getenv("LADDER_REPAIR_LOG") == "true",
+
+		LogCheckpointInterval: int(checkpointInterval),
+
+		IntegrityCheckInterval: integrityInterval,
+		GrowthCheckInterval:    durationEnv("LADDER_GROWTH_CHECK_INTERVAL"),
+		AdminToken:             os.Getenv("LADDER_ADMIN_TOKEN"),
+		TwilioAuthToken:        os.Getenv("TWILIO_AUTH_TOKEN"),
+		SMSWebhookURL:          os.Getenv("LADDER_SMS_WEBHOOK_URL"),
+		TelegramBotToken:       os.Getenv("TELEGRAM_BOT_TOKEN"),
+		TelegramChatID:         os.Getenv("TELEGRAM_CHAT_ID"),
+		MultiClub:              os.Getenv("LADDER_MULTI_CLUB") == "true",
+		ClubDomain:             os.Getenv("LADDER_CLUB_DOMAIN"),
+		ClubMaxPlayers:         int32(clubMaxPlayers),
+		ClubMaxMatchesPerMonth: int32(clubMaxMatches),
+		ClubMaxStorageBytes:    clubMaxStorage,
+		ResultLinkSecret:       os.Getenv("LADDER_RESULT_LINK_SECRET"),
+		ResultLinkTTL:          resultLinkTTL,
+		PublicURL:              os.Getenv("LADDER_PUBLIC_URL"),
+		AttachmentSecret:       os.Getenv("LADDER_ATTACHMENT_SECRET"),
+		Attachments:            attachmentStore,
+		MaxAttachmentBytes:     intEnv("LADDER_MAX_ATTACHMENT_BYTES"),
+		AttachmentURLTTL:       durationEnv("LADDER_ATTACHMENT_URL_TTL"),
+		SportyHQAPIKey:         os.Getenv("LADDER_SPORTYHQ_API_KEY"),
+		SportyHQLadderID:       os.Getenv("LADDER_SPORTYHQ_LADDER_ID"),
+		SportyHQBaseURL:        os.Getenv("LADDER_SPORTYHQ_BASE_URL"),
+		MaxRequestBytes:        intEnv("LADDER_MAX_REQUEST_BYTES"),
+		RPCTimeout:             rpcTimeout,
+		DisableRPCMetrics:      os.Getenv("LADDER_DISABLE_RPC_METRICS") == "true",
+		HTTPReadTimeout:        httpReadTimeout,
+		HTTPWriteTimeout:       httpWriteTimeout,
+		SyncInterval:           syncInterval,
+		SyncPullRoster:         os.Getenv("LADDER_SYNC_PULL_ROSTER") == "true",
+		GoogleSheetID:          os.Getenv("LADDER_GOOGLE_SHEET_ID"),
+		GoogleCredentialsFile:  os.Getenv("LADDER_GOOGLE_CREDENTIALS_FILE"),
+		BackupSchedule:         os.Getenv("LADDER_BACKUP_SCHEDULE"),
+		Backup:                 backupConfigFromEnv(),
+		LogEncryptionKey:       logKeyFromEnv(),
+		APIDocs:                os.Getenv("LADDER_API_DOCS") == "true",
+		GRPCReflection:         os.Getenv("LADDER_GRPC_REFLECTION") == "true",
+		PublicMode:             os.Getenv("LADDER_PUBLIC_MODE") == "true",
+		MemberToken:            os.Getenv("LADDER_MEMBER_TOKEN"),
+		Network:                network,
+		PlayerTokenSecret:      os.Getenv("LADDER_PLAYER_TOKEN_SECRET"),
+		RecordClientAddresses:  os.Getenv("LADDER_RECORD_CLIENT_ADDRESSES") == "true",
+		AuditSigningKey:        os.Getenv("LADDER_AUDIT_SIGNING_KEY"),
+		VAPIDPrivateKey:        os.Getenv("LADDER_VAPID_PRIVATE_KEY"),
+		VAPIDSubject:           os.Getenv("LADDER_VAPID_SUBJECT"),
+		FCMCredentialsFile:     os.Getenv("LADDER_FCM_CREDENTIALS_FILE"),
+		SMTP: server.SMTPConfig{
+			Addr:     os.Getenv("LADDER_SMTP_ADDR"),
+			Username: os.Getenv("LADDER_SMTP_USERNAME"),
+			Password: os.Getenv("LADDER_SMTP_PASSWORD"),
+			From:     os.Getenv("LADDER_SMTP_FROM"),
+		},
+		Wallet: server.WalletConfig{
+			PassTypeID:            os.Getenv("LADDER_WALLET_PASS_TYPE_ID"),
+			TeamID:                os.Getenv("LADDER_WALLET_TEAM_ID"),
+			CertFile:              os.Getenv("LADDER_WALLET_CERT_FILE"),
+			WWDRFile:              os.Getenv("LADDER_WALLET_WWDR_FILE"),
+			GoogleIssuerID:        os.Getenv("LADDER_WALLET_GOOGLE_ISSUER_ID"),
+			GoogleCredentialsFile: os.Getenv("LADDER_WALLET_GOOGLE_CREDENTIALS_FILE"),
+			Organization:          os.Getenv("LADDER_WALLET_ORGANIZATION"),
+		},
+		DigestSchedule: os.Getenv("LADDER_DIGEST_SCHEDULE"),
+		DefaultLocale:  os.Getenv("LADDER_DEFAULT_LOCALE"),
+	}
+
+	if err := reloadableFromEnv(&cfg); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if configFile != "" {
+		cfg.Reload = func() (server.Config, error) {
+			var next server.Config
+			if err := loadEnvFile(configFile); err != nil {
+				return next, err
+			}
+			err := reloadableFromEnv(&next)
+			return next, err
+		}
 	}
 
 	if err := server.Run(cfg); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// backupConfigFromEnv reads the backup target, shared by the server and the restore command
+func backupConfigFromEnv() server.BackupConfig {
+	return server.BackupConfig{
+		Dir:         os.Getenv("LADDER_BACKUP_DIR"),
+		S3Endpoint:  os.Getenv("LADDER_BACKUP_S3_ENDPOINT"),
+		S3Bucket:    os.Getenv("LADDER_BACKUP_S3_BUCKET"),
+		S3Prefix:    os.Getenv("LADDER_BACKUP_S3_PREFIX"),
+		S3Region:    os.Getenv("LADDER_BACKUP_S3_REGION"),
+		S3AccessKey: os.Getenv("LADDER_BACKUP_S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("LADDER_BACKUP_S3_SECRET_KEY"),
+		Keep:        int(intEnv("LADDER_BACKUP_KEEP")),
+	}
+}
+
+// logKeyFromEnv reads the base64 log encryption key from LADDER_LOG_KEY, the file
+// named by LADDER_LOG_KEY_FILE, or the output of LADDER_LOG_KEY_COMMAND, which can
+// fetch it from a KMS or secret manager (e.g. "aws kms decrypt ..."). It returns nil
+// when none is set.
+func logKeyFromEnv() []byte {
+	var encoded, source string
+	switch {
+	case os.Getenv("LADDER_LOG_KEY") != "":
+		encoded, source = os.Getenv("LADDER_LOG_KEY"), "LADDER_LOG_KEY"
+	case os.Getenv("LADDER_LOG_KEY_FILE") != "":
+		source = "LADDER_LOG_KEY_FILE"
+		data, err := os.ReadFile(os.Getenv(source))
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", source, err)
+		}
+		encoded = string(data)
+	case os.Getenv("LADDER_LOG_KEY_COMMAND") != "":
+		source = "LADDER_LOG_KEY_COMMAND"
+		out, err := exec.Command("sh", "-c", os.Getenv(source)).Output()
+		if err != nil {
+			log.Fatalf("%s failed: %v", source, err)
+		}
+		encoded = string(out)
+	default:
+		return nil
+	}
+	key, err := server.ParseLogKey(encoded)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", source, err)
+	}
+	return key
+}
+
+// envOr returns the environment variable, or def when it is unset or empty
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// intEnv parses an optional non-negative integer environment variable, exiting on bad input
+func intEnv(name string) int64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s: %q", name, v)
+	}
+	return n
+}
+
+// networksEnv parses an optional list of networks such as "private,203.0.113.0/24",
+// exiting on bad input
+func networksEnv(name string) []netip.Prefix {
+	networks, err := server.ParseNetworks(os.Getenv(name))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return networks
+}
+
+// durationEnv parses an optional duration environment variable such as "30s", exiting on bad input
+func durationEnv(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid %s: %q", name, v)
+	}
+	return d
+}
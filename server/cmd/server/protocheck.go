@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"squash-ladder/server"
+)
+
+// runProtoCheck implements "server proto-check", the gate a deploy runs to catch
+// proto changes that would break the clients already out there
+func runProtoCheck(args []string) {
+	fs := flag.NewFlagSet("proto-check", flag.ExitOnError)
+	addr := fs.String("addr", "", "gRPC address of a running server to check, which needs LADDER_GRPC_REFLECTION; empty checks this binary")
+	useTLS := fs.Bool("tls", false, "connect to -addr with TLS")
+	baseline := fs.String("baseline", "", "FileDescriptorSet or buf image to check against; empty uses the one built in")
+	write := fs.String("write", "", "write the checked descriptors to this file as the new baseline, instead of checking")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n"+
+			"  %[1]s proto-check [--addr <host:port>] [--baseline <file>]\n"+
+			"  %[1]s proto-check --write <file>\n\n"+
+			"Lints the API's protos and checks them for changes that break clients\n"+
+			"built against the baseline, such as a deleted field or a changed type.\n"+
+			"Problems are named by buf's rules, and the exit status is 1 if any are found.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	current := server.ProtoDescriptors()
+	if *addr != "" {
+		creds := insecure.NewCredentials()
+		if *useTLS {
+			creds = credentials.NewTLS(&tls.Config{})
+		}
+		conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %v", *addr, err)
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if current, err = server.FetchProtoDescriptors(ctx, conn); err != nil {
+			log.Fatalf("Failed to read the descriptors of %s: %v", *addr, err)
+		}
+	}
+
+	if *write != "" {
+		data, err := server.MarshalProtoDescriptors(current)
+		if err != nil {
+			log.Fatalf("Failed to encode the descriptors: %v", err)
+		}
+		if err := os.WriteFile(*write, data, 0o644); err != nil {
+			log.Fatalf("Failed to write the baseline: %v", err)
+		}
+		fmt.Printf("Wrote %d files to %s\n", len(current.File), *write)
+		return
+	}
+
+	var against *descriptorpb.FileDescriptorSet
+	var err error
+	if *baseline == "" {
+		against, err = server.ProtoBaseline()
+	} else {
+		var data []byte
+		if data, err = os.ReadFile(*baseline); err == nil {
+			against, err = server.ParseProtoDescriptors(data)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to read the baseline: %v", err)
+	}
+
+	lint, err := server.LintProtos(current)
+	if err != nil {
+		log.Fatalf("Failed to lint: %v", err)
+	}
+	breaking, err := server.CheckProtoBreaking(against, current)
+	if err != nil {
+		log.Fatalf("Failed to check for breaking changes: %v", err)
+	}
+	for _, p := range append(lint, breaking...) {
+		fmt.Println(p)
+	}
+	if len(lint)+len(breaking) > 0 {
+		fmt.Printf("%d lint problems, %d breaking changes\n", len(lint), len(breaking))
+		os.Exit(1)
+	}
+	fmt.Println("OK: no lint problems or breaking changes")
+}
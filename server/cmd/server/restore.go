@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"squash-ladder/server"
+)
+
+// runRestore implements "server restore", which either rolls the log back to a
+// transaction or replaces it with a backup while the server is stopped
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dataPath := fs.String("data", envOr("LADDER_DATA_FILE", "data/transaction_log.jsonl"), "path of the transaction log (env LADDER_DATA_FILE)")
+	toTx := fs.String("to-tx", "", "ID of the last transaction to keep")
+	fromBackup := fs.String("from-backup", "", `name of a backup to restore, or "latest"`)
+	listBackups := fs.Bool("list-backups", false, "list the available backups")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n"+
+			"  %[1]s restore --to-tx <id> [--data <path>]\n"+
+			"  %[1]s restore --from-backup <name|latest> [--data <path>]\n"+
+			"  %[1]s restore --list-backups\n\n"+
+			"--to-tx drops every transaction after <id>, keeping a backup of the log.\n"+
+			"--from-backup replaces the log with a backup from LADDER_BACKUP_DIR or the\n"+
+			"LADDER_BACKUP_S3_* bucket, keeping the current log next to it.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	modes := 0
+	for _, set := range []bool{*toTx != "", *fromBackup != "", *listBackups} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	switch {
+	case *listBackups:
+		target := backupTarget()
+		names, err := server.ListBackups(context.Background(), target)
+		if err != nil {
+			log.Fatalf("Failed to list backups: %v", err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case *fromBackup != "":
+		target := backupTarget()
+		name, err := server.RestoreBackup(context.Background(), target, *fromBackup, *dataPath)
+		if err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		fmt.Printf("Restored %s to %s\n", name, *dataPath)
+	default:
+		restoreToTransaction(*dataPath, *toTx)
+	}
+}
+
+func backupTarget() server.BackupTarget {
+	target, err := backupConfigFromEnv().Target()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return target
+}
+
+func restoreToTransaction(dataPath, txID string) {
+	m, err := server.NewModel(dataPath)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", dataPath, err)
+	}
+	defer m.Close()
+	if err := m.SetEncryptionKey(logKeyFromEnv()); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	result, err := m.RestoreToTransaction(context.Background(), txID)
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	if result.Removed == 0 {
+		fmt.Printf("%s is already the latest transaction; nothing to do\n", txID)
+		return
+	}
+	fmt.Printf("Removed %d transactions; the previous log was saved to %s\n", result.Removed, result.BackupPath)
+}
@@ -0,0 +1,24 @@
+//go:build js && wasm
+
+// Command wasm exposes the ladder engine to the web client as the global
+// squashLadder object. Build it with scripts/build_wasm.sh.
+package main
+
+import (
+	"syscall/js"
+
+	"squash-ladder/server/engine"
+)
+
+func main() {
+	js.Global().Set("squashLadder", js.ValueOf(map[string]interface{}{
+		"validateScore": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return engine.ValidateScore(args[0].String())
+		}),
+		"previewMatch": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return engine.PreviewMatch(args[0].String())
+		}),
+	}))
+	// Keep the functions alive for the life of the page
+	select {}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Cache-Control policies for plain HTTP endpoints
+const (
+	// Standings change only when a result is entered, so pollers can share a short-lived copy
+	cacheStandings = "public, max-age=10"
+	// Exports are generated on demand and may be large
+	cacheExports = "private, max-age=60"
+)
+
+// compressibleTypes are content types worth compressing; images and PDFs are
+// already compressed
+var compressibleTypes = []string{"text/", "application/json", "application/javascript", "image/svg+xml"}
+
+// compressed wraps h to gzip or deflate its response when the client accepts it,
+// and to send cacheControl unless h sets its own Cache-Control header
+func compressed(cacheControl string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: negotiateEncoding(r.Header.Get("Accept-Encoding"))}
+		defer cw.Close()
+		h(cw, r)
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, preferring
+// gzip, or returns "" when neither is acceptable
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[name] = q > 0
+	}
+	for _, enc := range []string{"gzip", "deflate"} {
+		if accepted[enc] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compressWriter decides on compression when the response header is written
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string // Negotiated encoding, "" for none
+	enc         io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	h := c.Header()
+	if c.encoding != "" && code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		if c.encoding == "gzip" {
+			c.enc = gzip.NewWriter(c.ResponseWriter)
+		} else {
+			c.enc, _ = flate.NewWriter(c.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Close flushes any compressed data that is still buffered
+func (c *compressWriter) Close() error {
+	if c.enc != nil {
+		return c.enc.Close()
+	}
+	return nil
+}
+
+func isCompressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
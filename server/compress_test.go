@@ -0,0 +1,80 @@
+package server
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressed(t *testing.T) {
+	body := strings.Repeat(`{"id":"alice","name":"Alice","rank":1},`, 300)
+	handler := compressed(cacheStandings, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	})
+
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"gzip, deflate, br", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0.5", "deflate"},
+		{"br", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/players", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%q: expected encoding %q, got %q", tt.acceptEncoding, tt.want, got)
+			continue
+		}
+		if rec.Header().Get("Cache-Control") != cacheStandings || rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%q: missing caching headers: %v", tt.acceptEncoding, rec.Header())
+		}
+
+		var r io.Reader = rec.Body
+		switch tt.want {
+		case "gzip":
+			gz, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("invalid gzip body: %v", err)
+			}
+			r = gz
+		case "deflate":
+			r = flate.NewReader(rec.Body)
+		}
+		if tt.want != "" && rec.Body.Len() >= len(body)/4 {
+			t.Errorf("%q: body was not compressed: %d bytes", tt.acceptEncoding, rec.Body.Len())
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || string(got) != body {
+			t.Errorf("%q: body did not round-trip: %v", tt.acceptEncoding, err)
+		}
+	}
+
+	// Images pass through, and a handler's own Cache-Control wins
+	png := compressed(cacheExports, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("\x89PNG"))
+	})
+	req := httptest.NewRequest("GET", "/api/result-links/qr.png", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	png(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "\x89PNG" {
+		t.Errorf("expected the image to be sent uncompressed, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected the handler's Cache-Control, got %q", rec.Header().Get("Cache-Control"))
+	}
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+const (
+	consolePath         = "/admin"
+	consoleRecentLimit  = 20
+	consoleLogPageLimit = 50
+)
+
+var consoleTemplate = template.Must(template.New("console").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Squash Ladder admin</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; max-width: 60em; }
+  h2 { margin-top: 2em; border-bottom: 1px solid #ccc; }
+  table { border-collapse: collapse; width: 100%; }
+  td, th { padding: 0.3em 0.6em; border-bottom: 1px solid #eee; text-align: left; vertical-align: top; }
+  input[type=number] { width: 4em; }
+  .message { background: #e6f4e6; padding: 0.6em; }
+  .error { background: #fbe3e3; padding: 0.6em; }
+  .invalidated { color: #999; text-decoration: line-through; }
+  .note { color: #666; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Squash Ladder admin{{if .Club}} – {{.Club}}{{end}}</h1>
+{{if .Message}}<p class="message">{{.Message}}</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+
+<h2>Standings</h2>
+{{if .Players}}<form method="post" action="{{.ReorderURL}}">
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<table>
+<tr><th>New position</th><th>Rank</th><th>Player</th></tr>
+{{range .Players}}<tr><td><input type="number" min="1" name="pos_{{.Id}}" value="{{.Rank}}"></td><td>{{.Rank}}</td><td>{{.Name}}{{if .Provisional}} (provisional){{end}}</td></tr>
+{{end}}</table>
+<p class="note">Give players new positions and save; ties keep their current order. Saving places provisional players too.</p>
+<button type="submit">Save order</button>
+</form>{{else}}<p>The ladder is empty.</p>{{end}}
+
+<h2>Recent matches</h2>
+{{if .Matches}}<table>
+{{range .Matches}}<tr><td>{{.When}}</td><td>{{.Text}}</td><td>
+<form method="post" action="{{$.InvalidateURL}}" onsubmit="return confirm('Invalidate this match and replay the ladder without it?')">
+<input type="hidden" name="csrf" value="{{$.CSRF}}">
+<input type="hidden" name="transaction_id" value="{{.ID}}">
+<button type="submit">Invalidate</button>
+</form></td></tr>
+{{end}}</table>{{else}}<p>No matches recorded yet.</p>{{end}}
+
+<h2>Audit log</h2>
+{{if .Log}}<table>
+<tr><th>When</th><th>Type</th><th>What</th><th>By</th></tr>
+{{range .Log}}<tr{{if .InvalidatedBy}} class="invalidated" title="Invalidated by {{.InvalidatedBy}}"{{end}}><td>{{.When}}</td><td>{{.Type}}</td><td>{{.Summary}}</td><td>{{.Client}}</td></tr>
+{{end}}</table>
+{{if .OlderURL}}<p><a href="{{.OlderURL}}">Older entries</a></p>{{end}}{{else}}<p>The log is empty.</p>{{end}}
+</body>
+</html>
+`))
+
+// consoleMatch is a row of the console's recent matches
+type consoleMatch struct {
+	ID   string
+	When string
+	Text string
+}
+
+// consoleLogEntry is a row of the console's audit log
+type consoleLogEntry struct {
+	When          string
+	Type          string
+	Summary       string
+	InvalidatedBy string
+	Client        string
+}
+
+// AdminConsole serves a small server-rendered admin page at /admin, for committee
+// members who won't use grpcurl or the web client: it invalidates matches, reorders
+// players and shows the audit log. The browser signs in with HTTP basic auth, using
+// any user name and the admin token as the password.
+type AdminConsole struct {
+	service *LadderService
+	clubs   *ClubRegistry
+	domain  string
+	token   string
+	keys    *APIKeys // Admin API keys sign in too when set
+}
+
+// NewAdminConsole creates the console. It refuses every request when token is empty.
+func NewAdminConsole(service *LadderService, clubs *ClubRegistry, domain, token string) *AdminConsole {
+	return &AdminConsole{service: service, clubs: clubs, domain: domain, token: token}
+}
+
+// isConsolePath reports whether path belongs to the admin console
+func isConsolePath(path string) bool {
+	return path == consolePath || strings.HasPrefix(path, consolePath+"/")
+}
+
+// ServeHTTP routes GET /admin, POST /admin/invalidate and POST /admin/reorder. The
+// club is chosen as for the kiosk, by host or ?club=.
+func (a *AdminConsole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.token == "" {
+		http.Error(w, "the admin console is disabled: no admin token configured", http.StatusForbidden)
+		return
+	}
+	principal := a.principal(r)
+	if principal == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Squash Ladder admin", charset="UTF-8"`)
+		http.Error(w, "admin token required", http.StatusUnauthorized)
+		return
+	}
+	ctx, err := clubHTTPContext(r, a.clubs, a.domain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ctx = a.service.clientContext(ctx, clientConsole, principal, remoteHost(r))
+	r = r.WithContext(AsAdmin(ctx))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+
+	switch {
+	case r.URL.Path == consolePath && r.Method == "GET":
+		a.render(w, r)
+	case r.URL.Path == consolePath+"/invalidate" && r.Method == "POST":
+		a.invalidate(w, r)
+	case r.URL.Path == consolePath+"/reorder" && r.Method == "POST":
+		a.reorder(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// principal accepts the admin token or an admin API key, as a basic auth password
+// or a bearer token, and names the caller for the audit log. It returns "" for
+// anyone else.
+func (a *AdminConsole) principal(r *http.Request) string {
+	credential, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, basic := r.BasicAuth(); basic {
+		credential, ok = password, true
+	}
+	if !ok {
+		return ""
+	}
+	if subtle.ConstantTimeCompare([]byte(credential), []byte(a.token)) == 1 {
+		return "admin"
+	}
+	if id, role := a.keys.identify(credential); role == ladderpb.ApiKeyRole_API_KEY_ROLE_ADMIN {
+		return "api-key:" + id
+	}
+	return ""
+}
+
+// csrfToken is sent with every form. Browsers resend basic auth credentials to any
+// page that posts to the console, so the credentials alone do not show that the
+// console sent the form.
+func (a *AdminConsole) csrfToken() string {
+	mac := hmac.New(sha256.New, []byte(a.token))
+	mac.Write([]byte("admin console form"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkForm parses a posted form and checks its CSRF token
+func (a *AdminConsole) checkForm(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("invalid form: %v", err)
+	}
+	if !hmac.Equal([]byte(r.PostForm.Get("csrf")), []byte(a.csrfToken())) {
+		return fmt.Errorf("the form has expired; reload the page and try again")
+	}
+	return nil
+}
+
+// url returns the console URL for path with the request's club and extra query
+// parameters, empty ones left out
+func (a *AdminConsole) url(r *http.Request, path string, params ...string) string {
+	q := url.Values{}
+	if club := r.URL.Query().Get("club"); club != "" {
+		q.Set("club", club)
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			q.Set(params[i], params[i+1])
+		}
+	}
+	if len(q) == 0 {
+		return path
+	}
+	return path + "?" + q.Encode()
+}
+
+// done redirects back to the page with the outcome of a form, so reloading the page
+// does not post the form again
+func (a *AdminConsole) done(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if err != nil {
+		http.Redirect(w, r, a.url(r, consolePath, "error", err.Error()), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, a.url(r, consolePath, "message", message), http.StatusSeeOther)
+}
+
+func (a *AdminConsole) render(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	loc := a.service.modelFor(ctx).TimeZone()
+	when := func(ms int64) string { return time.UnixMilli(ms).In(loc).Format("2006-01-02 15:04") }
+
+	players, err := a.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recent, err := a.service.ListRecentMatches(ctx, &ladderpb.ListRecentMatchesRequest{Limit: consoleRecentLimit})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cursor := r.URL.Query().Get("cursor")
+	txs, err := a.service.ListTransactions(ctx, &ladderpb.ListTransactionsRequest{Limit: consoleLogPageLimit, Cursor: cursor})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names := make(map[string]string)
+	for _, p := range players.Players {
+		names[p.Id] = p.Name
+	}
+	matches := make([]consoleMatch, len(recent.Results))
+	for i, mr := range recent.Results {
+		matches[i] = consoleMatch{ID: mr.TransactionId, When: when(mr.PlayedAtMs), Text: describeMatch(mr, names)}
+	}
+	entries := make([]consoleLogEntry, len(txs.Transactions))
+	for i, t := range txs.Transactions {
+		entries[i] = consoleLogEntry{When: when(t.TimestampMs), Type: t.Type, Summary: t.Summary, InvalidatedBy: t.InvalidatedBy, Client: describeClient(t)}
+	}
+	older := ""
+	if txs.NextCursor != "" {
+		older = a.url(r, consolePath, "cursor", txs.NextCursor)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = consoleTemplate.Execute(w, struct {
+		Club          string
+		Message       string
+		Error         string
+		CSRF          string
+		ReorderURL    string
+		InvalidateURL string
+		Players       []*ladderpb.Player
+		Matches       []consoleMatch
+		Log           []consoleLogEntry
+		OlderURL      string
+	}{
+		Club:          r.URL.Query().Get("club"),
+		Message:       r.URL.Query().Get("message"),
+		Error:         r.URL.Query().Get("error"),
+		CSRF:          a.csrfToken(),
+		ReorderURL:    a.url(r, consolePath+"/reorder"),
+		InvalidateURL: a.url(r, consolePath+"/invalidate"),
+		Players:       players.Players,
+		Matches:       matches,
+		Log:           entries,
+		OlderURL:      older,
+	})
+	if err != nil {
+		log.Printf("failed to render admin console: %v", err)
+	}
+}
+
+func (a *AdminConsole) invalidate(w http.ResponseWriter, r *http.Request) {
+	if err := a.checkForm(r); err != nil {
+		a.done(w, r, "", err)
+		return
+	}
+	txID := r.PostForm.Get("transaction_id")
+	_, err := a.service.InvalidateMatchResult(r.Context(), &ladderpb.InvalidateMatchResultRequest{TransactionId: txID})
+	if err != nil {
+		a.done(w, r, "", err)
+		return
+	}
+	log.Printf("Admin console: invalidated match %s", txID)
+	a.done(w, r, "Invalidated match "+txID, nil)
+}
+
+func (a *AdminConsole) reorder(w http.ResponseWriter, r *http.Request) {
+	if err := a.checkForm(r); err != nil {
+		a.done(w, r, "", err)
+		return
+	}
+	model := a.service.modelFor(r.Context())
+	players := model.ListPlayers()
+
+	positions := make(map[string]int, len(players))
+	for _, p := range players {
+		pos, err := strconv.Atoi(strings.TrimSpace(r.PostForm.Get("pos_" + p.Id)))
+		if err != nil || pos < 1 {
+			a.done(w, r, "", fmt.Errorf("give %s a position of 1 or more; the ladder may have changed, so reload the page", p.Name))
+			return
+		}
+		positions[p.Id] = pos
+	}
+	order := make([]string, len(players))
+	for i, p := range players {
+		order[i] = p.Id
+	}
+	sort.SliceStable(order, func(i, j int) bool { return positions[order[i]] < positions[order[j]] })
+
+	changed := false
+	for i, p := range players {
+		changed = changed || order[i] != p.Id || p.Provisional
+	}
+	if !changed {
+		a.done(w, r, "The order is unchanged", nil)
+		return
+	}
+	txID, _, err := model.Reorder(order, "admin console")
+	if err != nil {
+		a.done(w, r, "", err)
+		return
+	}
+	log.Printf("Admin console: reordered the ladder in %s", txID)
+	a.done(w, r, "Saved the new order", nil)
+}
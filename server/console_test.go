@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAdminConsole(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("<Bob>", "bob")
+	m.AddPlayer("Carol", "carol")
+	txID, err := m.AddMatchResult("bob", "alice", "bob", threeLove)
+	if err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+
+	c := NewAdminConsole(NewLadderService(m), nil, "", "secret")
+	serve := func(method, target string, form url.Values, password string) *httptest.ResponseRecorder {
+		var req *http.Request
+		if form != nil {
+			req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(method, target, nil)
+		}
+		if password != "" {
+			req.SetBasicAuth("committee", password)
+		}
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("GET", "/admin", nil, ""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected a basic auth challenge, got %d", rec.Code)
+	}
+	if rec := serve("GET", "/admin", nil, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password, got %d", rec.Code)
+	}
+
+	rec := serve("GET", "/admin", nil, "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`name="pos_alice"`, "&lt;Bob&gt; beat Alice", `value="` + txID + `"`, "ADD_PLAYER"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page missing %q", want)
+		}
+	}
+	if strings.Contains(body, "<Bob>") {
+		t.Error("player names must be escaped")
+	}
+
+	// Forms without the page's CSRF token are refused
+	rec = serve("POST", "/admin/invalidate", url.Values{"transaction_id": {txID}}, "secret")
+	if rec.Code != http.StatusSeeOther || !strings.Contains(rec.Header().Get("Location"), "error=") {
+		t.Errorf("expected a redirect with an error, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	assertOrder(t, m, "bob", "alice", "carol")
+
+	csrf := c.csrfToken()
+	rec = serve("POST", "/admin/invalidate", url.Values{"csrf": {csrf}, "transaction_id": {txID}}, "secret")
+	if rec.Code != http.StatusSeeOther || !strings.Contains(rec.Header().Get("Location"), "message=") {
+		t.Errorf("expected a redirect with a message, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	assertOrder(t, m, "alice", "bob", "carol")
+
+	rec = serve("POST", "/admin/reorder", url.Values{"csrf": {csrf}, "pos_alice": {"3"}, "pos_bob": {"1"}, "pos_carol": {"1"}}, "secret")
+	if rec.Code != http.StatusSeeOther || !strings.Contains(rec.Header().Get("Location"), "message=") {
+		t.Errorf("expected a redirect with a message, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	assertOrder(t, m, "bob", "carol", "alice")
+
+	// A player missing from the form means the page is out of date
+	rec = serve("POST", "/admin/reorder", url.Values{"csrf": {csrf}, "pos_alice": {"1"}, "pos_bob": {"2"}}, "secret")
+	if !strings.Contains(rec.Header().Get("Location"), "error=") {
+		t.Errorf("expected an error for a missing position, got %s", rec.Header().Get("Location"))
+	}
+	assertOrder(t, m, "bob", "carol", "alice")
+
+	disabled := NewAdminConsole(NewLadderService(m), nil, "", "")
+	rec = httptest.NewRecorder()
+	disabled.ServeHTTP(rec, httptest.NewRequest("GET", "/admin", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without an admin token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+const (
+	defaultTrendDays      = 30
+	dashboardRecentLimit  = 5
+	dashboardSuggestLimit = 3
+)
+
+// Dashboard gathers a player's home screen: their place, rating, rank trend over the
+// last trendDays, recent matches and who they might play next
+func (m *Model) Dashboard(playerID string, trendDays int, now time.Time) (*ladderpb.GetMyDashboardResponse, error) {
+	if trendDays <= 0 {
+		trendDays = defaultTrendDays
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	var current []*ladderpb.Player
+	if len(txs) > 0 {
+		current = storageToLadder(txs[len(txs)-1].PlayerList)
+	}
+	me := findPlayer(current, playerID)
+	if me == nil {
+		return nil, fmt.Errorf("player %s is not on the ladder", playerID)
+	}
+
+	ratings := computeRatings(txs)
+	dash := &ladderpb.GetMyDashboardResponse{
+		Player:             me,
+		Rating:             ratings.rating(playerID),
+		RankTrend:          []*ladderpb.RankPoint{},
+		RecentMatches:      []*ladderpb.MatchResult{},
+		SuggestedOpponents: []*ladderpb.SuggestedOpponent{},
+	}
+
+	// Rank at the start of the period, then every change since
+	since := now.AddDate(0, 0, -trendDays).UnixMilli()
+	var rank int32
+	var start *ladderpb.RankPoint
+	for _, t := range txs {
+		r := rankIn(t.PlayerList, playerID)
+		if r == rank {
+			continue
+		}
+		rank = r
+		point := &ladderpb.RankPoint{TransactionId: t.Id, TimestampMs: t.TimestampMs, Rank: r}
+		if t.TimestampMs < since {
+			start = point
+		} else {
+			dash.RankTrend = append(dash.RankTrend, point)
+		}
+	}
+	if start != nil {
+		dash.RankTrend = append([]*ladderpb.RankPoint{start}, dash.RankTrend...)
+	}
+	if len(dash.RankTrend) > 0 && dash.RankTrend[0].Rank > 0 {
+		dash.RankChange = dash.RankTrend[0].Rank - me.Rank
+	}
+
+	// Valid matches, for recent results and when each opponent was last played
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+	lastPlayed := make(map[string]int64)
+	for i := len(txs) - 1; i >= 0; i-- {
+		t := txs[i]
+		mr := t.GetMatchResultPayload()
+		if mr == nil || invalidated[t.Id] || (mr.ChallengerId != playerID && mr.DefenderId != playerID) {
+			continue
+		}
+		opponent := mr.ChallengerId
+		if opponent == playerID {
+			opponent = mr.DefenderId
+		}
+		if _, ok := lastPlayed[opponent]; !ok {
+			lastPlayed[opponent] = t.TimestampMs
+		}
+		if len(dash.RecentMatches) < dashboardRecentLimit {
+			result := matchResultFromStorage(t)
+			ratings.annotate(result)
+			dash.RecentMatches = append(dash.RecentMatches, result)
+		}
+	}
+
+	// Players on holiday can't be challenged
+	var available []*ladderpb.Player
+	for _, p := range current {
+		if !protectedAt(p, now) {
+			available = append(available, p)
+		}
+	}
+	dash.SuggestedOpponents = suggestOpponents(available, me, rulesAt(txs, len(txs)).ChallengeWindow, lastPlayed)
+	return dash, nil
+}
+
+// rankIn returns a player's rank in a snapshot, or 0 if they are not on it
+func rankIn(players []*storagepb.PlayerStorage, playerID string) int32 {
+	for _, p := range players {
+		if p.Id == playerID {
+			return p.Rank
+		}
+	}
+	return 0
+}
+
+// suggestOpponents proposes the players within the challenge window above me, or
+// below for the top player, preferring those played least recently
+func suggestOpponents(players []*ladderpb.Player, me *ladderpb.Player, window int32, lastPlayed map[string]int64) []*ladderpb.SuggestedOpponent {
+	if window <= 0 {
+		window = DefaultLadderRules().ChallengeWindow
+	}
+	var suggestions []*ladderpb.SuggestedOpponent
+	for _, p := range players {
+		gap := me.Rank - p.Rank
+		var reason string
+		switch {
+		case me.Rank == 1 && -gap >= 1 && -gap <= window:
+			reason = fmt.Sprintf("can challenge you from %d places below", -gap)
+		case me.Rank > 1 && gap >= 1 && gap <= window:
+			reason = fmt.Sprintf("%d places above you", gap)
+			if gap == 1 {
+				reason = "1 place above you"
+			}
+		default:
+			continue
+		}
+		suggestions = append(suggestions, &ladderpb.SuggestedOpponent{Player: p, LastPlayedMs: lastPlayed[p.Id], Reason: reason})
+	}
+	// Never played first, then longest ago, then closest in rank
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.LastPlayedMs != b.LastPlayedMs {
+			return a.LastPlayedMs < b.LastPlayedMs
+		}
+		return abs32(a.Player.Rank-me.Rank) < abs32(b.Player.Rank-me.Rank)
+	})
+	if len(suggestions) > dashboardSuggestLimit {
+		suggestions = suggestions[:dashboardSuggestLimit]
+	}
+	if suggestions == nil {
+		suggestions = []*ladderpb.SuggestedOpponent{}
+	}
+	return suggestions
+}
+
+func abs32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// GetMyDashboard returns the calling player's home screen
+func (h *LadderService) GetMyDashboard(ctx context.Context, req *ladderpb.GetMyDashboardRequest) (*ladderpb.GetMyDashboardResponse, error) {
+	m, playerID, err := h.currentPlayer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.Dashboard(playerID, int(req.TrendDays), m.now())
+}
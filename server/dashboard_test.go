@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetMyDashboard(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	for _, id := range []string{"alice", "bob", "charlie", "dave", "erin"} {
+		m.AddPlayer(id, id)
+	}
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	m.AddMatchResult("erin", "dave", "erin", sets)    // erin 4th
+	m.AddMatchResult("erin", "charlie", "erin", sets) // erin 3rd
+	m.AddMatchResult("alice", "erin", "alice", sets)
+
+	svc := NewLadderService(m)
+	svc.playerAuth = NewPlayerAuth("secret", nil)
+	call := func(ctx context.Context) (*ladderpb.GetMyDashboardResponse, error) {
+		resp, err := playerUnaryInterceptor(svc.playerAuth)(ctx, &ladderpb.GetMyDashboardRequest{}, &grpc.UnaryServerInfo{},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return svc.GetMyDashboard(ctx, req.(*ladderpb.GetMyDashboardRequest))
+			})
+		if err != nil {
+			return nil, err
+		}
+		return resp.(*ladderpb.GetMyDashboardResponse), nil
+	}
+
+	if _, err := call(context.Background()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a token, got %v", err)
+	}
+	forged := metadata.NewIncomingContext(context.Background(), metadata.Pairs(playerTokenHeader, NewPlayerAuth("other", nil).Sign(playerClaims{PlayerID: "erin", ExpiresMs: time.Now().Add(time.Hour).UnixMilli()})))
+	if _, err := call(forged); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated for a forged token, got %v", err)
+	}
+
+	issued, err := svc.IssuePlayerToken(context.Background(), &ladderpb.IssuePlayerTokenRequest{PlayerId: "erin"})
+	if err != nil {
+		t.Fatalf("IssuePlayerToken failed: %v", err)
+	}
+	dash, err := call(metadata.NewIncomingContext(context.Background(), metadata.Pairs(playerTokenHeader, issued.Token)))
+	if err != nil {
+		t.Fatalf("GetMyDashboard failed: %v", err)
+	}
+
+	if dash.Player.Id != "erin" || dash.Player.Rank != 3 {
+		t.Errorf("unexpected player %v", dash.Player)
+	}
+	// Joined 5th, climbed to 4th and 3rd; the loss to alice did not move her
+	ranks := []int32{}
+	for _, p := range dash.RankTrend {
+		ranks = append(ranks, p.Rank)
+	}
+	if len(ranks) != 3 || ranks[0] != 5 || ranks[2] != 3 || dash.RankChange != 2 {
+		t.Errorf("unexpected trend %v, change %d", ranks, dash.RankChange)
+	}
+	if len(dash.RecentMatches) != 3 || dash.RecentMatches[0].ChallengerId != "alice" {
+		t.Errorf("expected 3 recent matches newest first, got %v", dash.RecentMatches)
+	}
+	// bob has never played erin, so comes before alice who just did
+	if len(dash.SuggestedOpponents) != 2 || dash.SuggestedOpponents[0].Player.Id != "bob" || dash.SuggestedOpponents[1].LastPlayedMs == 0 {
+		t.Errorf("unexpected suggestions %v", dash.SuggestedOpponents)
+	}
+
+	if _, err := svc.IssuePlayerToken(context.Background(), &ladderpb.IssuePlayerTokenRequest{PlayerId: "nobody"}); err == nil {
+		t.Error("expected an error issuing a token for an unknown player")
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// DiffLadder compares the ladder at two points of its history and reports the players
+// who moved, joined or left in between. The stored snapshots are used, so the state at
+// a point reflects only the invalidations recorded before it.
+func (m *Model) DiffLadder(ctx context.Context, from, to *ladderpb.LadderPoint) (*ladderpb.DiffLadderResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fromIdx, err := resolveLadderPoint(txs, from, -1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from point: %v", err)
+	}
+	toIdx, err := resolveLadderPoint(txs, to, len(txs)-1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to point: %v", err)
+	}
+	if fromIdx > toIdx {
+		return nil, fmt.Errorf("from point is after to point")
+	}
+
+	return diffSnapshots(txs, fromIdx, toIdx), nil
+}
+
+// diffSnapshots compares the snapshots after txs[fromIdx] and txs[toIdx], where -1
+// stands for the empty ladder before the log
+func diffSnapshots(txs []*storagepb.TransactionStorage, fromIdx, toIdx int) *ladderpb.DiffLadderResponse {
+	before, after := []*ladderpb.Player{}, []*ladderpb.Player{}
+	if fromIdx >= 0 {
+		before = storageToLadder(txs[fromIdx].PlayerList)
+	}
+	if toIdx >= 0 {
+		after = storageToLadder(txs[toIdx].PlayerList)
+	}
+	resp := diffPlayers(before, after)
+	if fromIdx >= 0 {
+		resp.FromTransactionId = txs[fromIdx].Id
+	}
+	if toIdx >= 0 {
+		resp.ToTransactionId = txs[toIdx].Id
+	}
+	return resp
+}
+
+// diffPlayers reports the players who moved, joined or left between two ladders
+func diffPlayers(before, after []*ladderpb.Player) *ladderpb.DiffLadderResponse {
+	resp := &ladderpb.DiffLadderResponse{}
+	previous := make(map[string]*ladderpb.Player, len(before))
+	for _, p := range before {
+		previous[p.Id] = p
+	}
+	current := make(map[string]bool, len(after))
+	for _, p := range after {
+		current[p.Id] = true
+		old, ok := previous[p.Id]
+		switch {
+		case !ok:
+			resp.Joined = append(resp.Joined, p)
+		case old.Rank != p.Rank:
+			resp.Moved = append(resp.Moved, &ladderpb.PlayerMovement{
+				PlayerId: p.Id,
+				Name:     p.Name,
+				FromRank: old.Rank,
+				ToRank:   p.Rank,
+			})
+		}
+	}
+	for _, p := range before {
+		if !current[p.Id] {
+			resp.Left = append(resp.Left, p)
+		}
+	}
+	sort.Slice(resp.Moved, func(i, j int) bool { return resp.Moved[i].ToRank < resp.Moved[j].ToRank })
+
+	return resp
+}
+
+// movementSteps returns the fewest single-player moves that turn the before ladder
+// into the after one, in the order to apply them. Ranks are those at the time of each
+// step; players who keep their order relative to each other stay put and shift.
+func movementSteps(before, after []*ladderpb.Player) []*ladderpb.PlayerMovement {
+	position := make(map[string]int, len(before))
+	for i, p := range before {
+		position[p.Id] = i
+	}
+	inAfter := make(map[string]bool, len(after))
+	for _, p := range after {
+		inAfter[p.Id] = true
+	}
+
+	// Players on both ladders whose order is a longest increasing run of old positions
+	// stay put; everyone else is moved
+	var stay []int // Index in after of the last player of the best run of each length
+	prev := make([]int, len(after))
+	for i, p := range after {
+		prev[i] = -1
+		old, ok := position[p.Id]
+		if !ok {
+			continue
+		}
+		n := sort.Search(len(stay), func(k int) bool { return position[after[stay[k]].Id] >= old })
+		if n > 0 {
+			prev[i] = stay[n-1]
+		}
+		if n == len(stay) {
+			stay = append(stay, i)
+		} else {
+			stay[n] = i
+		}
+	}
+	stays := make(map[string]bool)
+	if len(stay) > 0 {
+		for i := stay[len(stay)-1]; i != -1; i = prev[i] {
+			stays[after[i].Id] = true
+		}
+	}
+
+	var steps []*ladderpb.PlayerMovement
+	current := make([]*ladderpb.Player, 0, len(before))
+	for _, p := range before {
+		if inAfter[p.Id] {
+			current = append(current, p)
+			continue
+		}
+		// Those above have either stayed in current or already left
+		steps = append(steps, &ladderpb.PlayerMovement{PlayerId: p.Id, Name: p.Name, FromRank: int32(len(current) + 1)})
+	}
+	// Each mover goes in straight after whoever precedes them on the new ladder, which
+	// is either staying or has already been placed
+	for i, p := range after {
+		if stays[p.Id] {
+			continue
+		}
+		step := &ladderpb.PlayerMovement{PlayerId: p.Id, Name: p.Name}
+		for j, q := range current {
+			if q.Id == p.Id {
+				step.FromRank = int32(j + 1)
+				current = append(current[:j], current[j+1:]...)
+				break
+			}
+		}
+		at := 0
+		if i > 0 {
+			for j, q := range current {
+				if q.Id == after[i-1].Id {
+					at = j + 1
+					break
+				}
+			}
+		}
+		current = append(current[:at], append([]*ladderpb.Player{p}, current[at:]...)...)
+		step.ToRank = int32(at + 1)
+		if step.FromRank != step.ToRank {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// resolveLadderPoint returns the index of the last transaction at or before point,
+// -1 if the point precedes the whole log, or def if the point is unset
+func resolveLadderPoint(txs []*storagepb.TransactionStorage, point *ladderpb.LadderPoint, def int) (int, error) {
+	switch p := point.GetPoint().(type) {
+	case *ladderpb.LadderPoint_TransactionId:
+		idx := indexOfTransaction(txs, p.TransactionId)
+		if idx == -1 {
+			return 0, fmt.Errorf("transaction not found: %s", p.TransactionId)
+		}
+		return idx, nil
+	case *ladderpb.LadderPoint_TimestampMs:
+		idx := -1
+		for i, t := range txs {
+			if t.TimestampMs > p.TimestampMs {
+				break
+			}
+			idx = i
+		}
+		return idx, nil
+	default:
+		return def, nil
+	}
+}
+
+// DiffLadder reports ladder changes between two points in time
+func (h *LadderService) DiffLadder(ctx context.Context, req *ladderpb.DiffLadderRequest) (*ladderpb.DiffLadderResponse, error) {
+	return h.modelFor(ctx).DiffLadder(ctx, req.From, req.To)
+}
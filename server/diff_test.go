@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_DiffLadder(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+
+	txs, _, _ := m.ListTransactions(context.Background(), 1, "", nil)
+	start := txs[0].Id
+
+	m.AddMatchResult("charlie", "bob", "charlie", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	m.RemovePlayer("alice")
+	m.AddPlayer("Dave", "dave")
+
+	diff, err := m.DiffLadder(context.Background(), &ladderpb.LadderPoint{Point: &ladderpb.LadderPoint_TransactionId{TransactionId: start}}, nil)
+	if err != nil {
+		t.Fatalf("DiffLadder failed: %v", err)
+	}
+
+	if diff.FromTransactionId != start {
+		t.Errorf("expected from transaction %s, got %s", start, diff.FromTransactionId)
+	}
+	if len(diff.Joined) != 1 || diff.Joined[0].Id != "dave" || diff.Joined[0].Rank != 3 {
+		t.Errorf("expected dave to join at rank 3, got %+v", diff.Joined)
+	}
+	if len(diff.Left) != 1 || diff.Left[0].Id != "alice" || diff.Left[0].Rank != 1 {
+		t.Errorf("expected alice to leave from rank 1, got %+v", diff.Left)
+	}
+	if len(diff.Moved) != 1 || diff.Moved[0].PlayerId != "charlie" || diff.Moved[0].FromRank != 3 || diff.Moved[0].ToRank != 1 {
+		t.Errorf("expected only charlie to move, 3 -> 1, got %+v", diff.Moved)
+	}
+
+	// A time before the first transaction diffs against an empty ladder
+	diff, err = m.DiffLadder(context.Background(), &ladderpb.LadderPoint{Point: &ladderpb.LadderPoint_TimestampMs{TimestampMs: 1}}, nil)
+	if err != nil {
+		t.Fatalf("DiffLadder by time failed: %v", err)
+	}
+	if diff.FromTransactionId != "" || len(diff.Joined) != 3 || len(diff.Moved) != 0 {
+		t.Errorf("expected every current player to have joined, got %+v", diff)
+	}
+
+	if _, err := m.DiffLadder(context.Background(), nil, &ladderpb.LadderPoint{Point: &ladderpb.LadderPoint_TransactionId{TransactionId: "nope"}}); err == nil {
+		t.Error("expected an error for an unknown transaction")
+	}
+}
+
+func TestMovementSteps(t *testing.T) {
+	ladder := func(ids string) []*ladderpb.Player {
+		var players []*ladderpb.Player
+		for i, id := range strings.Split(ids, "") {
+			players = append(players, &ladderpb.Player{Id: id, Name: strings.ToUpper(id), Rank: int32(i + 1)})
+		}
+		return players
+	}
+	// apply plays the steps back on before the way a frontend would
+	apply := func(before []*ladderpb.Player, steps []*ladderpb.PlayerMovement) string {
+		ids := make([]string, len(before))
+		for i, p := range before {
+			ids[i] = p.Id
+		}
+		for _, s := range steps {
+			if s.FromRank > 0 {
+				if ids[s.FromRank-1] != s.PlayerId {
+					t.Fatalf("step %v: rank %d is %s", s, s.FromRank, ids[s.FromRank-1])
+				}
+				ids = append(ids[:s.FromRank-1], ids[s.FromRank:]...)
+			}
+			if s.ToRank > 0 {
+				ids = append(ids[:s.ToRank-1], append([]string{s.PlayerId}, ids[s.ToRank-1:]...)...)
+			}
+		}
+		return strings.Join(ids, "")
+	}
+
+	for _, tc := range []struct {
+		before, after string
+		steps         int
+	}{
+		{"abcde", "abcde", 0},
+		{"abcde", "aebcd", 1}, // A challenger leapfrogging up
+		{"abcde", "bacde", 1}, // A swap
+		{"abcde", "bcdea", 1}, // Dropping to the bottom
+		{"abcde", "acde", 1},  // Leaving
+		{"abcd", "abcde", 1},  // Joining
+		{"abcde", "edcba", 4},
+		{"abcdef", "fbxdac", 5}, // E leaves, X joins and three of the rest move
+		{"", "ab", 2},
+	} {
+		before, after := ladder(tc.before), ladder(tc.after)
+		steps := movementSteps(before, after)
+		if got := apply(before, steps); got != tc.after {
+			t.Errorf("%s to %s: steps %v give %s", tc.before, tc.after, steps, got)
+		}
+		if len(steps) != tc.steps {
+			t.Errorf("%s to %s: expected %d steps, got %v", tc.before, tc.after, tc.steps, steps)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// defaultDigestSchedule sends the weekly digest on Sunday evening (UTC)
+const defaultDigestSchedule = "0 18 * * 0"
+
+// DigestJob sends the players who want it a weekly summary of their rank, matches
+// and who to play next
+type DigestJob struct {
+	notifier *Notifier
+	model    *Model
+	clubs    *ClubRegistry // nil unless multi-club mode is enabled
+	schedule *cronSchedule
+}
+
+// NewDigestJob creates a job sending digests for m and every club at the cron
+// schedule, or on Sunday evening when schedule is empty
+func NewDigestJob(n *Notifier, m *Model, clubs *ClubRegistry, schedule string) (*DigestJob, error) {
+	if schedule == "" {
+		schedule = defaultDigestSchedule
+	}
+	s, err := parseCron(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest schedule: %v", err)
+	}
+	return &DigestJob{notifier: n, model: m, clubs: clubs, schedule: s}, nil
+}
+
+// Start runs the job in the background until stop is closed
+func (j *DigestJob) Start(stop <-chan struct{}) {
+	go func() {
+		for {
+			next := j.schedule.next(time.Now())
+			if next.IsZero() {
+				log.Printf("digest: schedule never fires; weekly digests are disabled")
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				j.RunOnce(time.Now())
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// RunOnce sends the digest for the week up to now and returns how many players it
+// was sent to. Only players with notification settings can want it, so only they
+// are considered.
+func (j *DigestJob) RunOnce(now time.Time) int {
+	ladders := map[string]*Model{"": j.model}
+	if j.clubs != nil {
+		clubs, err := j.clubs.ListClubs()
+		if err != nil {
+			log.Printf("digest: failed to list clubs: %v", err)
+		}
+		for _, c := range clubs {
+			m, err := j.clubs.Model(c.Id)
+			if err != nil {
+				log.Printf("digest: %v", err)
+				continue
+			}
+			ladders[c.Id] = m
+		}
+	}
+
+	ctx := context.Background()
+	sent := 0
+	for clubID, m := range ladders {
+		local := now.In(m.TimeZone())
+		names := make(map[string]string)
+		for _, p := range m.ListPlayers() {
+			names[p.Id] = p.Name
+		}
+		for _, playerID := range j.notifier.store.playersOf(clubID) {
+			if len(j.notifier.store.Channels(clubID, playerID, ladderpb.NotificationEvent_NOTIFY_WEEKLY_DIGEST)) == 0 {
+				continue
+			}
+			dash, err := m.Dashboard(playerID, 7, local)
+			if err != nil {
+				continue // No longer on the ladder
+			}
+			locale := j.notifier.localeOf(clubID, playerID)
+			msg := notification{Title: tr(locale, "Your week on the ladder"), Body: digestText(locale, dash, names, local), Tag: "digest"}
+			j.notifier.notify(ctx, clubID, playerID, ladderpb.NotificationEvent_NOTIFY_WEEKLY_DIGEST, msg)
+			sent++
+		}
+	}
+	return sent
+}
+
+// digestText summarises the week covered by dash in locale, with dates in the zone of now
+func digestText(locale string, dash *ladderpb.GetMyDashboardResponse, names map[string]string, now time.Time) string {
+	var sb strings.Builder
+	rank := dash.Player.Rank
+	switch {
+	case dash.RankChange == 1:
+		sb.WriteString(trf(locale, "You are #%d, up 1 place this week.", rank))
+	case dash.RankChange > 1:
+		sb.WriteString(trf(locale, "You are #%d, up %d places this week.", rank, dash.RankChange))
+	case dash.RankChange == -1:
+		sb.WriteString(trf(locale, "You are #%d, down 1 place this week.", rank))
+	case dash.RankChange < -1:
+		sb.WriteString(trf(locale, "You are #%d, down %d places this week.", rank, -dash.RankChange))
+	default:
+		sb.WriteString(trf(locale, "You are #%d, unchanged this week.", rank))
+	}
+	sb.WriteString("\n")
+
+	since := now.AddDate(0, 0, -7).UnixMilli()
+	var played []string
+	for _, mr := range dash.RecentMatches {
+		if mr.PlayedAtMs >= since {
+			day := time.UnixMilli(mr.PlayedAtMs).In(now.Location()).Format(tr(locale, "2 Jan"))
+			played = append(played, day+": "+describeMatchIn(locale, mr, names))
+		}
+	}
+	if len(played) == 0 {
+		sb.WriteString(tr(locale, "No matches this week.") + "\n")
+	} else {
+		sb.WriteString(tr(locale, "Matches this week:") + "\n")
+		for _, line := range played {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+
+	if len(dash.SuggestedOpponents) > 0 {
+		var next []string
+		for _, o := range dash.SuggestedOpponents {
+			next = append(next, fmt.Sprintf("%s (#%d)", o.Player.Name, o.Player.Rank))
+		}
+		sb.WriteString(trf(locale, "Who to play next: %s", strings.Join(next, ", ")) + "\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,142 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	"squash-ladder/server/servertest"
+)
+
+// End-to-end tests drive the real server over gRPC. They replace the former
+// cmd/verify and cmd/verify_recent binaries.
+
+func TestE2E_MatchMovesLadder(t *testing.T) {
+	s := servertest.Start(t)
+	c := s.Client
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	alice := addPlayer(ctx, t, c, "Alice")
+	bob := addPlayer(ctx, t, c, "Bob")
+	charlie := addPlayer(ctx, t, c, "Charlie")
+	assertLadder(ctx, t, c, "Alice", "Bob", "Charlie")
+
+	// Charlie (#3) beats Alice (#1): Charlie takes #1 and everyone in between drops one place
+	match, err := c.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+		ChallengerId: alice.Id,
+		DefenderId:   charlie.Id,
+		WinnerId:     charlie.Id,
+		SetScores: []*ladderpb.SetScore{
+			{ChallengerPoints: 9, DefenderPoints: 11},
+			{ChallengerPoints: 8, DefenderPoints: 11},
+			{ChallengerPoints: 11, DefenderPoints: 9},
+			{ChallengerPoints: 5, DefenderPoints: 11},
+		},
+	})
+	if err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	assertLadder(ctx, t, c, "Charlie", "Alice", "Bob")
+
+	// Invalidating the match restores the previous order and hides it from recent results
+	if _, err := c.InvalidateMatchResult(ctx, &ladderpb.InvalidateMatchResultRequest{TransactionId: match.TransactionId}); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	assertLadder(ctx, t, c, "Alice", "Bob", "Charlie")
+
+	recent, err := c.ListRecentMatches(ctx, &ladderpb.ListRecentMatchesRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListRecentMatches failed: %v", err)
+	}
+	if len(recent.Results) != 0 {
+		t.Errorf("invalidated match should not be listed, got %d results", len(recent.Results))
+	}
+
+	if _, err := c.RemovePlayer(ctx, &ladderpb.RemovePlayerRequest{PlayerId: bob.Id}); err != nil {
+		t.Fatalf("RemovePlayer failed: %v", err)
+	}
+	assertLadder(ctx, t, c, "Alice", "Charlie")
+}
+
+func TestE2E_RecentMatches(t *testing.T) {
+	s := servertest.Start(t)
+	c := s.Client
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p1 := addPlayer(ctx, t, c, "P1")
+	p2 := addPlayer(ctx, t, c, "P2")
+
+	var txIDs []string
+	for i := 0; i < 5; i++ {
+		resp, err := c.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+			ChallengerId: p1.Id,
+			DefenderId:   p2.Id,
+			WinnerId:     p1.Id,
+			SetScores: []*ladderpb.SetScore{
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{ChallengerPoints: 11, DefenderPoints: 5},
+			},
+		})
+		if err != nil {
+			t.Fatalf("AddMatchResult %d failed: %v", i, err)
+		}
+		txIDs = append(txIDs, resp.TransactionId)
+	}
+
+	resp, err := c.ListRecentMatches(ctx, &ladderpb.ListRecentMatchesRequest{Limit: 3})
+	if err != nil {
+		t.Fatalf("ListRecentMatches failed: %v", err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("expected 3 matches, got %d", len(resp.Results))
+	}
+
+	// Newest first, identified by transaction rather than timestamp so the test needs no sleeps
+	for i, m := range resp.Results {
+		if want := txIDs[len(txIDs)-1-i]; m.TransactionId != want {
+			t.Errorf("result %d: got transaction %s, want %s", i, m.TransactionId, want)
+		}
+		if m.TimestampMs == 0 {
+			t.Errorf("result %d: timestamp should not be 0", i)
+		}
+		if i > 0 && m.TimestampMs > resp.Results[i-1].TimestampMs {
+			t.Errorf("result %d is newer than result %d", i, i-1)
+		}
+	}
+}
+
+func addPlayer(ctx context.Context, t *testing.T, c ladderpb.LadderServiceClient, name string) *ladderpb.Player {
+	t.Helper()
+	resp, err := c.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: name})
+	if err != nil {
+		t.Fatalf("AddPlayer(%s) failed: %v", name, err)
+	}
+	return resp.Player
+}
+
+func assertLadder(ctx context.Context, t *testing.T, c ladderpb.LadderServiceClient, names ...string) {
+	t.Helper()
+	resp, err := c.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		t.Fatalf("ListPlayers failed: %v", err)
+	}
+	got := make([]string, len(resp.Players))
+	for i, p := range resp.Players {
+		got[i] = p.Name
+		if p.Rank != int32(i+1) {
+			t.Errorf("%s at position %d has rank %d", p.Name, i+1, p.Rank)
+		}
+	}
+	if len(got) != len(names) {
+		t.Fatalf("ladder is %v, want %v", got, names)
+	}
+	for i := range names {
+		if got[i] != names[i] {
+			t.Fatalf("ladder is %v, want %v", got, names)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPConfig says how to send email
+type SMTPConfig struct {
+	Addr     string // host:port of the SMTP server, e.g. "smtp.example.org:587"
+	Username string // Empty for servers that accept mail without authentication
+	Password string
+	From     string // e.g. "Squash Ladder <ladder@example.org>"
+}
+
+// emailSender sends plain text email through an SMTP server
+type emailSender struct {
+	addr string
+	auth smtp.Auth
+	from *mail.Address
+	// sendMail is smtp.SendMail, replaced in tests
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func newEmailSender(cfg SMTPConfig) (*emailSender, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %v", cfg.Addr, err)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email sender %q: %v", cfg.From, err)
+	}
+	s := &emailSender{addr: cfg.Addr, from: from, sendMail: smtp.SendMail}
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return s, nil
+}
+
+// send delivers a plain text message to one address
+func (s *emailSender) send(to, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.Write(bytes.ReplaceAll([]byte(body), []byte("\n"), []byte("\r\n")))
+	msg.WriteString("\r\n")
+	return s.sendMail(s.addr, s.auth, s.from.Address, []string{to}, msg.Bytes())
+}
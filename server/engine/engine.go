@@ -0,0 +1,140 @@
+// Package engine is the part of the ladder the web client runs offline, compiled to
+// WebAssembly by cmd/wasm: checking a score and previewing the standings after a
+// match, with exactly the server's rules. Requests and responses are JSON in the
+// proto3 JSON mapping, as the gRPC-Web messages' toObject gives them.
+package engine
+
+import (
+	"encoding/json"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+	"squash-ladder/server/scoring"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ScoreRequest is a score to check. The scoring format is the ScoringFormat name or
+// number, empty for the default. Each side's head start comes from the players'
+// handicaps when players are given, as the server works it out, and from
+// ChallengerStart and DefenderStart otherwise.
+type ScoreRequest struct {
+	SetScores       []json.RawMessage `json:"setScores"`
+	ScoringFormat   json.RawMessage   `json:"scoringFormat"`
+	Players         []json.RawMessage `json:"players"`
+	ChallengerID    string            `json:"challengerId"`
+	DefenderID      string            `json:"defenderId"`
+	ChallengerStart int32             `json:"challengerStart"`
+	DefenderStart   int32             `json:"defenderStart"`
+}
+
+// ScoreResponse gives the winner, 1 for the challenger or 2 for the defender, or
+// the rule the score breaks
+type ScoreResponse struct {
+	Winner int    `json:"winner,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PreviewRequest is a match to apply to the current standings
+type PreviewRequest struct {
+	Players      []json.RawMessage `json:"players"`
+	ChallengerID string            `json:"challengerId"`
+	DefenderID   string            `json:"defenderId"`
+	WinnerID     string            `json:"winnerId"`
+}
+
+// PreviewResponse is the standings after the match, or why it cannot be applied.
+// Provisional players who complete their qualification are placed by the server
+// once the result is recorded, so the preview leaves them unranked.
+type PreviewResponse struct {
+	Players []json.RawMessage `json:"players,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+var unmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// ValidateScore checks the score in a JSON ScoreRequest and returns a JSON
+// ScoreResponse
+func ValidateScore(request string) string {
+	var req ScoreRequest
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		return encode(ScoreResponse{Error: err.Error()})
+	}
+	// LadderRules reads the format in either form
+	rules := &ladderpb.LadderRules{}
+	if len(req.ScoringFormat) > 0 {
+		data := append(append([]byte(`{"scoringFormat":`), req.ScoringFormat...), '}')
+		if err := unmarshal.Unmarshal(data, rules); err != nil {
+			return encode(ScoreResponse{Error: err.Error()})
+		}
+	}
+	sets := make([]*ladderpb.SetScore, len(req.SetScores))
+	for i, raw := range req.SetScores {
+		sets[i] = &ladderpb.SetScore{}
+		if err := unmarshal.Unmarshal(raw, sets[i]); err != nil {
+			return encode(ScoreResponse{Error: err.Error()})
+		}
+	}
+	challengerStart, defenderStart := req.ChallengerStart, req.DefenderStart
+	if len(req.Players) > 0 {
+		players, err := unmarshalPlayers(req.Players)
+		if err != nil {
+			return encode(ScoreResponse{Error: err.Error()})
+		}
+		challengerStart, defenderStart = scoring.HandicapStarts(players, req.ChallengerID, req.DefenderID)
+	}
+	winner, err := scoring.ValidateHandicap(sets, rules.ScoringFormat, challengerStart, defenderStart)
+	if err != nil {
+		return encode(ScoreResponse{Error: err.Error()})
+	}
+	return encode(ScoreResponse{Winner: winner})
+}
+
+// PreviewMatch applies the match in a JSON PreviewRequest and returns a JSON
+// PreviewResponse
+func PreviewMatch(request string) string {
+	var req PreviewRequest
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		return encode(PreviewResponse{Error: err.Error()})
+	}
+	players, err := unmarshalPlayers(req.Players)
+	if err != nil {
+		return encode(PreviewResponse{Error: err.Error()})
+	}
+
+	after, err := replay.Apply(storagepb.TransactionType_MATCH_RESULT, &storagepb.MatchResultStorage{
+		ChallengerId: req.ChallengerID,
+		DefenderId:   req.DefenderID,
+		WinnerId:     req.WinnerID,
+	}, players)
+	if err != nil {
+		return encode(PreviewResponse{Error: err.Error()})
+	}
+	resp := PreviewResponse{Players: make([]json.RawMessage, len(after))}
+	for i, p := range after {
+		if resp.Players[i], err = protojson.Marshal(p); err != nil {
+			return encode(PreviewResponse{Error: err.Error()})
+		}
+	}
+	return encode(resp)
+}
+
+func unmarshalPlayers(raws []json.RawMessage) ([]*ladderpb.Player, error) {
+	players := make([]*ladderpb.Player, len(raws))
+	for i, raw := range raws {
+		players[i] = &ladderpb.Player{}
+		if err := unmarshal.Unmarshal(raw, players[i]); err != nil {
+			return nil, err
+		}
+	}
+	return players, nil
+}
+
+func encode(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return `{"error":"failed to encode the response"}`
+	}
+	return string(data)
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		winner  int
+		err     string
+	}{
+		{
+			name:    "challenger wins",
+			request: `{"setScores":[{"challengerPoints":11,"defenderPoints":9},{"challengerPoints":11,"defenderPoints":5},{"challengerPoints":11,"defenderPoints":7}]}`,
+			winner:  1,
+		},
+		{
+			name:    "format by name",
+			request: `{"setScores":[{"challengerPoints":4,"defenderPoints":11},{"challengerPoints":8,"defenderPoints":11}],"scoringFormat":"BEST_OF_3_PAR_11"}`,
+			winner:  2,
+		},
+		{
+			name:    "format by number",
+			request: `{"setScores":[{"challengerPoints":4,"defenderPoints":11},{"challengerPoints":8,"defenderPoints":11}],"scoringFormat":1}`,
+			winner:  2,
+		},
+		{
+			name:    "not won by two",
+			request: `{"setScores":[{"challengerPoints":11,"defenderPoints":10}]}`,
+			err:     "must win by 2 points: 11-10",
+		},
+		{
+			name: "handicap from players",
+			request: `{"setScores":[{"challengerPoints":8,"defenderPoints":11},{"challengerPoints":8,"defenderPoints":11},{"challengerPoints":8,"defenderPoints":11}],
+				"players":[{"id":"a","handicap":3},{"id":"b"}],"challengerId":"a","defenderId":"b"}`,
+			err: "must win by 2 points: 11-11",
+		},
+		{
+			name:    "not JSON",
+			request: `{`,
+			err:     "unexpected end of JSON input",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp ScoreResponse
+			if err := json.Unmarshal([]byte(ValidateScore(tt.request)), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Winner != tt.winner || resp.Error != tt.err {
+				t.Errorf("got winner %d, error %q; want %d, %q", resp.Winner, resp.Error, tt.winner, tt.err)
+			}
+		})
+	}
+}
+
+func TestPreviewMatch(t *testing.T) {
+	request := `{"players":[{"id":"a","name":"Ann","rank":1},{"id":"b","name":"Bob","rank":2}],
+		"challengerId":"b","defenderId":"a","winnerId":"b"}`
+	var resp PreviewResponse
+	if err := json.Unmarshal([]byte(PreviewMatch(request)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	var got []string
+	for _, raw := range resp.Players {
+		var p struct {
+			ID   string `json:"id"`
+			Rank int    `json:"rank"`
+		}
+		if err := json.Unmarshal(raw, &p); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p.ID)
+		if p.Rank != len(got) {
+			t.Errorf("%s has rank %d, want %d", p.ID, p.Rank, len(got))
+		}
+	}
+	if strings.Join(got, ",") != "b,a" {
+		t.Errorf("standings %v, want [b a]", got)
+	}
+
+	if err := json.Unmarshal([]byte(PreviewMatch(`{"players":[{"id":"a","rank":1}],"challengerId":"x","defenderId":"a","winnerId":"x"}`)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == "" {
+		t.Error("match with an unknown player was previewed")
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// LadderChange describes a transaction that was just appended to the log
+type LadderChange struct {
+	Transaction *storagepb.TransactionStorage
+	Before      []*ladderpb.Player
+	After       []*ladderpb.Player
+	// Seq increases with every write to the model, so listeners, which may run out
+	// of order, can tell which of two changes is newer
+	Seq uint64
+}
+
+// RankMove is a single player's change of position caused by a transaction
+type RankMove struct {
+	PlayerID string
+	Name     string
+	FromRank int32 // 0 when the player joined
+	ToRank   int32 // 0 when the player left
+}
+
+// OnChange registers fn to be called after every successful write. Listeners run on
+// their own goroutine and must not assume ordering between calls.
+func (m *Model) OnChange(fn func(LadderChange)) {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+func (m *Model) hasListeners() bool {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+	return len(m.listeners) > 0
+}
+
+func (m *Model) notifyListeners(change LadderChange) {
+	m.listenersMu.Lock()
+	m.changeSeq++
+	change.Seq = m.changeSeq
+	listeners := append([]func(LadderChange){}, m.listeners...)
+	m.listenersMu.Unlock()
+
+	for _, fn := range listeners {
+		go fn(change)
+	}
+}
+
+// Moves lists every player whose rank changed, in the order of their new rank
+// followed by players who left the ladder
+func (c LadderChange) Moves() []RankMove {
+	before := make(map[string]*ladderpb.Player)
+	for _, p := range c.Before {
+		before[p.Id] = p
+	}
+
+	var moves []RankMove
+	seen := make(map[string]bool)
+	for _, p := range c.After {
+		seen[p.Id] = true
+		old, ok := before[p.Id]
+		if !ok {
+			moves = append(moves, RankMove{PlayerID: p.Id, Name: p.Name, ToRank: p.Rank})
+			continue
+		}
+		if old.Rank != p.Rank {
+			moves = append(moves, RankMove{PlayerID: p.Id, Name: p.Name, FromRank: old.Rank, ToRank: p.Rank})
+		}
+	}
+	for _, p := range c.Before {
+		if !seen[p.Id] {
+			moves = append(moves, RankMove{PlayerID: p.Id, Name: p.Name, FromRank: p.Rank})
+		}
+	}
+	return moves
+}
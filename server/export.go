@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+)
+
+// exportRecentLimit is the number of recent results printed under the standings
+const exportRecentLimit = 10
+
+// ExportHandler serves downloadable exports of the ladder
+type ExportHandler struct {
+	service *LadderService
+}
+
+// NewExportHandler creates an export handler
+func NewExportHandler(service *LadderService) *ExportHandler {
+	return &ExportHandler{service: service}
+}
+
+// ServeHTTP routes export requests by path
+func (e *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/export/ladder.pdf":
+		e.ladderPDF(w, r)
+	case "/api/export/results.csv":
+		e.resultsCSV(w, r)
+	case "/api/export/grid.html":
+		e.gridHTML(w, r)
+	case "/api/export/grid.csv":
+		e.gridCSV(w, r)
+	default:
+		writeRESTError(w, codes.NotFound, "unknown export", map[string]string{"path": r.URL.Path})
+	}
+}
+
+// ladderPDF renders the standings and recent results for the noticeboard
+func (e *ExportHandler) ladderPDF(w http.ResponseWriter, r *http.Request) {
+	players, err := e.service.ListPlayers(r.Context(), &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		writeRESTErr(w, err)
+		return
+	}
+	matches, err := e.service.ListRecentMatches(r.Context(), &ladderpb.ListRecentMatchesRequest{Limit: exportRecentLimit})
+	if err != nil {
+		writeRESTErr(w, err)
+		return
+	}
+
+	loc := e.service.modelFor(r.Context()).TimeZone()
+	lines := []pdfLine{
+		{Text: "Squash Ladder", Size: 24, Bold: true},
+		{Text: "Standings as of " + time.Now().In(loc).Format("Monday 2 January 2006, 15:04"), Size: 10},
+		{Text: "Standings", Size: 16, Bold: true, Gap: 12},
+	}
+	if len(players.Players) == 0 {
+		lines = append(lines, pdfLine{Text: "The ladder is empty.", Size: 12})
+	}
+	names := make(map[string]string)
+	for _, p := range players.Players {
+		names[p.Id] = p.Name
+		lines = append(lines, pdfLine{Text: fmt.Sprintf("%3d.  %s", p.Rank, p.Name), Size: 12})
+	}
+
+	lines = append(lines, pdfLine{Text: "Recent results", Size: 16, Bold: true, Gap: 12})
+	if len(matches.Results) == 0 {
+		lines = append(lines, pdfLine{Text: "No results recorded yet.", Size: 12})
+	}
+	for _, mr := range matches.Results {
+		played := time.UnixMilli(mr.PlayedAtMs).In(loc).Format("2 Jan")
+		lines = append(lines, pdfLine{Text: played + "   " + describeMatch(mr, names), Size: 11})
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="ladder.pdf"`)
+	if err := writeTextPDF(w, lines); err != nil {
+		log.Printf("failed to write ladder PDF: %v", err)
+	}
+}
+
+// clubLockerHeader is the column layout of the ClubLocker / US Squash sanctioned-play
+// results upload. Player 1 is the challenger and game scores are player 1 first.
+var clubLockerHeader = []string{
+	"Match Date", "Player 1 ID", "Player 1 Name", "Player 2 ID", "Player 2 Name", "Winner",
+	"Game 1", "Game 2", "Game 3", "Game 4", "Game 5", "Forfeit",
+}
+
+// exportDateRange reads the inclusive ?from= and ?to= dates (YYYY-MM-DD) in the zone of
+// now. Without them the previous calendar month is exported, ready for the monthly upload.
+func exportDateRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	from, to := thisMonth.AddDate(0, -1, 0), thisMonth
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", v)
+		}
+		from = d
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", v)
+		}
+		to = d.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from date must not be after to date")
+	}
+	return from, to, nil
+}
+
+// resultsCSV exports the matches in a date range in the ClubLocker upload layout
+func (e *ExportHandler) resultsCSV(w http.ResponseWriter, r *http.Request) {
+	model := e.service.modelFor(r.Context())
+	loc := model.TimeZone()
+	from, to, err := exportDateRange(r, time.Now().In(loc))
+	if err != nil {
+		writeRESTError(w, codes.InvalidArgument, err.Error(), nil)
+		return
+	}
+	matches, names, err := model.MatchesBetween(r.Context(), from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		writeRESTErr(w, err)
+		return
+	}
+	if isPublicView(r.Context()) {
+		names = maskedNames(names)
+	}
+
+	filename := fmt.Sprintf("results-%s-to-%s.csv", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write(clubLockerHeader)
+	for _, mr := range matches {
+		cw.Write(clubLockerRow(mr, names, loc))
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("failed to write results CSV: %v", err)
+	}
+}
+
+func clubLockerRow(mr *ladderpb.MatchResult, names map[string]string, loc *time.Location) []string {
+	winner := "1"
+	if mr.WinnerId == mr.DefenderId {
+		winner = "2"
+	}
+	games := make([]string, 5)
+	forfeit := "N"
+	for i, s := range mr.SetScores {
+		if s.ChallengerDefault || s.DefenderDefault {
+			forfeit = "Y"
+			continue
+		}
+		if i < len(games) {
+			games[i] = strconv.Itoa(int(s.ChallengerPoints)) + "-" + strconv.Itoa(int(s.DefenderPoints))
+		}
+	}
+
+	row := []string{
+		time.UnixMilli(mr.PlayedAtMs).In(loc).Format("2006-01-02"),
+		mr.ChallengerId, names[mr.ChallengerId],
+		mr.DefenderId, names[mr.DefenderId],
+		winner,
+	}
+	row = append(row, games...)
+	return append(row, forfeit)
+}
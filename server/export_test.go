@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestExportHandler_LadderPDF(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob (Jr)", "bob")
+	scores := []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 11, DefenderPoints: 7}, {ChallengerPoints: 11, DefenderPoints: 3}}
+	m.AddMatchResult("bob", "alice", "bob", scores)
+
+	rec := httptest.NewRecorder()
+	NewExportHandler(NewLadderService(m)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/export/ladder.pdf", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.Bytes()
+	if !bytes.HasPrefix(body, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(body, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF document")
+	}
+	for _, want := range []string{`(  1.  Bob \(Jr\)) Tj`, `(  2.  Alice) Tj`, `Bob \(Jr\) beat Alice \(11-5, 11-7, 11-3\)`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("PDF missing %q", want)
+		}
+	}
+
+	// startxref must point at the cross-reference table
+	match := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(body)
+	if match == nil {
+		t.Fatal("missing startxref")
+	}
+	off, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(body[off:], []byte("xref\n")) {
+		t.Errorf("startxref %d does not point at xref table", off)
+	}
+}
+
+func TestWriteTextPDF_Pagination(t *testing.T) {
+	var lines []pdfLine
+	for i := 0; i < 100; i++ {
+		lines = append(lines, pdfLine{Text: "line", Size: 12})
+	}
+	var buf bytes.Buffer
+	if err := writeTextPDF(&buf, lines); err != nil {
+		t.Fatalf("writeTextPDF failed: %v", err)
+	}
+	if got := strings.Count(buf.String(), "/Type /Page /Parent"); got != 3 {
+		t.Errorf("expected 3 pages for 100 lines, got %d", got)
+	}
+}
+
+func TestExportHandler_ResultsCSV(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob, Jr", "bob")
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 9, DefenderPoints: 11}, {ChallengerPoints: 11, DefenderPoints: 3}, {ChallengerPoints: 12, DefenderPoints: 10}})
+	txID, _ := m.AddMatchResult("alice", "bob", "bob", []*ladderpb.SetScore{{ChallengerDefault: true}})
+	m.AddMatchResult("alice", "bob", "alice", []*ladderpb.SetScore{{DefenderDefault: true}})
+	m.InvalidateMatchResult(context.Background(), txID)
+
+	today := time.Now().Format("2006-01-02")
+	rec := httptest.NewRecorder()
+	NewExportHandler(NewLadderService(m)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/export/results.csv?from="+today+"&to="+today, nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Body.String())
+	}
+
+	want := "Match Date,Player 1 ID,Player 1 Name,Player 2 ID,Player 2 Name,Winner,Game 1,Game 2,Game 3,Game 4,Game 5,Forfeit\n" +
+		today + ",bob,\"Bob, Jr\",alice,Alice,1,11-5,9-11,11-3,12-10,,N\n" +
+		today + ",alice,Alice,bob,\"Bob, Jr\",1,,,,,,Y\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("unexpected CSV:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The default range is the previous month, which has no matches
+	rec = httptest.NewRecorder()
+	NewExportHandler(NewLadderService(m)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/export/results.csv", nil))
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 1 {
+		t.Errorf("expected only the header for last month, got %d lines", lines)
+	}
+
+	rec = httptest.NewRecorder()
+	NewExportHandler(NewLadderService(m)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/export/results.csv?from=2024-13-01", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad date, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	fcmAPIBase = "https://fcm.googleapis.com/v1"
+	fcmScope   = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// fcmSender delivers notifications to Android and iOS apps through the Firebase
+// Cloud Messaging HTTP v1 API, authenticating as a service account of the project
+type fcmSender struct {
+	auth    *googleServiceAccount
+	apiBase string
+	client  *http.Client
+}
+
+// newFCMSender creates a sender from the JSON key file of a service account of the
+// Firebase project
+func newFCMSender(credentialsJSON []byte) (*fcmSender, error) {
+	auth, err := newGoogleServiceAccount(credentialsJSON, fcmScope)
+	if err != nil {
+		return nil, err
+	}
+	if auth.projectID == "" {
+		return nil, fmt.Errorf("FCM credentials need a project_id")
+	}
+	return &fcmSender{
+		auth:    auth,
+		apiBase: fcmAPIBase,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// send delivers msg to a device registration token
+func (s *fcmSender) send(ctx context.Context, token string, msg pushMessage) error {
+	access, err := s.auth.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        token,
+			"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+			"data":         map[string]string{"event": msg.Event, "tag": msg.Tag},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/projects/%s/messages:send", s.apiBase, url.PathEscape(s.auth.projectID))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	// Tokens of uninstalled apps are reported as UNREGISTERED, usually with a 404
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusNotFound || strings.Contains(string(body), "UNREGISTERED") {
+		return errPushGone
+	}
+	return fmt.Errorf("FCM returned %s", resp.Status)
+}
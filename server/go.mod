@@ -4,7 +4,9 @@ go 1.23
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/icza/backscanner v0.0.0-20241124160932-dff01ac50250
 	github.com/improbable-eng/grpc-web v0.15.0
+	golang.org/x/net v0.21.0
 	google.golang.org/grpc v1.63.2
 	google.golang.org/protobuf v1.34.1
 )
@@ -12,10 +14,8 @@ require (
 require (
 	github.com/cenkalti/backoff/v4 v4.1.1 // indirect
 	github.com/desertbit/timer v0.0.0-20180107155436-c41aec40b27f // indirect
-	github.com/icza/backscanner v0.0.0-20241124160932-dff01ac50250 // indirect
 	github.com/klauspost/compress v1.11.7 // indirect
 	github.com/rs/cors v1.7.0 // indirect
-	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240227224415-6ceb2ff114de // indirect
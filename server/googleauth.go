@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+
+// googleServiceAccount obtains OAuth access tokens for a Google service account by
+// signing a JWT assertion with its private key
+type googleServiceAccount struct {
+	email     string
+	projectID string
+	key       *rsa.PrivateKey
+	tokenURL  string
+	scope     string
+	client    *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// newGoogleServiceAccount parses the JSON key file of a service account and requests
+// tokens for scope
+func newGoogleServiceAccount(credentialsJSON []byte, scope string) (*googleServiceAccount, error) {
+	var creds struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+		ProjectID   string `json:"project_id"`
+	}
+	if err := json.Unmarshal(credentialsJSON, &creds); err != nil {
+		return nil, fmt.Errorf("invalid service account credentials: %v", err)
+	}
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if creds.ClientEmail == "" || block == nil {
+		return nil, fmt.Errorf("service account credentials need client_email and private_key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key is not RSA")
+	}
+	if creds.TokenURI == "" {
+		creds.TokenURI = googleTokenURL
+	}
+	return &googleServiceAccount{
+		email:     creds.ClientEmail,
+		projectID: creds.ProjectID,
+		key:       key,
+		tokenURL:  creds.TokenURI,
+		scope:     scope,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// accessToken returns a cached OAuth token, exchanging a signed service account
+// assertion for a new one when it is about to expire
+func (a *googleServiceAccount) accessToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expiry) {
+		return a.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := a.signJWT(map[string]interface{}{
+		"iss":   a.email,
+		"scope": a.scope,
+		"aud":   a.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	a.token = body.AccessToken
+	// Renew a minute early so a token never expires mid-request
+	a.expiry = now.Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return a.token, nil
+}
+
+func (a *googleServiceAccount) signJWT(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
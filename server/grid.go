@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+var gridTemplate = template.Must(template.New("grid").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Squash Ladder results grid</title>
+<style>
+  body { font-family: sans-serif; margin: 1cm; }
+  h1 { margin: 0 0 0.2cm; }
+  table { border-collapse: collapse; }
+  th, td { border: 1px solid #888; padding: 0.1cm 0.2cm; text-align: center; }
+  th.name { text-align: left; white-space: nowrap; }
+  th.col { writing-mode: vertical-rl; transform: rotate(180deg); white-space: nowrap; }
+  td.self { background: #444; }
+  td.up { background: #dfd; }
+  td.down { background: #fdd; }
+  .updated { font-size: small; color: #777; margin-bottom: 0.5cm; }
+  @media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Squash Ladder</h1>
+<div class="updated">Head-to-head results as of {{.Updated}}; each cell is the row player's wins-losses against the column player</div>
+{{if .Rows}}<table>
+<tr><th></th>{{range .Rows}}<th class="col">{{.Rank}}. {{.Name}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th class="name">{{.Rank}}. {{.Name}}</th>{{range .Cells}}<td class="{{.Class}}">{{.Text}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p>The ladder is empty.</p>{{end}}
+</body>
+</html>
+`))
+
+// ResultsGrid returns the head-to-head record of every pair of players on the ladder
+// over all valid matches
+func (m *Model) ResultsGrid(ctx context.Context) (*ladderpb.GetResultsGridResponse, error) {
+	players := m.ListPlayers()
+	matches, _, err := m.MatchesBetween(ctx, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(players))
+	resp := &ladderpb.GetResultsGridResponse{Players: players}
+	for i, p := range players {
+		index[p.Id] = i
+		row := &ladderpb.GridRow{PlayerId: p.Id, Cells: make([]*ladderpb.GridCell, len(players))}
+		for j := range row.Cells {
+			row.Cells[j] = &ladderpb.GridCell{}
+		}
+		resp.Rows = append(resp.Rows, row)
+	}
+	for _, mr := range matches {
+		c, okC := index[mr.ChallengerId]
+		d, okD := index[mr.DefenderId]
+		if !okC || !okD {
+			continue
+		}
+		winner, loser := c, d
+		if mr.WinnerId == mr.DefenderId {
+			winner, loser = d, c
+		}
+		resp.Rows[winner].Cells[loser].Wins++
+		resp.Rows[loser].Cells[winner].Losses++
+	}
+	return resp, nil
+}
+
+// GetResultsGrid returns the head-to-head grid
+func (h *LadderService) GetResultsGrid(ctx context.Context, req *ladderpb.GetResultsGridRequest) (*ladderpb.GetResultsGridResponse, error) {
+	return h.modelFor(ctx).ResultsGrid(ctx)
+}
+
+// resultsGrid fetches the grid for an export, masking names for the public view
+func (e *ExportHandler) resultsGrid(w http.ResponseWriter, r *http.Request) *ladderpb.GetResultsGridResponse {
+	grid, err := e.service.GetResultsGrid(r.Context(), &ladderpb.GetResultsGridRequest{})
+	if err != nil {
+		writeRESTErr(w, err)
+		return nil
+	}
+	if isPublicView(r.Context()) {
+		maskNames(grid)
+	}
+	return grid
+}
+
+// gridCellText shows a record as wins-losses, or nothing if the pair never played
+func gridCellText(c *ladderpb.GridCell) string {
+	if c.Wins == 0 && c.Losses == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", c.Wins, c.Losses)
+}
+
+// gridHTML renders the grid as a printable poster
+func (e *ExportHandler) gridHTML(w http.ResponseWriter, r *http.Request) {
+	grid := e.resultsGrid(w, r)
+	if grid == nil {
+		return
+	}
+
+	type cell struct{ Text, Class string }
+	type row struct {
+		Rank  int32
+		Name  string
+		Cells []cell
+	}
+	data := struct {
+		Updated string
+		Rows    []row
+	}{Updated: time.Now().In(e.service.modelFor(r.Context()).TimeZone()).Format("2 January 2006, 15:04")}
+	for i, p := range grid.Players {
+		rw := row{Rank: p.Rank, Name: p.Name}
+		for j, c := range grid.Rows[i].Cells {
+			class := ""
+			switch {
+			case i == j:
+				class = "self"
+			case c.Wins > c.Losses:
+				class = "up"
+			case c.Wins < c.Losses:
+				class = "down"
+			}
+			rw.Cells = append(rw.Cells, cell{Text: gridCellText(c), Class: class})
+		}
+		data.Rows = append(data.Rows, rw)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := gridTemplate.Execute(w, data); err != nil {
+		log.Printf("failed to render results grid: %v", err)
+	}
+}
+
+// gridCSV exports the grid with a header row and column of player names
+func (e *ExportHandler) gridCSV(w http.ResponseWriter, r *http.Request) {
+	grid := e.resultsGrid(w, r)
+	if grid == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="grid.csv"`)
+
+	cw := csv.NewWriter(w)
+	header := []string{"Rank", "Player"}
+	for _, p := range grid.Players {
+		header = append(header, p.Name)
+	}
+	cw.Write(header)
+	for i, p := range grid.Players {
+		record := []string{fmt.Sprint(p.Rank), p.Name}
+		for _, c := range grid.Rows[i].Cells {
+			record = append(record, gridCellText(c))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("failed to write results grid CSV: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestResultsGrid(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol <3", "carol")
+	win := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	m.AddMatchResult("bob", "alice", "bob", win)
+	m.AddMatchResult("bob", "alice", "alice", []*ladderpb.SetScore{{ChallengerDefault: true}})
+	m.AddMatchResult("carol", "alice", "carol", win)
+	txID, _ := m.AddMatchResult("carol", "bob", "carol", win)
+	m.InvalidateMatchResult(context.Background(), txID)
+
+	svc := NewLadderService(m)
+	grid, err := svc.GetResultsGrid(context.Background(), &ladderpb.GetResultsGridRequest{})
+	if err != nil {
+		t.Fatalf("GetResultsGrid failed: %v", err)
+	}
+	// Carol took Alice's place at the top
+	var ids []string
+	for _, p := range grid.Players {
+		ids = append(ids, p.Id)
+	}
+	if !reflect.DeepEqual(ids, []string{"carol", "alice", "bob"}) {
+		t.Fatalf("expected ladder order, got %v", ids)
+	}
+	record := func(i, j int) [2]int32 {
+		c := grid.Rows[i].Cells[j]
+		return [2]int32{c.Wins, c.Losses}
+	}
+	for _, tc := range []struct {
+		i, j int
+		want [2]int32
+	}{
+		{1, 2, [2]int32{1, 1}}, // Alice against Bob
+		{2, 1, [2]int32{1, 1}},
+		{0, 1, [2]int32{1, 0}}, // Carol against Alice
+		{1, 0, [2]int32{0, 1}},
+		{0, 2, [2]int32{0, 0}}, // The invalidated match is left out
+		{1, 1, [2]int32{0, 0}},
+	} {
+		if got := record(tc.i, tc.j); got != tc.want {
+			t.Errorf("%s against %s: expected %v, got %v", ids[tc.i], ids[tc.j], tc.want, got)
+		}
+	}
+
+	exports := NewExportHandler(svc)
+	rec := httptest.NewRecorder()
+	exports.ServeHTTP(rec, httptest.NewRequest("GET", "/api/export/grid.csv", nil))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	want := [][]string{
+		{"Rank", "Player", "Carol <3", "Alice", "Bob"},
+		{"1", "Carol <3", "", "1-0", ""},
+		{"2", "Alice", "0-1", "", "1-1"},
+		{"3", "Bob", "", "1-1", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("expected %v, got %v", want, rows)
+	}
+
+	rec = httptest.NewRecorder()
+	exports.ServeHTTP(rec, httptest.NewRequest("GET", "/api/export/grid.html", nil))
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/html; charset=utf-8" || !strings.Contains(body, "1. Carol &lt;3") || !strings.Contains(body, `<td class="up">1-0</td>`) {
+		t.Errorf("unexpected grid page: %s", body)
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultGrowthCheckInterval is how often log growth is measured when thresholds are set
+const defaultGrowthCheckInterval = time.Hour
+
+var (
+	logSizeBytes       = expvar.NewInt("log_size_bytes")
+	logTransactions    = expvar.NewInt("log_transactions")
+	logGrowthWarnings  = expvar.NewInt("log_growth_warnings")
+	logGrowthOverLimit = expvar.NewMap("log_growth_over_limit")
+)
+
+// GrowthLimits are soft limits on a ladder's log. Passing one only raises a warning;
+// writes carry on. Zero fields are not checked.
+type GrowthLimits struct {
+	MaxBytes        int64
+	MaxTransactions int64
+}
+
+// GrowthWarning reports a ladder whose log has passed one of its soft limits
+type GrowthWarning struct {
+	Ladder    string `json:"ladder"` // "ladder", or "club-" and the club ID
+	Limit     string `json:"limit"`  // "bytes" or "transactions"
+	Value     int64  `json:"value"`
+	Threshold int64  `json:"threshold"`
+}
+
+// GrowthAlarm measures the logs of the ladder, and every club's, and warns in the
+// server log, the expvar metrics and an optional webhook when one passes a soft limit,
+// so there is time to compact it before the disk fills. Each limit warns once when it
+// is passed, and again only after the log has shrunk back below it.
+type GrowthAlarm struct {
+	model    *Model
+	clubs    *ClubRegistry // nil unless hosting multiple clubs
+	interval time.Duration
+	client   *http.Client
+
+	mu         sync.Mutex
+	limits     GrowthLimits
+	webhookURL string
+	raised     map[string]bool // ladder and limit pairs currently over
+}
+
+// NewGrowthAlarm creates an alarm that checks limits every interval (default 1h) and
+// POSTs new warnings to webhookURL (if set)
+func NewGrowthAlarm(m *Model, clubs *ClubRegistry, limits GrowthLimits, interval time.Duration, webhookURL string) *GrowthAlarm {
+	return &GrowthAlarm{
+		model:      m,
+		clubs:      clubs,
+		limits:     limits,
+		interval:   orDefault(interval, defaultGrowthCheckInterval),
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		raised:     make(map[string]bool),
+	}
+}
+
+// Start checks once straight away, then in the background every interval until stop
+// is closed
+func (a *GrowthAlarm) Start(stop <-chan struct{}) {
+	go func() {
+		a.RunOnce()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.RunOnce()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// SetLimits replaces the soft limits; the next check warns about any that are
+// already passed
+func (a *GrowthAlarm) SetLimits(limits GrowthLimits) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.limits = limits
+}
+
+// SetWebhookURL changes where warnings are sent; "" stops sending them
+func (a *GrowthAlarm) SetWebhookURL(url string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.webhookURL = url
+}
+
+// RunOnce measures every log now and returns the limits newly passed
+func (a *GrowthAlarm) RunOnce() []GrowthWarning {
+	ladders := map[string]*Model{"ladder": a.model}
+	if a.clubs != nil {
+		clubs, err := a.clubs.ListClubs()
+		if err != nil {
+			log.Printf("growth: failed to list clubs: %v", err)
+		}
+		for _, c := range clubs {
+			m, err := a.clubs.Model(c.Id)
+			if err != nil {
+				log.Printf("growth: %v", err)
+				continue
+			}
+			ladders["club-"+c.Id] = m
+		}
+	}
+	names := make([]string, 0, len(ladders))
+	for name := range ladders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	a.mu.Lock()
+	limits := a.limits
+	a.mu.Unlock()
+
+	var warnings []GrowthWarning
+	for _, name := range names {
+		size, count, err := ladders[name].LogStats()
+		if err != nil {
+			log.Printf("growth: failed to measure %s: %v", name, err)
+			continue
+		}
+		if name == "ladder" {
+			logSizeBytes.Set(size)
+			logTransactions.Set(count)
+		}
+		warnings = append(warnings, a.check(name, "bytes", size, limits.MaxBytes)...)
+		warnings = append(warnings, a.check(name, "transactions", count, limits.MaxTransactions)...)
+	}
+
+	for _, w := range warnings {
+		logGrowthWarnings.Add(1)
+		log.Printf("growth: %s log has %d %s, over the soft limit of %d; consider compacting it", w.Ladder, w.Value, w.Limit, w.Threshold)
+		a.notify(w)
+	}
+	return warnings
+}
+
+// check returns a warning if value has just passed threshold, and re-arms the alarm
+// once it is back below
+func (a *GrowthAlarm) check(ladder, limit string, value, threshold int64) []GrowthWarning {
+	key := ladder + " " + limit
+	if threshold <= 0 {
+		a.mu.Lock()
+		delete(a.raised, key)
+		a.mu.Unlock()
+		logGrowthOverLimit.Delete(key)
+		return nil
+	}
+	over := value > threshold
+	overVar := new(expvar.Int)
+	if over {
+		overVar.Set(1)
+	}
+	logGrowthOverLimit.Set(key, overVar)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if over == a.raised[key] {
+		return nil
+	}
+	a.raised[key] = over
+	if !over {
+		return nil
+	}
+	return []GrowthWarning{{Ladder: ladder, Limit: limit, Value: value, Threshold: threshold}}
+}
+
+func (a *GrowthAlarm) notify(w GrowthWarning) {
+	a.mu.Lock()
+	webhookURL := a.webhookURL
+	a.mu.Unlock()
+	if webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"event":   "log_growth_warning",
+		"warning": w,
+	})
+	if err != nil {
+		log.Printf("failed to encode growth webhook: %v", err)
+		return
+	}
+	resp, err := a.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("failed to send growth webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("growth webhook returned %s", resp.Status)
+	}
+}
+
+// LogStats returns the size of the transaction log in bytes and the number of
+// transactions in it
+func (m *Model) LogStats() (size, transactions int64, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, err := os.Open(m.LogFilePath)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	blank := true
+	for {
+		line, err := r.ReadSlice('\n')
+		size += int64(len(line))
+		if len(bytes.TrimSpace(line)) > 0 {
+			blank = false
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if !blank {
+			transactions++
+		}
+		blank = true
+		if err == io.EOF {
+			return size, transactions, nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read log: %v", err)
+		}
+	}
+}
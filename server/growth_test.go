@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestModel_LogStats(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddMatchResult("bob", "alice", "bob", threeLove)
+
+	size, count, err := m.LogStats()
+	if err != nil {
+		t.Fatalf("LogStats failed: %v", err)
+	}
+	stat, _ := os.Stat(path)
+	if size != stat.Size() || count != 3 {
+		t.Errorf("expected %d bytes in 3 transactions, got %d in %d", stat.Size(), size, count)
+	}
+}
+
+func TestGrowthAlarm_WarnsOncePerCrossing(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	received := make(chan map[string]interface{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+	}))
+	defer srv.Close()
+
+	alarm := NewGrowthAlarm(m, nil, GrowthLimits{MaxTransactions: 2}, time.Hour, srv.URL)
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	if warnings := alarm.RunOnce(); len(warnings) != 0 {
+		t.Fatalf("expected no warning at the limit, got %+v", warnings)
+	}
+
+	m.AddPlayer("Carol", "carol")
+	warnings := alarm.RunOnce()
+	if len(warnings) != 1 || warnings[0].Limit != "transactions" || warnings[0].Value != 3 {
+		t.Fatalf("expected a transactions warning, got %+v", warnings)
+	}
+	select {
+	case body := <-received:
+		if body["event"] != "log_growth_warning" {
+			t.Errorf("unexpected webhook body: %v", body)
+		}
+	default:
+		t.Error("expected webhook to be called")
+	}
+
+	m.AddPlayer("Dave", "dave")
+	if warnings := alarm.RunOnce(); len(warnings) != 0 {
+		t.Errorf("expected no repeat warning, got %+v", warnings)
+	}
+
+	// Back under the limit the alarm is armed again
+	alarm.SetLimits(GrowthLimits{MaxTransactions: 10})
+	alarm.RunOnce()
+	alarm.SetLimits(GrowthLimits{MaxTransactions: 2})
+	if warnings := alarm.RunOnce(); len(warnings) != 1 {
+		t.Errorf("expected a new warning after re-arming, got %+v", warnings)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/scoring"
+)
+
+// maxHandicap keeps a head start below the smallest set target
+const maxHandicap = 10
+
+// SetPlayerHandicap records a player's per-set head start, returning the transaction ID
+func (m *Model) SetPlayerHandicap(playerID string, handicap int32) (string, error) {
+	if handicap < 0 || handicap > maxHandicap {
+		return "", localizedErrorf("handicap must be between 0 and %d", maxHandicap)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", err
+	}
+
+	payload := &storagepb.SetHandicapStorage{PlayerId: playerID, Handicap: handicap}
+	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_SET_HANDICAP, payload, currentPlayers)
+	if err != nil {
+		return "", err
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_SET_HANDICAP,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_SetHandicapPayload{SetHandicapPayload: payload},
+		PlayerList:  ladderToStorage(newPlayers),
+	}
+
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	return tx.Id, nil
+}
+
+// handicapStarts returns the per-set head start each side receives
+func handicapStarts(players []*ladderpb.Player, challengerID, defenderID string) (challengerStart, defenderStart int32) {
+	return scoring.HandicapStarts(players, challengerID, defenderID)
+}
+
+// ValidateScoreHandicap validates scores entered as points won on court, after adding
+// each side's head start to every set
+func ValidateScoreHandicap(setScores []*ladderpb.SetScore, format ladderpb.ScoringFormat, challengerStart, defenderStart int32) (int, error) {
+	return localizeScoringError(scoring.ValidateHandicap(setScores, format, challengerStart, defenderStart))
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_SetPlayerHandicap(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	if _, err := m.SetPlayerHandicap("bob", 4); err != nil {
+		t.Fatalf("SetPlayerHandicap failed: %v", err)
+	}
+	if players := m.ListPlayers(); players[1].Handicap != 4 {
+		t.Errorf("expected Bob to have handicap 4, got %+v", players[1])
+	}
+
+	if _, err := m.SetPlayerHandicap("bob", maxHandicap+1); err == nil {
+		t.Error("expected error for oversized handicap")
+	}
+	if _, err := m.SetPlayerHandicap("nobody", 2); err == nil {
+		t.Error("expected error for unknown player")
+	}
+
+	// Handicaps survive later snapshots and replays
+	m.AddPlayer("Charlie", "charlie")
+	if report, _ := m.VerifyLog(context.Background(), false); !report.OK() {
+		t.Errorf("expected clean log, got %+v", report.Mismatches)
+	}
+}
+
+func TestLadderService_AddMatchResult_Handicap(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.SetPlayerHandicap("bob", 3)
+
+	svc := NewLadderService(m)
+
+	// Bob wins 8-11 on court three times, which is 11-11 with his head start: not a valid set
+	_, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+		ChallengerId: "bob",
+		DefenderId:   "alice",
+		WinnerId:     "bob",
+		SetScores: []*ladderpb.SetScore{
+			{ChallengerPoints: 8, DefenderPoints: 11},
+			{ChallengerPoints: 8, DefenderPoints: 11},
+			{ChallengerPoints: 8, DefenderPoints: 11},
+		},
+	})
+	if err == nil {
+		t.Error("expected tied adjusted sets to be rejected")
+	}
+
+	// 8-5 on court is 11-5 with the head start
+	_, err = svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+		ChallengerId: "bob",
+		DefenderId:   "alice",
+		WinnerId:     "bob",
+		SetScores: []*ladderpb.SetScore{
+			{ChallengerPoints: 8, DefenderPoints: 5},
+			{ChallengerPoints: 8, DefenderPoints: 5},
+			{ChallengerPoints: 8, DefenderPoints: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected handicap-adjusted win to be accepted: %v", err)
+	}
+
+	matches, _ := m.GetRecentMatches(1)
+	if matches[0].ChallengerHandicap != 3 || matches[0].DefenderHandicap != 0 {
+		t.Errorf("expected head starts to be recorded, got %+v", matches[0])
+	}
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// supportedLocales are the languages messages can be shown in. English is the source
+// language: messages are written in English in the code and looked up in the catalog.
+var supportedLocales = []string{"en", "de", "fr"}
+
+// catalog translates messages, keyed by locale and then by the English format string.
+// A message missing from a locale is shown in English.
+var catalog = map[string]map[string]string{
+	"de": {
+		// Score validation
+		"defaulting player must happen in the final set":    "eine Aufgabe ist nur im letzten Satz möglich",
+		"both players cannot default":                       "es können nicht beide Spieler aufgeben",
+		"scores cannot be negative":                         "Punktzahlen dürfen nicht negativ sein",
+		"set must go to at least %d: %d-%d":                 "ein Satz geht bis mindestens %d: %d-%d",
+		"must win by 2 points: %d-%d":                       "ein Satz muss mit 2 Punkten Vorsprung gewonnen werden: %d-%d",
+		"too many sets won":                                 "zu viele gewonnene Sätze",
+		"match must have a clear winner (first to %d sets)": "das Spiel braucht einen klaren Sieger (wer zuerst %d Sätze gewinnt)",
+		"handicap must be between 0 and %d":                 "das Handicap muss zwischen 0 und %d liegen",
+
+		// Ladder rules
+		"rules are required":                                              "Regeln sind erforderlich",
+		"challenge window must be at least 1":                             "das Forderungsfenster muss mindestens 1 sein",
+		"response deadline must be at least 1 day":                        "die Antwortfrist muss mindestens 1 Tag betragen",
+		"unknown scoring format: %d":                                      "unbekanntes Zählformat: %d",
+		"unknown decay policy: %d":                                        "unbekannte Verfallsregel: %d",
+		"decay period must be at least 1 day":                             "der Verfallszeitraum muss mindestens 1 Tag betragen",
+		"league points cannot be negative":                                "Ligapunkte dürfen nicht negativ sein",
+		"unknown time zone %q":                                            "unbekannte Zeitzone %q",
+		"entry deadline cannot be negative":                               "die Eintragungsfrist darf nicht negativ sein",
+		"qualification matches cannot be negative":                        "die Zahl der Qualifikationsspiele darf nicht negativ sein",
+		"protection must end after it starts":                             "der Schutz muss nach seinem Beginn enden",
+		"protection dates must look like 2024-07-01":                      "Schutzdaten müssen wie 2024-07-01 aussehen",
+		"players can only act for themselves":                             "Spieler können nur für sich selbst handeln",
+		"%s is protected from challenges through %s":                      "%s ist bis einschließlich %s vor Forderungen geschützt",
+		"a session needs a name":                                          "eine Sitzung braucht einen Namen",
+		"session %q is still open":                                        "die Sitzung %q ist noch offen",
+		"no open session %q":                                              "keine offene Sitzung %q",
+		"session not found":                                               "Sitzung nicht gefunden",
+		"no players to record":                                            "keine Spieler einzutragen",
+		"maximum players cannot be negative":                              "die Höchstzahl der Spieler darf nicht negativ sein",
+		"the ladder is full at %d players; join the waiting list instead": "die Rangliste ist mit %d Spielern voll; trag dich stattdessen in die Warteliste ein",
+		"the ladder has room; join it directly":                           "die Rangliste hat noch Platz; tritt ihr direkt bei",
+		"already on the waiting list":                                     "bereits auf der Warteliste",
+		"not on the waiting list":                                         "nicht auf der Warteliste",
+		"unknown join policy: %d":                                         "unbekannte Beitrittsregel: %d",
+		"unknown join position: %d":                                       "unbekannte Einstiegsposition: %d",
+		"unknown transaction type: %s":                                    "unbekannte Transaktionsart: %s",
+		"only an admin can add players to this ladder":                    "nur ein Admin kann dieser Rangliste Spieler hinzufügen",
+		"already asked to join":                                           "Beitritt bereits angefragt",
+		"no request to join from %s":                                      "keine Beitrittsanfrage von %s",
+		"player %s is not on the ladder":                                  "Spieler %s steht nicht auf der Rangliste",
+		"team_size must be at least 1":                                    "team_size muss mindestens 1 sein",
+		"more players are included than fit in the team":                  "es sind mehr Spieler eingeschlossen, als ins Team passen",
+		"player %s is both included and excluded":                         "Spieler %s ist zugleich eingeschlossen und ausgeschlossen",
+		"date must look like 2024-03-02":                                  "das Datum muss wie 2024-03-02 aussehen",
+		"a team needs a name":                                             "ein Team braucht einen Namen",
+		"team not found: %s":                                              "Team nicht gefunden: %s",
+		"player %s is listed twice":                                       "Spieler %s steht doppelt auf der Liste",
+		"a fixture needs an opponent":                                     "eine Begegnung braucht einen Gegner",
+		"a fixture needs at least one rubber":                             "eine Begegnung braucht mindestens ein Einzel",
+		"rubber positions must be distinct and start at 1":                "die Positionen der Einzel müssen verschieden sein und bei 1 beginnen",
+		"rubber %d has no scores":                                         "Einzel %d hat keine Ergebnisse",
+		"challenger and defender must be two different players":           "Herausforderer und Verteidiger müssen zwei verschiedene Spieler sein",
+		"live match not found: %s":                                        "Live-Spiel nicht gefunden: %s",
+		"there is no point to take back":                                  "es gibt keinen Punkt zum Zurücknehmen",
+		"a point needs a winner":                                          "ein Punkt braucht einen Gewinner",
+		"%s is not playing this match":                                    "%s spielt dieses Spiel nicht",
+		"set duration cannot be negative":                                 "die Satzdauer darf nicht negativ sein",
+		"set %d: every point needs a winner":                              "Satz %d: jeder Punkt braucht einen Gewinner",
+		"set %d: the points add up to %d-%d but the score is %d-%d":       "Satz %d: die Punkte ergeben %d-%d, das Ergebnis ist aber %d-%d",
+		"match not found: %s":                                             "Spiel nicht gefunden: %s",
+		"attachment not found: %s":                                        "Anhang nicht gefunden: %s",
+		"only the players of a match can attach files to it":              "nur die Spieler eines Spiels können Dateien daran anhängen",
+		"a match can have at most %d attachments":                         "ein Spiel kann höchstens %d Anhänge haben",
+		"attachments must be a JPEG, PNG or WebP image or a PDF":          "Anhänge müssen ein JPEG-, PNG- oder WebP-Bild oder ein PDF sein",
+		"invalid set score %q; expected e.g. 11-5":                        "ungültiges Satzergebnis %q; erwartet z. B. 11-5",
+		"no set scores found":                                             "keine Satzergebnisse gefunden",
+		"give either set_scores or scores_string, not both":               "gib entweder set_scores oder scores_string an, nicht beides",
+		"until must be in the future":                                     "das Ende muss in der Zukunft liegen",
+		"you can look for a game for at most %d hours":                    "du kannst höchstens %d Stunden lang nach einem Spiel suchen",
+		"until must be an RFC 3339 time with an offset, e.g. 2024-03-02T19:30:00+01:00": "das Ende muss eine RFC-3339-Zeit mit Zeitzone sein, z. B. 2024-03-02T19:30:00+01:00",
+
+		// Players and results
+		"player ID already exists":          "die Spieler-ID existiert bereits",
+		"player not found":                  "Spieler nicht gefunden",
+		"player not found: %s":              "Spieler nicht gefunden: %s",
+		"challenger or defender not found":  "Herausforderer oder Verteidiger nicht gefunden",
+		"winner must be one of the players": "der Sieger muss einer der beiden Spieler sein",
+		"played_at must be an RFC 3339 time with an offset, e.g. 2024-03-02T19:30:00+01:00":      "played_at muss eine RFC-3339-Zeit mit Zeitverschiebung sein, z. B. 2024-03-02T19:30:00+01:00",
+		"played_at cannot be in the future":                                                      "played_at darf nicht in der Zukunft liegen",
+		"results must be entered within %d days of being played; ask an admin to enter this one": "Ergebnisse müssen innerhalb von %d Tagen nach dem Spiel eingetragen werden; bitte einen Admin, dieses einzutragen",
+		"only an admin can override the entry deadline":                                          "nur ein Admin kann die Eintragungsfrist übergehen",
+		"only an admin can insert a result retroactively":                                        "nur ein Admin kann ein Ergebnis rückwirkend einfügen",
+		"retroactive_insert needs played_at":                                                     "retroactive_insert braucht played_at",
+		"a friendly moves nobody, so it cannot be inserted retroactively":                        "ein Freundschaftsspiel verschiebt niemanden und kann daher nicht rückwirkend eingefügt werden",
+		"%s is ranked above %s; set reversal_override to record a friendly reversal":             "%s steht über %s; setze reversal_override, um ein Freundschaftsspiel mit vertauschten Rollen einzutragen",
+
+		// Notification preferences
+		"invalid email address": "ungültige E-Mail-Adresse",
+		"telegram_chat_id must be numeric; the bot's /myid command shows it": "telegram_chat_id muss numerisch sein; der Befehl /myid des Bots zeigt sie an",
+		"an email address is needed for email notifications":                 "für E-Mail-Benachrichtigungen wird eine E-Mail-Adresse benötigt",
+		"a Telegram chat ID is needed for Telegram notifications":            "für Telegram-Benachrichtigungen wird eine Telegram-Chat-ID benötigt",
+		"unsupported locale %q":                                   "nicht unterstützte Sprache %q",
+		"phone must be in international form, e.g. +447700900123": "die Telefonnummer muss international angegeben werden, z. B. +447700900123",
+		"that phone number is linked to another player":           "diese Telefonnummer gehört schon zu einem anderen Spieler",
+
+		// Notifications
+		"Result recorded":                "Ergebnis eingetragen",
+		"%s beat %s (%s)":                "%s schlägt %s (%s)",
+		"Ladder update":                  "Neues aus der Rangliste",
+		"You moved up to #%d (from #%d)": "Du bist auf Platz %d aufgestiegen (von Platz %d)",
+		"You dropped to #%d (from #%d)":  "Du bist auf Platz %d abgerutscht (von Platz %d)",
+
+		// Weekly digest
+		"Your week on the ladder":                "Deine Woche auf der Rangliste",
+		"You are #%d, up 1 place this week.":     "Du bist auf Platz %d, diese Woche 1 Platz nach oben.",
+		"You are #%d, up %d places this week.":   "Du bist auf Platz %d, diese Woche %d Plätze nach oben.",
+		"You are #%d, down 1 place this week.":   "Du bist auf Platz %d, diese Woche 1 Platz nach unten.",
+		"You are #%d, down %d places this week.": "Du bist auf Platz %d, diese Woche %d Plätze nach unten.",
+		"You are #%d, unchanged this week.":      "Du bist auf Platz %d, unverändert diese Woche.",
+		"No matches this week.":                  "Diese Woche keine Spiele.",
+		"Matches this week:":                     "Spiele dieser Woche:",
+		"2 Jan":                                  "2.1.", // Date layout of a match
+		"Who to play next: %s":                   "Mögliche nächste Gegner: %s",
+	},
+	"fr": {
+		// Score validation
+		"defaulting player must happen in the final set":    "un forfait ne peut intervenir que dans le dernier set",
+		"both players cannot default":                       "les deux joueurs ne peuvent pas déclarer forfait",
+		"scores cannot be negative":                         "les scores ne peuvent pas être négatifs",
+		"set must go to at least %d: %d-%d":                 "un set se joue en au moins %d points : %d-%d",
+		"must win by 2 points: %d-%d":                       "un set se gagne avec 2 points d'écart : %d-%d",
+		"too many sets won":                                 "trop de sets gagnés",
+		"match must have a clear winner (first to %d sets)": "le match doit avoir un vainqueur (premier à %d sets)",
+		"handicap must be between 0 and %d":                 "le handicap doit être compris entre 0 et %d",
+
+		// Ladder rules
+		"rules are required":                                              "les règles sont obligatoires",
+		"challenge window must be at least 1":                             "la fenêtre de défi doit être d'au moins 1",
+		"response deadline must be at least 1 day":                        "le délai de réponse doit être d'au moins 1 jour",
+		"unknown scoring format: %d":                                      "format de score inconnu : %d",
+		"unknown decay policy: %d":                                        "règle de déclin inconnue : %d",
+		"decay period must be at least 1 day":                             "la période de déclin doit être d'au moins 1 jour",
+		"league points cannot be negative":                                "les points de ligue ne peuvent pas être négatifs",
+		"unknown time zone %q":                                            "fuseau horaire inconnu %q",
+		"entry deadline cannot be negative":                               "le délai de saisie ne peut pas être négatif",
+		"qualification matches cannot be negative":                        "le nombre de matchs de qualification ne peut pas être négatif",
+		"protection must end after it starts":                             "la protection doit se terminer après son début",
+		"protection dates must look like 2024-07-01":                      "les dates de protection doivent ressembler à 2024-07-01",
+		"players can only act for themselves":                             "les joueurs ne peuvent agir que pour eux-mêmes",
+		"%s is protected from challenges through %s":                      "%s est protégé des défis jusqu'au %s inclus",
+		"a session needs a name":                                          "une séance doit avoir un nom",
+		"session %q is still open":                                        "la séance %q est encore ouverte",
+		"no open session %q":                                              "aucune séance ouverte %q",
+		"session not found":                                               "séance introuvable",
+		"no players to record":                                            "aucun joueur à enregistrer",
+		"maximum players cannot be negative":                              "le nombre maximal de joueurs ne peut pas être négatif",
+		"the ladder is full at %d players; join the waiting list instead": "le classement est complet avec %d joueurs ; inscrivez-vous plutôt sur la liste d'attente",
+		"the ladder has room; join it directly":                           "le classement a encore de la place ; rejoignez-le directement",
+		"already on the waiting list":                                     "déjà sur la liste d'attente",
+		"not on the waiting list":                                         "absent de la liste d'attente",
+		"unknown join policy: %d":                                         "règle d'inscription inconnue : %d",
+		"unknown join position: %d":                                       "position d'arrivée inconnue : %d",
+		"unknown transaction type: %s":                                    "type de transaction inconnu : %s",
+		"only an admin can add players to this ladder":                    "seul un administrateur peut ajouter des joueurs à ce classement",
+		"already asked to join":                                           "demande d'inscription déjà envoyée",
+		"no request to join from %s":                                      "aucune demande d'inscription de %s",
+		"player %s is not on the ladder":                                  "le joueur %s n'est pas au classement",
+		"team_size must be at least 1":                                    "team_size doit valoir au moins 1",
+		"more players are included than fit in the team":                  "plus de joueurs sont inclus que l'équipe ne peut en compter",
+		"player %s is both included and excluded":                         "le joueur %s est à la fois inclus et exclu",
+		"date must look like 2024-03-02":                                  "la date doit ressembler à 2024-03-02",
+		"a team needs a name":                                             "une équipe doit avoir un nom",
+		"team not found: %s":                                              "équipe introuvable : %s",
+		"player %s is listed twice":                                       "le joueur %s figure deux fois dans la liste",
+		"a fixture needs an opponent":                                     "une rencontre doit avoir un adversaire",
+		"a fixture needs at least one rubber":                             "une rencontre doit comporter au moins un match",
+		"rubber positions must be distinct and start at 1":                "les positions des matchs doivent être distinctes et commencer à 1",
+		"rubber %d has no scores":                                         "le match %d n'a pas de score",
+		"challenger and defender must be two different players":           "le challenger et le défenseur doivent être deux joueurs différents",
+		"live match not found: %s":                                        "match en direct introuvable : %s",
+		"there is no point to take back":                                  "il n'y a aucun point à annuler",
+		"a point needs a winner":                                          "un point doit avoir un gagnant",
+		"%s is not playing this match":                                    "%s ne joue pas ce match",
+		"set duration cannot be negative":                                 "la durée du set ne peut pas être négative",
+		"set %d: every point needs a winner":                              "set %d : chaque point doit avoir un gagnant",
+		"set %d: the points add up to %d-%d but the score is %d-%d":       "set %d : les points donnent %d-%d mais le score est %d-%d",
+		"match not found: %s":                                             "match introuvable : %s",
+		"attachment not found: %s":                                        "pièce jointe introuvable : %s",
+		"only the players of a match can attach files to it":              "seuls les joueurs d'un match peuvent y joindre des fichiers",
+		"a match can have at most %d attachments":                         "un match peut avoir au plus %d pièces jointes",
+		"attachments must be a JPEG, PNG or WebP image or a PDF":          "les pièces jointes doivent être une image JPEG, PNG ou WebP ou un PDF",
+		"invalid set score %q; expected e.g. 11-5":                        "score de set %q invalide ; attendu par ex. 11-5",
+		"no set scores found":                                             "aucun score de set trouvé",
+		"give either set_scores or scores_string, not both":               "indiquez soit set_scores soit scores_string, pas les deux",
+		"until must be in the future":                                     "la fin doit être dans le futur",
+		"you can look for a game for at most %d hours":                    "vous pouvez chercher un match pendant %d heures au plus",
+		"until must be an RFC 3339 time with an offset, e.g. 2024-03-02T19:30:00+01:00": "la fin doit être une heure RFC 3339 avec décalage, par ex. 2024-03-02T19:30:00+01:00",
+
+		// Players and results
+		"player ID already exists":          "cet identifiant de joueur existe déjà",
+		"player not found":                  "joueur introuvable",
+		"player not found: %s":              "joueur introuvable : %s",
+		"challenger or defender not found":  "challenger ou défenseur introuvable",
+		"winner must be one of the players": "le vainqueur doit être l'un des joueurs",
+		"played_at must be an RFC 3339 time with an offset, e.g. 2024-03-02T19:30:00+01:00":      "played_at doit être une heure RFC 3339 avec son décalage, par ex. 2024-03-02T19:30:00+01:00",
+		"played_at cannot be in the future":                                                      "played_at ne peut pas être dans le futur",
+		"results must be entered within %d days of being played; ask an admin to enter this one": "les résultats doivent être saisis dans les %d jours suivant le match ; demandez à un administrateur de saisir celui-ci",
+		"only an admin can override the entry deadline":                                          "seul un administrateur peut passer outre le délai de saisie",
+		"only an admin can insert a result retroactively":                                        "seul un administrateur peut insérer un résultat rétroactivement",
+		"retroactive_insert needs played_at":                                                     "retroactive_insert nécessite played_at",
+		"a friendly moves nobody, so it cannot be inserted retroactively":                        "un match amical ne déplace personne et ne peut donc pas être inséré rétroactivement",
+		"%s is ranked above %s; set reversal_override to record a friendly reversal":             "%s est classé au-dessus de %s ; utilisez reversal_override pour enregistrer un défi inversé amical",
+
+		// Notification preferences
+		"invalid email address": "adresse e-mail invalide",
+		"telegram_chat_id must be numeric; the bot's /myid command shows it": "telegram_chat_id doit être numérique ; la commande /myid du bot l'affiche",
+		"an email address is needed for email notifications":                 "une adresse e-mail est nécessaire pour les notifications par e-mail",
+		"a Telegram chat ID is needed for Telegram notifications":            "un identifiant de discussion Telegram est nécessaire pour les notifications Telegram",
+		"unsupported locale %q":                                   "langue non prise en charge %q",
+		"phone must be in international form, e.g. +447700900123": "le numéro de téléphone doit être au format international, par ex. +447700900123",
+		"that phone number is linked to another player":           "ce numéro de téléphone est déjà lié à un autre joueur",
+
+		// Notifications
+		"Result recorded":                "Résultat enregistré",
+		"%s beat %s (%s)":                "%s bat %s (%s)",
+		"Ladder update":                  "Mise à jour du classement",
+		"You moved up to #%d (from #%d)": "Vous montez à la place n°%d (auparavant n°%d)",
+		"You dropped to #%d (from #%d)":  "Vous descendez à la place n°%d (auparavant n°%d)",
+
+		// Weekly digest
+		"Your week on the ladder":                "Votre semaine au classement",
+		"You are #%d, up 1 place this week.":     "Vous êtes n°%d, 1 place de mieux cette semaine.",
+		"You are #%d, up %d places this week.":   "Vous êtes n°%d, %d places de mieux cette semaine.",
+		"You are #%d, down 1 place this week.":   "Vous êtes n°%d, 1 place de moins cette semaine.",
+		"You are #%d, down %d places this week.": "Vous êtes n°%d, %d places de moins cette semaine.",
+		"You are #%d, unchanged this week.":      "Vous êtes n°%d, sans changement cette semaine.",
+		"No matches this week.":                  "Aucun match cette semaine.",
+		"Matches this week:":                     "Matchs de la semaine :",
+		"2 Jan":                                  "2/1", // Date layout of a match
+		"Who to play next: %s":                   "Prochains adversaires possibles : %s",
+	},
+}
+
+// tr returns the translation of an English format string, or the string itself when
+// locale is English, empty or missing it
+func tr(locale, format string) string {
+	if t, ok := catalog[locale][format]; ok {
+		return t
+	}
+	return format
+}
+
+// trf formats a message in locale
+func trf(locale, format string, args ...interface{}) string {
+	return fmt.Sprintf(tr(locale, format), args...)
+}
+
+// localizedError is an error whose message is in the catalog. Its Error method gives
+// the English message; the locale interceptor replaces it with the caller's language.
+type localizedError struct {
+	code   codes.Code
+	format string
+	args   []interface{}
+}
+
+// localizedErrorf returns an error with a catalog message
+func localizedErrorf(format string, args ...interface{}) error {
+	return &localizedError{code: codes.Unknown, format: format, args: args}
+}
+
+// localizedStatusf returns an error with a catalog message and a gRPC status code
+func localizedStatusf(code codes.Code, format string, args ...interface{}) error {
+	return &localizedError{code: code, format: format, args: args}
+}
+
+func (e *localizedError) Error() string {
+	return fmt.Sprintf(e.format, e.args...)
+}
+
+// GRPCStatus lets status.Code and status.FromError see the error's code
+func (e *localizedError) GRPCStatus() *status.Status {
+	return status.New(e.code, e.Error())
+}
+
+// In returns the message in locale
+func (e *localizedError) In(locale string) string {
+	return trf(locale, e.format, e.args...)
+}
+
+// supportedLocale returns the supported locale for a language tag such as "de" or
+// "fr-CH", or "" if the language is not supported
+func supportedLocale(tag string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	for _, l := range supportedLocales {
+		if l == lang {
+			return l
+		}
+	}
+	return ""
+}
+
+// parseAcceptLanguage returns the supported locale the client prefers most in an
+// Accept-Language header, or "" if it accepts none of them
+func parseAcceptLanguage(header string) string {
+	type choice struct {
+		locale string
+		q      float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if l := supportedLocale(tag); l != "" && q > 0 {
+			choices = append(choices, choice{l, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	if len(choices) == 0 {
+		return ""
+	}
+	return choices[0].locale
+}
+
+// requestLocale chooses the language for a request: the calling player's chosen
+// language, then the client's Accept-Language header, then the server default
+func (h *LadderService) requestLocale(ctx context.Context) string {
+	if claims, ok := ctx.Value(playerClaimsKey{}).(*playerClaims); ok && h.notifier != nil {
+		if l := h.notifier.store.Locale(claims.ClubID, claims.PlayerID); l != "" {
+			return l
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("accept-language") {
+		if l := parseAcceptLanguage(v); l != "" {
+			return l
+		}
+	}
+	return h.locale
+}
+
+// localeUnaryInterceptor translates catalog errors into the caller's language. It must
+// run after the player and club interceptors, so the caller is known.
+func (h *LadderService) localeUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		var lErr *localizedError
+		if errors.As(err, &lErr) {
+			return resp, status.Error(lErr.code, lErr.In(h.requestLocale(ctx)))
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCatalog_KeepsVerbs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+	for locale, messages := range catalog {
+		if supportedLocale(locale) != locale {
+			t.Errorf("catalog locale %q is not supported", locale)
+		}
+		for en, translated := range messages {
+			if got, want := verbs.FindAllString(translated, -1), verbs.FindAllString(en, -1); len(got) != len(want) {
+				t.Errorf("%s: %q has verbs %v, want %v", locale, translated, got, want)
+			}
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"de", "de"},
+		{"fr-CH, fr;q=0.9, en;q=0.8", "fr"},
+		{"nl, en;q=0.5, de;q=0.7", "de"},
+		{"es, it", ""},
+		{"de;q=0, en", "en"},
+		{"DE-de", "de"},
+	}
+	for _, tt := range tests {
+		if got := parseAcceptLanguage(tt.header); got != tt.want {
+			t.Errorf("parseAcceptLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestLocaleUnaryInterceptor(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	svc := NewLadderService(m)
+	store, _ := NewNotificationStore(filepath.Join(t.TempDir(), notificationStoreFile))
+	svc.notifier = NewNotifier(store)
+	interceptor := svc.localeUnaryInterceptor()
+	addResult := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return svc.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+			ChallengerId: "bob", DefenderId: "alice",
+			SetScores: []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 10}},
+		})
+	}
+	call := func(ctx context.Context) error {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, addResult)
+		return err
+	}
+
+	if err := call(context.Background()); status.Convert(err).Message() != "must win by 2 points: 11-10" {
+		t.Errorf("expected the English message without a preference, got %v", err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "fr-FR,fr;q=0.9"))
+	err := call(ctx)
+	if status.Code(err) != codes.Unknown || status.Convert(err).Message() != "un set se gagne avec 2 points d'écart : 11-10" {
+		t.Errorf("expected the French message, got %v", err)
+	}
+
+	// A player's chosen language wins over the browser's
+	store.Update("", "bob", nil, "", "", "de")
+	playerCtx := context.WithValue(ctx, playerClaimsKey{}, &playerClaims{PlayerID: "bob"})
+	if err := call(playerCtx); status.Convert(err).Message() != "ein Satz muss mit 2 Punkten Vorsprung gewonnen werden: 11-10" {
+		t.Errorf("expected the German message, got %v", err)
+	}
+
+	// Status codes survive translation
+	_, err = interceptor(playerCtx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return svc.UpdateNotificationPreferences(ctx, &ladderpb.UpdateNotificationPreferencesRequest{Locale: "xx"})
+	})
+	if status.Code(err) != codes.InvalidArgument || status.Convert(err).Message() != `nicht unterstützte Sprache "xx"` {
+		t.Errorf("expected a German InvalidArgument, got %v", err)
+	}
+
+	svc.locale = "fr"
+	if err := call(context.Background()); status.Convert(err).Message() != "un set se gagne avec 2 points d'écart : 11-10" {
+		t.Errorf("expected the server default, got %v", err)
+	}
+}
+
+func TestLocalizedNotifications(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	store, _ := NewNotificationStore(filepath.Join(t.TempDir(), notificationStoreFile))
+	notifier := NewNotifier(store)
+	var emails chan sentEmail
+	notifier.email, emails = testEmail(t)
+	notifier.locale = "fr"
+	rankByEmail := []*ladderpb.NotificationPreference{{
+		Event:    ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED,
+		Channels: []ladderpb.NotificationChannel{ladderpb.NotificationChannel_CHANNEL_EMAIL},
+	}}
+	store.Update("", "alice", rankByEmail, "alice@example.org", "", "")
+	store.Update("", "bob", rankByEmail, "bob@example.org", "", "de")
+	notifier.Attach("", m)
+
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	want := map[string]string{
+		"alice@example.org": "Vous descendez à la place n°2 (auparavant n°1)",
+		"bob@example.org":   "Du bist auf Platz 1 aufgestiegen (von Platz 2)",
+	}
+	for range want {
+		select {
+		case e := <-emails:
+			if !strings.Contains(e.msg, want[e.to]) {
+				t.Errorf("expected %q in the email to %s, got %q", want[e.to], e.to, e.msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected an email")
+		}
+	}
+
+	dash, err := m.Dashboard("bob", 7, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{"alice": "Alice", "bob": "Bob"}
+	text := digestText("de", dash, names, time.Now())
+	wantDigest := "Du bist auf Platz 1, diese Woche 1 Platz nach oben.\nSpiele dieser Woche:\n  " + time.Now().Format("2.1.") + ": Bob schlägt Alice (11-0, 11-0, 11-0)"
+	if !strings.HasPrefix(text, wantDigest) {
+		t.Errorf("unexpected digest %q", text)
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+var (
+	integrityChecksRun     = expvar.NewInt("integrity_checks_run")
+	integrityCheckFailures = expvar.NewInt("integrity_check_failures")
+)
+
+// SnapshotMismatch describes a transaction whose stored PlayerList does not match the replayed state
+type SnapshotMismatch struct {
+	Index         int // Zero-based position of the transaction in the log
+	TransactionID string
+	Type          storagepb.TransactionType
+	Reason        string
+}
+
+// IntegrityReport is the outcome of replaying the log against its stored snapshots
+type IntegrityReport struct {
+	TransactionsChecked int
+	Mismatches          []SnapshotMismatch
+	Repaired            bool
+	CheckedAt           time.Time
+}
+
+// OK reports whether every snapshot matched the replayed state
+func (r *IntegrityReport) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+// VerifyLog replays the whole log from the start and compares each transaction's
+// stored PlayerList with the recomputed state. If repair is true and divergences
+// were found, the log is rewritten with the recomputed snapshots.
+func (m *Model) VerifyLog(ctx context.Context, repair bool) (*IntegrityReport, error) {
+	if repair {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	} else {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+	}
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{TransactionsChecked: len(txs), CheckedAt: m.now()}
+	expected, err := replay.Snapshots(ctx, txs, func(i int, reason string) {
+		report.Mismatches = append(report.Mismatches, SnapshotMismatch{
+			Index:         i,
+			TransactionID: txs[i].Id,
+			Type:          txs[i].Type,
+			Reason:        reason,
+		})
+	})
+	if err != nil {
+		return nil, contextErr(ctx)
+	}
+
+	for i, t := range txs {
+		if reason := comparePlayers(expected[i], storageToLadder(t.PlayerList)); reason != "" {
+			report.Mismatches = append(report.Mismatches, SnapshotMismatch{
+				Index:         i,
+				TransactionID: t.Id,
+				Type:          t.Type,
+				Reason:        reason,
+			})
+			if repair {
+				t.PlayerList = ladderToStorage(expected[i])
+			}
+		}
+	}
+
+	if repair && !report.OK() {
+		if err := m.rewriteLogLocked(txs); err != nil {
+			return report, fmt.Errorf("failed to repair log: %v", err)
+		}
+		report.Repaired = true
+	}
+
+	return report, nil
+}
+
+// comparePlayers returns a description of the first difference between two player lists,
+// or an empty string if they are identical
+func comparePlayers(want, got []*ladderpb.Player) string {
+	if len(want) != len(got) {
+		return fmt.Sprintf("snapshot has %d players, replay has %d", len(got), len(want))
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if w.Id != g.Id || w.Name != g.Name || w.Rank != g.Rank {
+			return fmt.Sprintf("position %d: snapshot has %s (%q, rank %d), replay has %s (%q, rank %d)",
+				i+1, g.Id, g.Name, g.Rank, w.Id, w.Name, w.Rank)
+		}
+		if w.Category != g.Category {
+			return fmt.Sprintf("position %d: snapshot has category %s for %s, replay has %s", i+1, g.Category, g.Id, w.Category)
+		}
+		if w.Handicap != g.Handicap {
+			return fmt.Sprintf("position %d: snapshot has handicap %d for %s, replay has %d", i+1, g.Handicap, g.Id, w.Handicap)
+		}
+		if w.ProtectedFromMs != g.ProtectedFromMs || w.ProtectedUntilMs != g.ProtectedUntilMs {
+			return fmt.Sprintf("position %d: snapshot has a different protection for %s than replay", i+1, g.Id)
+		}
+		if w.Provisional != g.Provisional || w.QualificationMatchesPlayed != g.QualificationMatchesPlayed {
+			return fmt.Sprintf("position %d: snapshot has %s provisional=%v after %d matches, replay has provisional=%v after %d",
+				i+1, g.Id, g.Provisional, g.QualificationMatchesPlayed, w.Provisional, w.QualificationMatchesPlayed)
+		}
+	}
+	return ""
+}
+
+// rewriteLogLocked atomically replaces the log with the given transactions.
+// The caller must hold the write lock.
+func (m *Model) rewriteLogLocked(txs []*storagepb.TransactionStorage) error {
+	// The rewrite chains the log again, so note a chain it papers over
+	if report, err := checkChain(txs); err == nil && !report.Intact() {
+		log.Printf("Rewriting a log whose hash chain was broken at transaction %s: %s", report.BrokenID, report.Reason)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.LogFilePath), filepath.Base(m.LogFilePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := &logEncoder{interval: m.checkpointEvery(), cipher: m.cipher}
+	for _, t := range txs {
+		line, checkpoint, err := enc.encode(t)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := tmp.Write(line); err != nil {
+			tmp.Close()
+			return err
+		}
+		enc.advance(t, line, checkpoint)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), m.LogFilePath); err != nil {
+		return err
+	}
+	m.matches.reset()
+	m.rules.reset()
+	m.waiting.reset()
+	m.encoder = nil
+	return nil
+}
+
+// IntegrityChecker periodically runs VerifyLog and alerts on divergences
+type IntegrityChecker struct {
+	model    *Model
+	interval time.Duration
+	client   *http.Client
+
+	mu         sync.Mutex
+	webhookURL string
+}
+
+// NewIntegrityChecker creates a checker that runs every interval and POSTs
+// failed reports to webhookURL (if set)
+func NewIntegrityChecker(m *Model, interval time.Duration, webhookURL string) *IntegrityChecker {
+	return &IntegrityChecker{
+		model:      m,
+		interval:   interval,
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Start runs the checker in the background until stop is closed
+func (c *IntegrityChecker) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.RunOnce()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// RunOnce performs a single read-only check and alerts on failure
+func (c *IntegrityChecker) RunOnce() *IntegrityReport {
+	integrityChecksRun.Add(1)
+
+	report, err := c.model.VerifyLog(context.Background(), false)
+	if err != nil {
+		integrityCheckFailures.Add(1)
+		log.Printf("Scheduled integrity check failed: %v", err)
+		c.notify(map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+
+	logIntegrityReport(report)
+	if !report.OK() {
+		integrityCheckFailures.Add(1)
+		c.notify(report)
+	}
+	return report
+}
+
+// SetWebhookURL changes where failed reports are sent; "" stops sending them
+func (c *IntegrityChecker) SetWebhookURL(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.webhookURL = url
+}
+
+func (c *IntegrityChecker) notify(payload interface{}) {
+	c.mu.Lock()
+	webhookURL := c.webhookURL
+	c.mu.Unlock()
+	if webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"event":  "integrity_check_failed",
+		"report": payload,
+	})
+	if err != nil {
+		log.Printf("failed to encode integrity webhook: %v", err)
+		return
+	}
+	resp, err := c.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("failed to send integrity webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("integrity webhook returned %s", resp.Status)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_VerifyLog_Clean(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+	txID, _ := m.AddMatchResult("charlie", "alice", "charlie", []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+	})
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+	})
+	if err := m.InvalidateMatchResult(context.Background(), txID); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	m.RemovePlayer("bob")
+
+	report, err := m.VerifyLog(context.Background(), false)
+	if err != nil {
+		t.Fatalf("VerifyLog failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("expected clean log, got mismatches: %+v", report.Mismatches)
+	}
+	if report.TransactionsChecked != 7 {
+		t.Errorf("expected 7 transactions checked, got %d", report.TransactionsChecked)
+	}
+}
+
+func TestModel_VerifyLog_Repair(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	// Simulate a hand edit that swapped the ranks in the last snapshot
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		t.Fatalf("readTransactionsLocked failed: %v", err)
+	}
+	last := txs[len(txs)-1]
+	last.PlayerList[0].Id, last.PlayerList[1].Id = last.PlayerList[1].Id, last.PlayerList[0].Id
+	if err := m.rewriteLogLocked(txs); err != nil {
+		t.Fatalf("rewriteLogLocked failed: %v", err)
+	}
+
+	report, err := m.VerifyLog(context.Background(), false)
+	if err != nil {
+		t.Fatalf("VerifyLog failed: %v", err)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].TransactionID != last.Id {
+		t.Fatalf("expected one mismatch on %s, got %+v", last.Id, report.Mismatches)
+	}
+	if report.Repaired {
+		t.Error("log should not be repaired without the repair flag")
+	}
+
+	report, err = m.VerifyLog(context.Background(), true)
+	if err != nil {
+		t.Fatalf("VerifyLog(repair) failed: %v", err)
+	}
+	if !report.Repaired {
+		t.Error("expected log to be repaired")
+	}
+
+	if players := m.ListPlayers(); players[0].Id != "alice" {
+		t.Errorf("expected alice at rank 1 after repair, got %+v", players[0])
+	}
+	if report, _ := m.VerifyLog(context.Background(), false); !report.OK() {
+		t.Errorf("expected clean log after repair, got %+v", report.Mismatches)
+	}
+}
+
+func TestIntegrityChecker_Webhook(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	txs, _ := m.readTransactionsLocked()
+	txs[1].PlayerList = txs[1].PlayerList[:1]
+	m.rewriteLogLocked(txs)
+
+	received := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+	}))
+	defer srv.Close()
+
+	report := NewIntegrityChecker(m, time.Hour, srv.URL).RunOnce()
+	if report == nil || report.OK() {
+		t.Fatalf("expected a failing report, got %+v", report)
+	}
+
+	select {
+	case body := <-received:
+		if body["event"] != "integrity_check_failed" {
+			t.Errorf("unexpected webhook body: %v", body)
+		}
+	default:
+		t.Error("expected webhook to be called")
+	}
+}
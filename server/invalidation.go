@@ -0,0 +1,482 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"github.com/icza/backscanner"
+)
+
+var invalidationConflicts = expvar.NewInt("invalidation_conflicts")
+
+// errLogChanged means the log no longer matches what an invalidation was planned
+// from, so the plan has to be redone under the write lock
+var errLogChanged = errors.New("transaction log changed while planning")
+
+// invalidationPlan is the state of the ladder without an invalidated transaction,
+// worked out from the log as it stood when end bytes long
+type invalidationPlan struct {
+	players []*ladderpb.Player
+	file    os.FileInfo // The log the plan was made from; rewrites replace the file
+	end     int64       // Its size at the time
+	lastID  string      // ID of the last transaction in it
+
+	// What was replayed, for previews: the players before the replay, the
+	// transactions replayed and those left out, targets included
+	start       []*ladderpb.Player
+	replayed    []*storagepb.TransactionStorage
+	invalidated map[string]bool
+}
+
+// InvalidateMatchResult undoes a transaction by rebuilding the state without it
+func (m *Model) InvalidateMatchResult(ctx context.Context, txID string) error {
+	_, err := m.invalidateTransactions(ctx, []string{txID}, false)
+	return err
+}
+
+// InvalidateMatchResults undoes several match results with one replay and one
+// appended transaction, whose ID it returns
+func (m *Model) InvalidateMatchResults(ctx context.Context, txIDs []string) (string, error) {
+	return m.invalidateTransactions(ctx, txIDs, false)
+}
+
+// InvalidationPreview is the outcome an invalidation would have
+type InvalidationPreview struct {
+	Players  []*ladderpb.Player         // The ladder after it
+	Moved    []*ladderpb.PlayerMovement // Players whose rank it would change, ordered by new rank
+	Affected []*ladderpb.AffectedMatch  // Later matches that would move players differently
+}
+
+// PreviewInvalidation works out what invalidating txIDs would do without writing
+// anything, so an admin can see the consequences first
+func (m *Model) PreviewInvalidation(ctx context.Context, txIDs []string) (*InvalidationPreview, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plan, err := m.planInvalidation(ctx, m.cipher, txIDs, false)
+	if err != nil {
+		return nil, err
+	}
+	// The history as it stands counts only the invalidations already recorded
+	recorded := make(map[string]bool, len(plan.invalidated))
+	for id := range plan.invalidated {
+		recorded[id] = true
+	}
+	for _, id := range txIDs {
+		delete(recorded, id)
+	}
+	before, current, err := winnerPlaces(ctx, plan.start, plan.replayed, recorded)
+	if err != nil {
+		return nil, err
+	}
+	after, _, err := winnerPlaces(ctx, plan.start, plan.replayed, plan.invalidated)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &InvalidationPreview{Players: plan.players, Moved: diffPlayers(current, plan.players).Moved}
+	order, _ := replay.Order(plan.replayed, plan.invalidated)
+	for _, t := range order {
+		p := t.GetMatchResultPayload()
+		if p == nil || before[t.Id] == after[t.Id] {
+			continue
+		}
+		loser := p.ChallengerId
+		if p.WinnerId == p.ChallengerId {
+			loser = p.DefenderId
+		}
+		preview.Affected = append(preview.Affected, &ladderpb.AffectedMatch{
+			TransactionId:  t.Id,
+			WinnerId:       p.WinnerId,
+			LoserId:        loser,
+			PlacesRecorded: before[t.Id],
+			PlacesReplayed: after[t.Id],
+		})
+	}
+	return preview, nil
+}
+
+// winnerPlaces replays txs on players as Replay does and returns how many places
+// the winner of each match went up, with the players at the end
+func winnerPlaces(ctx context.Context, players []*ladderpb.Player, txs []*storagepb.TransactionStorage, invalidated map[string]bool) (map[string]int32, []*ladderpb.Player, error) {
+	order, err := replay.Order(txs, invalidated)
+	if err != nil {
+		return nil, nil, err
+	}
+	places := make(map[string]int32)
+	for i, t := range order {
+		if i%contextCheckInterval == 0 {
+			if err := contextErr(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+		if p := t.GetMatchResultPayload(); p != nil {
+			winner, loser := -1, -1
+			for j, pl := range players {
+				switch {
+				case pl.Id == p.WinnerId:
+					winner = j
+				case pl.Id == p.ChallengerId || pl.Id == p.DefenderId:
+					loser = j
+				}
+			}
+			// Qualification matches move nobody
+			if winner > loser && loser >= 0 && !players[winner].Provisional && !players[loser].Provisional {
+				places[t.Id] = int32(winner - loser)
+			}
+		}
+		next, err := replay.Apply(t.Type, replay.Payload(t), players)
+		if err != nil {
+			return nil, nil, fmt.Errorf("replay failed at tx %s: %v", t.Id, err)
+		}
+		players = next
+	}
+	return places, players, nil
+}
+
+// invalidateTransactions replays the log without txIDs while other reads and writes
+// carry on, then takes the write lock only to append the invalidation. Transactions
+// appended in the meantime are replayed on top of the plan; if the log was rewritten
+// or another invalidation got in first, the plan is redone under the lock.
+func (m *Model) invalidateTransactions(ctx context.Context, txIDs []string, anyType bool) (string, error) {
+	m.mu.RLock()
+	cipher := m.cipher
+	m.mu.RUnlock()
+
+	plan, err := m.planInvalidation(ctx, cipher, txIDs, anyType)
+	if err != nil && !errors.Is(err, errLogChanged) {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if plan != nil {
+		id, err := m.commitInvalidationLocked(ctx, plan, txIDs, true)
+		if !errors.Is(err, errLogChanged) {
+			return id, err
+		}
+		invalidationConflicts.Add(1)
+	}
+	return m.invalidateTransactionsLocked(ctx, txIDs, anyType)
+}
+
+// invalidateTransactionsLocked rebuilds the state without txIDs and appends the
+// invalidation, returning its ID. Unless anyType is set only match results can be
+// invalidated. Nothing is written if ctx is done before the replay finishes. The
+// caller must hold the write lock.
+func (m *Model) invalidateTransactionsLocked(ctx context.Context, txIDs []string, anyType bool) (string, error) {
+	plan, err := m.planInvalidation(ctx, m.cipher, txIDs, anyType)
+	if err != nil {
+		return "", err
+	}
+	return m.commitInvalidationLocked(ctx, plan, txIDs, false)
+}
+
+// planInvalidation scans the log back to the earliest of txIDs, and past anything
+// invalidated or retroactively inserted since, and replays what followed without them. It only reads the log, so it needs no lock;
+// it returns errLogChanged if it catches an append half written.
+func (m *Model) planInvalidation(ctx context.Context, c *logCipher, txIDs []string, anyType bool) (*invalidationPlan, error) {
+	if len(txIDs) == 0 {
+		return nil, fmt.Errorf("no transactions to invalidate")
+	}
+	// Targets the scan has not reached yet
+	remaining := make(map[string]bool, len(txIDs))
+	for _, id := range txIDs {
+		if remaining[id] {
+			return nil, fmt.Errorf("transaction %s listed twice", id)
+		}
+		remaining[id] = true
+	}
+
+	file, err := os.Open(m.LogFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	plan := &invalidationPlan{file: stat, end: stat.Size()}
+	if plan.end > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, plan.end-1); err != nil {
+			return nil, err
+		}
+		if last[0] != '\n' {
+			return nil, errLogChanged
+		}
+	}
+
+	scanner := backscanner.New(file, int(plan.end))
+
+	var replayStack []*storagepb.TransactionStorage
+	invalidatedIds := make(map[string]bool)
+	// Transactions invalidated after the point the scan has reached still count in the
+	// snapshots before them, so the replay has to start before all of them
+	pending := make(map[string]bool)
+	currentPlayers := []*ladderpb.Player{}
+
+	// Scan backwards to the target transactions and past anything invalidated since
+	for scanned := 0; ; scanned++ {
+		if scanned%contextCheckInterval == 0 {
+			if err := contextErr(ctx); err != nil {
+				return nil, err
+			}
+		}
+		line, _, err := scanner.Line()
+		if err != nil {
+			if err.Error() == "EOF" {
+				break
+			}
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		t, err := decodeLogLine([]byte(line), c)
+		if err != nil {
+			return nil, err
+		}
+		if plan.lastID == "" {
+			plan.lastID = t.Id
+		}
+
+		if remaining[t.Id] {
+			if t.Type == storagepb.TransactionType_INVALIDATE_MATCH {
+				return nil, fmt.Errorf("cannot invalidate an invalidation")
+			}
+			if irreversible(t.Type) {
+				return nil, fmt.Errorf("cannot invalidate %s, which rewrote the log", t.Type)
+			}
+			if !anyType && t.GetMatchResultPayload() == nil {
+				return nil, fmt.Errorf("can only invalidate match results")
+			}
+			if invalidatedIds[t.Id] {
+				return nil, fmt.Errorf("transaction already invalidated")
+			}
+			delete(remaining, t.Id)
+		}
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidatedIds[id] = true
+				pending[id] = true
+			}
+		}
+		// A retroactive match changes the history from where it was inserted
+		if t.Type == storagepb.TransactionType_RETROACTIVE_MATCH {
+			pending[t.GetMatchResultPayload().GetInsertBeforeId()] = true
+		}
+		delete(pending, t.Id)
+		replayStack = append(replayStack, t)
+
+		if len(remaining) == 0 && len(pending) == 0 {
+			// The player state before the replay is the list after the previous
+			// transaction (which is next in backward scan)
+			prevPlayers, _, err := scanBackToCheckpoint(scanner, c)
+			if err != nil {
+				return nil, err
+			}
+			currentPlayers = storageToLadder(prevPlayers)
+			break
+		}
+	}
+
+	if len(remaining) > 0 {
+		return nil, fmt.Errorf("transaction not found")
+	}
+
+	// Replay, oldest first, without the targets and the transactions invalidated since
+	for i, j := 0, len(replayStack)-1; i < j; i, j = i+1, j-1 {
+		replayStack[i], replayStack[j] = replayStack[j], replayStack[i]
+	}
+	for _, id := range txIDs {
+		invalidatedIds[id] = true
+	}
+	plan.start, plan.replayed, plan.invalidated = currentPlayers, replayStack, invalidatedIds
+	plan.players, err = replay.Replay(ctx, currentPlayers, replayStack, invalidatedIds)
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// commitInvalidationLocked appends the invalidation of txIDs planned by plan and
+// returns its ID. If allowTail is set, transactions appended since the plan was made
+// are replayed on top of it. It returns errLogChanged if the log is not the one the
+// plan was made from followed by such transactions. The caller must hold the write
+// lock.
+func (m *Model) commitInvalidationLocked(ctx context.Context, plan *invalidationPlan, txIDs []string, allowTail bool) (string, error) {
+	file, err := os.Open(m.LogFilePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !os.SameFile(plan.file, stat) || stat.Size() < plan.end {
+		return "", errLogChanged
+	}
+	if stat.Size() > plan.end && !allowTail {
+		return "", errLogChanged
+	}
+
+	// The log must still end where the plan's did, at the same transaction
+	scanner := backscanner.New(file, int(plan.end))
+	for {
+		line, _, err := scanner.Line()
+		if err != nil {
+			return "", errLogChanged
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		t, err := decodeLogLine([]byte(line), m.cipher)
+		if err != nil || t.Id != plan.lastID {
+			return "", errLogChanged
+		}
+		break
+	}
+
+	var tail []*storagepb.TransactionStorage
+	lines := bufio.NewScanner(io.NewSectionReader(file, plan.end, stat.Size()-plan.end))
+	lines.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			continue
+		}
+		t, err := decodeLogLine([]byte(line), m.cipher)
+		if err != nil {
+			return "", errLogChanged
+		}
+		// Another invalidation or a retroactive match may change what has to be replayed
+		if t.Type == storagepb.TransactionType_INVALIDATE_MATCH || t.Type == storagepb.TransactionType_RETROACTIVE_MATCH {
+			return "", errLogChanged
+		}
+		tail = append(tail, t)
+	}
+	if err := lines.Err(); err != nil {
+		return "", err
+	}
+
+	currentPlayers, err := replay.Replay(ctx, plan.players, tail, nil)
+	if err := contextErr(ctx); err != nil {
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_INVALIDATE_MATCH,
+		TimestampMs: m.now().UnixMilli(),
+		Payload: &storagepb.TransactionStorage_InvalidateMatchPayload{InvalidateMatchPayload: &storagepb.InvalidateMatchStorage{
+			InvalidatedTransactionId:      txIDs[0],
+			AlsoInvalidatedTransactionIds: txIDs[1:],
+		}},
+		PlayerList: ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	return tx.Id, nil
+}
+
+// UndoLastTransaction invalidates the most recent transaction that can be undone: any
+// type but invalidations, erasures and renames, that has not already been invalidated.
+// It returns the undone transaction. Like
+// InvalidateMatchResult it replays without the write lock, and starts again under
+// the lock if anything was written in the meantime.
+func (m *Model) UndoLastTransaction(ctx context.Context) (*storagepb.TransactionStorage, string, error) {
+	m.mu.RLock()
+	txs, err := m.readTransactionsContextLocked(ctx)
+	cipher := m.cipher
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if target := lastUndoable(txs); target != nil {
+		plan, err := m.planInvalidation(ctx, cipher, []string{target.Id}, true)
+		if err != nil && !errors.Is(err, errLogChanged) {
+			return nil, "", err
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// The plan must be of the log the target was chosen from
+		if plan != nil && plan.lastID == txs[len(txs)-1].Id {
+			id, err := m.commitInvalidationLocked(ctx, plan, []string{target.Id}, false)
+			if !errors.Is(err, errLogChanged) {
+				if err != nil {
+					return nil, "", err
+				}
+				return target, id, nil
+			}
+		}
+		invalidationConflicts.Add(1)
+	} else {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+
+	if txs, err = m.readTransactionsContextLocked(ctx); err != nil {
+		return nil, "", err
+	}
+	target := lastUndoable(txs)
+	if target == nil {
+		return nil, "", fmt.Errorf("nothing to undo")
+	}
+	invalidationID, err := m.invalidateTransactionsLocked(ctx, []string{target.Id}, true)
+	if err != nil {
+		return nil, "", err
+	}
+	return target, invalidationID, nil
+}
+
+// irreversible reports whether transactions of a type rewrote the log when they were
+// recorded. Erasures and renames replaced names throughout it, so invalidating them
+// could not bring the old names back.
+func irreversible(t storagepb.TransactionType) bool {
+	return t == storagepb.TransactionType_ERASE_PLAYER || t == storagepb.TransactionType_RENAME_PLAYERS
+}
+
+// lastUndoable returns the most recent transaction that is not an invalidation or
+// irreversible and has not been invalidated, or nil if there is none
+func lastUndoable(txs []*storagepb.TransactionStorage) *storagepb.TransactionStorage {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+	for i := len(txs) - 1; i >= 0; i-- {
+		if t := txs[i]; t.Type != storagepb.TransactionType_INVALIDATE_MATCH && !irreversible(t.Type) && !invalidated[t.Id] {
+			return t
+		}
+	}
+	return nil
+}
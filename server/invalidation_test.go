@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var threeLove = []*ladderpb.SetScore{
+	{ChallengerPoints: 11, DefenderPoints: 5},
+	{ChallengerPoints: 11, DefenderPoints: 5},
+	{ChallengerPoints: 11, DefenderPoints: 5},
+}
+
+func TestModel_CommitInvalidation_ReplaysAppendsSincePlan(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	txID, _ := m.AddMatchResult("bob", "alice", "bob", threeLove)
+
+	plan, err := m.planInvalidation(ctx, nil, []string{txID}, false)
+	if err != nil {
+		t.Fatalf("planInvalidation failed: %v", err)
+	}
+
+	// Written while the plan was being made
+	m.AddMatchResult("carol", "bob", "carol", threeLove)
+	assertOrder(t, m, "carol", "bob", "alice")
+
+	m.mu.Lock()
+	_, err = m.commitInvalidationLocked(ctx, plan, []string{txID}, false)
+	if !errors.Is(err, errLogChanged) {
+		t.Errorf("expected errLogChanged without the tail allowed, got %v", err)
+	}
+	_, err = m.commitInvalidationLocked(ctx, plan, []string{txID}, true)
+	m.mu.Unlock()
+	if err != nil {
+		t.Fatalf("commitInvalidationLocked failed: %v", err)
+	}
+
+	// Without Bob's win Carol's moves her above Bob only
+	assertOrder(t, m, "alice", "carol", "bob")
+	if report, err := m.VerifyLog(ctx, false); err != nil || !report.OK() {
+		t.Errorf("expected the log to replay cleanly, got %+v, %v", report, err)
+	}
+}
+
+func TestModel_CommitInvalidation_Conflicts(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	first, _ := m.AddMatchResult("bob", "alice", "bob", threeLove)
+	second, _ := m.AddMatchResult("alice", "bob", "alice", threeLove)
+
+	// Another invalidation got in first
+	plan, err := m.planInvalidation(ctx, nil, []string{second}, false)
+	if err != nil {
+		t.Fatalf("planInvalidation failed: %v", err)
+	}
+	if err := m.InvalidateMatchResult(ctx, first); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	m.mu.Lock()
+	_, err = m.commitInvalidationLocked(ctx, plan, []string{second}, true)
+	m.mu.Unlock()
+	if !errors.Is(err, errLogChanged) {
+		t.Errorf("expected errLogChanged after another invalidation, got %v", err)
+	}
+
+	// The log was rewritten
+	plan, err = m.planInvalidation(ctx, nil, []string{second}, false)
+	if err != nil {
+		t.Fatalf("planInvalidation failed: %v", err)
+	}
+	if _, _, err := m.ErasePlayer(ctx, "bob"); err != nil {
+		t.Fatalf("ErasePlayer failed: %v", err)
+	}
+	m.mu.Lock()
+	_, err = m.commitInvalidationLocked(ctx, plan, []string{second}, true)
+	m.mu.Unlock()
+	if !errors.Is(err, errLogChanged) {
+		t.Errorf("expected errLogChanged after a rewrite, got %v", err)
+	}
+
+	// Redone under the lock, the invalidation still goes through
+	if err := m.InvalidateMatchResult(ctx, second); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	if report, err := m.VerifyLog(ctx, false); err != nil || !report.OK() {
+		t.Errorf("expected the log to replay cleanly, got %+v, %v", report, err)
+	}
+}
+
+func TestModel_InvalidateMatchResult_Concurrent(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	ids := []string{"alice", "bob", "carol", "dave"}
+	for _, id := range ids {
+		m.AddPlayer(id, id)
+	}
+	var matches []string
+	for i := 0; i < 20; i++ {
+		txID, err := m.AddMatchResult(ids[(i+1)%4], ids[i%4], ids[(i+1)%4], threeLove)
+		if err != nil {
+			t.Fatalf("AddMatchResult failed: %v", err)
+		}
+		matches = append(matches, txID)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := m.InvalidateMatchResult(ctx, matches[i*2]); err != nil {
+				t.Errorf("InvalidateMatchResult failed: %v", err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			m.AddMatchResult(ids[i%4], ids[(i+2)%4], ids[i%4], threeLove)
+			m.ListPlayers()
+		}(i)
+	}
+	wg.Wait()
+
+	if report, err := m.VerifyLog(ctx, false); err != nil || !report.OK() {
+		t.Errorf("expected the log to replay cleanly, got %+v, %v", report, err)
+	}
+}
+
+func TestModel_InvalidateMatchResults(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	first, _ := m.AddMatchResult("bob", "alice", "bob", threeLove)
+	second, _ := m.AddMatchResult("carol", "alice", "carol", threeLove)
+	third, _ := m.AddMatchResult("carol", "bob", "carol", threeLove)
+	assertOrder(t, m, "carol", "bob", "alice")
+
+	for _, ids := range [][]string{nil, {first, first}, {first, "missing"}} {
+		if _, err := m.InvalidateMatchResults(ctx, ids); err == nil {
+			t.Errorf("expected invalidating %v to fail", ids)
+		}
+	}
+
+	invID, err := m.InvalidateMatchResults(ctx, []string{third, first})
+	if err != nil {
+		t.Fatalf("InvalidateMatchResults failed: %v", err)
+	}
+	// Only Carol's win over Alice is left
+	assertOrder(t, m, "carol", "alice", "bob")
+	if _, err := m.InvalidateMatchResults(ctx, []string{second, first}); err == nil {
+		t.Error("expected invalidating a match twice to fail")
+	}
+
+	txs, _, err := m.ListTransactions(ctx, 10, "", nil)
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if len(txs) != 7 || txs[0].Id != invID {
+		t.Fatalf("expected one invalidation appended, got %+v", txs)
+	}
+	if txs[0].Invalidates != third || len(txs[0].AlsoInvalidates) != 1 || txs[0].AlsoInvalidates[0] != first {
+		t.Errorf("expected the invalidation to list both matches, got %+v", txs[0])
+	}
+	for _, tx := range txs[1:] {
+		want := ""
+		if tx.Id == first || tx.Id == third {
+			want = invID
+		}
+		if tx.InvalidatedBy != want {
+			t.Errorf("transaction %s: expected invalidated by %q, got %q", tx.Id, want, tx.InvalidatedBy)
+		}
+	}
+	if report, err := m.VerifyLog(ctx, false); err != nil || !report.OK() {
+		t.Errorf("expected the log to replay cleanly, got %+v, %v", report, err)
+	}
+}
+
+func TestModel_PreviewInvalidation(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		m.AddPlayer(name, name)
+	}
+	first, _ := m.AddMatchResult("bob", "alice", "bob", threeLove)
+	second, _ := m.AddMatchResult("carol", "alice", "carol", threeLove)
+	third, _ := m.AddMatchResult("dave", "bob", "dave", threeLove)
+	assertOrder(t, m, "dave", "bob", "carol", "alice")
+
+	preview, err := m.PreviewInvalidation(ctx, []string{first})
+	if err != nil {
+		t.Fatalf("PreviewInvalidation failed: %v", err)
+	}
+	for i, id := range []string{"carol", "alice", "dave", "bob"} {
+		if preview.Players[i].Id != id {
+			t.Fatalf("expected the ladder to become carol, alice, dave, bob, got %v", preview.Players)
+		}
+	}
+	if len(preview.Moved) != 4 || preview.Moved[0].PlayerId != "carol" || preview.Moved[0].FromRank != 3 || preview.Moved[0].ToRank != 1 {
+		t.Errorf("expected everyone to move, carol from 3 to 1 first, got %v", preview.Moved)
+	}
+	// Without Bob's win, Carol jumps two places and Dave only one
+	want := []*ladderpb.AffectedMatch{
+		{TransactionId: second, WinnerId: "carol", LoserId: "alice", PlacesRecorded: 1, PlacesReplayed: 2},
+		{TransactionId: third, WinnerId: "dave", LoserId: "bob", PlacesRecorded: 3, PlacesReplayed: 1},
+	}
+	if len(preview.Affected) != len(want) {
+		t.Fatalf("expected %d affected matches, got %v", len(want), preview.Affected)
+	}
+	for i, w := range want {
+		if !proto.Equal(preview.Affected[i], w) {
+			t.Errorf("affected match %d: expected %v, got %v", i, w, preview.Affected[i])
+		}
+	}
+
+	// Nothing was written
+	assertOrder(t, m, "dave", "bob", "carol", "alice")
+	if txs, _ := m.readTransactionsLocked(); len(txs) != 7 {
+		t.Errorf("expected the preview to write nothing, got %d transactions", len(txs))
+	}
+	if _, err := m.PreviewInvalidation(ctx, []string{"missing"}); err == nil {
+		t.Error("expected previewing a missing transaction to fail")
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/grpc/codes"
+)
+
+// checkJoinPolicy applies the ladder's join policy to a request to add a player or
+// queue them, reporting whether it must wait for approval. Admins may always add.
+func (h *LadderService) checkJoinPolicy(ctx context.Context, m *Model) (bool, error) {
+	if isAdmin(ctx) {
+		return false, nil
+	}
+	rules, err := m.GetLadderRules()
+	if err != nil {
+		return false, err
+	}
+	switch rules.JoinPolicy {
+	case ladderpb.JoinPolicy_JOIN_ADMIN_ONLY:
+		return false, localizedStatusf(codes.PermissionDenied, "only an admin can add players to this ladder")
+	case ladderpb.JoinPolicy_JOIN_APPROVAL_REQUIRED:
+		return true, nil
+	}
+	return false, nil
+}
+
+// joinRequests returns the requests to join that are still awaiting a decision, oldest first
+func joinRequests(txs []*storagepb.TransactionStorage) []*ladderpb.JoinRequest {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	var requests []*ladderpb.JoinRequest
+	settle := func(playerID string) {
+		for i, r := range requests {
+			if r.PlayerId == playerID {
+				requests = append(requests[:i], requests[i+1:]...)
+				return
+			}
+		}
+	}
+	for _, t := range txs {
+		if invalidated[t.Id] {
+			continue
+		}
+		switch p := replay.Payload(t).(type) {
+		case *storagepb.JoinRequestStorage:
+			requests = append(requests, &ladderpb.JoinRequest{
+				PlayerId:      p.PlayerId,
+				Name:          p.Name,
+				Category:      ladderpb.PlayerCategory(p.Category),
+				RequestedAtMs: t.TimestampMs,
+			})
+		case *storagepb.AddPlayerStorage:
+			settle(p.PlayerId)
+		case *storagepb.WaitingListStorage:
+			settle(p.PlayerId)
+		case *storagepb.JoinRejectedStorage:
+			settle(p.PlayerId)
+		}
+	}
+	return requests
+}
+
+// RequestToJoin records a request to join the ladder for an admin to decide
+func (m *Model) RequestToJoin(name, playerID string, category ladderpb.PlayerCategory) (*ladderpb.JoinRequest, error) {
+	if playerID == "" {
+		playerID = m.newID()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	if findPlayer(currentPlayers, playerID) != nil {
+		return nil, localizedErrorf("player ID already exists")
+	}
+	for _, e := range waitingList(txs) {
+		if e.PlayerId == playerID {
+			return nil, localizedStatusf(codes.AlreadyExists, "already on the waiting list")
+		}
+	}
+	for _, r := range joinRequests(txs) {
+		if r.PlayerId == playerID {
+			return nil, localizedStatusf(codes.AlreadyExists, "already asked to join")
+		}
+	}
+
+	payload := &storagepb.JoinRequestStorage{
+		PlayerId: playerID,
+		Name:     name,
+		Category: storagepb.PlayerCategoryStorage(category),
+	}
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_JOIN_REQUEST,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_JoinRequestPayload{JoinRequestPayload: payload},
+		PlayerList:  ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+	return &ladderpb.JoinRequest{PlayerId: playerID, Name: name, Category: category, RequestedAtMs: tx.TimestampMs}, nil
+}
+
+// JoinRequests returns the requests to join awaiting a decision, oldest first
+func (m *Model) JoinRequests() ([]*ladderpb.JoinRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	return joinRequests(txs), nil
+}
+
+// DecideJoinRequest settles a request to join. An approved player is added to the
+// ladder, or to the waiting list if the ladder is full.
+func (m *Model) DecideJoinRequest(playerID string, approve bool) (*ladderpb.DecideJoinRequestResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	var request *ladderpb.JoinRequest
+	for _, r := range joinRequests(txs) {
+		if r.PlayerId == playerID {
+			request = r
+		}
+	}
+	if request == nil {
+		return nil, localizedStatusf(codes.NotFound, "no request to join from %s", playerID)
+	}
+
+	if approve {
+		limit := rulesAt(txs, len(txs)).MaxPlayers
+		if limit > 0 && len(txs[len(txs)-1].PlayerList) >= int(limit) {
+			entry, err := m.joinWaitingListLocked(request.Name, request.PlayerId, request.Category)
+			if err != nil {
+				return nil, err
+			}
+			return &ladderpb.DecideJoinRequestResponse{WaitingListEntry: entry}, nil
+		}
+		player, err := m.addPlayerLocked(request.Name, request.PlayerId, request.Category, false)
+		if err != nil {
+			return nil, err
+		}
+		return &ladderpb.DecideJoinRequestResponse{Player: player}, nil
+	}
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_JOIN_REJECTED,
+		TimestampMs: m.now().UnixMilli(),
+		Payload: &storagepb.TransactionStorage_JoinRejectedPayload{JoinRejectedPayload: &storagepb.JoinRejectedStorage{
+			PlayerId: playerID,
+		}},
+		PlayerList: ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+	return &ladderpb.DecideJoinRequestResponse{}, nil
+}
+
+// ListJoinRequests returns the requests to join awaiting approval
+func (h *LadderService) ListJoinRequests(ctx context.Context, req *ladderpb.ListJoinRequestsRequest) (*ladderpb.ListJoinRequestsResponse, error) {
+	requests, err := h.modelFor(ctx).JoinRequests()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListJoinRequestsResponse{Requests: requests}, nil
+}
+
+// DecideJoinRequest approves or rejects a request to join
+func (h *LadderService) DecideJoinRequest(ctx context.Context, req *ladderpb.DecideJoinRequestRequest) (*ladderpb.DecideJoinRequestResponse, error) {
+	return h.modelFor(ctx).DecideJoinRequest(req.PlayerId, req.Approve)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLadderService_JoinPolicy(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	svc := NewLadderService(m)
+	ctx := context.Background()
+	asAdmin := func(call func(ctx context.Context) error) error {
+		admin := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer secret"))
+		_, err := adminUnaryInterceptor("secret", nil)(admin, nil, &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/AddPlayer"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, call(ctx)
+			})
+		return err
+	}
+	addPlayer := func(ctx context.Context, name, id string) (*ladderpb.AddPlayerResponse, error) {
+		return svc.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: name, PlayerId: id})
+	}
+	setRules := func(policy ladderpb.JoinPolicy, maxPlayers int32) {
+		if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, JoinPolicy: policy, MaxPlayers: maxPlayers}); err != nil {
+			t.Fatalf("SetLadderRules failed: %v", err)
+		}
+	}
+
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, JoinPolicy: 9}); err == nil {
+		t.Error("expected an error for an unknown join policy")
+	}
+
+	setRules(ladderpb.JoinPolicy_JOIN_ADMIN_ONLY, 0)
+	if _, err := addPlayer(ctx, "Bob", "bob"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+	if err := asAdmin(func(ctx context.Context) error { _, err := addPlayer(ctx, "Bob", "bob"); return err }); err != nil {
+		t.Errorf("expected an admin to add players, got %v", err)
+	}
+
+	setRules(ladderpb.JoinPolicy_JOIN_APPROVAL_REQUIRED, 3)
+	resp, err := addPlayer(ctx, "Charlie", "charlie")
+	if err != nil || !resp.PendingApproval {
+		t.Fatalf("expected the request to await approval, got %v, %v", resp, err)
+	}
+	if _, err := addPlayer(ctx, "Charlie", "charlie"); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists for a second request, got %v", err)
+	}
+	addPlayer(ctx, "Dave", "dave")
+	addPlayer(ctx, "Erin", "erin")
+	if len(m.ListPlayers()) != 2 {
+		t.Errorf("expected nobody to join before approval, got %v", m.ListPlayers())
+	}
+
+	decided, err := m.DecideJoinRequest("charlie", true)
+	if err != nil || decided.Player.GetRank() != 3 {
+		t.Fatalf("expected Charlie to be added, got %v, %v", decided, err)
+	}
+	// The ladder is full now, so approval puts Dave on the waiting list
+	decided, err = m.DecideJoinRequest("dave", true)
+	if err != nil || decided.WaitingListEntry.GetPosition() != 1 {
+		t.Fatalf("expected Dave to join the waiting list, got %v, %v", decided, err)
+	}
+	if _, err := m.DecideJoinRequest("erin", false); err != nil {
+		t.Fatalf("DecideJoinRequest failed: %v", err)
+	}
+	if _, err := m.DecideJoinRequest("erin", true); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a settled request, got %v", err)
+	}
+	if requests, _ := m.JoinRequests(); len(requests) != 0 {
+		t.Errorf("expected every request to be settled, got %v", requests)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+const (
+	kioskDefaultRefresh = 30 // seconds
+	kioskRecentLimit    = 6
+)
+
+var kioskTemplate = template.Must(template.New("kiosk").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Squash Ladder</title>
+<style>
+  body { background: #111; color: #eee; font-family: sans-serif; margin: 2vw; font-size: 2.4vw; }
+  h1 { font-size: 4vw; margin: 0 0 1vw; }
+  h2 { font-size: 3vw; color: #9cf; margin: 0 0 1vw; }
+  .cols { display: flex; gap: 4vw; }
+  .standings { flex: 3; }
+  .recent { flex: 2; }
+  table { border-collapse: collapse; width: 100%; }
+  td { padding: 0.4vw 1vw; border-bottom: 1px solid #333; }
+  td.rank { width: 4vw; text-align: right; color: #fc6; font-weight: bold; }
+  ul { list-style: none; padding: 0; margin: 0; }
+  li { padding: 0.4vw 0; border-bottom: 1px solid #333; }
+  .updated { font-size: 1.4vw; color: #777; margin-top: 2vw; }
+</style>
+</head>
+<body>
+<h1>Squash Ladder</h1>
+<div class="cols">
+  <div class="standings">
+    <h2>Standings</h2>
+    {{if .Players}}<table>
+    {{range .Players}}<tr><td class="rank">{{.Rank}}</td><td>{{.Name}}</td></tr>
+    {{end}}</table>{{else}}<p>The ladder is empty.</p>{{end}}
+  </div>
+  <div class="recent">
+    <h2>Recent results</h2>
+    {{if .Recent}}<ul>
+    {{range .Recent}}<li>{{.}}</li>
+    {{end}}</ul>{{else}}<p>No results recorded yet.</p>{{end}}
+  </div>
+</div>
+<div class="updated">Updated {{.Updated}}</div>
+</body>
+</html>
+`))
+
+// KioskHandler renders a self-refreshing standings page for a wall-mounted display
+type KioskHandler struct {
+	service *LadderService
+}
+
+// NewKioskHandler creates a kiosk page handler
+func NewKioskHandler(service *LadderService) *KioskHandler {
+	return &KioskHandler{service: service}
+}
+
+// ServeHTTP renders the page. The refresh interval in seconds can be set with ?refresh=.
+func (k *KioskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	refresh := kioskDefaultRefresh
+	if v := r.URL.Query().Get("refresh"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 5 {
+			http.Error(w, "refresh must be at least 5 seconds", http.StatusBadRequest)
+			return
+		}
+		refresh = n
+	}
+
+	players, err := k.service.ListPlayers(r.Context(), &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	matches, err := k.service.ListRecentMatches(r.Context(), &ladderpb.ListRecentMatchesRequest{Limit: kioskRecentLimit})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	names := make(map[string]string)
+	for _, p := range players.Players {
+		names[p.Id] = p.Name
+	}
+	recent := make([]string, len(matches.Results))
+	for i, mr := range matches.Results {
+		recent[i] = describeMatch(mr, names)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err = kioskTemplate.Execute(w, struct {
+		Refresh int
+		Players []*ladderpb.Player
+		Recent  []string
+		Updated string
+	}{
+		Refresh: refresh,
+		Players: players.Players,
+		Recent:  recent,
+		Updated: time.Now().In(k.service.modelFor(r.Context()).TimeZone()).Format("15:04"),
+	})
+	if err != nil {
+		log.Printf("failed to render kiosk page: %v", err)
+	}
+}
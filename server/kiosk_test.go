@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestKioskHandler(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("<Bob>", "bob")
+	scores := []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 11, DefenderPoints: 7}, {ChallengerPoints: 11, DefenderPoints: 3}}
+	if _, err := m.AddMatchResult("bob", "alice", "bob", scores); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+
+	k := NewKioskHandler(NewLadderService(m))
+
+	rec := httptest.NewRecorder()
+	k.ServeHTTP(rec, httptest.NewRequest("GET", "/kiosk?refresh=10", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<meta http-equiv="refresh" content="10">`,
+		"&lt;Bob&gt;",
+		"&lt;Bob&gt; beat Alice (11-5, 11-7, 11-3)",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page missing %q", want)
+		}
+	}
+	if strings.Contains(body, "<Bob>") {
+		t.Error("player names must be escaped")
+	}
+
+	rec = httptest.NewRecorder()
+	k.ServeHTTP(rec, httptest.NewRequest("GET", "/kiosk?refresh=1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too-short refresh, got %d", rec.Code)
+	}
+}
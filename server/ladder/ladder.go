@@ -0,0 +1,268 @@
+// Package ladder is the squash ladder engine as a Go library, for programs such as
+// a club's membership system that want the ladder without running the network
+// server. It works on the same transaction log as the server, with the same rules,
+// so a ladder can be kept by a program and served by the server in turn.
+package ladder
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"squash-ladder/server"
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// Store says where a ladder keeps its transaction log
+type Store struct {
+	// Path is the log file; it and its directory are created when missing
+	Path string
+	// EncryptionKey encrypts the log as server.Config.LogEncryptionKey does
+	EncryptionKey []byte
+	// Clock and IDs replace the system clock and random UUIDs, for reproducible logs
+	Clock server.Clock
+	IDs   server.IDGenerator
+}
+
+// Ladder is an open ladder. It is safe for concurrent use.
+type Ladder struct {
+	model   *server.Model
+	service *server.LadderService
+}
+
+// Player is a player's place on the ladder
+type Player struct {
+	ID   string
+	Name string
+	Rank int // 1 is the top
+	// Provisional players are still playing qualification matches and are listed
+	// below every ranked player
+	Provisional bool
+}
+
+// Set is the score of one set
+type Set struct {
+	ChallengerPoints int
+	DefenderPoints   int
+}
+
+// Match is a match result
+type Match struct {
+	ID           string // Set when the match is recorded
+	ChallengerID string
+	DefenderID   string
+	WinnerID     string
+	Sets         []Set
+	// PlayedAt is when the match was played, zero for now; RecordedAt is set when it
+	// is recorded
+	PlayedAt   time.Time
+	RecordedAt time.Time
+	// Rating changes from the match, set when it is recorded
+	ChallengerRatingDelta float64
+	DefenderRatingDelta   float64
+}
+
+// PlayerStats sums up a player's valid matches
+type PlayerStats struct {
+	Player Player
+	Played int
+	Won    int
+	Lost   int
+	Rating float64
+}
+
+// New opens the ladder kept in store
+func New(store Store) (*Ladder, error) {
+	if store.Path == "" {
+		return nil, fmt.Errorf("ladder: no log path given")
+	}
+	if err := os.MkdirAll(filepath.Dir(store.Path), 0755); err != nil {
+		return nil, fmt.Errorf("ladder: failed to create data directory: %v", err)
+	}
+	m, err := server.NewModel(store.Path)
+	if err != nil {
+		return nil, err
+	}
+	m.SetClock(store.Clock)
+	m.SetIDGenerator(store.IDs)
+	if store.EncryptionKey != nil {
+		if err := m.SetEncryptionKey(store.EncryptionKey); err != nil {
+			return nil, err
+		}
+		if _, err := m.EncryptLog(); err != nil {
+			return nil, err
+		}
+	}
+	return &Ladder{model: m, service: server.NewLadderService(m)}, nil
+}
+
+// Close flushes pending writes and releases the log
+func (l *Ladder) Close() {
+	l.model.Close()
+}
+
+// Players returns the players in rank order
+func (l *Ladder) Players() []Player {
+	return playersFromProto(l.model.ListPlayers())
+}
+
+// Player returns one player
+func (l *Ladder) Player(id string) (Player, error) {
+	for _, p := range l.Players() {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Player{}, fmt.Errorf("player not found: %s", id)
+}
+
+// AddPlayer adds a player at the bottom of the ladder. An empty id gets a new one.
+func (l *Ladder) AddPlayer(name, id string) (Player, error) {
+	p, err := l.model.AddPlayer(name, id)
+	if err != nil {
+		return Player{}, err
+	}
+	return playerFromProto(p), nil
+}
+
+// RemovePlayer takes a player off the ladder; those below move up
+func (l *Ladder) RemovePlayer(id string) error {
+	return l.model.RemovePlayer(id)
+}
+
+// RecordMatch checks a result against the ladder's rules, as the server does, and
+// records it. It returns the match with its ID, time and rating changes filled in.
+func (l *Ladder) RecordMatch(ctx context.Context, match Match) (Match, error) {
+	req := &ladderpb.AddMatchResultRequest{
+		ChallengerId: match.ChallengerID,
+		DefenderId:   match.DefenderID,
+		WinnerId:     match.WinnerID,
+	}
+	for _, s := range match.Sets {
+		req.SetScores = append(req.SetScores, &ladderpb.SetScore{
+			ChallengerPoints: int32(s.ChallengerPoints),
+			DefenderPoints:   int32(s.DefenderPoints),
+		})
+	}
+	if !match.PlayedAt.IsZero() {
+		req.PlayedAt = match.PlayedAt.Format(time.RFC3339)
+	}
+	resp, err := l.service.AddMatchResult(server.AsAdmin(ctx), req)
+	if err != nil {
+		return Match{}, err
+	}
+
+	recorded, err := l.model.GetTransaction(ctx, resp.TransactionId)
+	if err != nil {
+		return Match{}, err
+	}
+	match.ID = resp.TransactionId
+	match.RecordedAt = time.UnixMilli(recorded.GetSummary().GetTimestampMs())
+	match.ChallengerRatingDelta = resp.ChallengerRatingDelta
+	match.DefenderRatingDelta = resp.DefenderRatingDelta
+	return match, nil
+}
+
+// InvalidateMatch undoes a match result, replaying the ladder without it
+func (l *Ladder) InvalidateMatch(ctx context.Context, id string) error {
+	return l.model.InvalidateMatchResult(ctx, id)
+}
+
+// Matches returns the valid matches played from from up to but excluding to, oldest
+// first
+func (l *Ladder) Matches(ctx context.Context, from, to time.Time) ([]Match, error) {
+	results, _, err := l.model.MatchesBetween(ctx, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]Match, len(results))
+	for i, mr := range results {
+		matches[i] = matchFromProto(mr)
+	}
+	return matches, nil
+}
+
+// RecentMatches returns the last limit valid matches, newest first
+func (l *Ladder) RecentMatches(limit int) ([]Match, error) {
+	results, err := l.model.GetRecentMatches(int32(limit))
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]Match, len(results))
+	for i, mr := range results {
+		matches[i] = matchFromProto(mr)
+	}
+	return matches, nil
+}
+
+// Stats sums up a player's matches and rating
+func (l *Ladder) Stats(ctx context.Context, playerID string) (PlayerStats, error) {
+	p, err := l.Player(playerID)
+	if err != nil {
+		return PlayerStats{}, err
+	}
+	rating, _, err := l.model.GetRatingHistory(ctx, playerID)
+	if err != nil {
+		return PlayerStats{}, err
+	}
+	results, _, err := l.model.MatchesBetween(ctx, 0, math.MaxInt64)
+	if err != nil {
+		return PlayerStats{}, err
+	}
+
+	stats := PlayerStats{Player: p, Rating: rating}
+	for _, mr := range results {
+		if mr.ChallengerId != playerID && mr.DefenderId != playerID {
+			continue
+		}
+		stats.Played++
+		if mr.WinnerId == playerID {
+			stats.Won++
+		} else {
+			stats.Lost++
+		}
+	}
+	return stats, nil
+}
+
+// OnChange calls fn with the new standings after every change to the ladder. Calls
+// run on their own goroutine and may arrive out of order.
+func (l *Ladder) OnChange(fn func([]Player)) {
+	l.model.OnChange(func(c server.LadderChange) {
+		fn(playersFromProto(c.After))
+	})
+}
+
+func playerFromProto(p *ladderpb.Player) Player {
+	return Player{ID: p.Id, Name: p.Name, Rank: int(p.Rank), Provisional: p.Provisional}
+}
+
+func playersFromProto(players []*ladderpb.Player) []Player {
+	out := make([]Player, len(players))
+	for i, p := range players {
+		out[i] = playerFromProto(p)
+	}
+	return out
+}
+
+func matchFromProto(mr *ladderpb.MatchResult) Match {
+	m := Match{
+		ID:                    mr.TransactionId,
+		ChallengerID:          mr.ChallengerId,
+		DefenderID:            mr.DefenderId,
+		WinnerID:              mr.WinnerId,
+		RecordedAt:            time.UnixMilli(mr.TimestampMs),
+		ChallengerRatingDelta: mr.ChallengerRatingDelta,
+		DefenderRatingDelta:   mr.DefenderRatingDelta,
+	}
+	if mr.PlayedAtMs != 0 {
+		m.PlayedAt = time.UnixMilli(mr.PlayedAtMs)
+	}
+	for _, s := range mr.SetScores {
+		m.Sets = append(m.Sets, Set{ChallengerPoints: int(s.ChallengerPoints), DefenderPoints: int(s.DefenderPoints)})
+	}
+	return m
+}
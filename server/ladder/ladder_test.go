@@ -0,0 +1,78 @@
+package ladder
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"squash-ladder/server"
+)
+
+func TestLadder(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	store := Store{
+		Path:  filepath.Join(t.TempDir(), "data", "ladder.jsonl"),
+		Clock: server.NewSteppingClock(start, time.Minute),
+	}
+	l, err := New(store)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer l.Close()
+
+	changes := make(chan []Player, 8)
+	l.OnChange(func(players []Player) { changes <- players })
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if _, err := l.AddPlayer(name, ""); err != nil {
+			t.Fatalf("AddPlayer failed: %v", err)
+		}
+	}
+	players := l.Players()
+	alice, carol := players[0], players[2]
+
+	threeLove := []Set{{11, 5}, {11, 7}, {11, 3}}
+	if _, err := l.RecordMatch(ctx, Match{ChallengerID: carol.ID, DefenderID: alice.ID, WinnerID: alice.ID, Sets: threeLove}); err == nil {
+		t.Error("expected a winner the scores contradict to be refused")
+	}
+	match, err := l.RecordMatch(ctx, Match{ChallengerID: carol.ID, DefenderID: alice.ID, WinnerID: carol.ID, Sets: threeLove})
+	if err != nil {
+		t.Fatalf("RecordMatch failed: %v", err)
+	}
+	if match.ID == "" || match.RecordedAt.Before(start) || match.ChallengerRatingDelta <= 0 {
+		t.Errorf("expected the recorded match to be filled in, got %+v", match)
+	}
+	if top := l.Players()[0]; top.ID != carol.ID || top.Rank != 1 {
+		t.Errorf("expected Carol on top, got %+v", top)
+	}
+
+	recent, err := l.RecentMatches(10)
+	if err != nil || len(recent) != 1 || recent[0].ID != match.ID || len(recent[0].Sets) != 3 {
+		t.Errorf("unexpected recent matches: %+v, %v", recent, err)
+	}
+	stats, err := l.Stats(ctx, carol.ID)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.Played != 1 || stats.Won != 1 || stats.Lost != 0 || stats.Rating <= 1500 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if err := l.InvalidateMatch(ctx, match.ID); err != nil {
+		t.Fatalf("InvalidateMatch failed: %v", err)
+	}
+	if top := l.Players()[0]; top.ID != alice.ID {
+		t.Errorf("expected Alice back on top, got %+v", top)
+	}
+	if matches, err := l.Matches(ctx, start, start.Add(time.Hour)); err != nil || len(matches) != 0 {
+		t.Errorf("expected no valid matches, got %+v, %v", matches, err)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Error("expected OnChange to be called")
+	}
+}
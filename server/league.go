@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"sort"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+// DefaultLeaguePoints awards 3 points for a clear win, 2 for a win in the final set
+// and 1 for losing in the final set
+func DefaultLeaguePoints() *ladderpb.LeaguePoints {
+	return &ladderpb.LeaguePoints{Win: 3, CloseWin: 2, CloseLoss: 1}
+}
+
+func leaguePointsToStorage(p *ladderpb.LeaguePoints) *storagepb.LeaguePointsStorage {
+	if p == nil {
+		return nil
+	}
+	return &storagepb.LeaguePointsStorage{
+		Win:       p.Win,
+		CloseWin:  p.CloseWin,
+		CloseLoss: p.CloseLoss,
+		Loss:      p.Loss,
+		PerSet:    p.PerSet,
+	}
+}
+
+func leaguePointsFromStorage(p *storagepb.LeaguePointsStorage) *ladderpb.LeaguePoints {
+	if p == nil {
+		return DefaultLeaguePoints()
+	}
+	return &ladderpb.LeaguePoints{
+		Win:       p.Win,
+		CloseWin:  p.CloseWin,
+		CloseLoss: p.CloseLoss,
+		Loss:      p.Loss,
+		PerSet:    p.PerSet,
+	}
+}
+
+// setsWon counts the sets each side won on court, with handicaps applied. A set
+// ended by a default is not counted.
+func setsWon(mr *storagepb.MatchResultStorage) (challenger, defender int32) {
+	for _, s := range mr.SetScores {
+		if s.ChallengerDefault || s.DefenderDefault {
+			continue
+		}
+		if s.ChallengerPoints+mr.ChallengerHandicap > s.DefenderPoints+mr.DefenderHandicap {
+			challenger++
+		} else {
+			defender++
+		}
+	}
+	return challenger, defender
+}
+
+// GetLeagueTable ranks players by league points earned from valid matches played
+// between sinceMs and untilMs, scored with the league points in the current rules.
+// Every current player is listed, as is anyone who played in the season and has left.
+func (m *Model) GetLeagueTable(ctx context.Context, sinceMs, untilMs int64) ([]*ladderpb.LeagueStanding, *ladderpb.LeaguePoints, error) {
+	if untilMs == 0 {
+		untilMs = m.now().UnixMilli()
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules := rulesAt(txs, len(txs))
+	scoring := rules.LeaguePoints
+	setsToWin, _ := scoringFormatRules(rules.ScoringFormat)
+
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	standings := make(map[string]*ladderpb.LeagueStanding)
+	standing := func(id string) *ladderpb.LeagueStanding {
+		s, ok := standings[id]
+		if !ok {
+			s = &ladderpb.LeagueStanding{PlayerId: id}
+			standings[id] = s
+		}
+		return s
+	}
+	if len(txs) > 0 {
+		for _, p := range txs[len(txs)-1].PlayerList {
+			standing(p.Id)
+		}
+	}
+
+	for _, t := range txs {
+		mr := t.GetMatchResultPayload()
+		if mr == nil || mr.Friendly || invalidated[t.Id] || playedAtMs(t) < sinceMs || playedAtMs(t) > untilMs {
+			continue
+		}
+
+		cs, ds := setsWon(mr)
+		winner, loser := standing(mr.ChallengerId), standing(mr.DefenderId)
+		ws, ls := cs, ds
+		if mr.WinnerId == mr.DefenderId {
+			winner, loser = loser, winner
+			ws, ls = ds, cs
+		}
+		decider := ws == int32(setsToWin) && ls == ws-1
+
+		winner.Played++
+		winner.Won++
+		winner.SetsWon += ws
+		winner.SetsLost += ls
+		loser.Played++
+		loser.Lost++
+		loser.SetsWon += ls
+		loser.SetsLost += ws
+		if decider {
+			winner.Points += scoring.CloseWin
+			loser.Points += scoring.CloseLoss
+		} else {
+			winner.Points += scoring.Win
+			loser.Points += scoring.Loss
+		}
+		winner.Points += ws * scoring.PerSet
+		loser.Points += ls * scoring.PerSet
+	}
+
+	names := playerNames(txs)
+	table := make([]*ladderpb.LeagueStanding, 0, len(standings))
+	for id, s := range standings {
+		s.Name = names[id]
+		table = append(table, s)
+	}
+	sort.Slice(table, func(i, j int) bool {
+		a, b := table[i], table[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Won != b.Won {
+			return a.Won > b.Won
+		}
+		if a.SetsWon-a.SetsLost != b.SetsWon-b.SetsLost {
+			return a.SetsWon-a.SetsLost > b.SetsWon-b.SetsLost
+		}
+		return a.Name < b.Name
+	})
+	for i, s := range table {
+		s.Position = int32(i + 1)
+	}
+
+	return table, scoring, nil
+}
+
+// GetLeagueTable returns the points table for a season
+func (h *LadderService) GetLeagueTable(ctx context.Context, req *ladderpb.GetLeagueTableRequest) (*ladderpb.GetLeagueTableResponse, error) {
+	table, scoring, err := h.modelFor(ctx).GetLeagueTable(ctx, req.SinceMs, req.UntilMs)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.GetLeagueTableResponse{Standings: table, Scoring: scoring}, nil
+}
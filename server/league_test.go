@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_GetLeagueTable(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+
+	won, lost := &ladderpb.SetScore{ChallengerPoints: 11, DefenderPoints: 5}, &ladderpb.SetScore{ChallengerPoints: 5, DefenderPoints: 11}
+	// Bob beats Alice 3-0, Charlie beats Alice 3-2, Alice beats Charlie 3-1 but it is invalidated,
+	// and she beats him 3-0 in a friendly that earns nothing
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{won, won, won})
+	m.AddMatchResult("charlie", "alice", "charlie", []*ladderpb.SetScore{won, lost, won, lost, won})
+	txID, _ := m.AddMatchResult("alice", "charlie", "alice", []*ladderpb.SetScore{won, lost, won, won})
+	if err := m.InvalidateMatchResult(context.Background(), txID); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	if _, err := m.AddMatchResultAt("alice", "charlie", "alice", []*ladderpb.SetScore{won, won, won}, time.Time{}, false, true); err != nil {
+		t.Fatalf("AddMatchResultAt failed: %v", err)
+	}
+
+	table, scoring, err := m.GetLeagueTable(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatalf("GetLeagueTable failed: %v", err)
+	}
+	if scoring.Win != 3 || scoring.CloseWin != 2 {
+		t.Errorf("expected default scoring, got %+v", scoring)
+	}
+
+	want := []struct {
+		id             string
+		points, played int32
+	}{{"bob", 3, 1}, {"charlie", 2, 1}, {"alice", 1, 2}}
+	if len(table) != len(want) {
+		t.Fatalf("expected %d rows, got %d", len(want), len(table))
+	}
+	for i, w := range want {
+		row := table[i]
+		if row.PlayerId != w.id || row.Points != w.points || row.Played != w.played || row.Position != int32(i+1) {
+			t.Errorf("row %d: expected %s with %d points from %d matches, got %+v", i, w.id, w.points, w.played, row)
+		}
+	}
+	if alice := table[2]; alice.SetsWon != 2 || alice.SetsLost != 6 {
+		t.Errorf("expected alice 2-6 in sets, got %d-%d", alice.SetsWon, alice.SetsLost)
+	}
+
+	// A set bonus rewards the sets Alice took off Charlie
+	rules := DefaultLadderRules()
+	rules.LeaguePoints = &ladderpb.LeaguePoints{Win: 3, PerSet: 1}
+	if _, err := m.SetLadderRules(rules); err != nil {
+		t.Fatalf("SetLadderRules failed: %v", err)
+	}
+	table, _, _ = m.GetLeagueTable(context.Background(), 0, 0)
+	for _, row := range table {
+		if row.PlayerId == "alice" && row.Points != 2 {
+			t.Errorf("expected alice to have 2 set bonus points, got %d", row.Points)
+		}
+	}
+}
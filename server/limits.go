@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults sized for a small host; each can be overridden in Config
+const (
+	// defaultMaxRequestBytes caps gRPC messages and HTTP request bodies. A ratings
+	// import for a few hundred players is well under this.
+	defaultMaxRequestBytes = 1 << 20
+	// defaultRPCTimeout bounds how long a single RPC may run
+	defaultRPCTimeout = 15 * time.Second
+	// defaultHTTPReadTimeout bounds reading a whole request, body included
+	defaultHTTPReadTimeout = 30 * time.Second
+	// defaultHTTPWriteTimeout bounds writing a response; live event streams lift it
+	defaultHTTPWriteTimeout = 60 * time.Second
+
+	httpReadHeaderTimeout = 10 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// orDefault returns v, or def when v is not positive
+func orDefault[T int64 | time.Duration](v, def T) T {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// deadlineUnaryInterceptor gives every RPC a deadline of at most timeout; a shorter
+// deadline sent by the client is kept. When it passes the caller gets DEADLINE_EXCEEDED
+// straight away, though a handler that ignores its context runs on to completion.
+func deadlineUnaryInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		type result struct {
+			resp interface{}
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			resp, err := handler(ctx, req)
+			done <- result{resp, err}
+		}()
+		select {
+		case r := <-done:
+			return r.resp, r.err
+		case <-ctx.Done():
+			return nil, status.Errorf(codes.DeadlineExceeded, "%s did not finish within its deadline", info.FullMethod)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeadlineUnaryInterceptor(t *testing.T) {
+	interceptor := deadlineUnaryInterceptor(50 * time.Millisecond)
+	info := &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/ListPlayers"}
+
+	fast := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the handler to get a deadline")
+		}
+		return "ok", nil
+	}
+	if resp, err := interceptor(context.Background(), nil, info, fast); err != nil || resp != "ok" {
+		t.Errorf("expected the fast handler to succeed, got %v, %v", resp, err)
+	}
+
+	slow := func(ctx context.Context, req interface{}) (interface{}, error) {
+		time.Sleep(time.Second)
+		return "late", nil
+	}
+	start := time.Now()
+	_, err := interceptor(context.Background(), nil, info, slow)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DEADLINE_EXCEEDED, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("expected the caller to be answered at the deadline")
+	}
+}
+
+func TestRun_MaxRequestBytes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ladder_limits_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	addrs := make(chan net.Addr, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Run(Config{
+		Stop:            stop,
+		DataPath:        filepath.Join(dir, "ladder.log"),
+		HTTPAddr:        "127.0.0.1:0",
+		GRPCAddr:        "127.0.0.1:0",
+		MaxRequestBytes: 1024,
+		OnListening: func(httpAddr, grpcAddr net.Addr) {
+			addrs <- grpcAddr
+		},
+	})
+
+	var grpcAddr net.Addr
+	select {
+	case grpcAddr = <-addrs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not start listening")
+	}
+
+	conn, err := grpc.Dial(grpcAddr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := ladderpb.NewLadderServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("expected a small request to succeed: %v", err)
+	}
+	_, err = client.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: strings.Repeat("x", 4096)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected RESOURCE_EXHAUSTED for an oversized request, got %v", err)
+	}
+}
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// liveSubscriberBuffer is how many events a slow subscriber may fall behind by
+	// before it is disconnected
+	liveSubscriberBuffer = 32
+	// livePingInterval keeps idle connections open through proxies
+	livePingInterval = 30 * time.Second
+)
+
+// Live event types
+const (
+	liveStandingsChanged = "standings_changed"
+	liveMatchRecorded    = "match_recorded"
+	liveLookingForGame   = "looking_for_game"
+	liveScoreChanged     = "live_score"
+)
+
+// liveEvent is the JSON message pushed to live subscribers
+type liveEvent struct {
+	Type          string       `json:"type"`
+	TransactionID string       `json:"transaction_id,omitempty"`
+	TimestampMs   int64        `json:"timestamp_ms"`
+	Players       []livePlayer `json:"players,omitempty"`
+	// How the standings got there, one player at a time, for animating the change
+	Moves []liveMove `json:"moves,omitempty"`
+	Match *liveMatch `json:"match,omitempty"`
+	// Everyone looking for a game, sent whenever someone starts or stops
+	Looking []liveLooking `json:"looking,omitempty"`
+	// A match being scored point by point, sent after every point
+	Score *liveScore `json:"score,omitempty"`
+}
+
+type livePlayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Rank int32  `json:"rank"`
+}
+
+// liveMove takes a player out at FromRank (0 for a join) and puts them in at ToRank
+// (0 for a leave); see TransactionDetail.movements
+type liveMove struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	FromRank int32  `json:"from_rank"`
+	ToRank   int32  `json:"to_rank"`
+}
+
+type liveLooking struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Rank    int32  `json:"rank"`
+	UntilMs int64  `json:"until_ms"`
+}
+
+type liveScore struct {
+	ID             string     `json:"id"`
+	ChallengerID   string     `json:"challenger_id"`
+	ChallengerName string     `json:"challenger_name"`
+	DefenderID     string     `json:"defender_id"`
+	DefenderName   string     `json:"defender_name"`
+	Sets           [][2]int32 `json:"sets"`    // Completed sets, challenger first
+	Current        [2]int32   `json:"current"` // The set being played
+	TransactionID  string     `json:"transaction_id,omitempty"`
+	Abandoned      bool       `json:"abandoned,omitempty"`
+}
+
+type liveMatch struct {
+	ChallengerID string `json:"challenger_id"`
+	DefenderID   string `json:"defender_id"`
+	WinnerID     string `json:"winner_id"`
+	Summary      string `json:"summary"`
+
+	result *ladderpb.MatchResult // For rebuilding Summary with masked names
+	names  map[string]string
+}
+
+// liveFeed fans the changes of one model out to its subscribers
+type liveFeed struct {
+	mu      sync.Mutex
+	subs    map[chan liveEvent]bool
+	lastSeq uint64 // Seq of the newest standings sent
+}
+
+// LiveHandler streams ladder changes to browsers and scripts as JSON events
+type LiveHandler struct {
+	service *LadderService
+
+	mu    sync.Mutex
+	feeds map[*modelState]*liveFeed // By ladder
+}
+
+// NewLiveHandler creates a live event handler for the service's ladders
+func NewLiveHandler(service *LadderService) *LiveHandler {
+	return &LiveHandler{service: service, feeds: make(map[*modelState]*liveFeed)}
+}
+
+// subscribe returns a channel of m's events, closed if the subscriber falls too far
+// behind, and a function to unsubscribe
+func (h *LiveHandler) subscribe(m *Model) (<-chan liveEvent, func()) {
+	h.mu.Lock()
+	feed, ok := h.feeds[m.modelState]
+	if !ok {
+		feed = &liveFeed{subs: make(map[chan liveEvent]bool)}
+		h.feeds[m.modelState] = feed
+		m.OnChange(feed.publish)
+		m.OnPresence(func() { feed.send(lookingEvent(m.LookingForGame(m.now()))) })
+		m.OnLiveScore(func(match *ladderpb.LiveMatch) { feed.send(scoreEvent(match, m.ListPlayers())) })
+	}
+	h.mu.Unlock()
+
+	ch := make(chan liveEvent, liveSubscriberBuffer)
+	feed.mu.Lock()
+	feed.subs[ch] = true
+	feed.mu.Unlock()
+
+	return ch, func() {
+		feed.mu.Lock()
+		defer feed.mu.Unlock()
+		if feed.subs[ch] {
+			delete(feed.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (f *liveFeed) publish(change LadderChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tx := change.Transaction
+	var events []liveEvent
+	if tx.GetMatchResultPayload() != nil {
+		names := make(map[string]string)
+		for _, p := range change.Before {
+			names[p.Id] = p.Name
+		}
+		for _, p := range change.After {
+			names[p.Id] = p.Name
+		}
+		events = append(events, matchEvent(tx, names))
+	}
+	// Listeners may run out of order; never follow newer standings with older ones
+	if change.Seq >= f.lastSeq {
+		f.lastSeq = change.Seq
+		ev := standingsEvent(tx.Id, tx.TimestampMs, storageToLadder(tx.PlayerList))
+		for _, step := range movementSteps(change.Before, change.After) {
+			ev.Moves = append(ev.Moves, liveMove{ID: step.PlayerId, Name: step.Name, FromRank: step.FromRank, ToRank: step.ToRank})
+		}
+		events = append(events, ev)
+	}
+
+	f.sendLocked(events...)
+}
+
+func (f *liveFeed) send(events ...liveEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sendLocked(events...)
+}
+
+func (f *liveFeed) sendLocked(events ...liveEvent) {
+	for ch := range f.subs {
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+				continue
+			default:
+			}
+			// Too far behind; the client reconnects and starts from a fresh snapshot
+			delete(f.subs, ch)
+			close(ch)
+			break
+		}
+	}
+}
+
+func matchEvent(tx *storagepb.TransactionStorage, names map[string]string) liveEvent {
+	mr := matchResultFromStorage(tx)
+	return liveEvent{
+		Type:          liveMatchRecorded,
+		TransactionID: tx.Id,
+		TimestampMs:   tx.TimestampMs,
+		Match: &liveMatch{
+			ChallengerID: mr.ChallengerId,
+			DefenderID:   mr.DefenderId,
+			WinnerID:     mr.WinnerId,
+			Summary:      describeMatch(mr, names),
+			result:       mr,
+			names:        names,
+		},
+	}
+}
+
+func standingsEvent(txID string, timestampMs int64, players []*ladderpb.Player) liveEvent {
+	ev := liveEvent{Type: liveStandingsChanged, TransactionID: txID, TimestampMs: timestampMs, Players: []livePlayer{}}
+	for _, p := range players {
+		ev.Players = append(ev.Players, livePlayer{ID: p.Id, Name: p.Name, Rank: p.Rank})
+	}
+	return ev
+}
+
+func lookingEvent(looking []*ladderpb.LookingForGame) liveEvent {
+	ev := liveEvent{Type: liveLookingForGame, TimestampMs: time.Now().UnixMilli(), Looking: []liveLooking{}}
+	for _, l := range looking {
+		ev.Looking = append(ev.Looking, liveLooking{ID: l.PlayerId, Name: l.Name, Rank: l.Rank, UntilMs: l.UntilMs})
+	}
+	return ev
+}
+
+func scoreEvent(match *ladderpb.LiveMatch, players []*ladderpb.Player) liveEvent {
+	score := &liveScore{
+		ID:            match.Id,
+		ChallengerID:  match.ChallengerId,
+		DefenderID:    match.DefenderId,
+		Sets:          [][2]int32{},
+		Current:       [2]int32{match.ChallengerPoints, match.DefenderPoints},
+		TransactionID: match.TransactionId,
+		Abandoned:     match.Abandoned,
+	}
+	if p := findPlayer(players, match.ChallengerId); p != nil {
+		score.ChallengerName = p.Name
+	}
+	if p := findPlayer(players, match.DefenderId); p != nil {
+		score.DefenderName = p.Name
+	}
+	for _, s := range match.CompletedSets {
+		score.Sets = append(score.Sets, [2]int32{s.ChallengerPoints, s.DefenderPoints})
+	}
+	return liveEvent{Type: liveScoreChanged, TransactionID: match.TransactionId, TimestampMs: time.Now().UnixMilli(), Score: score}
+}
+
+// public returns a copy of ev with masked names, for anonymous readers in public mode
+func (ev liveEvent) public() liveEvent {
+	if ev.Players != nil {
+		players := make([]livePlayer, len(ev.Players))
+		for i, p := range ev.Players {
+			players[i] = livePlayer{ID: p.ID, Name: maskName(p.Name), Rank: p.Rank}
+		}
+		ev.Players = players
+	}
+	if ev.Moves != nil {
+		moves := make([]liveMove, len(ev.Moves))
+		for i, mv := range ev.Moves {
+			moves[i] = mv
+			moves[i].Name = maskName(mv.Name)
+		}
+		ev.Moves = moves
+	}
+	if ev.Looking != nil {
+		looking := make([]liveLooking, len(ev.Looking))
+		for i, l := range ev.Looking {
+			looking[i] = l
+			looking[i].Name = maskName(l.Name)
+		}
+		ev.Looking = looking
+	}
+	if ev.Score != nil {
+		score := *ev.Score
+		score.ChallengerName = maskName(score.ChallengerName)
+		score.DefenderName = maskName(score.DefenderName)
+		ev.Score = &score
+	}
+	if ev.Match != nil {
+		match := *ev.Match
+		match.Summary = describeMatch(match.result, maskedNames(match.names))
+		ev.Match = &match
+	}
+	return ev
+}
+
+// sendFor masks the names in every event sent when ctx is a public view
+func sendFor(ctx context.Context, send func(liveEvent) error) func(liveEvent) error {
+	if !isPublicView(ctx) {
+		return send
+	}
+	return func(ev liveEvent) error {
+		return send(ev.public())
+	}
+}
+
+// ServeWebSocket handles GET /ws. The first message is the current standings;
+// after that each change to the ladder is pushed as it happens.
+func (h *LiveHandler) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	m := h.service.modelFor(r.Context())
+	events, unsubscribe := h.subscribe(m)
+	defer unsubscribe()
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn.readLoop()
+		close(closed)
+	}()
+
+	send := func(ev liveEvent) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		return conn.writeFrame(wsText, data)
+	}
+	ping := func() error {
+		return conn.writeFrame(wsPing, nil)
+	}
+	if !h.pump(m, events, closed, sendFor(r.Context(), send), ping) {
+		conn.writeFrame(wsClose, nil)
+	}
+}
+
+// ServeSSE handles GET /api/events, sending the same events as ServeWebSocket as
+// server-sent events named by their type
+func (h *LiveHandler) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeRESTError(w, codes.Internal, "streaming is not supported", nil)
+		return
+	}
+	m := h.service.modelFor(r.Context())
+	events, unsubscribe := h.subscribe(m)
+	defer unsubscribe()
+
+	// The stream outlives the HTTP server's read and write timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx and similar proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(ev liveEvent) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	ping := func() error {
+		if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	h.pump(m, events, r.Context().Done(), sendFor(r.Context(), send), ping)
+}
+
+// pump sends m's current standings and then each event until the client goes away
+// or a send fails. It returns false if the subscriber was dropped for falling behind.
+func (h *LiveHandler) pump(m *Model, events <-chan liveEvent, done <-chan struct{}, send func(liveEvent) error, ping func() error) bool {
+	if send(standingsEvent("", time.Now().UnixMilli(), m.ListPlayers())) != nil {
+		return true
+	}
+	if looking := m.LookingForGame(m.now()); len(looking) > 0 && send(lookingEvent(looking)) != nil {
+		return true
+	}
+
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return true
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			if send(ev) != nil {
+				return true
+			}
+		case <-ticker.C:
+			if ping() != nil {
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// readWSFrame reads one unmasked server frame
+func readWSFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("failed to read payload: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func readLiveEvent(t *testing.T, r *bufio.Reader) liveEvent {
+	t.Helper()
+	for {
+		opcode, payload := readWSFrame(t, r)
+		if opcode != wsText {
+			continue
+		}
+		var ev liveEvent
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			t.Fatalf("invalid event %q: %v", payload, err)
+		}
+		return ev
+	}
+}
+
+func TestLiveHandler_WebSocket(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	live := NewLiveHandler(NewLadderService(m))
+	srv := httptest.NewServer(http.HandlerFunc(live.ServeWebSocket))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: ladder\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake response: %s %v", resp.Status, resp.Header)
+	}
+
+	ev := readLiveEvent(t, r)
+	if ev.Type != liveStandingsChanged || len(ev.Players) != 2 || ev.Players[0].ID != "alice" {
+		t.Fatalf("expected the current standings first, got %+v", ev)
+	}
+
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+
+	ev = readLiveEvent(t, r)
+	if ev.Type != liveMatchRecorded || ev.Match.Summary != "Bob beat Alice (11-0, 11-0, 11-0)" {
+		t.Errorf("expected the match, got %+v", ev)
+	}
+	ev = readLiveEvent(t, r)
+	if ev.Type != liveStandingsChanged || ev.Players[0].ID != "bob" {
+		t.Errorf("expected bob to lead the new standings, got %+v", ev)
+	}
+	if want := []liveMove{{ID: "bob", Name: "Bob", FromRank: 2, ToRank: 1}}; !reflect.DeepEqual(ev.Moves, want) {
+		t.Errorf("expected bob's move up, got %+v", ev.Moves)
+	}
+
+	// A plain GET is rejected
+	plain, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-WebSocket request, got %d", plain.StatusCode)
+	}
+}
+
+func TestLiveHandler_SSE(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+
+	live := NewLiveHandler(NewLadderService(m))
+	srv := httptest.NewServer(http.HandlerFunc(live.ServeSSE))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/events")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	next := func() (string, liveEvent) {
+		t.Helper()
+		var name string
+		var ev liveEvent
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev)
+			case line == "" && name != "":
+				return name, ev
+			}
+		}
+	}
+
+	if name, ev := next(); name != liveStandingsChanged || len(ev.Players) != 1 {
+		t.Fatalf("expected the current standings first, got %s %+v", name, ev)
+	}
+	m.AddPlayer("Bob", "bob")
+	if name, ev := next(); name != liveStandingsChanged || len(ev.Players) != 2 || ev.Players[1].Name != "Bob" {
+		t.Errorf("expected bob to join the standings, got %s %+v", name, ev)
+	}
+	m.SetLookingForGame("bob", time.Now().Add(time.Hour), time.Now())
+	if name, ev := next(); name != liveLookingForGame || len(ev.Looking) != 1 || ev.Looking[0].ID != "bob" {
+		t.Errorf("expected bob to be looking for a game, got %s %+v", name, ev)
+	}
+	m.StartLiveMatch("bob", "alice", time.Now())
+	if name, ev := next(); name != liveScoreChanged || ev.Score.ChallengerName != "Bob" || len(ev.Score.Sets) != 0 {
+		t.Errorf("expected the live match to start, got %s %+v", name, ev)
+	}
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// staleLiveMatch is how long a live match may go without a point before it is dropped
+const staleLiveMatch = 6 * time.Hour
+
+// liveScoring holds the matches being scored point by point. Like presence it lives in
+// memory only: a restart loses matches in progress but never a recorded result.
+type liveScoring struct {
+	mu        sync.Mutex
+	matches   map[string]*liveMatchState
+	listeners []func(*ladderpb.LiveMatch)
+}
+
+// liveMatchState is a live match and what is needed to score it
+type liveMatchState struct {
+	match                          *ladderpb.LiveMatch
+	points                         []ladderpb.PointWinner // Of the set being played
+	setStarts                      []int64                // When each set began, completed ones included
+	lastPointMs                    int64
+	challengerStart, defenderStart int32 // Handicap head starts
+	setsToWin, setPoints           int
+}
+
+// liveResult is how a live match ended, ready to be recorded
+type liveResult struct {
+	sets     []*ladderpb.SetScore
+	winnerID string
+}
+
+// setWinner returns who has won a set of the given points, or POINT_UNKNOWN if it is
+// still being played
+func (s *liveMatchState) setWinner(challengerPoints, defenderPoints int32) ladderpb.PointWinner {
+	c, d := int(challengerPoints+s.challengerStart), int(defenderPoints+s.defenderStart)
+	switch {
+	case c >= s.setPoints && c-d >= 2:
+		return ladderpb.PointWinner_POINT_CHALLENGER
+	case d >= s.setPoints && d-c >= 2:
+		return ladderpb.PointWinner_POINT_DEFENDER
+	}
+	return ladderpb.PointWinner_POINT_UNKNOWN
+}
+
+// winnerID returns the ID of the player who has won the match, or "" while it is on
+func (s *liveMatchState) winnerID() string {
+	var challenger, defender int
+	for _, set := range s.match.CompletedSets {
+		if s.setWinner(set.ChallengerPoints, set.DefenderPoints) == ladderpb.PointWinner_POINT_CHALLENGER {
+			challenger++
+		} else {
+			defender++
+		}
+	}
+	switch {
+	case challenger == s.setsToWin:
+		return s.match.ChallengerId
+	case defender == s.setsToWin:
+		return s.match.DefenderId
+	}
+	return ""
+}
+
+// tally sets the current set's score from its points
+func (s *liveMatchState) tally() {
+	s.match.ChallengerPoints, s.match.DefenderPoints = 0, 0
+	for _, p := range s.points {
+		if p == ladderpb.PointWinner_POINT_CHALLENGER {
+			s.match.ChallengerPoints++
+		} else {
+			s.match.DefenderPoints++
+		}
+	}
+}
+
+// currentSet returns the set being played as a SetScore
+func (s *liveMatchState) currentSet(now time.Time) *ladderpb.SetScore {
+	return &ladderpb.SetScore{
+		ChallengerPoints: s.match.ChallengerPoints,
+		DefenderPoints:   s.match.DefenderPoints,
+		DurationSeconds:  int32((now.UnixMilli() - s.setStarts[len(s.setStarts)-1]) / 1000),
+		Points:           append([]ladderpb.PointWinner(nil), s.points...),
+	}
+}
+
+// StartLiveMatch begins scoring a match between two players on the ladder
+func (m *Model) StartLiveMatch(challengerID, defenderID string, now time.Time) (*ladderpb.LiveMatch, error) {
+	players := m.ListPlayers()
+	if findPlayer(players, challengerID) == nil || findPlayer(players, defenderID) == nil {
+		return nil, localizedStatusf(codes.NotFound, "challenger or defender not found")
+	}
+	if challengerID == defenderID {
+		return nil, localizedStatusf(codes.InvalidArgument, "challenger and defender must be two different players")
+	}
+	rules, err := m.GetLadderRules()
+	if err != nil {
+		return nil, err
+	}
+	state := &liveMatchState{
+		match: &ladderpb.LiveMatch{
+			Id:           m.newID(),
+			ChallengerId: challengerID,
+			DefenderId:   defenderID,
+			StartedAtMs:  now.UnixMilli(),
+		},
+		setStarts:   []int64{now.UnixMilli()},
+		lastPointMs: now.UnixMilli(),
+	}
+	state.challengerStart, state.defenderStart = handicapStarts(players, challengerID, defenderID)
+	state.setsToWin, state.setPoints = scoringFormatRules(rules.ScoringFormat)
+
+	l := &m.live
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.matches == nil {
+		l.matches = make(map[string]*liveMatchState)
+	}
+	for id, s := range l.matches {
+		if now.Sub(time.UnixMilli(s.lastPointMs)) > staleLiveMatch {
+			delete(l.matches, id)
+		}
+	}
+	l.matches[state.match.Id] = state
+	return l.notifyLocked(state.match), nil
+}
+
+// RecordLivePoint scores a point of a live match, or takes back the last one if undo is
+// set. Once the match is won it returns the result for the caller to record; further
+// points are ignored until it is, and the same result is returned again.
+func (m *Model) RecordLivePoint(id string, winner ladderpb.PointWinner, undo bool, now time.Time) (*ladderpb.LiveMatch, *liveResult, error) {
+	l := &m.live
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.matches[id]
+	if s == nil {
+		return nil, nil, localizedStatusf(codes.NotFound, "live match not found: %s", id)
+	}
+
+	switch {
+	case undo:
+		if len(s.points) == 0 {
+			sets := s.match.CompletedSets
+			if len(sets) == 0 {
+				return nil, nil, localizedStatusf(codes.FailedPrecondition, "there is no point to take back")
+			}
+			// Reopen the last set
+			s.points = sets[len(sets)-1].Points
+			s.match.CompletedSets = sets[:len(sets)-1]
+			s.setStarts = s.setStarts[:len(s.setStarts)-1]
+		}
+		s.points = s.points[:len(s.points)-1]
+		s.tally()
+	case s.winnerID() != "":
+		// Already won; the result still has to be recorded
+	case winner != ladderpb.PointWinner_POINT_CHALLENGER && winner != ladderpb.PointWinner_POINT_DEFENDER:
+		return nil, nil, localizedStatusf(codes.InvalidArgument, "a point needs a winner")
+	default:
+		s.points = append(s.points, winner)
+		s.tally()
+		if s.setWinner(s.match.ChallengerPoints, s.match.DefenderPoints) != ladderpb.PointWinner_POINT_UNKNOWN {
+			s.match.CompletedSets = append(s.match.CompletedSets, s.currentSet(now))
+			s.points = nil
+			s.tally()
+			s.setStarts = append(s.setStarts, now.UnixMilli())
+		}
+	}
+	s.lastPointMs = now.UnixMilli()
+
+	var result *liveResult
+	if winnerID := s.winnerID(); winnerID != "" {
+		result = &liveResult{sets: proto.Clone(s.match).(*ladderpb.LiveMatch).CompletedSets, winnerID: winnerID}
+	}
+	return l.notifyLocked(s.match), result, nil
+}
+
+// liveMatchDefaulted returns a live match and its result when defaultedID defaults in
+// the set being played
+func (m *Model) liveMatchDefaulted(id, defaultedID string, now time.Time) (*ladderpb.LiveMatch, *liveResult, error) {
+	l := &m.live
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.matches[id]
+	if s == nil {
+		return nil, nil, localizedStatusf(codes.NotFound, "live match not found: %s", id)
+	}
+	set := s.currentSet(now)
+	winnerID := s.match.ChallengerId
+	switch defaultedID {
+	case s.match.ChallengerId:
+		set.ChallengerDefault = true
+		winnerID = s.match.DefenderId
+	case s.match.DefenderId:
+		set.DefenderDefault = true
+	default:
+		return nil, nil, localizedStatusf(codes.InvalidArgument, "%s is not playing this match", defaultedID)
+	}
+	match := proto.Clone(s.match).(*ladderpb.LiveMatch)
+	return match, &liveResult{sets: append(match.CompletedSets, set), winnerID: winnerID}, nil
+}
+
+// EndLiveMatch stops scoring a live match, whose result was recorded as transactionID
+// or, if that is empty, abandoned
+func (m *Model) EndLiveMatch(id, transactionID string) (*ladderpb.LiveMatch, error) {
+	l := &m.live
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.matches[id]
+	if s == nil {
+		return nil, localizedStatusf(codes.NotFound, "live match not found: %s", id)
+	}
+	delete(l.matches, id)
+	s.match.TransactionId = transactionID
+	s.match.Abandoned = transactionID == ""
+	return l.notifyLocked(s.match), nil
+}
+
+// LiveMatches returns the matches being scored, oldest first
+func (m *Model) LiveMatches() []*ladderpb.LiveMatch {
+	l := &m.live
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	matches := []*ladderpb.LiveMatch{}
+	for _, s := range l.matches {
+		matches = append(matches, proto.Clone(s.match).(*ladderpb.LiveMatch))
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].StartedAtMs < matches[j].StartedAtMs })
+	return matches
+}
+
+// OnLiveScore registers fn to be called with a live match after every change to it.
+// Unlike OnChange listeners it is called synchronously, in order, so it must not block.
+func (m *Model) OnLiveScore(fn func(*ladderpb.LiveMatch)) {
+	m.live.mu.Lock()
+	defer m.live.mu.Unlock()
+	m.live.listeners = append(m.live.listeners, fn)
+}
+
+// notifyLocked passes a copy of match to the listeners and returns another for the
+// caller. The caller must hold l.mu.
+func (l *liveScoring) notifyLocked(match *ladderpb.LiveMatch) *ladderpb.LiveMatch {
+	for _, fn := range l.listeners {
+		fn(proto.Clone(match).(*ladderpb.LiveMatch))
+	}
+	return proto.Clone(match).(*ladderpb.LiveMatch)
+}
+
+// StartLiveMatch begins scoring a match point by point
+func (h *LadderService) StartLiveMatch(ctx context.Context, req *ladderpb.StartLiveMatchRequest) (*ladderpb.StartLiveMatchResponse, error) {
+	m := h.modelFor(ctx)
+	if defender := findPlayer(m.ListPlayers(), req.DefenderId); defender != nil && protectedAt(defender, m.now()) {
+		return nil, localizedStatusf(codes.FailedPrecondition, "%s is protected from challenges through %s",
+			defender.Name, time.UnixMilli(defender.ProtectedUntilMs-1).In(m.TimeZone()).Format("2006-01-02"))
+	}
+	match, err := m.StartLiveMatch(req.ChallengerId, req.DefenderId, m.now())
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.StartLiveMatchResponse{Match: match}, nil
+}
+
+// RecordPoint scores a point of a live match and records the result when it wins
+// the match
+func (h *LadderService) RecordPoint(ctx context.Context, req *ladderpb.RecordPointRequest) (*ladderpb.RecordPointResponse, error) {
+	m := h.modelFor(ctx)
+	match, result, err := m.RecordLivePoint(req.LiveMatchId, req.Winner, req.Undo, m.now())
+	if err != nil {
+		return nil, err
+	}
+	if result != nil {
+		if match, err = h.recordLiveMatch(ctx, m, match, result); err != nil {
+			return nil, err
+		}
+	}
+	return &ladderpb.RecordPointResponse{Match: match}, nil
+}
+
+// FinishLiveMatch ends a live match early, recording a default or abandoning it
+func (h *LadderService) FinishLiveMatch(ctx context.Context, req *ladderpb.FinishLiveMatchRequest) (*ladderpb.FinishLiveMatchResponse, error) {
+	m := h.modelFor(ctx)
+	if req.DefaultedPlayerId == "" {
+		match, err := m.EndLiveMatch(req.LiveMatchId, "")
+		if err != nil {
+			return nil, err
+		}
+		return &ladderpb.FinishLiveMatchResponse{Match: match}, nil
+	}
+	match, result, err := m.liveMatchDefaulted(req.LiveMatchId, req.DefaultedPlayerId, m.now())
+	if err != nil {
+		return nil, err
+	}
+	if match, err = h.recordLiveMatch(ctx, m, match, result); err != nil {
+		return nil, err
+	}
+	return &ladderpb.FinishLiveMatchResponse{Match: match}, nil
+}
+
+// recordLiveMatch records the result of a live match like any other and ends it
+func (h *LadderService) recordLiveMatch(ctx context.Context, m *Model, match *ladderpb.LiveMatch, result *liveResult) (*ladderpb.LiveMatch, error) {
+	resp, err := h.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+		ChallengerId: match.ChallengerId,
+		DefenderId:   match.DefenderId,
+		WinnerId:     result.winnerID,
+		SetScores:    result.sets,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.EndLiveMatch(match.Id, resp.TransactionId)
+}
+
+// ListLiveMatches returns the matches being scored now
+func (h *LadderService) ListLiveMatches(ctx context.Context, req *ladderpb.ListLiveMatchesRequest) (*ladderpb.ListLiveMatchesResponse, error) {
+	return &ladderpb.ListLiveMatchesResponse{Matches: h.modelFor(ctx).LiveMatches()}, nil
+}
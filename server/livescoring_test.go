@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLadderService_LiveScoring(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, ScoringFormat: ladderpb.ScoringFormat_BEST_OF_3_PAR_11}); err != nil {
+		t.Fatalf("SetLadderRules failed: %v", err)
+	}
+	var updates []*ladderpb.LiveMatch
+	m.OnLiveScore(func(match *ladderpb.LiveMatch) { updates = append(updates, match) })
+
+	svc := NewLadderService(m)
+	ctx := context.Background()
+	if _, err := svc.StartLiveMatch(ctx, &ladderpb.StartLiveMatchRequest{ChallengerId: "bob", DefenderId: "bob"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for one player, got %v", err)
+	}
+	started, err := svc.StartLiveMatch(ctx, &ladderpb.StartLiveMatchRequest{ChallengerId: "bob", DefenderId: "alice"})
+	if err != nil {
+		t.Fatalf("StartLiveMatch failed: %v", err)
+	}
+	id := started.Match.Id
+	point := func(winner ladderpb.PointWinner, n int) *ladderpb.LiveMatch {
+		t.Helper()
+		var resp *ladderpb.RecordPointResponse
+		for i := 0; i < n; i++ {
+			if resp, err = svc.RecordPoint(ctx, &ladderpb.RecordPointRequest{LiveMatchId: id, Winner: winner}); err != nil {
+				t.Fatalf("RecordPoint failed: %v", err)
+			}
+		}
+		return resp.Match
+	}
+	c, d := ladderpb.PointWinner_POINT_CHALLENGER, ladderpb.PointWinner_POINT_DEFENDER
+
+	if _, err := svc.RecordPoint(ctx, &ladderpb.RecordPointRequest{LiveMatchId: id, Undo: true}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition undoing nothing, got %v", err)
+	}
+	point(d, 10)
+	match := point(c, 12)
+	if len(match.CompletedSets) != 1 || match.CompletedSets[0].ChallengerPoints != 12 || match.CompletedSets[0].DefenderPoints != 10 {
+		t.Fatalf("expected Bob to win the first set 12-10, got %v", match)
+	}
+
+	// Taking back a point reopens the set
+	resp, err := svc.RecordPoint(ctx, &ladderpb.RecordPointRequest{LiveMatchId: id, Undo: true})
+	if err != nil || len(resp.Match.CompletedSets) != 0 || resp.Match.ChallengerPoints != 11 || resp.Match.DefenderPoints != 10 {
+		t.Fatalf("expected 11-10 in the first set after undo, got %v, %v", resp, err)
+	}
+	point(c, 1)
+	point(d, 3)
+	match = point(c, 11)
+	if match.TransactionId == "" || len(m.LiveMatches()) != 0 {
+		t.Fatalf("expected the match to be recorded when won, got %v", match)
+	}
+
+	results, _ := m.GetRecentMatches(1)
+	result := results[0]
+	if result.TransactionId != match.TransactionId || result.WinnerId != "bob" || len(result.SetScores) != 2 {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if s := result.SetScores[1]; s.ChallengerPoints != 11 || s.DefenderPoints != 3 || len(s.Points) != 14 || s.Points[0] != d {
+		t.Errorf("expected the second set's points to be kept, got %v", s)
+	}
+	assertOrder(t, m, "bob", "alice")
+	if last := updates[len(updates)-1]; last.TransactionId != match.TransactionId {
+		t.Errorf("expected listeners to hear about the recorded result, got %v", last)
+	}
+
+	// A default ends a match early with the other player winning
+	started, _ = svc.StartLiveMatch(ctx, &ladderpb.StartLiveMatchRequest{ChallengerId: "alice", DefenderId: "bob"})
+	id = started.Match.Id
+	point(c, 4)
+	if _, err := svc.FinishLiveMatch(ctx, &ladderpb.FinishLiveMatchRequest{LiveMatchId: id, DefaultedPlayerId: "carol"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for someone not playing, got %v", err)
+	}
+	finished, err := svc.FinishLiveMatch(ctx, &ladderpb.FinishLiveMatchRequest{LiveMatchId: id, DefaultedPlayerId: "bob"})
+	if err != nil || finished.Match.TransactionId == "" {
+		t.Fatalf("expected the default to be recorded, got %v, %v", finished, err)
+	}
+	assertOrder(t, m, "alice", "bob")
+
+	// Abandoning records nothing
+	started, _ = svc.StartLiveMatch(ctx, &ladderpb.StartLiveMatchRequest{ChallengerId: "bob", DefenderId: "alice"})
+	finished, err = svc.FinishLiveMatch(ctx, &ladderpb.FinishLiveMatchRequest{LiveMatchId: started.Match.Id})
+	if err != nil || !finished.Match.Abandoned {
+		t.Fatalf("expected the match to be abandoned, got %v, %v", finished, err)
+	}
+	if results, _ := m.GetRecentMatches(10); len(results) != 2 {
+		t.Errorf("expected two recorded matches, got %d", len(results))
+	}
+	if _, err := svc.RecordPoint(ctx, &ladderpb.RecordPointRequest{LiveMatchId: started.Match.Id, Winner: c}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a finished match, got %v", err)
+	}
+}
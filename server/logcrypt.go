@@ -0,0 +1,150 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedLinePrefix marks a log line sealed with AES-GCM. Base64 never contains a
+// colon, so plaintext and encrypted lines can be mixed in one log and a log written
+// before encryption was turned on stays readable.
+const encryptedLinePrefix = "aes1:"
+
+// LogKeySize is the length of a log encryption key (AES-256)
+const LogKeySize = 32
+
+var errLogEncrypted = errors.New("the log is encrypted; configure its encryption key")
+
+// logCipher seals log lines with AES-256-GCM. A nil *logCipher writes plaintext lines.
+// Each line is "aes1:" followed by the base64 of a random nonce and the sealed
+// TransactionStorage.
+type logCipher struct {
+	aead cipher.AEAD
+}
+
+func newLogCipher(key []byte) (*logCipher, error) {
+	if len(key) != LogKeySize {
+		return nil, fmt.Errorf("log encryption key must be %d bytes, got %d", LogKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &logCipher{aead: aead}, nil
+}
+
+// seal returns the log line for an encoded transaction, without the newline
+func (c *logCipher) seal(data []byte) (string, error) {
+	if c == nil {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return encryptedLinePrefix + base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+// open returns the encoded transaction in a log line, plaintext or sealed
+func (c *logCipher) open(line string) ([]byte, error) {
+	line = strings.TrimSpace(line)
+	sealed, encrypted := strings.CutPrefix(line, encryptedLinePrefix)
+	if !encrypted {
+		return base64.StdEncoding.DecodeString(line)
+	}
+	if c == nil {
+		return nil, errLogEncrypted
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return nil, fmt.Errorf("encrypted line is truncated")
+	}
+	plain, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt line (wrong key?): %v", err)
+	}
+	return plain, nil
+}
+
+// ParseLogKey decodes a base64 log encryption key, as produced by
+// "head -c 32 /dev/urandom | base64"
+func ParseLogKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("log encryption key is not valid base64: %v", err)
+	}
+	if len(key) != LogKeySize {
+		return nil, fmt.Errorf("log encryption key must be %d bytes, got %d", LogKeySize, len(key))
+	}
+	return key, nil
+}
+
+// SetEncryptionKey encrypts every line appended from now on with key, and lets the
+// model read lines encrypted with it. A nil key goes back to writing plaintext.
+// Existing plaintext lines stay readable; EncryptLog rewrites them.
+func (m *Model) SetEncryptionKey(key []byte) error {
+	var c *logCipher
+	if key != nil {
+		var err error
+		if c, err = newLogCipher(key); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cipher = c
+	m.encoder = nil
+	m.matches.setCipher(c)
+	return nil
+}
+
+// EncryptLog rewrites the log so that every line is encrypted with the current key,
+// returning the number of plaintext lines it found. The log is only rewritten if
+// there were any.
+func (m *Model) EncryptLog() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cipher == nil {
+		return 0, fmt.Errorf("no encryption key is set")
+	}
+	data, err := os.ReadFile(m.LogFilePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	plain := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, encryptedLinePrefix) {
+			plain++
+		}
+	}
+	if plain == 0 {
+		return 0, nil
+	}
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.rewriteLogLocked(txs); err != nil {
+		return 0, fmt.Errorf("failed to encrypt log: %v", err)
+	}
+	return plain, nil
+}
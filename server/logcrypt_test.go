@@ -0,0 +1,73 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_EncryptedLog(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	// Written before encryption is turned on
+	m.AddPlayer("Alice Smith", "alice")
+
+	key := bytes.Repeat([]byte{7}, LogKeySize)
+	if err := m.SetEncryptionKey(key); err != nil {
+		t.Fatalf("SetEncryptionKey failed: %v", err)
+	}
+	m.AddPlayer("Bob Jones", "bob")
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	m.Close()
+
+	// Mixed logs read fine
+	if players := m.ListPlayers(); len(players) != 2 || players[0].Id != "bob" {
+		t.Fatalf("unexpected ladder from a mixed log: %v", players)
+	}
+	n, err := m.EncryptLog()
+	if err != nil || n != 1 {
+		t.Fatalf("expected EncryptLog to convert 1 line, got %d, %v", n, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.HasPrefix(line, encryptedLinePrefix) {
+			t.Errorf("expected every line to be encrypted, got %q", line)
+		}
+	}
+	if bytes.Contains(data, []byte("Alice")) {
+		t.Error("player names are visible in the encrypted log")
+	}
+
+	matches, err := m.GetRecentMatches(10)
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected 1 match from the encrypted log, got %v, %v", matches, err)
+	}
+	if err := m.InvalidateMatchResult(context.Background(), matches[0].TransactionId); err != nil {
+		t.Fatalf("InvalidateMatchResult on the encrypted log failed: %v", err)
+	}
+	if players := m.ListPlayers(); players[0].Id != "alice" {
+		t.Errorf("expected the invalidation to restore the ladder, got %v", players)
+	}
+
+	// Without the key, or with the wrong one, the log cannot be read
+	plain, _ := NewModel(path)
+	if _, err := plain.CurrentState(); err == nil {
+		t.Error("expected reading without the key to fail")
+	}
+	wrong, _ := NewModel(path)
+	wrong.SetEncryptionKey(bytes.Repeat([]byte{8}, LogKeySize))
+	if _, err := wrong.CurrentState(); err == nil {
+		t.Error("expected reading with the wrong key to fail")
+	}
+
+	if err := m.SetEncryptionKey([]byte("short")); err == nil {
+		t.Error("expected a short key to be rejected")
+	}
+}
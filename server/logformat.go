@@ -0,0 +1,220 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	storagepb "squash-ladder/server/gen/storage"
+
+	"github.com/icza/backscanner"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultCheckpointInterval is how often a full player list is written to the log.
+// The transactions in between only store a PlayerListDelta against their predecessor.
+const defaultCheckpointInterval = 100
+
+// Log format
+//
+// Every line is a base64-encoded TransactionStorage, or "aes1:" and the base64 of an
+// AES-GCM sealed one when the log is encrypted (see logcrypt.go). Originally (v1) every transaction
+// carried the full player list. In v2 most transactions carry a player_list_delta
+// instead, and only checkpoints carry player_list. A transaction without a delta is a
+// checkpoint, so v1 logs and mixed logs are read without conversion.
+
+// diffPlayerList returns the delta that turns prev into next
+func diffPlayerList(prev, next []*storagepb.PlayerStorage) *storagepb.PlayerListDelta {
+	d := &storagepb.PlayerListDelta{Length: int32(len(next))}
+	for i, p := range next {
+		if i < len(prev) && proto.Equal(prev[i], p) {
+			continue
+		}
+		d.Changed = append(d.Changed, &storagepb.PositionedPlayerStorage{Position: int32(i), Player: p})
+	}
+	return d
+}
+
+// applyPlayerListDelta returns the list that d describes relative to prev
+func applyPlayerListDelta(prev []*storagepb.PlayerStorage, d *storagepb.PlayerListDelta) ([]*storagepb.PlayerStorage, error) {
+	if d.Length < 0 {
+		return nil, fmt.Errorf("invalid delta length %d", d.Length)
+	}
+	// Unchanged players are copied so that no two snapshots share a message
+	next := make([]*storagepb.PlayerStorage, d.Length)
+	for i := 0; i < len(prev) && i < len(next); i++ {
+		next[i] = proto.Clone(prev[i]).(*storagepb.PlayerStorage)
+	}
+	for _, c := range d.Changed {
+		if c.Position < 0 || c.Position >= d.Length || c.Player == nil {
+			return nil, fmt.Errorf("invalid delta entry at position %d", c.Position)
+		}
+		next[c.Position] = c.Player
+	}
+	for i, p := range next {
+		if p == nil {
+			return nil, fmt.Errorf("delta leaves position %d empty", i)
+		}
+	}
+	return next, nil
+}
+
+// resolveSnapshots fills in PlayerList on every delta transaction of a log read in
+// write order, so callers always see full snapshots
+func resolveSnapshots(txs []*storagepb.TransactionStorage) error {
+	var state []*storagepb.PlayerStorage
+	for _, t := range txs {
+		if t.PlayerListDelta == nil {
+			state = t.PlayerList
+			continue
+		}
+		next, err := applyPlayerListDelta(state, t.PlayerListDelta)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %v", t.Id, err)
+		}
+		t.PlayerList = next
+		t.PlayerListDelta = nil
+		state = next
+	}
+	return nil
+}
+
+// scanBackToCheckpoint reads lines backwards from the scanner's position until it
+// reaches a checkpoint, and returns the player list after the first transaction read
+// together with the number of delta transactions passed on the way
+func scanBackToCheckpoint(scanner *backscanner.Scanner, c *logCipher) ([]*storagepb.PlayerStorage, int, error) {
+	var deltas []*storagepb.PlayerListDelta
+	state := []*storagepb.PlayerStorage{}
+	for {
+		line, _, err := scanner.Line()
+		if err != nil {
+			if err.Error() == "EOF" {
+				break
+			}
+			return nil, 0, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		t, err := decodeLogLine([]byte(line), c)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to decode line: %v", err)
+		}
+		if t.PlayerListDelta == nil {
+			state = t.PlayerList
+			break
+		}
+		deltas = append(deltas, t.PlayerListDelta)
+	}
+
+	for i := len(deltas) - 1; i >= 0; i-- {
+		next, err := applyPlayerListDelta(state, deltas[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		state = next
+	}
+	return state, len(deltas), nil
+}
+
+// logEncoder turns transactions into log lines, writing a checkpoint every interval
+// transactions and deltas in between
+type logEncoder struct {
+	interval        int
+	cipher          *logCipher // nil writes plaintext lines
+	size            int64      // Bytes of log the encoder's state corresponds to
+	prev            []*storagepb.PlayerStorage
+	chain           []byte // Chain hash of the last transaction written
+	sinceCheckpoint int
+}
+
+// encode returns the log line for tx without changing the encoder's state. It reports
+// whether the line is a checkpoint, to be passed to advance once the line is written.
+func (e *logEncoder) encode(tx *storagepb.TransactionStorage) ([]byte, bool, error) {
+	checkpoint := e.size == 0 || e.sinceCheckpoint+1 >= e.interval
+
+	hash, err := chainHash(e.chain, tx)
+	if err != nil {
+		return nil, false, err
+	}
+	tx.ChainHash = hash
+
+	players := tx.PlayerList
+	if !checkpoint {
+		tx.PlayerList = nil
+		tx.PlayerListDelta = diffPlayerList(e.prev, players)
+	}
+	data, err := proto.Marshal(tx)
+	tx.PlayerList = players
+	tx.PlayerListDelta = nil
+	if err != nil {
+		return nil, false, err
+	}
+	line, err := e.cipher.seal(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(line + "\n"), checkpoint, nil
+}
+
+// advance records that the line encoded for tx has been written
+func (e *logEncoder) advance(tx *storagepb.TransactionStorage, line []byte, checkpoint bool) {
+	e.size += int64(len(line))
+	e.prev = tx.PlayerList
+	e.chain = tx.ChainHash
+	if checkpoint {
+		e.sinceCheckpoint = 0
+	} else {
+		e.sinceCheckpoint++
+	}
+}
+
+// SetCheckpointInterval sets how many transactions may pass between full player list
+// snapshots in the log. 1 writes a snapshot with every transaction, as log format v1 did;
+// zero or less restores the default.
+func (m *Model) SetCheckpointInterval(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpointInterval = n
+	m.encoder = nil
+}
+
+func (m *Model) checkpointEvery() int {
+	if m.checkpointInterval <= 0 {
+		return defaultCheckpointInterval
+	}
+	return m.checkpointInterval
+}
+
+// encoderLocked returns an encoder positioned at the end of the log, rebuilding it from
+// the tail of the log if the file has changed since the last append.
+// The caller must hold the write lock.
+func (m *Model) encoderLocked() (*logEncoder, error) {
+	size, err := m.logSizeLocked()
+	if err != nil {
+		return nil, err
+	}
+	if m.encoder != nil && m.encoder.size == size {
+		return m.encoder, nil
+	}
+
+	enc := &logEncoder{interval: m.checkpointEvery(), cipher: m.cipher, size: size}
+	if size > 0 {
+		file, err := os.Open(m.LogFilePath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		enc.prev, enc.sinceCheckpoint, err = scanBackToCheckpoint(backscanner.New(file, int(size)), m.cipher)
+		if err != nil {
+			return nil, err
+		}
+		if enc.chain, err = lastChainHash(file, size, m.cipher); err != nil {
+			return nil, err
+		}
+	}
+	m.encoder = enc
+	return enc, nil
+}
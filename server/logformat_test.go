@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// playMatches adds players and then n matches where the bottom player challenges
+// the one above and wins, so every match moves two positions
+func playMatches(t *testing.T, m *Model, players, n int) {
+	t.Helper()
+	for i := 0; i < players; i++ {
+		if _, err := m.AddPlayer(fmt.Sprintf("Player %d", i), fmt.Sprintf("p%d", i)); err != nil {
+			t.Fatalf("AddPlayer failed: %v", err)
+		}
+	}
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	for i := 0; i < n; i++ {
+		list := m.ListPlayers()
+		k := 1 + i%(len(list)-1)
+		challenger, defender := list[k].Id, list[k-1].Id
+		if _, err := m.AddMatchResult(challenger, defender, challenger, sets); err != nil {
+			t.Fatalf("AddMatchResult failed: %v", err)
+		}
+	}
+}
+
+func TestLogFormat_DeltasReplayAcrossCheckpoints(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.SetCheckpointInterval(5)
+
+	playMatches(t, m, 6, 12)
+
+	// Undo a match that sits between two checkpoints
+	m.mu.RLock()
+	txs, err := m.readTransactionsLocked()
+	m.mu.RUnlock()
+	if err != nil {
+		t.Fatalf("readTransactionsLocked failed: %v", err)
+	}
+	if err := m.InvalidateMatchResult(context.Background(), txs[12].Id); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+
+	report, err := m.VerifyLog(context.Background(), false)
+	if err != nil {
+		t.Fatalf("VerifyLog failed: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected resolved snapshots to match the replay, got %+v", report.Mismatches)
+	}
+
+	// A fresh model reading the same file agrees with the replay
+	fresh, _ := NewModel(path)
+	if reason := comparePlayers(fresh.ListPlayers(), m.ListPlayers()); reason != "" {
+		t.Errorf("fresh model disagrees: %s", reason)
+	}
+}
+
+func TestLogFormat_ReadsV1Logs(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	// A snapshot on every transaction is the original format
+	m.SetCheckpointInterval(1)
+	playMatches(t, m, 4, 3)
+
+	m.SetCheckpointInterval(0)
+	playMatches(t, m, 0, 3)
+
+	if report, err := m.VerifyLog(context.Background(), false); err != nil || !report.OK() {
+		t.Fatalf("mixed log does not verify: %v %+v", err, report)
+	}
+	if got := len(m.ListPlayers()); got != 4 {
+		t.Errorf("expected 4 players, got %d", got)
+	}
+}
+
+func TestLogFormat_SmallerThanSnapshots(t *testing.T) {
+	size := func(interval int) int64 {
+		m, path := createTempModel(t)
+		defer os.Remove(path)
+		defer m.Close()
+		m.SetCheckpointInterval(interval)
+		playMatches(t, m, 60, 200)
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stat.Size()
+	}
+
+	full, delta := size(1), size(0)
+	if delta*5 > full {
+		t.Errorf("expected delta log to be at least 5x smaller, got %d bytes vs %d", delta, full)
+	}
+}
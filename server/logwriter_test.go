@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestModel_ConcurrentAppends(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	const n = 50
+	appends, syncs := logAppends.Value(), logSyncs.Value()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := m.AddPlayer(fmt.Sprintf("Player %d", i), fmt.Sprintf("p%d", i)); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("AddPlayer failed: %v", err)
+	}
+
+	m.mu.RLock()
+	txs, err := m.readTransactionsLocked()
+	m.mu.RUnlock()
+	if err != nil {
+		t.Fatalf("log is not readable after concurrent appends: %v", err)
+	}
+	if len(txs) != n {
+		t.Fatalf("expected %d transactions, got %d", n, len(txs))
+	}
+	if players := m.ListPlayers(); len(players) != n {
+		t.Errorf("expected %d players, got %d", n, len(players))
+	}
+	// Appends are serialized by the model's lock, so each is synced on its own
+	if got := logAppends.Value() - appends; got != n {
+		t.Errorf("expected %d appends, got %d", n, got)
+	}
+	if got := logSyncs.Value() - syncs; got != n {
+		t.Errorf("expected a sync per append, got %d syncs", got)
+	}
+}
+
+func TestModel_AppendAfterLogReplaced(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	if _, err := m.AddPlayer("Alice", "alice"); err != nil {
+		t.Fatalf("AddPlayer failed: %v", err)
+	}
+
+	// Swap the file underneath the open writer, as a repair or restore would
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".new", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".new", path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.AddPlayer("Bob", "bob"); err != nil {
+		t.Fatalf("AddPlayer failed: %v", err)
+	}
+	if players := m.ListPlayers(); len(players) != 2 {
+		t.Fatalf("expected 2 players after the log was replaced, got %d", len(players))
+	}
+
+	m.Close()
+	if _, err := m.AddPlayer("Charlie", "charlie"); err != nil {
+		t.Fatalf("AddPlayer after Close failed: %v", err)
+	}
+	if players := m.ListPlayers(); len(players) != 3 {
+		t.Errorf("expected 3 players after Close, got %d", len(players))
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaintenanceError is returned by every write while maintenance mode is on
+type MaintenanceError struct {
+	Message string
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Message == "" {
+		return "the ladder is in maintenance mode, please try again later"
+	}
+	return "the ladder is in maintenance mode: " + e.Message
+}
+
+// maintenanceMode blocks writes while the data is audited or migrated. The server's
+// ladder and all club ladders share one.
+type maintenanceMode struct {
+	mu      sync.RWMutex
+	on      bool
+	message string
+}
+
+func (mm *maintenanceMode) set(on bool, message string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.on = on
+	mm.message = ""
+	if on {
+		mm.message = message
+	}
+}
+
+// check returns a *MaintenanceError while maintenance mode is on
+func (mm *maintenanceMode) check() error {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+	if mm.on {
+		return &MaintenanceError{Message: mm.message}
+	}
+	return nil
+}
+
+// maintenanceUnaryInterceptor reports writes refused during maintenance as UNAVAILABLE
+func maintenanceUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		var mErr *MaintenanceError
+		if errors.As(err, &mErr) {
+			return resp, status.Error(codes.Unavailable, mErr.Error())
+		}
+		return resp, err
+	}
+}
+
+// SetMaintenanceMode turns maintenance mode on or off for every ladder on the server
+func (h *LadderService) SetMaintenanceMode(ctx context.Context, req *ladderpb.SetMaintenanceModeRequest) (*ladderpb.SetMaintenanceModeResponse, error) {
+	h.model.maintenance.set(req.On, req.Message)
+	return &ladderpb.SetMaintenanceModeResponse{Success: true}, nil
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	svc := NewLadderService(m)
+	ctx := context.Background()
+
+	if _, err := svc.SetMaintenanceMode(ctx, &ladderpb.SetMaintenanceModeRequest{On: true, Message: "migrating"}); err != nil {
+		t.Fatalf("SetMaintenanceMode failed: %v", err)
+	}
+
+	_, err := m.AddPlayer("Bob", "bob")
+	var mErr *MaintenanceError
+	if !errors.As(err, &mErr) || mErr.Message != "migrating" {
+		t.Fatalf("expected a maintenance error, got %v", err)
+	}
+	if players := m.ListPlayers(); len(players) != 1 {
+		t.Errorf("expected reads to keep working, got %d players", len(players))
+	}
+
+	// Over gRPC the refusal is UNAVAILABLE
+	interceptor := maintenanceUnaryInterceptor()
+	_, err = interceptor(ctx, &ladderpb.AddPlayerRequest{Name: "Bob"}, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return svc.AddPlayer(ctx, req.(*ladderpb.AddPlayerRequest))
+	})
+	if s, _ := status.FromError(err); s.Code() != codes.Unavailable || s.Message() != "the ladder is in maintenance mode: migrating" {
+		t.Errorf("expected UNAVAILABLE with the message, got %v", err)
+	}
+
+	svc.SetMaintenanceMode(ctx, &ladderpb.SetMaintenanceModeRequest{On: false})
+	if _, err := m.AddPlayer("Bob", "bob"); err != nil {
+		t.Errorf("expected writes to resume, got %v", err)
+	}
+}
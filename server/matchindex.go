@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// matchEntry locates one MATCH_RESULT transaction in the log. Only what is needed to
+// skip invalidated matches and to replay ratings is held in memory; the full result is
+// read back from the log when it is returned.
+type matchEntry struct {
+	txID       string
+	offset     int64
+	length     int
+	challenger string
+	defender   string
+	winner     string
+	recordedMs int64
+
+	invalidated bool
+	friendly    bool    // Changes no rating
+	delta       float64 // Challenger's rating change; the defender's is the negation
+	attachments []*ladderpb.Attachment
+}
+
+// matchIndex is an in-memory index of the match results in a model's log. It is built
+// by one forward scan on first use and then kept current by appends, so GetRecentMatches
+// only touches the matches it returns regardless of how many invalidations there are.
+type matchIndex struct {
+	mu      sync.Mutex
+	built   bool
+	size    int64 // Bytes of the log covered by the index
+	entries []matchEntry
+	byID    map[string]int
+	byFile  map[string]int    // ATTACHMENT transaction ID to the entry of its match
+	ids     map[string]string // Interned player IDs
+	cipher  *logCipher        // nil when the log is not encrypted
+}
+
+func (x *matchIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.built = false
+	x.entries = nil
+	x.byID = nil
+	x.byFile = nil
+	x.ids = nil
+}
+
+// setCipher changes the log's encryption and drops the index, as offsets change when
+// the log is rewritten
+func (x *matchIndex) setCipher(c *logCipher) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.cipher = c
+	x.built = false
+	x.entries = nil
+	x.byID = nil
+	x.byFile = nil
+	x.ids = nil
+}
+
+func (x *matchIndex) intern(id string) string {
+	if s, ok := x.ids[id]; ok {
+		return s
+	}
+	x.ids[id] = id
+	return id
+}
+
+// ensureBuilt (re)builds the index if it has not been built yet or the log no longer
+// has the size the index expects, e.g. after it was rewritten or restored.
+// The caller must hold x.mu.
+func (x *matchIndex) ensureBuilt(path string) error {
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		x.built = true
+		x.size = 0
+		x.entries = nil
+		x.byID = make(map[string]int)
+		x.byFile = make(map[string]int)
+		x.ids = make(map[string]string)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if x.built && stat.Size() == x.size {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	x.built = false
+	x.size = 0
+	x.entries = nil
+	x.byID = make(map[string]int)
+	x.byFile = make(map[string]int)
+	x.ids = make(map[string]string)
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			x.add(line, false)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	x.recomputeRatings()
+	x.built = true
+	return nil
+}
+
+// add indexes one encoded log line starting at x.size. Undecodable lines are skipped.
+// Ratings are only brought up to date if updateRatings is set.
+func (x *matchIndex) add(line []byte, updateRatings bool) {
+	offset := x.size
+	x.size += int64(len(line))
+
+	t, err := decodeLogLine(line, x.cipher)
+	if err != nil {
+		return
+	}
+
+	switch t.Type {
+	case storagepb.TransactionType_MATCH_RESULT, storagepb.TransactionType_RETROACTIVE_MATCH:
+		mr := t.GetMatchResultPayload()
+		if mr == nil {
+			return
+		}
+		e := matchEntry{
+			txID:       t.Id,
+			offset:     offset,
+			length:     len(line),
+			challenger: x.intern(mr.ChallengerId),
+			defender:   x.intern(mr.DefenderId),
+			winner:     x.intern(mr.WinnerId),
+			recordedMs: t.TimestampMs,
+			friendly:   mr.Friendly,
+		}
+		x.byID[t.Id] = len(x.entries)
+		x.entries = append(x.entries, e)
+		if updateRatings {
+			x.recomputeRatings()
+		}
+	case storagepb.TransactionType_INVALIDATE_MATCH:
+		inv := t.GetInvalidateMatchPayload()
+		if inv == nil {
+			return
+		}
+		changed := false
+		for _, id := range replay.InvalidatedIDs(inv) {
+			if i, ok := x.byID[id]; ok && !x.entries[i].invalidated {
+				x.entries[i].invalidated = true
+				changed = true
+			}
+			if i, ok := x.byFile[id]; ok {
+				e := &x.entries[i]
+				for j, a := range e.attachments {
+					if a.Id == id {
+						e.attachments = append(e.attachments[:j:j], e.attachments[j+1:]...)
+						break
+					}
+				}
+				delete(x.byFile, id)
+			}
+		}
+		if changed && updateRatings {
+			x.recomputeRatings()
+		}
+	case storagepb.TransactionType_ATTACHMENT:
+		p := t.GetAttachmentPayload()
+		if p == nil {
+			return
+		}
+		if i, ok := x.byID[p.MatchTransactionId]; ok {
+			x.entries[i].attachments = append(x.entries[i].attachments, attachmentFromStorage(t))
+			x.byFile[t.Id] = i
+		}
+	}
+}
+
+// recomputeRatings replays every valid match in memory, matching computeRatings
+func (x *matchIndex) recomputeRatings() {
+	ratings := make(map[string]float64)
+	rating := func(id string) float64 {
+		if r, ok := ratings[id]; ok {
+			return r
+		}
+		return initialRating
+	}
+	for i := range x.entries {
+		e := &x.entries[i]
+		if e.invalidated || e.friendly {
+			e.delta = 0
+			continue
+		}
+		c, d := rating(e.challenger), rating(e.defender)
+		e.delta = eloDelta(c, d, e.winner == e.challenger)
+		ratings[e.challenger] = c + e.delta
+		ratings[e.defender] = d - e.delta
+	}
+}
+
+// ratings returns the current rating of every player with a rated match, as
+// computeRatings does, without reading the log once the index is built
+func (x *matchIndex) ratings(path string) (map[string]float64, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.ensureBuilt(path); err != nil {
+		return nil, err
+	}
+	ratings := make(map[string]float64)
+	rating := func(id string) float64 {
+		if r, ok := ratings[id]; ok {
+			return r
+		}
+		return initialRating
+	}
+	for _, e := range x.entries {
+		if e.invalidated || e.friendly {
+			continue
+		}
+		c, d := rating(e.challenger), rating(e.defender)
+		ratings[e.challenger] = c + e.delta
+		ratings[e.defender] = d - e.delta
+	}
+	return ratings, nil
+}
+
+// recordedSince reports whether a valid match between a and b, either way round,
+// was recorded at or after sinceMs
+func (x *matchIndex) recordedSince(path, a, b string, sinceMs int64) (bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.ensureBuilt(path); err != nil {
+		return false, err
+	}
+	for i := len(x.entries) - 1; i >= 0; i-- {
+		e := x.entries[i]
+		if e.invalidated || e.recordedMs < sinceMs {
+			continue
+		}
+		if (e.challenger == a && e.defender == b) || (e.challenger == b && e.defender == a) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// appended updates a built index with a line just written to the end of the log
+func (x *matchIndex) appended(line []byte) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.built {
+		x.add(line, true)
+	}
+}
+
+// recent returns up to limit valid matches, newest first, reading each from the log
+func (x *matchIndex) recent(path string, limit int32) ([]*ladderpb.MatchResult, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if err := x.ensureBuilt(path); err != nil {
+		return nil, err
+	}
+
+	matches := []*ladderpb.MatchResult{}
+	if limit <= 0 || len(x.entries) == 0 {
+		return matches, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	for i := len(x.entries) - 1; i >= 0 && int32(len(matches)) < limit; i-- {
+		e := x.entries[i]
+		if e.invalidated {
+			continue
+		}
+		buf := make([]byte, e.length)
+		if _, err := file.ReadAt(buf, e.offset); err != nil {
+			return nil, err
+		}
+		t, err := decodeLogLine(buf, x.cipher)
+		if err != nil {
+			return nil, err
+		}
+		mr := matchResultFromStorage(t)
+		mr.ChallengerRatingDelta = e.delta
+		mr.DefenderRatingDelta = -e.delta
+		mr.Attachments = e.attachments
+		matches = append(matches, mr)
+	}
+	return matches, nil
+}
+
+// decodeLogLine decodes one transaction from the log. c may be nil for a log that
+// is not encrypted.
+func decodeLogLine(line []byte, c *logCipher) (*storagepb.TransactionStorage, error) {
+	data, err := c.open(string(line))
+	if err != nil {
+		return nil, err
+	}
+	var t storagepb.TransactionStorage
+	if err := proto.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestMatchIndex_SkipsInvalidatedMatches(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+
+	// Build the index before the interesting writes so they go through the append path
+	if _, err := m.GetRecentMatches(5); err != nil {
+		t.Fatalf("GetRecentMatches failed: %v", err)
+	}
+
+	var kept []string
+	for i := 0; i < 20; i++ {
+		txID, err := m.AddMatchResult("bob", "alice", "bob", sets)
+		if err != nil {
+			t.Fatalf("AddMatchResult failed: %v", err)
+		}
+		if i%4 == 0 {
+			kept = append(kept, txID)
+			continue
+		}
+		if err := m.InvalidateMatchResult(context.Background(), txID); err != nil {
+			t.Fatalf("InvalidateMatchResult failed: %v", err)
+		}
+	}
+
+	check := func(label string, m *Model) {
+		matches, err := m.GetRecentMatches(3)
+		if err != nil {
+			t.Fatalf("%s: GetRecentMatches failed: %v", label, err)
+		}
+		if len(matches) != 3 {
+			t.Fatalf("%s: expected 3 matches, got %d", label, len(matches))
+		}
+		for i, mr := range matches {
+			if want := kept[len(kept)-1-i]; mr.TransactionId != want {
+				t.Errorf("%s: match %d is %s, want %s", label, i, mr.TransactionId, want)
+			}
+			change, err := m.MatchRatingChange(mr.TransactionId)
+			if err != nil {
+				t.Fatalf("%s: MatchRatingChange failed: %v", label, err)
+			}
+			if mr.ChallengerRatingDelta != change.ChallengerDelta || mr.DefenderRatingDelta != change.DefenderDelta {
+				t.Errorf("%s: match %d has deltas %v/%v, want %v/%v", label, i,
+					mr.ChallengerRatingDelta, mr.DefenderRatingDelta, change.ChallengerDelta, change.DefenderDelta)
+			}
+		}
+	}
+
+	check("incremental", m)
+
+	// A fresh model builds the same index from a single scan
+	fresh, err := NewModel(path)
+	if err != nil {
+		t.Fatalf("NewModel failed: %v", err)
+	}
+	check("rebuilt", fresh)
+
+	// Rewriting the log drops the index so it is rebuilt against the new file
+	m.mu.Lock()
+	txs, err := m.readTransactionsLocked()
+	if err == nil {
+		err = m.rewriteLogLocked(txs)
+	}
+	m.mu.Unlock()
+	if err != nil {
+		t.Fatalf("rewrite failed: %v", err)
+	}
+	check("after rewrite", m)
+}
+
+func TestMatchIndex_FriendliesChangeNoRating(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	if _, err := m.GetRecentMatches(5); err != nil {
+		t.Fatalf("GetRecentMatches failed: %v", err)
+	}
+	if _, err := m.AddMatchResultAt("bob", "alice", "bob", sets, time.Time{}, false, true); err != nil {
+		t.Fatalf("AddMatchResultAt failed: %v", err)
+	}
+	txID, err := m.AddMatchResult("bob", "alice", "bob", sets)
+	if err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	change, err := m.MatchRatingChange(txID)
+	if err != nil {
+		t.Fatalf("MatchRatingChange failed: %v", err)
+	}
+
+	fresh, err := NewModel(path)
+	if err != nil {
+		t.Fatalf("NewModel failed: %v", err)
+	}
+	for label, m := range map[string]*Model{"incremental": m, "rebuilt": fresh} {
+		matches, err := m.GetRecentMatches(2)
+		if err != nil || len(matches) != 2 {
+			t.Fatalf("%s: expected 2 matches, got %v, %v", label, matches, err)
+		}
+		if matches[0].ChallengerRatingDelta != change.ChallengerDelta {
+			t.Errorf("%s: expected the match after the friendly to have delta %v, got %v", label, change.ChallengerDelta, matches[0].ChallengerRatingDelta)
+		}
+		if !matches[1].Friendly || matches[1].ChallengerRatingDelta != 0 || matches[1].DefenderRatingDelta != 0 {
+			t.Errorf("%s: expected the friendly to change no rating, got %+v", label, matches[1])
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package server
 
 import (
-	"encoding/base64"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"strings"
 	"sync"
@@ -10,23 +13,56 @@ import (
 
 	ladderpb "squash-ladder/server/gen/ladder"
 	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+	"squash-ladder/server/version"
 
-	"github.com/google/uuid"
 	"github.com/icza/backscanner"
-	"google.golang.org/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// maxLogLineSize bounds a single encoded transaction when reading the log forwards
+const maxLogLineSize = 16 * 1024 * 1024
+
 // Model manages the state of the squash ladder
 type Model struct {
+	*modelState
+	// client is recorded on the transactions written through this handle; see withClient
+	client *storagepb.ClientStorage
+}
+
+// modelState is a ladder's state, shared by the handles of the ladder
+type modelState struct {
 	mu          sync.RWMutex
 	LogFilePath string
+	quota       *ladderpb.ClubQuota // nil means unlimited
+	writer      *logWriter          // opened on the first append
+	matches     matchIndex
+	rules       rulesCache
+	waiting     waitingCache
+	maintenance *maintenanceMode // Shared with club ladders when hosting several
+
+	checkpointInterval int         // zero uses defaultCheckpointInterval
+	encoder            *logEncoder // nil until the next append rebuilds it
+	cipher             *logCipher  // nil when the log is not encrypted
+
+	clock Clock       // nil uses the system clock
+	ids   IDGenerator // nil uses random UUIDs
+
+	listenersMu sync.Mutex
+	listeners   []func(LadderChange)
+	changeSeq   uint64 // Last LadderChange.Seq handed to listeners
+
+	presence presenceBoard // Players looking for a game; not logged
+	live     liveScoring   // Matches being scored point by point; not logged
 }
 
 // NewModel creates a new model
 func NewModel(logFilePath string) (*Model, error) {
-	return &Model{
+	return &Model{modelState: &modelState{
 		LogFilePath: logFilePath,
-	}, nil
+		maintenance: &maintenanceMode{},
+	}}, nil
 }
 
 // Helper to convert storage players to ladder players
@@ -34,9 +70,16 @@ func storageToLadder(sPlayers []*storagepb.PlayerStorage) []*ladderpb.Player {
 	lPlayers := make([]*ladderpb.Player, len(sPlayers))
 	for i, sp := range sPlayers {
 		lPlayers[i] = &ladderpb.Player{
-			Id:   sp.Id,
-			Name: sp.Name,
-			Rank: sp.Rank,
+			Id:       sp.Id,
+			Name:     sp.Name,
+			Rank:     sp.Rank,
+			Handicap: sp.Handicap,
+			Category: ladderpb.PlayerCategory(sp.Category),
+
+			Provisional:                sp.Provisional,
+			QualificationMatchesPlayed: sp.QualificationMatchesPlayed,
+			ProtectedFromMs:            sp.ProtectedFromMs,
+			ProtectedUntilMs:           sp.ProtectedUntilMs,
 		}
 	}
 	return lPlayers
@@ -47,15 +90,22 @@ func ladderToStorage(lPlayers []*ladderpb.Player) []*storagepb.PlayerStorage {
 	sPlayers := make([]*storagepb.PlayerStorage, len(lPlayers))
 	for i, lp := range lPlayers {
 		sPlayers[i] = &storagepb.PlayerStorage{
-			Id:   lp.Id,
-			Name: lp.Name,
-			Rank: lp.Rank,
+			Id:       lp.Id,
+			Name:     lp.Name,
+			Rank:     lp.Rank,
+			Handicap: lp.Handicap,
+			Category: storagepb.PlayerCategoryStorage(lp.Category),
+
+			Provisional:                lp.Provisional,
+			QualificationMatchesPlayed: lp.QualificationMatchesPlayed,
+			ProtectedFromMs:            lp.ProtectedFromMs,
+			ProtectedUntilMs:           lp.ProtectedUntilMs,
 		}
 	}
 	return sPlayers
 }
 
-// CurrentState reads the log backwards to find the last transaction and return its player list
+// CurrentState reads the log backwards to the last checkpoint and returns the current player list
 func (m *Model) CurrentState() ([]*ladderpb.Player, error) {
 	file, err := os.Open(m.LogFilePath)
 	if os.IsNotExist(err) {
@@ -75,150 +125,39 @@ func (m *Model) CurrentState() ([]*ladderpb.Player, error) {
 		return []*ladderpb.Player{}, nil
 	}
 
-	scanner := backscanner.New(file, int(stat.Size()))
-
-	// Scan backwards for the first valid line
-	for {
-		line, _, err := scanner.Line()
-		if err != nil {
-			// EOF or other error
-			if err.Error() == "EOF" { // backscanner returns EOF when done
-				return []*ladderpb.Player{}, nil
-			}
-			return nil, err
-		}
-
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		// Decode Base64
-		data, err := base64.StdEncoding.DecodeString(line)
-		if err != nil {
-			// If we can't decode, maybe it's corrupted or old format?
-			// We treat it as error for now.
-			return nil, fmt.Errorf("failed to decode line: %v", err)
-		}
-
-		var lastTx storagepb.TransactionStorage
-		if err := proto.Unmarshal(data, &lastTx); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal last transaction: %v", err)
-		}
-
-		return storageToLadder(lastTx.PlayerList), nil
+	players, _, err := scanBackToCheckpoint(backscanner.New(file, int(stat.Size())), m.cipher)
+	if err != nil {
+		return nil, err
 	}
+	return storageToLadder(players), nil
 }
 
-// applyTransactionLogic calculates the NEW player state based on a transaction type and payload.
+// applyTransactionLogic calculates the new player state for a transaction, with the
+// replay package's errors turned into catalog messages
 func (m *Model) applyTransactionLogic(txType storagepb.TransactionType, payload interface{}, currentPlayers []*ladderpb.Player) ([]*ladderpb.Player, error) {
-	// Deep copy players
-	players := make([]*ladderpb.Player, len(currentPlayers))
-	for i, p := range currentPlayers {
-		players[i] = &ladderpb.Player{
-			Id:   p.Id,
-			Name: p.Name,
-			Rank: p.Rank,
-		}
-	}
-
-	switch txType {
-	case storagepb.TransactionType_ADD_PLAYER:
-		p, ok := payload.(*storagepb.AddPlayerStorage)
-		if !ok {
-			return nil, fmt.Errorf("invalid payload type for ADD_PLAYER")
-		}
-		// Check duplicates
-		for _, pl := range players {
-			if pl.Id == p.PlayerId {
-				return nil, fmt.Errorf("player ID already exists")
-			}
-		}
-		newPlayer := &ladderpb.Player{
-			Id:   p.PlayerId,
-			Name: p.Name,
-			Rank: int32(len(players) + 1),
-		}
-		players = append(players, newPlayer)
-
-	case storagepb.TransactionType_REMOVE_PLAYER:
-		p, ok := payload.(*storagepb.RemovePlayerStorage)
-		if !ok {
-			return nil, fmt.Errorf("invalid payload type for REMOVE_PLAYER")
-		}
-		idx := -1
-		for i, pl := range players {
-			if pl.Id == p.PlayerId {
-				idx = i
-				break
-			}
-		}
-		if idx == -1 {
-			return nil, fmt.Errorf("player not found")
-		}
-		players = append(players[:idx], players[idx+1:]...)
-		// Re-rank
-		for i := idx; i < len(players); i++ {
-			players[i].Rank = int32(i + 1)
-		}
-
-	case storagepb.TransactionType_MATCH_RESULT:
-		p, ok := payload.(*storagepb.MatchResultStorage)
-		if !ok {
-			return nil, fmt.Errorf("invalid payload type for MATCH_RESULT")
-		}
-
-		challengerIdx := -1
-		defenderIdx := -1
-		for i, pl := range players {
-			if pl.Id == p.ChallengerId {
-				challengerIdx = i
-			}
-			if pl.Id == p.DefenderId {
-				defenderIdx = i
-			}
-		}
-
-		if challengerIdx == -1 || defenderIdx == -1 {
-			return nil, fmt.Errorf("challenger or defender not found")
-		}
-
-		winnerIdx := -1
-		loserIdx := -1
-		if p.WinnerId == p.ChallengerId {
-			winnerIdx = challengerIdx
-			loserIdx = defenderIdx
-		} else {
-			winnerIdx = defenderIdx
-			loserIdx = challengerIdx
-		}
-
-		// Only change rank if winner is below loser
-		if winnerIdx > loserIdx {
-			// Winner takes loser's position
-			winner := players[winnerIdx]
-
-			// Shift everyone from loserIdx to winnerIdx-1 down one spot
-			copy(players[loserIdx+1:winnerIdx+1], players[loserIdx:winnerIdx])
-
-			// Place winner at loser's old spot
-			players[loserIdx] = winner
-
-			// Re-assign ranks
-			for i := loserIdx; i <= winnerIdx; i++ {
-				players[i].Rank = int32(i + 1)
-			}
-		}
-
-	case storagepb.TransactionType_INVALIDATE_MATCH:
-		// We don't apply logic on top of current state for invalidation
-		// because invalidation requires replay.
-		return currentPlayers, nil
+	players, err := replay.Apply(txType, payload, currentPlayers)
+	if err != nil {
+		return nil, localizeReplayError(err)
 	}
-
 	return players, nil
 }
 
+// localizeReplayError returns the catalog form of an error from the replay package
+func localizeReplayError(err error) error {
+	var unknown *replay.UnknownPlayerError
+	switch {
+	case errors.As(err, &unknown):
+		return localizedErrorf("player not found: %s", unknown.PlayerID)
+	case errors.Is(err, replay.ErrDuplicatePlayer):
+		return localizedErrorf("player ID already exists")
+	case errors.Is(err, replay.ErrPlayerNotFound):
+		return localizedErrorf("player not found")
+	case errors.Is(err, replay.ErrMatchPlayerNotFound):
+		return localizedErrorf("challenger or defender not found")
+	}
+	return err
+}
+
 // ListPlayers returns the current player list
 func (m *Model) ListPlayers() []*ladderpb.Player {
 	m.mu.RLock()
@@ -234,13 +173,25 @@ func (m *Model) ListPlayers() []*ladderpb.Player {
 
 // AddPlayer adds a player to the ladder
 func (m *Model) AddPlayer(name, playerID string) (*ladderpb.Player, error) {
+	return m.AddPlayerInCategory(name, playerID, ladderpb.PlayerCategory_CATEGORY_NONE)
+}
+
+// AddPlayerInCategory adds a player in the given category where the rules' join
+// position puts them.
+// While the rules ask for qualification matches the player joins as provisional.
+func (m *Model) AddPlayerInCategory(name, playerID string, category ladderpb.PlayerCategory) (*ladderpb.Player, error) {
 	if playerID == "" {
-		playerID = uuid.New().String()
+		playerID = m.newID()
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	return m.addPlayerLocked(name, playerID, category, false)
+}
+
+// addPlayerLocked adds a player unless the ladder is full. The caller must hold m.mu.
+func (m *Model) addPlayerLocked(name, playerID string, category ladderpb.PlayerCategory, fromWaitingList bool) (*ladderpb.Player, error) {
 	// 1. Get Current State
 	currentPlayers, err := m.CurrentState()
 	if err != nil {
@@ -248,9 +199,33 @@ func (m *Model) AddPlayer(name, playerID string) (*ladderpb.Player, error) {
 	}
 
 	// 2. Prepare Payload
+	rules, err := m.currentRulesLocked()
+	if err != nil {
+		return nil, err
+	}
+	if rules.MaxPlayers > 0 && len(currentPlayers) >= int(rules.MaxPlayers) {
+		return nil, localizedStatusf(codes.FailedPrecondition, "the ladder is full at %d players; join the waiting list instead", rules.MaxPlayers)
+	}
 	payload := &storagepb.AddPlayerStorage{
 		PlayerId: playerID,
 		Name:     name,
+		Category: storagepb.PlayerCategoryStorage(category),
+		// The first players of a ladder have nobody ranked to qualify against
+		Provisional:     rules.QualificationMatches > 0 && replay.RankedCount(currentPlayers) > 0,
+		FromWaitingList: fromWaitingList,
+		JoinPosition:    storagepb.JoinPositionStorage(rules.JoinPosition),
+	}
+	if payload.JoinPosition == storagepb.JoinPositionStorage_JOIN_BY_RATING {
+		// Worked out now and kept, so replays do not depend on later results
+		ratings, err := m.matches.ratings(m.LogFilePath)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range currentPlayers {
+			if r, ok := ratings[p.Id]; ok && !p.Provisional && r > initialRating {
+				payload.RatedAbove++
+			}
+		}
 	}
 
 	// 3. Compute New State
@@ -261,9 +236,9 @@ func (m *Model) AddPlayer(name, playerID string) (*ladderpb.Player, error) {
 
 	// 4. Create Transaction
 	tx := &storagepb.TransactionStorage{
-		Id:          uuid.New().String(),
+		Id:          m.newID(),
 		Type:        storagepb.TransactionType_ADD_PLAYER,
-		TimestampMs: time.Now().UnixMilli(),
+		TimestampMs: m.now().UnixMilli(),
 		Payload:     &storagepb.TransactionStorage_AddPlayerPayload{AddPlayerPayload: payload},
 		PlayerList:  ladderToStorage(newPlayers),
 	}
@@ -273,29 +248,138 @@ func (m *Model) AddPlayer(name, playerID string) (*ladderpb.Player, error) {
 		return nil, err
 	}
 
-	return newPlayers[len(newPlayers)-1], nil
+	for _, p := range newPlayers {
+		if p.Id == playerID {
+			return p, nil
+		}
+	}
+	return nil, localizedErrorf("player not found")
 }
 
 func (m *Model) writeTransactionLocked(tx *storagepb.TransactionStorage) error {
-	file, err := os.OpenFile(m.LogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+	if err := m.maintenance.check(); err != nil {
 		return err
 	}
-	defer file.Close()
 
-	data, err := proto.Marshal(tx)
+	var before []*ladderpb.Player
+	if m.hasListeners() {
+		before, _ = m.CurrentState()
+	}
+
+	enc, err := m.encoderLocked()
 	if err != nil {
 		return err
 	}
+	tx.ServerVersion = version.Version
+	tx.Client = m.client
+	line, checkpoint, err := enc.encode(tx)
+	if err != nil {
+		return err
+	}
+	if err := m.checkQuotaLocked(tx, int64(len(line))); err != nil {
+		return err
+	}
+	if err := m.appendLineLocked(line); err != nil {
+		// The write may have partly reached the file; resync from disk next time
+		m.encoder = nil
+		return err
+	}
+	enc.advance(tx, line, checkpoint)
+	m.rules.appended(tx, len(line))
+	m.waiting.appended(tx, len(line))
 
-	encoded := base64.StdEncoding.EncodeToString(data)
+	m.notifyListeners(LadderChange{
+		Transaction: tx,
+		Before:      before,
+		After:       storageToLadder(tx.PlayerList),
+	})
+	return nil
+}
 
-	if _, err := file.WriteString(encoded + "\n"); err != nil {
+func (m *Model) appendLineLocked(line []byte) error {
+	if m.writer == nil {
+		m.writer = newLogWriter(m.LogFilePath)
+	}
+	if err := m.writer.append(line); err != nil {
 		return err
 	}
+	m.matches.appended(line)
+	return nil
+}
+
+// Close releases the log file. The model can still be used afterwards; the writer
+// is reopened on the next append.
+func (m *Model) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.writer != nil {
+		m.writer.close()
+		m.writer = nil
+	}
+}
+
+// readTransactionsLocked reads the whole log from the start, in write order.
+// The caller must hold m.mu.
+func (m *Model) readTransactionsLocked() ([]*storagepb.TransactionStorage, error) {
+	return m.readTransactionsContextLocked(context.Background())
+}
+
+// contextCheckInterval is how many log lines a scan reads between checks of its context
+const contextCheckInterval = 256
+
+// contextErr returns nil while ctx is live, and otherwise the status a cancelled
+// request or one that ran out of time reports to the client
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
 	return nil
 }
 
+// readTransactionsContextLocked reads the log like readTransactionsLocked but gives up
+// once ctx is done
+func (m *Model) readTransactionsContextLocked(ctx context.Context) ([]*storagepb.TransactionStorage, error) {
+	file, err := os.Open(m.LogFilePath)
+	if os.IsNotExist(err) {
+		return []*storagepb.TransactionStorage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var txs []*storagepb.TransactionStorage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+	lineNo := 0
+	for scanner.Scan() {
+		if lineNo%contextCheckInterval == 0 {
+			if err := contextErr(ctx); err != nil {
+				return nil, err
+			}
+		}
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		t, err := decodeLogLine([]byte(line), m.cipher)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode line %d: %v", lineNo, err)
+		}
+		txs = append(txs, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := resolveSnapshots(txs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
 // RemovePlayer removes a player from the ladder
 func (m *Model) RemovePlayer(playerID string) error {
 	m.mu.Lock()
@@ -314,46 +398,47 @@ func (m *Model) RemovePlayer(playerID string) error {
 	}
 
 	tx := &storagepb.TransactionStorage{
-		Id:          uuid.New().String(),
+		Id:          m.newID(),
 		Type:        storagepb.TransactionType_REMOVE_PLAYER,
-		TimestampMs: time.Now().UnixMilli(),
+		TimestampMs: m.now().UnixMilli(),
 		Payload:     &storagepb.TransactionStorage_RemovePlayerPayload{RemovePlayerPayload: payload},
 		PlayerList:  ladderToStorage(newPlayers),
 	}
 
-	return m.writeTransactionLocked(tx)
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return err
+	}
+	m.promoteWaitingLocked()
+	return nil
 }
 
-// AddMatchResult records a match
+// AddMatchResult records a match played now
 func (m *Model) AddMatchResult(challengerID, defenderID, winnerID string, setScores []*ladderpb.SetScore) (string, error) {
+	return m.AddMatchResultAt(challengerID, defenderID, winnerID, setScores, time.Time{}, false, false)
+}
+
+// AddMatchResultAt records a match played at playedAt, or now if it is zero, marking
+// it late if it was entered after the entry deadline. The result still takes effect
+// on the ladder in the order it was recorded, unless it is a friendly, which moves
+// nobody.
+func (m *Model) AddMatchResultAt(challengerID, defenderID, winnerID string, setScores []*ladderpb.SetScore, playedAt time.Time, late, friendly bool) (string, error) {
 	if winnerID != challengerID && winnerID != defenderID {
-		return "", fmt.Errorf("winner must be one of the players")
+		return "", localizedErrorf("winner must be one of the players")
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.addMatchResultLocked(challengerID, defenderID, winnerID, setScores, playedAt, late, friendly)
+}
 
+// addMatchResultLocked appends a match result. The caller must hold m.mu.
+func (m *Model) addMatchResultLocked(challengerID, defenderID, winnerID string, setScores []*ladderpb.SetScore, playedAt time.Time, late, friendly bool) (string, error) {
 	currentPlayers, err := m.CurrentState()
 	if err != nil {
 		return "", err
 	}
-
-	storageSetScores := make([]*storagepb.SetScoreStorage, len(setScores))
-	for i, s := range setScores {
-		storageSetScores[i] = &storagepb.SetScoreStorage{
-			ChallengerPoints:  s.ChallengerPoints,
-			DefenderPoints:    s.DefenderPoints,
-			ChallengerDefault: s.ChallengerDefault,
-			DefenderDefault:   s.DefenderDefault,
-		}
-	}
-
-	payload := &storagepb.MatchResultStorage{
-		ChallengerId: challengerID,
-		DefenderId:   defenderID,
-		WinnerId:     winnerID,
-		SetScores:    storageSetScores,
-	}
+	payload := matchPayload(currentPlayers, challengerID, defenderID, winnerID, setScores, playedAt, late)
+	payload.Friendly = friendly
 
 	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_MATCH_RESULT, payload, currentPlayers)
 	if err != nil {
@@ -361,9 +446,9 @@ func (m *Model) AddMatchResult(challengerID, defenderID, winnerID string, setSco
 	}
 
 	tx := &storagepb.TransactionStorage{
-		Id:          uuid.New().String(),
+		Id:          m.newID(),
 		Type:        storagepb.TransactionType_MATCH_RESULT,
-		TimestampMs: time.Now().UnixMilli(),
+		TimestampMs: m.now().UnixMilli(),
 		Payload:     &storagepb.TransactionStorage_MatchResultPayload{MatchResultPayload: payload},
 		PlayerList:  ladderToStorage(newPlayers),
 	}
@@ -372,230 +457,133 @@ func (m *Model) AddMatchResult(challengerID, defenderID, winnerID string, setSco
 		return "", err
 	}
 
+	if err := m.placeQualifiedLocked(newPlayers, challengerID, defenderID); err != nil {
+		log.Printf("Failed to place qualified players: %v", err)
+	}
 	return tx.Id, nil
 }
 
-// InvalidateMatchResult undoes a transaction by rebuilding the state without it
-func (m *Model) InvalidateMatchResult(txID string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	file, err := os.Open(m.LogFilePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return err
-	}
-
-	scanner := backscanner.New(file, int(stat.Size()))
-
-	var replayStack []*storagepb.TransactionStorage
-	var found bool
-	var currentPlayers []*ladderpb.Player
-
-	// Scan backwards to find the target transaction
-	for {
-		line, _, err := scanner.Line()
-		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-			return err
-		}
-
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		data, err := base64.StdEncoding.DecodeString(line)
-		if err != nil {
-			return err
-		}
-
-		var t storagepb.TransactionStorage
-		if err := proto.Unmarshal(data, &t); err != nil {
-			return err
+// matchPayload is the stored form of a match, with the head starts given by the
+// handicaps of players
+func matchPayload(players []*ladderpb.Player, challengerID, defenderID, winnerID string, setScores []*ladderpb.SetScore, playedAt time.Time, late bool) *storagepb.MatchResultStorage {
+	storageSetScores := make([]*storagepb.SetScoreStorage, len(setScores))
+	for i, s := range setScores {
+		storageSetScores[i] = &storagepb.SetScoreStorage{
+			ChallengerPoints:  s.ChallengerPoints,
+			DefenderPoints:    s.DefenderPoints,
+			ChallengerDefault: s.ChallengerDefault,
+			DefenderDefault:   s.DefenderDefault,
+			DurationSeconds:   s.DurationSeconds,
 		}
-
-		if t.Id == txID {
-			if t.Type != storagepb.TransactionType_MATCH_RESULT {
-				return fmt.Errorf("can only invalidate match results")
-			}
-			found = true
-
-			// The player state *before* this transaction is the list from the previous transaction
-			// (which is next in backward scan)
-			for {
-				prevLine, _, err := scanner.Line()
-				if err != nil {
-					if err.Error() == "EOF" {
-						// Start of log
-						currentPlayers = []*ladderpb.Player{}
-						break
-					}
-					return err
-				}
-				prevLine = strings.TrimSpace(prevLine)
-				if prevLine == "" {
-					continue
-				}
-
-				prevData, err := base64.StdEncoding.DecodeString(prevLine)
-				if err != nil {
-					return err
-				}
-				var prevTx storagepb.TransactionStorage
-				if err := proto.Unmarshal(prevData, &prevTx); err != nil {
-					return err
-				}
-				currentPlayers = storageToLadder(prevTx.PlayerList)
-				break
-			}
-			break
+		for _, p := range s.Points {
+			storageSetScores[i].Points = append(storageSetScores[i].Points, storagepb.PointWinnerStorage(p))
 		}
-
-		replayStack = append(replayStack, &t)
 	}
 
-	if !found {
-		return fmt.Errorf("transaction not found")
-	}
-
-	// 3. Replay (reverse of replayStack)
-	for i := len(replayStack) - 1; i >= 0; i-- {
-		t := replayStack[i]
-
-		// Extract payload interface based on oneof
-		var payload interface{}
-		switch t.Type {
-		case storagepb.TransactionType_ADD_PLAYER:
-			payload = t.GetAddPlayerPayload()
-		case storagepb.TransactionType_REMOVE_PLAYER:
-			payload = t.GetRemovePlayerPayload()
-		case storagepb.TransactionType_MATCH_RESULT:
-			payload = t.GetMatchResultPayload()
-		case storagepb.TransactionType_INVALIDATE_MATCH:
-			// No state change logic for this, just pass through
-			continue
-		}
+	challengerStart, defenderStart := handicapStarts(players, challengerID, defenderID)
+	payload := &storagepb.MatchResultStorage{
+		ChallengerId:       challengerID,
+		DefenderId:         defenderID,
+		WinnerId:           winnerID,
+		SetScores:          storageSetScores,
+		ChallengerHandicap: challengerStart,
+		DefenderHandicap:   defenderStart,
+		LateEntry:          late,
+	}
+	if !playedAt.IsZero() {
+		payload.PlayedAtMs = playedAt.UnixMilli()
+	}
+	return payload
+}
 
-		newPlayers, err := m.applyTransactionLogic(t.Type, payload, currentPlayers)
-		if err != nil {
-			return fmt.Errorf("replay failed at tx %s: %v", t.Id, err)
-		}
-		currentPlayers = newPlayers
-	}
+// GetRecentMatches returns the last n matches that have not been invalidated
+func (m *Model) GetRecentMatches(limit int32) ([]*ladderpb.MatchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	// 4. Create Invalidate Transaction
-	payload := &storagepb.InvalidateMatchStorage{
-		InvalidatedTransactionId: txID,
-	}
+	return m.matches.recent(m.LogFilePath, limit)
+}
 
-	tx := &storagepb.TransactionStorage{
-		Id:          uuid.New().String(),
-		Type:        storagepb.TransactionType_INVALIDATE_MATCH,
-		TimestampMs: time.Now().UnixMilli(),
-		Payload:     &storagepb.TransactionStorage_InvalidateMatchPayload{InvalidateMatchPayload: payload},
-		PlayerList:  ladderToStorage(currentPlayers),
-	}
+// MatchRecordedSince reports whether a valid match between two players was
+// recorded at or after sinceMs
+func (m *Model) MatchRecordedSince(a, b string, sinceMs int64) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	return m.writeTransactionLocked(tx)
+	return m.matches.recordedSince(m.LogFilePath, a, b, sinceMs)
 }
 
-// GetRecentMatches returns the last n matches
-func (m *Model) GetRecentMatches(limit int32) ([]*ladderpb.MatchResult, error) {
+// MatchesBetween returns the valid matches played from fromMs up to but excluding
+// toMs, oldest first, with the names of every player who has been on the ladder
+func (m *Model) MatchesBetween(ctx context.Context, fromMs, toMs int64) ([]*ladderpb.MatchResult, map[string]string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	file, err := os.Open(m.LogFilePath)
-	if os.IsNotExist(err) {
-		return []*ladderpb.MatchResult{}, nil
-	}
+	txs, err := m.readTransactionsContextLocked(ctx)
 	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	scanner := backscanner.New(file, int(stat.Size()))
-
-	var matches []*ladderpb.MatchResult
-	invalidatedIds := make(map[string]bool)
-	count := int32(0)
-
-	for {
-		if count >= limit {
-			break
-		}
-
-		line, _, err := scanner.Line()
-		if err != nil {
-			if err.Error() == "EOF" {
-				break
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
 			}
-			return nil, err
-		}
-
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		data, err := base64.StdEncoding.DecodeString(line)
-		if err != nil {
-			continue // skip bad lines
 		}
+	}
 
-		var t storagepb.TransactionStorage
-		if err := proto.Unmarshal(data, &t); err != nil {
+	attachments := matchAttachments(txs)
+	matches := []*ladderpb.MatchResult{}
+	for _, t := range txs {
+		if t.GetMatchResultPayload() == nil || invalidated[t.Id] || playedAtMs(t) < fromMs || playedAtMs(t) >= toMs {
 			continue
 		}
+		mr := matchResultFromStorage(t)
+		mr.Attachments = attachments[t.Id]
+		matches = append(matches, mr)
+	}
+	return matches, playerNames(txs), nil
+}
 
-		if t.Type == storagepb.TransactionType_INVALIDATE_MATCH {
-			inv := t.GetInvalidateMatchPayload()
-			if inv != nil {
-				invalidatedIds[inv.InvalidatedTransactionId] = true
-			}
-		} else if t.Type == storagepb.TransactionType_MATCH_RESULT {
-			if invalidatedIds[t.Id] {
-				continue // Skip invalidated matches
-			}
-
-			mr := t.GetMatchResultPayload()
-			if mr == nil {
-				continue
-			}
+// playedAtMs returns when the match of a MATCH_RESULT transaction was played
+func playedAtMs(t *storagepb.TransactionStorage) int64 {
+	if ms := t.GetMatchResultPayload().GetPlayedAtMs(); ms != 0 {
+		return ms
+	}
+	return t.TimestampMs
+}
 
-			setScores := make([]*ladderpb.SetScore, len(mr.SetScores))
-			for j, s := range mr.SetScores {
-				setScores[j] = &ladderpb.SetScore{
-					ChallengerPoints:  s.ChallengerPoints,
-					DefenderPoints:    s.DefenderPoints,
-					ChallengerDefault: s.ChallengerDefault,
-					DefenderDefault:   s.DefenderDefault,
-				}
-			}
+// matchResultFromStorage converts a MATCH_RESULT transaction to its API form
+func matchResultFromStorage(t *storagepb.TransactionStorage) *ladderpb.MatchResult {
+	mr := t.GetMatchResultPayload()
 
-			matches = append(matches, &ladderpb.MatchResult{
-				ChallengerId:  mr.ChallengerId,
-				DefenderId:    mr.DefenderId,
-				WinnerId:      mr.WinnerId,
-				SetScores:     setScores,
-				TimestampMs:   t.TimestampMs,
-				TransactionId: t.Id,
-			})
-			count++
+	setScores := make([]*ladderpb.SetScore, len(mr.SetScores))
+	for j, s := range mr.SetScores {
+		setScores[j] = &ladderpb.SetScore{
+			ChallengerPoints:  s.ChallengerPoints,
+			DefenderPoints:    s.DefenderPoints,
+			ChallengerDefault: s.ChallengerDefault,
+			DefenderDefault:   s.DefenderDefault,
+			DurationSeconds:   s.DurationSeconds,
+		}
+		for _, p := range s.Points {
+			setScores[j].Points = append(setScores[j].Points, ladderpb.PointWinner(p))
 		}
 	}
 
-	return matches, nil
+	return &ladderpb.MatchResult{
+		ChallengerId:       mr.ChallengerId,
+		DefenderId:         mr.DefenderId,
+		WinnerId:           mr.WinnerId,
+		SetScores:          setScores,
+		TimestampMs:        t.TimestampMs,
+		TransactionId:      t.Id,
+		ChallengerHandicap: mr.ChallengerHandicap,
+		DefenderHandicap:   mr.DefenderHandicap,
+		PlayedAtMs:         playedAtMs(t),
+		LateEntry:          mr.LateEntry,
+		Retroactive:        t.Type == storagepb.TransactionType_RETROACTIVE_MATCH,
+		Friendly:           mr.Friendly,
+	}
 }
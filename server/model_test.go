@@ -1,10 +1,16 @@
 package server
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func createTempModel(t *testing.T) (*Model, string) {
@@ -42,6 +48,43 @@ func TestModel_AddPlayer(t *testing.T) {
 	}
 }
 
+func TestModel_AddPlayer_JoinPosition(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	setPosition := func(position ladderpb.JoinPosition) {
+		t.Helper()
+		rules := DefaultLadderRules()
+		rules.JoinPosition = position
+		if _, err := m.SetLadderRules(rules); err != nil {
+			t.Fatalf("SetLadderRules failed: %v", err)
+		}
+	}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		m.AddPlayer(id, id)
+	}
+	setPosition(ladderpb.JoinPosition_JOIN_IN_MIDDLE)
+	m.AddPlayer("e", "e")
+	assertOrder(t, m, "a", "b", "e", "c", "d")
+
+	// D's win lifts their rating above the starting one, and A's below it
+	matchID, _ := m.AddMatchResult("d", "a", "d", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	setPosition(ladderpb.JoinPosition_JOIN_BY_RATING)
+	m.AddPlayer("f", "f")
+	assertOrder(t, m, "d", "f", "a", "b", "e", "c")
+
+	setPosition(ladderpb.JoinPosition_JOIN_AT_BOTTOM)
+	m.AddPlayer("g", "g")
+	assertOrder(t, m, "d", "f", "a", "b", "e", "c", "g")
+
+	// Replaying after an invalidation keeps each join where its own rules put it
+	if err := m.InvalidateMatchResult(context.Background(), matchID); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "a", "f", "b", "e", "c", "d", "g")
+}
+
 func TestModel_RemovePlayer(t *testing.T) {
 	m, path := createTempModel(t)
 	defer os.Remove(path)
@@ -117,7 +160,7 @@ func TestModel_InvalidateMatchResult(t *testing.T) {
 		t.Fatal("Bob should be #1")
 	}
 
-	err := m.InvalidateMatchResult(txID)
+	err := m.InvalidateMatchResult(context.Background(), txID)
 	if err != nil {
 		t.Fatalf("InvalidateMatchResult failed: %v", err)
 	}
@@ -128,6 +171,63 @@ func TestModel_InvalidateMatchResult(t *testing.T) {
 	}
 }
 
+func TestModel_InvalidateMatchResult_AfterEarlierInvalidation(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	win := []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+	}
+	first, _ := m.AddMatchResult("bob", "alice", "bob", win)
+	second, _ := m.AddMatchResult("carol", "alice", "carol", win)
+
+	if err := m.InvalidateMatchResult(context.Background(), first); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "carol", "alice", "bob")
+
+	// The snapshot before the second match still has the first one in it, so it must
+	// not come back
+	if err := m.InvalidateMatchResult(context.Background(), second); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "alice", "bob", "carol")
+}
+
+func TestModel_InvalidateMatchResult_DeadlineExceeded(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	txID, _ := m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if err := m.InvalidateMatchResult(ctx, txID); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if _, err := m.VerifyLog(ctx, false); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded from VerifyLog, got %v", err)
+	}
+
+	// Nothing was written, so the match still stands and can be undone later
+	assertOrder(t, m, "bob", "alice")
+	if err := m.InvalidateMatchResult(context.Background(), txID); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "alice", "bob")
+}
+
 func TestModel_GetRecentMatches(t *testing.T) {
 	m, path := createTempModel(t)
 	defer os.Remove(path)
@@ -176,3 +276,64 @@ func TestModel_Persistence(t *testing.T) {
 		t.Errorf("State not recovered correctly: %+v", players)
 	}
 }
+
+func TestModel_UndoLastTransaction(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+	})
+
+	undone, _, err := m.UndoLastTransaction(context.Background())
+	if err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	if undone.Type != storagepb.TransactionType_MATCH_RESULT {
+		t.Errorf("expected match to be undone first, got %s", undone.Type)
+	}
+	if m.ListPlayers()[0].Id != "alice" {
+		t.Fatal("Alice should be #1 after undoing the match")
+	}
+
+	// The next undo skips the invalidation and removes Bob
+	undone, _, err = m.UndoLastTransaction(context.Background())
+	if err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	if undone.Type != storagepb.TransactionType_ADD_PLAYER {
+		t.Errorf("expected add player to be undone, got %s", undone.Type)
+	}
+	if players := m.ListPlayers(); len(players) != 1 || players[0].Id != "alice" {
+		t.Errorf("expected only Alice left, got %+v", players)
+	}
+
+	m.UndoLastTransaction(context.Background())
+	if _, _, err := m.UndoLastTransaction(context.Background()); err == nil {
+		t.Error("expected error when there is nothing left to undo")
+	}
+}
+
+func TestModel_UndoLastTransaction_SkipsRenames(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("bob  smith", "bob")
+	if _, renameID, err := m.NormalizePlayerNames(ctx, false); err != nil || renameID == "" {
+		t.Fatalf("NormalizePlayerNames failed: %q %v", renameID, err)
+	}
+
+	undone, _, err := m.UndoLastTransaction(ctx)
+	if err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	if p := undone.GetAddPlayerPayload(); p == nil || p.PlayerId != "bob" {
+		t.Errorf("expected undo to skip the rename and remove Bob, got %s", undone.Type)
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// tidyName tidies a name typed or imported by hand: spaces are trimmed and
+// collapsed, and each part of a word between hyphens and apostrophes that is written
+// all in lower or upper case is capitalized, so "o'brien-SMITH" becomes
+// "O'Brien-Smith". Parts in mixed case, such as "McDonald", are left alone.
+func tidyName(name string) string {
+	words := strings.Fields(name)
+	for i, w := range words {
+		var b strings.Builder
+		for _, part := range strings.SplitAfter(w, "-") {
+			for _, piece := range strings.SplitAfter(part, "'") {
+				b.WriteString(capitalize(piece))
+			}
+		}
+		words[i] = b.String()
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalize writes a part of a name in lower case with a capital first letter,
+// unless it is already in mixed case
+func capitalize(part string) string {
+	if strings.ToLower(part) != part && strings.ToUpper(part) != part {
+		return part
+	}
+	runes := []rune(strings.ToLower(part))
+	if len(runes) > 0 {
+		runes[0] = unicode.ToTitle(runes[0])
+	}
+	return string(runes)
+}
+
+// NormalizePlayerNames tidies every player's name with tidyName, in each
+// transaction that holds it as well as on the ladder, then records the renames as a
+// RENAME_PLAYERS transaction. Erased players keep their pseudonyms. With dryRun it
+// only returns the renames it would make. It returns them ordered by new name, with
+// the ID of the new transaction, which is empty when no name changes.
+func (m *Model) NormalizePlayerNames(ctx context.Context, dryRun bool) ([]*ladderpb.PlayerRename, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !dryRun {
+		if err := m.maintenance.check(); err != nil {
+			return nil, "", err
+		}
+	}
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	erased := make(map[string]bool)
+	for _, t := range txs {
+		if p := t.GetErasePlayerPayload(); p != nil {
+			erased[p.PlayerId] = true
+		}
+	}
+	newNames := make(map[string]string)
+	var renames []*ladderpb.PlayerRename
+	for id, name := range playerNames(txs) {
+		normalized := tidyName(name)
+		if erased[id] || normalized == "" || normalized == name {
+			continue
+		}
+		newNames[id] = normalized
+		renames = append(renames, &ladderpb.PlayerRename{PlayerId: id, OldName: name, NewName: normalized})
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		if renames[i].NewName != renames[j].NewName {
+			return renames[i].NewName < renames[j].NewName
+		}
+		return renames[i].PlayerId < renames[j].PlayerId
+	})
+	if dryRun || len(renames) == 0 {
+		return renames, "", nil
+	}
+
+	rename := func(id string, name *string) {
+		if n, ok := newNames[id]; ok {
+			*name = n
+		}
+	}
+	for _, t := range txs {
+		if p := t.GetAddPlayerPayload(); p != nil {
+			rename(p.PlayerId, &p.Name)
+		}
+		if p := t.GetWaitingListPayload(); p != nil {
+			rename(p.PlayerId, &p.Name)
+		}
+		if p := t.GetJoinRequestPayload(); p != nil {
+			rename(p.PlayerId, &p.Name)
+		}
+		for _, p := range t.PlayerList {
+			rename(p.Id, &p.Name)
+		}
+	}
+	if err := m.rewriteLogLocked(txs); err != nil {
+		return nil, "", fmt.Errorf("failed to rewrite log: %v", err)
+	}
+
+	var current []*ladderpb.Player
+	if len(txs) > 0 {
+		current = storageToLadder(txs[len(txs)-1].PlayerList)
+	}
+	payload := &storagepb.RenamePlayersStorage{}
+	for _, r := range renames {
+		payload.Renames = append(payload.Renames, &storagepb.PlayerRenameStorage{PlayerId: r.PlayerId, OldName: r.OldName, NewName: r.NewName})
+	}
+	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_RENAME_PLAYERS, payload, current)
+	if err != nil {
+		return nil, "", err
+	}
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_RENAME_PLAYERS,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_RenamePlayersPayload{RenamePlayersPayload: payload},
+		PlayerList:  ladderToStorage(newPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, "", err
+	}
+	return renames, tx.Id, nil
+}
+
+// NormalizePlayerNames tidies every player's name, or previews it
+func (h *LadderService) NormalizePlayerNames(ctx context.Context, req *ladderpb.NormalizePlayerNamesRequest) (*ladderpb.NormalizePlayerNamesResponse, error) {
+	renames, txID, err := h.modelFor(ctx).NormalizePlayerNames(ctx, req.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.NormalizePlayerNamesResponse{Renames: renames, TransactionId: txID}, nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+func TestTidyName(t *testing.T) {
+	for in, want := range map[string]string{
+		"  alice   smith ": "Alice Smith",
+		"BOB JONES":        "Bob Jones",
+		"o'brien-SMITH":    "O'Brien-Smith",
+		"Charlie McDonald": "Charlie McDonald",
+		"jean-luc\tpicard": "Jean-Luc Picard",
+		"émile zola":       "Émile Zola",
+		"Already Tidy":     "Already Tidy",
+		"   ":              "",
+		"dave the 2nd":     "Dave The 2nd",
+		"eve van DYKE":     "Eve Van Dyke",
+	} {
+		if got := tidyName(in); got != want {
+			t.Errorf("tidyName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestModel_NormalizePlayerNames(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	m.AddPlayer("  alice   SMITH", "alice")
+	m.AddPlayer("Bob McDonald", "bob")
+	m.AddPlayer("CHARLIE brown", "charlie")
+	m.AddMatchResult("charlie", "alice", "charlie", sets)
+	m.ErasePlayer(ctx, "bob")
+
+	renames, txID, err := m.NormalizePlayerNames(ctx, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if txID != "" || len(renames) != 2 || renames[0].PlayerId != "alice" || renames[0].OldName != "  alice   SMITH" ||
+		renames[0].NewName != "Alice Smith" || renames[1].NewName != "Charlie Brown" {
+		t.Fatalf("unexpected preview %v, %q", renames, txID)
+	}
+	if m.ListPlayers()[1].Name != "  alice   SMITH" {
+		t.Error("the dry run renamed a player")
+	}
+
+	before := m.ListPlayers()
+	renames, txID, err = m.NormalizePlayerNames(ctx, false)
+	if err != nil || txID == "" || len(renames) != 2 {
+		t.Fatalf("NormalizePlayerNames failed: %v, %q, %v", renames, txID, err)
+	}
+	after := m.ListPlayers()
+	for i := range before {
+		if before[i].Id != after[i].Id || before[i].Rank != after[i].Rank {
+			t.Errorf("renaming moved players: %v -> %v", before, after)
+		}
+	}
+	if after[0].Name != "Charlie Brown" || after[1].Name != "Alice Smith" || !strings.HasPrefix(after[2].Name, "Erased player ") {
+		t.Errorf("unexpected names after normalizing: %v", after)
+	}
+	if matches, _ := m.GetRecentMatches(10); len(matches) != 1 {
+		t.Errorf("expected the match to survive, got %v", matches)
+	}
+
+	// Only the RENAME_PLAYERS transaction still holds the old name
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		raw, _ := base64.StdEncoding.DecodeString(line)
+		if bytes.Contains(raw, []byte("CHARLIE brown")) {
+			t.Fatal("an old name is still in the history")
+		}
+	}
+	if report, err := m.VerifyLog(ctx, false); err != nil || !report.OK() {
+		t.Errorf("log no longer verifies after renaming: %v, %v", report, err)
+	}
+	txs, _, _ := m.ListTransactions(ctx, 1, "", nil)
+	if len(txs) != 1 || txs[0].Id != txID || txs[0].Type != storagepb.TransactionType_RENAME_PLAYERS.String() ||
+		!strings.Contains(txs[0].Summary, `"CHARLIE brown" to "Charlie Brown"`) {
+		t.Errorf("unexpected transaction %v", txs)
+	}
+	if export, _ := m.ExportPlayerData(ctx, "charlie"); len(export.Names) != 2 {
+		t.Errorf("expected the export to list both of Charlie's names, got %v", export.Names)
+	}
+
+	// Once tidy there is nothing to do
+	if renames, txID, err := m.NormalizePlayerNames(ctx, false); err != nil || len(renames) != 0 || txID != "" {
+		t.Errorf("expected no renames the second time, got %v, %q, %v", renames, txID, err)
+	}
+}
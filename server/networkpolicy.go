@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// readOnlyMethods lists the RPCs that change nothing, which a network policy lets
+// through from anywhere it allows reads. Anything else counts as a mutation, so a
+// new RPC is held to the stricter rule until it is listed here.
+var readOnlyMethods = map[string]bool{
+	"/ladder.LadderService/ListPlayers":                true,
+	"/ladder.LadderService/ListRecentMatches":          true,
+	"/ladder.LadderService/GetAttachmentURL":           true,
+	"/ladder.LadderService/GetVersion":                 true,
+	"/ladder.LadderService/VerifyChain":                true,
+	"/ladder.LadderService/ListTransactions":           true,
+	"/ladder.LadderService/GetTransaction":             true,
+	"/ladder.LadderService/GetLadderRules":             true,
+	"/ladder.LadderService/GetRatingHistory":           true,
+	"/ladder.LadderService/ListClubs":                  true,
+	"/ladder.LadderService/GetUsage":                   true,
+	"/ladder.LadderService/DiffLadder":                 true,
+	"/ladder.LadderService/GetLeagueTable":             true,
+	"/ladder.LadderService/ExportPlayerData":           true,
+	"/ladder.LadderService/ListApiKeys":                true,
+	"/ladder.LadderService/ExportAuditTranscript":      true,
+	"/ladder.LadderService/GetMyDashboard":             true,
+	"/ladder.LadderService/GetWalletPass":              true,
+	"/ladder.LadderService/ListLookingForGame":         true,
+	"/ladder.LadderService/ListLiveMatches":            true,
+	"/ladder.LadderService/GetPushPreferences":         true,
+	"/ladder.LadderService/GetNotificationPreferences": true,
+	"/ladder.LadderService/GetSession":                 true,
+	"/ladder.LadderService/ListSessions":               true,
+	"/ladder.LadderService/GetAttendanceStats":         true,
+	"/ladder.LadderService/ListWaitingList":            true,
+	"/ladder.LadderService/ListJoinRequests":           true,
+	"/ladder.LadderService/ListTeams":                  true,
+	"/ladder.LadderService/ListFixtures":               true,
+	"/ladder.LadderService/SuggestTeamSelection":       true,
+	"/ladder.LadderService/GetResultsGrid":             true,
+}
+
+// readOnlyPaths are HTTP paths whose POSTs change nothing on the ladder, such as
+// phones registering for wallet card updates from wherever they are
+var readOnlyPaths = []string{walletPath}
+
+// webhookPaths are HTTP paths that outside services post to, so they never come from
+// the club network. Their handlers check the sender's signature, and the results they
+// take are confirmed by a player, so mutation networks don't apply to them.
+var webhookPaths = []string{smsPath}
+
+// privateNetworks are what "private" stands for in a network list: loopback and
+// the private and link-local ranges a club's own network uses
+var privateNetworks = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// ParseNetworks parses a comma-separated list of CIDR ranges and addresses, such as
+// "192.168.1.0/24, 203.0.113.9". The word "private" adds loopback and the private
+// address ranges.
+func ParseNetworks(s string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			continue
+		case field == "private":
+			networks = append(networks, privateNetworks...)
+		case strings.Contains(field, "/"):
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %v", field, err)
+			}
+			networks = append(networks, prefix.Masked())
+		default:
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %v", field, err)
+			}
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return networks, nil
+}
+
+// NetworkPolicy limits where requests are accepted from. Reads can be open to the
+// internet while mutations are only accepted from the club network, or the whole
+// server can be limited to a few networks. An empty list allows any address.
+type NetworkPolicy struct {
+	// Allowed networks may call the server at all
+	Allowed []netip.Prefix
+	// Mutation networks may also change the ladder, through mutating RPCs and any
+	// HTTP request other than GET and HEAD
+	Mutations []netip.Prefix
+	// TrustedProxies are reverse proxies whose X-Forwarded-For header names the client.
+	// Without them, a server behind a proxy on the club network accepts everyone.
+	TrustedProxies []netip.Prefix
+}
+
+// enabled reports whether the policy limits anything
+func (p *NetworkPolicy) enabled() bool {
+	return len(p.Allowed) > 0 || len(p.Mutations) > 0
+}
+
+// check returns a PermissionDenied error when addr may not make a request, or a
+// mutating one
+func (p *NetworkPolicy) check(addr netip.Addr, mutation bool) error {
+	if len(p.Allowed) > 0 && !inNetworks(addr, p.Allowed) {
+		return status.Errorf(codes.PermissionDenied, "requests are not accepted from %s", addr)
+	}
+	if mutation && len(p.Mutations) > 0 && !inNetworks(addr, p.Mutations) {
+		return status.Errorf(codes.PermissionDenied, "changes are only accepted from the club network, not %s", addr)
+	}
+	return nil
+}
+
+// clientAddr returns the address a request came from, following X-Forwarded-For
+// back through trusted proxies. An unparseable address is invalid, which no
+// network contains.
+func (p *NetworkPolicy) clientAddr(remote string, forwardedFor []string) netip.Addr {
+	addr, _ := netip.ParseAddr(hostOnly(remote))
+	var hops []string
+	for _, v := range forwardedFor {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	// The rightmost hops were added by our own proxies; the first untrusted one is
+	// the client
+	for i := len(hops) - 1; i >= 0 && inNetworks(addr, p.TrustedProxies); i-- {
+		addr, _ = netip.ParseAddr(strings.TrimSpace(hops[i]))
+	}
+	return addr.Unmap()
+}
+
+// unaryInterceptor enforces the policy on RPCs, native and gRPC-Web alike
+func (p *NetworkPolicy) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !p.enabled() {
+			return handler(ctx, req)
+		}
+		var remote string
+		if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+			remote = pr.Addr.String()
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		addr := p.clientAddr(remote, md.Get("x-forwarded-for"))
+		if err := p.check(addr, !readOnlyMethods[info.FullMethod]); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// checkHTTP enforces the policy on plain HTTP requests
+func (p *NetworkPolicy) checkHTTP(r *http.Request) error {
+	if !p.enabled() {
+		return nil
+	}
+	addr := p.clientAddr(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+	mutation := r.Method != "GET" && r.Method != "HEAD"
+	for _, prefix := range readOnlyPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			mutation = false
+		}
+	}
+	for _, path := range webhookPaths {
+		if r.URL.Path == path {
+			mutation = false
+		}
+	}
+	return p.check(addr, mutation)
+}
+
+func inNetworks(addr netip.Addr, networks []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, n := range networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
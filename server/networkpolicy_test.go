@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks(" 192.168.1.0/24, 203.0.113.9,2001:db8::/32 ")
+	if err != nil {
+		t.Fatalf("ParseNetworks failed: %v", err)
+	}
+	want := []string{"192.168.1.0/24", "203.0.113.9/32", "2001:db8::/32"}
+	if len(networks) != len(want) {
+		t.Fatalf("expected %v, got %v", want, networks)
+	}
+	for i, w := range want {
+		if networks[i].String() != w {
+			t.Errorf("expected %s, got %s", w, networks[i])
+		}
+	}
+	if networks, _ := ParseNetworks("private"); len(networks) != len(privateNetworks) {
+		t.Errorf("expected private to expand to %d networks, got %d", len(privateNetworks), len(networks))
+	}
+	if networks, err := ParseNetworks(""); err != nil || networks != nil {
+		t.Errorf("expected no networks, got %v, %v", networks, err)
+	}
+	for _, bad := range []string{"192.168.1.0/33", "clubhouse"} {
+		if _, err := ParseNetworks(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestNetworkPolicy_LANOnlyMutations(t *testing.T) {
+	lan, _ := ParseNetworks("private")
+	proxy, _ := ParseNetworks("10.0.0.2")
+	policy := &NetworkPolicy{Mutations: lan, TrustedProxies: proxy}
+	intercept := policy.unaryInterceptor()
+
+	call := func(method, remote string, md ...string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(md...))
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(remote))})
+		_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+	for _, tc := range []struct {
+		method, remote string
+		md             []string
+		want           codes.Code
+	}{
+		{"/ladder.LadderService/ListPlayers", "203.0.113.9:4000", nil, codes.OK},
+		{"/ladder.LadderService/AddMatchResult", "192.168.1.20:4000", nil, codes.OK},
+		{"/ladder.LadderService/AddMatchResult", "[::ffff:192.168.1.20]:4000", nil, codes.OK},
+		{"/ladder.LadderService/AddMatchResult", "203.0.113.9:4000", nil, codes.PermissionDenied},
+		// Through the club's proxy, the forwarded address counts
+		{"/ladder.LadderService/AddMatchResult", "10.0.0.2:4000", []string{"x-forwarded-for", "203.0.113.9"}, codes.PermissionDenied},
+		{"/ladder.LadderService/AddMatchResult", "10.0.0.2:4000", []string{"x-forwarded-for", "203.0.113.9, 192.168.1.20"}, codes.OK},
+		// But not from anyone else, who could forge it
+		{"/ladder.LadderService/AddMatchResult", "203.0.113.9:4000", []string{"x-forwarded-for", "192.168.1.20"}, codes.PermissionDenied},
+	} {
+		if err := call(tc.method, tc.remote, tc.md...); status.Code(err) != tc.want {
+			t.Errorf("%s from %s %v: expected %v, got %v", tc.method, tc.remote, tc.md, tc.want, err)
+		}
+	}
+
+	get := httptest.NewRequest("GET", "/api/players", nil)
+	get.RemoteAddr = "203.0.113.9:4000"
+	if err := policy.checkHTTP(get); err != nil {
+		t.Errorf("expected reads from anywhere, got %v", err)
+	}
+	post := httptest.NewRequest("POST", "/admin/reorder", nil)
+	post.RemoteAddr = "203.0.113.9:4000"
+	if err := policy.checkHTTP(post); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for a POST from outside, got %v", err)
+	}
+	register := httptest.NewRequest("POST", walletPath+"v1/devices/phone/registrations/pass.test/serial", nil)
+	register.RemoteAddr = "203.0.113.9:4000"
+	if err := policy.checkHTTP(register); err != nil {
+		t.Errorf("expected wallet registrations from anywhere, got %v", err)
+	}
+	sms := httptest.NewRequest("POST", smsPath, nil)
+	sms.RemoteAddr = "203.0.113.9:4000"
+	if err := policy.checkHTTP(sms); err != nil {
+		t.Errorf("expected Twilio's webhook from anywhere, got %v", err)
+	}
+	smsLike := httptest.NewRequest("POST", smsPath+"/other", nil)
+	smsLike.RemoteAddr = "203.0.113.9:4000"
+	if err := policy.checkHTTP(smsLike); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected only the webhook itself to be exempt, got %v", err)
+	}
+}
+
+func TestNetworkPolicy_Allowed(t *testing.T) {
+	allowed, _ := ParseNetworks("192.168.1.0/24")
+	policy := &NetworkPolicy{Allowed: allowed}
+	r := httptest.NewRequest("GET", "/kiosk", nil)
+	r.RemoteAddr = "192.168.1.50:4000"
+	if err := policy.checkHTTP(r); err != nil {
+		t.Errorf("expected the club network to be allowed, got %v", err)
+	}
+	r.RemoteAddr = "192.168.2.50:4000"
+	if err := policy.checkHTTP(r); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+	if err := (&NetworkPolicy{}).checkHTTP(r); err != nil {
+		t.Errorf("expected an empty policy to allow everything, got %v", err)
+	}
+}
+
+func TestReadOnlyMethodsExist(t *testing.T) {
+	methods := make(map[string]bool)
+	for _, m := range ladderpb.LadderService_ServiceDesc.Methods {
+		methods["/"+ladderpb.LadderService_ServiceDesc.ServiceName+"/"+m.MethodName] = true
+	}
+	for name := range readOnlyMethods {
+		if !methods[name] {
+			t.Errorf("read-only method %s is not an RPC", name)
+		}
+	}
+}
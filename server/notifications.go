@@ -0,0 +1,618 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// notificationStoreFile holds every ladder's notification settings, next to the
+// server's log. Servers before email and Telegram notifications used pushStoreFile.
+const (
+	notificationStoreFile = "notifications.json"
+	pushStoreFile         = "push_subscriptions.json"
+)
+
+// e164Phone matches phone numbers in the international form Twilio sends them in
+var e164Phone = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// defaultChannels are used for events a player has not chosen channels for
+var defaultChannels = map[ladderpb.NotificationEvent][]ladderpb.NotificationChannel{
+	ladderpb.NotificationEvent_NOTIFY_RESULT_CONFIRMED:   {ladderpb.NotificationChannel_CHANNEL_PUSH},
+	ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED:       {ladderpb.NotificationChannel_CHANNEL_PUSH},
+	ladderpb.NotificationEvent_NOTIFY_CHALLENGE_RECEIVED: {ladderpb.NotificationChannel_CHANNEL_PUSH},
+	ladderpb.NotificationEvent_NOTIFY_WEEKLY_DIGEST:      {ladderpb.NotificationChannel_CHANNEL_EMAIL},
+}
+
+// notificationPlayer is everything stored for one player
+type notificationPlayer struct {
+	Subscriptions  []pushSubscription  `json:"subscriptions,omitempty"`
+	Email          string              `json:"email,omitempty"`
+	TelegramChatID string              `json:"telegram_chat_id,omitempty"`
+	Phone          string              `json:"phone,omitempty"`    // E.164, for SMS result entry
+	Locale         string              `json:"locale,omitempty"`   // Empty for the server default
+	Channels       map[string][]string `json:"channels,omitempty"` // Event name to channel names
+	// DisabledEvents were not pushed, in stores written before channels existed
+	DisabledEvents []string `json:"disabled_events,omitempty"`
+}
+
+func (p *notificationPlayer) empty() bool {
+	return len(p.Subscriptions) == 0 && p.Email == "" && p.TelegramChatID == "" && p.Phone == "" && p.Locale == "" && len(p.Channels) == 0
+}
+
+// NotificationStore keeps players' contact details, push subscriptions and chosen
+// channels per event in a JSON file
+type NotificationStore struct {
+	path string
+
+	mu      sync.Mutex
+	players map[string]*notificationPlayer // Keyed by notificationKey
+}
+
+// NewNotificationStore opens the store at path, which is created on the first change
+func NewNotificationStore(path string) (*NotificationStore, error) {
+	s := &NotificationStore{path: path, players: make(map[string]*notificationPlayer)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.players); err != nil {
+		return nil, fmt.Errorf("invalid notification store %s: %v", path, err)
+	}
+	for _, p := range s.players {
+		if len(p.DisabledEvents) == 0 {
+			continue
+		}
+		// Keep the default channels of a disabled event, except push
+		for _, name := range p.DisabledEvents {
+			event := ladderpb.NotificationEvent(ladderpb.NotificationEvent_value[name])
+			var channels []string
+			for _, c := range defaultChannels[event] {
+				if c != ladderpb.NotificationChannel_CHANNEL_PUSH {
+					channels = append(channels, c.String())
+				}
+			}
+			if p.Channels == nil {
+				p.Channels = make(map[string][]string)
+			}
+			p.Channels[name] = append([]string{}, channels...)
+		}
+		p.DisabledEvents = nil
+	}
+	return s, nil
+}
+
+// openNotificationStore opens the store in dataDir, taking over the push
+// subscriptions of an older server
+func openNotificationStore(dataDir string) (*NotificationStore, error) {
+	path := filepath.Join(dataDir, notificationStoreFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.Rename(filepath.Join(dataDir, pushStoreFile), path); err == nil {
+			log.Printf("Moved %s to %s", pushStoreFile, notificationStoreFile)
+		}
+	}
+	return NewNotificationStore(path)
+}
+
+// notificationKey identifies a player across ladders; clubID is empty for the
+// default ladder
+func notificationKey(clubID, playerID string) string {
+	return clubID + "/" + playerID
+}
+
+// splitNotificationKey reverses notificationKey
+func splitNotificationKey(key string) (clubID, playerID string) {
+	clubID, playerID, _ = strings.Cut(key, "/")
+	return clubID, playerID
+}
+
+// Channels returns the channels a player wants event sent on
+func (s *NotificationStore) Channels(clubID, playerID string, event ladderpb.NotificationEvent) []ladderpb.NotificationChannel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channelsLocked(notificationKey(clubID, playerID), event)
+}
+
+func (s *NotificationStore) channelsLocked(key string, event ladderpb.NotificationEvent) []ladderpb.NotificationChannel {
+	p, ok := s.players[key]
+	if !ok {
+		return defaultChannels[event]
+	}
+	names, ok := p.Channels[event.String()]
+	if !ok {
+		return defaultChannels[event]
+	}
+	channels := []ladderpb.NotificationChannel{}
+	for _, name := range names {
+		channels = append(channels, ladderpb.NotificationChannel(ladderpb.NotificationChannel_value[name]))
+	}
+	return channels
+}
+
+// wants reports whether a player wants event sent on channel
+func (s *NotificationStore) wants(clubID, playerID string, event ladderpb.NotificationEvent, channel ladderpb.NotificationChannel) bool {
+	for _, c := range s.Channels(clubID, playerID, event) {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *NotificationStore) setChannelsLocked(key string, event ladderpb.NotificationEvent, channels []ladderpb.NotificationChannel) {
+	p := s.playerLocked(key)
+	if p.Channels == nil {
+		p.Channels = make(map[string][]string)
+	}
+	names := []string{}
+	seen := make(map[ladderpb.NotificationChannel]bool)
+	for _, c := range channels {
+		if !seen[c] {
+			seen[c] = true
+			names = append(names, c.String())
+		}
+	}
+	p.Channels[event.String()] = names
+}
+
+// Contact returns a player's email address and Telegram chat ID
+func (s *NotificationStore) Contact(clubID, playerID string) (email, telegramChatID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[notificationKey(clubID, playerID)]
+	if !ok {
+		return "", ""
+	}
+	return p.Email, p.TelegramChatID
+}
+
+// TelegramChatClubs returns the clubs, sorted, with a player who linked a Telegram
+// chat. "" is the default ladder.
+func (s *NotificationStore) TelegramChatClubs(chatID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var clubs []string
+	for key, p := range s.players {
+		if c, _ := splitNotificationKey(key); p.TelegramChatID == chatID && !slices.Contains(clubs, c) {
+			clubs = append(clubs, c)
+		}
+	}
+	sort.Strings(clubs)
+	return clubs
+}
+
+// Phone returns the phone number a player linked for SMS result entry
+func (s *NotificationStore) Phone(clubID, playerID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.players[notificationKey(clubID, playerID)]; ok {
+		return p.Phone
+	}
+	return ""
+}
+
+// PlayerByPhone returns the club and player that linked a phone number. A number is
+// linked to at most one player on the whole server, so it also identifies the club.
+func (s *NotificationStore) PlayerByPhone(phone string) (clubID, playerID string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, p := range s.players {
+		if p.Phone == phone {
+			clubID, playerID = splitNotificationKey(key)
+			return clubID, playerID, true
+		}
+	}
+	return "", "", false
+}
+
+// SetPhone links a phone number to a player
+func (s *NotificationStore) SetPhone(clubID, playerID, phone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playerLocked(notificationKey(clubID, playerID)).Phone = phone
+	return s.saveLocked()
+}
+
+// Locale returns the language a player chose, or "" for the server default
+func (s *NotificationStore) Locale(clubID, playerID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.players[notificationKey(clubID, playerID)]; ok {
+		return p.Locale
+	}
+	return ""
+}
+
+// Update applies a player's new preferences, contact details and language together;
+// empty contact details and language are left unchanged
+func (s *NotificationStore) Update(clubID, playerID string, prefs []*ladderpb.NotificationPreference, email, telegramChatID, locale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := notificationKey(clubID, playerID)
+	p := s.playerLocked(key)
+	if email != "" {
+		p.Email = email
+	}
+	if telegramChatID != "" {
+		p.TelegramChatID = telegramChatID
+	}
+	if locale != "" {
+		p.Locale = locale
+	}
+	for _, pref := range prefs {
+		s.setChannelsLocked(key, pref.Event, pref.Channels)
+	}
+	return s.saveLocked()
+}
+
+// playersOf returns the IDs of every player with stored settings on a ladder
+func (s *NotificationStore) playersOf(clubID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for key := range s.players {
+		if c, id := splitNotificationKey(key); c == clubID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Forget removes everything stored for a player
+func (s *NotificationStore) Forget(clubID, playerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := notificationKey(clubID, playerID)
+	if _, ok := s.players[key]; !ok {
+		return nil
+	}
+	delete(s.players, key)
+	return s.saveLocked()
+}
+
+func (s *NotificationStore) playerLocked(key string) *notificationPlayer {
+	p, ok := s.players[key]
+	if !ok {
+		p = &notificationPlayer{}
+		s.players[key] = p
+	}
+	return p
+}
+
+// saveLocked replaces the file atomically; it is readable only by the server, as it
+// holds players' addresses and the tokens that let anyone push to them
+func (s *NotificationStore) saveLocked() error {
+	for key, p := range s.players {
+		if p.empty() {
+			delete(s.players, key)
+		}
+	}
+	data, err := json.MarshalIndent(s.players, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// notificationEvents lists every event a player can choose, in enum order
+func notificationEvents() []ladderpb.NotificationEvent {
+	var events []ladderpb.NotificationEvent
+	for n := range ladderpb.NotificationEvent_name {
+		if e := ladderpb.NotificationEvent(n); e != ladderpb.NotificationEvent_NOTIFY_NONE {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+	return events
+}
+
+// checkNotificationEvents rejects unknown events
+func checkNotificationEvents(events []ladderpb.NotificationEvent) error {
+	for _, e := range events {
+		if _, ok := ladderpb.NotificationEvent_name[int32(e)]; !ok || e == ladderpb.NotificationEvent_NOTIFY_NONE {
+			return fmt.Errorf("unknown notification event %d", e)
+		}
+	}
+	return nil
+}
+
+// notification is a message to one player, rendered for each channel
+type notification struct {
+	Title string
+	Body  string
+	Tag   string // A newer push with the same tag replaces the older
+}
+
+// Notifier delivers ladder events to players on the channels they chose: push
+// notifications to their browsers and devices, email, and Telegram messages
+type Notifier struct {
+	store    *NotificationStore
+	webPush  *webPushSender // nil when Web Push is not configured
+	fcm      *fcmSender     // nil when FCM is not configured
+	email    *emailSender   // nil when email is not configured
+	telegram *TelegramBot   // nil when the Telegram bot is not running
+	locale   string         // For players who have not chosen a language; empty is English
+}
+
+// NewNotifier creates a notifier that keeps players' settings in store. Channels are
+// switched on with the Enable methods.
+func NewNotifier(store *NotificationStore) *Notifier {
+	return &Notifier{store: store}
+}
+
+// EnableWebPush sends push notifications to browsers, identified by a VAPID private
+// key and a mailto: or https: subject
+func (n *Notifier) EnableWebPush(vapidPrivateKey, subject string) error {
+	sender, err := newWebPushSender(vapidPrivateKey, subject)
+	if err != nil {
+		return err
+	}
+	n.webPush = sender
+	return nil
+}
+
+// EnableFCM sends push notifications to the mobile apps through Firebase, using the
+// JSON key file of a service account of the project
+func (n *Notifier) EnableFCM(credentialsJSON []byte) error {
+	sender, err := newFCMSender(credentialsJSON)
+	if err != nil {
+		return err
+	}
+	n.fcm = sender
+	return nil
+}
+
+// EnableEmail sends email through an SMTP server
+func (n *Notifier) EnableEmail(cfg SMTPConfig) error {
+	sender, err := newEmailSender(cfg)
+	if err != nil {
+		return err
+	}
+	n.email = sender
+	return nil
+}
+
+// EnableTelegram sends direct messages from bot, and lets the players who linked a
+// chat record results through it
+func (n *Notifier) EnableTelegram(bot *TelegramBot) {
+	n.telegram = bot
+	bot.contacts = n.store
+}
+
+// EnableSMS lets the players who linked a phone number record results by SMS through h
+func (n *Notifier) EnableSMS(h *SMSHandler) {
+	h.contacts = n.store
+}
+
+// localeOf returns the language to notify a player in
+func (n *Notifier) localeOf(clubID, playerID string) string {
+	if l := n.store.Locale(clubID, playerID); l != "" {
+		return l
+	}
+	return n.locale
+}
+
+// availableChannels lists the channels this server can deliver on
+func (n *Notifier) availableChannels() []ladderpb.NotificationChannel {
+	var channels []ladderpb.NotificationChannel
+	if n.email != nil {
+		channels = append(channels, ladderpb.NotificationChannel_CHANNEL_EMAIL)
+	}
+	if n.webPush != nil || n.fcm != nil {
+		channels = append(channels, ladderpb.NotificationChannel_CHANNEL_PUSH)
+	}
+	if n.telegram != nil {
+		channels = append(channels, ladderpb.NotificationChannel_CHANNEL_TELEGRAM)
+	}
+	return channels
+}
+
+// Attach notifies players of the changes to a club's ladder; clubID is empty for the
+// default ladder
+func (n *Notifier) Attach(clubID string, m *Model) {
+	m.OnChange(func(change LadderChange) {
+		n.handle(clubID, change)
+	})
+}
+
+func (n *Notifier) handle(clubID string, change LadderChange) {
+	ctx := context.Background()
+	tx := change.Transaction
+	if mr := tx.GetMatchResultPayload(); mr != nil {
+		names := make(map[string]string)
+		for _, p := range change.Before {
+			names[p.Id] = p.Name
+		}
+		for _, p := range change.After {
+			names[p.Id] = p.Name
+		}
+		for _, id := range []string{mr.ChallengerId, mr.DefenderId} {
+			locale := n.localeOf(clubID, id)
+			msg := notification{
+				Title: tr(locale, "Result recorded"),
+				Body:  describeMatchIn(locale, matchResultFromStorage(tx), names),
+				Tag:   "result-" + tx.Id,
+			}
+			n.notify(ctx, clubID, id, ladderpb.NotificationEvent_NOTIFY_RESULT_CONFIRMED, msg)
+		}
+	}
+
+	for _, mv := range change.Moves() {
+		if mv.FromRank == 0 || mv.ToRank == 0 {
+			continue
+		}
+		locale := n.localeOf(clubID, mv.PlayerID)
+		body := trf(locale, "You moved up to #%d (from #%d)", mv.ToRank, mv.FromRank)
+		if mv.ToRank > mv.FromRank {
+			body = trf(locale, "You dropped to #%d (from #%d)", mv.ToRank, mv.FromRank)
+		}
+		msg := notification{Title: tr(locale, "Ladder update"), Body: body, Tag: "rank"}
+		n.notify(ctx, clubID, mv.PlayerID, ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED, msg)
+	}
+}
+
+// notify sends msg to a player on every channel they chose for event that this
+// server can deliver on
+func (n *Notifier) notify(ctx context.Context, clubID, playerID string, event ladderpb.NotificationEvent, msg notification) {
+	email, chatID := n.store.Contact(clubID, playerID)
+	for _, channel := range n.store.Channels(clubID, playerID, event) {
+		var err error
+		switch channel {
+		case ladderpb.NotificationChannel_CHANNEL_PUSH:
+			n.push(ctx, clubID, playerID, event, msg)
+		case ladderpb.NotificationChannel_CHANNEL_EMAIL:
+			if n.email != nil && email != "" {
+				err = n.email.send(email, msg.Title, msg.Body)
+			}
+		case ladderpb.NotificationChannel_CHANNEL_TELEGRAM:
+			if n.telegram != nil && chatID != "" {
+				err = n.telegram.sendMessage(chatID, msg.Title+"\n"+msg.Body)
+			}
+		}
+		if err != nil {
+			log.Printf("notifications: failed to send %s to %s by %s: %v", event, playerID, channel, err)
+		}
+	}
+}
+
+// checkChannels rejects channels the server cannot deliver on
+func (n *Notifier) checkChannels(channels []ladderpb.NotificationChannel) error {
+	available := make(map[ladderpb.NotificationChannel]bool)
+	for _, c := range n.availableChannels() {
+		available[c] = true
+	}
+	for _, c := range channels {
+		if _, ok := ladderpb.NotificationChannel_name[int32(c)]; !ok || c == ladderpb.NotificationChannel_CHANNEL_NONE {
+			return fmt.Errorf("unknown notification channel %d", c)
+		}
+		if !available[c] {
+			return fmt.Errorf("%s is not enabled on this server", c)
+		}
+	}
+	return nil
+}
+
+// notificationPlayer returns the calling player and their club, or an error if
+// notifications are off or the caller has no player token
+func (h *LadderService) notificationPlayer(ctx context.Context) (string, string, error) {
+	if h.notifier == nil {
+		return "", "", status.Error(codes.FailedPrecondition, "notifications are not enabled on this server")
+	}
+	m, playerID, err := h.currentPlayer(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return h.clubIDFor(m), playerID, nil
+}
+
+// GetNotificationPreferences returns which events reach the calling player on which channels
+func (h *LadderService) GetNotificationPreferences(ctx context.Context, req *ladderpb.GetNotificationPreferencesRequest) (*ladderpb.GetNotificationPreferencesResponse, error) {
+	clubID, playerID, err := h.notificationPlayer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store := h.notifier.store
+	resp := &ladderpb.GetNotificationPreferencesResponse{
+		Preferences:       []*ladderpb.NotificationPreference{},
+		AvailableChannels: h.notifier.availableChannels(),
+		Locale:            store.Locale(clubID, playerID),
+		AvailableLocales:  supportedLocales,
+	}
+	for _, e := range notificationEvents() {
+		resp.Preferences = append(resp.Preferences, &ladderpb.NotificationPreference{Event: e, Channels: store.Channels(clubID, playerID, e)})
+	}
+	resp.Email, resp.TelegramChatId = store.Contact(clubID, playerID)
+	resp.Phone = store.Phone(clubID, playerID)
+	return resp, nil
+}
+
+// UpdateNotificationPreferences chooses which events reach the calling player on which channels
+func (h *LadderService) UpdateNotificationPreferences(ctx context.Context, req *ladderpb.UpdateNotificationPreferencesRequest) (*ladderpb.UpdateNotificationPreferencesResponse, error) {
+	clubID, playerID, err := h.notificationPlayer(ctx)
+	if err != nil {
+		return &ladderpb.UpdateNotificationPreferencesResponse{Success: false}, err
+	}
+	invalid := func(format string, args ...interface{}) (*ladderpb.UpdateNotificationPreferencesResponse, error) {
+		return &ladderpb.UpdateNotificationPreferencesResponse{Success: false}, localizedStatusf(codes.InvalidArgument, format, args...)
+	}
+	if req.Email != "" {
+		if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+			return invalid("invalid email address")
+		}
+	}
+	if req.TelegramChatId != "" {
+		if _, err := strconv.ParseInt(req.TelegramChatId, 10, 64); err != nil {
+			return invalid("telegram_chat_id must be numeric; the bot's /myid command shows it")
+		}
+	}
+
+	if req.Phone != "" {
+		if !e164Phone.MatchString(req.Phone) {
+			return invalid("phone must be in international form, e.g. +447700900123")
+		}
+		if c, id, ok := h.notifier.store.PlayerByPhone(req.Phone); ok && (c != clubID || id != playerID) {
+			return &ladderpb.UpdateNotificationPreferencesResponse{Success: false}, localizedStatusf(codes.AlreadyExists, "that phone number is linked to another player")
+		}
+	}
+
+	if req.Locale != "" && supportedLocale(req.Locale) != req.Locale {
+		return invalid("unsupported locale %q", req.Locale)
+	}
+
+	email, chatID := h.notifier.store.Contact(clubID, playerID)
+	if req.Email != "" {
+		email = req.Email
+	}
+	if req.TelegramChatId != "" {
+		chatID = req.TelegramChatId
+	}
+	for _, pref := range req.Preferences {
+		if err := checkNotificationEvents([]ladderpb.NotificationEvent{pref.Event}); err != nil {
+			return invalid("%v", err)
+		}
+		if err := h.notifier.checkChannels(pref.Channels); err != nil {
+			return invalid("%v", err)
+		}
+		for _, c := range pref.Channels {
+			switch {
+			case c == ladderpb.NotificationChannel_CHANNEL_EMAIL && email == "":
+				return invalid("an email address is needed for email notifications")
+			case c == ladderpb.NotificationChannel_CHANNEL_TELEGRAM && chatID == "":
+				return invalid("a Telegram chat ID is needed for Telegram notifications")
+			}
+		}
+	}
+
+	if req.Phone != "" {
+		if err := h.notifier.store.SetPhone(clubID, playerID, req.Phone); err != nil {
+			return &ladderpb.UpdateNotificationPreferencesResponse{Success: false}, fmt.Errorf("failed to save preferences: %v", err)
+		}
+	}
+	if err := h.notifier.store.Update(clubID, playerID, req.Preferences, req.Email, req.TelegramChatId, req.Locale); err != nil {
+		return &ladderpb.UpdateNotificationPreferencesResponse{Success: false}, fmt.Errorf("failed to save preferences: %v", err)
+	}
+	return &ladderpb.UpdateNotificationPreferencesResponse{Success: true}, nil
+}
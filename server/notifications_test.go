@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type sentEmail struct {
+	to  string
+	msg string
+}
+
+// testEmail returns an email sender that records messages instead of sending them
+func testEmail(t *testing.T) (*emailSender, chan sentEmail) {
+	sender, err := newEmailSender(SMTPConfig{Addr: "smtp.example.org:587", From: "Squash Ladder <ladder@example.org>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan sentEmail, 10)
+	sender.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent <- sentEmail{to: to[0], msg: string(msg)}
+		return nil
+	}
+	return sender, sent
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	messages := make(chan map[string]string, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		messages <- body
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer api.Close()
+
+	svc := NewLadderService(m)
+	ctx := context.WithValue(context.Background(), playerClaimsKey{}, &playerClaims{PlayerID: "bob"})
+	if _, err := svc.GetNotificationPreferences(ctx, &ladderpb.GetNotificationPreferencesRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition with notifications disabled, got %v", err)
+	}
+
+	store, _ := NewNotificationStore(filepath.Join(t.TempDir(), notificationStoreFile))
+	svc.notifier = NewNotifier(store)
+	var emails chan sentEmail
+	svc.notifier.email, emails = testEmail(t)
+	bot := NewTelegramBot(svc, "token", "")
+	bot.apiBase = api.URL
+	svc.notifier.EnableTelegram(bot)
+	svc.notifier.Attach("", m)
+
+	prefs, err := svc.GetNotificationPreferences(ctx, &ladderpb.GetNotificationPreferencesRequest{})
+	if err != nil {
+		t.Fatalf("GetNotificationPreferences failed: %v", err)
+	}
+	if len(prefs.Preferences) != 4 || len(prefs.AvailableChannels) != 2 {
+		t.Errorf("expected 4 events and 2 channels, got %v", prefs)
+	}
+
+	rankByEmail := []*ladderpb.NotificationPreference{{
+		Event:    ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED,
+		Channels: []ladderpb.NotificationChannel{ladderpb.NotificationChannel_CHANNEL_EMAIL, ladderpb.NotificationChannel_CHANNEL_TELEGRAM},
+	}}
+	for _, bad := range []*ladderpb.UpdateNotificationPreferencesRequest{
+		{Preferences: rankByEmail}, // No address or chat ID yet
+		{Preferences: rankByEmail, Email: "bob@example.org"},
+		{Preferences: []*ladderpb.NotificationPreference{{Event: ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED, Channels: []ladderpb.NotificationChannel{ladderpb.NotificationChannel_CHANNEL_PUSH}}}},
+		{Preferences: []*ladderpb.NotificationPreference{{Event: 99}}},
+		{Email: "Bob <bob@example.org>\r\nBcc: everyone@example.org"},
+		{TelegramChatId: "@bob"},
+	} {
+		if _, err := svc.UpdateNotificationPreferences(ctx, bad); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument for %v, got %v", bad, err)
+		}
+	}
+
+	_, err = svc.UpdateNotificationPreferences(ctx, &ladderpb.UpdateNotificationPreferencesRequest{
+		Preferences:    append(rankByEmail, &ladderpb.NotificationPreference{Event: ladderpb.NotificationEvent_NOTIFY_RESULT_CONFIRMED}),
+		Email:          "bob@example.org",
+		TelegramChatId: "42",
+	})
+	if err != nil {
+		t.Fatalf("UpdateNotificationPreferences failed: %v", err)
+	}
+	prefs, _ = svc.GetNotificationPreferences(ctx, &ladderpb.GetNotificationPreferencesRequest{})
+	if prefs.Email != "bob@example.org" || prefs.TelegramChatId != "42" || len(prefs.Preferences[0].Channels) != 0 || len(prefs.Preferences[1].Channels) != 2 {
+		t.Errorf("preferences were not saved: %v", prefs)
+	}
+
+	// bob moves up; the result itself is switched off
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	select {
+	case e := <-emails:
+		if e.to != "bob@example.org" || !strings.Contains(e.msg, "Subject: Ladder update") || !strings.Contains(e.msg, "You moved up to #1 (from #2)") {
+			t.Errorf("unexpected email %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an email")
+	}
+	select {
+	case body := <-messages:
+		if body["chat_id"] != "42" || body["text"] != "Ladder update\nYou moved up to #1 (from #2)" {
+			t.Errorf("unexpected Telegram message %v", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a Telegram message")
+	}
+	select {
+	case e := <-emails:
+		t.Errorf("unexpected second email %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNotificationStore_TakesOverPushStore(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"/alice":{"subscriptions":[{"id":"s1","fcm_token":"phone","created_ms":1}],"disabled_events":["NOTIFY_RANK_CHANGED"]}}`
+	if err := os.WriteFile(filepath.Join(dir, pushStoreFile), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openNotificationStore(dir)
+	if err != nil {
+		t.Fatalf("openNotificationStore failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, notificationStoreFile)); err != nil {
+		t.Errorf("expected the push store to be moved: %v", err)
+	}
+	if len(store.Subscriptions("", "alice")) != 1 {
+		t.Error("subscriptions were lost")
+	}
+	if store.wants("", "alice", ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED, ladderpb.NotificationChannel_CHANNEL_PUSH) {
+		t.Error("a disabled event should stay off")
+	}
+	if !store.wants("", "alice", ladderpb.NotificationEvent_NOTIFY_RESULT_CONFIRMED, ladderpb.NotificationChannel_CHANNEL_PUSH) {
+		t.Error("other events should keep their defaults")
+	}
+}
+
+func TestDigestJob(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+	m.AddMatchResult("charlie", "bob", "charlie", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+
+	store, _ := NewNotificationStore(filepath.Join(t.TempDir(), notificationStoreFile))
+	notifier := NewNotifier(store)
+	var emails chan sentEmail
+	notifier.email, emails = testEmail(t)
+	store.Update("", "charlie", nil, "charlie@example.org", "", "")
+	store.Update("", "alice", []*ladderpb.NotificationPreference{{Event: ladderpb.NotificationEvent_NOTIFY_WEEKLY_DIGEST}}, "alice@example.org", "", "")
+
+	job, err := NewDigestJob(notifier, m, nil, "")
+	if err != nil {
+		t.Fatalf("NewDigestJob failed: %v", err)
+	}
+	if n := job.RunOnce(time.Now()); n != 1 {
+		t.Errorf("expected 1 digest, sent %d", n)
+	}
+	e := <-emails
+	want := "You are #2, up 1 place this week.\r\nMatches this week:\r\n  " + time.Now().Format("2 Jan") + ": Charlie beat Bob (11-0, 11-0, 11-0)\r\nWho to play next: Alice (#1)"
+	if e.to != "charlie@example.org" || !strings.Contains(e.msg, want) {
+		t.Errorf("unexpected digest %+v", e)
+	}
+
+	if _, err := NewDigestJob(notifier, m, nil, "every sunday"); err == nil {
+		t.Error("expected an error for an invalid schedule")
+	}
+}
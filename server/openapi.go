@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"squash-ladder/server/version"
+)
+
+const (
+	apiDocsPath = "/api/docs"
+
+	// swaggerUIVersion is the swagger-ui-dist release the docs page loads from unpkg
+	swaggerUIVersion = "5.17.14"
+)
+
+// openAPISchemas are the named schemas of the document, generated from the types
+// the handlers encode so the two cannot drift apart
+var openAPISchemas = map[string]reflect.Type{
+	"Error":        reflect.TypeOf(restError{}),
+	"Player":       reflect.TypeOf(publicPlayerV1{}),
+	"PlayerRef":    reflect.TypeOf(publicPlayerRefV1{}),
+	"Set":          reflect.TypeOf(publicSetV1{}),
+	"Match":        reflect.TypeOf(publicMatchV1{}),
+	"Standing":     reflect.TypeOf(publicStandingV1{}),
+	"LegacyPlayer": reflect.TypeOf(legacyPlayer{}),
+	"ResultLink":   reflect.TypeOf(resultLinkResponse{}),
+	"Attachment":   reflect.TypeOf(attachmentResponse{}),
+}
+
+// OpenAPIDocument returns an OpenAPI 3 description of the HTTP endpoints, for
+// serverURL or relative to wherever it is served when serverURL is empty
+func OpenAPIDocument(serverURL string) ([]byte, error) {
+	schemas := make(map[string]interface{}, len(openAPISchemas))
+	for name, t := range openAPISchemas {
+		schemas[name] = openAPISchema(t)
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Squash Ladder HTTP API",
+			"version":     version.Version,
+			"description": "The JSON and file endpoints beside the gRPC service. Third-party apps should use /api/public, whose schema is versioned with the X-API-Version header.",
+		},
+		"paths": openAPIPaths(),
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer":      map[string]interface{}{"type": "http", "scheme": "bearer", "description": "The admin token, or the member token in public mode"},
+				"playerToken": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Player-Token"},
+			},
+			"parameters": map[string]interface{}{
+				"club": map[string]interface{}{
+					"name": "X-Club-Id", "in": "header", "schema": map[string]string{"type": "string"},
+					"description": "The club, in multi-club mode; the host name can choose it instead",
+				},
+				"apiVersion": map[string]interface{}{
+					"name": apiVersionHeader, "in": "header", "schema": map[string]string{"type": "string", "default": "1"},
+					"description": "Version of the public API; responses carry the version they were written in",
+				},
+			},
+			"responses": map[string]interface{}{
+				"error": map[string]interface{}{
+					"description": "An error; code is the gRPC status name and the HTTP status follows it",
+					"content":     jsonContent(ref("Error")),
+				},
+			},
+		},
+	}
+	if serverURL != "" {
+		doc["servers"] = []map[string]string{{"url": strings.TrimSuffix(serverURL, "/")}}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func openAPIPaths() map[string]interface{} {
+	club := ref("#/components/parameters/club")
+	apiVersion := ref("#/components/parameters/apiVersion")
+	errorResponse := ref("#/components/responses/error")
+	query := func(name, typ, description string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "in": "query", "schema": map[string]string{"type": typ}, "description": description}
+	}
+	get := func(tag, summary string, params []interface{}, ok map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"get": map[string]interface{}{
+			"tags": []string{tag}, "summary": summary, "parameters": params,
+			"responses": map[string]interface{}{"200": ok, "default": errorResponse},
+		}}
+	}
+	listOf := func(key, schema string, extra map[string]interface{}) map[string]interface{} {
+		properties := map[string]interface{}{key: map[string]interface{}{"type": "array", "items": ref(schema)}}
+		for k, v := range extra {
+			properties[k] = v
+		}
+		return map[string]interface{}{"description": "OK", "content": jsonContent(map[string]interface{}{"type": "object", "properties": properties})}
+	}
+	file := func(contentType string) map[string]interface{} {
+		return map[string]interface{}{"description": "OK", "content": map[string]interface{}{contentType: map[string]interface{}{"schema": map[string]string{"type": "string", "format": "binary"}}}}
+	}
+	dateRange := []interface{}{club,
+		query("from", "string", "First day (YYYY-MM-DD); defaults to the start of last month"),
+		query("to", "string", "Last day (YYYY-MM-DD), inclusive")}
+
+	return map[string]interface{}{
+		"/api/public/players": get("Public API", "Players in ladder order", []interface{}{club, apiVersion},
+			listOf("players", "Player", nil)),
+		"/api/public/standings": get("Public API", "Players in ladder order with their record", []interface{}{club, apiVersion},
+			listOf("standings", "Standing", map[string]interface{}{"as_of": map[string]string{"type": "string", "format": "date-time"}})),
+		"/api/public/matches": get("Public API", "Recent matches, newest first", []interface{}{club, apiVersion,
+			query("limit", "integer", "At most this many, up to 100; defaults to 20")},
+			listOf("matches", "Match", nil)),
+		"/api/players": get("Legacy", "Players in ladder order (superseded by /api/public/players)", []interface{}{club},
+			listOf("players", "LegacyPlayer", nil)),
+		"/api/export/ladder.pdf":  get("Exports", "Printable standings and recent results", []interface{}{club}, file("application/pdf")),
+		"/api/export/results.csv": get("Exports", "Results in the ClubLocker upload layout", dateRange, file("text/csv")),
+		"/api/export/grid.html":   get("Exports", "Head-to-head results grid", dateRange, file("text/html")),
+		"/api/export/grid.csv":    get("Exports", "Head-to-head results grid", dateRange, file("text/csv")),
+		"/api/events": get("Live", "Ladder changes as server-sent events", []interface{}{club}, map[string]interface{}{
+			"description": "A stream of JSON events", "content": map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": map[string]string{"type": "string"}}},
+		}),
+		"/api/result-links": map[string]interface{}{"post": map[string]interface{}{
+			"tags": []string{"Result links"}, "summary": "Create a signed link to a form for one match's result",
+			"security": []map[string][]string{{"bearer": {}}},
+			"parameters": []interface{}{
+				query("challenger", "string", "Challenger's player ID"),
+				query("defender", "string", "Defender's player ID"),
+				query("club", "string", "The club, in multi-club mode"),
+			},
+			"responses": map[string]interface{}{"200": map[string]interface{}{"description": "OK", "content": jsonContent(ref("ResultLink"))}, "default": errorResponse},
+		}},
+		"/api/result-links/qr.png": get("Result links", "QR code of a result link", []interface{}{query("token", "string", "The link's token")}, file("image/png")),
+		"/api/matches/{transaction_id}/attachments": map[string]interface{}{"post": map[string]interface{}{
+			"tags": []string{"Attachments"}, "summary": "Attach a file, such as a scoresheet photo, to a match",
+			"security":   []map[string][]string{{"bearer": {}}, {"playerToken": {}}},
+			"parameters": []interface{}{club, map[string]interface{}{"name": "transaction_id", "in": "path", "required": true, "schema": map[string]string{"type": "string"}}},
+			"requestBody": map[string]interface{}{"required": true, "content": map[string]interface{}{"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{
+				"type": "object", "required": []string{"file"},
+				"properties": map[string]interface{}{"file": map[string]string{"type": "string", "format": "binary"}},
+			}}}},
+			"responses": map[string]interface{}{"201": map[string]interface{}{"description": "Attached", "content": jsonContent(ref("Attachment"))}, "default": errorResponse},
+		}},
+	}
+}
+
+func ref(name string) map[string]interface{} {
+	if !strings.HasPrefix(name, "#") {
+		name = "#/components/schemas/" + name
+	}
+	return map[string]interface{}{"$ref": name}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// openAPISchema describes how encoding/json writes t. Struct types with a name in
+// openAPISchemas are referred to rather than repeated.
+func openAPISchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		return openAPISchema(t.Elem())
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int32, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = openAPIFieldSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
+
+func openAPIFieldSchema(t reflect.Type) map[string]interface{} {
+	for name, named := range openAPISchemas {
+		if t == named {
+			return ref(name)
+		}
+	}
+	if t.Kind() == reflect.Slice {
+		return map[string]interface{}{"type": "array", "items": openAPIFieldSchema(t.Elem())}
+	}
+	return openAPISchema(t)
+}
+
+var apiDocsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Squash Ladder HTTP API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@{{.Version}}/swagger-ui-bundle.js" crossorigin></script>
+<script>
+  window.onload = function () {
+    SwaggerUIBundle({ url: {{.SpecURL}}, dom_id: "#swagger-ui" });
+  };
+</script>
+</body>
+</html>
+`))
+
+// APIDocs serves the OpenAPI document at /api/docs/openapi.json and Swagger UI, to
+// explore it, at /api/docs
+type APIDocs struct {
+	spec []byte
+}
+
+// NewAPIDocs generates the document once; publicURL, when set, is the server it
+// names
+func NewAPIDocs(publicURL string) (*APIDocs, error) {
+	spec, err := OpenAPIDocument(publicURL)
+	if err != nil {
+		return nil, err
+	}
+	return &APIDocs{spec: spec}, nil
+}
+
+// ServeHTTP serves the docs page and the document
+func (d *APIDocs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case apiDocsPath, apiDocsPath + "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		apiDocsTemplate.Execute(w, map[string]string{"Version": swaggerUIVersion, "SpecURL": apiDocsPath + "/openapi.json"})
+	case apiDocsPath + "/openapi.json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(d.spec)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	data, err := OpenAPIDocument("https://ladder.example.org/")
+	if err != nil {
+		t.Fatalf("OpenAPIDocument failed: %v", err)
+	}
+	var doc struct {
+		OpenAPI    string                            `json:"openapi"`
+		Servers    []struct{ URL string }            `json:"servers"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components map[string]map[string]interface{} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Servers) != 1 || doc.Servers[0].URL != "https://ladder.example.org" {
+		t.Errorf("unexpected header: %s %v", doc.OpenAPI, doc.Servers)
+	}
+	for _, path := range []string{"/api/public/players", "/api/public/standings", "/api/public/matches", "/api/players", "/api/export/results.csv"} {
+		if doc.Paths[path]["get"] == nil {
+			t.Errorf("no GET %s", path)
+		}
+	}
+
+	// Every reference resolves
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if target, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(target, "#/components/"), "/")
+				if len(parts) != 2 || doc.Components[parts[0]][parts[1]] == nil {
+					t.Errorf("dangling reference %s", target)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	var raw interface{}
+	json.Unmarshal(data, &raw)
+	walk(raw)
+
+	// Schemas follow the JSON encoding of the handlers' types
+	var player struct {
+		Properties map[string]map[string]string `json:"properties"`
+		Required   []string                     `json:"required"`
+	}
+	schema, _ := json.Marshal(doc.Components["schemas"]["Player"])
+	json.Unmarshal(schema, &player)
+	if player.Properties["rank"]["type"] != "integer" || player.Properties["category"]["type"] != "string" {
+		t.Errorf("unexpected Player properties %v", player.Properties)
+	}
+	if strings.Join(player.Required, ",") != "id,name,rank" {
+		t.Errorf("expected omitempty fields to be optional, got required %v", player.Required)
+	}
+	var match struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	schema, _ = json.Marshal(doc.Components["schemas"]["Match"])
+	json.Unmarshal(schema, &match)
+	if match.Properties["played_at"]["format"] != "date-time" || match.Properties["challenger"]["$ref"] != "#/components/schemas/PlayerRef" {
+		t.Errorf("unexpected Match properties %v", match.Properties)
+	}
+}
+
+func TestAPIDocs(t *testing.T) {
+	docs, err := NewAPIDocs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	docs.ServeHTTP(rec, httptest.NewRequest("GET", "/api/docs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"/api/docs/openapi.json"`) {
+		t.Errorf("expected the Swagger UI page, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	docs.ServeHTTP(rec, httptest.NewRequest("GET", "/api/docs/openapi.json", nil))
+	if rec.Code != http.StatusOK || !json.Valid(rec.Body.Bytes()) || strings.Contains(rec.Body.String(), `"servers"`) {
+		t.Errorf("expected the document without servers, got %d", rec.Code)
+	}
+}
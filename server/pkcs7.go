@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type pkcs7Algorithm struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+// signDetachedPKCS7 returns a DER PKCS #7 signature of content that does not include
+// content itself, as Apple Wallet expects of a pass's manifest. The signer's
+// certificate and chain are included so the signature can be checked on its own.
+func signDetachedPKCS7(content []byte, cert *x509.Certificate, key crypto.Signer, chain []*x509.Certificate, now time.Time) ([]byte, error) {
+	sha256Alg := pkcs7Algorithm{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	var sigAlg pkcs7Algorithm
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = pkcs7Algorithm{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	case *ecdsa.PublicKey:
+		sigAlg = pkcs7Algorithm{Algorithm: oidECDSAWithSHA256}
+	default:
+		return nil, fmt.Errorf("unsupported signing key %T", key.Public())
+	}
+
+	digest := sha256.Sum256(content)
+	var attrs [][]byte
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, now.UTC()},
+		{oidMessageDigest, digest[:]},
+	} {
+		value, err := asn1.Marshal(attr.value)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := asn1.Marshal(struct {
+			Type   asn1.ObjectIdentifier
+			Values asn1.RawValue
+		}{attr.oid, derSet(value)})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, encoded)
+	}
+	// The attributes are signed as a SET and sent as [0]
+	signedAttrs := derSet(attrs...)
+	attrsDigest := sha256.Sum256(signedAttrs.FullBytes)
+	signature, err := key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	signedAttrs.Class, signedAttrs.Tag, signedAttrs.FullBytes = asn1.ClassContextSpecific, 0, nil
+
+	signerInfo, err := asn1.Marshal(struct {
+		Version            int
+		IssuerAndSerial    pkcs7IssuerAndSerial
+		DigestAlgorithm    pkcs7Algorithm
+		SignedAttrs        asn1.RawValue
+		SignatureAlgorithm pkcs7Algorithm
+		Signature          []byte
+	}{1, pkcs7IssuerAndSerial{asn1.RawValue{FullBytes: cert.RawIssuer}, cert.SerialNumber}, sha256Alg, signedAttrs, sigAlg, signature})
+	if err != nil {
+		return nil, err
+	}
+	digestAlgs, err := asn1.Marshal(sha256Alg)
+	if err != nil {
+		return nil, err
+	}
+	var certs []byte
+	for _, c := range append([]*x509.Certificate{cert}, chain...) {
+		certs = append(certs, c.Raw...)
+	}
+
+	signedData, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: derSet(digestAlgs),
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      derSet(signerInfo),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData}})
+}
+
+// derSet encodes elements as a DER SET OF, which orders them by their encoding
+func derSet(elements ...[]byte) asn1.RawValue {
+	sorted := append([][]byte{}, elements...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	set := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(sorted, nil)}
+	set.FullBytes, _ = asn1.Marshal(set)
+	return set
+}
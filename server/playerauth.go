@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// playerTokenHeader carries a player token on player RPCs
+const playerTokenHeader = "x-player-token"
+
+// defaultPlayerTokenTTL is how long an issued player token lasts unless asked otherwise
+const defaultPlayerTokenTTL = 365 * 24 * time.Hour
+
+// PlayerAuth issues and checks signed tokens that identify a player, so the mobile
+// client can call the player RPCs without an account system. A token is bound to
+// one club's ladder.
+type PlayerAuth struct {
+	tokens signedTokens
+}
+
+// playerClaims is the signed payload of a player token
+type playerClaims struct {
+	ClubID    string `json:"c,omitempty"`
+	PlayerID  string `json:"p"`
+	ExpiresMs int64  `json:"e"`
+}
+
+func (c *playerClaims) expiresMs() int64 { return c.ExpiresMs }
+
+type playerClaimsKey struct{}
+
+// NewPlayerAuth creates an issuer signing with secret that checks expiry against
+// clock, or the system clock if it is nil
+func NewPlayerAuth(secret string, clock Clock) *PlayerAuth {
+	return &PlayerAuth{tokens: signedTokens{secret: []byte(secret), domain: "player", noun: "player token", clock: clock}}
+}
+
+// Sign returns a token carrying the claims
+func (a *PlayerAuth) Sign(claims playerClaims) string {
+	return a.tokens.sign(&claims)
+}
+
+// Verify checks a token's signature and expiry and returns its claims
+func (a *PlayerAuth) Verify(token string) (*playerClaims, error) {
+	var claims playerClaims
+	if err := a.tokens.verify(token, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// playerUnaryInterceptor checks the player token of requests that carry one and makes
+// its claims available to the handler
+func playerUnaryInterceptor(auth *PlayerAuth) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tokens := md.Get(playerTokenHeader)
+		if len(tokens) == 0 {
+			return handler(ctx, req)
+		}
+		if auth == nil {
+			return nil, status.Error(codes.Unauthenticated, "player tokens are not enabled on this server")
+		}
+		claims, err := auth.Verify(tokens[0])
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(context.WithValue(ctx, playerClaimsKey{}, claims), req)
+	}
+}
+
+// currentPlayer returns the player identified by the request's token and their
+// ladder, checking that the token belongs to the ladder the request is for
+func (h *LadderService) currentPlayer(ctx context.Context) (*Model, string, error) {
+	claims, ok := ctx.Value(playerClaimsKey{}).(*playerClaims)
+	if !ok {
+		return nil, "", status.Error(codes.Unauthenticated, "a player token is required")
+	}
+	m := h.modelFor(ctx)
+	if h.clubIDFor(m) != claims.ClubID {
+		return nil, "", status.Error(codes.PermissionDenied, "the player token is for a different club")
+	}
+	return m, claims.PlayerID, nil
+}
+
+// modelActingFor returns the ladder of a request made on behalf of playerID, which an
+// admin may do for anyone and a player with a token only for themselves
+func (h *LadderService) modelActingFor(ctx context.Context, playerID string) (*Model, error) {
+	if isAdmin(ctx) {
+		return h.modelFor(ctx), nil
+	}
+	m, tokenPlayerID, err := h.currentPlayer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tokenPlayerID != playerID {
+		return nil, localizedStatusf(codes.PermissionDenied, "players can only act for themselves")
+	}
+	return m, nil
+}
+
+// clubIDFor returns the ID of the club whose ladder is m, or "" for the default ladder
+func (h *LadderService) clubIDFor(m *Model) string {
+	if h.clubs == nil || m.modelState == h.model.modelState {
+		return ""
+	}
+	h.clubs.mu.Lock()
+	defer h.clubs.mu.Unlock()
+	for id, cm := range h.clubs.models {
+		if cm.modelState == m.modelState {
+			return id
+		}
+	}
+	return ""
+}
+
+// IssuePlayerToken creates a token identifying a player of the request's ladder
+func (h *LadderService) IssuePlayerToken(ctx context.Context, req *ladderpb.IssuePlayerTokenRequest) (*ladderpb.IssuePlayerTokenResponse, error) {
+	if h.playerAuth == nil {
+		return nil, fmt.Errorf("player tokens are not enabled on this server")
+	}
+	m := h.modelFor(ctx)
+	if findPlayer(m.ListPlayers(), req.PlayerId) == nil {
+		return nil, status.Error(codes.NotFound, "player not found")
+	}
+	ttl := defaultPlayerTokenTTL
+	if req.TtlDays > 0 {
+		ttl = time.Duration(req.TtlDays) * 24 * time.Hour
+	}
+	claims := playerClaims{ClubID: h.clubIDFor(m), PlayerID: req.PlayerId, ExpiresMs: m.now().Add(ttl).UnixMilli()}
+	return &ladderpb.IssuePlayerTokenResponse{Token: h.playerAuth.Sign(claims), ExpiresMs: claims.ExpiresMs}, nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+)
+
+// maxLookingForGame bounds how far ahead a player can say they are looking for a game
+const maxLookingForGame = 4 * time.Hour
+
+// presenceBoard holds who is looking for a game. It lives in memory only: a restart
+// forgets it, which at worst means a player sets it again.
+type presenceBoard struct {
+	mu        sync.Mutex
+	since     map[string]int64 // Player ID to when they started looking
+	until     map[string]int64
+	listeners []func()
+}
+
+// SetLookingForGame shows a player as looking for a game until until, or stops if it
+// is zero, and tells the presence listeners
+func (m *Model) SetLookingForGame(playerID string, until, now time.Time) (*ladderpb.LookingForGame, error) {
+	if !until.IsZero() && !until.After(now) {
+		return nil, localizedStatusf(codes.InvalidArgument, "until must be in the future")
+	}
+	if until.After(now.Add(maxLookingForGame)) {
+		return nil, localizedStatusf(codes.InvalidArgument, "you can look for a game for at most %d hours", int(maxLookingForGame.Hours()))
+	}
+	player := findPlayer(m.ListPlayers(), playerID)
+	if player == nil {
+		return nil, localizedStatusf(codes.NotFound, "player %s is not on the ladder", playerID)
+	}
+
+	b := &m.presence
+	b.mu.Lock()
+	if b.since == nil {
+		b.since, b.until = make(map[string]int64), make(map[string]int64)
+	}
+	if until.IsZero() {
+		delete(b.since, playerID)
+		delete(b.until, playerID)
+	} else {
+		if _, ok := b.since[playerID]; !ok {
+			b.since[playerID] = now.UnixMilli()
+		}
+		b.until[playerID] = until.UnixMilli()
+		time.AfterFunc(time.Until(until), func() { m.expireLooking(playerID) })
+	}
+	var entry *ladderpb.LookingForGame
+	if !until.IsZero() {
+		entry = &ladderpb.LookingForGame{
+			PlayerId: player.Id,
+			Name:     player.Name,
+			Rank:     player.Rank,
+			SinceMs:  b.since[playerID],
+			UntilMs:  b.until[playerID],
+		}
+	}
+	b.mu.Unlock()
+
+	m.notifyPresence()
+	return entry, nil
+}
+
+// expireLooking drops a player whose time has run out, unless they have extended it
+func (m *Model) expireLooking(playerID string) {
+	b := &m.presence
+	b.mu.Lock()
+	until, ok := b.until[playerID]
+	expired := ok && until <= m.now().UnixMilli()
+	if expired {
+		delete(b.since, playerID)
+		delete(b.until, playerID)
+	}
+	b.mu.Unlock()
+
+	if expired {
+		m.notifyPresence()
+	}
+}
+
+// LookingForGame returns the players on the ladder looking for a game at now, longest
+// waiting first
+func (m *Model) LookingForGame(now time.Time) []*ladderpb.LookingForGame {
+	players := m.ListPlayers()
+
+	b := &m.presence
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var looking []*ladderpb.LookingForGame
+	for id, until := range b.until {
+		p := findPlayer(players, id)
+		if p == nil || until <= now.UnixMilli() {
+			continue
+		}
+		looking = append(looking, &ladderpb.LookingForGame{
+			PlayerId: p.Id,
+			Name:     p.Name,
+			Rank:     p.Rank,
+			SinceMs:  b.since[id],
+			UntilMs:  until,
+		})
+	}
+	sort.Slice(looking, func(i, j int) bool {
+		if looking[i].SinceMs != looking[j].SinceMs {
+			return looking[i].SinceMs < looking[j].SinceMs
+		}
+		return looking[i].Rank < looking[j].Rank
+	})
+	return looking
+}
+
+// OnPresence registers fn to be called whenever someone starts or stops looking for
+// a game. Like OnChange listeners, it runs on its own goroutine.
+func (m *Model) OnPresence(fn func()) {
+	m.presence.mu.Lock()
+	defer m.presence.mu.Unlock()
+	m.presence.listeners = append(m.presence.listeners, fn)
+}
+
+func (m *Model) notifyPresence() {
+	m.presence.mu.Lock()
+	listeners := append([]func(){}, m.presence.listeners...)
+	m.presence.mu.Unlock()
+
+	for _, fn := range listeners {
+		go fn()
+	}
+}
+
+// SetLookingForGame shows a player as looking for a game now
+func (h *LadderService) SetLookingForGame(ctx context.Context, req *ladderpb.SetLookingForGameRequest) (*ladderpb.SetLookingForGameResponse, error) {
+	m, err := h.modelActingFor(ctx, req.PlayerId)
+	if err != nil {
+		return nil, err
+	}
+	var until time.Time
+	if req.Until != "" {
+		if until, err = time.Parse(time.RFC3339, req.Until); err != nil {
+			return nil, localizedStatusf(codes.InvalidArgument, "until must be an RFC 3339 time with an offset, e.g. 2024-03-02T19:30:00+01:00")
+		}
+	}
+	entry, err := m.SetLookingForGame(req.PlayerId, until, m.now())
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.SetLookingForGameResponse{Entry: entry}, nil
+}
+
+// ListLookingForGame returns the players looking for a game now
+func (h *LadderService) ListLookingForGame(ctx context.Context, req *ladderpb.ListLookingForGameRequest) (*ladderpb.ListLookingForGameResponse, error) {
+	m := h.modelFor(ctx)
+	return &ladderpb.ListLookingForGameResponse{Players: m.LookingForGame(m.now())}, nil
+}
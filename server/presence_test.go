@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestModel_LookingForGame(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	changed := make(chan struct{}, 10)
+	m.OnPresence(func() { changed <- struct{}{} })
+
+	now := time.Now()
+	if _, err := m.SetLookingForGame("alice", now.Add(-time.Minute), now); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a time in the past, got %v", err)
+	}
+	if _, err := m.SetLookingForGame("alice", now.Add(5*time.Hour), now); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument beyond the limit, got %v", err)
+	}
+	if _, err := m.SetLookingForGame("zoe", now.Add(time.Hour), now); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for an unknown player, got %v", err)
+	}
+
+	entry, err := m.SetLookingForGame("bob", now.Add(time.Hour), now)
+	if err != nil || entry.Name != "Bob" || entry.Rank != 2 {
+		t.Fatalf("unexpected entry %v, %v", entry, err)
+	}
+	m.SetLookingForGame("alice", now.Add(50*time.Millisecond), now.Add(time.Millisecond))
+	looking := m.LookingForGame(now)
+	if len(looking) != 2 || looking[0].PlayerId != "bob" {
+		t.Errorf("expected Bob to have waited longest, got %v", looking)
+	}
+
+	// Alice expires on her own and the listeners hear about it
+	for i := 0; i < 3; i++ {
+		select {
+		case <-changed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected a presence notification")
+		}
+	}
+	if looking := m.LookingForGame(time.Now()); len(looking) != 1 || looking[0].PlayerId != "bob" {
+		t.Errorf("expected only Bob after Alice expired, got %v", looking)
+	}
+
+	if entry, err := m.SetLookingForGame("bob", time.Time{}, now); err != nil || entry != nil {
+		t.Errorf("expected Bob to stop looking, got %v, %v", entry, err)
+	}
+	if looking := m.LookingForGame(time.Now()); len(looking) != 0 {
+		t.Errorf("expected nobody looking, got %v", looking)
+	}
+}
+
+func TestLadderService_SetLookingForGame(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	svc := NewLadderService(m)
+	ctx := context.WithValue(context.Background(), playerClaimsKey{}, &playerClaims{PlayerID: "alice"})
+	until := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	if _, err := svc.SetLookingForGame(ctx, &ladderpb.SetLookingForGameRequest{PlayerId: "bob", Until: until}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for another player, got %v", err)
+	}
+	if _, err := svc.SetLookingForGame(ctx, &ladderpb.SetLookingForGameRequest{PlayerId: "alice", Until: "tonight"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a bad time, got %v", err)
+	}
+	if _, err := svc.SetLookingForGame(ctx, &ladderpb.SetLookingForGameRequest{PlayerId: "alice", Until: until}); err != nil {
+		t.Fatalf("SetLookingForGame failed: %v", err)
+	}
+	resp, err := svc.ListLookingForGame(context.Background(), &ladderpb.ListLookingForGameRequest{})
+	if err != nil || len(resp.Players) != 1 || resp.Players[0].PlayerId != "alice" {
+		t.Errorf("expected Alice to be looking, got %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+// concernsPlayer reports whether a transaction's payload refers to playerID
+func concernsPlayer(t *storagepb.TransactionStorage, playerID string) bool {
+	switch p := replay.Payload(t).(type) {
+	case *storagepb.AddPlayerStorage:
+		return p.PlayerId == playerID
+	case *storagepb.RemovePlayerStorage:
+		return p.PlayerId == playerID
+	case *storagepb.MatchResultStorage:
+		return p.ChallengerId == playerID || p.DefenderId == playerID
+	case *storagepb.SetHandicapStorage:
+		return p.PlayerId == playerID
+	case *storagepb.SetCategoryStorage:
+		return p.PlayerId == playerID
+	case *storagepb.SetProtectionStorage:
+		return p.PlayerId == playerID
+	case *storagepb.ErasePlayerStorage:
+		return p.PlayerId == playerID
+	case *storagepb.RenamePlayersStorage:
+		for _, r := range p.Renames {
+			if r.PlayerId == playerID {
+				return true
+			}
+		}
+	case *storagepb.WaitingListStorage:
+		return p.PlayerId == playerID
+	case *storagepb.JoinRequestStorage:
+		return p.PlayerId == playerID
+	case *storagepb.JoinRejectedStorage:
+		return p.PlayerId == playerID
+	case *storagepb.AttachmentStorage:
+		return p.UploadedBy == playerID
+	case *storagepb.TeamStorage:
+		for _, id := range p.PlayerIds {
+			if id == playerID {
+				return true
+			}
+		}
+	case *storagepb.FixtureStorage:
+		for _, r := range p.Rubbers {
+			if r.PlayerId == playerID {
+				return true
+			}
+		}
+	case *storagepb.AttendanceStorage:
+		for _, id := range p.PlayerIds {
+			if id == playerID {
+				return true
+			}
+		}
+	case *storagepb.ReorderStorage:
+		for _, id := range p.PlayerIds {
+			if id == playerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExportPlayerData collects everything the log holds about a player: their details,
+// the names they have been listed under, their matches and ratings, and every
+// transaction about them
+func (m *Model) ExportPlayerData(ctx context.Context, playerID string) (*ladderpb.ExportPlayerDataResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := playerNames(txs)
+	if _, ok := names[playerID]; !ok {
+		return nil, fmt.Errorf("player not found")
+	}
+	invalidatedBy := make(map[string]string)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidatedBy[id] = t.Id
+			}
+		}
+	}
+	ratings := computeRatings(txs)
+
+	export := &ladderpb.ExportPlayerDataResponse{
+		Player:        &ladderpb.Player{Id: playerID, Name: names[playerID]},
+		Matches:       []*ladderpb.MatchResult{},
+		Transactions:  []*ladderpb.TransactionSummary{},
+		CurrentRating: ratings.rating(playerID),
+		RatingHistory: ratings.history[playerID],
+		ExportedAtMs:  m.now().UnixMilli(),
+	}
+	if export.RatingHistory == nil {
+		export.RatingHistory = []*ladderpb.RatingPoint{}
+	}
+
+	var last *storagepb.PlayerStorage // Latest listing of the player
+	seen := make(map[string]bool)
+	addName := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			export.Names = append(export.Names, name)
+		}
+	}
+	for _, t := range txs {
+		if p := t.GetAddPlayerPayload(); p != nil && p.PlayerId == playerID {
+			addName(p.Name)
+		}
+		for _, p := range t.PlayerList {
+			if p.Id == playerID {
+				addName(p.Name)
+				last = p
+			}
+		}
+		for _, r := range t.GetRenamePlayersPayload().GetRenames() {
+			if r.PlayerId == playerID {
+				addName(r.OldName)
+			}
+		}
+		if !concernsPlayer(t, playerID) {
+			continue
+		}
+		export.Transactions = append(export.Transactions, summarizeTransaction(t, names, invalidatedBy[t.Id]))
+		if t.GetMatchResultPayload() != nil && invalidatedBy[t.Id] == "" {
+			mr := matchResultFromStorage(t)
+			ratings.annotate(mr)
+			export.Matches = append(export.Matches, mr)
+		}
+	}
+
+	// Details as last listed; rank stays 0 once the player has left
+	if last != nil {
+		export.Player = storageToLadder([]*storagepb.PlayerStorage{last})[0]
+		export.Player.Rank = 0
+		for _, p := range txs[len(txs)-1].PlayerList {
+			if p.Id == playerID {
+				export.Player.Rank = p.Rank
+			}
+		}
+	}
+	return export, nil
+}
+
+// ErasePlayer replaces a player's name with a pseudonym in every transaction of the
+// log, then records the erasure as an ERASE_PLAYER transaction. The player's ID,
+// matches and ranks are kept, so ratings and the ladder's history are unchanged. The
+// client addresses recorded on the transactions that concern the player, such as the
+// phone number of a result they texted in, are dropped too.
+// Backups written before the erasure still hold the old name and must be handled
+// separately. It returns the pseudonym and the ID of the new transaction.
+func (m *Model) ErasePlayer(ctx context.Context, playerID string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.maintenance.check(); err != nil {
+		return "", "", err
+	}
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := playerNames(txs)[playerID]; !ok {
+		return "", "", fmt.Errorf("player not found")
+	}
+	for _, t := range txs {
+		if p := t.GetErasePlayerPayload(); p != nil && p.PlayerId == playerID {
+			return "", "", fmt.Errorf("player %s has already been erased", playerID)
+		}
+	}
+
+	suffix := m.newID()
+	if len(suffix) > 8 {
+		suffix = suffix[:8]
+	}
+	pseudonym := "Erased player " + suffix
+	for _, t := range txs {
+		if p := t.GetAddPlayerPayload(); p != nil && p.PlayerId == playerID {
+			p.Name = pseudonym
+		}
+		if p := t.GetWaitingListPayload(); p != nil && p.PlayerId == playerID {
+			p.Name = pseudonym
+		}
+		if p := t.GetJoinRequestPayload(); p != nil && p.PlayerId == playerID {
+			p.Name = pseudonym
+		}
+		for _, p := range t.PlayerList {
+			if p.Id == playerID {
+				p.Name = pseudonym
+			}
+		}
+		for _, r := range t.GetRenamePlayersPayload().GetRenames() {
+			if r.PlayerId == playerID {
+				r.OldName, r.NewName = pseudonym, pseudonym
+			}
+		}
+		if t.Client != nil && concernsPlayer(t, playerID) {
+			t.Client.RemoteAddr = ""
+		}
+	}
+	if err := m.rewriteLogLocked(txs); err != nil {
+		return "", "", fmt.Errorf("failed to rewrite log: %v", err)
+	}
+
+	var current []*ladderpb.Player
+	if len(txs) > 0 {
+		current = storageToLadder(txs[len(txs)-1].PlayerList)
+	}
+	payload := &storagepb.ErasePlayerStorage{PlayerId: playerID, Pseudonym: pseudonym}
+	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_ERASE_PLAYER, payload, current)
+	if err != nil {
+		return "", "", err
+	}
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_ERASE_PLAYER,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_ErasePlayerPayload{ErasePlayerPayload: payload},
+		PlayerList:  ladderToStorage(newPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", "", err
+	}
+	return pseudonym, tx.Id, nil
+}
+
+// ExportPlayerData returns all data held about a player
+func (h *LadderService) ExportPlayerData(ctx context.Context, req *ladderpb.ExportPlayerDataRequest) (*ladderpb.ExportPlayerDataResponse, error) {
+	return h.modelFor(ctx).ExportPlayerData(ctx, req.PlayerId)
+}
+
+// ErasePlayer pseudonymizes a player throughout the log, and forgets their contact
+// details, wallet cards, match attachments and results waiting for confirmation
+func (h *LadderService) ErasePlayer(ctx context.Context, req *ladderpb.ErasePlayerRequest) (*ladderpb.ErasePlayerResponse, error) {
+	m := h.modelFor(ctx)
+	pseudonym, txID, err := m.ErasePlayer(ctx, req.PlayerId)
+	if err != nil {
+		return &ladderpb.ErasePlayerResponse{Success: false}, err
+	}
+	clubID := h.clubIDFor(m)
+	if h.notifier != nil {
+		if err := h.notifier.store.Forget(clubID, req.PlayerId); err != nil {
+			log.Printf("notifications: failed to forget %s: %v", req.PlayerId, err)
+		}
+	}
+	if h.wallet != nil {
+		if err := h.wallet.store.forget(walletSerial(clubID, req.PlayerId)); err != nil {
+			log.Printf("wallet: failed to forget %s: %v", req.PlayerId, err)
+		}
+	}
+	if h.attachments != nil {
+		if err := h.attachments.forget(ctx, m, req.PlayerId); err != nil {
+			log.Printf("attachments: failed to forget %s: %v", req.PlayerId, err)
+		}
+	}
+	if h.sms != nil {
+		h.sms.pending.forget(clubID, req.PlayerId)
+	}
+	if h.telegram != nil {
+		h.telegram.pending.forget(clubID, req.PlayerId)
+	}
+	return &ladderpb.ErasePlayerResponse{Success: true, Pseudonym: pseudonym, TransactionId: txID}, nil
+}
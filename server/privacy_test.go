@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_ExportAndErasePlayer(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	m.AddPlayer("Alice Smith", "alice")
+	m.AddPlayer("Bob Jones", "bob")
+	m.AddPlayer("Charlie Brown", "charlie")
+	m.AddMatchResult("bob", "alice", "bob", sets)
+	m.AddMatchResult("charlie", "alice", "charlie", sets)
+
+	export, err := m.ExportPlayerData(context.Background(), "bob")
+	if err != nil {
+		t.Fatalf("ExportPlayerData failed: %v", err)
+	}
+	if export.Player.Name != "Bob Jones" || export.Player.Rank != 1 {
+		t.Errorf("unexpected player in export: %v", export.Player)
+	}
+	if len(export.Matches) != 1 || len(export.Transactions) != 2 || len(export.RatingHistory) != 1 {
+		t.Errorf("expected 1 match, 2 transactions and 1 rating point, got %d, %d, %d",
+			len(export.Matches), len(export.Transactions), len(export.RatingHistory))
+	}
+
+	before := m.ListPlayers()
+	pseudonym, txID, err := m.ErasePlayer(context.Background(), "bob")
+	if err != nil {
+		t.Fatalf("ErasePlayer failed: %v", err)
+	}
+	if txID == "" || !strings.HasPrefix(pseudonym, "Erased player ") {
+		t.Errorf("unexpected erasure result %q, %q", pseudonym, txID)
+	}
+
+	// Ranks and matches are untouched, only the name changes
+	after := m.ListPlayers()
+	for i := range before {
+		if before[i].Id != after[i].Id || before[i].Rank != after[i].Rank {
+			t.Errorf("erasure moved players: %v -> %v", before, after)
+		}
+	}
+	if after[0].Name != pseudonym {
+		t.Errorf("expected %q on the ladder, got %q", pseudonym, after[0].Name)
+	}
+	if matches, _ := m.GetRecentMatches(10); len(matches) != 2 {
+		t.Errorf("expected both matches to survive, got %d", len(matches))
+	}
+
+	// The name is gone from every line of the log
+	data, _ := os.ReadFile(path)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		raw, _ := base64.StdEncoding.DecodeString(line)
+		if bytes.Contains(raw, []byte("Bob Jones")) {
+			t.Fatal("the erased name is still in the log")
+		}
+	}
+	if report, err := m.VerifyLog(context.Background(), false); err != nil || !report.OK() {
+		t.Errorf("log no longer verifies after erasure: %v, %v", report, err)
+	}
+
+	export, _ = m.ExportPlayerData(context.Background(), "bob")
+	if len(export.Names) != 1 || export.Names[0] != pseudonym {
+		t.Errorf("expected only the pseudonym in the export, got %v", export.Names)
+	}
+
+	if _, _, err := m.ErasePlayer(context.Background(), "bob"); err == nil {
+		t.Error("expected erasing twice to fail")
+	}
+	if _, _, err := m.ErasePlayer(context.Background(), "nobody"); err == nil {
+		t.Error("expected erasing an unknown player to fail")
+	}
+}
+
+func TestModel_ErasePlayer_ClientAddresses(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	svc := NewLadderService(m)
+	svc.recordClientAddresses = true
+
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	for _, id := range []string{"alice", "bob", "carol", "dave"} {
+		m.AddPlayer(id, id)
+	}
+	bobs := svc.clientContext(context.Background(), clientSMS, "", "+15550100")
+	if _, err := svc.AddMatchResult(bobs, &ladderpb.AddMatchResultRequest{ChallengerId: "bob", DefenderId: "alice", WinnerId: "bob", SetScores: sets}); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	carols := svc.clientContext(context.Background(), clientSMS, "", "+15550199")
+	if _, err := svc.AddMatchResult(carols, &ladderpb.AddMatchResultRequest{ChallengerId: "dave", DefenderId: "carol", WinnerId: "dave", SetScores: sets}); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+
+	if _, _, err := m.ErasePlayer(context.Background(), "bob"); err != nil {
+		t.Fatalf("ErasePlayer failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		raw, _ := base64.StdEncoding.DecodeString(line)
+		if bytes.Contains(raw, []byte("+15550100")) {
+			t.Fatal("the erased player's phone number is still in the log")
+		}
+	}
+	// Transactions that don't concern the player keep their addresses
+	txs, _, _ := m.ListTransactions(context.Background(), 2, "", nil)
+	if txs[1].ClientAddr != "+15550199" || txs[1].ClientType != clientSMS {
+		t.Errorf("expected the other match to keep its client, got %q %q", txs[1].ClientType, txs[1].ClientAddr)
+	}
+}
+
+func TestLadderService_ErasePlayer_Forgets(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	for _, id := range []string{"alice", "bob", "carol", "dave"} {
+		m.AddPlayer(id, id)
+	}
+	bobsMatch, _ := m.AddMatchResult("bob", "alice", "bob", sets)
+	othersMatch, _ := m.AddMatchResult("dave", "carol", "dave", sets)
+
+	svc := NewLadderService(m)
+	files := dirTarget(t.TempDir())
+	svc.attachments = NewAttachments(svc, nil, "", files, "secret", 0, 1024, "", "admin")
+	for id, match := range map[string]string{"bobs-photo": bobsMatch, "others-photo": othersMatch} {
+		files.Put(ctx, id, []byte("photo"))
+		if _, err := m.AttachToMatch(id, match, "image/png", 5, ""); err != nil {
+			t.Fatalf("AttachToMatch failed: %v", err)
+		}
+	}
+
+	cards, err := openWalletStore(filepath.Join(t.TempDir(), "wallet.json"))
+	if err != nil {
+		t.Fatalf("openWalletStore failed: %v", err)
+	}
+	cards.register("phone", "push-token", walletSerial("", "bob"))
+	cards.register("phone", "push-token", walletSerial("", "carol"))
+	svc.wallet = &WalletPasses{store: cards}
+
+	svc.sms = NewSMSHandler(svc, "", "")
+	bobsCode, _ := svc.sms.pending.add("+100", "", &ladderpb.AddMatchResultRequest{ChallengerId: "bob", DefenderId: "alice"}, "")
+	othersCode, _ := svc.sms.pending.add("+100", "", &ladderpb.AddMatchResultRequest{ChallengerId: "dave", DefenderId: "carol"}, "")
+
+	if _, err := svc.ErasePlayer(ctx, &ladderpb.ErasePlayerRequest{PlayerId: "bob"}); err != nil {
+		t.Fatalf("ErasePlayer failed: %v", err)
+	}
+
+	if _, err := files.Get(ctx, "bobs-photo"); err == nil {
+		t.Error("the photo of Bob's match should be deleted")
+	}
+	if _, err := files.Get(ctx, "others-photo"); err != nil {
+		t.Errorf("other matches' photos should be kept: %v", err)
+	}
+	if serials, _ := cards.updatedSince("phone", 0); len(serials) != 1 || serials[0] != walletSerial("", "carol") {
+		t.Errorf("expected only Carol's card left on the device, got %v", serials)
+	}
+	if _, ok := cards.passes[walletSerial("", "bob")]; ok {
+		t.Error("Bob's card should be forgotten")
+	}
+	if _, ok := svc.sms.pending.take("+100", bobsCode); ok {
+		t.Error("Bob's pending result should be dropped")
+	}
+	if _, ok := svc.sms.pending.take("+100", othersCode); !ok {
+		t.Error("other pending results should be kept")
+	}
+}
+
+func TestModel_ErasePlayer_NotUndoable(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	_, eraseID, err := m.ErasePlayer(ctx, "bob")
+	if err != nil {
+		t.Fatalf("ErasePlayer failed: %v", err)
+	}
+
+	if _, err := m.planInvalidation(ctx, nil, []string{eraseID}, true); err == nil {
+		t.Error("expected the erasure not to be invalidatable")
+	}
+	undone, _, err := m.UndoLastTransaction(ctx)
+	if err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	if p := undone.GetAddPlayerPayload(); p == nil || p.PlayerId != "carol" {
+		t.Errorf("expected undo to skip the erasure and remove Carol, got %s", undone.Type)
+	}
+	if _, _, err := m.ErasePlayer(ctx, "bob"); err == nil {
+		t.Error("expected Bob to stay erased")
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"google.golang.org/grpc/codes"
+)
+
+// SetPlayerProtection protects a player's rank from from until until, or clears the
+// protection when both are zero, returning the transaction ID
+func (m *Model) SetPlayerProtection(playerID string, from, until time.Time) (string, error) {
+	payload := &storagepb.SetProtectionStorage{PlayerId: playerID}
+	if !from.IsZero() || !until.IsZero() {
+		if !until.After(from) {
+			return "", localizedErrorf("protection must end after it starts")
+		}
+		payload.FromMs, payload.UntilMs = from.UnixMilli(), until.UnixMilli()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", err
+	}
+
+	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_SET_PROTECTION, payload, currentPlayers)
+	if err != nil {
+		return "", err
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_SET_PROTECTION,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_SetProtectionPayload{SetProtectionPayload: payload},
+		PlayerList:  ladderToStorage(newPlayers),
+	}
+
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	return tx.Id, nil
+}
+
+// protectedAt reports whether p is protected at t
+func protectedAt(p *ladderpb.Player, t time.Time) bool {
+	ms := t.UnixMilli()
+	return p.ProtectedUntilMs != 0 && ms >= p.ProtectedFromMs && ms < p.ProtectedUntilMs
+}
+
+// parseProtection reads the first and last protected days in loc and returns the
+// window they cover, with until at the start of the day after to
+func parseProtection(from, to string, loc *time.Location) (time.Time, time.Time, error) {
+	if from == "" && to == "" {
+		return time.Time{}, time.Time{}, nil
+	}
+	start, err := time.ParseInLocation("2006-01-02", from, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, localizedStatusf(codes.InvalidArgument, "protection dates must look like 2024-07-01")
+	}
+	end, err := time.ParseInLocation("2006-01-02", to, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, localizedStatusf(codes.InvalidArgument, "protection dates must look like 2024-07-01")
+	}
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// SetPlayerProtection protects a player's rank while they are away. Admins can set it
+// for anyone and players with a token for themselves.
+func (h *LadderService) SetPlayerProtection(ctx context.Context, req *ladderpb.SetPlayerProtectionRequest) (*ladderpb.SetPlayerProtectionResponse, error) {
+	m, err := h.modelActingFor(ctx, req.PlayerId)
+	if err != nil {
+		return &ladderpb.SetPlayerProtectionResponse{Success: false}, err
+	}
+
+	from, until, err := parseProtection(req.From, req.To, m.TimeZone())
+	if err != nil {
+		return &ladderpb.SetPlayerProtectionResponse{Success: false}, err
+	}
+	txID, err := m.SetPlayerProtection(req.PlayerId, from, until)
+	if err != nil {
+		return &ladderpb.SetPlayerProtectionResponse{Success: false}, err
+	}
+	return &ladderpb.SetPlayerProtectionResponse{Success: true, TransactionId: txID}, nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLadderService_SetPlayerProtection(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, TimeZone: "Europe/London"})
+	svc := NewLadderService(m)
+
+	today := time.Now().In(m.TimeZone())
+	req := &ladderpb.SetPlayerProtectionRequest{
+		PlayerId: "alice",
+		From:     today.AddDate(0, 0, -1).Format("2006-01-02"),
+		To:       today.AddDate(0, 0, 14).Format("2006-01-02"),
+	}
+	if _, err := svc.SetPlayerProtection(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a token, got %v", err)
+	}
+	bob := context.WithValue(context.Background(), playerClaimsKey{}, &playerClaims{PlayerID: "bob"})
+	if _, err := svc.SetPlayerProtection(bob, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for another player, got %v", err)
+	}
+	alice := context.WithValue(context.Background(), playerClaimsKey{}, &playerClaims{PlayerID: "alice"})
+	for _, bad := range []*ladderpb.SetPlayerProtectionRequest{
+		{PlayerId: "alice", From: "1 July", To: req.To},
+		{PlayerId: "alice", From: req.To, To: req.From},
+	} {
+		if _, err := svc.SetPlayerProtection(alice, bad); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+	if _, err := svc.SetPlayerProtection(alice, req); err != nil {
+		t.Fatalf("SetPlayerProtection failed: %v", err)
+	}
+
+	p := m.ListPlayers()[0]
+	wantUntil, _ := time.ParseInLocation("2006-01-02", today.AddDate(0, 0, 15).Format("2006-01-02"), m.TimeZone())
+	if p.ProtectedUntilMs != wantUntil.UnixMilli() || !protectedAt(p, time.Now()) || protectedAt(p, wantUntil) {
+		t.Errorf("expected Alice to be protected through the last day, got %+v", p)
+	}
+
+	// Alice can't be challenged, but a match from before the holiday can still be entered
+	win := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	_, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{ChallengerId: "bob", DefenderId: "alice", WinnerId: "bob", SetScores: win})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition while Alice is protected, got %v", err)
+	}
+	_, err = svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+		ChallengerId: "bob", DefenderId: "alice", WinnerId: "bob", SetScores: win,
+		PlayedAt: time.Now().AddDate(0, 0, -3).Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Errorf("expected a match played before the protection to be accepted, got %v", err)
+	}
+
+	dash, err := m.Dashboard("alice", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobDash, _ := m.Dashboard("bob", 0, time.Now())
+	if len(bobDash.SuggestedOpponents) != 0 || len(dash.SuggestedOpponents) != 1 {
+		t.Errorf("expected nobody to be told to challenge Alice, got %v", bobDash.SuggestedOpponents)
+	}
+
+	if _, err := svc.SetPlayerProtection(alice, &ladderpb.SetPlayerProtectionRequest{PlayerId: "alice"}); err != nil {
+		t.Fatalf("clearing the protection failed: %v", err)
+	}
+	if p := findPlayer(m.ListPlayers(), "alice"); p.ProtectedFromMs != 0 || p.ProtectedUntilMs != 0 {
+		t.Errorf("expected the protection to be cleared, got %+v", p)
+	}
+	history, _, _ := m.ListTransactions(context.Background(), 1, "", nil)
+	if history[0].Summary != "Cleared the protection of Alice" {
+		t.Errorf("unexpected summary %q", history[0].Summary)
+	}
+}
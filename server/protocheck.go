@@ -0,0 +1,382 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// protoBaseline is the API as last released, as a FileDescriptorSet, which buf also
+// reads as an image: buf breaking proto --against proto/ladder.binpb. Rewrite it
+// with "server proto-check -write proto/ladder.binpb" when a release ships.
+//
+//go:embed proto/ladder.binpb
+var protoBaseline []byte
+
+// ProtoProblem is a lint or breaking-change finding, named by the buf rule it
+// follows
+type ProtoProblem struct {
+	Rule    string // e.g. FIELD_SAME_TYPE
+	Element string // Full name of the message, field, enum or RPC
+	Message string
+}
+
+func (p ProtoProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Rule, p.Element, p.Message)
+}
+
+// ProtoDescriptors returns the API this binary serves
+func ProtoDescriptors() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(ladderpb.File_ladder_proto),
+	}}
+}
+
+// ProtoBaseline returns the stored baseline the API is checked against
+func ProtoBaseline() (*descriptorpb.FileDescriptorSet, error) {
+	return ParseProtoDescriptors(protoBaseline)
+}
+
+// ParseProtoDescriptors reads a serialized FileDescriptorSet or buf image
+func ParseProtoDescriptors(data []byte) (*descriptorpb.FileDescriptorSet, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("reading descriptors: %w", err)
+	}
+	return set, nil
+}
+
+// MarshalProtoDescriptors serializes a set for a baseline, the same for the same
+// descriptors
+func MarshalProtoDescriptors(set *descriptorpb.FileDescriptorSet) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(set)
+}
+
+// FetchProtoDescriptors reads the services a running server offers, and the files
+// that define them, through gRPC reflection (Config.GRPCReflection)
+func FetchProtoDescriptors(ctx context.Context, conn grpc.ClientConnInterface) (*descriptorpb.FileDescriptorSet, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+	ask := func(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("server closed the reflection stream")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("reflection: %s", e.ErrorMessage)
+		}
+		return resp, nil
+	}
+
+	resp, err := ask(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*descriptorpb.FileDescriptorProto{}
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		if strings.HasPrefix(svc.Name, "grpc.") {
+			continue // Reflection and health, which the server doesn't define
+		}
+		resp, err := ask(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: svc.Name}})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", svc.Name, err)
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, fd); err != nil {
+				return nil, fmt.Errorf("%s: %w", svc.Name, err)
+			}
+			files[fd.GetName()] = fd
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("the server lists no services")
+	}
+	return sortedFiles(files), nil
+}
+
+// sortedFiles orders files by name with each one's imports before it, as buf
+// expects of an image
+func sortedFiles(files map[string]*descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorSet {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	set := &descriptorpb.FileDescriptorSet{}
+	added := map[string]bool{}
+	var add func(name string)
+	add = func(name string) {
+		fd, ok := files[name]
+		if !ok || added[name] {
+			return
+		}
+		added[name] = true
+		for _, dep := range fd.GetDependency() {
+			add(dep)
+		}
+		set.File = append(set.File, fd)
+	}
+	for _, name := range names {
+		add(name)
+	}
+	return set
+}
+
+// CheckProtoBreaking returns the changes from baseline to current that would break
+// clients built against the baseline, by buf's FILE rules: deleted elements, and
+// fields, enum values and RPCs whose wire or JSON form changed. A field or enum
+// value may be deleted if its number is reserved.
+func CheckProtoBreaking(baseline, current *descriptorpb.FileDescriptorSet) ([]ProtoProblem, error) {
+	before, err := protodesc.NewFiles(baseline)
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+	after, err := protodesc.NewFiles(current)
+	if err != nil {
+		return nil, err
+	}
+	var problems []ProtoProblem
+	add := func(rule string, d protoreflect.Descriptor, format string, args ...interface{}) {
+		problems = append(problems, ProtoProblem{Rule: rule, Element: string(d.FullName()), Message: fmt.Sprintf(format, args...)})
+	}
+
+	var checkMessages func(old protoreflect.MessageDescriptors)
+	var checkEnums func(old protoreflect.EnumDescriptors)
+	checkMessages = func(old protoreflect.MessageDescriptors) {
+		for i := 0; i < old.Len(); i++ {
+			om := old.Get(i)
+			d, err := after.FindDescriptorByName(om.FullName())
+			nm, ok := d.(protoreflect.MessageDescriptor)
+			if err != nil || !ok {
+				add("MESSAGE_NO_DELETE", om, "message was deleted")
+				continue
+			}
+			checkFields(om, nm, add)
+			checkMessages(om.Messages())
+			checkEnums(om.Enums())
+		}
+	}
+	checkEnums = func(old protoreflect.EnumDescriptors) {
+		for i := 0; i < old.Len(); i++ {
+			oe := old.Get(i)
+			d, err := after.FindDescriptorByName(oe.FullName())
+			ne, ok := d.(protoreflect.EnumDescriptor)
+			if err != nil || !ok {
+				add("ENUM_NO_DELETE", oe, "enum was deleted")
+				continue
+			}
+			for j := 0; j < oe.Values().Len(); j++ {
+				ov := oe.Values().Get(j)
+				nv := ne.Values().ByNumber(ov.Number())
+				switch {
+				case nv == nil && !ne.ReservedRanges().Has(ov.Number()):
+					add("ENUM_VALUE_NO_DELETE_UNLESS_NUMBER_RESERVED", ov, "value %d was deleted without reserving its number", ov.Number())
+				case nv != nil && nv.Name() != ov.Name():
+					add("ENUM_VALUE_SAME_NAME", ov, "value %d was renamed to %s", ov.Number(), nv.Name())
+				}
+			}
+		}
+	}
+
+	before.RangeFiles(func(of protoreflect.FileDescriptor) bool {
+		if _, err := after.FindFileByPath(of.Path()); err != nil {
+			problems = append(problems, ProtoProblem{Rule: "FILE_NO_DELETE", Element: of.Path(), Message: "file was deleted"})
+			return true
+		}
+		checkMessages(of.Messages())
+		checkEnums(of.Enums())
+		for i := 0; i < of.Services().Len(); i++ {
+			osvc := of.Services().Get(i)
+			d, err := after.FindDescriptorByName(osvc.FullName())
+			nsvc, ok := d.(protoreflect.ServiceDescriptor)
+			if err != nil || !ok {
+				add("SERVICE_NO_DELETE", osvc, "service was deleted")
+				continue
+			}
+			for j := 0; j < osvc.Methods().Len(); j++ {
+				om := osvc.Methods().Get(j)
+				nm := nsvc.Methods().ByName(om.Name())
+				switch {
+				case nm == nil:
+					add("RPC_NO_DELETE", om, "RPC was deleted")
+				case nm.Input().FullName() != om.Input().FullName():
+					add("RPC_SAME_REQUEST_TYPE", om, "request changed from %s to %s", om.Input().FullName(), nm.Input().FullName())
+				case nm.Output().FullName() != om.Output().FullName():
+					add("RPC_SAME_RESPONSE_TYPE", om, "response changed from %s to %s", om.Output().FullName(), nm.Output().FullName())
+				case nm.IsStreamingClient() != om.IsStreamingClient():
+					add("RPC_SAME_CLIENT_STREAMING", om, "client streaming changed to %t", nm.IsStreamingClient())
+				case nm.IsStreamingServer() != om.IsStreamingServer():
+					add("RPC_SAME_SERVER_STREAMING", om, "server streaming changed to %t", nm.IsStreamingServer())
+				}
+			}
+		}
+		return true
+	})
+	sortProblems(problems)
+	return problems, nil
+}
+
+// checkFields compares a message's fields by number
+func checkFields(om, nm protoreflect.MessageDescriptor, add func(string, protoreflect.Descriptor, string, ...interface{})) {
+	for i := 0; i < om.Fields().Len(); i++ {
+		of := om.Fields().Get(i)
+		nf := nm.Fields().ByNumber(of.Number())
+		if nf == nil {
+			if !nm.ReservedRanges().Has(of.Number()) {
+				add("FIELD_NO_DELETE_UNLESS_NUMBER_RESERVED", of, "field %d was deleted without reserving its number", of.Number())
+			}
+			continue
+		}
+		switch {
+		case nf.Name() != of.Name():
+			add("FIELD_SAME_NAME", of, "field %d was renamed to %s", of.Number(), nf.Name())
+		case nf.JSONName() != of.JSONName():
+			add("FIELD_SAME_JSON_NAME", of, "JSON name changed from %s to %s", of.JSONName(), nf.JSONName())
+		case fieldType(nf) != fieldType(of):
+			add("FIELD_SAME_TYPE", of, "type changed from %s to %s", fieldType(of), fieldType(nf))
+		case nf.Cardinality() != of.Cardinality():
+			add("FIELD_SAME_CARDINALITY", of, "changed from %s to %s", of.Cardinality(), nf.Cardinality())
+		case oneofName(nf) != oneofName(of):
+			add("FIELD_SAME_ONEOF", of, "moved from oneof %q to %q", oneofName(of), oneofName(nf))
+		}
+	}
+}
+
+// fieldType names a field's type, with the message or enum it refers to
+func fieldType(f protoreflect.FieldDescriptor) string {
+	switch {
+	case f.IsMap():
+		return fmt.Sprintf("map<%s, %s>", fieldType(f.MapKey()), fieldType(f.MapValue()))
+	case f.Message() != nil:
+		return string(f.Message().FullName())
+	case f.Enum() != nil:
+		return string(f.Enum().FullName())
+	}
+	return f.Kind().String()
+}
+
+// oneofName returns the real oneof a field is in, or ""
+func oneofName(f protoreflect.FieldDescriptor) string {
+	if o := f.ContainingOneof(); o != nil && !o.IsSynthetic() {
+		return string(o.Name())
+	}
+	return ""
+}
+
+var (
+	pascalCase     = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	lowerSnakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	upperSnakeCase = regexp.MustCompile(`^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`)
+)
+
+// LintProtos checks the naming rules of buf's lint that the API follows: the
+// style guide's casing, and RPCs that take a <Rpc>Request and return a
+// <Rpc>Response of their own
+func LintProtos(set *descriptorpb.FileDescriptorSet) ([]ProtoProblem, error) {
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	var problems []ProtoProblem
+	add := func(rule string, d protoreflect.Descriptor, format string, args ...interface{}) {
+		problems = append(problems, ProtoProblem{Rule: rule, Element: string(d.FullName()), Message: fmt.Sprintf(format, args...)})
+	}
+	var lintMessages func(ms protoreflect.MessageDescriptors)
+	lintEnums := func(es protoreflect.EnumDescriptors) {
+		for i := 0; i < es.Len(); i++ {
+			e := es.Get(i)
+			if !pascalCase.MatchString(string(e.Name())) {
+				add("ENUM_PASCAL_CASE", e, "enum names should be PascalCase")
+			}
+			for j := 0; j < e.Values().Len(); j++ {
+				if v := e.Values().Get(j); !upperSnakeCase.MatchString(string(v.Name())) {
+					add("ENUM_VALUE_UPPER_SNAKE_CASE", v, "enum values should be UPPER_SNAKE_CASE")
+				}
+			}
+		}
+	}
+	lintMessages = func(ms protoreflect.MessageDescriptors) {
+		for i := 0; i < ms.Len(); i++ {
+			m := ms.Get(i)
+			if m.IsMapEntry() {
+				continue
+			}
+			if !pascalCase.MatchString(string(m.Name())) {
+				add("MESSAGE_PASCAL_CASE", m, "message names should be PascalCase")
+			}
+			for j := 0; j < m.Fields().Len(); j++ {
+				if f := m.Fields().Get(j); !lowerSnakeCase.MatchString(string(f.Name())) {
+					add("FIELD_LOWER_SNAKE_CASE", f, "field names should be lower_snake_case")
+				}
+			}
+			lintMessages(m.Messages())
+			lintEnums(m.Enums())
+		}
+	}
+
+	files.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		lintMessages(f.Messages())
+		lintEnums(f.Enums())
+		for i := 0; i < f.Services().Len(); i++ {
+			s := f.Services().Get(i)
+			if !pascalCase.MatchString(string(s.Name())) {
+				add("SERVICE_PASCAL_CASE", s, "service names should be PascalCase")
+			}
+			used := map[protoreflect.FullName]bool{}
+			for j := 0; j < s.Methods().Len(); j++ {
+				m := s.Methods().Get(j)
+				if !pascalCase.MatchString(string(m.Name())) {
+					add("RPC_PASCAL_CASE", m, "RPC names should be PascalCase")
+				}
+				if want := m.Name() + "Request"; m.Input().Name() != want {
+					add("RPC_REQUEST_STANDARD_NAME", m, "request should be %s, not %s", want, m.Input().Name())
+				}
+				if want := m.Name() + "Response"; m.Output().Name() != want {
+					add("RPC_RESPONSE_STANDARD_NAME", m, "response should be %s, not %s", want, m.Output().Name())
+				}
+				for _, t := range []protoreflect.FullName{m.Input().FullName(), m.Output().FullName()} {
+					if used[t] {
+						add("RPC_REQUEST_RESPONSE_UNIQUE", m, "%s is used by another RPC", t)
+					}
+					used[t] = true
+				}
+			}
+		}
+		return true
+	})
+	sortProblems(problems)
+	return problems, nil
+}
+
+// sortProblems orders problems by element, since files are visited in no order
+func sortProblems(problems []ProtoProblem) {
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Element != problems[j].Element {
+			return problems[i].Element < problems[j].Element
+		}
+		return problems[i].Rule < problems[j].Rule
+	})
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// TestProtoBaseline is the gate in CI: the API must lint clean and keep working for
+// clients built against the stored baseline
+func TestProtoBaseline(t *testing.T) {
+	baseline, err := ProtoBaseline()
+	if err != nil {
+		t.Fatalf("ProtoBaseline failed: %v", err)
+	}
+	lint, err := LintProtos(ProtoDescriptors())
+	if err != nil {
+		t.Fatalf("LintProtos failed: %v", err)
+	}
+	breaking, err := CheckProtoBreaking(baseline, ProtoDescriptors())
+	if err != nil {
+		t.Fatalf("CheckProtoBreaking failed: %v", err)
+	}
+	for _, p := range append(lint, breaking...) {
+		t.Errorf("%s", p)
+	}
+}
+
+func TestCheckProtoBreaking(t *testing.T) {
+	baseline := ProtoDescriptors()
+	current := proto.Clone(baseline).(*descriptorpb.FileDescriptorSet)
+	file := current.File[0]
+	find := func(name string) *descriptorpb.DescriptorProto {
+		for _, m := range file.MessageType {
+			if m.GetName() == name {
+				return m
+			}
+		}
+		t.Fatalf("no message %s", name)
+		return nil
+	}
+
+	player := find("Player")
+	var fields []*descriptorpb.FieldDescriptorProto
+	for _, f := range player.Field {
+		switch f.GetName() {
+		case "name":
+			continue // Deleted
+		case "handicap":
+			continue // Deleted, with its number reserved
+		case "rank":
+			f.Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+		case "provisional":
+			f.Name, f.JsonName = proto.String("is_provisional"), proto.String("isProvisional")
+		}
+		fields = append(fields, f)
+	}
+	player.Field = fields
+	player.ReservedRange = append(player.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(4), End: proto.Int32(5)})
+	file.EnumType[0].Value[1].Name = proto.String("CATEGORY_UNDER_18")
+	methods := file.Service[0].Method
+	file.Service[0].Method = methods[1:]
+	// An added message isn't a break
+	file.MessageType = append(file.MessageType, &descriptorpb.DescriptorProto{Name: proto.String("NewThing")})
+
+	problems, err := CheckProtoBreaking(baseline, current)
+	if err != nil {
+		t.Fatalf("CheckProtoBreaking failed: %v", err)
+	}
+	want := map[string]string{
+		"ENUM_VALUE_SAME_NAME":                   "ladder.CATEGORY_JUNIOR",
+		"FIELD_NO_DELETE_UNLESS_NUMBER_RESERVED": "ladder.Player.name",
+		"FIELD_SAME_TYPE":                        "ladder.Player.rank",
+		"FIELD_SAME_NAME":                        "ladder.Player.provisional",
+		"RPC_NO_DELETE":                          "ladder.LadderService." + methods[0].GetName(),
+	}
+	if len(problems) != len(want) {
+		t.Errorf("expected %d problems, got %v", len(want), problems)
+	}
+	for _, p := range problems {
+		if want[p.Rule] != p.Element {
+			t.Errorf("unexpected problem %s", p)
+		}
+	}
+}
+
+func TestLintProtos(t *testing.T) {
+	set := ProtoDescriptors()
+	file := set.File[0]
+	file.MessageType[1].Field[0].Name = proto.String("playerId")
+	file.Service[0].Method[0].OutputType = file.Service[0].Method[0].InputType
+
+	problems, err := LintProtos(set)
+	if err != nil {
+		t.Fatalf("LintProtos failed: %v", err)
+	}
+	rules := map[string]bool{}
+	for _, p := range problems {
+		rules[p.Rule] = true
+	}
+	for _, rule := range []string{"FIELD_LOWER_SNAKE_CASE", "RPC_RESPONSE_STANDARD_NAME", "RPC_REQUEST_RESPONSE_UNIQUE"} {
+		if !rules[rule] {
+			t.Errorf("expected a %s problem, got %v", rule, problems)
+		}
+	}
+}
+
+func TestFetchProtoDescriptors(t *testing.T) {
+	addrs := make(chan net.Addr, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Run(Config{
+		Stop:           stop,
+		DataPath:       filepath.Join(t.TempDir(), "ladder.log"),
+		HTTPAddr:       "127.0.0.1:0",
+		GRPCAddr:       "127.0.0.1:0",
+		GRPCReflection: true,
+		OnListening:    func(httpAddr, grpcAddr net.Addr) { addrs <- grpcAddr },
+	})
+	var addr net.Addr
+	select {
+	case addr = <-addrs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not start listening")
+	}
+
+	conn, err := grpc.NewClient(addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	set, err := FetchProtoDescriptors(ctx, conn)
+	if err != nil {
+		t.Fatalf("FetchProtoDescriptors failed: %v", err)
+	}
+	if len(set.File) != 1 || set.File[0].GetName() != "ladder.proto" {
+		t.Fatalf("expected ladder.proto, got %d files", len(set.File))
+	}
+	if problems, err := CheckProtoBreaking(ProtoDescriptors(), set); err != nil || len(problems) > 0 {
+		t.Errorf("expected the served API to match this binary's, got %v, %v", problems, err)
+	}
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	publicAPIPath    = "/api/public/"
+	apiVersionHeader = "X-API-Version"
+
+	// defaultPublicAPIVersion is served to clients that do not ask for a version. It
+	// stays at 1 so that apps written before versioning keep working.
+	defaultPublicAPIVersion = 1
+
+	publicMatchesDefault = 20
+	publicMatchesMax     = 100
+)
+
+// publicAPIVersions are the versions of the public JSON API this server speaks. The
+// schema of a version never changes incompatibly: fields may be added, but not
+// renamed, retyped or removed. Such changes get a new version, and the old one is
+// kept until club apps have moved on.
+var publicAPIVersions = []int{1}
+
+// The v1 schema. These types are the contract with third-party apps, so they are
+// deliberately separate from the protos, which change with the server.
+
+type publicPlayerV1 struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Rank        int32  `json:"rank"`
+	Category    string `json:"category,omitempty"` // "junior", "senior" or "veteran"
+	Provisional bool   `json:"provisional,omitempty"`
+}
+
+type publicPlayerRefV1 struct {
+	ID   string `json:"id"`
+	Name string `json:"name"` // Empty for players who have left the ladder
+}
+
+type publicSetV1 struct {
+	Challenger int32 `json:"challenger"`
+	Defender   int32 `json:"defender"`
+	Forfeit    bool  `json:"forfeit,omitempty"` // Conceded by the player with fewer points
+}
+
+type publicMatchV1 struct {
+	ID         string            `json:"id"`
+	PlayedAt   time.Time         `json:"played_at"`
+	RecordedAt time.Time         `json:"recorded_at"`
+	Challenger publicPlayerRefV1 `json:"challenger"`
+	Defender   publicPlayerRefV1 `json:"defender"`
+	WinnerID   string            `json:"winner_id"`
+	Sets       []publicSetV1     `json:"sets"`
+}
+
+type publicStandingV1 struct {
+	Rank     int32  `json:"rank"`
+	PlayerID string `json:"player_id"`
+	Name     string `json:"name"`
+	Played   int32  `json:"played"`
+	Won      int32  `json:"won"`
+	Lost     int32  `json:"lost"`
+}
+
+// legacyPlayer is a player as GET /api/players lists them, which predates the
+// public API and stays as it is
+type legacyPlayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Rank int32  `json:"rank"`
+}
+
+// PublicAPI serves the ladder as versioned JSON for third-party club apps at
+// /api/public. Clients choose a version with the X-API-Version header; responses
+// carry the version they were written in.
+type PublicAPI struct {
+	service *LadderService
+	now     func() time.Time
+}
+
+// NewPublicAPI creates the public API handler
+func NewPublicAPI(service *LadderService) *PublicAPI {
+	return &PublicAPI{service: service, now: time.Now}
+}
+
+// negotiateAPIVersion returns the version a request asks for, and false when this
+// server does not speak it
+func negotiateAPIVersion(r *http.Request) (int, bool) {
+	v := strings.TrimSpace(r.Header.Get(apiVersionHeader))
+	if v == "" {
+		return defaultPublicAPIVersion, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+	for _, supported := range publicAPIVersions {
+		if n == supported {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+func supportedAPIVersions() string {
+	versions := make([]string, len(publicAPIVersions))
+	for i, v := range publicAPIVersions {
+		versions[i] = strconv.Itoa(v)
+	}
+	return strings.Join(versions, ",")
+}
+
+// ServeHTTP routes public API requests by path
+func (a *PublicAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", apiVersionHeader)
+	version, ok := negotiateAPIVersion(r)
+	if !ok {
+		writeRESTError(w, codes.InvalidArgument, "unsupported API version", map[string]string{
+			"requested": r.Header.Get(apiVersionHeader),
+			"supported": supportedAPIVersions(),
+		})
+		return
+	}
+	w.Header().Set(apiVersionHeader, strconv.Itoa(version))
+
+	var body interface{}
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, publicAPIPath) {
+	case "players":
+		body, err = a.playersV1(r)
+	case "standings":
+		body, err = a.standingsV1(r)
+	case "matches":
+		body, err = a.matchesV1(r)
+	default:
+		writeRESTError(w, codes.NotFound, "no such endpoint", map[string]string{"method": r.Method, "path": r.URL.Path})
+		return
+	}
+	if err != nil {
+		writeRESTErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// playersV1 lists the players in ladder order
+func (a *PublicAPI) playersV1(r *http.Request) (interface{}, error) {
+	resp, err := a.service.ListPlayers(r.Context(), &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	players := make([]publicPlayerV1, len(resp.Players))
+	for i, p := range resp.Players {
+		players[i] = publicPlayerV1{ID: p.Id, Name: p.Name, Rank: p.Rank, Category: publicCategory(p.Category), Provisional: p.Provisional}
+	}
+	return map[string]interface{}{"players": players}, nil
+}
+
+// standingsV1 lists the players in ladder order with their record over all matches
+func (a *PublicAPI) standingsV1(r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	resp, err := a.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	table, _, err := a.service.modelFor(ctx).GetLeagueTable(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]*ladderpb.LeagueStanding, len(table))
+	for _, s := range table {
+		records[s.PlayerId] = s
+	}
+	standings := make([]publicStandingV1, len(resp.Players))
+	for i, p := range resp.Players {
+		standings[i] = publicStandingV1{Rank: p.Rank, PlayerID: p.Id, Name: p.Name}
+		if s := records[p.Id]; s != nil {
+			standings[i].Played, standings[i].Won, standings[i].Lost = s.Played, s.Won, s.Lost
+		}
+	}
+	return map[string]interface{}{"as_of": a.now().UTC().Truncate(time.Second), "standings": standings}, nil
+}
+
+// matchesV1 lists recent matches, newest first; ?limit= takes up to 100
+func (a *PublicAPI) matchesV1(r *http.Request) (interface{}, error) {
+	limit := publicMatchesDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid limit %q", v)
+		}
+		limit = min(n, publicMatchesMax)
+	}
+	ctx := r.Context()
+	players, err := a.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(players.Players))
+	for _, p := range players.Players {
+		names[p.Id] = p.Name
+	}
+	resp, err := a.service.ListRecentMatches(ctx, &ladderpb.ListRecentMatchesRequest{Limit: int32(limit)})
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]publicMatchV1, len(resp.Results))
+	for i, mr := range resp.Results {
+		sets := make([]publicSetV1, len(mr.SetScores))
+		for j, s := range mr.SetScores {
+			sets[j] = publicSetV1{Challenger: s.ChallengerPoints, Defender: s.DefenderPoints, Forfeit: s.ChallengerDefault || s.DefenderDefault}
+		}
+		matches[i] = publicMatchV1{
+			ID:         mr.TransactionId,
+			PlayedAt:   time.UnixMilli(mr.PlayedAtMs).UTC(),
+			RecordedAt: time.UnixMilli(mr.TimestampMs).UTC(),
+			Challenger: publicPlayerRefV1{ID: mr.ChallengerId, Name: names[mr.ChallengerId]},
+			Defender:   publicPlayerRefV1{ID: mr.DefenderId, Name: names[mr.DefenderId]},
+			WinnerID:   mr.WinnerId,
+			Sets:       sets,
+		}
+	}
+	return map[string]interface{}{"matches": matches}, nil
+}
+
+func publicCategory(c ladderpb.PlayerCategory) string {
+	switch c {
+	case ladderpb.PlayerCategory_CATEGORY_JUNIOR:
+		return "junior"
+	case ladderpb.PlayerCategory_CATEGORY_SENIOR:
+		return "senior"
+	case ladderpb.PlayerCategory_CATEGORY_VETERAN:
+		return "veteran"
+	}
+	return ""
+}
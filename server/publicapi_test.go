@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestPublicAPI_V1(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayerInCategory("Bob", "bob", ladderpb.PlayerCategory_CATEGORY_JUNIOR)
+	m.AddPlayer("Carol", "carol")
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 11, DefenderPoints: 7}, {ChallengerPoints: 11, DefenderPoints: 3}})
+	api := NewPublicAPI(NewLadderService(m))
+	api.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	get := func(target, version string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		if version != "" {
+			r.Header.Set(apiVersionHeader, version)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// The body is compared as text: these are the field names and formats club apps
+	// rely on
+	rec := get("/api/public/players", "")
+	if rec.Code != http.StatusOK || rec.Header().Get(apiVersionHeader) != "1" {
+		t.Fatalf("expected version 1 by default, got %d %q", rec.Code, rec.Header().Get(apiVersionHeader))
+	}
+	want := `{"players":[{"id":"bob","name":"Bob","rank":1,"category":"junior"},{"id":"alice","name":"Alice","rank":2},{"id":"carol","name":"Carol","rank":3}]}` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("players:\nexpected %s\ngot      %s", want, rec.Body.String())
+	}
+
+	rec = get("/api/public/standings", "1")
+	want = `{"as_of":"2026-03-01T12:00:00Z","standings":[{"rank":1,"player_id":"bob","name":"Bob","played":1,"won":1,"lost":0},` +
+		`{"rank":2,"player_id":"alice","name":"Alice","played":1,"won":0,"lost":1},{"rank":3,"player_id":"carol","name":"Carol","played":0,"won":0,"lost":0}]}` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("standings:\nexpected %s\ngot      %s", want, rec.Body.String())
+	}
+
+	rec = get("/api/public/matches?limit=5", "1")
+	var matches struct {
+		Matches []map[string]json.RawMessage `json:"matches"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &matches); err != nil || len(matches.Matches) != 1 {
+		t.Fatalf("expected one match, got %s", rec.Body.String())
+	}
+	match := matches.Matches[0]
+	for field, want := range map[string]string{
+		"challenger": `{"id":"bob","name":"Bob"}`,
+		"defender":   `{"id":"alice","name":"Alice"}`,
+		"winner_id":  `"bob"`,
+		"sets":       `[{"challenger":11,"defender":5},{"challenger":11,"defender":7},{"challenger":11,"defender":3}]`,
+	} {
+		if string(match[field]) != want {
+			t.Errorf("match %s: expected %s, got %s", field, want, match[field])
+		}
+	}
+	for _, field := range []string{"id", "played_at", "recorded_at"} {
+		if len(match[field]) == 0 {
+			t.Errorf("match has no %s", field)
+		}
+	}
+
+	if rec := get("/api/public/matches?limit=none", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad limit, got %d", rec.Code)
+	}
+	if rec := get("/api/public/fixtures", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown endpoint, got %d", rec.Code)
+	}
+
+	// Versions the server does not speak are refused, naming those it does
+	rec = get("/api/public/players", "2")
+	var apiErr restError
+	json.Unmarshal(rec.Body.Bytes(), &apiErr)
+	if rec.Code != http.StatusBadRequest || apiErr.Details["supported"] != "1" {
+		t.Errorf("expected 400 listing version 1, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Public mode lets the ladder be linked from a club's public website without
+// publishing members' full names: anonymous readers see "Alice J." while requests
+// carrying the member or admin token as a bearer token see everything.
+
+type publicViewKey struct{}
+
+// withPublicView marks ctx as an anonymous read whose names must be masked
+func withPublicView(ctx context.Context) context.Context {
+	return context.WithValue(ctx, publicViewKey{}, true)
+}
+
+// isPublicView reports whether names must be masked for this request
+func isPublicView(ctx context.Context) bool {
+	v, _ := ctx.Value(publicViewKey{}).(bool)
+	return v
+}
+
+// publicAccess decides which requests are anonymous in public mode
+type publicAccess struct {
+	enabled bool
+	tokens  []string // Member and admin tokens; any one unmasks names
+	keys    *APIKeys // API keys of either role unmask names too; may be nil
+}
+
+func newPublicAccess(enabled bool, tokens ...string) *publicAccess {
+	a := &publicAccess{enabled: enabled}
+	for _, t := range tokens {
+		if t != "" {
+			a.tokens = append(a.tokens, t)
+		}
+	}
+	return a
+}
+
+// httpContext returns the request's context, marked as public if it is anonymous
+func (a *publicAccess) httpContext(r *http.Request) context.Context {
+	if !a.enabled {
+		return r.Context()
+	}
+	for _, t := range a.tokens {
+		if hasBearerHeader(r, t) {
+			return r.Context()
+		}
+	}
+	if a.keys.Role(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) != ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED {
+		return r.Context()
+	}
+	return withPublicView(r.Context())
+}
+
+// unaryInterceptor masks the names in responses to anonymous RPCs
+func (a *publicAccess) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !a.enabled {
+			return handler(ctx, req)
+		}
+		for _, t := range a.tokens {
+			if hasBearerToken(ctx, t) {
+				return handler(ctx, req)
+			}
+		}
+		if a.keys.roleOf(ctx) != ladderpb.ApiKeyRole_API_KEY_ROLE_UNSPECIFIED {
+			return handler(ctx, req)
+		}
+		resp, err := handler(withPublicView(ctx), req)
+		if msg, ok := resp.(proto.Message); ok && err == nil {
+			maskNames(msg)
+		}
+		return resp, err
+	}
+}
+
+// maskName shortens every word after the first to its initial, so "Alice Johnson"
+// becomes "Alice J." and "Mary Ann Smith" becomes "Mary A. S.". Already masked names
+// are unchanged.
+func maskName(name string) string {
+	words := strings.Fields(name)
+	for i := 1; i < len(words); i++ {
+		r, _ := utf8.DecodeRuneInString(words[i])
+		words[i] = string(r) + "."
+	}
+	return strings.Join(words, " ")
+}
+
+// maskedNames returns a copy of an ID to name map with every name masked
+func maskedNames(names map[string]string) map[string]string {
+	masked := make(map[string]string, len(names))
+	for id, name := range names {
+		masked[id] = maskName(name)
+	}
+	return masked
+}
+
+// maskNames masks, in place, the names of players anywhere in msg. Club names and
+// other "name" fields are left alone.
+func maskNames(msg proto.Message) {
+	maskMessage(msg.ProtoReflect())
+}
+
+// playerNameMessages are the messages whose name field is a person's name
+var playerNameMessages = map[protoreflect.FullName]bool{
+	"ladder.Player":           true,
+	"ladder.PlayerMovement":   true,
+	"ladder.LeagueStanding":   true,
+	"ladder.LookingForGame":   true,
+	"ladder.AttendanceStats":  true,
+	"ladder.WaitingListEntry": true,
+}
+
+func maskMessage(m protoreflect.Message) {
+	if playerNameMessages[m.Descriptor().FullName()] {
+		if fd := m.Descriptor().Fields().ByName("name"); fd != nil && fd.Kind() == protoreflect.StringKind {
+			m.Set(fd, protoreflect.ValueOfString(maskName(m.Get(fd).String())))
+		}
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind && fd.Kind() != protoreflect.GroupKind {
+			return true
+		}
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				maskMessage(list.Get(i).Message())
+			}
+		case fd.IsMap():
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				if fd.MapValue().Kind() == protoreflect.MessageKind {
+					maskMessage(mv.Message())
+				}
+				return true
+			})
+		default:
+			maskMessage(v.Message())
+		}
+		return true
+	})
+}
+
+// maskPlayers returns copies of players with masked names
+func maskPlayers(players []*ladderpb.Player) []*ladderpb.Player {
+	masked := make([]*ladderpb.Player, len(players))
+	for i, p := range players {
+		masked[i] = proto.Clone(p).(*ladderpb.Player)
+		masked[i].Name = maskName(p.Name)
+	}
+	return masked
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMaskName(t *testing.T) {
+	tests := map[string]string{
+		"Alice Johnson":  "Alice J.",
+		"Mary Ann Smith": "Mary A. S.",
+		"Cher":           "Cher",
+		"Alice J.":       "Alice J.",
+		"Zoë Łukasz":     "Zoë Ł.",
+	}
+	for in, want := range tests {
+		if got := maskName(in); got != want {
+			t.Errorf("maskName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPublicAccess(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice Johnson", "alice")
+	svc := NewLadderService(m)
+
+	access := newPublicAccess(true, "member-secret", "")
+	interceptor := access.unaryInterceptor()
+	list := func(ctx context.Context) string {
+		resp, err := interceptor(ctx, &ladderpb.ListPlayersRequest{}, &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/ListPlayers"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return svc.ListPlayers(ctx, req.(*ladderpb.ListPlayersRequest))
+			})
+		if err != nil {
+			t.Fatalf("ListPlayers failed: %v", err)
+		}
+		return resp.(*ladderpb.ListPlayersResponse).Players[0].Name
+	}
+
+	if got := list(context.Background()); got != "Alice J." {
+		t.Errorf("expected a masked name for anonymous callers, got %q", got)
+	}
+	member := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer member-secret"))
+	if got := list(member); got != "Alice Johnson" {
+		t.Errorf("expected the full name for members, got %q", got)
+	}
+
+	// Responses built from other messages are masked too
+	diff := &ladderpb.DiffLadderResponse{Moved: []*ladderpb.PlayerMovement{{Name: "Bob Smith"}}, Joined: []*ladderpb.Player{{Name: "Carol White"}}}
+	maskNames(diff)
+	if diff.Moved[0].Name != "Bob S." || diff.Joined[0].Name != "Carol W." {
+		t.Errorf("unexpected masked diff: %v", diff)
+	}
+
+	// Plain HTTP requests
+	r := httptest.NewRequest("GET", "/api/players", nil)
+	if !isPublicView(access.httpContext(r)) {
+		t.Error("expected an anonymous HTTP request to be a public view")
+	}
+	r.Header.Set("Authorization", "Bearer member-secret")
+	if isPublicView(access.httpContext(r)) {
+		t.Error("expected a member's HTTP request to see full names")
+	}
+	if isPublicView(newPublicAccess(false, "").httpContext(httptest.NewRequest("GET", "/", nil))) {
+		t.Error("expected no masking when public mode is off")
+	}
+
+	// Live events
+	ev := liveEvent{
+		Players: []livePlayer{{ID: "alice", Name: "Alice Johnson", Rank: 1}},
+		Match: &liveMatch{
+			Summary: "Alice Johnson beat Bob Smith",
+			result:  &ladderpb.MatchResult{ChallengerId: "alice", DefenderId: "bob", WinnerId: "alice", SetScores: []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 3}}},
+			names:   map[string]string{"alice": "Alice Johnson", "bob": "Bob Smith"},
+		},
+	}
+	pub := ev.public()
+	if pub.Players[0].Name != "Alice J." || ev.Players[0].Name != "Alice Johnson" {
+		t.Errorf("expected a masked copy, got %v and %v", pub.Players, ev.Players)
+	}
+	if want := describeMatch(ev.Match.result, map[string]string{"alice": "Alice J.", "bob": "Bob S."}); pub.Match.Summary != want {
+		t.Errorf("expected summary %q, got %q", want, pub.Match.Summary)
+	}
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	pushesSent    = expvar.NewInt("pushes_sent")
+	pushFailures  = expvar.NewInt("push_failures")
+	pushesExpired = expvar.NewInt("pushes_expired")
+)
+
+// pushMessage is the notification shown to a player. Web Push delivers it as JSON for
+// the client's service worker to display.
+type pushMessage struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Event string `json:"event"` // NotificationEvent name
+	Tag   string `json:"tag"`   // A newer notification with the same tag replaces the older
+}
+
+// pushSubscription is a stored browser or device subscription
+type pushSubscription struct {
+	ID        string `json:"id"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	P256dh    string `json:"p256dh,omitempty"`
+	Auth      string `json:"auth,omitempty"`
+	FCMToken  string `json:"fcm_token,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	CreatedMs int64  `json:"created_ms"`
+}
+
+func (s pushSubscription) toProto() *ladderpb.PushSubscription {
+	return &ladderpb.PushSubscription{
+		Id:        s.ID,
+		Endpoint:  s.Endpoint,
+		P256Dh:    s.P256dh,
+		Auth:      s.Auth,
+		FcmToken:  s.FCMToken,
+		UserAgent: s.UserAgent,
+		CreatedMs: s.CreatedMs,
+	}
+}
+
+// sameTarget reports whether two subscriptions deliver to the same browser or device
+func (s pushSubscription) sameTarget(o pushSubscription) bool {
+	return (s.Endpoint != "" && s.Endpoint == o.Endpoint) || (s.FCMToken != "" && s.FCMToken == o.FCMToken)
+}
+
+// Register stores a push subscription for a player and returns its ID. A browser or
+// device belongs to one player at a time, so registering it again moves it.
+func (s *NotificationStore) Register(clubID, playerID string, sub pushSubscription) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := notificationKey(clubID, playerID)
+	for k, p := range s.players {
+		for i, existing := range p.Subscriptions {
+			if !existing.sameTarget(sub) {
+				continue
+			}
+			if k == key {
+				return existing.ID, nil
+			}
+			p.Subscriptions = append(p.Subscriptions[:i], p.Subscriptions[i+1:]...)
+			break
+		}
+	}
+
+	sub.ID = uuid.New().String()
+	sub.CreatedMs = time.Now().UnixMilli()
+	p := s.playerLocked(key)
+	p.Subscriptions = append(p.Subscriptions, sub)
+	return sub.ID, s.saveLocked()
+}
+
+// Unregister removes one of a player's subscriptions, reporting whether it existed
+func (s *NotificationStore) Unregister(clubID, playerID, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.removeLocked(notificationKey(clubID, playerID), id) {
+		return false, nil
+	}
+	return true, s.saveLocked()
+}
+
+// Subscriptions returns a player's push subscriptions, oldest first
+func (s *NotificationStore) Subscriptions(clubID, playerID string) []pushSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[notificationKey(clubID, playerID)]
+	if !ok {
+		return nil
+	}
+	return append([]pushSubscription{}, p.Subscriptions...)
+}
+
+// PushedEvents lists the events a player wants pushed
+func (s *NotificationStore) PushedEvents(clubID, playerID string) []ladderpb.NotificationEvent {
+	events := []ladderpb.NotificationEvent{}
+	for _, e := range notificationEvents() {
+		if s.wants(clubID, playerID, e, ladderpb.NotificationChannel_CHANNEL_PUSH) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// SetPushedEvents chooses the events a player wants pushed, leaving their other
+// channels alone
+func (s *NotificationStore) SetPushedEvents(clubID, playerID string, events []ladderpb.NotificationEvent) error {
+	pushed := make(map[ladderpb.NotificationEvent]bool)
+	for _, e := range events {
+		pushed[e] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := notificationKey(clubID, playerID)
+	for _, e := range notificationEvents() {
+		var channels []ladderpb.NotificationChannel
+		for _, c := range s.channelsLocked(key, e) {
+			if c != ladderpb.NotificationChannel_CHANNEL_PUSH {
+				channels = append(channels, c)
+			}
+		}
+		if pushed[e] {
+			channels = append(channels, ladderpb.NotificationChannel_CHANNEL_PUSH)
+		}
+		s.setChannelsLocked(key, e, channels)
+	}
+	return s.saveLocked()
+}
+
+// expire drops a subscription the push service no longer accepts
+func (s *NotificationStore) expire(clubID, playerID, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removeLocked(notificationKey(clubID, playerID), id) {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("push: failed to save subscriptions: %v", err)
+		}
+	}
+}
+
+func (s *NotificationStore) removeLocked(key, id string) bool {
+	p, ok := s.players[key]
+	if !ok {
+		return false
+	}
+	for i, sub := range p.Subscriptions {
+		if sub.ID == id {
+			p.Subscriptions = append(p.Subscriptions[:i], p.Subscriptions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// push sends msg to every push subscription of a player
+func (n *Notifier) push(ctx context.Context, clubID, playerID string, event ladderpb.NotificationEvent, msg notification) {
+	pm := pushMessage{Title: msg.Title, Body: msg.Body, Event: event.String(), Tag: msg.Tag}
+	payload, err := json.Marshal(pm)
+	if err != nil {
+		return
+	}
+	for _, sub := range n.store.Subscriptions(clubID, playerID) {
+		var err error
+		switch {
+		case sub.FCMToken != "" && n.fcm != nil:
+			err = n.fcm.send(ctx, sub.FCMToken, pm)
+		case sub.Endpoint != "" && n.webPush != nil:
+			err = n.webPush.send(ctx, sub, payload)
+		default:
+			continue
+		}
+		switch {
+		case err == errPushGone:
+			pushesExpired.Add(1)
+			n.store.expire(clubID, playerID, sub.ID)
+		case err != nil:
+			pushFailures.Add(1)
+			log.Printf("push: failed to notify %s: %v", playerID, err)
+		default:
+			pushesSent.Add(1)
+		}
+	}
+}
+
+// validateSubscription checks that sub is a complete subscription of a kind the
+// server can deliver to
+func (n *Notifier) validateSubscription(sub *ladderpb.PushSubscription) error {
+	switch {
+	case sub == nil:
+		return fmt.Errorf("subscription is required")
+	case sub.FcmToken != "" && sub.Endpoint != "":
+		return fmt.Errorf("set either endpoint or fcm_token, not both")
+	case sub.FcmToken != "":
+		if n.fcm == nil {
+			return fmt.Errorf("FCM is not enabled on this server")
+		}
+	case sub.Endpoint != "":
+		if n.webPush == nil {
+			return fmt.Errorf("Web Push is not enabled on this server")
+		}
+		if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("endpoint must be an https URL")
+		}
+		if key, err := decodeBase64URL(sub.P256Dh); err != nil || len(key) != 65 {
+			return fmt.Errorf("p256dh must be an uncompressed P-256 public key")
+		}
+		if auth, err := decodeBase64URL(sub.Auth); err != nil || len(auth) != 16 {
+			return fmt.Errorf("auth must be a 16 byte secret")
+		}
+	default:
+		return fmt.Errorf("endpoint or fcm_token is required")
+	}
+	return nil
+}
+
+// pushPlayer returns the calling player and their club, or an error if push
+// notifications are off or the caller has no player token
+func (h *LadderService) pushPlayer(ctx context.Context) (string, string, error) {
+	if h.notifier == nil || (h.notifier.webPush == nil && h.notifier.fcm == nil) {
+		return "", "", status.Error(codes.FailedPrecondition, "push notifications are not enabled on this server")
+	}
+	return h.notificationPlayer(ctx)
+}
+
+// RegisterPushSubscription subscribes the calling player's browser or device
+func (h *LadderService) RegisterPushSubscription(ctx context.Context, req *ladderpb.RegisterPushSubscriptionRequest) (*ladderpb.RegisterPushSubscriptionResponse, error) {
+	clubID, playerID, err := h.pushPlayer(ctx)
+	if err != nil {
+		return &ladderpb.RegisterPushSubscriptionResponse{Success: false}, err
+	}
+	if err := h.notifier.validateSubscription(req.Subscription); err != nil {
+		return &ladderpb.RegisterPushSubscriptionResponse{Success: false}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	sub := req.Subscription
+	id, err := h.notifier.store.Register(clubID, playerID, pushSubscription{
+		Endpoint:  sub.Endpoint,
+		P256dh:    sub.P256Dh,
+		Auth:      sub.Auth,
+		FCMToken:  sub.FcmToken,
+		UserAgent: sub.UserAgent,
+	})
+	if err != nil {
+		return &ladderpb.RegisterPushSubscriptionResponse{Success: false}, fmt.Errorf("failed to save subscription: %v", err)
+	}
+	return &ladderpb.RegisterPushSubscriptionResponse{Success: true, SubscriptionId: id}, nil
+}
+
+// UnregisterPushSubscription removes one of the calling player's subscriptions
+func (h *LadderService) UnregisterPushSubscription(ctx context.Context, req *ladderpb.UnregisterPushSubscriptionRequest) (*ladderpb.UnregisterPushSubscriptionResponse, error) {
+	clubID, playerID, err := h.pushPlayer(ctx)
+	if err != nil {
+		return &ladderpb.UnregisterPushSubscriptionResponse{Success: false}, err
+	}
+	found, err := h.notifier.store.Unregister(clubID, playerID, req.SubscriptionId)
+	if err != nil {
+		return &ladderpb.UnregisterPushSubscriptionResponse{Success: false}, fmt.Errorf("failed to save subscriptions: %v", err)
+	}
+	if !found {
+		return &ladderpb.UnregisterPushSubscriptionResponse{Success: false}, status.Error(codes.NotFound, "subscription not found")
+	}
+	return &ladderpb.UnregisterPushSubscriptionResponse{Success: true}, nil
+}
+
+// GetPushPreferences returns the calling player's subscriptions and pushed events
+func (h *LadderService) GetPushPreferences(ctx context.Context, req *ladderpb.GetPushPreferencesRequest) (*ladderpb.GetPushPreferencesResponse, error) {
+	clubID, playerID, err := h.pushPlayer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &ladderpb.GetPushPreferencesResponse{
+		EnabledEvents: h.notifier.store.PushedEvents(clubID, playerID),
+		Subscriptions: []*ladderpb.PushSubscription{},
+	}
+	for _, sub := range h.notifier.store.Subscriptions(clubID, playerID) {
+		resp.Subscriptions = append(resp.Subscriptions, sub.toProto())
+	}
+	if h.notifier.webPush != nil {
+		resp.VapidPublicKey = h.notifier.webPush.public
+	}
+	return resp, nil
+}
+
+// UpdatePushPreferences chooses which events are pushed to the calling player
+func (h *LadderService) UpdatePushPreferences(ctx context.Context, req *ladderpb.UpdatePushPreferencesRequest) (*ladderpb.UpdatePushPreferencesResponse, error) {
+	clubID, playerID, err := h.pushPlayer(ctx)
+	if err != nil {
+		return &ladderpb.UpdatePushPreferencesResponse{Success: false}, err
+	}
+	if err := checkNotificationEvents(req.EnabledEvents); err != nil {
+		return &ladderpb.UpdatePushPreferencesResponse{Success: false}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := h.notifier.store.SetPushedEvents(clubID, playerID, req.EnabledEvents); err != nil {
+		return &ladderpb.UpdatePushPreferencesResponse{Success: false}, fmt.Errorf("failed to save preferences: %v", err)
+	}
+	return &ladderpb.UpdatePushPreferencesResponse{Success: true}, nil
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testBrowser is the receiving side of a Web Push subscription
+type testBrowser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newTestBrowser(t *testing.T) *testBrowser {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &testBrowser{key: key, auth: auth}
+}
+
+func (b *testBrowser) subscription(endpoint string) pushSubscription {
+	enc := base64.RawURLEncoding
+	return pushSubscription{Endpoint: endpoint, P256dh: enc.EncodeToString(b.key.PublicKey().Bytes()), Auth: enc.EncodeToString(b.auth)}
+}
+
+// decrypt reverses encryptWebPush as a browser would
+func (b *testBrowser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	salt, rs, idLen := body[:16], binary.BigEndian.Uint32(body[16:20]), int(body[20])
+	if rs != webPushRecordSize || idLen != 65 {
+		t.Fatalf("unexpected header rs=%d idlen=%d", rs, idLen)
+	}
+	asPublic := body[21 : 21+idLen]
+	peer, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := b.key.ECDH(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, nonce := webPushKeys(secret, b.auth, b.key.PublicKey().Bytes(), asPublic, salt)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plain, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt push: %v", err)
+	}
+	if plain[len(plain)-1] != 0x02 {
+		t.Fatalf("missing last record delimiter")
+	}
+	return plain[:len(plain)-1]
+}
+
+func TestEncryptWebPush(t *testing.T) {
+	browser := newTestBrowser(t)
+	sub := browser.subscription("")
+
+	body, err := encryptWebPush(sub.P256dh, sub.Auth, []byte("hello"))
+	if err != nil {
+		t.Fatalf("encryptWebPush failed: %v", err)
+	}
+	if got := browser.decrypt(t, body); string(got) != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+
+	if _, err := encryptWebPush(sub.P256dh, sub.Auth, make([]byte, webPushMaxPayload+1)); err == nil {
+		t.Error("expected an error for an oversized payload")
+	}
+	if _, err := encryptWebPush("not-a-key", sub.Auth, []byte("x")); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
+
+func TestPushNotifier(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	private, public, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := newTestBrowser(t), newTestBrowser(t)
+
+	var mu sync.Mutex
+	received := map[string][]pushMessage{}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validVAPID(t, r, public) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		browser := map[string]*testBrowser{"/alice": alice, "/bob": bob}[r.URL.Path]
+		body, _ := io.ReadAll(r.Body)
+		var msg pushMessage
+		json.Unmarshal(browser.decrypt(t, body), &msg)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], msg)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer service.Close()
+
+	store, err := NewNotificationStore(filepath.Join(t.TempDir(), notificationStoreFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Register("", "alice", alice.subscription(service.URL+"/alice"))
+	store.Register("", "bob", bob.subscription(service.URL+"/bob"))
+	store.Register("", "bob", newTestBrowser(t).subscription(service.URL+"/gone"))
+	store.SetPushedEvents("", "alice", []ladderpb.NotificationEvent{ladderpb.NotificationEvent_NOTIFY_RESULT_CONFIRMED})
+
+	notifier := NewNotifier(store)
+	if err := notifier.EnableWebPush(private, "mailto:admin@example.org"); err != nil {
+		t.Fatalf("EnableWebPush failed: %v", err)
+	}
+	notifier.Attach("", m)
+
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(received["/alice"]) == 1 && len(received["/bob"]) == 2
+		mu.Unlock()
+		if done && len(store.Subscriptions("", "bob")) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out; received %v, bob has %d subscriptions", received, len(store.Subscriptions("", "bob")))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// alice turned rank changes off, so only hears about the result
+	if msg := received["/alice"][0]; msg.Event != "NOTIFY_RESULT_CONFIRMED" || !strings.Contains(msg.Body, "Bob beat Alice") {
+		t.Errorf("unexpected push to alice: %+v", msg)
+	}
+	var rank *pushMessage
+	for i, msg := range received["/bob"] {
+		if msg.Event == "NOTIFY_RANK_CHANGED" {
+			rank = &received["/bob"][i]
+		}
+	}
+	if rank == nil || rank.Body != "You moved up to #1 (from #2)" {
+		t.Errorf("expected a rank change push to bob, got %+v", received["/bob"])
+	}
+
+	// The store survives a restart
+	reopened, err := NewNotificationStore(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.Subscriptions("", "bob")) != 1 || reopened.wants("", "alice", ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED, ladderpb.NotificationChannel_CHANNEL_PUSH) {
+		t.Error("push store was not persisted")
+	}
+}
+
+// validVAPID checks the request's VAPID JWT against the server's public key
+func validVAPID(t *testing.T, r *http.Request, public string) bool {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "vapid ")
+	var token, key string
+	for _, part := range strings.Split(auth, ", ") {
+		if v, ok := strings.CutPrefix(part, "t="); ok {
+			token = v
+		}
+		if v, ok := strings.CutPrefix(part, "k="); ok {
+			key = v
+		}
+	}
+	if key != public || r.Header.Get("Content-Encoding") != "aes128gcm" {
+		return false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	var claims map[string]interface{}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(payload, &claims)
+	if claims["aud"] != "http://"+r.Host || claims["sub"] != "mailto:admin@example.org" {
+		return false
+	}
+
+	pub, _ := base64.RawURLEncoding.DecodeString(public)
+	parsed, err := ecdh.P256().NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := parsed.Bytes()
+	verifier := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(raw[1:33]), Y: new(big.Int).SetBytes(raw[33:])}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return len(sig) == 64 && ecdsa.Verify(verifier, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+}
+
+func TestPushSubscriptionRPCs(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	m.AddPlayer("Alice", "alice")
+
+	svc := NewLadderService(m)
+	ctx := context.WithValue(context.Background(), playerClaimsKey{}, &playerClaims{PlayerID: "alice"})
+	sub := newTestBrowser(t).subscription("https://push.example.com/abc")
+	req := &ladderpb.RegisterPushSubscriptionRequest{Subscription: &ladderpb.PushSubscription{Endpoint: sub.Endpoint, P256Dh: sub.P256dh, Auth: sub.Auth}}
+
+	if _, err := svc.RegisterPushSubscription(ctx, req); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition with push disabled, got %v", err)
+	}
+
+	private, public, _ := GenerateVAPIDKeys()
+	store, _ := NewNotificationStore(filepath.Join(t.TempDir(), notificationStoreFile))
+	svc.notifier = NewNotifier(store)
+	svc.notifier.EnableWebPush(private, "mailto:admin@example.org")
+
+	if _, err := svc.RegisterPushSubscription(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a player token, got %v", err)
+	}
+	for _, bad := range []*ladderpb.PushSubscription{
+		{Endpoint: "http://push.example.com/abc", P256Dh: sub.P256dh, Auth: sub.Auth},
+		{Endpoint: sub.Endpoint, P256Dh: sub.P256dh},
+		{FcmToken: "device-token"}, // FCM is not configured
+		{},
+	} {
+		if _, err := svc.RegisterPushSubscription(ctx, &ladderpb.RegisterPushSubscriptionRequest{Subscription: bad}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument for %v, got %v", bad, err)
+		}
+	}
+
+	first, err := svc.RegisterPushSubscription(ctx, req)
+	if err != nil {
+		t.Fatalf("RegisterPushSubscription failed: %v", err)
+	}
+	again, _ := svc.RegisterPushSubscription(ctx, req)
+	if again.SubscriptionId != first.SubscriptionId {
+		t.Error("registering the same endpoint twice should return the same subscription")
+	}
+
+	if _, err := svc.UpdatePushPreferences(ctx, &ladderpb.UpdatePushPreferencesRequest{EnabledEvents: []ladderpb.NotificationEvent{99}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an unknown event, got %v", err)
+	}
+	svc.UpdatePushPreferences(ctx, &ladderpb.UpdatePushPreferencesRequest{EnabledEvents: []ladderpb.NotificationEvent{ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED}})
+	prefs, err := svc.GetPushPreferences(ctx, &ladderpb.GetPushPreferencesRequest{})
+	if err != nil {
+		t.Fatalf("GetPushPreferences failed: %v", err)
+	}
+	if len(prefs.Subscriptions) != 1 || prefs.VapidPublicKey != public || len(prefs.EnabledEvents) != 1 || prefs.EnabledEvents[0] != ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED {
+		t.Errorf("unexpected preferences %v", prefs)
+	}
+
+	if _, err := svc.UnregisterPushSubscription(ctx, &ladderpb.UnregisterPushSubscriptionRequest{SubscriptionId: first.SubscriptionId}); err != nil {
+		t.Fatalf("UnregisterPushSubscription failed: %v", err)
+	}
+	if _, err := svc.UnregisterPushSubscription(ctx, &ladderpb.UnregisterPushSubscriptionRequest{SubscriptionId: first.SubscriptionId}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a removed subscription, got %v", err)
+	}
+}
+
+func TestFCMSender(t *testing.T) {
+	var mu sync.Mutex
+	var sent []map[string]interface{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/token":
+			w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+		case r.Header.Get("Authorization") != "Bearer tok":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/projects/club-app/messages:send":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			message := body["message"].(map[string]interface{})
+			if message["token"] == "uninstalled" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+				return
+			}
+			sent = append(sent, message)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	creds, _ := json.Marshal(map[string]string{
+		"client_email": "push@club-app.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    api.URL + "/token",
+		"project_id":   "club-app",
+	})
+
+	store, _ := NewNotificationStore(filepath.Join(t.TempDir(), notificationStoreFile))
+	notifier := NewNotifier(store)
+	if err := notifier.EnableFCM(creds); err != nil {
+		t.Fatalf("EnableFCM failed: %v", err)
+	}
+	notifier.fcm.apiBase = api.URL
+	store.Register("", "alice", pushSubscription{FCMToken: "phone"})
+	store.Register("", "alice", pushSubscription{FCMToken: "uninstalled"})
+
+	notifier.notify(context.Background(), "", "alice", ladderpb.NotificationEvent_NOTIFY_RANK_CHANGED, notification{Title: "Ladder update", Body: "You moved up to #1 (from #2)", Tag: "rank"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || sent[0]["token"] != "phone" {
+		t.Fatalf("expected one message to the phone, got %v", sent)
+	}
+	notification := sent[0]["notification"].(map[string]interface{})
+	data := sent[0]["data"].(map[string]interface{})
+	if notification["title"] != "Ladder update" || data["event"] != "NOTIFY_RANK_CHANGED" {
+		t.Errorf("unexpected message %v", sent[0])
+	}
+	if subs := store.Subscriptions("", "alice"); len(subs) != 1 || subs[0].FCMToken != "phone" {
+		t.Errorf("expected the unregistered token to be dropped, got %v", subs)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestQRReedSolomon(t *testing.T) {
+	// Version 1-M "HELLO WORLD" example from the QR code specification walkthrough
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := qrRSRemainder(data, qrRSDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Errorf("got ECC %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	if got := qrFormatBits(); got != 0x5412 {
+		t.Errorf("format bits for level M, mask 0 = %015b, want 101010000010010", got)
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	tests := []struct {
+		length   int
+		wantSize int
+	}{
+		{10, 21},  // version 1
+		{120, 45}, // version 7, with version information
+		{213, 57}, // version 10, the largest supported
+	}
+	for _, tt := range tests {
+		q, err := EncodeQR(bytes.Repeat([]byte("a"), tt.length))
+		if err != nil {
+			t.Fatalf("EncodeQR(%d bytes) failed: %v", tt.length, err)
+		}
+		if q.Size != tt.wantSize {
+			t.Errorf("EncodeQR(%d bytes) size = %d, want %d", tt.length, q.Size, tt.wantSize)
+		}
+		// Finder pattern corners and the always-dark module
+		for _, c := range [][2]int{{0, 0}, {6, 6}, {q.Size - 1, 0}, {0, q.Size - 1}, {8, q.Size - 8}} {
+			if !q.Dark(c[0], c[1]) {
+				t.Errorf("module %v should be dark", c)
+			}
+		}
+		if q.Dark(7, 7) {
+			t.Error("finder separator should be light")
+		}
+	}
+
+	if _, err := EncodeQR(bytes.Repeat([]byte("a"), 214)); err == nil {
+		t.Error("expected error for data that does not fit")
+	}
+}
+
+func TestQRCode_WritePNG(t *testing.T) {
+	q, _ := EncodeQR([]byte("https://example.org/r/abc"))
+	var buf bytes.Buffer
+	if err := q.WritePNG(&buf, 4); err != nil {
+		t.Fatalf("WritePNG failed: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	if got, want := img.Bounds().Dx(), (q.Size+8)*4; got != want {
+		t.Errorf("image width %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+// Provisional players join below every ranked player and play qualification matches,
+// which move nobody. Once a player has played the number the rules ask for, a
+// PLACE_PLAYER transaction inserts them where their results put them.
+
+// qualificationResult is one qualification match from the provisional player's side
+type qualificationResult struct {
+	opponent string
+	won      bool
+}
+
+// qualificationResults returns a provisional player's matches since they last joined
+// the ladder, all of which were qualification matches
+func qualificationResults(txs []*storagepb.TransactionStorage, playerID string) []qualificationResult {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	var results []qualificationResult
+	for _, t := range txs {
+		if p := t.GetAddPlayerPayload(); p != nil && p.PlayerId == playerID && !invalidated[t.Id] {
+			results = nil
+		}
+		mr := t.GetMatchResultPayload()
+		if mr == nil || mr.Friendly || invalidated[t.Id] {
+			continue
+		}
+		switch playerID {
+		case mr.ChallengerId:
+			results = append(results, qualificationResult{opponent: mr.DefenderId, won: mr.WinnerId == playerID})
+		case mr.DefenderId:
+			results = append(results, qualificationResult{opponent: mr.ChallengerId, won: mr.WinnerId == playerID})
+		}
+	}
+	return results
+}
+
+// placementRank chooses where a qualified player enters the ranked ladder: the rank
+// that agrees with the most of their results against ranked players, where a win
+// agrees with ranking above the opponent and a loss with ranking below. Of equally
+// good ranks the lowest is taken, so nobody is displaced on thin evidence.
+func placementRank(players []*ladderpb.Player, results []qualificationResult) int32 {
+	rankOf := make(map[string]int32)
+	for _, p := range players {
+		if !p.Provisional {
+			rankOf[p.Id] = p.Rank
+		}
+	}
+
+	ranked := int32(replay.RankedCount(players))
+	best, bestAgree := ranked+1, -1
+	for rank := ranked + 1; rank >= 1; rank-- {
+		agree := 0
+		for _, r := range results {
+			opp, ok := rankOf[r.opponent]
+			if !ok {
+				continue // Provisional opponents say nothing about the ranked ladder
+			}
+			if r.won == (rank <= opp) {
+				agree++
+			}
+		}
+		if agree > bestAgree {
+			best, bestAgree = rank, agree
+		}
+	}
+	return best
+}
+
+// placeQualifiedLocked places those of playerIDs who are provisional and have played
+// enough qualification matches, or any match once the rules stop asking for them,
+// starting from players. The caller must hold m.mu.
+func (m *Model) placeQualifiedLocked(players []*ladderpb.Player, playerIDs ...string) error {
+	var due []string
+	for _, p := range players {
+		for _, id := range playerIDs {
+			if p.Id == id && p.Provisional {
+				due = append(due, id)
+			}
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return err
+	}
+	required := rulesAt(txs, len(txs)).QualificationMatches
+	for _, id := range due {
+		var player *ladderpb.Player
+		for _, p := range players {
+			if p.Id == id {
+				player = p
+			}
+		}
+		if required > 0 && player.QualificationMatchesPlayed < required {
+			continue
+		}
+
+		payload := &storagepb.PlacePlayerStorage{PlayerId: id, Rank: placementRank(players, qualificationResults(txs, id))}
+		next, err := m.applyTransactionLogic(storagepb.TransactionType_PLACE_PLAYER, payload, players)
+		if err != nil {
+			return err
+		}
+		tx := &storagepb.TransactionStorage{
+			Id:          m.newID(),
+			Type:        storagepb.TransactionType_PLACE_PLAYER,
+			TimestampMs: m.now().UnixMilli(),
+			Payload:     &storagepb.TransactionStorage_PlacePlayerPayload{PlacePlayerPayload: payload},
+			PlayerList:  ladderToStorage(next),
+		}
+		if err := m.writeTransactionLocked(tx); err != nil {
+			return err
+		}
+		txs = append(txs, tx)
+		players = next
+	}
+	return nil
+}
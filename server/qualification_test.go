@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+func TestModel_QualificationMatches(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	// The first player has nobody to qualify against
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, QualificationMatches: -1}); err == nil {
+		t.Error("expected an error for negative qualification matches")
+	}
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, QualificationMatches: 2}); err != nil {
+		t.Fatalf("SetLadderRules failed: %v", err)
+	}
+
+	dave, err := m.AddPlayer("Dave", "dave")
+	if err != nil {
+		t.Fatalf("AddPlayer failed: %v", err)
+	}
+	if !dave.Provisional || dave.Rank != 4 {
+		t.Errorf("expected Dave to join provisionally at the bottom, got %+v", dave)
+	}
+
+	// A ranked player added later still goes above the provisional one
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7})
+	m.AddPlayer("Erin", "erin")
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, QualificationMatches: 2})
+	assertOrder(t, m, "alice", "bob", "charlie", "erin", "dave")
+
+	// Qualification matches move nobody
+	win := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	if _, err := m.AddMatchResult("dave", "charlie", "dave", win); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "alice", "bob", "charlie", "erin", "dave")
+	if p := m.ListPlayers()[4]; !p.Provisional || p.QualificationMatchesPlayed != 1 {
+		t.Errorf("expected one qualification match, got %+v", p)
+	}
+
+	// The second completes qualification: beat Charlie, lost to Alice
+	lose := []*ladderpb.SetScore{{DefenderPoints: 11}, {DefenderPoints: 11}, {DefenderPoints: 11}}
+	if _, err := m.AddMatchResult("dave", "alice", "alice", lose); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "alice", "bob", "dave", "charlie", "erin")
+	if p := m.ListPlayers()[2]; p.Provisional || p.QualificationMatchesPlayed != 0 {
+		t.Errorf("expected Dave to be ranked, got %+v", p)
+	}
+
+	txs, _, err := m.ListTransactions(context.Background(), 1, "", nil)
+	if err != nil || len(txs) != 1 || txs[0].Type != storagepb.TransactionType_PLACE_PLAYER.String() {
+		t.Fatalf("expected a placement transaction, got %v, %v", txs, err)
+	}
+	if txs[0].Summary != "Placed Dave at #3 after qualifying" {
+		t.Errorf("unexpected summary %q", txs[0].Summary)
+	}
+}
+
+func assertOrder(t *testing.T, m *Model, ids ...string) {
+	t.Helper()
+	players := m.ListPlayers()
+	if len(players) != len(ids) {
+		t.Fatalf("expected %d players, got %d", len(ids), len(players))
+	}
+	for i, p := range players {
+		if p.Id != ids[i] || p.Rank != int32(i+1) {
+			t.Errorf("position %d: expected %s, got %s at #%d", i+1, ids[i], p.Id, p.Rank)
+		}
+	}
+}
+
+func TestPlacementRank(t *testing.T) {
+	players := []*ladderpb.Player{
+		{Id: "a", Rank: 1}, {Id: "b", Rank: 2}, {Id: "c", Rank: 3},
+		{Id: "p", Rank: 4, Provisional: true}, {Id: "q", Rank: 5, Provisional: true},
+	}
+	tests := []struct {
+		name    string
+		results []qualificationResult
+		want    int32
+	}{
+		{"no results", nil, 4},
+		{"beat the top", []qualificationResult{{"a", true}}, 1},
+		{"lost to the bottom", []qualificationResult{{"c", false}}, 4},
+		{"between", []qualificationResult{{"a", false}, {"c", true}}, 3},
+		{"contradictory takes the lowest", []qualificationResult{{"a", true}, {"c", false}}, 4},
+		{"provisional opponents ignored", []qualificationResult{{"q", true}, {"b", false}}, 4},
+	}
+	for _, tt := range tests {
+		if got := placementRank(players, tt.results); got != tt.want {
+			t.Errorf("%s: placementRank = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
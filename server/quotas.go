@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// QuotaExceededError is returned when a write would take a club past one of its limits
+type QuotaExceededError struct {
+	Resource string
+	Limit    int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("club quota exceeded: %s limit is %d", e.Resource, e.Limit)
+}
+
+// SetQuota limits the ladder's size; nil or zero fields mean unlimited
+func (m *Model) SetQuota(q *ladderpb.ClubQuota) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quota = q
+}
+
+// checkQuotaLocked rejects tx, encoded as lineSize bytes of log, if writing it would
+// exceed the model's quota. Invalidations are always allowed so that admins can correct mistakes.
+func (m *Model) checkQuotaLocked(tx *storagepb.TransactionStorage, lineSize int64) error {
+	q := m.quota
+	if q == nil || tx.Type == storagepb.TransactionType_INVALIDATE_MATCH {
+		return nil
+	}
+
+	if q.MaxStorageBytes > 0 {
+		size, err := m.logSizeLocked()
+		if err != nil {
+			return err
+		}
+		if size+lineSize > q.MaxStorageBytes {
+			return &QuotaExceededError{Resource: "storage bytes", Limit: q.MaxStorageBytes}
+		}
+	}
+
+	if q.MaxPlayers > 0 && tx.Type == storagepb.TransactionType_ADD_PLAYER && len(tx.PlayerList) > int(q.MaxPlayers) {
+		return &QuotaExceededError{Resource: "players", Limit: int64(q.MaxPlayers)}
+	}
+
+	if q.MaxMatchesPerMonth > 0 && tx.GetMatchResultPayload() != nil {
+		txs, err := m.readTransactionsLocked()
+		if err != nil {
+			return err
+		}
+		if matchesInMonth(txs, m.now()) >= int(q.MaxMatchesPerMonth) {
+			return &QuotaExceededError{Resource: "matches per month", Limit: int64(q.MaxMatchesPerMonth)}
+		}
+	}
+
+	return nil
+}
+
+// Usage reports the ladder's current resource consumption against its quota
+func (m *Model) Usage() (*ladderpb.ClubUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	players, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	size, err := m.logSizeLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ladderpb.ClubUsage{
+		Players:          int32(len(players)),
+		MatchesThisMonth: int32(matchesInMonth(txs, m.now())),
+		StorageBytes:     size,
+		Quota:            m.quota,
+	}, nil
+}
+
+func (m *Model) logSizeLocked() (int64, error) {
+	stat, err := os.Stat(m.LogFilePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// matchesInMonth counts match results recorded in the UTC calendar month containing now,
+// including ones that were later invalidated
+func matchesInMonth(txs []*storagepb.TransactionStorage, now time.Time) int {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	count := 0
+	for _, t := range txs {
+		if t.GetMatchResultPayload() != nil && t.TimestampMs >= start {
+			count++
+		}
+	}
+	return count
+}
+
+// Usage reports resource consumption for a single club
+func (r *ClubRegistry) Usage(id string) (*ladderpb.ClubUsage, error) {
+	m, err := r.Model(id)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := m.Usage()
+	if err != nil {
+		return nil, err
+	}
+	usage.ClubId = id
+	return usage, nil
+}
+
+// GetUsage reports resource consumption for one club, or for every club when none is given
+func (h *LadderService) GetUsage(ctx context.Context, req *ladderpb.GetUsageRequest) (*ladderpb.GetUsageResponse, error) {
+	if h.clubs == nil {
+		if req.ClubId != "" {
+			return nil, fmt.Errorf("multi-club mode is not enabled")
+		}
+		usage, err := h.model.Usage()
+		if err != nil {
+			return nil, err
+		}
+		return &ladderpb.GetUsageResponse{Clubs: []*ladderpb.ClubUsage{usage}}, nil
+	}
+
+	ids := []string{req.ClubId}
+	if req.ClubId == "" {
+		clubs, err := h.clubs.ListClubs()
+		if err != nil {
+			return nil, err
+		}
+		ids = ids[:0]
+		for _, c := range clubs {
+			ids = append(ids, c.Id)
+		}
+	}
+
+	resp := &ladderpb.GetUsageResponse{Clubs: []*ladderpb.ClubUsage{}}
+	for _, id := range ids {
+		usage, err := h.clubs.Usage(id)
+		if err != nil {
+			return nil, err
+		}
+		resp.Clubs = append(resp.Clubs, usage)
+	}
+	return resp, nil
+}
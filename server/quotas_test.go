@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestModel_QuotaPlayers(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.SetQuota(&ladderpb.ClubQuota{MaxPlayers: 2})
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	_, err := m.AddPlayer("Charlie", "charlie")
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) || quotaErr.Resource != "players" {
+		t.Fatalf("expected players quota error, got %v", err)
+	}
+	if got := len(m.ListPlayers()); got != 2 {
+		t.Errorf("expected 2 players after rejected add, got %d", got)
+	}
+}
+
+func TestModel_QuotaMatchesPerMonth(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.SetQuota(&ladderpb.ClubQuota{MaxMatchesPerMonth: 1})
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	scores := []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 11, DefenderPoints: 5}}
+
+	txID, err := m.AddMatchResult("bob", "alice", "bob", scores)
+	if err != nil {
+		t.Fatalf("first match should be within quota: %v", err)
+	}
+	if _, err := m.AddMatchResult("alice", "bob", "alice", scores); err == nil {
+		t.Fatal("expected matches quota error")
+	}
+	// Corrections are never blocked
+	if err := m.InvalidateMatchResult(context.Background(), txID); err != nil {
+		t.Errorf("invalidation should bypass quotas: %v", err)
+	}
+
+	usage, err := m.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.Players != 2 || usage.MatchesThisMonth != 1 || usage.StorageBytes == 0 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestModel_QuotaStorage(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.SetQuota(&ladderpb.ClubQuota{MaxStorageBytes: 200})
+	var err error
+	for i := 0; i < 20 && err == nil; i++ {
+		_, err = m.AddPlayer("Player", "")
+	}
+	if err == nil {
+		t.Fatal("expected storage quota error")
+	}
+	stat, _ := os.Stat(path)
+	if stat.Size() > 200 {
+		t.Errorf("log grew to %d bytes, past the 200 byte quota", stat.Size())
+	}
+}
+
+func TestLadderService_GetUsage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ladder_clubs_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	r, _ := NewClubRegistry(dir, &ladderpb.ClubQuota{MaxPlayers: 1})
+	r.CreateClub("riverside", "Riverside SC", nil)
+	r.CreateClub("abbey", "Abbey", &ladderpb.ClubQuota{MaxPlayers: 5})
+
+	svc := NewLadderService(m)
+	svc.clubs = r
+	interceptor := clubUnaryInterceptor(r, "")
+	info := &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/AddPlayer"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(clubHeader, "riverside"))
+	add := func(id string) error {
+		_, err := interceptor(ctx, &ladderpb.AddPlayerRequest{Name: id, PlayerId: id}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return svc.AddPlayer(ctx, req.(*ladderpb.AddPlayerRequest))
+		})
+		return err
+	}
+	if err := add("alice"); err != nil {
+		t.Fatalf("AddPlayer failed: %v", err)
+	}
+	if err := add("bob"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+
+	resp, err := svc.GetUsage(context.Background(), &ladderpb.GetUsageRequest{})
+	if err != nil {
+		t.Fatalf("GetUsage failed: %v", err)
+	}
+	if len(resp.Clubs) != 2 {
+		t.Fatalf("expected usage for 2 clubs, got %d", len(resp.Clubs))
+	}
+	abbey, riverside := resp.Clubs[0], resp.Clubs[1]
+	if abbey.ClubId != "abbey" || abbey.Players != 0 || abbey.Quota.GetMaxPlayers() != 5 {
+		t.Errorf("unexpected abbey usage: %+v", abbey)
+	}
+	if riverside.ClubId != "riverside" || riverside.Players != 1 || riverside.Quota.GetMaxPlayers() != 1 {
+		t.Errorf("unexpected riverside usage: %+v", riverside)
+	}
+}
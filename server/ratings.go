@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+const (
+	initialRating = 1500.0
+	ratingKFactor = 32.0
+)
+
+// RatingChange is the Elo movement of both players in one match
+type RatingChange struct {
+	ChallengerDelta float64
+	DefenderDelta   float64
+}
+
+// ratingEngine replays match results into Elo ratings. Ratings are derived from the
+// log on demand so invalidating a match also removes its rating effect.
+type ratingEngine struct {
+	ratings map[string]float64
+	changes map[string]RatingChange            // By match transaction ID
+	history map[string][]*ladderpb.RatingPoint // By player ID
+}
+
+func computeRatings(txs []*storagepb.TransactionStorage) *ratingEngine {
+	e := &ratingEngine{
+		ratings: make(map[string]float64),
+		changes: make(map[string]RatingChange),
+		history: make(map[string][]*ladderpb.RatingPoint),
+	}
+
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	for _, t := range txs {
+		mr := t.GetMatchResultPayload()
+		if mr == nil || mr.Friendly || invalidated[t.Id] {
+			continue
+		}
+		e.apply(t, mr)
+	}
+	return e
+}
+
+func (e *ratingEngine) rating(playerID string) float64 {
+	if r, ok := e.ratings[playerID]; ok {
+		return r
+	}
+	return initialRating
+}
+
+func (e *ratingEngine) apply(t *storagepb.TransactionStorage, mr *storagepb.MatchResultStorage) {
+	c, d := e.rating(mr.ChallengerId), e.rating(mr.DefenderId)
+	delta := eloDelta(c, d, mr.WinnerId == mr.ChallengerId)
+	e.ratings[mr.ChallengerId] = c + delta
+	e.ratings[mr.DefenderId] = d - delta
+	e.changes[t.Id] = RatingChange{ChallengerDelta: delta, DefenderDelta: -delta}
+
+	e.history[mr.ChallengerId] = append(e.history[mr.ChallengerId], &ladderpb.RatingPoint{
+		TransactionId: t.Id,
+		TimestampMs:   t.TimestampMs,
+		Rating:        c + delta,
+		Delta:         delta,
+	})
+	e.history[mr.DefenderId] = append(e.history[mr.DefenderId], &ladderpb.RatingPoint{
+		TransactionId: t.Id,
+		TimestampMs:   t.TimestampMs,
+		Rating:        d - delta,
+		Delta:         -delta,
+	})
+}
+
+// annotate fills in the rating deltas on an API match result
+func (e *ratingEngine) annotate(mr *ladderpb.MatchResult) {
+	if c, ok := e.changes[mr.TransactionId]; ok {
+		mr.ChallengerRatingDelta = c.ChallengerDelta
+		mr.DefenderRatingDelta = c.DefenderDelta
+	}
+}
+
+// eloDelta is the challenger's rating change for a match between players rated c and d
+func eloDelta(c, d float64, challengerWon bool) float64 {
+	expected := 1 / (1 + math.Pow(10, (d-c)/400))
+
+	score := 0.0
+	if challengerWon {
+		score = 1
+	}
+	return roundRating(ratingKFactor * (score - expected))
+}
+
+func roundRating(r float64) float64 {
+	return math.Round(r*10) / 10
+}
+
+// MatchRatingChange returns the Elo movement caused by a recorded match
+func (m *Model) MatchRatingChange(txID string) (RatingChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return RatingChange{}, err
+	}
+	c, ok := computeRatings(txs).changes[txID]
+	if !ok {
+		return RatingChange{}, fmt.Errorf("no rating change for transaction %s", txID)
+	}
+	return c, nil
+}
+
+// GetRatingHistory returns a player's current rating and the rating after each match, oldest first
+func (m *Model) GetRatingHistory(ctx context.Context, playerID string) (float64, []*ladderpb.RatingPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, ok := playerNames(txs)[playerID]; !ok {
+		return 0, nil, fmt.Errorf("player not found")
+	}
+
+	e := computeRatings(txs)
+	history := e.history[playerID]
+	if history == nil {
+		history = []*ladderpb.RatingPoint{}
+	}
+	return e.rating(playerID), history, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_RatingHistory(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	win := []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+	}
+	first, _ := m.AddMatchResult("bob", "alice", "bob", win)
+	second, _ := m.AddMatchResult("alice", "bob", "alice", win)
+
+	change, err := m.MatchRatingChange(first)
+	if err != nil {
+		t.Fatalf("MatchRatingChange failed: %v", err)
+	}
+	// Equal ratings: the winner gains K/2
+	if change.ChallengerDelta != 16 || change.DefenderDelta != -16 {
+		t.Errorf("unexpected first change: %+v", change)
+	}
+
+	current, history, err := m.GetRatingHistory(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("GetRatingHistory failed: %v", err)
+	}
+	if len(history) != 2 || history[0].Delta != -16 || history[1].TransactionId != second {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if current != history[1].Rating || current <= 1484 {
+		t.Errorf("unexpected current rating %v", current)
+	}
+
+	matches, _ := m.GetRecentMatches(10)
+	if matches[1].ChallengerRatingDelta != 16 {
+		t.Errorf("expected recent matches to carry rating deltas, got %+v", matches[1])
+	}
+
+	// Invalidated matches no longer count
+	m.InvalidateMatchResult(context.Background(), first)
+	current, history, _ = m.GetRatingHistory(context.Background(), "alice")
+	if len(history) != 1 || history[0].Delta != 16 || current != 1516 {
+		t.Errorf("expected only the second match to count, got %v %+v", current, history)
+	}
+
+	if _, _, err := m.GetRatingHistory(context.Background(), "nobody"); err == nil {
+		t.Error("expected error for unknown player")
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// liveSettings holds the parts of the configuration that can change while the server
+// runs, so a reload keeps connections and live event streams open. Ladder rules need
+// no reload: SetLadderRules changes them in the log.
+type liveSettings struct {
+	reload    func() (Config, error) // nil when reloading is not set up
+	integrity *IntegrityChecker      // nil when scheduled checks are off
+	growth    *GrowthAlarm
+
+	mu                  sync.RWMutex
+	corsOrigins         []string
+	integrityWebhookURL string
+	growthWebhookURL    string
+	growthLimits        GrowthLimits
+}
+
+// newLiveSettings starts from cfg's values
+func newLiveSettings(cfg Config, integrity *IntegrityChecker, growth *GrowthAlarm) *liveSettings {
+	return &liveSettings{
+		reload:              cfg.Reload,
+		integrity:           integrity,
+		growth:              growth,
+		corsOrigins:         cfg.CORSOrigins,
+		integrityWebhookURL: cfg.IntegrityWebhookURL,
+		growthWebhookURL:    cfg.GrowthWebhookURL,
+		growthLimits:        GrowthLimits{MaxBytes: cfg.LogWarnBytes, MaxTransactions: cfg.LogWarnTransactions},
+	}
+}
+
+// Reload fetches the configuration again and applies what changed, returning the
+// names of the changed settings. Other fields of the new Config are ignored.
+func (s *liveSettings) Reload() ([]string, error) {
+	if s.reload == nil {
+		return nil, status.Error(codes.FailedPrecondition, "configuration reload is not set up")
+	}
+	cfg, err := s.reload()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload configuration: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changed []string
+	if !slices.Equal(cfg.CORSOrigins, s.corsOrigins) {
+		s.corsOrigins = cfg.CORSOrigins
+		changed = append(changed, "cors_origins")
+	}
+	if cfg.IntegrityWebhookURL != s.integrityWebhookURL {
+		s.integrityWebhookURL = cfg.IntegrityWebhookURL
+		if s.integrity != nil {
+			s.integrity.SetWebhookURL(cfg.IntegrityWebhookURL)
+		}
+		changed = append(changed, "integrity_webhook_url")
+	}
+	if cfg.GrowthWebhookURL != s.growthWebhookURL {
+		s.growthWebhookURL = cfg.GrowthWebhookURL
+		s.growth.SetWebhookURL(cfg.GrowthWebhookURL)
+		changed = append(changed, "growth_webhook_url")
+	}
+	if limits := (GrowthLimits{MaxBytes: cfg.LogWarnBytes, MaxTransactions: cfg.LogWarnTransactions}); limits != s.growthLimits {
+		s.growthLimits = limits
+		s.growth.SetLimits(limits)
+		changed = append(changed, "log_growth_limits")
+	}
+	log.Printf("Configuration reloaded, changed: %v", changed)
+	return changed, nil
+}
+
+// reloadOnSignal reloads on every SIGHUP until stop is closed
+func (s *liveSettings) reloadOnSignal(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				if _, err := s.Reload(); err != nil {
+					log.Printf("SIGHUP: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// setCORSOrigin allows r's origin to read the response: any origin when none are
+// configured, otherwise only the listed ones
+func (s *liveSettings) setCORSOrigin(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	origins := s.corsOrigins
+	s.mu.RUnlock()
+
+	if len(origins) == 0 {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(origins, origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
+// ReloadConfig applies configuration changes without a restart
+func (h *LadderService) ReloadConfig(ctx context.Context, req *ladderpb.ReloadConfigRequest) (*ladderpb.ReloadConfigResponse, error) {
+	if h.settings == nil {
+		return nil, status.Error(codes.FailedPrecondition, "configuration reload is not set up")
+	}
+	changed, err := h.settings.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ReloadConfigResponse{Changed: changed}, nil
+}
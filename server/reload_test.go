@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLiveSettings_Reload(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	next := Config{
+		CORSOrigins:      []string{"https://club.example.org"},
+		GrowthWebhookURL: "https://hooks.example.org/growth",
+		LogWarnBytes:     1 << 20,
+	}
+	cfg := Config{Reload: func() (Config, error) { return next, nil }}
+	growth := NewGrowthAlarm(m, nil, GrowthLimits{}, time.Hour, "")
+	settings := newLiveSettings(cfg, nil, growth)
+
+	cors := func(origin string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		settings.setCORSOrigin(w, r)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+	if got := cors("https://evil.example.com"); got != "*" {
+		t.Errorf("expected any origin before the reload, got %q", got)
+	}
+
+	changed, err := settings.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	want := []string{"cors_origins", "growth_webhook_url", "log_growth_limits"}
+	if !slices.Equal(changed, want) {
+		t.Errorf("expected %v to change, got %v", want, changed)
+	}
+	if got := cors("https://club.example.org"); got != "https://club.example.org" {
+		t.Errorf("expected the listed origin to be allowed, got %q", got)
+	}
+	if got := cors("https://evil.example.com"); got != "" {
+		t.Errorf("expected other origins to be refused, got %q", got)
+	}
+	if growth.limits.MaxBytes != 1<<20 || growth.webhookURL != next.GrowthWebhookURL {
+		t.Errorf("expected the growth alarm to be updated, got %+v, %q", growth.limits, growth.webhookURL)
+	}
+
+	if changed, err := settings.Reload(); err != nil || len(changed) != 0 {
+		t.Errorf("expected nothing to change on a second reload, got %v, %v", changed, err)
+	}
+}
+
+func TestLiveSettings_ReloadNotSetUp(t *testing.T) {
+	settings := newLiveSettings(Config{}, nil, nil)
+	if _, err := settings.Reload(); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition, got %v", err)
+	}
+}
@@ -0,0 +1,509 @@
+// Package replay computes the ladder from its transaction log.
+//
+// Apply is the only place where a transaction changes the standings. It is
+// deterministic: the players it returns depend on nothing but its arguments. It reads
+// no clock, randomness, configuration or I/O, and it never modifies the players it
+// is given. Anything a transaction needs that depends on when it was written, such as
+// the join position in force or the ratings at the time, is stored in its payload.
+// Replaying the same log therefore always yields the same snapshots, whether that is
+// done transaction by transaction as they are written, from a checkpoint after an
+// invalidation, or from scratch by Snapshots.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// Errors for transactions that do not fit the players they are applied to
+var (
+	ErrDuplicatePlayer     = errors.New("player ID already exists")
+	ErrPlayerNotFound      = errors.New("player not found")
+	ErrMatchPlayerNotFound = errors.New("challenger or defender not found")
+)
+
+// UnknownPlayerError is returned when a REORDER lists a player who is not on the ladder
+type UnknownPlayerError struct {
+	PlayerID string
+}
+
+func (e *UnknownPlayerError) Error() string {
+	return "player not found: " + e.PlayerID
+}
+
+// RankedCount returns the number of players that are not provisional, which are
+// always the top of the list
+func RankedCount(players []*ladderpb.Player) int {
+	n := 0
+	for _, p := range players {
+		if !p.Provisional {
+			n++
+		}
+	}
+	return n
+}
+
+// Apply returns the players after a transaction of type txType with payload, as
+// returned by Payload, is applied to currentPlayers
+func Apply(txType storagepb.TransactionType, payload interface{}, currentPlayers []*ladderpb.Player) ([]*ladderpb.Player, error) {
+	// Deep copy players
+	players := make([]*ladderpb.Player, len(currentPlayers))
+	for i, p := range currentPlayers {
+		players[i] = &ladderpb.Player{
+			Id:       p.Id,
+			Name:     p.Name,
+			Rank:     p.Rank,
+			Handicap: p.Handicap,
+			Category: p.Category,
+
+			Provisional:                p.Provisional,
+			QualificationMatchesPlayed: p.QualificationMatchesPlayed,
+			ProtectedFromMs:            p.ProtectedFromMs,
+			ProtectedUntilMs:           p.ProtectedUntilMs,
+		}
+	}
+
+	switch txType {
+	case storagepb.TransactionType_ADD_PLAYER:
+		p, ok := payload.(*storagepb.AddPlayerStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for ADD_PLAYER")
+		}
+		// Check duplicates
+		for _, pl := range players {
+			if pl.Id == p.PlayerId {
+				return nil, ErrDuplicatePlayer
+			}
+		}
+		newPlayer := &ladderpb.Player{
+			Id:          p.PlayerId,
+			Name:        p.Name,
+			Category:    ladderpb.PlayerCategory(p.Category),
+			Provisional: p.Provisional,
+		}
+		// Ranked players join where the join position at the time put them, always above
+		// any provisional ones
+		at := len(players)
+		if !p.Provisional {
+			ranked := RankedCount(players)
+			switch p.JoinPosition {
+			case storagepb.JoinPositionStorage_JOIN_IN_MIDDLE:
+				at = ranked / 2
+			case storagepb.JoinPositionStorage_JOIN_BY_RATING:
+				at = min(int(p.RatedAbove), ranked)
+			default:
+				at = ranked
+			}
+		}
+		players = append(players[:at], append([]*ladderpb.Player{newPlayer}, players[at:]...)...)
+		for i := at; i < len(players); i++ {
+			players[i].Rank = int32(i + 1)
+		}
+
+	case storagepb.TransactionType_REMOVE_PLAYER:
+		p, ok := payload.(*storagepb.RemovePlayerStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for REMOVE_PLAYER")
+		}
+		idx := -1
+		for i, pl := range players {
+			if pl.Id == p.PlayerId {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return nil, ErrPlayerNotFound
+		}
+		players = append(players[:idx], players[idx+1:]...)
+		// Re-rank
+		for i := idx; i < len(players); i++ {
+			players[i].Rank = int32(i + 1)
+		}
+
+	case storagepb.TransactionType_MATCH_RESULT, storagepb.TransactionType_RETROACTIVE_MATCH:
+		p, ok := payload.(*storagepb.MatchResultStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for MATCH_RESULT")
+		}
+
+		challengerIdx := -1
+		defenderIdx := -1
+		for i, pl := range players {
+			if pl.Id == p.ChallengerId {
+				challengerIdx = i
+			}
+			if pl.Id == p.DefenderId {
+				defenderIdx = i
+			}
+		}
+
+		if challengerIdx == -1 || defenderIdx == -1 {
+			return nil, ErrMatchPlayerNotFound
+		}
+
+		// Friendlies move nobody and count for nothing
+		if p.Friendly {
+			break
+		}
+
+		// Qualification matches count towards placement and move nobody
+		challenger, defender := players[challengerIdx], players[defenderIdx]
+		if challenger.Provisional || defender.Provisional {
+			for _, pl := range []*ladderpb.Player{challenger, defender} {
+				if pl.Provisional {
+					pl.QualificationMatchesPlayed++
+				}
+			}
+			break
+		}
+
+		winnerIdx := -1
+		loserIdx := -1
+		if p.WinnerId == p.ChallengerId {
+			winnerIdx = challengerIdx
+			loserIdx = defenderIdx
+		} else {
+			winnerIdx = defenderIdx
+			loserIdx = challengerIdx
+		}
+
+		// Only change rank if winner is below loser
+		if winnerIdx > loserIdx {
+			// Winner takes loser's position
+			winner := players[winnerIdx]
+
+			// Shift everyone from loserIdx to winnerIdx-1 down one spot
+			copy(players[loserIdx+1:winnerIdx+1], players[loserIdx:winnerIdx])
+
+			// Place winner at loser's old spot
+			players[loserIdx] = winner
+
+			// Re-assign ranks
+			for i := loserIdx; i <= winnerIdx; i++ {
+				players[i].Rank = int32(i + 1)
+			}
+		}
+
+	case storagepb.TransactionType_INVALIDATE_MATCH:
+		// We don't apply logic on top of current state for invalidation
+		// because invalidation requires replay.
+		return currentPlayers, nil
+
+	case storagepb.TransactionType_RULES_CHANGE, storagepb.TransactionType_SESSION_OPEN, storagepb.TransactionType_SESSION_CLOSE,
+		storagepb.TransactionType_ATTENDANCE, storagepb.TransactionType_WAITING_LIST_JOIN, storagepb.TransactionType_JOIN_REQUEST,
+		storagepb.TransactionType_JOIN_REJECTED, storagepb.TransactionType_ATTACHMENT, storagepb.TransactionType_TEAM,
+		storagepb.TransactionType_FIXTURE:
+		// Rules and sessions don't move players; the snapshot is carried forward unchanged
+
+	case storagepb.TransactionType_SET_HANDICAP:
+		p, ok := payload.(*storagepb.SetHandicapStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for SET_HANDICAP")
+		}
+		found := false
+		for _, pl := range players {
+			if pl.Id == p.PlayerId {
+				pl.Handicap = p.Handicap
+				found = true
+			}
+		}
+		if !found {
+			return nil, ErrPlayerNotFound
+		}
+
+	case storagepb.TransactionType_SET_PROTECTION:
+		p, ok := payload.(*storagepb.SetProtectionStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for SET_PROTECTION")
+		}
+		found := false
+		for _, pl := range players {
+			if pl.Id == p.PlayerId {
+				pl.ProtectedFromMs = p.FromMs
+				pl.ProtectedUntilMs = p.UntilMs
+				found = true
+			}
+		}
+		if !found {
+			return nil, ErrPlayerNotFound
+		}
+
+	case storagepb.TransactionType_SET_CATEGORY:
+		p, ok := payload.(*storagepb.SetCategoryStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for SET_CATEGORY")
+		}
+		found := false
+		for _, pl := range players {
+			if pl.Id == p.PlayerId {
+				pl.Category = ladderpb.PlayerCategory(p.Category)
+				found = true
+			}
+		}
+		if !found {
+			return nil, ErrPlayerNotFound
+		}
+
+	case storagepb.TransactionType_REORDER:
+		p, ok := payload.(*storagepb.ReorderStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for REORDER")
+		}
+		byID := make(map[string]*ladderpb.Player, len(players))
+		for _, pl := range players {
+			byID[pl.Id] = pl
+		}
+		reordered := make([]*ladderpb.Player, 0, len(players))
+		for _, id := range p.PlayerIds {
+			pl, ok := byID[id]
+			if !ok {
+				return nil, &UnknownPlayerError{PlayerID: id}
+			}
+			reordered = append(reordered, pl)
+			delete(byID, id)
+		}
+		for _, pl := range players {
+			if _, ok := byID[pl.Id]; ok {
+				reordered = append(reordered, pl)
+			}
+		}
+		players = reordered
+		// Seeding places everyone, so qualification ends
+		for i, pl := range players {
+			pl.Rank = int32(i + 1)
+			pl.Provisional = false
+			pl.QualificationMatchesPlayed = 0
+		}
+
+	case storagepb.TransactionType_PLACE_PLAYER:
+		p, ok := payload.(*storagepb.PlacePlayerStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for PLACE_PLAYER")
+		}
+		idx := -1
+		for i, pl := range players {
+			if pl.Id == p.PlayerId {
+				idx = i
+			}
+		}
+		if idx == -1 {
+			return nil, ErrPlayerNotFound
+		}
+		if !players[idx].Provisional {
+			// Already placed, e.g. by seeding before an invalidation replays this
+			break
+		}
+		placed := players[idx]
+		placed.Provisional = false
+		placed.QualificationMatchesPlayed = 0
+		players = append(players[:idx], players[idx+1:]...)
+		at := int(p.Rank) - 1
+		if at < 0 {
+			at = 0
+		}
+		if n := RankedCount(players); at > n {
+			at = n
+		}
+		players = append(players[:at], append([]*ladderpb.Player{placed}, players[at:]...)...)
+		for i, pl := range players {
+			pl.Rank = int32(i + 1)
+		}
+
+	case storagepb.TransactionType_ERASE_PLAYER:
+		p, ok := payload.(*storagepb.ErasePlayerStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for ERASE_PLAYER")
+		}
+		// Players who already left the ladder can be erased too
+		for _, pl := range players {
+			if pl.Id == p.PlayerId {
+				pl.Name = p.Pseudonym
+			}
+		}
+
+	case storagepb.TransactionType_RENAME_PLAYERS:
+		p, ok := payload.(*storagepb.RenamePlayersStorage)
+		if !ok {
+			return nil, fmt.Errorf("invalid payload type for RENAME_PLAYERS")
+		}
+		names := make(map[string]string, len(p.Renames))
+		for _, r := range p.Renames {
+			names[r.PlayerId] = r.NewName
+		}
+		for _, pl := range players {
+			if name, ok := names[pl.Id]; ok {
+				pl.Name = name
+			}
+		}
+	}
+
+	return players, nil
+}
+
+// Payload extracts the oneof payload of t in the form Apply expects
+func Payload(t *storagepb.TransactionStorage) interface{} {
+	switch t.Type {
+	case storagepb.TransactionType_ADD_PLAYER:
+		return t.GetAddPlayerPayload()
+	case storagepb.TransactionType_REMOVE_PLAYER:
+		return t.GetRemovePlayerPayload()
+	case storagepb.TransactionType_MATCH_RESULT, storagepb.TransactionType_RETROACTIVE_MATCH:
+		return t.GetMatchResultPayload()
+	case storagepb.TransactionType_INVALIDATE_MATCH:
+		return t.GetInvalidateMatchPayload()
+	case storagepb.TransactionType_RULES_CHANGE:
+		return t.GetRulesChangePayload()
+	case storagepb.TransactionType_SET_HANDICAP:
+		return t.GetSetHandicapPayload()
+	case storagepb.TransactionType_SET_PROTECTION:
+		return t.GetSetProtectionPayload()
+	case storagepb.TransactionType_SET_CATEGORY:
+		return t.GetSetCategoryPayload()
+	case storagepb.TransactionType_REORDER:
+		return t.GetReorderPayload()
+	case storagepb.TransactionType_ERASE_PLAYER:
+		return t.GetErasePlayerPayload()
+	case storagepb.TransactionType_RENAME_PLAYERS:
+		return t.GetRenamePlayersPayload()
+	case storagepb.TransactionType_PLACE_PLAYER:
+		return t.GetPlacePlayerPayload()
+	case storagepb.TransactionType_SESSION_OPEN, storagepb.TransactionType_SESSION_CLOSE:
+		return t.GetSessionPayload()
+	case storagepb.TransactionType_ATTENDANCE:
+		return t.GetAttendancePayload()
+	case storagepb.TransactionType_WAITING_LIST_JOIN:
+		return t.GetWaitingListPayload()
+	case storagepb.TransactionType_JOIN_REQUEST:
+		return t.GetJoinRequestPayload()
+	case storagepb.TransactionType_JOIN_REJECTED:
+		return t.GetJoinRejectedPayload()
+	case storagepb.TransactionType_ATTACHMENT:
+		return t.GetAttachmentPayload()
+	case storagepb.TransactionType_TEAM:
+		return t.GetTeamPayload()
+	case storagepb.TransactionType_FIXTURE:
+		return t.GetFixturePayload()
+	}
+	return nil
+}
+
+// InvalidatedIDs returns every transaction an invalidation targets, the first one
+// and the rest of its batch
+func InvalidatedIDs(inv *storagepb.InvalidateMatchStorage) []string {
+	return append([]string{inv.GetInvalidatedTransactionId()}, inv.GetAlsoInvalidatedTransactionIds()...)
+}
+
+// contextCheckInterval is how many transactions Replay applies between checks of
+// its context
+const contextCheckInterval = 256
+
+// Order returns txs in the order they take effect: log order, except that a
+// RETROACTIVE_MATCH takes effect just before the transaction it was inserted before,
+// which must come earlier in txs. Invalidations and the transactions in invalidated
+// are left out.
+func Order(txs []*storagepb.TransactionStorage, invalidated map[string]bool) ([]*storagepb.TransactionStorage, error) {
+	seen := make(map[string]bool, len(txs))
+	inserted := make(map[string][]*storagepb.TransactionStorage)
+	for _, t := range txs {
+		if t.Type == storagepb.TransactionType_RETROACTIVE_MATCH {
+			before := t.GetMatchResultPayload().GetInsertBeforeId()
+			if !seen[before] {
+				return nil, fmt.Errorf("retroactive match %s is inserted before %s, which does not precede it", t.Id, before)
+			}
+			inserted[before] = append(inserted[before], t)
+		}
+		seen[t.Id] = true
+	}
+
+	order := make([]*storagepb.TransactionStorage, 0, len(txs))
+	var add func(t *storagepb.TransactionStorage)
+	add = func(t *storagepb.TransactionStorage) {
+		// Matches inserted before an invalidated transaction still count
+		for _, r := range inserted[t.Id] {
+			add(r)
+		}
+		if t.Type != storagepb.TransactionType_INVALIDATE_MATCH && !invalidated[t.Id] {
+			order = append(order, t)
+		}
+	}
+	for _, t := range txs {
+		if t.Type != storagepb.TransactionType_RETROACTIVE_MATCH {
+			add(t)
+		}
+	}
+	return order, nil
+}
+
+// Replay applies txs to players in the order they take effect, as given by Order. It
+// stops with the context's error once ctx is done.
+func Replay(ctx context.Context, players []*ladderpb.Player, txs []*storagepb.TransactionStorage, invalidated map[string]bool) ([]*ladderpb.Player, error) {
+	order, err := Order(txs, invalidated)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range order {
+		if i%contextCheckInterval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		next, err := Apply(t.Type, Payload(t), players)
+		if err != nil {
+			return nil, fmt.Errorf("replay failed at tx %s: %v", t.Id, err)
+		}
+		players = next
+	}
+	return players, nil
+}
+
+// Snapshots recomputes the player state after every transaction of a whole log, in
+// log order. Matches are excluded from the state once a later invalidation targets
+// them, and retroactive matches change the history from where they were inserted.
+// Transactions that fail to apply are reported through onError and leave the state
+// unchanged. It stops with the context's error once ctx is done.
+func Snapshots(ctx context.Context, txs []*storagepb.TransactionStorage, onError func(i int, reason string)) ([][]*ladderpb.Player, error) {
+	snapshots := make([][]*ladderpb.Player, len(txs))
+	invalidated := make(map[string]bool)
+	state := []*ladderpb.Player{}
+
+	for i, t := range txs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		switch t.Type {
+		case storagepb.TransactionType_INVALIDATE_MATCH, storagepb.TransactionType_RETROACTIVE_MATCH:
+			if inv := t.GetInvalidateMatchPayload(); inv != nil {
+				for _, id := range InvalidatedIDs(inv) {
+					invalidated[id] = true
+				}
+			}
+			// Rebuild from scratch with the history as it now stands
+			order, err := Order(txs[:i+1], invalidated)
+			if err != nil {
+				onError(i, fmt.Sprintf("replay failed: %v", err))
+				break
+			}
+			state = []*ladderpb.Player{}
+			for _, prev := range order {
+				if next, err := Apply(prev.Type, Payload(prev), state); err == nil {
+					state = next
+				} else if prev == t {
+					onError(i, fmt.Sprintf("replay failed: %v", err))
+				}
+			}
+		default:
+			next, err := Apply(t.Type, Payload(t), state)
+			if err != nil {
+				onError(i, fmt.Sprintf("replay failed: %v", err))
+			} else {
+				state = next
+			}
+		}
+		snapshots[i] = state
+	}
+
+	return snapshots, nil
+}
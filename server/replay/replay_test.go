@@ -0,0 +1,324 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// readLog reads an unencrypted log whose every line is a checkpoint, the format the
+// server writes with a checkpoint interval of 1
+func readLog(t *testing.T, path string) []*storagepb.TransactionStorage {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var txs []*storagepb.TransactionStorage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			t.Fatalf("%s line %d: %v", path, len(txs)+1, err)
+		}
+		var tx storagepb.TransactionStorage
+		if err := proto.Unmarshal(data, &tx); err != nil {
+			t.Fatalf("%s line %d: %v", path, len(txs)+1, err)
+		}
+		if tx.PlayerListDelta != nil {
+			t.Fatalf("%s line %d: golden logs must not use deltas", path, len(txs)+1)
+		}
+		txs = append(txs, &tx)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return txs
+}
+
+func fromStorage(players []*storagepb.PlayerStorage) []*ladderpb.Player {
+	out := make([]*ladderpb.Player, len(players))
+	for i, p := range players {
+		out[i] = &ladderpb.Player{
+			Id:                         p.Id,
+			Name:                       p.Name,
+			Rank:                       p.Rank,
+			Handicap:                   p.Handicap,
+			Category:                   ladderpb.PlayerCategory(p.Category),
+			Provisional:                p.Provisional,
+			QualificationMatchesPlayed: p.QualificationMatchesPlayed,
+			ProtectedFromMs:            p.ProtectedFromMs,
+			ProtectedUntilMs:           p.ProtectedUntilMs,
+		}
+	}
+	return out
+}
+
+// diffPlayers describes the first difference between two player lists, or returns ""
+func diffPlayers(want, got []*ladderpb.Player) string {
+	if len(want) != len(got) {
+		return fmt.Sprintf("expected %d players, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !proto.Equal(want[i], got[i]) {
+			return fmt.Sprintf("position %d: expected %v, got %v", i+1, want[i], got[i])
+		}
+	}
+	return ""
+}
+
+// render prints a snapshot per transaction for the golden files
+func render(txs []*storagepb.TransactionStorage, snapshots [][]*ladderpb.Player) string {
+	var b strings.Builder
+	for i, t := range txs {
+		fmt.Fprintf(&b, "%d %s\n", i+1, t.Type)
+		for _, p := range snapshots[i] {
+			fmt.Fprintf(&b, "  %2d %s %q", p.Rank, p.Id, p.Name)
+			if p.Provisional {
+				fmt.Fprintf(&b, " provisional(%d)", p.QualificationMatchesPlayed)
+			}
+			if p.Handicap != 0 {
+				fmt.Fprintf(&b, " handicap(%d)", p.Handicap)
+			}
+			if p.Category != 0 {
+				fmt.Fprintf(&b, " %s", p.Category)
+			}
+			if p.ProtectedUntilMs != 0 {
+				fmt.Fprintf(&b, " protected(%d-%d)", p.ProtectedFromMs, p.ProtectedUntilMs)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// TestGolden replays logs recorded by a running server. The replay must agree with the
+// snapshots the server wrote, and with the golden rendering; run with -update after an
+// intended change to the rules.
+func TestGolden(t *testing.T) {
+	logs, _ := filepath.Glob("testdata/*.log")
+	if len(logs) == 0 {
+		t.Fatal("no golden logs")
+	}
+	for _, path := range logs {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			txs := readLog(t, path)
+			snapshots, err := Snapshots(context.Background(), txs, func(i int, reason string) {
+				t.Errorf("transaction %d (%s): %s", i+1, txs[i].Id, reason)
+			})
+			if err != nil {
+				t.Fatalf("Snapshots failed: %v", err)
+			}
+			for i, t2 := range txs {
+				if d := diffPlayers(fromStorage(t2.PlayerList), snapshots[i]); d != "" {
+					t.Errorf("transaction %d (%s %s): %s", i+1, t2.Type, t2.Id, d)
+				}
+			}
+
+			got := render(txs, snapshots)
+			golden := strings.TrimSuffix(path, ".log") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file, run with -update: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("replay of %s differs from %s", path, golden)
+			}
+		})
+	}
+}
+
+func TestReplay_Cancelled(t *testing.T) {
+	txs := readLog(t, filepath.Join("testdata", "club-season.log"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Replay(ctx, nil, txs, nil); err != context.Canceled {
+		t.Errorf("expected Replay to stop when cancelled, got %v", err)
+	}
+	if _, err := Snapshots(ctx, txs, func(int, string) {}); err != context.Canceled {
+		t.Errorf("expected Snapshots to stop when cancelled, got %v", err)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tx := func(id string, txType storagepb.TransactionType, before string) *storagepb.TransactionStorage {
+		t := &storagepb.TransactionStorage{Id: id, Type: txType}
+		if before != "" {
+			t.Payload = &storagepb.TransactionStorage_MatchResultPayload{MatchResultPayload: &storagepb.MatchResultStorage{InsertBeforeId: before}}
+		}
+		return t
+	}
+	txs := []*storagepb.TransactionStorage{
+		tx("a", storagepb.TransactionType_ADD_PLAYER, ""),
+		tx("m1", storagepb.TransactionType_MATCH_RESULT, ""),
+		tx("m2", storagepb.TransactionType_MATCH_RESULT, ""),
+		tx("r1", storagepb.TransactionType_RETROACTIVE_MATCH, "m1"),
+		tx("r2", storagepb.TransactionType_RETROACTIVE_MATCH, "r1"), // Played before r1
+		tx("r3", storagepb.TransactionType_RETROACTIVE_MATCH, "m2"),
+		tx("i", storagepb.TransactionType_INVALIDATE_MATCH, ""),
+	}
+
+	order, err := Order(txs, map[string]bool{"m1": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, t := range order {
+		got = append(got, t.Id)
+	}
+	if want := "a r2 r1 r3 m2"; strings.Join(got, " ") != want {
+		t.Errorf("got order %v, want %s", got, want)
+	}
+
+	txs = append(txs, tx("r4", storagepb.TransactionType_RETROACTIVE_MATCH, "later"), tx("later", storagepb.TransactionType_MATCH_RESULT, ""))
+	if _, err := Order(txs, nil); err == nil {
+		t.Error("expected an insert before a later transaction to fail")
+	}
+}
+
+// FuzzConvergence drives a log the way the server writes one: each transaction's
+// snapshot is applied to the one before it, and an invalidation replays what followed
+// its target from the snapshot before the target, or before anything undone since.
+// Replaying the whole log from scratch must arrive at the same snapshots.
+func FuzzConvergence(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 2, 3, 1, 2, 5, 0, 3, 2})
+	f.Add([]byte{0, 1, 0, 9, 0, 4, 2, 2, 0, 3, 0, 1, 3, 0, 4, 1, 5, 7, 2, 6})
+	f.Add([]byte{0, 0, 0, 0, 0, 2, 0, 8, 2, 1, 4, 9, 6, 0, 1, 3, 3, 2, 2, 3, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > 400 {
+			return // Long logs only slow the search down
+		}
+		var txs []*storagepb.TransactionStorage
+		var snapshots [][]*ladderpb.Player
+		state := []*ladderpb.Player{}
+		invalidated := make(map[string]bool)
+		index := make(map[string]int)
+		next := func() int {
+			if len(data) == 0 {
+				return 0
+			}
+			b := int(data[0])
+			data = data[1:]
+			return b
+		}
+		pick := func() string {
+			if len(state) == 0 {
+				return "nobody"
+			}
+			return state[next()%len(state)].Id
+		}
+		write := func(t2 *storagepb.TransactionStorage, players []*ladderpb.Player) {
+			t2.Id = fmt.Sprintf("tx%d", len(txs))
+			index[t2.Id] = len(txs)
+			txs = append(txs, t2)
+			snapshots = append(snapshots, players)
+			state = players
+		}
+
+		for players := 0; len(data) > 0; {
+			var t2 *storagepb.TransactionStorage
+			switch op := next() % 8; op {
+			case 0:
+				players++
+				b := next()
+				t2 = &storagepb.TransactionStorage{Type: storagepb.TransactionType_ADD_PLAYER, Payload: &storagepb.TransactionStorage_AddPlayerPayload{AddPlayerPayload: &storagepb.AddPlayerStorage{
+					PlayerId:     fmt.Sprintf("p%d", players),
+					Name:         fmt.Sprintf("Player %d", players),
+					Provisional:  b&1 != 0,
+					JoinPosition: storagepb.JoinPositionStorage(b >> 1 % 3),
+					RatedAbove:   int32(b >> 3),
+				}}}
+			case 1:
+				t2 = &storagepb.TransactionStorage{Type: storagepb.TransactionType_REMOVE_PLAYER, Payload: &storagepb.TransactionStorage_RemovePlayerPayload{RemovePlayerPayload: &storagepb.RemovePlayerStorage{PlayerId: pick()}}}
+			case 2, 3:
+				c, d := pick(), pick()
+				winner := c
+				if next()%2 == 0 {
+					winner = d
+				}
+				t2 = &storagepb.TransactionStorage{Type: storagepb.TransactionType_MATCH_RESULT, Payload: &storagepb.TransactionStorage_MatchResultPayload{MatchResultPayload: &storagepb.MatchResultStorage{ChallengerId: c, DefenderId: d, WinnerId: winner}}}
+			case 4:
+				t2 = &storagepb.TransactionStorage{Type: storagepb.TransactionType_SET_HANDICAP, Payload: &storagepb.TransactionStorage_SetHandicapPayload{SetHandicapPayload: &storagepb.SetHandicapStorage{PlayerId: pick(), Handicap: int32(next() % 5)}}}
+			case 5:
+				t2 = &storagepb.TransactionStorage{Type: storagepb.TransactionType_PLACE_PLAYER, Payload: &storagepb.TransactionStorage_PlacePlayerPayload{PlacePlayerPayload: &storagepb.PlacePlayerStorage{PlayerId: pick(), Rank: int32(next() % 8)}}}
+			case 6:
+				var ids []string
+				for n := next() % 4; n > 0; n-- {
+					ids = append(ids, pick())
+				}
+				t2 = &storagepb.TransactionStorage{Type: storagepb.TransactionType_REORDER, Payload: &storagepb.TransactionStorage_ReorderPayload{ReorderPayload: &storagepb.ReorderStorage{PlayerIds: ids}}}
+			case 7:
+				// Undo any earlier transaction that is still in effect
+				if len(txs) == 0 {
+					continue
+				}
+				target := next() % len(txs)
+				if txs[target].Type == storagepb.TransactionType_INVALIDATE_MATCH || invalidated[txs[target].Id] {
+					continue
+				}
+				// Start before anything undone since, as its effect is in the snapshots
+				// up to its own invalidation
+				start := target
+				for i := start; i < len(txs); i++ {
+					if inv := txs[i].GetInvalidateMatchPayload(); inv != nil {
+						if j := index[inv.InvalidatedTransactionId]; j < start {
+							start, i = j, j
+						}
+					}
+				}
+				before := []*ladderpb.Player{}
+				if start > 0 {
+					before = snapshots[start-1]
+				}
+				invalidated[txs[target].Id] = true
+				players, err := Replay(context.Background(), before, txs[start:], invalidated)
+				if err != nil {
+					delete(invalidated, txs[target].Id)
+					continue // The server refuses an undo that breaks a later transaction
+				}
+				write(&storagepb.TransactionStorage{Type: storagepb.TransactionType_INVALIDATE_MATCH, Payload: &storagepb.TransactionStorage_InvalidateMatchPayload{InvalidateMatchPayload: &storagepb.InvalidateMatchStorage{InvalidatedTransactionId: txs[target].Id}}}, players)
+				continue
+			}
+			players, err := Apply(t2.Type, Payload(t2), state)
+			if err != nil {
+				continue // Refused, so never written
+			}
+			write(t2, players)
+		}
+
+		replayed, err := Snapshots(context.Background(), txs, func(i int, reason string) {
+			t.Errorf("transaction %d: %s", i, reason)
+		})
+		if err != nil {
+			t.Fatalf("Snapshots failed: %v", err)
+		}
+		for i := range txs {
+			if d := diffPlayers(snapshots[i], replayed[i]); d != "" {
+				t.Fatalf("transaction %d (%s): %s", i, txs[i].Type, d)
+			}
+		}
+	})
+}
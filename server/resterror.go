@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// restError is the JSON body of every REST error response
+type restError struct {
+	Code    string            `json:"code"` // gRPC status name, e.g. "NOT_FOUND"
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// restHTTPStatus maps gRPC codes to HTTP statuses as grpc-gateway does
+var restHTTPStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499, // Client closed request
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+}
+
+// writeRESTError sends the JSON error envelope for code
+func writeRESTError(w http.ResponseWriter, code codes.Code, message string, details map[string]string) {
+	httpStatus, ok := restHTTPStatus[code]
+	if !ok {
+		httpStatus = http.StatusInternalServerError
+	}
+	h := w.Header()
+	h.Del("Content-Encoding")
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(restError{Code: codeName(code), Message: message, Details: details})
+}
+
+// writeRESTErr sends the JSON error envelope for err, using its gRPC status when it
+// has one
+func writeRESTErr(w http.ResponseWriter, err error) {
+	message := err.Error()
+	if s, ok := status.FromError(err); ok {
+		message = s.Message()
+	}
+	writeRESTError(w, restErrorCode(err), message, nil)
+}
+
+// restErrorCode classifies err for the REST error envelope
+func restErrorCode(err error) codes.Code {
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		return s.Code()
+	}
+	var quotaErr *QuotaExceededError
+	var maintenanceErr *MaintenanceError
+	switch {
+	case errors.As(err, &quotaErr):
+		return codes.ResourceExhausted
+	case errors.As(err, &maintenanceErr):
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// codeName turns a code such as NotFound into NOT_FOUND
+func codeName(code codes.Code) string {
+	var sb strings.Builder
+	for i, r := range code.String() {
+		if i > 0 && unicode.IsUpper(r) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
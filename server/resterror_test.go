@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWriteRESTErr(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+		wantMsg    string
+	}{
+		{status.Error(codes.NotFound, "club not found"), http.StatusNotFound, "NOT_FOUND", "club not found"},
+		{status.Error(codes.InvalidArgument, "bad score"), http.StatusBadRequest, "INVALID_ARGUMENT", "bad score"},
+		{&QuotaExceededError{Resource: "players", Limit: 10}, http.StatusTooManyRequests, "RESOURCE_EXHAUSTED", ""},
+		{fmt.Errorf("write failed: %w", &MaintenanceError{}), http.StatusServiceUnavailable, "UNAVAILABLE", ""},
+		{fmt.Errorf("disk on fire"), http.StatusInternalServerError, "INTERNAL", "disk on fire"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeRESTErr(rec, tt.err)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.wantStatus, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%v: expected JSON, got %q", tt.err, ct)
+		}
+		var body restError
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%v: invalid envelope: %v", tt.err, err)
+		}
+		if body.Code != tt.wantCode {
+			t.Errorf("%v: expected code %s, got %s", tt.err, tt.wantCode, body.Code)
+		}
+		if tt.wantMsg != "" && body.Message != tt.wantMsg {
+			t.Errorf("%v: expected message %q, got %q", tt.err, tt.wantMsg, body.Message)
+		}
+	}
+}
+
+func TestWriteRESTError_Details(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeRESTError(rec, codes.NotFound, "no such endpoint", map[string]string{"path": "/api/nope"})
+
+	var body map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&body)
+	details, _ := body["details"].(map[string]interface{})
+	if rec.Code != http.StatusNotFound || details["path"] != "/api/nope" {
+		t.Errorf("unexpected envelope: %d %v", rec.Code, body)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// RestoreResult describes a truncation of the log
+type RestoreResult struct {
+	Removed    int    // Transactions dropped from the log
+	BackupPath string // Copy of the log as it was before the restore
+}
+
+// RestoreToTransaction drops every transaction after txID from the log, returning the
+// ladder to its state right after txID. The whole log is first copied to a backup
+// next to it, so the dropped transactions can still be recovered. Unlike other writes
+// this works in maintenance mode, which is the usual time to use it.
+func (m *Model) RestoreToTransaction(ctx context.Context, txID string) (*RestoreResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx := indexOfTransaction(txs, txID)
+	if idx == -1 {
+		return nil, fmt.Errorf("transaction %s not found", txID)
+	}
+	if idx == len(txs)-1 {
+		return &RestoreResult{}, nil
+	}
+
+	backup, err := m.backupLocked(m.now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up log: %v", err)
+	}
+	if err := m.rewriteLogLocked(txs[:idx+1]); err != nil {
+		return nil, err
+	}
+	return &RestoreResult{Removed: len(txs) - idx - 1, BackupPath: backup}, nil
+}
+
+// backupLocked copies the log to "<log>.backup-<time>" and returns the copy's path.
+// The caller must hold the lock.
+func (m *Model) backupLocked(now time.Time) (string, error) {
+	path := m.LogFilePath + ".backup-" + now.UTC().Format("20060102T150405Z")
+	src, err := os.Open(m.LogFilePath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, dst.Close()
+}
+
+// RestoreToTransaction truncates the log after a transaction, keeping a backup
+func (h *LadderService) RestoreToTransaction(ctx context.Context, req *ladderpb.RestoreToTransactionRequest) (*ladderpb.RestoreToTransactionResponse, error) {
+	result, err := h.modelFor(ctx).RestoreToTransaction(ctx, req.TransactionId)
+	if err != nil {
+		return &ladderpb.RestoreToTransactionResponse{Success: false}, err
+	}
+	return &ladderpb.RestoreToTransactionResponse{
+		Success:    true,
+		Removed:    int32(result.Removed),
+		BackupPath: result.BackupPath,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_RestoreToTransaction(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	txs, _, _ := m.ListTransactions(context.Background(), 1, "", nil)
+	keep := txs[0].Id
+
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	m.AddPlayer("Charlie", "charlie")
+
+	// Maintenance mode does not block a restore
+	m.maintenance.set(true, "restoring")
+	result, err := m.RestoreToTransaction(context.Background(), keep)
+	if err != nil {
+		t.Fatalf("RestoreToTransaction failed: %v", err)
+	}
+	defer os.Remove(result.BackupPath)
+	m.maintenance.set(false, "")
+
+	if result.Removed != 2 {
+		t.Errorf("expected 2 transactions removed, got %d", result.Removed)
+	}
+	players := m.ListPlayers()
+	if len(players) != 2 || players[0].Id != "alice" {
+		t.Errorf("expected the ladder from before the match, got %v", players)
+	}
+
+	backup, err := NewModel(result.BackupPath)
+	if err != nil {
+		t.Fatalf("failed to open backup: %v", err)
+	}
+	defer backup.Close()
+	if n := len(backup.ListPlayers()); n != 3 {
+		t.Errorf("expected the backup to hold all 3 players, got %d", n)
+	}
+
+	// New writes continue from the restored point
+	if _, err := m.AddPlayer("Dave", "dave"); err != nil {
+		t.Fatalf("AddPlayer after restore failed: %v", err)
+	}
+	if players := m.ListPlayers(); len(players) != 3 || players[2].Id != "dave" {
+		t.Errorf("unexpected ladder after restore: %v", players)
+	}
+
+	if _, err := m.RestoreToTransaction(context.Background(), "nope"); err == nil {
+		t.Error("expected an error for an unknown transaction")
+	}
+}
@@ -0,0 +1,383 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// defaultResultLinkTTL is how long a court-side result link stays valid
+	defaultResultLinkTTL = 2 * time.Hour
+	resultLinkPath       = "/r/"
+	qrModuleScale        = 8
+)
+
+// ResultLinks issues signed, short-lived URLs for a single fixture that open a
+// pre-filled result form, so players can record results from their phones
+// without logging in. Each link can be used to record one result.
+type ResultLinks struct {
+	service    *LadderService
+	clubs      *ClubRegistry
+	tokens     signedTokens
+	ttl        time.Duration
+	publicURL  string
+	adminToken string
+
+	mu   sync.Mutex
+	used map[string]time.Time // Submitted tokens, kept until they expire
+}
+
+// resultLinkClaims is the signed payload of a result link
+type resultLinkClaims struct {
+	ClubID       string `json:"c,omitempty"`
+	ChallengerID string `json:"ch"`
+	DefenderID   string `json:"d"`
+	IssuedMs     int64  `json:"i,omitempty"`
+	ExpiresMs    int64  `json:"e"`
+}
+
+func (c *resultLinkClaims) expiresMs() int64 { return c.ExpiresMs }
+
+// NewResultLinks creates a link issuer. publicURL is the externally visible base URL
+// of the server; when empty it is derived from each request's Host header. clock
+// should be the ladder's clock; nil uses the system clock.
+func NewResultLinks(service *LadderService, clubs *ClubRegistry, secret string, clock Clock, ttl time.Duration, publicURL, adminToken string) *ResultLinks {
+	if ttl <= 0 {
+		ttl = defaultResultLinkTTL
+	}
+	return &ResultLinks{
+		service:    service,
+		clubs:      clubs,
+		tokens:     signedTokens{secret: []byte(secret), domain: "result-link", noun: "link", clock: clock},
+		ttl:        ttl,
+		publicURL:  strings.TrimSuffix(publicURL, "/"),
+		adminToken: adminToken,
+		used:       make(map[string]time.Time),
+	}
+}
+
+// Sign returns a URL-safe token carrying the claims
+func (l *ResultLinks) Sign(claims resultLinkClaims) string {
+	return l.tokens.sign(&claims)
+}
+
+// Verify checks a token's signature and expiry and returns its claims
+func (l *ResultLinks) Verify(token string) (*resultLinkClaims, error) {
+	var claims resultLinkClaims
+	if err := l.tokens.verify(token, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// ServeHTTP routes the link API, the QR code image and the result form
+func (l *ResultLinks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/api/result-links" && r.Method == "POST":
+		l.createLink(w, r)
+	case r.URL.Path == "/api/result-links/qr.png" && r.Method == "GET":
+		l.serveQR(w, r)
+	case strings.HasPrefix(r.URL.Path, resultLinkPath):
+		l.serveForm(w, r, strings.TrimPrefix(r.URL.Path, resultLinkPath))
+	default:
+		writeRESTError(w, codes.NotFound, "not found", map[string]string{"path": r.URL.Path})
+	}
+}
+
+// createLink issues a link for ?challenger=&defender= (and optionally &club=). Admin only.
+func (l *ResultLinks) createLink(w http.ResponseWriter, r *http.Request) {
+	if l.adminToken == "" || !hasBearerHeader(r, l.adminToken) {
+		writeRESTError(w, codes.Unauthenticated, "admin token required", nil)
+		return
+	}
+
+	q := r.URL.Query()
+	now := l.tokens.now()
+	claims := resultLinkClaims{
+		ClubID:       q.Get("club"),
+		ChallengerID: q.Get("challenger"),
+		DefenderID:   q.Get("defender"),
+		IssuedMs:     now.UnixMilli(),
+		ExpiresMs:    now.Add(l.ttl).UnixMilli(),
+	}
+	if claims.ChallengerID == "" || claims.DefenderID == "" || claims.ChallengerID == claims.DefenderID {
+		writeRESTError(w, codes.InvalidArgument, "challenger and defender must be two different players", nil)
+		return
+	}
+
+	ctx, err := l.clubContext(r.Context(), claims.ClubID)
+	if err != nil {
+		writeRESTError(w, codes.NotFound, err.Error(), map[string]string{"club": claims.ClubID})
+		return
+	}
+	players, err := l.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		writeRESTErr(w, err)
+		return
+	}
+	if findPlayer(players.Players, claims.ChallengerID) == nil || findPlayer(players.Players, claims.DefenderID) == nil {
+		writeRESTError(w, codes.NotFound, "player not found", map[string]string{"challenger": claims.ChallengerID, "defender": claims.DefenderID})
+		return
+	}
+
+	token := l.Sign(claims)
+	base := l.baseURL(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resultLinkResponse{
+		URL:       base + resultLinkPath + token,
+		QRURL:     base + "/api/result-links/qr.png?token=" + token,
+		ExpiresMs: claims.ExpiresMs,
+	})
+}
+
+// resultLinkResponse is the JSON body of a created link
+type resultLinkResponse struct {
+	URL       string `json:"url"`
+	QRURL     string `json:"qr_url"`
+	ExpiresMs int64  `json:"expires_ms"`
+}
+
+// serveQR renders the link for ?token= as a PNG QR code
+func (l *ResultLinks) serveQR(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if _, err := l.Verify(token); err != nil {
+		writeRESTError(w, codes.PermissionDenied, err.Error(), nil)
+		return
+	}
+	code, err := EncodeQR([]byte(l.baseURL(r) + resultLinkPath + token))
+	if err != nil {
+		writeRESTErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := code.WritePNG(w, qrModuleScale); err != nil {
+		log.Printf("failed to write QR code: %v", err)
+	}
+}
+
+var resultFormTemplate = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Record result</title>
+<style>
+  body { font-family: sans-serif; max-width: 28em; margin: 1em auto; padding: 0 1em; font-size: 1.2em; }
+  input[type=number] { width: 4em; font-size: 1.2em; }
+  button { font-size: 1.2em; padding: 0.4em 1.2em; margin-top: 1em; }
+  .error { color: #b00; }
+  td { padding: 0.2em 0.5em; }
+</style>
+</head>
+<body>
+{{if .Done}}<h1>Result recorded</h1>
+<p>{{.Message}}</p>
+{{else}}<h1>{{.Challenger}} v {{.Defender}}</h1>
+{{if .Message}}<p class="error">{{.Message}}</p>{{end}}
+<form method="post">
+<table>
+<tr><th></th><th>{{.Challenger}}</th><th>{{.Defender}}</th></tr>
+{{range .Sets}}<tr><td>Game {{.}}</td><td><input type="number" min="0" name="c{{.}}"></td><td><input type="number" min="0" name="d{{.}}"></td></tr>
+{{end}}</table>
+<button type="submit">Record result</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// serveForm shows the pre-filled form for a link and records the submitted result
+func (l *ResultLinks) serveForm(w http.ResponseWriter, r *http.Request, token string) {
+	claims, err := l.Verify(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx, err := l.clubContext(r.Context(), claims.ClubID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	model := l.service.modelFor(ctx)
+
+	// The used set is lost on restart, so also look for a result recorded since
+	// the link was issued
+	used := l.isUsed(token)
+	if !used {
+		if used, err = model.MatchRecordedSince(claims.ChallengerID, claims.DefenderID, l.issuedMs(claims)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if used {
+		http.Error(w, "a result has already been recorded with this link", http.StatusGone)
+		return
+	}
+	players := model.ListPlayers()
+	challenger, defender := findPlayer(players, claims.ChallengerID), findPlayer(players, claims.DefenderID)
+	if challenger == nil || defender == nil {
+		http.Error(w, "player not found", http.StatusNotFound)
+		return
+	}
+	rules, err := model.GetLadderRules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setsToWin, _ := scoringFormatRules(rules.ScoringFormat)
+
+	page := struct {
+		Challenger, Defender string
+		Sets                 []int
+		Message              string
+		Done                 bool
+	}{Challenger: challenger.Name, Defender: defender.Name}
+	for i := 1; i <= 2*setsToWin-1; i++ {
+		page.Sets = append(page.Sets, i)
+	}
+
+	if r.Method == "POST" {
+		page.Message, page.Done = l.submit(ctx, r, token, claims, page.Sets, players, rules.ScoringFormat)
+		if page.Done {
+			page.Message = fmt.Sprintf("%s. Thanks!", page.Message)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := resultFormTemplate.Execute(w, page); err != nil {
+		log.Printf("failed to render result form: %v", err)
+	}
+}
+
+// submit records the posted scores and returns a message and whether it succeeded
+func (l *ResultLinks) submit(ctx context.Context, r *http.Request, token string, claims *resultLinkClaims, sets []int, players []*ladderpb.Player, format ladderpb.ScoringFormat) (string, bool) {
+	if err := r.ParseForm(); err != nil {
+		return "Could not read the form.", false
+	}
+	var scores []*ladderpb.SetScore
+	for _, i := range sets {
+		c, d := r.PostForm.Get(fmt.Sprintf("c%d", i)), r.PostForm.Get(fmt.Sprintf("d%d", i))
+		if c == "" && d == "" {
+			continue
+		}
+		cp, err1 := strconv.Atoi(c)
+		dp, err2 := strconv.Atoi(d)
+		if err1 != nil || err2 != nil {
+			return fmt.Sprintf("Game %d needs a score for both players.", i), false
+		}
+		scores = append(scores, &ladderpb.SetScore{ChallengerPoints: int32(cp), DefenderPoints: int32(dp)})
+	}
+
+	challengerStart, defenderStart := handicapStarts(players, claims.ChallengerID, claims.DefenderID)
+	winnerIdx, err := ValidateScoreHandicap(scores, format, challengerStart, defenderStart)
+	if err != nil {
+		return fmt.Sprintf("Invalid score: %v", err), false
+	}
+	winner := claims.ChallengerID
+	if winnerIdx == 2 {
+		winner = claims.DefenderID
+	}
+
+	// Claim the token before writing so a double tap cannot record the result twice
+	if !l.markUsed(token, claims.ExpiresMs) {
+		return "A result has already been recorded with this link.", false
+	}
+	ctx = l.service.clientContext(ctx, clientResultLink, "", remoteHost(r))
+	_, err = l.service.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+		ChallengerId: claims.ChallengerID,
+		DefenderId:   claims.DefenderID,
+		WinnerId:     winner,
+		SetScores:    scores,
+	})
+	if err != nil {
+		l.unmarkUsed(token)
+		return fmt.Sprintf("Could not record result: %v", err), false
+	}
+	return fmt.Sprintf("%s won", findPlayer(players, winner).Name), true
+}
+
+// issuedMs returns when a link was issued. Links issued before the claim existed
+// are taken to have been issued one TTL before they expire.
+func (l *ResultLinks) issuedMs(claims *resultLinkClaims) int64 {
+	if claims.IssuedMs != 0 {
+		return claims.IssuedMs
+	}
+	return claims.ExpiresMs - l.ttl.Milliseconds()
+}
+
+func (l *ResultLinks) isUsed(token string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.used[token]
+	return ok
+}
+
+func (l *ResultLinks) markUsed(token string, expiresMs int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.tokens.now()
+	for t, exp := range l.used {
+		if now.After(exp) {
+			delete(l.used, t)
+		}
+	}
+	if _, ok := l.used[token]; ok {
+		return false
+	}
+	l.used[token] = time.UnixMilli(expiresMs)
+	return true
+}
+
+func (l *ResultLinks) unmarkUsed(token string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.used, token)
+}
+
+func (l *ResultLinks) clubContext(ctx context.Context, clubID string) (context.Context, error) {
+	if clubID == "" {
+		return ctx, nil
+	}
+	if l.clubs == nil {
+		return nil, fmt.Errorf("multi-club mode is not enabled")
+	}
+	m, err := l.clubs.Model(clubID)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, clubModelKey{}, m), nil
+}
+
+func (l *ResultLinks) baseURL(r *http.Request) string {
+	if l.publicURL != "" {
+		return l.publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func findPlayer(players []*ladderpb.Player, id string) *ladderpb.Player {
+	for _, p := range players {
+		if p.Id == id {
+			return p
+		}
+	}
+	return nil
+}
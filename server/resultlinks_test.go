@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultLinks_SignVerify(t *testing.T) {
+	l := NewResultLinks(nil, nil, "secret", nil, 0, "", "")
+	claims := resultLinkClaims{ChallengerID: "bob", DefenderID: "alice", ExpiresMs: time.Now().Add(time.Hour).UnixMilli()}
+	token := l.Sign(claims)
+
+	got, err := l.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if *got != claims {
+		t.Errorf("got claims %+v, want %+v", got, claims)
+	}
+
+	if _, err := NewResultLinks(nil, nil, "other", nil, 0, "", "").Verify(token); err == nil {
+		t.Error("expected error for token signed with another secret")
+	}
+	if _, err := l.Verify(token[:len(token)-2]); err == nil {
+		t.Error("expected error for tampered token")
+	}
+	expired := l.Sign(resultLinkClaims{ChallengerID: "bob", DefenderID: "alice", ExpiresMs: time.Now().Add(-time.Minute).UnixMilli()})
+	if _, err := l.Verify(expired); err == nil {
+		t.Error("expected error for expired token")
+	}
+}
+
+func TestResultLinks_Flow(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	l := NewResultLinks(NewLadderService(m), nil, "secret", nil, time.Hour, "https://ladder.example.org", "admin")
+
+	// Issuing links requires the admin token
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest("POST", "/api/result-links?challenger=bob&defender=alice", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/api/result-links?challenger=bob&defender=alice", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var link struct {
+		URL   string `json:"url"`
+		QRURL string `json:"qr_url"`
+	}
+	json.NewDecoder(rec.Body).Decode(&link)
+	if !strings.HasPrefix(link.URL, "https://ladder.example.org/r/") {
+		t.Fatalf("unexpected link URL: %s", link.URL)
+	}
+	formPath := strings.TrimPrefix(link.URL, "https://ladder.example.org")
+
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest("GET", strings.TrimPrefix(link.QRURL, "https://ladder.example.org"), nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expected PNG QR code, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest("GET", formPath, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Bob v Alice") {
+		t.Fatalf("unexpected form: %d %s", rec.Code, rec.Body.String())
+	}
+
+	post := func() *httptest.ResponseRecorder {
+		form := url.Values{"c1": {"11"}, "d1": {"5"}, "c2": {"11"}, "d2": {"7"}, "c3": {"11"}, "d3": {"3"}}
+		req := httptest.NewRequest("POST", formPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(); !strings.Contains(rec.Body.String(), "Bob won") {
+		t.Fatalf("unexpected submission response: %s", rec.Body.String())
+	}
+	if m.ListPlayers()[0].Id != "bob" {
+		t.Error("Bob should be #1 after the result")
+	}
+
+	// Links are single use
+	if rec := post(); rec.Code != http.StatusGone {
+		t.Errorf("expected 410 on reuse, got %d", rec.Code)
+	}
+}
+
+func TestResultLinks_SingleUseAcrossRestartsAndExpiry(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	clock := NewSteppingClock(time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC), time.Second)
+	m.SetClock(clock)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	l := NewResultLinks(NewLadderService(m), nil, "secret", clock, time.Hour, "", "admin")
+	issue := func() string {
+		req := httptest.NewRequest("POST", "/api/result-links?challenger=bob&defender=alice", nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, req)
+		var link struct {
+			URL string `json:"url"`
+		}
+		json.NewDecoder(rec.Body).Decode(&link)
+		return strings.TrimPrefix(link.URL, "http://example.com")
+	}
+	post := func(l *ResultLinks, formPath string) *httptest.ResponseRecorder {
+		form := url.Values{"c1": {"11"}, "d1": {"5"}, "c2": {"11"}, "d2": {"7"}, "c3": {"11"}, "d3": {"3"}}
+		req := httptest.NewRequest("POST", formPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, req)
+		return rec
+	}
+
+	formPath := issue()
+	if rec := post(l, formPath); !strings.Contains(rec.Body.String(), "Bob won") {
+		t.Fatalf("unexpected submission response: %s", rec.Body.String())
+	}
+
+	// A restarted server has forgotten the used set but finds the result in the log
+	restarted := NewResultLinks(NewLadderService(m), nil, "secret", clock, time.Hour, "", "admin")
+	if rec := post(restarted, formPath); rec.Code != http.StatusGone {
+		t.Errorf("expected 410 on reuse after restart, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A link issued after that result is still usable, until the ladder's clock
+	// passes its expiry
+	formPath = issue()
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest("GET", formPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a fresh link to open, got %d: %s", rec.Code, rec.Body.String())
+	}
+	clock.Set(time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC))
+	if rec := post(l, formPath); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "expired") {
+		t.Errorf("expected the link to have expired, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
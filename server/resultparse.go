@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	setScoreToken = regexp.MustCompile(`^(\d+)-(\d+)$`)
+	spacedDash    = regexp.MustCompile(`\s*-\s*`)
+)
+
+// parseResultText turns "Bob beat Alice 11-5 11-7 11-3" into a match request for the
+// given ladder. Scores are given winner first and converted to the challenger's
+// perspective; the challenger is whichever player is currently ranked lower. Names may
+// be prefixed with "@". A sets-only score such as "3-1" is refused, as the points of
+// each set are needed.
+func parseResultText(players []*ladderpb.Player, text string) (*ladderpb.AddMatchResultRequest, string, error) {
+	lower := strings.ToLower(text)
+	idx := strings.Index(lower, " beat ")
+	if idx == -1 {
+		return nil, "", fmt.Errorf("expected '<winner> beat <loser>'")
+	}
+	winnerName := strings.TrimPrefix(strings.TrimSpace(text[:idx]), "@")
+
+	rest := strings.Fields(strings.ReplaceAll(text[idx+len(" beat "):], ",", " "))
+	var scores [][2]int32
+	for len(rest) > 0 {
+		m := setScoreToken.FindStringSubmatch(rest[len(rest)-1])
+		if m == nil {
+			break
+		}
+		w, _ := strconv.Atoi(m[1])
+		l, _ := strconv.Atoi(m[2])
+		scores = append([][2]int32{{int32(w), int32(l)}}, scores...)
+		rest = rest[:len(rest)-1]
+	}
+	loserName := strings.TrimPrefix(strings.Join(rest, " "), "@")
+	if len(scores) == 0 {
+		return nil, "", fmt.Errorf("no set scores found")
+	}
+	if len(scores) == 1 && scores[0][0] <= 3 && scores[0][1] < scores[0][0] {
+		return nil, "", fmt.Errorf("please give the points of each set, e.g. 11-5 11-7 11-3, not just the sets won")
+	}
+
+	winner, err := findPlayerByName(players, winnerName)
+	if err != nil {
+		return nil, "", err
+	}
+	loser, err := findPlayerByName(players, loserName)
+	if err != nil {
+		return nil, "", err
+	}
+	if winner.Id == loser.Id {
+		return nil, "", fmt.Errorf("winner and loser are the same player")
+	}
+
+	challenger, defender := winner, loser
+	if winner.Rank < loser.Rank {
+		challenger, defender = loser, winner
+	}
+
+	req := &ladderpb.AddMatchResultRequest{
+		ChallengerId: challenger.Id,
+		DefenderId:   defender.Id,
+		WinnerId:     winner.Id,
+	}
+	for _, s := range scores {
+		set := &ladderpb.SetScore{ChallengerPoints: s[0], DefenderPoints: s[1]}
+		if challenger.Id != winner.Id {
+			set.ChallengerPoints, set.DefenderPoints = s[1], s[0]
+		}
+		req.SetScores = append(req.SetScores, set)
+	}
+
+	summary := fmt.Sprintf("%s beat %s %s", winner.Name, loser.Name, formatWinnerScores(scores))
+	return req, summary, nil
+}
+
+// parseScoresString turns "11-5, 9-11, 11-7" into set scores, challenger first. Sets
+// may be separated by commas or spaces.
+func parseScoresString(text string) ([]*ladderpb.SetScore, error) {
+	text = spacedDash.ReplaceAllString(strings.ReplaceAll(text, ",", " "), "-")
+	var scores []*ladderpb.SetScore
+	for _, token := range strings.Fields(text) {
+		m := setScoreToken.FindStringSubmatch(token)
+		if m == nil {
+			return nil, localizedStatusf(codes.InvalidArgument, "invalid set score %q; expected e.g. 11-5", token)
+		}
+		c, err := strconv.ParseInt(m[1], 10, 32)
+		if err != nil {
+			return nil, localizedStatusf(codes.InvalidArgument, "invalid set score %q; expected e.g. 11-5", token)
+		}
+		d, err := strconv.ParseInt(m[2], 10, 32)
+		if err != nil {
+			return nil, localizedStatusf(codes.InvalidArgument, "invalid set score %q; expected e.g. 11-5", token)
+		}
+		scores = append(scores, &ladderpb.SetScore{ChallengerPoints: int32(c), DefenderPoints: int32(d)})
+	}
+	if len(scores) == 0 {
+		return nil, localizedStatusf(codes.InvalidArgument, "no set scores found")
+	}
+	return scores, nil
+}
+
+func formatWinnerScores(scores [][2]int32) string {
+	parts := make([]string, len(scores))
+	for i, s := range scores {
+		parts[i] = fmt.Sprintf("%d-%d", s[0], s[1])
+	}
+	return strings.Join(parts, " ")
+}
+
+// findPlayerByName matches a full name case-insensitively, falling back to a unique
+// first-name match
+func findPlayerByName(players []*ladderpb.Player, name string) (*ladderpb.Player, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing player name")
+	}
+
+	var firstNameMatches []*ladderpb.Player
+	for _, p := range players {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+		if fields := strings.Fields(p.Name); len(fields) > 0 && strings.EqualFold(fields[0], name) {
+			firstNameMatches = append(firstNameMatches, p)
+		}
+	}
+
+	switch len(firstNameMatches) {
+	case 0:
+		return nil, fmt.Errorf("no player named %q", name)
+	case 1:
+		return firstNameMatches[0], nil
+	}
+	return nil, fmt.Errorf("%q matches several players, use the full name", name)
+}
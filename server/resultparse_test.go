@@ -0,0 +1,62 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestParseResultText(t *testing.T) {
+	players := []*ladderpb.Player{
+		{Id: "alice", Name: "Alice Jones", Rank: 1},
+		{Id: "bob", Name: "Bob Smith", Rank: 2},
+		{Id: "bobby", Name: "Bob Brown", Rank: 3},
+	}
+	tests := []struct {
+		text       string
+		challenger string
+		winner     string
+		sets       string // Challenger first
+		summary    string
+		wantErr    string
+	}{
+		{
+			text:       "Bob Smith beat Alice 11-5 9-11 11-7 11-3",
+			challenger: "bob", winner: "bob", sets: "11-5 9-11 11-7 11-3",
+			summary: "Bob Smith beat Alice Jones 11-5 9-11 11-7 11-3",
+		},
+		{
+			text:       "@alice beat @Bob Smith 11-5, 11-7, 11-3",
+			challenger: "bob", winner: "alice", sets: "5-11 7-11 3-11",
+			summary: "Alice Jones beat Bob Smith 11-5 11-7 11-3",
+		},
+		{text: "Bob Smith beat Alice 3-1", wantErr: "points of each set"},
+		{text: "Bob Smith beat Alice 2-0", wantErr: "points of each set"},
+		{text: "Bob Smith and Alice 11-5 11-5 11-5", wantErr: "expected '<winner> beat <loser>'"},
+		{text: "Bob Smith beat Alice", wantErr: "no set scores found"},
+		{text: "Bob beat Alice 11-5 11-5 11-5", wantErr: "matches several players"},
+		{text: "Zed beat Alice 11-5 11-5 11-5", wantErr: `no player named "Zed"`},
+		{text: "Alice beat Alice Jones 11-5 11-5 11-5", wantErr: "same player"},
+	}
+	for _, tt := range tests {
+		req, summary, err := parseResultText(players, tt.text)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: expected an error containing %q, got %v", tt.text, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.text, err)
+			continue
+		}
+		sets := make([]string, len(req.SetScores))
+		for i, s := range req.SetScores {
+			sets[i] = formatWinnerScores([][2]int32{{s.ChallengerPoints, s.DefenderPoints}})
+		}
+		if req.ChallengerId != tt.challenger || req.WinnerId != tt.winner || strings.Join(sets, " ") != tt.sets || summary != tt.summary {
+			t.Errorf("%q: got challenger %s, winner %s, sets %v, summary %q", tt.text, req.ChallengerId, req.WinnerId, sets, summary)
+		}
+	}
+}
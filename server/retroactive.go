@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+// InsertMatchResultAt records a match played at playedAt so that it takes effect on
+// the ladder at its place in the history: before the first transaction that took
+// effect after playedAt. The ladder is replayed from there, so results recorded
+// since may move players differently. If nothing took effect after playedAt the
+// match is recorded as AddMatchResultAt would.
+func (m *Model) InsertMatchResultAt(ctx context.Context, challengerID, defenderID, winnerID string, setScores []*ladderpb.SetScore, playedAt time.Time, late bool) (string, error) {
+	if winnerID != challengerID && winnerID != defenderID {
+		return "", localizedErrorf("winner must be one of the players")
+	}
+	if playedAt.IsZero() {
+		return "", localizedErrorf("retroactive_insert needs played_at")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return "", err
+	}
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+	order, err := replay.Order(txs, invalidated)
+	if err != nil {
+		return "", err
+	}
+	var before string
+	for _, t := range order {
+		if effectiveAtMs(t) > playedAt.UnixMilli() {
+			before = t.Id
+			break
+		}
+	}
+	if before == "" {
+		return m.addMatchResultLocked(challengerID, defenderID, winnerID, setScores, playedAt, late, false)
+	}
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", err
+	}
+	payload := matchPayload(currentPlayers, challengerID, defenderID, winnerID, setScores, playedAt, late)
+	payload.InsertBeforeId = before
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_RETROACTIVE_MATCH,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_MatchResultPayload{MatchResultPayload: payload},
+	}
+
+	newPlayers, err := replay.Replay(ctx, []*ladderpb.Player{}, append(txs, tx), invalidated)
+	if err := contextErr(ctx); err != nil {
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+	tx.PlayerList = ladderToStorage(newPlayers)
+
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	if err := m.placeQualifiedLocked(newPlayers, challengerID, defenderID); err != nil {
+		log.Printf("Failed to place qualified players: %v", err)
+	}
+	return tx.Id, nil
+}
+
+// effectiveAtMs is when a transaction happened: when its match was played, or
+// otherwise when it was recorded
+func effectiveAtMs(t *storagepb.TransactionStorage) int64 {
+	if t.GetMatchResultPayload() != nil {
+		return playedAtMs(t)
+	}
+	return t.TimestampMs
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+func TestModel_InsertMatchResultAt(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+	start := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	m.SetClock(NewSteppingClock(start, time.Minute))
+	ctx := context.Background()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	laterID, _ := m.AddMatchResult("carol", "bob", "carol", threeLove)
+	assertOrder(t, m, "alice", "carol", "bob")
+	later, err := m.GetTransaction(ctx, laterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob beat Alice before Carol beat him, so Carol takes first place from him
+	playedAt := time.UnixMilli(later.Summary.TimestampMs).Add(-time.Second)
+	txID, err := m.InsertMatchResultAt(ctx, "bob", "alice", "bob", threeLove, playedAt, false)
+	if err != nil {
+		t.Fatalf("InsertMatchResultAt failed: %v", err)
+	}
+	assertOrder(t, m, "carol", "bob", "alice")
+
+	inserted, err := m.GetTransaction(ctx, txID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted.Summary.Type != storagepb.TransactionType_RETROACTIVE_MATCH.String() || !inserted.Match.Retroactive {
+		t.Errorf("expected a retroactive match, got %v", inserted.Summary)
+	}
+	if report, err := m.VerifyLog(ctx, false); err != nil || !report.OK() {
+		t.Errorf("expected the log to replay cleanly, got %+v, %v", report, err)
+	}
+
+	// Invalidating the later match keeps the inserted one where it was put
+	if err := m.InvalidateMatchResult(ctx, laterID); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "bob", "alice", "carol")
+	if err := m.InvalidateMatchResult(ctx, txID); err != nil {
+		t.Fatalf("InvalidateMatchResult failed: %v", err)
+	}
+	assertOrder(t, m, "alice", "bob", "carol")
+	if report, err := m.VerifyLog(ctx, false); err != nil || !report.OK() {
+		t.Errorf("expected the log to replay cleanly, got %+v, %v", report, err)
+	}
+
+	// Nothing took effect after a match played now, so it is simply appended
+	txID, err = m.InsertMatchResultAt(ctx, "carol", "alice", "carol", threeLove, m.now(), false)
+	if err != nil {
+		t.Fatalf("InsertMatchResultAt failed: %v", err)
+	}
+	if appended, _ := m.GetTransaction(ctx, txID); appended.Summary.Type != storagepb.TransactionType_MATCH_RESULT.String() {
+		t.Errorf("expected an ordinary match result, got %v", appended.Summary)
+	}
+	assertOrder(t, m, "carol", "alice", "bob")
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rpcLatencyBuckets are the upper bounds, in seconds, of the RPC latency histograms.
+// They run from a cached read to the default RPC timeout.
+var rpcLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 15}
+
+// methodMetrics holds the metrics of one RPC
+type methodMetrics struct {
+	inFlight int64
+	buckets  []uint64 // Counts per bucket, not cumulative
+	count    uint64
+	sum      float64
+	codes    map[codes.Code]uint64
+}
+
+// RPCMetrics records per-RPC latency histograms, in-flight gauges and response code
+// counters through a single interceptor, and serves them at /metrics in the
+// Prometheus text format
+type RPCMetrics struct {
+	mu      sync.Mutex
+	methods map[string]*methodMetrics
+}
+
+// NewRPCMetrics creates an empty set of RPC metrics
+func NewRPCMetrics() *RPCMetrics {
+	return &RPCMetrics{methods: make(map[string]*methodMetrics)}
+}
+
+// methodLocked returns the metrics of a method, creating them on first use. The caller
+// must hold r.mu.
+func (r *RPCMetrics) methodLocked(method string) *methodMetrics {
+	m := r.methods[method]
+	if m == nil {
+		m = &methodMetrics{buckets: make([]uint64, len(rpcLatencyBuckets)), codes: make(map[codes.Code]uint64)}
+		r.methods[method] = m
+	}
+	return m
+}
+
+// unaryInterceptor times every RPC. It runs first, so rejected calls and timeouts are
+// counted too.
+func (r *RPCMetrics) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		r.mu.Lock()
+		r.methodLocked(info.FullMethod).inFlight++
+		r.mu.Unlock()
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		r.observe(info.FullMethod, time.Since(start), status.Code(err))
+		return resp, err
+	}
+}
+
+// observe records a finished RPC
+func (r *RPCMetrics) observe(method string, d time.Duration, code codes.Code) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.methodLocked(method)
+	m.inFlight--
+	m.count++
+	m.sum += d.Seconds()
+	m.codes[code]++
+	for i, le := range rpcLatencyBuckets {
+		if d.Seconds() <= le {
+			m.buckets[i]++
+			break
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (r *RPCMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.methods))
+	for name := range r.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# HELP ladder_rpc_duration_seconds Time taken by RPCs, rejected ones included.\n")
+	b.WriteString("# TYPE ladder_rpc_duration_seconds histogram\n")
+	for _, name := range names {
+		m, labels := r.methods[name], rpcLabels(name)
+		var cumulative uint64
+		for i, le := range rpcLatencyBuckets {
+			cumulative += m.buckets[i]
+			fmt.Fprintf(&b, "ladder_rpc_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&b, "ladder_rpc_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, m.count)
+		fmt.Fprintf(&b, "ladder_rpc_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(m.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "ladder_rpc_duration_seconds_count{%s} %d\n", labels, m.count)
+	}
+
+	b.WriteString("# HELP ladder_rpc_in_flight RPCs being handled.\n")
+	b.WriteString("# TYPE ladder_rpc_in_flight gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "ladder_rpc_in_flight{%s} %d\n", rpcLabels(name), r.methods[name].inFlight)
+	}
+
+	b.WriteString("# HELP ladder_rpc_responses_total RPCs finished, by status code.\n")
+	b.WriteString("# TYPE ladder_rpc_responses_total counter\n")
+	for _, name := range names {
+		m := r.methods[name]
+		codeList := make([]codes.Code, 0, len(m.codes))
+		for c := range m.codes {
+			codeList = append(codeList, c)
+		}
+		sort.Slice(codeList, func(i, j int) bool { return codeList[i] < codeList[j] })
+		for _, c := range codeList {
+			fmt.Fprintf(&b, "ladder_rpc_responses_total{%s,code=\"%s\"} %d\n", rpcLabels(name), c, m.codes[c])
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// rpcLabels turns "/ladder.LadderService/AddPlayer" into its service and method labels
+func rpcLabels(fullMethod string) string {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return fmt.Sprintf("service=%q,method=%q", service, method)
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRPCMetrics(t *testing.T) {
+	metrics := NewRPCMetrics()
+	intercept := metrics.unaryInterceptor()
+	call := func(method string, err error) {
+		intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				// The call is in flight while its handler runs
+				rec := httptest.NewRecorder()
+				metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+				if !strings.Contains(rec.Body.String(), "ladder_rpc_in_flight{"+rpcLabels(method)+"} 1\n") {
+					t.Errorf("expected %s to be in flight", method)
+				}
+				return nil, err
+			})
+	}
+	call("/ladder.LadderService/ListPlayers", nil)
+	call("/ladder.LadderService/ListPlayers", nil)
+	call("/ladder.LadderService/AddPlayer", status.Error(codes.Unauthenticated, "admin token required"))
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE ladder_rpc_duration_seconds histogram\n",
+		`ladder_rpc_duration_seconds_bucket{service="ladder.LadderService",method="ListPlayers",le="+Inf"} 2` + "\n",
+		`ladder_rpc_duration_seconds_count{service="ladder.LadderService",method="ListPlayers"} 2` + "\n",
+		`ladder_rpc_in_flight{service="ladder.LadderService",method="ListPlayers"} 0` + "\n",
+		`ladder_rpc_responses_total{service="ladder.LadderService",method="ListPlayers",code="OK"} 2` + "\n",
+		`ladder_rpc_responses_total{service="ladder.LadderService",method="AddPlayer",code="Unauthenticated"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
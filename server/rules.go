@@ -0,0 +1,247 @@
+package server
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultLadderRules are in effect until the first RULES_CHANGE transaction
+func DefaultLadderRules() *ladderpb.LadderRules {
+	return &ladderpb.LadderRules{
+		ChallengeWindow:      3,
+		ResponseDeadlineDays: 14,
+		ScoringFormat:        ladderpb.ScoringFormat_BEST_OF_5_PAR_11,
+		DecayPolicy:          ladderpb.DecayPolicy_DECAY_NONE,
+		LeaguePoints:         DefaultLeaguePoints(),
+	}
+}
+
+// GetLadderRules returns the rule set in effect at the end of the log
+func (m *Model) GetLadderRules() (*ladderpb.LadderRules, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules, err := m.currentRulesLocked()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(rules).(*ladderpb.LadderRules), nil
+}
+
+// currentRulesLocked returns the rules in effect at the end of the log, from the cache
+// when it is current. They are shared, so the caller must not change them. The caller
+// must hold m.mu.
+func (m *Model) currentRulesLocked() (*ladderpb.LadderRules, error) {
+	if rules := m.rules.get(m.LogFilePath); rules != nil {
+		return rules, nil
+	}
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	rules := rulesAt(txs, len(txs))
+	m.rules.set(m.LogFilePath, rules)
+	return rules, nil
+}
+
+// rulesCache holds the rules in effect at the end of the log, as they are checked on
+// every result and reading them means reading the whole log. Like the match index it
+// follows appends by size, and is dropped by a transaction that may change the rules
+// or when the log on disk no longer has the size it expects.
+type rulesCache struct {
+	mu    sync.Mutex
+	rules *ladderpb.LadderRules // nil until read
+	size  int64                 // Bytes of the log the rules hold for
+}
+
+func (c *rulesCache) get(path string) *ladderpb.LadderRules {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rules == nil {
+		return nil
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != c.size {
+		c.rules = nil
+	}
+	return c.rules
+}
+
+// set caches rules read from the log as it is now. The caller must hold the model's
+// lock, so that nothing is appended in between.
+func (c *rulesCache) set(path string, rules *ladderpb.LadderRules) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules, c.size = rules, info.Size()
+}
+
+// appended follows a transaction of n bytes just written to the end of the log
+func (c *rulesCache) appended(tx *storagepb.TransactionStorage, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tx.GetRulesChangePayload() != nil || tx.GetInvalidateMatchPayload() != nil {
+		c.rules = nil
+		return
+	}
+	c.size += int64(n)
+}
+
+func (c *rulesCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = nil
+}
+
+// SetLadderRules validates and records a new rule set, returning the transaction ID
+func (m *Model) SetLadderRules(rules *ladderpb.LadderRules) (string, error) {
+	if err := validateLadderRules(rules); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", err
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_RULES_CHANGE,
+		TimestampMs: m.now().UnixMilli(),
+		Payload: &storagepb.TransactionStorage_RulesChangePayload{RulesChangePayload: &storagepb.RulesChangeStorage{
+			Rules: rulesToStorage(rules),
+		}},
+		PlayerList: ladderToStorage(currentPlayers),
+	}
+
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	m.promoteWaitingLocked()
+	return tx.Id, nil
+}
+
+// rulesAt returns the rules in effect before the transaction at position end,
+// ignoring rule changes that were later invalidated
+func rulesAt(txs []*storagepb.TransactionStorage, end int) *ladderpb.LadderRules {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	for i := end - 1; i >= 0; i-- {
+		if rc := txs[i].GetRulesChangePayload(); rc != nil && !invalidated[txs[i].Id] {
+			return rulesFromStorage(rc.Rules)
+		}
+	}
+	return DefaultLadderRules()
+}
+
+func validateLadderRules(rules *ladderpb.LadderRules) error {
+	if rules == nil {
+		return localizedErrorf("rules are required")
+	}
+	if rules.ChallengeWindow < 1 {
+		return localizedErrorf("challenge window must be at least 1")
+	}
+	if rules.ResponseDeadlineDays < 1 {
+		return localizedErrorf("response deadline must be at least 1 day")
+	}
+	if _, ok := ladderpb.ScoringFormat_name[int32(rules.ScoringFormat)]; !ok {
+		return localizedErrorf("unknown scoring format: %d", rules.ScoringFormat)
+	}
+	if _, ok := ladderpb.DecayPolicy_name[int32(rules.DecayPolicy)]; !ok {
+		return localizedErrorf("unknown decay policy: %d", rules.DecayPolicy)
+	}
+	if rules.DecayPolicy != ladderpb.DecayPolicy_DECAY_NONE && rules.DecayPeriodDays < 1 {
+		return localizedErrorf("decay period must be at least 1 day")
+	}
+	if lp := rules.LeaguePoints; lp != nil && (lp.Win < 0 || lp.CloseWin < 0 || lp.CloseLoss < 0 || lp.Loss < 0 || lp.PerSet < 0) {
+		return localizedErrorf("league points cannot be negative")
+	}
+	if _, ok := ladderpb.JoinPolicy_name[int32(rules.JoinPolicy)]; !ok {
+		return localizedErrorf("unknown join policy: %d", rules.JoinPolicy)
+	}
+	if _, ok := ladderpb.JoinPosition_name[int32(rules.JoinPosition)]; !ok {
+		return localizedErrorf("unknown join position: %d", rules.JoinPosition)
+	}
+	if rules.MaxPlayers < 0 {
+		return localizedErrorf("maximum players cannot be negative")
+	}
+	if rules.QualificationMatches < 0 {
+		return localizedErrorf("qualification matches cannot be negative")
+	}
+	if rules.EntryDeadlineDays < 0 {
+		return localizedErrorf("entry deadline cannot be negative")
+	}
+	if _, err := time.LoadLocation(rules.TimeZone); err != nil {
+		return localizedErrorf("unknown time zone %q", rules.TimeZone)
+	}
+	return nil
+}
+
+// TimeZone returns the zone the ladder's dates are shown in, which is the server's
+// own zone unless the rules choose one
+func (m *Model) TimeZone() *time.Location {
+	rules, err := m.GetLadderRules()
+	if err != nil || rules.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(rules.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+func rulesToStorage(r *ladderpb.LadderRules) *storagepb.LadderRulesStorage {
+	return &storagepb.LadderRulesStorage{
+		ChallengeWindow:      r.ChallengeWindow,
+		ResponseDeadlineDays: r.ResponseDeadlineDays,
+		ScoringFormat:        storagepb.ScoringFormatStorage(r.ScoringFormat),
+		DecayPolicy:          storagepb.DecayPolicyStorage(r.DecayPolicy),
+		DecayPeriodDays:      r.DecayPeriodDays,
+		LeaguePoints:         leaguePointsToStorage(r.LeaguePoints),
+		TimeZone:             r.TimeZone,
+		EntryDeadlineDays:    r.EntryDeadlineDays,
+		QualificationMatches: r.QualificationMatches,
+		MaxPlayers:           r.MaxPlayers,
+		JoinPolicy:           storagepb.JoinPolicyStorage(r.JoinPolicy),
+		JoinPosition:         storagepb.JoinPositionStorage(r.JoinPosition),
+		UpwardChallengesOnly: r.UpwardChallengesOnly,
+	}
+}
+
+func rulesFromStorage(r *storagepb.LadderRulesStorage) *ladderpb.LadderRules {
+	return &ladderpb.LadderRules{
+		ChallengeWindow:      r.GetChallengeWindow(),
+		ResponseDeadlineDays: r.GetResponseDeadlineDays(),
+		ScoringFormat:        ladderpb.ScoringFormat(r.GetScoringFormat()),
+		DecayPolicy:          ladderpb.DecayPolicy(r.GetDecayPolicy()),
+		DecayPeriodDays:      r.GetDecayPeriodDays(),
+		LeaguePoints:         leaguePointsFromStorage(r.GetLeaguePoints()),
+		TimeZone:             r.GetTimeZone(),
+		EntryDeadlineDays:    r.GetEntryDeadlineDays(),
+		QualificationMatches: r.GetQualificationMatches(),
+		MaxPlayers:           r.GetMaxPlayers(),
+		JoinPolicy:           ladderpb.JoinPolicy(r.GetJoinPolicy()),
+		JoinPosition:         ladderpb.JoinPosition(r.GetJoinPosition()),
+		UpwardChallengesOnly: r.GetUpwardChallengesOnly(),
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestModel_LadderRules(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	rules, err := m.GetLadderRules()
+	if err != nil {
+		t.Fatalf("GetLadderRules failed: %v", err)
+	}
+	if rules.ScoringFormat != ladderpb.ScoringFormat_BEST_OF_5_PAR_11 || rules.ChallengeWindow != 3 {
+		t.Errorf("expected default rules, got %+v", rules)
+	}
+
+	m.AddPlayer("Alice", "alice")
+	txID, err := m.SetLadderRules(&ladderpb.LadderRules{
+		ChallengeWindow:      2,
+		ResponseDeadlineDays: 7,
+		ScoringFormat:        ladderpb.ScoringFormat_BEST_OF_3_PAR_11,
+	})
+	if err != nil {
+		t.Fatalf("SetLadderRules failed: %v", err)
+	}
+
+	rules, _ = m.GetLadderRules()
+	if rules.ScoringFormat != ladderpb.ScoringFormat_BEST_OF_3_PAR_11 || rules.ChallengeWindow != 2 {
+		t.Errorf("expected updated rules, got %+v", rules)
+	}
+	if players := m.ListPlayers(); len(players) != 1 {
+		t.Errorf("rules change must carry the ladder forward, got %+v", players)
+	}
+
+	// Undoing the change restores the previous rules
+	undone, _, err := m.UndoLastTransaction(context.Background())
+	if err != nil || undone.Id != txID {
+		t.Fatalf("expected rules change to be undone, got %v, %v", undone, err)
+	}
+	if rules, _ = m.GetLadderRules(); rules.ChallengeWindow != 3 {
+		t.Errorf("expected default rules after undo, got %+v", rules)
+	}
+
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 0, ResponseDeadlineDays: 7}); err == nil {
+		t.Error("expected error for invalid challenge window")
+	}
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 1, ResponseDeadlineDays: 7, DecayPolicy: ladderpb.DecayPolicy_DECAY_DROP_ONE_PER_PERIOD}); err == nil {
+		t.Error("expected error for decay policy without a period")
+	}
+}
+
+func TestModel_LadderRulesCache(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 2, ResponseDeadlineDays: 7})
+	before, _ := os.ReadFile(path)
+	if rules, _ := m.GetLadderRules(); rules.ChallengeWindow != 2 {
+		t.Fatalf("expected the new rules, got %+v", rules)
+	}
+
+	// Appends that don't touch the rules keep the cache; callers can't change it
+	m.AddPlayer("Bob", "bob")
+	rules, _ := m.GetLadderRules()
+	rules.ChallengeWindow = 9
+	if m.rules.rules == nil {
+		t.Error("expected the rules to stay cached across an append")
+	}
+	if rules, _ := m.GetLadderRules(); rules.ChallengeWindow != 2 {
+		t.Errorf("expected the cached rules to be unchanged, got %+v", rules)
+	}
+
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 4, ResponseDeadlineDays: 7})
+	if rules, _ := m.GetLadderRules(); rules.ChallengeWindow != 4 {
+		t.Errorf("expected a rules change to replace the cached rules, got %+v", rules)
+	}
+	if _, _, err := m.UndoLastTransaction(context.Background()); err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	if rules, _ := m.GetLadderRules(); rules.ChallengeWindow != 2 {
+		t.Errorf("expected undoing the change to restore the rules, got %+v", rules)
+	}
+
+	// A log replaced on disk, e.g. by a restore, is read again
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 5, ResponseDeadlineDays: 7})
+	if rules, _ := m.GetLadderRules(); rules.ChallengeWindow != 5 {
+		t.Fatalf("expected the new rules, got %+v", rules)
+	}
+	if err := os.WriteFile(path, before, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := m.GetLadderRules(); rules.ChallengeWindow != 2 {
+		t.Errorf("expected the rules of the replaced log, got %+v", rules)
+	}
+	m.mu.Lock()
+	err := m.rewriteLogLocked(nil)
+	m.mu.Unlock()
+	if err != nil {
+		t.Fatalf("rewrite failed: %v", err)
+	}
+	if rules, _ := m.GetLadderRules(); rules.ChallengeWindow != 3 {
+		t.Errorf("expected the default rules after the log was emptied, got %+v", rules)
+	}
+}
+
+func TestLadderService_AddMatchResult_ScoringFormat(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.SetLadderRules(&ladderpb.LadderRules{
+		ChallengeWindow:      3,
+		ResponseDeadlineDays: 14,
+		ScoringFormat:        ladderpb.ScoringFormat_BEST_OF_3_PAR_11,
+	})
+
+	svc := NewLadderService(m)
+	_, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+		ChallengerId: "bob",
+		DefenderId:   "alice",
+		WinnerId:     "bob",
+		SetScores: []*ladderpb.SetScore{
+			{ChallengerPoints: 11, DefenderPoints: 5},
+			{ChallengerPoints: 11, DefenderPoints: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected 2-0 to be a complete best-of-3 match: %v", err)
+	}
+}
+
+func TestValidateScoreFormat(t *testing.T) {
+	to15 := []*ladderpb.SetScore{
+		{ChallengerPoints: 15, DefenderPoints: 10},
+		{ChallengerPoints: 15, DefenderPoints: 10},
+		{ChallengerPoints: 15, DefenderPoints: 10},
+	}
+	if winner, err := ValidateScoreFormat(to15, ladderpb.ScoringFormat_BEST_OF_5_PAR_15); err != nil || winner != 1 {
+		t.Errorf("expected challenger win to 15, got %d, %v", winner, err)
+	}
+
+	short := []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 5},
+	}
+	if _, err := ValidateScoreFormat(short, ladderpb.ScoringFormat_BEST_OF_5_PAR_15); err == nil {
+		t.Error("expected sets to 11 to be rejected in a par-15 format")
+	}
+}
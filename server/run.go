@@ -1,18 +1,28 @@
 package server
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	ladderpb "squash-ladder/server/gen/ladder"
+	"squash-ladder/server/version"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
 )
 
 // Config holds the configuration for the server
@@ -20,11 +30,216 @@ type Config struct {
 	DataPath string
 	HTTPPort string
 	GRPCPort string
+
+	// HTTPAddr and GRPCAddr are full listen addresses such as "127.0.0.1:9090" or
+	// ":0" for an ephemeral port, and take precedence over the port fields.
+	// GRPCAddr may also be "unix:/path/to/socket".
+	HTTPAddr string
+	GRPCAddr string
+	// OnListening, if set, is called with the bound addresses once both listeners
+	// are open; grpcAddr is nil when plain gRPC is disabled and equals httpAddr
+	// in single-port mode
+	OnListening func(httpAddr, grpcAddr net.Addr)
+	// Stop, if set, shuts the server down when closed; Run then returns nil
+	Stop <-chan struct{}
+	// SinglePort serves plain gRPC (over h2c), gRPC-Web and REST on the HTTP
+	// listener and opens no separate gRPC listener
+	SinglePort bool
+
+	// LogCheckpointInterval is the number of transactions between full player list
+	// snapshots in the log; those in between store only a delta. Zero uses the default
+	// and 1 writes a snapshot every time, like the original log format.
+	LogCheckpointInterval int
+
+	// Clock and IDs stamp and name new transactions in place of the system clock and
+	// random UUIDs, so tools and tests can write reproducible logs
+	Clock Clock
+	IDs   IDGenerator
+
+	// VerifyLogOnStartup replays the log on boot and reports snapshot divergences
+	VerifyLogOnStartup bool
+	// RepairLogOnStartup rewrites divergent snapshots found by the startup check
+	RepairLogOnStartup bool
+
+	// IntegrityCheckInterval schedules background log verification; zero disables it
+	IntegrityCheckInterval time.Duration
+	// IntegrityWebhookURL receives a JSON POST when a scheduled check fails
+	IntegrityWebhookURL string
+
+	// LogWarnBytes and LogWarnTransactions are soft limits on the size of each ladder's
+	// log. Passing one logs a warning, bumps the log_growth_warnings metric and POSTs to
+	// GrowthWebhookURL, if set, so there is time to compact the log; zero is no limit.
+	LogWarnBytes        int64
+	LogWarnTransactions int64
+	GrowthWebhookURL    string
+	// GrowthCheckInterval is how often the logs are measured (default 1h)
+	GrowthCheckInterval time.Duration
+
+	// CORSOrigins are the browser origins allowed to call the server; empty allows any
+	CORSOrigins []string
+
+	// Reload, if set, is called on SIGHUP and by the ReloadConfig RPC. The webhook URLs,
+	// log growth limits and CORS origins of the Config it returns replace the running
+	// ones; changes to other fields need a restart.
+	Reload func() (Config, error)
+
+	// AdminToken guards admin RPCs; they are rejected when it is empty
+	AdminToken string
+	// APIKeysFile keeps the keys made by CreateApiKey; it defaults to api_keys.json
+	// next to DataPath. Admin keys work only while AdminToken is set.
+	APIKeysFile string
+
+	// TwilioAuthToken enables the inbound SMS webhook at /api/sms/twilio, which texts
+	// confirmation codes through the account that messages arrive on
+	TwilioAuthToken string
+	// SMSWebhookURL is the public webhook URL configured in Twilio, used for signature checks
+	SMSWebhookURL string
+
+	// TelegramBotToken enables the Telegram bot
+	TelegramBotToken string
+	// TelegramChatID receives rank-change announcements when set
+	TelegramChatID string
+
+	// MultiClub hosts a separate ladder per club under the "clubs" directory next to DataPath
+	MultiClub bool
+	// ClubDomain lets clubs be selected by subdomain, e.g. "ladder.example.org"
+	ClubDomain string
+	// Default per-club quotas for clubs created without their own; zero means unlimited
+	ClubMaxPlayers         int32
+	ClubMaxMatchesPerMonth int32
+	ClubMaxStorageBytes    int64
+
+	// ResultLinkSecret signs court-side result links; the feature is off when empty
+	ResultLinkSecret string
+	// ResultLinkTTL is how long a result link stays valid (default 2h)
+	ResultLinkTTL time.Duration
+	// PublicURL is the externally visible base URL used in generated links
+	PublicURL string
+
+	// AttachmentSecret signs download links and enables attaching files such as
+	// scoresheet photos to matches; the feature is off when empty
+	AttachmentSecret string
+	// Attachments says where attached files are stored, by default the "attachments"
+	// directory next to DataPath. Keep is not used.
+	Attachments BackupConfig
+	// MaxAttachmentBytes caps an uploaded file (default 10 MiB)
+	MaxAttachmentBytes int64
+	// AttachmentURLTTL is how long a download link stays valid (default 1h)
+	AttachmentURLTTL time.Duration
+
+	// MaxRequestBytes caps gRPC messages and HTTP request bodies (default 1 MiB)
+	MaxRequestBytes int64
+	// RPCTimeout is the longest any RPC may run (default 15s)
+	RPCTimeout time.Duration
+	// DisableRPCMetrics turns off the per-RPC latency, in-flight and status code
+	// metrics served at /metrics, for minimal deployments
+	DisableRPCMetrics bool
+	// HTTPReadTimeout and HTTPWriteTimeout bound reading a request and writing a
+	// response (defaults 30s and 60s); live event streams are exempt from the latter
+	HTTPReadTimeout  time.Duration
+	HTTPWriteTimeout time.Duration
+
+	// SportyHQAPIKey and SportyHQLadderID enable pushing results to SportyHQ
+	SportyHQAPIKey   string
+	SportyHQLadderID string
+	// SportyHQBaseURL overrides the SportyHQ API endpoint
+	SportyHQBaseURL string
+	// SyncInterval is how often pending results are pushed (default 5m)
+	SyncInterval time.Duration
+	// SyncPullRoster adds players from the external roster that are missing from the ladder
+	SyncPullRoster bool
+
+	// GoogleSheetID mirrors standings and recent results to this spreadsheet, which
+	// needs "Standings" and "Results" tabs
+	GoogleSheetID string
+	// GoogleCredentialsFile is the JSON key of a service account with edit access to the sheet
+	GoogleCredentialsFile string
+
+	// LogEncryptionKey encrypts the transaction logs with AES-256-GCM when set. It must
+	// be LogKeySize bytes. Existing plaintext lines are encrypted on startup.
+	LogEncryptionKey []byte
+
+	// APIDocs serves Swagger UI for the HTTP API at /api/docs, and its OpenAPI document
+	// at /api/docs/openapi.json
+	APIDocs bool
+	// GRPCReflection serves gRPC reflection, so tools such as grpcurl and
+	// "server proto-check -addr" can read the API from the running server
+	GRPCReflection bool
+
+	// PublicMode masks surnames ("Alice J.") in standings, results and live events
+	// for anonymous readers, so the ladder can be linked from a public website
+	PublicMode bool
+	// Network limits where requests are accepted from, such as mutations only from
+	// the club network. The zero value accepts them from anywhere.
+	Network NetworkPolicy
+
+	// MemberToken, sent as a bearer token, shows members full names in public mode.
+	// The admin token works too.
+	MemberToken string
+
+	// PlayerTokenSecret signs the tokens that identify players to player RPCs such as
+	// GetMyDashboard; those RPCs are off when it is empty
+	PlayerTokenSecret string
+
+	// RecordClientAddresses stores the remote address of each write on its transaction,
+	// beside the caller and client type. It is off by default for privacy.
+	RecordClientAddresses bool
+
+	// Wallet enables membership cards in Apple Wallet and Google Wallet that show a
+	// player's rank; it needs PublicURL and PlayerTokenSecret
+	Wallet WalletConfig
+
+	// AuditSigningKey signs the transcripts of ExportAuditTranscript, which are off when
+	// it is empty; "server audit-keys" generates a key pair
+	AuditSigningKey string
+
+	// VAPIDPrivateKey and VAPIDSubject (a mailto: or https: contact) enable Web Push
+	// notifications to browsers; "server vapid-keys" generates a key pair
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+	// FCMCredentialsFile is the JSON key of a Firebase service account, enabling push
+	// notifications to the mobile apps
+	FCMCredentialsFile string
+	// SMTP enables email notifications when its Addr is set
+	SMTP SMTPConfig
+	// DigestSchedule is a cron expression (UTC) for the weekly digest; empty sends it
+	// on Sunday evening
+	DigestSchedule string
+	// DefaultLocale is the language of errors and notifications for clients and players
+	// without a preference, e.g. "de"; empty is English
+	DefaultLocale string
+
+	// BackupSchedule is a cron expression (UTC) for backing up every ladder, e.g.
+	// "0 3 * * *"; backups are off when empty
+	BackupSchedule string
+	// Backup says where backups are stored and how many are kept
+	Backup BackupConfig
+
+	// ResultSinks receive ladder updates, in addition to sinks added with RegisterResultSink
+	ResultSinks []ResultSink
+
+	// UnaryInterceptors run on every RPC after the built-in ones, so they see the
+	// caller's club, locale and player already resolved into the context
+	UnaryInterceptors []grpc.UnaryServerInterceptor
+	// HTTPMiddleware wraps the HTTP handler, the first outermost, and so sees every
+	// request on the HTTP port: REST, gRPC-Web, live events and, in single-port mode,
+	// plain gRPC. It runs before the built-in CORS, body limit and public view handling.
+	HTTPMiddleware []func(http.Handler) http.Handler
 }
 
 // Run starts the server with the given configuration.
 // It blocks until the server fails or is stopped.
 func Run(cfg Config) error {
+	stop := cfg.Stop
+	if stop == nil {
+		stop = make(chan struct{})
+	}
+	log.Printf("Squash ladder server %s", version.String())
+
+	if cfg.DefaultLocale != "" && supportedLocale(cfg.DefaultLocale) != cfg.DefaultLocale {
+		return fmt.Errorf("unsupported default locale %q; choose one of %v", cfg.DefaultLocale, supportedLocales)
+	}
+
 	// Ensure data directory exists
 	dataDir := filepath.Dir(cfg.DataPath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
@@ -34,50 +249,452 @@ func Run(cfg Config) error {
 	if err != nil {
 		return fmt.Errorf("failed to initialize ladder: %v", err)
 	}
+	ladderModel.SetCheckpointInterval(cfg.LogCheckpointInterval)
+	ladderModel.SetClock(cfg.Clock)
+	ladderModel.SetIDGenerator(cfg.IDs)
+	if cfg.LogEncryptionKey != nil {
+		if err := ladderModel.SetEncryptionKey(cfg.LogEncryptionKey); err != nil {
+			return err
+		}
+		n, err := ladderModel.EncryptLog()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Encrypted %d log lines", n)
+		}
+	}
+
+	if cfg.VerifyLogOnStartup || cfg.RepairLogOnStartup {
+		report, err := ladderModel.VerifyLog(context.Background(), cfg.RepairLogOnStartup)
+		if err != nil {
+			return fmt.Errorf("failed to verify log: %v", err)
+		}
+		logIntegrityReport(report)
+	}
 
-	// Create gRPC server
-	grpcServer := grpc.NewServer()
+	var checker *IntegrityChecker
+	if cfg.IntegrityCheckInterval > 0 {
+		checker = NewIntegrityChecker(ladderModel, cfg.IntegrityCheckInterval, cfg.IntegrityWebhookURL)
+		checker.Start(stop)
+		log.Printf("Scheduled integrity check every %s", cfg.IntegrityCheckInterval)
+	}
 
-	// Create and register ladder service
+	keysFile := cfg.APIKeysFile
+	if keysFile == "" {
+		keysFile = filepath.Join(dataDir, "api_keys.json")
+	}
+	apiKeys, err := OpenAPIKeys(keysFile)
+	if err != nil {
+		return err
+	}
+
+	public := newPublicAccess(cfg.PublicMode, cfg.MemberToken, cfg.AdminToken)
+	public.keys = apiKeys
+	var auditKey ed25519.PrivateKey
+	if cfg.AuditSigningKey != "" {
+		if auditKey, err = parseAuditKey(cfg.AuditSigningKey); err != nil {
+			return err
+		}
+	}
+	var playerAuth *PlayerAuth
+	if cfg.PlayerTokenSecret != "" {
+		playerAuth = NewPlayerAuth(cfg.PlayerTokenSecret, cfg.Clock)
+	}
+	maxRequestBytes := orDefault(cfg.MaxRequestBytes, defaultMaxRequestBytes)
+	interceptors := []grpc.UnaryServerInterceptor{
+		cfg.Network.unaryInterceptor(),
+		deadlineUnaryInterceptor(orDefault(cfg.RPCTimeout, defaultRPCTimeout)),
+		adminUnaryInterceptor(cfg.AdminToken, apiKeys),
+		maintenanceUnaryInterceptor(),
+		public.unaryInterceptor(),
+		playerUnaryInterceptor(playerAuth),
+	}
+	if cfg.Network.enabled() {
+		log.Printf("Network policy: %d allowed networks, %d networks allowed to make changes", len(cfg.Network.Allowed), len(cfg.Network.Mutations))
+	}
+	var rpcMetrics *RPCMetrics
+	if !cfg.DisableRPCMetrics {
+		rpcMetrics = NewRPCMetrics()
+		interceptors = append([]grpc.UnaryServerInterceptor{rpcMetrics.unaryInterceptor()}, interceptors...)
+	}
+	var clubs *ClubRegistry
+	if cfg.MultiClub {
+		quota := &ladderpb.ClubQuota{
+			MaxPlayers:         cfg.ClubMaxPlayers,
+			MaxMatchesPerMonth: cfg.ClubMaxMatchesPerMonth,
+			MaxStorageBytes:    cfg.ClubMaxStorageBytes,
+		}
+		clubs, err = NewClubRegistry(filepath.Join(dataDir, "clubs"), quota)
+		if err != nil {
+			return err
+		}
+		clubs.checkpointInterval = cfg.LogCheckpointInterval
+		clubs.maintenance = ladderModel.maintenance
+		clubs.encryptionKey = cfg.LogEncryptionKey
+		clubs.clock, clubs.ids = cfg.Clock, cfg.IDs
+		interceptors = append(interceptors, clubUnaryInterceptor(clubs, cfg.ClubDomain))
+		log.Printf("Multi-club mode enabled")
+	}
+
+	// The alarm always runs, for the size metrics, so a reload can set limits later
+	limits := GrowthLimits{MaxBytes: cfg.LogWarnBytes, MaxTransactions: cfg.LogWarnTransactions}
+	growth := NewGrowthAlarm(ladderModel, clubs, limits, cfg.GrowthCheckInterval, cfg.GrowthWebhookURL)
+	growth.Start(stop)
+	if cfg.LogWarnBytes > 0 || cfg.LogWarnTransactions > 0 {
+		log.Printf("Log growth alarm set at %d bytes, %d transactions", cfg.LogWarnBytes, cfg.LogWarnTransactions)
+	}
+	settings := newLiveSettings(cfg, checker, growth)
+	if cfg.Reload != nil {
+		settings.reloadOnSignal(stop)
+	}
+
+	// Create ladder service
 	ladderService := NewLadderService(ladderModel)
+	ladderService.clubs = clubs
+	ladderService.playerAuth = playerAuth
+	ladderService.locale = cfg.DefaultLocale
+	ladderService.settings = settings
+	ladderService.apiKeys = apiKeys
+	ladderService.auditKey = auditKey
+	ladderService.recordClientAddresses = cfg.RecordClientAddresses
+	interceptors = append(interceptors, ladderService.localeUnaryInterceptor())
+	interceptors = append(interceptors, ladderService.clientUnaryInterceptor(cfg.MemberToken))
+	interceptors = append(interceptors, cfg.UnaryInterceptors...)
+
+	// Create gRPC server and register the service
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.MaxRecvMsgSize(int(maxRequestBytes)),
+	)
 	ladderpb.RegisterLadderServiceServer(grpcServer, ladderService)
+	if cfg.GRPCReflection {
+		reflection.Register(grpcServer)
+	}
+
+	var smsHandler *SMSHandler
+	if cfg.TwilioAuthToken != "" {
+		smsHandler = NewSMSHandler(ladderService, cfg.TwilioAuthToken, cfg.SMSWebhookURL)
+		ladderService.sms = smsHandler
+	}
+
+	var telegram *TelegramBot
+	if cfg.TelegramBotToken != "" {
+		telegram = NewTelegramBot(ladderService, cfg.TelegramBotToken, cfg.TelegramChatID)
+		telegram.Start(ladderModel, stop)
+		ladderService.telegram = telegram
+		log.Printf("Telegram bot started")
+	}
+
+	if cfg.VAPIDPrivateKey != "" || cfg.FCMCredentialsFile != "" || cfg.SMTP.Addr != "" || telegram != nil || smsHandler != nil {
+		store, err := openNotificationStore(dataDir)
+		if err != nil {
+			return err
+		}
+		notifier := NewNotifier(store)
+		notifier.locale = cfg.DefaultLocale
+		if cfg.VAPIDPrivateKey != "" {
+			if err := notifier.EnableWebPush(cfg.VAPIDPrivateKey, cfg.VAPIDSubject); err != nil {
+				return err
+			}
+		}
+		if cfg.FCMCredentialsFile != "" {
+			creds, err := os.ReadFile(cfg.FCMCredentialsFile)
+			if err != nil {
+				return fmt.Errorf("failed to read FCM credentials: %v", err)
+			}
+			if err := notifier.EnableFCM(creds); err != nil {
+				return err
+			}
+		}
+		if cfg.SMTP.Addr != "" {
+			if err := notifier.EnableEmail(cfg.SMTP); err != nil {
+				return err
+			}
+		}
+		if telegram != nil {
+			notifier.EnableTelegram(telegram)
+		}
+		if smsHandler != nil {
+			notifier.EnableSMS(smsHandler)
+		}
+		notifier.Attach("", ladderModel)
+		if clubs != nil {
+			clubs.OnOpen(notifier.Attach)
+		}
+		digest, err := NewDigestJob(notifier, ladderModel, clubs, cfg.DigestSchedule)
+		if err != nil {
+			return err
+		}
+		digest.Start(stop)
+		ladderService.notifier = notifier
+		log.Printf("Player notifications enabled on %v", notifier.availableChannels())
+	}
+
+	if cfg.Wallet.enabled() {
+		wallet, err := NewWalletPasses(ladderService, clubs, cfg.Wallet, cfg.PublicURL, cfg.PlayerTokenSecret, dataDir)
+		if err != nil {
+			return err
+		}
+		wallet.Attach("", ladderModel)
+		if clubs != nil {
+			clubs.OnOpen(wallet.Attach)
+		}
+		ladderService.wallet = wallet
+		log.Printf("Wallet passes enabled (Apple: %v, Google: %v)", wallet.apple != nil, wallet.google != nil)
+	}
+
+	if cfg.SportyHQAPIKey != "" && cfg.SportyHQLadderID != "" {
+		adapter := NewSportyHQAdapter(cfg.SportyHQBaseURL, cfg.SportyHQAPIKey, cfg.SportyHQLadderID)
+		ladderService.sync = NewSyncJob(ladderModel, adapter, cfg.SyncInterval, cfg.SyncPullRoster)
+		ladderService.sync.Start(stop)
+		log.Printf("SportyHQ sync started")
+	}
+
+	if cfg.BackupSchedule != "" {
+		target, err := cfg.Backup.Target()
+		if err != nil {
+			return err
+		}
+		job, err := NewBackupJob(ladderModel, clubs, target, cfg.BackupSchedule, cfg.Backup.Keep)
+		if err != nil {
+			return err
+		}
+		job.Start(stop)
+		log.Printf("Scheduled backups at %q", cfg.BackupSchedule)
+	}
+
+	sinks := append(resultSinks(), cfg.ResultSinks...)
+	if cfg.GoogleSheetID != "" {
+		creds, err := os.ReadFile(cfg.GoogleCredentialsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read Google credentials: %v", err)
+		}
+		mirror, err := NewSheetsMirror(ladderModel, cfg.GoogleSheetID, creds)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, mirror)
+	}
+	for _, sink := range sinks {
+		attachResultSink(ladderModel, sink)
+		log.Printf("Result sink %T attached", sink)
+	}
+
+	kiosk := NewKioskHandler(ladderService)
+	console := NewAdminConsole(ladderService, clubs, cfg.ClubDomain, cfg.AdminToken)
+	console.keys = apiKeys
+	exports := NewExportHandler(ladderService)
+	publicAPI := NewPublicAPI(ladderService)
+	var apiDocs *APIDocs
+	if cfg.APIDocs {
+		if apiDocs, err = NewAPIDocs(cfg.PublicURL); err != nil {
+			return err
+		}
+	}
+	live := NewLiveHandler(ladderService)
+
+	var resultLinks *ResultLinks
+	if cfg.ResultLinkSecret != "" {
+		resultLinks = NewResultLinks(ladderService, clubs, cfg.ResultLinkSecret, cfg.Clock, cfg.ResultLinkTTL, cfg.PublicURL, cfg.AdminToken)
+	}
+
+	var attachments *Attachments
+	if cfg.AttachmentSecret != "" {
+		storeCfg := cfg.Attachments
+		if storeCfg.Dir == "" && storeCfg.S3Bucket == "" {
+			storeCfg.Dir = filepath.Join(dataDir, "attachments")
+		}
+		store, err := storeCfg.Target()
+		if err != nil {
+			return err
+		}
+		attachments = NewAttachments(ladderService, clubs, cfg.ClubDomain, store, cfg.AttachmentSecret, cfg.AttachmentURLTTL, cfg.MaxAttachmentBytes, cfg.PublicURL, cfg.AdminToken)
+		ladderService.attachments = attachments
+	}
 
 	// Wrap gRPC server with gRPC-Web
 	wrappedGrpc := grpcweb.WrapServer(grpcServer)
 
 	// Create HTTP handler with CORS support
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Plain gRPC arrives as HTTP/2 with an application/grpc content type
+		if cfg.SinglePort && isNativeGRPC(r) {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+
 		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		settings.setCORSOrigin(w, r)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Grpc-Web, X-User-Agent, X-Grpc-Web-Type, Grpc-Timeout")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Grpc-Web, X-User-Agent, X-Grpc-Web-Type, Grpc-Timeout, X-Club-Id, X-Player-Token, X-API-Version")
+		w.Header().Set("Access-Control-Expose-Headers", "X-API-Version")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
+		// gRPC-Web requests are checked by the interceptor, which knows the RPC
+		if !wrappedGrpc.IsGrpcWebRequest(r) {
+			if err := cfg.Network.checkHTTP(r); err != nil {
+				writeRESTErr(w, err)
+				return
+			}
+		}
+
+		// gRPC-Web bodies are limited per message by the gRPC server, and uploads by
+		// the attachment limit
+		if !wrappedGrpc.IsGrpcWebRequest(r) && !(attachments != nil && isAttachmentUpload(r)) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+		}
+		r = r.WithContext(public.httpContext(r))
+
+		// Expose expvar counters (integrity check metrics) to admins
+		if r.URL.Path == "/debug/vars" && r.Method == "GET" {
+			if cfg.AdminToken == "" || !hasBearerHeader(r, cfg.AdminToken) {
+				writeRESTError(w, codes.Unauthenticated, "admin token required", nil)
+				return
+			}
+			expvar.Handler().ServeHTTP(w, r)
+			return
+		}
+
+		// Per-RPC metrics for Prometheus
+		if rpcMetrics != nil && r.URL.Path == "/metrics" && r.Method == "GET" {
+			rpcMetrics.ServeHTTP(w, r)
+			return
+		}
+
+		// Inbound SMS result entry
+		if smsHandler != nil && r.URL.Path == smsPath {
+			smsHandler.ServeHTTP(w, r)
+			return
+		}
+
+		// Signed result submission links and their QR codes
+		if resultLinks != nil && (strings.HasPrefix(r.URL.Path, "/api/result-links") || strings.HasPrefix(r.URL.Path, resultLinkPath)) {
+			resultLinks.ServeHTTP(w, r)
+			return
+		}
+
+		// Wallet card downloads and the Apple Wallet web service
+		if ladderService.wallet != nil && strings.HasPrefix(r.URL.Path, walletPath) {
+			ladderService.wallet.ServeHTTP(w, r)
+			return
+		}
+
+		// Match attachment uploads and signed downloads
+		if attachments != nil && (isAttachmentUpload(r) || strings.HasPrefix(r.URL.Path, attachmentPath)) {
+			attachments.ServeHTTP(w, r)
+			return
+		}
+
+		// Server-rendered admin pages
+		if isConsolePath(r.URL.Path) {
+			console.ServeHTTP(w, r)
+			return
+		}
+
+		// Wall-mounted standings display
+		if r.URL.Path == "/kiosk" && r.Method == "GET" {
+			ctx, err := clubHTTPContext(r, clubs, cfg.ClubDomain)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			compressed("", kiosk.ServeHTTP)(w, r.WithContext(ctx))
+			return
+		}
+
+		// Live JSON events over WebSocket
+		if r.URL.Path == "/ws" && r.Method == "GET" {
+			ctx, err := clubHTTPContext(r, clubs, cfg.ClubDomain)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			live.ServeWebSocket(w, r.WithContext(ctx))
+			return
+		}
+
+		// The same events as server-sent events, for proxies that break WebSockets
+		if r.URL.Path == "/api/events" && r.Method == "GET" {
+			ctx, err := clubHTTPContext(r, clubs, cfg.ClubDomain)
+			if err != nil {
+				writeRESTError(w, codes.NotFound, err.Error(), nil)
+				return
+			}
+			live.ServeSSE(w, r.WithContext(ctx))
+			return
+		}
+
+		// Printable and downloadable exports
+		if strings.HasPrefix(r.URL.Path, "/api/export/") && r.Method == "GET" {
+			ctx, err := clubHTTPContext(r, clubs, cfg.ClubDomain)
+			if err != nil {
+				writeRESTError(w, codes.NotFound, err.Error(), nil)
+				return
+			}
+			compressed(cacheExports, exports.ServeHTTP)(w, r.WithContext(ctx))
+			return
+		}
+
+		// OpenAPI document and Swagger UI
+		if apiDocs != nil && strings.HasPrefix(r.URL.Path, apiDocsPath) && r.Method == "GET" {
+			compressed(cacheExports, apiDocs.ServeHTTP)(w, r)
+			return
+		}
+
+		// Versioned JSON for third-party club apps
+		if strings.HasPrefix(r.URL.Path, publicAPIPath) && r.Method == "GET" {
+			ctx, err := clubHTTPContext(r, clubs, cfg.ClubDomain)
+			if err != nil {
+				writeRESTError(w, codes.NotFound, err.Error(), nil)
+				return
+			}
+			if clubs != nil {
+				w.Header().Add("Vary", clubHeader)
+			}
+			if cfg.PublicMode {
+				w.Header().Add("Vary", "Authorization")
+			}
+			compressed(cacheStandings, publicAPI.ServeHTTP)(w, r.WithContext(ctx))
+			return
+		}
+
 		// Serve JSON REST endpoint as fallback (for client compatibility)
 		if r.URL.Path == "/api/players" && r.Method == "GET" {
-			resp, err := ladderService.ListPlayers(r.Context(), &ladderpb.ListPlayersRequest{})
+			ctx, err := clubHTTPContext(r, clubs, cfg.ClubDomain)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeRESTError(w, codes.NotFound, err.Error(), nil)
 				return
 			}
-			w.Header().Set("Content-Type", "application/json")
-			// Convert proto response to JSON
-			players := make([]map[string]interface{}, len(resp.Players))
-			for i, p := range resp.Players {
-				players[i] = map[string]interface{}{
-					"id":   p.Id,
-					"name": p.Name,
-					"rank": p.Rank,
-				}
+			if clubs != nil {
+				// The club may be chosen by header rather than URL
+				w.Header().Add("Vary", clubHeader)
 			}
-			jsonData := map[string]interface{}{
-				"players": players,
+			if cfg.PublicMode {
+				// Members and anonymous readers see different names
+				w.Header().Add("Vary", "Authorization")
 			}
-			json.NewEncoder(w).Encode(jsonData)
+			compressed(cacheStandings, func(w http.ResponseWriter, r *http.Request) {
+				resp, err := ladderService.ListPlayers(r.Context(), &ladderpb.ListPlayersRequest{})
+				if err != nil {
+					writeRESTErr(w, err)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				// Convert proto response to JSON
+				players := make([]legacyPlayer, len(resp.Players))
+				for i, p := range resp.Players {
+					players[i] = legacyPlayer{ID: p.Id, Name: p.Name, Rank: p.Rank}
+				}
+				jsonData := map[string]interface{}{
+					"players": players,
+				}
+				json.NewEncoder(w).Encode(jsonData)
+			})(w, r.WithContext(ctx))
 			return
 		}
 
@@ -88,25 +705,119 @@ func Run(cfg Config) error {
 		}
 
 		// For non-gRPC requests, return 404
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			writeRESTError(w, codes.NotFound, "no such endpoint", map[string]string{"method": r.Method, "path": r.URL.Path})
+			return
+		}
 		http.NotFound(w, r)
 	})
 
+	httpAddr := cfg.HTTPAddr
+	if httpAddr == "" {
+		httpAddr = ":" + cfg.HTTPPort
+	}
+	grpcAddr := cfg.GRPCAddr
+	if grpcAddr == "" && cfg.GRPCPort != "" {
+		grpcAddr = ":" + cfg.GRPCPort
+	}
+	if cfg.SinglePort {
+		grpcAddr = ""
+	}
+
+	httpLis, err := listen(httpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", httpAddr, err)
+	}
+
 	// Start standard gRPC server (for specialized clients/testing)
-	if cfg.GRPCPort != "" {
+	var grpcBound net.Addr
+	if grpcAddr != "" {
+		grpcLis, err := listen(grpcAddr)
+		if err != nil {
+			httpLis.Close()
+			return fmt.Errorf("failed to listen on %s: %v", grpcAddr, err)
+		}
+		grpcBound = grpcLis.Addr()
+		log.Printf("Starting standard gRPC server on %s", grpcBound)
 		go func() {
-			lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.GRPCPort))
-			if err != nil {
-				log.Printf("failed to listen on :%s: %v", cfg.GRPCPort, err)
-				return
-			}
-			log.Printf("Starting standard gRPC server on port %s", cfg.GRPCPort)
-			if err := grpcServer.Serve(lis); err != nil {
-				log.Printf("failed to serve gRPC on :%s: %v", cfg.GRPCPort, err)
+			if err := grpcServer.Serve(grpcLis); err != nil {
+				log.Printf("failed to serve gRPC on %s: %v", grpcBound, err)
 			}
 		}()
 	}
 
+	httpHandler := chainMiddleware(handler, cfg.HTTPMiddleware)
+	if cfg.SinglePort {
+		grpcBound = httpLis.Addr()
+		httpHandler = h2c.NewHandler(httpHandler, &http2.Server{})
+		log.Printf("Serving gRPC, gRPC-Web and HTTP on a single port")
+	}
+
+	if cfg.OnListening != nil {
+		cfg.OnListening(httpLis.Addr(), grpcBound)
+	}
+
+	httpServer := &http.Server{
+		Handler:           httpHandler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       orDefault(cfg.HTTPReadTimeout, defaultHTTPReadTimeout),
+		WriteTimeout:      orDefault(cfg.HTTPWriteTimeout, defaultHTTPWriteTimeout),
+		IdleTimeout:       httpIdleTimeout,
+	}
+	go func() {
+		<-stop
+		grpcServer.Stop()
+		httpServer.Close()
+	}()
+
 	// Start HTTP server (serves both gRPC-Web and regular HTTP)
-	log.Printf("Starting gRPC-Web server on port %s", cfg.HTTPPort)
-	return http.ListenAndServe(fmt.Sprintf(":%s", cfg.HTTPPort), handler)
+	log.Printf("Starting gRPC-Web server on %s", httpLis.Addr())
+	if err := httpServer.Serve(httpLis); err != http.ErrServerClosed {
+		return err
+	}
+	ladderModel.Close()
+	if clubs != nil {
+		clubs.Close()
+	}
+	return nil
+}
+
+// chainMiddleware wraps h in middleware, the first outermost
+func chainMiddleware(h http.Handler, middleware []func(http.Handler) http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// isNativeGRPC reports whether r is a plain gRPC call rather than gRPC-Web
+func isNativeGRPC(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 && strings.HasPrefix(ct, "application/grpc") && !strings.HasPrefix(ct, "application/grpc-web")
+}
+
+// listen opens a TCP listener, or a Unix domain socket for "unix:" addresses.
+// A stale socket file left by a previous run is removed first.
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func logIntegrityReport(report *IntegrityReport) {
+	if report.OK() {
+		log.Printf("Log verification passed: %d transactions checked", report.TransactionsChecked)
+		return
+	}
+	log.Printf("Log verification found %d divergent transactions out of %d", len(report.Mismatches), report.TransactionsChecked)
+	for _, mm := range report.Mismatches {
+		log.Printf("  tx #%d %s (%s): %s", mm.Index, mm.TransactionID, mm.Type, mm.Reason)
+	}
+	if report.Repaired {
+		log.Printf("Log repaired with recomputed snapshots")
+	}
 }
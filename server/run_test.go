@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestRun_EphemeralAndUnixListeners(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ladder_run_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "grpc.sock")
+	type bound struct{ http, grpc net.Addr }
+	addrs := make(chan bound, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Run(Config{
+		Stop:     stop,
+		DataPath: filepath.Join(dir, "ladder.log"),
+		HTTPAddr: "127.0.0.1:0",
+		GRPCAddr: "unix:" + socket,
+		OnListening: func(httpAddr, grpcAddr net.Addr) {
+			addrs <- bound{httpAddr, grpcAddr}
+		},
+	})
+
+	var got bound
+	select {
+	case got = <-addrs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not start listening")
+	}
+	if port := got.http.(*net.TCPAddr).Port; port == 0 {
+		t.Error("expected the chosen HTTP port to be reported")
+	}
+	if got.grpc.Network() != "unix" || got.grpc.String() != socket {
+		t.Errorf("unexpected gRPC address: %s %s", got.grpc.Network(), got.grpc)
+	}
+
+	conn, err := grpc.Dial("unix:"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := ladderpb.NewLadderServiceClient(conn)
+	if _, err := c.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("AddPlayer over unix socket failed: %v", err)
+	}
+	resp, err := c.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil || len(resp.Players) != 1 {
+		t.Fatalf("unexpected ListPlayers result: %v %v", resp, err)
+	}
+}
+
+func TestRun_SinglePort(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ladder_run_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	addrs := make(chan net.Addr, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Run(Config{
+		Stop:       stop,
+		DataPath:   filepath.Join(dir, "ladder.log"),
+		HTTPAddr:   "127.0.0.1:0",
+		GRPCAddr:   "127.0.0.1:0",
+		SinglePort: true,
+		OnListening: func(httpAddr, grpcAddr net.Addr) {
+			if grpcAddr.String() != httpAddr.String() {
+				t.Errorf("single-port mode should report one address, got %s and %s", httpAddr, grpcAddr)
+			}
+			addrs <- httpAddr
+		},
+	})
+
+	var addr net.Addr
+	select {
+	case addr = <-addrs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not start listening")
+	}
+
+	conn, err := grpc.Dial(addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := ladderpb.NewLadderServiceClient(conn).AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("gRPC on the HTTP port failed: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr.String() + "/api/players")
+	if err != nil {
+		t.Fatalf("REST on the same port failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Players []struct{ Name string } `json:"players"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.Players) != 1 || body.Players[0].Name != "Alice" {
+		t.Errorf("unexpected REST response: %+v", body)
+	}
+}
+
+func TestRun_DebugVarsNeedAdminToken(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ladder_run_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	addrs := make(chan net.Addr, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Run(Config{
+		Stop:       stop,
+		DataPath:   filepath.Join(dir, "ladder.log"),
+		HTTPAddr:   "127.0.0.1:0",
+		GRPCAddr:   "127.0.0.1:0",
+		AdminToken: "secret",
+		OnListening: func(httpAddr, grpcAddr net.Addr) {
+			addrs <- httpAddr
+		},
+	})
+
+	var addr net.Addr
+	select {
+	case addr = <-addrs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not start listening")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "guess", http.StatusUnauthorized},
+		{"admin token", "secret", http.StatusOK},
+	} {
+		req, _ := http.NewRequest("GET", "http://"+addr.String()+"/debug/vars", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package scoring checks squash scores against a ladder's scoring format.
+//
+// It has no dependencies beyond the generated protos, so the same code runs in the
+// server and, compiled to WebAssembly, in the web client.
+package scoring
+
+import (
+	"fmt"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// Error is a score that breaks the rules. Format and Args are kept apart so the
+// server can translate the message.
+type Error struct {
+	Format string
+	Args   []interface{}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(e.Format, e.Args...)
+}
+
+func errorf(format string, args ...interface{}) error {
+	return &Error{Format: format, Args: args}
+}
+
+// FormatRules returns the sets needed to win and the points needed to win a set
+func FormatRules(format ladderpb.ScoringFormat) (setsToWin, setPoints int) {
+	switch format {
+	case ladderpb.ScoringFormat_BEST_OF_3_PAR_11:
+		return 2, 11
+	case ladderpb.ScoringFormat_BEST_OF_5_PAR_15:
+		return 3, 15
+	}
+	return 3, 11
+}
+
+// Validate checks set scores against format and returns the winner, 1 for the
+// challenger or 2 for the defender
+func Validate(setScores []*ladderpb.SetScore, format ladderpb.ScoringFormat) (int, error) {
+	setsToWin, setPoints := FormatRules(format)
+	p1Sets := 0
+	p2Sets := 0
+
+	for i, s := range setScores {
+		isLastSet := i == len(setScores)-1
+
+		// Nothing can follow the set that decided the match
+		if p1Sets == setsToWin || p2Sets == setsToWin {
+			return 0, errorf("too many sets won")
+		}
+
+		if s.ChallengerDefault || s.DefenderDefault {
+			if !isLastSet {
+				return 0, errorf("defaulting player must happen in the final set")
+			}
+			if s.ChallengerDefault && s.DefenderDefault {
+				return 0, errorf("both players cannot default")
+			}
+			// Valid default in final set
+			if s.ChallengerDefault {
+				// Challenger defaulted, Defender wins
+				return 2, nil
+			}
+			// Defender defaulted, Challenger wins
+			return 1, nil
+		}
+
+		challengerPoints := int(s.ChallengerPoints)
+		defenderPoints := int(s.DefenderPoints)
+
+		// Validate set rules: to setPoints, win by 2
+		if challengerPoints < 0 || defenderPoints < 0 {
+			return 0, errorf("scores cannot be negative")
+		}
+
+		if challengerPoints < setPoints && defenderPoints < setPoints {
+			return 0, errorf("set must go to at least %d: %d-%d", setPoints, challengerPoints, defenderPoints)
+		}
+
+		diff := challengerPoints - defenderPoints
+		if diff < 0 {
+			diff = -diff
+		}
+
+		if diff < 2 {
+			return 0, errorf("must win by 2 points: %d-%d", challengerPoints, defenderPoints)
+		}
+
+		// Determine winner of set
+		if challengerPoints > defenderPoints {
+			p1Sets++
+		} else {
+			p2Sets++
+		}
+	}
+
+	// Best of 2*setsToWin-1 (first to setsToWin)
+	if p1Sets == setsToWin {
+		return 1, nil
+	}
+	if p2Sets == setsToWin {
+		return 2, nil
+	}
+
+	return 0, errorf("match must have a clear winner (first to %d sets)", setsToWin)
+}
+
+// ValidateHandicap checks scores entered as points won on court, after adding each
+// side's head start to every set
+func ValidateHandicap(setScores []*ladderpb.SetScore, format ladderpb.ScoringFormat, challengerStart, defenderStart int32) (int, error) {
+	if challengerStart == 0 && defenderStart == 0 {
+		return Validate(setScores, format)
+	}
+
+	adjusted := make([]*ladderpb.SetScore, len(setScores))
+	for i, s := range setScores {
+		adjusted[i] = &ladderpb.SetScore{
+			ChallengerPoints:  s.ChallengerPoints + challengerStart,
+			DefenderPoints:    s.DefenderPoints + defenderStart,
+			ChallengerDefault: s.ChallengerDefault,
+			DefenderDefault:   s.DefenderDefault,
+		}
+	}
+	return Validate(adjusted, format)
+}
+
+// HandicapStarts returns the per-set head start each side receives. Only the
+// difference between the two handicaps matters, so at most one side gets a start.
+func HandicapStarts(players []*ladderpb.Player, challengerID, defenderID string) (challengerStart, defenderStart int32) {
+	var ch, dh int32
+	for _, p := range players {
+		if p.Id == challengerID {
+			ch = p.Handicap
+		}
+		if p.Id == defenderID {
+			dh = p.Handicap
+		}
+	}
+	if ch > dh {
+		return ch - dh, 0
+	}
+	return 0, dh - ch
+}
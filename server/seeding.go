@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+)
+
+// Header names recognised in ratings imports, lowercased
+var (
+	importIDColumns        = []string{"id", "player id", "player_id", "email", "e-mail", "email address"}
+	importNameColumns      = []string{"name", "player", "player name", "full name"}
+	importFirstNameColumns = []string{"first name", "firstname", "first_name", "first"}
+	importLastNameColumns  = []string{"last name", "lastname", "last_name", "surname", "last"}
+	importRatingColumns    = []string{"rating", "points", "ranking points", "level"} // Higher is better
+	importRankColumns      = []string{"rank", "ranking", "position", "pos"}          // Lower is better
+)
+
+// importedRating is one row of a ratings import
+type importedRating struct {
+	line  int
+	id    string
+	name  string
+	value float64
+}
+
+// parseRatingsImport reads a CSV ratings export and returns its rows best first
+func parseRatingsImport(data []byte) ([]importedRating, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("import needs a header row and at least one player")
+	}
+
+	header := make(map[string]int)
+	for i, h := range records[0] {
+		header[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	column := func(names []string) int {
+		for _, n := range names {
+			if i, ok := header[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	idCol, nameCol := column(importIDColumns), column(importNameColumns)
+	firstCol, lastCol := column(importFirstNameColumns), column(importLastNameColumns)
+	valueCol, higherIsBetter := column(importRatingColumns), true
+	if valueCol == -1 {
+		valueCol, higherIsBetter = column(importRankColumns), false
+	}
+	if idCol == -1 && nameCol == -1 && (firstCol == -1 || lastCol == -1) {
+		return nil, fmt.Errorf("import needs an id, email or name column")
+	}
+	if valueCol == -1 {
+		return nil, fmt.Errorf("import needs a rating, points or rank column")
+	}
+
+	field := func(rec []string, i int) string {
+		if i < 0 || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var rows []importedRating
+	for n, rec := range records[1:] {
+		row := importedRating{line: n + 2, id: field(rec, idCol), name: field(rec, nameCol)}
+		if row.name == "" && firstCol != -1 {
+			row.name = strings.TrimSpace(field(rec, firstCol) + " " + field(rec, lastCol))
+		}
+		raw := field(rec, valueCol)
+		if row.id == "" && row.name == "" && raw == "" {
+			continue // Blank line
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s %q", row.line, records[0][valueCol], raw)
+		}
+		row.value = v
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if higherIsBetter {
+			return rows[i].value > rows[j].value
+		}
+		return rows[i].value < rows[j].value
+	})
+	return rows, nil
+}
+
+// normalizeName folds case and whitespace so "  alice  SMITH" matches "Alice Smith"
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// SeedFromRatings reorders the ladder by an imported ratings file and records it as a
+// REORDER transaction noting source. Players not in the import keep their relative
+// order below the seeded ones. Rows that match no player, or a player already matched,
+// are returned as unmatched. With dryRun the new order is computed but not written.
+func (m *Model) SeedFromRatings(data []byte, source string, dryRun bool) (string, []*ladderpb.Player, []string, error) {
+	rows, err := parseRatingsImport(data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if strings.TrimSpace(source) == "" {
+		source = "ratings import"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	byID := make(map[string]string)
+	byName := make(map[string][]string)
+	for _, p := range currentPlayers {
+		byID[strings.ToLower(p.Id)] = p.Id
+		key := normalizeName(p.Name)
+		byName[key] = append(byName[key], p.Id)
+	}
+
+	seeded := make(map[string]bool)
+	order := []string{}
+	unmatched := []string{}
+	for _, row := range rows {
+		id := byID[strings.ToLower(row.id)]
+		if id == "" {
+			// Names shared by several players are ambiguous and left unmatched
+			if ids := byName[normalizeName(row.name)]; len(ids) == 1 {
+				id = ids[0]
+			}
+		}
+		if id == "" || seeded[id] {
+			label := row.name
+			if label == "" {
+				label = row.id
+			}
+			unmatched = append(unmatched, fmt.Sprintf("line %d: %s", row.line, label))
+			continue
+		}
+		seeded[id] = true
+		order = append(order, id)
+	}
+	if len(order) == 0 {
+		return "", nil, unmatched, fmt.Errorf("no rows in the import matched a player")
+	}
+
+	payload := &storagepb.ReorderStorage{PlayerIds: order, Source: source}
+	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_REORDER, payload, currentPlayers)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if dryRun {
+		return "", newPlayers, unmatched, nil
+	}
+
+	txID, err := m.writeReorderLocked(payload, newPlayers)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return txID, newPlayers, unmatched, nil
+}
+
+// Reorder moves the listed players to the top of the ladder in the given order and
+// records it as a REORDER transaction noting source. Players not listed keep their
+// relative order below them.
+func (m *Model) Reorder(playerIDs []string, source string) (string, []*ladderpb.Player, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return "", nil, err
+	}
+	payload := &storagepb.ReorderStorage{PlayerIds: playerIDs, Source: source}
+	newPlayers, err := m.applyTransactionLogic(storagepb.TransactionType_REORDER, payload, currentPlayers)
+	if err != nil {
+		return "", nil, err
+	}
+	txID, err := m.writeReorderLocked(payload, newPlayers)
+	if err != nil {
+		return "", nil, err
+	}
+	return txID, newPlayers, nil
+}
+
+// writeReorderLocked appends a REORDER leaving newPlayers. The caller must hold m.mu.
+func (m *Model) writeReorderLocked(payload *storagepb.ReorderStorage, newPlayers []*ladderpb.Player) (string, error) {
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_REORDER,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_ReorderPayload{ReorderPayload: payload},
+		PlayerList:  ladderToStorage(newPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return "", err
+	}
+	return tx.Id, nil
+}
+
+// SeedLadder reorders the ladder from an imported ratings file
+func (h *LadderService) SeedLadder(ctx context.Context, req *ladderpb.SeedLadderRequest) (*ladderpb.SeedLadderResponse, error) {
+	txID, players, unmatched, err := h.modelFor(ctx).SeedFromRatings(req.RatingsCsv, req.Source, req.DryRun)
+	if err != nil {
+		return &ladderpb.SeedLadderResponse{Success: false, Unmatched: unmatched}, err
+	}
+	return &ladderpb.SeedLadderResponse{
+		Success:       true,
+		TransactionId: txID,
+		Players:       players,
+		Unmatched:     unmatched,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestModel_SeedFromRatings(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice Smith", "alice@example.org")
+	m.AddPlayer("Bob Jones", "bob")
+	m.AddPlayer("Charlie Brown", "charlie")
+	m.AddPlayer("Dave Green", "dave")
+
+	csv := "First Name,Last Name,Email,Rating\n" +
+		"Charlie,Brown,,4.2\n" +
+		"Someone,Else,,5.0\n" +
+		"Alice,SMITH,alice@example.org,3.1\n" +
+		"bob,  jones,,3.9\n"
+
+	_, preview, unmatched, err := m.SeedFromRatings([]byte(csv), "ClubLocker export", true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(unmatched) != 1 || unmatched[0] != "line 3: Someone Else" {
+		t.Errorf("expected one unmatched row, got %v", unmatched)
+	}
+	if m.ListPlayers()[0].Id != "alice@example.org" {
+		t.Error("dry run must not change the ladder")
+	}
+
+	txID, players, _, err := m.SeedFromRatings([]byte(csv), "ClubLocker export", false)
+	if err != nil {
+		t.Fatalf("SeedFromRatings failed: %v", err)
+	}
+	want := []string{"charlie", "bob", "alice@example.org", "dave"}
+	for i, id := range want {
+		if players[i].Id != id || preview[i].Id != id || players[i].Rank != int32(i+1) {
+			t.Errorf("position %d: expected %s, got %+v", i+1, id, players[i])
+		}
+	}
+	if got := m.ListPlayers(); got[0].Id != "charlie" || got[3].Id != "dave" {
+		t.Errorf("ladder not reordered: %+v", got)
+	}
+
+	detail, err := m.GetTransaction(context.Background(), txID)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if detail.Summary.Summary != "Ladder reordered from ClubLocker export (3 players seeded)" {
+		t.Errorf("unexpected summary %q", detail.Summary.Summary)
+	}
+	if report, _ := m.VerifyLog(context.Background(), false); !report.OK() {
+		t.Errorf("REORDER does not replay: %+v", report.Mismatches)
+	}
+
+	// Ranks are ordered lowest first
+	if _, _, _, err := m.SeedFromRatings([]byte("Name,Rank\nDave Green,1\nAlice Smith,2\n"), "", false); err != nil {
+		t.Fatalf("seeding by rank failed: %v", err)
+	}
+	if got := m.ListPlayers(); got[0].Id != "dave" || got[1].Id != "alice@example.org" || got[2].Id != "charlie" {
+		t.Errorf("unexpected order after rank import: %v, %v, %v", got[0].Id, got[1].Id, got[2].Id)
+	}
+
+	if _, _, _, err := m.SeedFromRatings([]byte("Name,Club\nDave,Riverside\n"), "", false); err == nil {
+		t.Error("expected an error for an import without a rating column")
+	}
+}
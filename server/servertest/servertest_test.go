@@ -0,0 +1,91 @@
+package servertest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"squash-ladder/server"
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStart(t *testing.T) {
+	s := Start(t, WithAdminToken("secret"))
+	ctx := context.Background()
+
+	if _, err := s.Client.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Alice", PlayerId: "alice"}); err != nil {
+		t.Fatalf("AddPlayer failed: %v", err)
+	}
+
+	resp, err := http.Get(s.HTTPURL + "/api/players")
+	if err != nil {
+		t.Fatalf("GET /api/players failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Players []struct{ ID string } `json:"players"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.Players) != 1 || body.Players[0].ID != "alice" {
+		t.Errorf("unexpected REST response: %+v", body)
+	}
+
+	if _, err := s.Client.VerifyIntegrity(ctx, &ladderpb.VerifyIntegrityRequest{}); err == nil {
+		t.Error("admin RPC without token should fail")
+	}
+	if _, err := s.Client.VerifyIntegrity(s.AdminContext(ctx), &ladderpb.VerifyIntegrityRequest{}); err != nil {
+		t.Errorf("admin RPC with token failed: %v", err)
+	}
+
+	s.Close()
+	if _, err := http.Get(s.HTTPURL + "/api/players"); err == nil {
+		t.Error("server should not accept connections after Close")
+	}
+}
+
+func TestStart_Middleware(t *testing.T) {
+	var httpRequests atomic.Int32
+	s := Start(t, func(cfg *server.Config) {
+		cfg.UnaryInterceptors = []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if info.FullMethod == "/ladder.LadderService/RemovePlayer" {
+					return nil, status.Error(codes.PermissionDenied, "removals are handled by the membership system")
+				}
+				return handler(ctx, req)
+			},
+		}
+		cfg.HTTPMiddleware = []func(http.Handler) http.Handler{
+			func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					httpRequests.Add(1)
+					w.Header().Set("X-Tenant", "north")
+					next.ServeHTTP(w, r)
+				})
+			},
+		}
+	})
+	ctx := context.Background()
+
+	if _, err := s.Client.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Alice", PlayerId: "alice"}); err != nil {
+		t.Fatalf("AddPlayer failed: %v", err)
+	}
+	_, err := s.Client.RemovePlayer(ctx, &ladderpb.RemovePlayerRequest{PlayerId: "alice"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected the interceptor to refuse RemovePlayer, got %v", err)
+	}
+
+	resp, err := http.Get(s.HTTPURL + "/api/players")
+	if err != nil {
+		t.Fatalf("GET /api/players failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Tenant") != "north" || httpRequests.Load() != 1 {
+		t.Errorf("expected the middleware to wrap the request, got header %q after %d requests", resp.Header.Get("X-Tenant"), httpRequests.Load())
+	}
+}
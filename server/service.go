@@ -2,15 +2,41 @@ package server
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
+	"runtime"
+	"time"
 
 	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/scoring"
+	"squash-ladder/server/version"
+
+	"google.golang.org/grpc/codes"
 )
 
 // LadderService implements the LadderService gRPC service
 type LadderService struct {
 	ladderpb.UnimplementedLadderServiceServer
 	model *Model
+	clubs *ClubRegistry // nil unless multi-club mode is enabled
+	sync  *SyncJob      // nil unless a results sync is configured
+
+	playerAuth  *PlayerAuth        // nil unless player tokens are enabled
+	notifier    *Notifier          // nil unless player notifications are enabled
+	wallet      *WalletPasses      // nil unless wallet passes are enabled
+	attachments *Attachments       // nil unless match attachments are enabled
+	sms         *SMSHandler        // nil unless SMS result entry is enabled
+	telegram    *TelegramBot       // nil unless the Telegram bot is running
+	settings    *liveSettings      // nil unless started by Run
+	apiKeys     *APIKeys           // nil unless started by Run
+	auditKey    ed25519.PrivateKey // nil unless an audit signing key is set
+	locale      string             // Language for callers without a preference; empty is English
+
+	// recordClientAddresses stores callers' addresses on transactions; principals and
+	// client types are always stored
+	recordClientAddresses bool
 }
 
 // NewLadderService creates a new ladder service handler
@@ -20,17 +46,45 @@ func NewLadderService(m *Model) *LadderService {
 	}
 }
 
+// modelFor returns the club model resolved for this request, falling back to
+// the default ladder when the server is not running in multi-club mode
+func (h *LadderService) modelFor(ctx context.Context) *Model {
+	m, ok := ctx.Value(clubModelKey{}).(*Model)
+	if !ok {
+		m = h.model
+	}
+	return m.withClient(clientFrom(ctx))
+}
+
 // ListPlayers returns all players ordered by rank
 func (h *LadderService) ListPlayers(ctx context.Context, req *ladderpb.ListPlayersRequest) (*ladderpb.ListPlayersResponse, error) {
-	players := h.model.ListPlayers()
+	players := h.modelFor(ctx).ListPlayers()
+	if isPublicView(ctx) {
+		players = maskPlayers(players)
+	}
 	return &ladderpb.ListPlayersResponse{
-		Players: players,
+		Players: filterByCategory(players, req.Category),
 	}, nil
 }
 
 // AddPlayer adds a new player
 func (h *LadderService) AddPlayer(ctx context.Context, req *ladderpb.AddPlayerRequest) (*ladderpb.AddPlayerResponse, error) {
-	player, err := h.model.AddPlayer(req.Name, req.PlayerId)
+	m := h.modelFor(ctx)
+	pending, err := h.checkJoinPolicy(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		r, err := m.RequestToJoin(req.Name, req.PlayerId, req.Category)
+		if err != nil {
+			return nil, err
+		}
+		return &ladderpb.AddPlayerResponse{
+			Player:          &ladderpb.Player{Id: r.PlayerId, Name: r.Name, Category: r.Category},
+			PendingApproval: true,
+		}, nil
+	}
+	player, err := m.AddPlayerInCategory(req.Name, req.PlayerId, req.Category)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +93,7 @@ func (h *LadderService) AddPlayer(ctx context.Context, req *ladderpb.AddPlayerRe
 
 // RemovePlayer removes a player
 func (h *LadderService) RemovePlayer(ctx context.Context, req *ladderpb.RemovePlayerRequest) (*ladderpb.RemovePlayerResponse, error) {
-	err := h.model.RemovePlayer(req.PlayerId)
+	err := h.modelFor(ctx).RemovePlayer(req.PlayerId)
 	if err != nil {
 		return &ladderpb.RemovePlayerResponse{Success: false}, err
 	}
@@ -48,80 +102,155 @@ func (h *LadderService) RemovePlayer(ctx context.Context, req *ladderpb.RemovePl
 
 // ValidateScore validates squash scoring rules and returns the winner (1 or 2)
 func ValidateScore(setScores []*ladderpb.SetScore) (int, error) {
-	p1Sets := 0
-	p2Sets := 0
+	return ValidateScoreFormat(setScores, ladderpb.ScoringFormat_BEST_OF_5_PAR_11)
+}
 
-	for i, s := range setScores {
-		isLastSet := i == len(setScores)-1
+// scoringFormatRules returns the sets needed to win and the points needed to win a set
+func scoringFormatRules(format ladderpb.ScoringFormat) (setsToWin, setPoints int) {
+	return scoring.FormatRules(format)
+}
 
-		if s.ChallengerDefault || s.DefenderDefault {
-			if !isLastSet {
-				return 0, fmt.Errorf("defaulting player must happen in the final set")
-			}
-			if s.ChallengerDefault && s.DefenderDefault {
-				return 0, fmt.Errorf("both players cannot default")
-			}
-			// Valid default in final set
-			if s.ChallengerDefault {
-				// Challenger defaulted, Defender wins
-				return 2, nil
-			}
-			// Defender defaulted, Challenger wins
-			return 1, nil
-		}
+// ValidateScoreFormat validates set scores against the given scoring format and
+// returns the winner (1 or 2)
+func ValidateScoreFormat(setScores []*ladderpb.SetScore, format ladderpb.ScoringFormat) (int, error) {
+	return localizeScoringError(scoring.Validate(setScores, format))
+}
 
-		challengerPoints := int(s.ChallengerPoints)
-		defenderPoints := int(s.DefenderPoints)
+// localizeScoringError turns a rule broken by a score into a catalog message
+func localizeScoringError(winner int, err error) (int, error) {
+	var sErr *scoring.Error
+	if errors.As(err, &sErr) {
+		return winner, localizedErrorf(sErr.Format, sErr.Args...)
+	}
+	return winner, err
+}
 
-		// Validate set rules: to 11, win by 2
-		if challengerPoints < 0 || defenderPoints < 0 {
-			return 0, fmt.Errorf("scores cannot be negative")
+// validateSetDetail checks the optional point-by-point detail of each set: every
+// point has a winner and, unless the set ended in a default, they add up to its score
+func validateSetDetail(setScores []*ladderpb.SetScore) error {
+	for i, s := range setScores {
+		if s.DurationSeconds < 0 {
+			return localizedStatusf(codes.InvalidArgument, "set duration cannot be negative")
 		}
-
-		if challengerPoints < 11 && defenderPoints < 11 {
-			return 0, fmt.Errorf("set must go to at least 11: %d-%d", challengerPoints, defenderPoints)
+		if len(s.Points) == 0 {
+			continue
 		}
-
-		diff := challengerPoints - defenderPoints
-		if diff < 0 {
-			diff = -diff
+		var challenger, defender int32
+		for _, p := range s.Points {
+			switch p {
+			case ladderpb.PointWinner_POINT_CHALLENGER:
+				challenger++
+			case ladderpb.PointWinner_POINT_DEFENDER:
+				defender++
+			default:
+				return localizedStatusf(codes.InvalidArgument, "set %d: every point needs a winner", i+1)
+			}
 		}
-
-		if diff < 2 {
-			return 0, fmt.Errorf("must win by 2 points: %d-%d", challengerPoints, defenderPoints)
+		if s.ChallengerDefault || s.DefenderDefault {
+			continue
 		}
-
-		// Determine winner of set
-		if challengerPoints > defenderPoints {
-			p1Sets++
-		} else {
-			p2Sets++
+		if challenger != s.ChallengerPoints || defender != s.DefenderPoints {
+			return localizedStatusf(codes.InvalidArgument, "set %d: the points add up to %d-%d but the score is %d-%d",
+				i+1, challenger, defender, s.ChallengerPoints, s.DefenderPoints)
 		}
 	}
+	return nil
+}
 
-	// Best of 5 (first to 3)
-	if p1Sets > 3 || p2Sets > 3 {
-		return 0, fmt.Errorf("too many sets won")
-	}
+// maxPlayedAtSkew allows for clients whose clocks run slightly ahead
+const maxPlayedAtSkew = 5 * time.Minute
 
-	if p1Sets == 3 {
-		return 1, nil
+// parsePlayedAt reads a played_at time, which must carry its UTC offset so that
+// players in different zones agree on it; empty means now and returns the zero time
+func parsePlayedAt(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, localizedStatusf(codes.InvalidArgument, "played_at must be an RFC 3339 time with an offset, e.g. 2024-03-02T19:30:00+01:00")
 	}
-	if p2Sets == 3 {
-		return 2, nil
+	if t.After(now.Add(maxPlayedAtSkew)) {
+		return time.Time{}, localizedStatusf(codes.InvalidArgument, "played_at cannot be in the future")
 	}
+	return t.UTC(), nil
+}
 
-	return 0, fmt.Errorf("match must have a clear winner (first to 3 sets)")
+// isLateEntry reports whether a match played at playedAt is entered after the rules'
+// entry deadline; a zero playedAt is a match played now
+func isLateEntry(rules *ladderpb.LadderRules, playedAt, now time.Time) bool {
+	if rules.EntryDeadlineDays <= 0 || playedAt.IsZero() {
+		return false
+	}
+	return now.Sub(playedAt) > time.Duration(rules.EntryDeadlineDays)*24*time.Hour
 }
 
 // AddMatchResult records a match result
 func (h *LadderService) AddMatchResult(ctx context.Context, req *ladderpb.AddMatchResultRequest) (*ladderpb.AddMatchResultResponse, error) {
+	model := h.modelFor(ctx)
+	rules, err := model.GetLadderRules()
+	if err != nil {
+		return &ladderpb.AddMatchResultResponse{Success: false}, err
+	}
+	playedAt, err := parsePlayedAt(req.PlayedAt, model.now())
+	if err != nil {
+		return &ladderpb.AddMatchResultResponse{Success: false}, err
+	}
+	late := isLateEntry(rules, playedAt, model.now())
+	friendly := req.CountsForLadder != nil && !req.GetCountsForLadder()
+	setScores := req.SetScores
+	if req.ScoresString != "" {
+		if len(setScores) > 0 {
+			return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.InvalidArgument, "give either set_scores or scores_string, not both")
+		}
+		if setScores, err = parseScoresString(req.ScoresString); err != nil {
+			return &ladderpb.AddMatchResultResponse{Success: false}, err
+		}
+	}
+	if req.LateEntryOverride && !isAdmin(ctx) {
+		return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.PermissionDenied, "only an admin can override the entry deadline")
+	}
+	if req.RetroactiveInsert && !isAdmin(ctx) {
+		return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.PermissionDenied, "only an admin can insert a result retroactively")
+	}
+	if req.RetroactiveInsert && playedAt.IsZero() {
+		return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.InvalidArgument, "retroactive_insert needs played_at")
+	}
+	if req.RetroactiveInsert && friendly {
+		return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.InvalidArgument, "a friendly moves nobody, so it cannot be inserted retroactively")
+	}
+	if late && !req.LateEntryOverride {
+		return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.FailedPrecondition, "results must be entered within %d days of being played; ask an admin to enter this one", rules.EntryDeadlineDays)
+	}
+
+	players := model.ListPlayers()
+	at := playedAt
+	if at.IsZero() {
+		at = model.now()
+	}
+	if defender := findPlayer(players, req.DefenderId); defender != nil && !friendly && protectedAt(defender, at) {
+		return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.FailedPrecondition, "%s is protected from challenges through %s",
+			defender.Name, time.UnixMilli(defender.ProtectedUntilMs-1).In(model.TimeZone()).Format("2006-01-02"))
+	}
+	if rules.UpwardChallengesOnly && !req.ReversalOverride && !friendly {
+		challenger, defender := findPlayer(players, req.ChallengerId), findPlayer(players, req.DefenderId)
+		// Qualification matches of provisional players aren't challenges
+		if challenger != nil && defender != nil && !challenger.Provisional && !defender.Provisional && challenger.Rank < defender.Rank {
+			return &ladderpb.AddMatchResultResponse{Success: false}, localizedStatusf(codes.FailedPrecondition, "%s is ranked above %s; set reversal_override to record a friendly reversal",
+				challenger.Name, defender.Name)
+		}
+	}
+	challengerStart, defenderStart := handicapStarts(players, req.ChallengerId, req.DefenderId)
+
 	// Validate score
 	// Validate score covers defaults and calculates winner
-	winnerIdx, err := ValidateScore(req.SetScores)
+	winnerIdx, err := ValidateScoreHandicap(setScores, rules.ScoringFormat, challengerStart, defenderStart)
 	if err != nil {
 		return &ladderpb.AddMatchResultResponse{Success: false}, err
 	}
+	if err := validateSetDetail(setScores); err != nil {
+		return &ladderpb.AddMatchResultResponse{Success: false}, err
+	}
 
 	// Double check winner matches the score calculation
 	// 1 = Challenger, 2 = Defender
@@ -132,25 +261,58 @@ func (h *LadderService) AddMatchResult(ctx context.Context, req *ladderpb.AddMat
 		return &ladderpb.AddMatchResultResponse{Success: false}, fmt.Errorf("scores indicate defender won, but winner_id does not match defender")
 	}
 
-	txID, err := h.model.AddMatchResult(req.ChallengerId, req.DefenderId, req.WinnerId, req.SetScores)
+	var txID string
+	if req.RetroactiveInsert {
+		txID, err = model.InsertMatchResultAt(ctx, req.ChallengerId, req.DefenderId, req.WinnerId, setScores, playedAt, late)
+	} else {
+		txID, err = model.AddMatchResultAt(req.ChallengerId, req.DefenderId, req.WinnerId, setScores, playedAt, late, friendly)
+	}
 	if err != nil {
 		return &ladderpb.AddMatchResultResponse{Success: false}, err
 	}
-	return &ladderpb.AddMatchResultResponse{Success: true, TransactionId: txID}, nil
+
+	resp := &ladderpb.AddMatchResultResponse{Success: true, TransactionId: txID}
+	if change, err := model.MatchRatingChange(txID); err == nil {
+		resp.ChallengerRatingDelta = change.ChallengerDelta
+		resp.DefenderRatingDelta = change.DefenderDelta
+	}
+	return resp, nil
 }
 
-// InvalidateMatchResult invalidates a match result
+// InvalidateMatchResult invalidates a match result, or shows what that would do on a
+// dry run
 func (h *LadderService) InvalidateMatchResult(ctx context.Context, req *ladderpb.InvalidateMatchResultRequest) (*ladderpb.InvalidateMatchResultResponse, error) {
-	err := h.model.InvalidateMatchResult(req.TransactionId)
+	if req.DryRun {
+		preview, err := h.modelFor(ctx).PreviewInvalidation(ctx, []string{req.TransactionId})
+		if err != nil {
+			return nil, err
+		}
+		return &ladderpb.InvalidateMatchResultResponse{
+			Success:         true,
+			Players:         preview.Players,
+			Moved:           preview.Moved,
+			AffectedMatches: preview.Affected,
+		}, nil
+	}
+	err := h.modelFor(ctx).InvalidateMatchResult(ctx, req.TransactionId)
 	if err != nil {
 		return &ladderpb.InvalidateMatchResultResponse{Success: false}, err
 	}
 	return &ladderpb.InvalidateMatchResultResponse{Success: true}, nil
 }
 
+// InvalidateMatchResults invalidates several match results at once
+func (h *LadderService) InvalidateMatchResults(ctx context.Context, req *ladderpb.InvalidateMatchResultsRequest) (*ladderpb.InvalidateMatchResultsResponse, error) {
+	txID, err := h.modelFor(ctx).InvalidateMatchResults(ctx, req.TransactionIds)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.InvalidateMatchResultsResponse{TransactionId: txID}, nil
+}
+
 // ListRecentMatches returns the last n matches
 func (h *LadderService) ListRecentMatches(ctx context.Context, req *ladderpb.ListRecentMatchesRequest) (*ladderpb.ListRecentMatchesResponse, error) {
-	matches, err := h.model.GetRecentMatches(req.Limit)
+	matches, err := h.modelFor(ctx).GetRecentMatches(req.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -158,3 +320,132 @@ func (h *LadderService) ListRecentMatches(ctx context.Context, req *ladderpb.Lis
 		Results: matches,
 	}, nil
 }
+
+// GetVersion returns the running server's version and build details
+func (h *LadderService) GetVersion(ctx context.Context, req *ladderpb.GetVersionRequest) (*ladderpb.GetVersionResponse, error) {
+	return &ladderpb.GetVersionResponse{
+		Version:   version.Version,
+		Commit:    version.Commit,
+		BuildDate: version.BuildDate,
+		GoVersion: runtime.Version(),
+	}, nil
+}
+
+// VerifyIntegrity replays the log and reports snapshot divergences
+func (h *LadderService) VerifyIntegrity(ctx context.Context, req *ladderpb.VerifyIntegrityRequest) (*ladderpb.VerifyIntegrityResponse, error) {
+	report, err := h.modelFor(ctx).VerifyLog(ctx, req.Repair)
+	if err != nil {
+		return nil, err
+	}
+	return integrityReportToProto(report), nil
+}
+
+func integrityReportToProto(report *IntegrityReport) *ladderpb.VerifyIntegrityResponse {
+	mismatches := make([]*ladderpb.IntegrityMismatch, len(report.Mismatches))
+	for i, mm := range report.Mismatches {
+		mismatches[i] = &ladderpb.IntegrityMismatch{
+			Index:           int32(mm.Index),
+			TransactionId:   mm.TransactionID,
+			TransactionType: mm.Type.String(),
+			Reason:          mm.Reason,
+		}
+	}
+	return &ladderpb.VerifyIntegrityResponse{
+		TransactionsChecked: int32(report.TransactionsChecked),
+		Mismatches:          mismatches,
+		Repaired:            report.Repaired,
+		CheckedAtMs:         report.CheckedAt.UnixMilli(),
+	}
+}
+
+// ListTransactions returns a page of the transaction history
+func (h *LadderService) ListTransactions(ctx context.Context, req *ladderpb.ListTransactionsRequest) (*ladderpb.ListTransactionsResponse, error) {
+	types := make([]storagepb.TransactionType, 0, len(req.TypeFilter))
+	for _, name := range req.TypeFilter {
+		v, ok := storagepb.TransactionType_value[name]
+		if !ok {
+			return nil, localizedStatusf(codes.InvalidArgument, "unknown transaction type: %s", name)
+		}
+		types = append(types, storagepb.TransactionType(v))
+	}
+
+	txs, next, err := h.modelFor(ctx).ListTransactions(ctx, req.Limit, req.Cursor, types)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListTransactionsResponse{
+		Transactions: txs,
+		NextCursor:   next,
+	}, nil
+}
+
+// GetTransaction returns the full detail of a transaction
+func (h *LadderService) GetTransaction(ctx context.Context, req *ladderpb.GetTransactionRequest) (*ladderpb.GetTransactionResponse, error) {
+	detail, err := h.modelFor(ctx).GetTransaction(ctx, req.TransactionId)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.GetTransactionResponse{Transaction: detail}, nil
+}
+
+// UndoLastTransaction invalidates the most recent transaction that can be undone
+func (h *LadderService) UndoLastTransaction(ctx context.Context, req *ladderpb.UndoLastTransactionRequest) (*ladderpb.UndoLastTransactionResponse, error) {
+	undone, txID, err := h.modelFor(ctx).UndoLastTransaction(ctx)
+	if err != nil {
+		return &ladderpb.UndoLastTransactionResponse{Success: false}, err
+	}
+	return &ladderpb.UndoLastTransactionResponse{
+		Success:             true,
+		UndoneTransactionId: undone.Id,
+		UndoneType:          undone.Type.String(),
+		TransactionId:       txID,
+	}, nil
+}
+
+// GetLadderRules returns the active rule set
+func (h *LadderService) GetLadderRules(ctx context.Context, req *ladderpb.GetLadderRulesRequest) (*ladderpb.GetLadderRulesResponse, error) {
+	rules, err := h.modelFor(ctx).GetLadderRules()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.GetLadderRulesResponse{Rules: rules}, nil
+}
+
+// SetLadderRules records a new rule set
+func (h *LadderService) SetLadderRules(ctx context.Context, req *ladderpb.SetLadderRulesRequest) (*ladderpb.SetLadderRulesResponse, error) {
+	txID, err := h.modelFor(ctx).SetLadderRules(req.Rules)
+	if err != nil {
+		return &ladderpb.SetLadderRulesResponse{Success: false}, err
+	}
+	return &ladderpb.SetLadderRulesResponse{Success: true, TransactionId: txID}, nil
+}
+
+// GetRatingHistory returns a player's Elo rating history
+func (h *LadderService) GetRatingHistory(ctx context.Context, req *ladderpb.GetRatingHistoryRequest) (*ladderpb.GetRatingHistoryResponse, error) {
+	current, history, err := h.modelFor(ctx).GetRatingHistory(ctx, req.PlayerId)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.GetRatingHistoryResponse{
+		CurrentRating: current,
+		History:       history,
+	}, nil
+}
+
+// SetPlayerHandicap sets a player's per-set head start
+func (h *LadderService) SetPlayerHandicap(ctx context.Context, req *ladderpb.SetPlayerHandicapRequest) (*ladderpb.SetPlayerHandicapResponse, error) {
+	txID, err := h.modelFor(ctx).SetPlayerHandicap(req.PlayerId, req.Handicap)
+	if err != nil {
+		return &ladderpb.SetPlayerHandicapResponse{Success: false}, err
+	}
+	return &ladderpb.SetPlayerHandicapResponse{Success: true, TransactionId: txID}, nil
+}
+
+// SetPlayerCategory moves a player into a category
+func (h *LadderService) SetPlayerCategory(ctx context.Context, req *ladderpb.SetPlayerCategoryRequest) (*ladderpb.SetPlayerCategoryResponse, error) {
+	txID, err := h.modelFor(ctx).SetPlayerCategory(req.PlayerId, req.Category)
+	if err != nil {
+		return &ladderpb.SetPlayerCategoryResponse{Success: false}, err
+	}
+	return &ladderpb.SetPlayerCategoryResponse{Success: true, TransactionId: txID}, nil
+}
@@ -3,9 +3,18 @@ package server
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	ladderpb "squash-ladder/server/gen/ladder"
+	"squash-ladder/server/version"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestValidateScore(t *testing.T) {
@@ -107,6 +116,28 @@ func TestValidateScore(t *testing.T) {
 			wantWinner: 0,
 			wantErr:    true,
 		},
+		{
+			name: "Set after the match is won",
+			scores: []*ladderpb.SetScore{
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{ChallengerPoints: 5, DefenderPoints: 11},
+			},
+			wantWinner: 0,
+			wantErr:    true,
+		},
+		{
+			name: "Default after the match is won",
+			scores: []*ladderpb.SetScore{
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{ChallengerPoints: 11, DefenderPoints: 5},
+				{DefenderDefault: true},
+			},
+			wantWinner: 0,
+			wantErr:    true,
+		},
 		{
 			name: "Not enough sets",
 			scores: []*ladderpb.SetScore{
@@ -150,6 +181,129 @@ func TestValidateScore(t *testing.T) {
 	}
 }
 
+// swapSides returns the scores as the defender would have entered them
+func swapSides(scores []*ladderpb.SetScore) []*ladderpb.SetScore {
+	swapped := make([]*ladderpb.SetScore, len(scores))
+	for i, s := range scores {
+		swapped[i] = &ladderpb.SetScore{
+			ChallengerPoints:  s.DefenderPoints,
+			DefenderPoints:    s.ChallengerPoints,
+			ChallengerDefault: s.DefenderDefault,
+			DefenderDefault:   s.ChallengerDefault,
+		}
+	}
+	return swapped
+}
+
+// checkScoreProperties checks the rules every scoring format has to keep, whatever
+// the scores
+func checkScoreProperties(t *testing.T, scores []*ladderpb.SetScore, format ladderpb.ScoringFormat) {
+	t.Helper()
+	winner, err := ValidateScoreFormat(scores, format)
+	if (err == nil) != (winner == 1 || winner == 2) {
+		t.Fatalf("%v %v: got winner %d with error %v", format, scores, winner, err)
+	}
+
+	// Swapping the players flips the winner
+	swappedWinner, swappedErr := ValidateScoreFormat(swapSides(scores), format)
+	if (err == nil) != (swappedErr == nil) || (err == nil && swappedWinner != 3-winner) {
+		t.Fatalf("%v %v: winner %d (%v) but %d (%v) swapped", format, scores, winner, err, swappedWinner, swappedErr)
+	}
+
+	// No handicap is the same as none at all
+	if hw, herr := ValidateScoreHandicap(scores, format, 0, 0); hw != winner || (herr == nil) != (err == nil) {
+		t.Fatalf("%v %v: winner %d without a handicap, %d with a zero one", format, scores, winner, hw)
+	}
+	if err != nil {
+		return
+	}
+
+	// Any set after the match is decided is an error, including a default
+	setsToWin, setPoints := scoringFormatRules(format)
+	for _, extra := range []*ladderpb.SetScore{
+		{ChallengerPoints: int32(setPoints), DefenderPoints: 0},
+		{ChallengerPoints: 0, DefenderPoints: int32(setPoints)},
+		{ChallengerDefault: true},
+		{DefenderDefault: true},
+	} {
+		if _, err := ValidateScoreFormat(append(scores[:len(scores):len(scores)], extra), format); err == nil {
+			t.Fatalf("%v %v: accepted another set %v", format, scores, extra)
+		}
+	}
+
+	// Without a default the winner took the last set and exactly enough sets
+	last := scores[len(scores)-1]
+	if last.ChallengerDefault || last.DefenderDefault {
+		return
+	}
+	sets := 0
+	for _, s := range scores {
+		if (s.ChallengerPoints > s.DefenderPoints) == (winner == 1) {
+			sets++
+		}
+	}
+	if sets != setsToWin || (last.ChallengerPoints > last.DefenderPoints) != (winner == 1) {
+		t.Fatalf("%v %v: winner %d took %d sets", format, scores, winner, sets)
+	}
+}
+
+func TestValidateScore_Properties(t *testing.T) {
+	pool := []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 7, DefenderPoints: 11},
+		{ChallengerPoints: 11, DefenderPoints: 10},
+		{ChallengerPoints: 14, DefenderPoints: 12},
+		{ChallengerPoints: 15, DefenderPoints: 9},
+		{ChallengerPoints: 9, DefenderPoints: 7},
+		{ChallengerDefault: true},
+		{DefenderDefault: true},
+	}
+	formats := []ladderpb.ScoringFormat{
+		ladderpb.ScoringFormat_BEST_OF_5_PAR_11,
+		ladderpb.ScoringFormat_BEST_OF_3_PAR_11,
+		ladderpb.ScoringFormat_BEST_OF_5_PAR_15,
+	}
+
+	// Every sequence of up to five sets drawn from the pool
+	var walk func(scores []*ladderpb.SetScore)
+	walk = func(scores []*ladderpb.SetScore) {
+		for _, format := range formats {
+			checkScoreProperties(t, scores, format)
+		}
+		if len(scores) == 5 {
+			return
+		}
+		for _, s := range pool {
+			walk(append(scores[:len(scores):len(scores)], s))
+		}
+	}
+	walk(nil)
+}
+
+func FuzzValidateScore(f *testing.F) {
+	f.Add([]byte{0, 13, 7, 0, 13, 7, 0, 13, 7, 0})
+	f.Add([]byte{1, 13, 11, 0, 5, 13, 0, 2, 2, 1})
+	f.Add([]byte{2, 17, 15, 0, 18, 20, 0, 22, 20, 0, 2, 2, 2})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		format := ladderpb.ScoringFormat(int(data[0]) % 3)
+		var scores []*ladderpb.SetScore
+		for data = data[1:]; len(data) >= 3; data = data[3:] {
+			// Points run from -2 so that negative scores come up too
+			scores = append(scores, &ladderpb.SetScore{
+				ChallengerPoints:  int32(data[0]) - 2,
+				DefenderPoints:    int32(data[1]) - 2,
+				ChallengerDefault: data[2]&1 != 0,
+				DefenderDefault:   data[2]&2 != 0,
+			})
+		}
+		checkScoreProperties(t, scores, format)
+	})
+}
+
 func TestLadderService_AddMatchResult(t *testing.T) {
 	m, path := createTempModel(t)
 	defer os.Remove(path)
@@ -194,6 +348,275 @@ func TestLadderService_AddMatchResult(t *testing.T) {
 	}
 }
 
+func TestLadderService_AddMatchResult_PlayedAt(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	svc := NewLadderService(m)
+	add := func(playedAt string) error {
+		_, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+			ChallengerId: "bob", DefenderId: "alice", WinnerId: "bob",
+			SetScores: []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}},
+			PlayedAt:  playedAt,
+		})
+		return err
+	}
+
+	for _, bad := range []string{"2024-03-02T19:30:00", "2 March", time.Now().Add(time.Hour).Format(time.RFC3339)} {
+		if err := add(bad); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument for %q, got %v", bad, err)
+		}
+	}
+
+	// Late on Saturday evening in New York is already Sunday in UTC
+	if err := add("2024-03-02T23:30:00-05:00"); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	matches, _ := m.GetRecentMatches(1)
+	played := time.Date(2024, 3, 3, 4, 30, 0, 0, time.UTC)
+	if matches[0].PlayedAtMs != played.UnixMilli() || matches[0].TimestampMs < time.Now().Add(-time.Minute).UnixMilli() {
+		t.Errorf("expected the match played at %v and recorded now, got %v", played, matches[0])
+	}
+	if inMarch, _, _ := m.MatchesBetween(context.Background(), played.Add(-time.Hour).UnixMilli(), played.Add(time.Hour).UnixMilli()); len(inMarch) != 1 {
+		t.Errorf("expected date ranges to use the played time, got %d matches", len(inMarch))
+	}
+
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 14, TimeZone: "Mars/Olympus_Mons"}); err == nil {
+		t.Error("expected an error for an unknown time zone")
+	}
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 14, TimeZone: "America/New_York"}); err != nil {
+		t.Fatalf("SetLadderRules failed: %v", err)
+	}
+	if row := clubLockerRow(matches[0], nil, m.TimeZone()); row[0] != "2024-03-02" {
+		t.Errorf("expected the date in the ladder's zone, got %s", row[0])
+	}
+}
+
+func TestLadderService_AddMatchResult_ScoresString(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	svc := NewLadderService(m)
+	add := func(req *ladderpb.AddMatchResultRequest) error {
+		req.ChallengerId, req.DefenderId, req.WinnerId = "bob", "alice", "bob"
+		_, err := svc.AddMatchResult(context.Background(), req)
+		return err
+	}
+
+	for _, bad := range []string{"11-5, 9-11, eleven-7", "11:5", " , ", "11-5 99999999999-1"} {
+		if err := add(&ladderpb.AddMatchResultRequest{ScoresString: bad}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument for %q, got %v", bad, err)
+		}
+	}
+	if err := add(&ladderpb.AddMatchResultRequest{ScoresString: "11-5", SetScores: []*ladderpb.SetScore{{ChallengerPoints: 11}}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for both forms, got %v", err)
+	}
+
+	if err := add(&ladderpb.AddMatchResultRequest{ScoresString: "11-5, 9-11,11 - 7 11-8"}); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	matches, _ := m.GetRecentMatches(1)
+	want := [][2]int32{{11, 5}, {9, 11}, {11, 7}, {11, 8}}
+	if len(matches[0].SetScores) != len(want) {
+		t.Fatalf("expected %d sets, got %v", len(want), matches[0].SetScores)
+	}
+	for i, s := range matches[0].SetScores {
+		if s.ChallengerPoints != want[i][0] || s.DefenderPoints != want[i][1] {
+			t.Errorf("set %d: expected %v, got %v", i+1, want[i], s)
+		}
+	}
+}
+
+func TestLadderService_AddMatchResult_SetDetail(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	svc := NewLadderService(m)
+	c, d := ladderpb.PointWinner_POINT_CHALLENGER, ladderpb.PointWinner_POINT_DEFENDER
+	rally := func(challenger, defender int) []ladderpb.PointWinner {
+		var points []ladderpb.PointWinner
+		for i := 0; i < defender; i++ {
+			points = append(points, d)
+		}
+		for i := 0; i < challenger; i++ {
+			points = append(points, c)
+		}
+		return points
+	}
+	add := func(first *ladderpb.SetScore) error {
+		_, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+			ChallengerId: "bob", DefenderId: "alice", WinnerId: "bob",
+			SetScores: []*ladderpb.SetScore{first, {ChallengerPoints: 11}, {ChallengerPoints: 11}},
+		})
+		return err
+	}
+
+	for _, bad := range []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5, DurationSeconds: -1},
+		{ChallengerPoints: 11, DefenderPoints: 5, Points: rally(11, 4)},
+		{ChallengerPoints: 11, DefenderPoints: 5, Points: append(rally(11, 5), ladderpb.PointWinner_POINT_UNKNOWN)},
+	} {
+		if err := add(bad); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument for %v, got %v", bad, err)
+		}
+	}
+
+	if err := add(&ladderpb.SetScore{ChallengerPoints: 11, DefenderPoints: 5, DurationSeconds: 600, Points: rally(11, 5)}); err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	matches, _ := m.GetRecentMatches(1)
+	first := matches[0].SetScores[0]
+	if first.DurationSeconds != 600 || len(first.Points) != 16 || first.Points[0] != d || first.Points[15] != c {
+		t.Errorf("expected the set detail to be kept, got %v", first)
+	}
+	if second := matches[0].SetScores[1]; second.DurationSeconds != 0 || len(second.Points) != 0 {
+		t.Errorf("expected no detail on the second set, got %v", second)
+	}
+}
+
+func TestLadderService_AddMatchResult_EntryDeadline(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 14, EntryDeadlineDays: 3})
+	svc := NewLadderService(m)
+	add := func(ctx context.Context, daysAgo int, override bool) error {
+		_, err := svc.AddMatchResult(ctx, &ladderpb.AddMatchResultRequest{
+			ChallengerId: "bob", DefenderId: "alice", WinnerId: "bob",
+			SetScores:         []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}},
+			PlayedAt:          time.Now().AddDate(0, 0, -daysAgo).Format(time.RFC3339),
+			LateEntryOverride: override,
+		})
+		return err
+	}
+
+	ctx := context.Background()
+	if err := add(ctx, 2, false); err != nil {
+		t.Fatalf("expected a result within the deadline to be accepted, got %v", err)
+	}
+	if err := add(ctx, 5, false); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for a late result, got %v", err)
+	}
+	if err := add(ctx, 5, true); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for an override without the admin token, got %v", err)
+	}
+
+	admin := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer secret"))
+	_, err := adminUnaryInterceptor("secret", nil)(admin, nil, &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/AddMatchResult"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, add(ctx, 5, true)
+		})
+	if err != nil {
+		t.Fatalf("expected an admin override to be accepted, got %v", err)
+	}
+
+	matches, _ := m.GetRecentMatches(2)
+	if !matches[0].LateEntry || matches[1].LateEntry {
+		t.Errorf("expected only the overridden result to be marked late, got %v", matches)
+	}
+	history, _, err := m.ListTransactions(context.Background(), 1, "", nil)
+	if err != nil || !strings.HasSuffix(history[0].Summary, ", entered late") {
+		t.Errorf("expected the history to show the late entry, got %v, %v", history, err)
+	}
+
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 14, EntryDeadlineDays: -1}); err == nil {
+		t.Error("expected an error for a negative entry deadline")
+	}
+}
+
+func TestLadderService_AddMatchResult_UpwardChallengesOnly(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	svc := NewLadderService(m)
+	add := func(challenger, defender string, override bool) error {
+		_, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+			ChallengerId: challenger, DefenderId: defender, WinnerId: defender,
+			SetScores:        []*ladderpb.SetScore{{DefenderPoints: 11}, {DefenderPoints: 11}, {DefenderPoints: 11}},
+			ReversalOverride: override,
+		})
+		return err
+	}
+
+	if err := add("alice", "bob", false); err != nil {
+		t.Fatalf("expected a downward challenge to be accepted without the rule, got %v", err)
+	}
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 14, UpwardChallengesOnly: true})
+	// Bob beat Alice from below, so he is now ranked above her
+	if err := add("bob", "alice", false); status.Code(err) != codes.FailedPrecondition || !strings.Contains(err.Error(), "Bob is ranked above Alice") {
+		t.Errorf("expected FailedPrecondition for a downward challenge, got %v", err)
+	}
+	if err := add("alice", "bob", false); err != nil {
+		t.Errorf("expected an upward challenge to be accepted, got %v", err)
+	}
+	if err := add("bob", "alice", true); err != nil {
+		t.Errorf("expected a friendly reversal to be accepted with the override, got %v", err)
+	}
+	if matches, _ := m.GetRecentMatches(10); len(matches) != 3 {
+		t.Errorf("expected 3 matches, got %d", len(matches))
+	}
+	if rules, _ := m.GetLadderRules(); !rules.UpwardChallengesOnly {
+		t.Error("expected the rule to be stored")
+	}
+}
+
+func TestLadderService_AddMatchResult_Friendly(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 14, UpwardChallengesOnly: true})
+	svc := NewLadderService(m)
+	resp, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+		ChallengerId: "bob", DefenderId: "alice", WinnerId: "bob",
+		SetScores:       []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}},
+		CountsForLadder: proto.Bool(false),
+	})
+	if err != nil {
+		t.Fatalf("AddMatchResult failed: %v", err)
+	}
+	if resp.ChallengerRatingDelta != 0 || resp.DefenderRatingDelta != 0 {
+		t.Errorf("expected a friendly to change no rating, got %v", resp)
+	}
+	if players := m.ListPlayers(); players[0].Id != "alice" {
+		t.Errorf("expected a friendly to move nobody, got %v", players)
+	}
+	matches, _ := m.GetRecentMatches(1)
+	if len(matches) != 1 || !matches[0].Friendly || matches[0].WinnerId != "bob" {
+		t.Errorf("expected the friendly in the recent matches, got %v", matches)
+	}
+	history, _, _ := m.ListTransactions(context.Background(), 1, "", nil)
+	if len(history) != 1 || !strings.HasSuffix(history[0].Summary, ", friendly") {
+		t.Errorf("expected the history to show the friendly, got %v", history)
+	}
+
+	// Friendlies aren't challenges, so the rules on who may challenge don't apply
+	if _, err := svc.AddMatchResult(context.Background(), &ladderpb.AddMatchResultRequest{
+		ChallengerId: "alice", DefenderId: "bob", WinnerId: "alice",
+		SetScores:       []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}},
+		CountsForLadder: proto.Bool(false),
+	}); err != nil {
+		t.Errorf("expected a downward friendly to be accepted, got %v", err)
+	}
+}
+
 func TestLadderService_ListRecentMatches(t *testing.T) {
 	m, path := createTempModel(t)
 	defer os.Remove(path)
@@ -216,3 +639,109 @@ func TestLadderService_ListRecentMatches(t *testing.T) {
 		t.Errorf("expected 1 match, got %d", len(resp.Results))
 	}
 }
+
+func TestLadderService_VerifyIntegrity(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	svc := NewLadderService(m)
+	resp, err := svc.VerifyIntegrity(context.Background(), &ladderpb.VerifyIntegrityRequest{})
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if resp.TransactionsChecked != 2 || len(resp.Mismatches) != 0 {
+		t.Errorf("unexpected report: %+v", resp)
+	}
+}
+
+func TestLadderService_GetVersion(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	m.AddPlayer("Alice", "alice")
+
+	svc := NewLadderService(m)
+	resp, err := svc.GetVersion(context.Background(), &ladderpb.GetVersionRequest{})
+	if err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	if resp.Version != version.Version || resp.GoVersion == "" {
+		t.Errorf("unexpected version: %+v", resp)
+	}
+
+	// Transactions record the version that wrote them
+	txs, _, _ := m.ListTransactions(context.Background(), 1, "", nil)
+	if len(txs) != 1 || txs[0].ServerVersion != version.Version {
+		t.Errorf("expected the transaction to record version %s, got %v", version.Version, txs)
+	}
+}
+
+func TestAdminUnaryInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	admin := &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/UndoLastTransaction"}
+	public := &grpc.UnaryServerInfo{FullMethod: "/ladder.LadderService/ListPlayers"}
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		ctx      context.Context
+		info     *grpc.UnaryServerInfo
+		wantCode codes.Code
+	}{
+		{"public method without token", "secret", context.Background(), public, codes.OK},
+		{"admin method without token", "secret", context.Background(), admin, codes.Unauthenticated},
+		{"admin method with wrong token", "secret", withToken("nope"), admin, codes.Unauthenticated},
+		{"admin method with token", "secret", withToken("secret"), admin, codes.OK},
+		{"admin disabled", "", withToken(""), admin, codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := adminUnaryInterceptor(tt.token, nil)(tt.ctx, nil, tt.info, handler)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("got code %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestLadderService_ListPlayers_Category(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	svc := NewLadderService(m)
+	ctx := context.Background()
+	svc.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Alice", PlayerId: "alice", Category: ladderpb.PlayerCategory_CATEGORY_SENIOR})
+	svc.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Bob", PlayerId: "bob", Category: ladderpb.PlayerCategory_CATEGORY_JUNIOR})
+	svc.AddPlayer(ctx, &ladderpb.AddPlayerRequest{Name: "Charlie", PlayerId: "charlie"})
+
+	if _, err := svc.SetPlayerCategory(ctx, &ladderpb.SetPlayerCategoryRequest{PlayerId: "charlie", Category: ladderpb.PlayerCategory_CATEGORY_JUNIOR}); err != nil {
+		t.Fatalf("SetPlayerCategory failed: %v", err)
+	}
+
+	resp, err := svc.ListPlayers(ctx, &ladderpb.ListPlayersRequest{Category: ladderpb.PlayerCategory_CATEGORY_JUNIOR})
+	if err != nil {
+		t.Fatalf("ListPlayers failed: %v", err)
+	}
+	if len(resp.Players) != 2 {
+		t.Fatalf("expected 2 juniors, got %+v", resp.Players)
+	}
+	if resp.Players[0].Id != "bob" || resp.Players[0].Rank != 2 || resp.Players[0].CategoryRank != 1 {
+		t.Errorf("unexpected first junior: %+v", resp.Players[0])
+	}
+	if resp.Players[1].Id != "charlie" || resp.Players[1].Rank != 3 || resp.Players[1].CategoryRank != 2 {
+		t.Errorf("unexpected second junior: %+v", resp.Players[1])
+	}
+
+	all, _ := svc.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if len(all.Players) != 3 || all.Players[0].CategoryRank != 0 {
+		t.Errorf("unfiltered list should be the whole ladder, got %+v", all.Players)
+	}
+}
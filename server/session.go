@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/grpc/codes"
+)
+
+// sessionSpan locates a session in the log. closeIdx is -1 while it is open.
+type sessionSpan struct {
+	session  *ladderpb.Session
+	openIdx  int
+	closeIdx int
+	attended map[string]bool // Recorded with RecordAttendance
+}
+
+// sessionSpans finds every session that was opened and not undone, oldest first
+func sessionSpans(txs []*storagepb.TransactionStorage) []*sessionSpan {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	var spans []*sessionSpan
+	byID := make(map[string]*sessionSpan)
+	for i, t := range txs {
+		if invalidated[t.Id] {
+			continue
+		}
+		p := t.GetSessionPayload()
+		switch t.Type {
+		case storagepb.TransactionType_SESSION_OPEN:
+			span := &sessionSpan{
+				session:  &ladderpb.Session{Id: p.SessionId, Name: p.Name, OpenedAtMs: t.TimestampMs},
+				openIdx:  i,
+				closeIdx: -1,
+				attended: make(map[string]bool),
+			}
+			spans = append(spans, span)
+			byID[p.SessionId] = span
+		case storagepb.TransactionType_SESSION_CLOSE:
+			if span, ok := byID[p.SessionId]; ok {
+				span.session.ClosedAtMs = t.TimestampMs
+				span.closeIdx = i
+			}
+		case storagepb.TransactionType_ATTENDANCE:
+			a := t.GetAttendancePayload()
+			if span, ok := byID[a.SessionId]; ok {
+				for _, id := range a.PlayerIds {
+					span.attended[id] = true
+				}
+			}
+		}
+	}
+	return spans
+}
+
+// openSpan returns the session that is currently open, if any
+func openSpan(spans []*sessionSpan) *sessionSpan {
+	for _, span := range spans {
+		if span.closeIdx == -1 {
+			return span
+		}
+	}
+	return nil
+}
+
+// OpenSession starts a session; only one can be open at a time
+func (m *Model) OpenSession(name string) (*ladderpb.Session, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, localizedStatusf(codes.InvalidArgument, "a session needs a name")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	if open := openSpan(sessionSpans(txs)); open != nil {
+		return nil, localizedStatusf(codes.FailedPrecondition, "session %q is still open", open.session.Name)
+	}
+
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &storagepb.SessionStorage{SessionId: m.newID(), Name: name}
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_SESSION_OPEN,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_SessionPayload{SessionPayload: payload},
+		PlayerList:  ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+	return &ladderpb.Session{Id: payload.SessionId, Name: name, OpenedAtMs: tx.TimestampMs}, nil
+}
+
+// CloseSession ends the open session sessionID
+func (m *Model) CloseSession(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return err
+	}
+	open := openSpan(sessionSpans(txs))
+	if open == nil || open.session.Id != sessionID {
+		return localizedStatusf(codes.NotFound, "no open session %q", sessionID)
+	}
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return err
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_SESSION_CLOSE,
+		TimestampMs: m.now().UnixMilli(),
+		Payload: &storagepb.TransactionStorage_SessionPayload{SessionPayload: &storagepb.SessionStorage{
+			SessionId: sessionID,
+			Name:      open.session.Name,
+		}},
+		PlayerList: ladderToStorage(currentPlayers),
+	}
+	return m.writeTransactionLocked(tx)
+}
+
+// findSession returns the session with sessionID, or the most recent one if it is empty
+func findSession(spans []*sessionSpan, sessionID string) (*sessionSpan, error) {
+	var span *sessionSpan
+	for _, s := range spans {
+		if sessionID == "" || s.session.Id == sessionID {
+			span = s
+		}
+	}
+	if span == nil {
+		return nil, localizedStatusf(codes.NotFound, "session not found")
+	}
+	return span, nil
+}
+
+// endIdx returns the index of the session's last transaction: its close, or the end
+// of the log while it is open
+func (s *sessionSpan) endIdx(txs []*storagepb.TransactionStorage) int {
+	if s.closeIdx == -1 {
+		return len(txs) - 1
+	}
+	return s.closeIdx
+}
+
+// results returns the valid match results recorded during the session
+func (s *sessionSpan) results(txs []*storagepb.TransactionStorage, invalidated map[string]bool) []*storagepb.TransactionStorage {
+	var results []*storagepb.TransactionStorage
+	for _, t := range txs[s.openIdx+1 : s.endIdx(txs)+1] {
+		if t.GetMatchResultPayload() != nil && !invalidated[t.Id] {
+			results = append(results, t)
+		}
+	}
+	return results
+}
+
+// GetSession summarises a session, or the most recent one if sessionID is empty
+func (m *Model) GetSession(sessionID string) (*ladderpb.GetSessionResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	span, err := findSession(sessionSpans(txs), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	end := span.endIdx(txs)
+	resp := &ladderpb.GetSessionResponse{
+		Session:  span.session,
+		Movement: diffSnapshots(txs, span.openIdx, end),
+	}
+	ratings := computeRatings(txs)
+	came := make(map[string]bool)
+	for id := range span.attended {
+		came[id] = true
+	}
+	attachments := matchAttachments(txs)
+	for _, t := range span.results(txs, invalidated) {
+		result := matchResultFromStorage(t)
+		result.Attachments = attachments[t.Id]
+		ratings.annotate(result)
+		resp.Results = append(resp.Results, result)
+		came[result.ChallengerId] = true
+		came[result.DefenderId] = true
+	}
+	for _, p := range storageToLadder(txs[end].PlayerList) {
+		if came[p.Id] {
+			resp.Attendance = append(resp.Attendance, p)
+		}
+	}
+	return resp, nil
+}
+
+// ListSessions returns every session, newest first
+func (m *Model) ListSessions() ([]*ladderpb.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	spans := sessionSpans(txs)
+	sessions := make([]*ladderpb.Session, len(spans))
+	for i, span := range spans {
+		sessions[len(spans)-1-i] = span.session
+	}
+	return sessions, nil
+}
+
+// OpenSession starts a club night
+func (h *LadderService) OpenSession(ctx context.Context, req *ladderpb.OpenSessionRequest) (*ladderpb.OpenSessionResponse, error) {
+	session, err := h.modelFor(ctx).OpenSession(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.OpenSessionResponse{Session: session}, nil
+}
+
+// CloseSession ends a club night
+func (h *LadderService) CloseSession(ctx context.Context, req *ladderpb.CloseSessionRequest) (*ladderpb.CloseSessionResponse, error) {
+	if err := h.modelFor(ctx).CloseSession(req.SessionId); err != nil {
+		return &ladderpb.CloseSessionResponse{Success: false}, err
+	}
+	return &ladderpb.CloseSessionResponse{Success: true}, nil
+}
+
+// GetSession summarises a club night
+func (h *LadderService) GetSession(ctx context.Context, req *ladderpb.GetSessionRequest) (*ladderpb.GetSessionResponse, error) {
+	return h.modelFor(ctx).GetSession(req.SessionId)
+}
+
+// ListSessions returns every club night
+func (h *LadderService) ListSessions(ctx context.Context, req *ladderpb.ListSessionsRequest) (*ladderpb.ListSessionsResponse, error) {
+	sessions, err := h.modelFor(ctx).ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListSessionsResponse{Sessions: sessions}, nil
+}
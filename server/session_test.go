@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestModel_Sessions(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+	win := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	m.AddMatchResult("charlie", "bob", "charlie", win) // Before the session
+
+	if _, err := m.OpenSession(" "); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a session without a name, got %v", err)
+	}
+	session, err := m.OpenSession("Tuesday club night")
+	if err != nil {
+		t.Fatalf("OpenSession failed: %v", err)
+	}
+	if _, err := m.OpenSession("Wednesday"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition while a session is open, got %v", err)
+	}
+
+	m.AddMatchResult("charlie", "alice", "charlie", win)
+	invalid, _ := m.AddMatchResult("bob", "alice", "bob", win)
+	m.InvalidateMatchResult(context.Background(), invalid)
+	if err := m.CloseSession(session.Id); err != nil {
+		t.Fatalf("CloseSession failed: %v", err)
+	}
+	if err := m.CloseSession(session.Id); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a closed session, got %v", err)
+	}
+	m.AddMatchResult("alice", "charlie", "alice", win) // After the session
+
+	summary, err := m.GetSession("")
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if summary.Session.Id != session.Id || summary.Session.Name != "Tuesday club night" || summary.Session.ClosedAtMs == 0 {
+		t.Errorf("unexpected session %v", summary.Session)
+	}
+	if len(summary.Results) != 1 || summary.Results[0].WinnerId != "charlie" {
+		t.Errorf("expected the one valid result of the session, got %v", summary.Results)
+	}
+	if len(summary.Attendance) != 2 || summary.Attendance[0].Id != "charlie" || summary.Attendance[1].Id != "alice" {
+		t.Errorf("expected Charlie and Alice to have attended, got %v", summary.Attendance)
+	}
+	moved := summary.Movement.Moved
+	if len(moved) != 2 || moved[0].PlayerId != "charlie" || moved[0].FromRank != 2 || moved[0].ToRank != 1 {
+		t.Errorf("unexpected movement %v", moved)
+	}
+
+	if _, err := m.GetSession("missing"); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	sessions, _ := m.ListSessions()
+	if len(sessions) != 1 || sessions[0].Id != session.Id {
+		t.Errorf("expected one session, got %v", sessions)
+	}
+	history, _, _ := m.ListTransactions(context.Background(), 10, "", []storagepb.TransactionType{storagepb.TransactionType_SESSION_OPEN})
+	if len(history) != 1 || history[0].Summary != "Opened session Tuesday club night" {
+		t.Errorf("unexpected history %v", history)
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+const (
+	sheetsAPIBase = "https://sheets.googleapis.com/v4"
+	sheetsScope   = "https://www.googleapis.com/auth/spreadsheets"
+
+	// sheetsDebounce coalesces bursts of changes into a single sheet update
+	sheetsDebounce = 30 * time.Second
+	// sheetsRecentResults is the number of results mirrored, newest first
+	sheetsRecentResults = 50
+)
+
+// The spreadsheet must already contain tabs with these names
+const (
+	sheetsStandingsTab = "Standings"
+	sheetsResultsTab   = "Results"
+)
+
+// SheetsMirror keeps a Google Sheet in step with the ladder: the standings on one tab
+// and recent results on another. It authenticates as a service account, which must be
+// given edit access to the spreadsheet.
+type SheetsMirror struct {
+	model         *Model
+	spreadsheetID string
+	auth          *googleServiceAccount
+	apiBase       string
+	debounce      time.Duration
+	client        *http.Client
+
+	mu      sync.Mutex
+	pending *time.Timer // Set while an update is scheduled
+}
+
+// NewSheetsMirror creates a mirror of m's ladder to spreadsheetID using the JSON key
+// file of a Google service account
+func NewSheetsMirror(m *Model, spreadsheetID string, credentialsJSON []byte) (*SheetsMirror, error) {
+	auth, err := newGoogleServiceAccount(credentialsJSON, sheetsScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SheetsMirror{
+		model:         m,
+		spreadsheetID: spreadsheetID,
+		auth:          auth,
+		apiBase:       sheetsAPIBase,
+		debounce:      sheetsDebounce,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// OnMatchRecorded schedules a sheet update
+func (s *SheetsMirror) OnMatchRecorded(ctx context.Context, mr *ladderpb.MatchResult, names map[string]string) error {
+	s.schedule()
+	return nil
+}
+
+// OnLadderChanged schedules a sheet update
+func (s *SheetsMirror) OnLadderChanged(ctx context.Context, players []*ladderpb.Player) error {
+	s.schedule()
+	return nil
+}
+
+// schedule updates the sheet once the debounce period has passed; changes made in
+// the meantime are picked up by the same update
+func (s *SheetsMirror) schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != nil {
+		return
+	}
+	s.pending = time.AfterFunc(s.debounce, func() {
+		s.mu.Lock()
+		s.pending = nil
+		s.mu.Unlock()
+		if err := s.update(context.Background()); err != nil {
+			log.Printf("sheets: failed to update spreadsheet: %v", err)
+		}
+	})
+}
+
+// update rewrites both tabs from the current ladder
+func (s *SheetsMirror) update(ctx context.Context) error {
+	players := s.model.ListPlayers()
+	matches, names, err := s.model.MatchesBetween(ctx, 0, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+
+	standings := [][]interface{}{{"Rank", "Player"}}
+	for _, p := range players {
+		standings = append(standings, []interface{}{p.Rank, p.Name})
+	}
+	loc := s.model.TimeZone()
+	results := [][]interface{}{{"Date", "Result"}}
+	for i := len(matches) - 1; i >= 0 && len(results) <= sheetsRecentResults; i-- {
+		mr := matches[i]
+		date := time.UnixMilli(mr.PlayedAtMs).In(loc).Format("2006-01-02")
+		results = append(results, []interface{}{date, describeMatch(mr, names)})
+	}
+
+	clear := map[string]interface{}{"ranges": []string{sheetsStandingsTab, sheetsResultsTab}}
+	if err := s.call(ctx, "values:batchClear", clear); err != nil {
+		return err
+	}
+	write := map[string]interface{}{
+		"valueInputOption": "RAW",
+		"data": []map[string]interface{}{
+			{"range": sheetsStandingsTab + "!A1", "values": standings},
+			{"range": sheetsResultsTab + "!A1", "values": results},
+		},
+	}
+	return s.call(ctx, "values:batchUpdate", write)
+}
+
+func (s *SheetsMirror) call(ctx context.Context, method string, body interface{}) error {
+	token, err := s.auth.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/spreadsheets/%s/%s", s.apiBase, url.PathEscape(s.spreadsheetID), method)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", method, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+func TestSheetsMirror_Update(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 4}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+
+	var mu sync.Mutex
+	tokens, updates := 0, []map[string]interface{}{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/token":
+			r.ParseForm()
+			if len(strings.Split(r.Form.Get("assertion"), ".")) != 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tokens++
+			w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+		case r.Header.Get("Authorization") != "Bearer tok":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/spreadsheets/sheet1/values:batchClear":
+		case r.URL.Path == "/spreadsheets/sheet1/values:batchUpdate":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			updates = append(updates, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	creds, _ := json.Marshal(map[string]string{
+		"client_email": "ladder@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    api.URL + "/token",
+	})
+
+	mirror, err := NewSheetsMirror(m, "sheet1", creds)
+	if err != nil {
+		t.Fatalf("NewSheetsMirror failed: %v", err)
+	}
+	mirror.apiBase = api.URL
+	mirror.debounce = 50 * time.Millisecond
+
+	// A burst of changes results in a single update
+	for i := 0; i < 5; i++ {
+		mirror.OnLadderChanged(context.Background(), nil)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) != 1 || tokens != 1 {
+		t.Fatalf("expected 1 update with 1 token exchange, got %d updates and %d tokens", len(updates), tokens)
+	}
+	data, _ := json.Marshal(updates[0]["data"])
+	if !strings.Contains(string(data), `[1,"Bob"]`) {
+		t.Errorf("expected Bob at rank 1 in the standings, got %s", data)
+	}
+	if !strings.Contains(string(data), "Bob beat Alice (11-4, 11-0, 11-0)") {
+		t.Errorf("expected the result to be mirrored, got %s", data)
+	}
+}
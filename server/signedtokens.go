@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// signedTokens signs claims into URL-safe tokens with an HMAC: the claims as JSON,
+// then their MAC. The domain is part of what is signed, so a token issued for one
+// use, such as a result link, is never accepted for another that shares the secret.
+type signedTokens struct {
+	secret []byte
+	domain string // e.g. "player"
+	noun   string // What a token is called in errors, e.g. "player token"
+	clock  Clock  // nil uses the system clock
+}
+
+// expiringClaims are claims that stop being valid at some point
+type expiringClaims interface {
+	expiresMs() int64
+}
+
+// sign returns a token carrying claims
+func (s signedTokens) sign(claims expiringClaims) string {
+	payload, _ := json.Marshal(claims)
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + base64.RawURLEncoding.EncodeToString(s.mac(enc))
+}
+
+// verify checks a token's signature and expiry and decodes its claims into claims,
+// which must be a pointer
+func (s signedTokens) verify(token string, claims expiringClaims) error {
+	enc, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return fmt.Errorf("malformed %s", s.noun)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(enc)) {
+		return fmt.Errorf("invalid %s", s.noun)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return fmt.Errorf("malformed %s", s.noun)
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return fmt.Errorf("malformed %s", s.noun)
+	}
+	if s.now().UnixMilli() > claims.expiresMs() {
+		return fmt.Errorf("this %s has expired", s.noun)
+	}
+	return nil
+}
+
+func (s signedTokens) mac(data string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(s.domain + ":"))
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s signedTokens) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
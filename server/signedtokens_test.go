@@ -0,0 +1,29 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedTokens(t *testing.T) {
+	start := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	clock := NewSteppingClock(start, 0)
+	auth := NewPlayerAuth("secret", clock)
+	token := auth.Sign(playerClaims{PlayerID: "alice", ExpiresMs: start.Add(time.Hour).UnixMilli()})
+	if claims, err := auth.Verify(token); err != nil || claims.PlayerID != "alice" {
+		t.Fatalf("Verify failed: %+v, %v", claims, err)
+	}
+
+	// The same secret in another domain doesn't accept the token
+	links := NewResultLinks(nil, nil, "secret", nil, 0, "", "")
+	if _, err := links.Verify(token); err == nil || !strings.Contains(err.Error(), "invalid link") {
+		t.Errorf("expected a player token to be refused as a result link, got %v", err)
+	}
+
+	// Expiry follows the clock, not the system time
+	clock.Set(start.Add(2 * time.Hour))
+	if _, err := auth.Verify(token); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected the token to have expired, got %v", err)
+	}
+}
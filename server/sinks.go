@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// ResultSink receives ladder updates for a custom integration such as a club website.
+// Calls to a sink are serialised, so implementations need not be safe for concurrent
+// use. A returned error is logged and the update is not retried.
+type ResultSink interface {
+	// OnMatchRecorded is called after a match result is written. names maps the
+	// player IDs in mr to their display names.
+	OnMatchRecorded(ctx context.Context, mr *ladderpb.MatchResult, names map[string]string) error
+	// OnLadderChanged is called with the full ladder after any write that changed it,
+	// including match results, which are delivered first
+	OnLadderChanged(ctx context.Context, players []*ladderpb.Player) error
+}
+
+var (
+	sinksMu         sync.Mutex
+	registeredSinks []ResultSink
+)
+
+// RegisterResultSink adds a sink that Run attaches to the ladder. Integrations compiled
+// into the server binary call it from an init function; it has no effect on servers
+// already running.
+func RegisterResultSink(s ResultSink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	registeredSinks = append(registeredSinks, s)
+}
+
+func resultSinks() []ResultSink {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	return append([]ResultSink{}, registeredSinks...)
+}
+
+// sinkDispatcher forwards ladder changes to a single sink
+type sinkDispatcher struct {
+	sink ResultSink
+
+	mu      sync.Mutex // Serialises calls to sink
+	lastSeq uint64     // Seq of the newest ladder delivered
+}
+
+// attachResultSink delivers every change to m to sink
+func attachResultSink(m *Model, sink ResultSink) {
+	d := &sinkDispatcher{sink: sink}
+	m.OnChange(d.handle)
+}
+
+func (d *sinkDispatcher) handle(change LadderChange) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ctx := context.Background()
+	tx := change.Transaction
+	if tx.GetMatchResultPayload() != nil {
+		names := make(map[string]string)
+		for _, p := range change.Before {
+			names[p.Id] = p.Name
+		}
+		for _, p := range change.After {
+			names[p.Id] = p.Name
+		}
+		if err := d.sink.OnMatchRecorded(ctx, matchResultFromStorage(tx), names); err != nil {
+			log.Printf("result sink %T: match %s: %v", d.sink, tx.Id, err)
+		}
+	}
+
+	// Listeners may run out of order; never replace a newer ladder with an older one
+	if change.Seq < d.lastSeq {
+		return
+	}
+	d.lastSeq = change.Seq
+	if err := d.sink.OnLadderChanged(ctx, change.After); err != nil {
+		log.Printf("result sink %T: ladder update: %v", d.sink, err)
+	}
+}
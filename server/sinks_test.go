@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	matches []string
+	ladders [][]*ladderpb.Player
+}
+
+func (s *recordingSink) OnMatchRecorded(ctx context.Context, mr *ladderpb.MatchResult, names map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loser := mr.ChallengerId
+	if mr.WinnerId == loser {
+		loser = mr.DefenderId
+	}
+	s.matches = append(s.matches, names[mr.WinnerId]+" beat "+names[loser])
+	return nil
+}
+
+func (s *recordingSink) OnLadderChanged(ctx context.Context, players []*ladderpb.Player) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ladders = append(s.ladders, players)
+	return nil
+}
+
+// done reports whether a match and a ladder with leader first have been delivered
+func (s *recordingSink) done(leader string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.matches) == 0 || len(s.ladders) == 0 {
+		return false
+	}
+	last := s.ladders[len(s.ladders)-1]
+	return len(last) > 0 && last[0].Id == leader
+}
+
+func TestResultSink_Delivery(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	sink := &recordingSink{}
+	attachResultSink(m, sink)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !sink.done("bob") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the match and updated ladder")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.matches) != 1 || sink.matches[0] != "Bob beat Alice" {
+		t.Errorf("expected one match with names resolved, got %q", sink.matches)
+	}
+}
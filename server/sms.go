@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+const (
+	// pendingSMSTimeout is how long an SMS result waits for the opponent's confirmation
+	pendingSMSTimeout = 30 * time.Minute
+	twilioAPIBase     = "https://api.twilio.com"
+	// smsPath is the webhook Twilio posts inbound messages to
+	smsPath = "/api/sms/twilio"
+)
+
+// SMSHandler accepts Twilio inbound message webhooks. Players link their phone numbers
+// in their notification settings; one texts "RESULT Bob beat Alice 11-5 11-7 11-3"
+// about their own match, and the opponent is texted a code to confirm it with
+// "YES <code>".
+type SMSHandler struct {
+	service    *LadderService
+	authToken  string
+	webhookURL string
+	contacts   *NotificationStore // Links players' phone numbers; nil when notifications are off
+	pending    *pendingResults
+	apiBase    string
+	client     *http.Client
+}
+
+// smsMessage is an inbound message as Twilio posts it
+type smsMessage struct {
+	accountSID string
+	from       string
+	to         string // The club's Twilio number, which replies are sent from
+	body       string
+}
+
+// pendingResults holds results read from messages until they are confirmed. Codes are
+// only unique per confirming sender, so two senders can't confirm each other's results
+// or replace them.
+type pendingResults struct {
+	timeout time.Duration
+	newCode func() (string, error)
+
+	mu      sync.Mutex
+	results map[pendingKey]*pendingResult
+}
+
+type pendingKey struct {
+	sender string
+	code   string
+}
+
+type pendingResult struct {
+	clubID    string // Empty for the default ladder
+	request   *ladderpb.AddMatchResultRequest
+	summary   string
+	expiresAt time.Time
+}
+
+func newPendingResults(timeout time.Duration) *pendingResults {
+	return &pendingResults{
+		timeout: timeout,
+		newCode: confirmationCode,
+		results: make(map[pendingKey]*pendingResult),
+	}
+}
+
+// add keeps a result of a club's ladder until sender confirms it, and returns the code
+// that confirms it
+func (p *pendingResults) add(sender, clubID string, req *ladderpb.AddMatchResultRequest, summary string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expireLocked()
+	for i := 0; i < 100; i++ {
+		code, err := p.newCode()
+		if err != nil {
+			return "", err
+		}
+		key := pendingKey{sender: sender, code: code}
+		if _, taken := p.results[key]; taken {
+			continue
+		}
+		p.results[key] = &pendingResult{clubID: clubID, request: req, summary: summary, expiresAt: time.Now().Add(p.timeout)}
+		return code, nil
+	}
+	return "", fmt.Errorf("no free confirmation code for %s", sender)
+}
+
+// take removes and returns the result sender is confirming with code
+func (p *pendingResults) take(sender, code string) (*pendingResult, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expireLocked()
+	key := pendingKey{sender: sender, code: code}
+	result, ok := p.results[key]
+	delete(p.results, key)
+	return result, ok
+}
+
+// forget drops the pending results of a club's ladder that involve a player
+func (p *pendingResults) forget(clubID, playerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, result := range p.results {
+		if result.clubID == clubID && (result.request.ChallengerId == playerID || result.request.DefenderId == playerID) {
+			delete(p.results, key)
+		}
+	}
+}
+
+func (p *pendingResults) expireLocked() {
+	now := time.Now()
+	for key, result := range p.results {
+		if now.After(result.expiresAt) {
+			delete(p.results, key)
+		}
+	}
+}
+
+// NewSMSHandler creates a Twilio webhook handler. authToken is used to validate
+// X-Twilio-Signature; webhookURL is the public URL configured in Twilio, which is
+// needed when the server sits behind a proxy.
+func NewSMSHandler(service *LadderService, authToken, webhookURL string) *SMSHandler {
+	return &SMSHandler{
+		service:    service,
+		authToken:  authToken,
+		webhookURL: webhookURL,
+		pending:    newPendingResults(pendingSMSTimeout),
+		apiBase:    twilioAPIBase,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ServeHTTP handles a single inbound message and replies with TwiML
+func (h *SMSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.validSignature(r) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	reply := h.handleMessage(r.Context(), smsMessage{
+		accountSID: r.PostForm.Get("AccountSid"),
+		from:       r.PostForm.Get("From"),
+		to:         r.PostForm.Get("To"),
+		body:       r.PostForm.Get("Body"),
+	})
+	writeTwiML(w, reply)
+}
+
+func (h *SMSHandler) handleMessage(ctx context.Context, msg smsMessage) string {
+	fields := strings.Fields(msg.body)
+	if len(fields) == 0 {
+		return smsHelp
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "RESULT":
+		return h.handleResult(ctx, msg, strings.Join(fields[1:], " "))
+	case "YES", "CONFIRM":
+		if len(fields) != 2 {
+			return "Reply YES followed by your confirmation code."
+		}
+		return h.handleConfirm(ctx, msg.from, fields[1])
+	}
+	return smsHelp
+}
+
+const smsHelp = "Text RESULT <winner> beat <loser> <scores>, e.g. RESULT Bob beat Alice 11-5 11-7 11-3"
+
+func (h *SMSHandler) handleResult(ctx context.Context, msg smsMessage, text string) string {
+	if h.contacts == nil {
+		return "Results can't be entered by SMS on this server."
+	}
+	clubID, senderID, ok := h.contacts.PlayerByPhone(msg.from)
+	if !ok {
+		return "This number isn't linked to a player. Add it to your notification settings first."
+	}
+	ctx, err := h.service.clubContext(ctx, clubID)
+	if err != nil {
+		log.Printf("sms: failed to open club %q: %v", clubID, err)
+		return "Sorry, something went wrong. Please try again."
+	}
+
+	resp, err := h.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return "Sorry, something went wrong. Please try again."
+	}
+	req, summary, err := parseResultText(resp.Players, text)
+	if err != nil {
+		return fmt.Sprintf("Could not read result: %v. %s", err, smsHelp)
+	}
+	var opponentID string
+	switch senderID {
+	case req.ChallengerId:
+		opponentID = req.DefenderId
+	case req.DefenderId:
+		opponentID = req.ChallengerId
+	default:
+		return "You can only report your own matches."
+	}
+	rules, err := h.service.modelFor(ctx).GetLadderRules()
+	if err != nil {
+		return "Sorry, something went wrong. Please try again."
+	}
+	challengerStart, defenderStart := handicapStarts(resp.Players, req.ChallengerId, req.DefenderId)
+	if _, err := ValidateScoreHandicap(req.SetScores, rules.ScoringFormat, challengerStart, defenderStart); err != nil {
+		return fmt.Sprintf("Invalid score: %v", err)
+	}
+
+	opponentPhone := h.contacts.Phone(clubID, opponentID)
+	if opponentPhone == "" {
+		return fmt.Sprintf("%s has no phone number linked, so they can't confirm by SMS.", playerName(resp.Players, opponentID))
+	}
+	code, err := h.pending.add(opponentPhone, clubID, req, summary)
+	if err != nil {
+		log.Printf("failed to generate SMS confirmation code: %v", err)
+		return "Sorry, something went wrong. Please try again."
+	}
+	prompt := fmt.Sprintf("%s reported: %s. Reply YES %s to confirm.", playerName(resp.Players, senderID), summary, code)
+	if err := h.send(ctx, msg.accountSID, msg.to, opponentPhone, prompt); err != nil {
+		log.Printf("sms: failed to send the confirmation code: %v", err)
+		h.pending.take(opponentPhone, code)
+		return "Sorry, the confirmation could not be sent. Please try again."
+	}
+	return fmt.Sprintf("%s. Sent to %s to confirm.", summary, playerName(resp.Players, opponentID))
+}
+
+func (h *SMSHandler) handleConfirm(ctx context.Context, from, code string) string {
+	p, ok := h.pending.take(from, code)
+	if !ok {
+		return "No pending result for that code. It may have expired."
+	}
+
+	ctx, err := h.service.clubContext(ctx, p.clubID)
+	if err != nil {
+		log.Printf("sms: failed to open club %q: %v", p.clubID, err)
+		return "Sorry, something went wrong. Please try again."
+	}
+	ctx = h.service.clientContext(ctx, clientSMS, "", from)
+	if _, err := h.service.AddMatchResult(ctx, p.request); err != nil {
+		return fmt.Sprintf("Could not record result: %v", err)
+	}
+	return fmt.Sprintf("Recorded: %s.", p.summary)
+}
+
+// send texts body to a phone number through Twilio's Messages API, from the number and
+// account the inbound message was addressed to
+func (h *SMSHandler) send(ctx context.Context, accountSID, from, to, body string) error {
+	form := url.Values{"From": {from}, "To": {to}, "Body": {body}}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", h.apiBase, url.PathEscape(accountSID))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(accountSID, h.authToken)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("twilio returned %s", resp.Status)
+	}
+	return nil
+}
+
+// validSignature checks X-Twilio-Signature as described in Twilio's webhook security docs
+func (h *SMSHandler) validSignature(r *http.Request) bool {
+	if h.authToken == "" {
+		return true
+	}
+
+	url := h.webhookURL
+	if url == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		url = scheme + "://" + r.Host + r.URL.RequestURI()
+	}
+
+	keys := make([]string, 0, len(r.PostForm))
+	for k := range r.PostForm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(url)
+	for _, k := range keys {
+		for _, v := range r.PostForm[k] {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(h.authToken))
+	mac.Write([]byte(b.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Twilio-Signature")))
+}
+
+// playerName returns the name of a listed player, or the ID of an unknown one
+func playerName(players []*ladderpb.Player, id string) string {
+	for _, p := range players {
+		if p.Id == id {
+			return p.Name
+		}
+	}
+	return id
+}
+
+func confirmationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%04d", n.Int64()), nil
+}
+
+func writeTwiML(w http.ResponseWriter, message string) {
+	type twimlMessage struct {
+		XMLName xml.Name `xml:"Response"`
+		Message string   `xml:"Message"`
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(twimlMessage{Message: message})
+}
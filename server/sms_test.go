@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// smsTestHandler returns a handler whose players link the given phone numbers and
+// whose texts are collected from a fake Twilio API
+func smsTestHandler(t *testing.T, service *LadderService, clubID string, phones map[string]string) (*SMSHandler, chan url.Values) {
+	store, err := NewNotificationStore(filepath.Join(t.TempDir(), "notifications.json"))
+	if err != nil {
+		t.Fatalf("NewNotificationStore failed: %v", err)
+	}
+	for playerID, phone := range phones {
+		store.SetPhone(clubID, playerID, phone)
+	}
+	sent := make(chan url.Values, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" {
+			t.Errorf("unexpected Twilio request %s", r.URL.Path)
+		}
+		r.ParseForm()
+		sent <- r.PostForm
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(api.Close)
+
+	h := NewSMSHandler(service, "", "")
+	h.apiBase = api.URL
+	NewNotifier(store).EnableSMS(h)
+	return h, sent
+}
+
+func smsFrom(from, body string) smsMessage {
+	return smsMessage{accountSID: "AC1", from: from, to: "+999", body: body}
+}
+
+var smsCode = regexp.MustCompile(`YES (\d{4})`)
+
+func TestSMSHandler_ResultAndConfirm(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice Jones", "alice")
+	m.AddPlayer("Bob Smith", "bob")
+	m.AddPlayer("Charlie", "charlie")
+
+	h, sent := smsTestHandler(t, NewLadderService(m), "", map[string]string{"alice": "+100", "bob": "+200", "charlie": "+300"})
+	ctx := context.Background()
+
+	if reply := h.handleMessage(ctx, smsFrom("+400", "RESULT bob beat Alice Jones 11-5 11-7 11-3")); !strings.HasPrefix(reply, "This number isn't linked") {
+		t.Errorf("unknown numbers must not report results, got %q", reply)
+	}
+	if reply := h.handleMessage(ctx, smsFrom("+300", "RESULT bob beat Alice Jones 11-5 11-7 11-3")); !strings.HasPrefix(reply, "You can only report your own matches") {
+		t.Errorf("players must not report others' matches, got %q", reply)
+	}
+
+	reply := h.handleMessage(ctx, smsFrom("+200", "RESULT bob beat Alice Jones 11-5, 11-7, 11-3"))
+	if !strings.HasPrefix(reply, "Bob Smith beat Alice Jones 11-5 11-7 11-3") || !strings.Contains(reply, "Sent to Alice Jones") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	text := <-sent
+	code := smsCode.FindStringSubmatch(text.Get("Body"))
+	if code == nil || text.Get("To") != "+100" || text.Get("From") != "+999" {
+		t.Fatalf("expected the code to be texted to Alice, got %v", text)
+	}
+
+	if reply := h.handleMessage(ctx, smsFrom("+200", "YES "+code[1])); !strings.HasPrefix(reply, "No pending result") {
+		t.Errorf("the reporter must not confirm their own result, got %q", reply)
+	}
+	if len(m.ListPlayers()) != 3 || m.ListPlayers()[0].Id != "alice" {
+		t.Fatal("result must not be recorded before confirmation")
+	}
+
+	if reply := h.handleMessage(ctx, smsFrom("+100", "yes "+code[1])); !strings.HasPrefix(reply, "Recorded") {
+		t.Fatalf("expected result to be recorded, got %q", reply)
+	}
+
+	matches, _ := m.GetRecentMatches(1)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	// Bob was ranked lower, so he is the challenger and the scores stay winner first
+	if matches[0].ChallengerId != "bob" || matches[0].SetScores[0].ChallengerPoints != 11 {
+		t.Errorf("unexpected match: %+v", matches[0])
+	}
+	if m.ListPlayers()[0].Id != "bob" {
+		t.Error("Bob should be #1 after the confirmed result")
+	}
+}
+
+func TestSMSHandler_SameCode(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Charlie", "charlie")
+
+	h, sent := smsTestHandler(t, NewLadderService(m), "", map[string]string{"alice": "+100", "bob": "+200", "charlie": "+300"})
+	codes := []string{"1234", "1234", "1234", "5678"}
+	h.pending.newCode = func() (string, error) {
+		code := codes[0]
+		codes = codes[1:]
+		return code, nil
+	}
+	ctx := context.Background()
+
+	// Another opponent may get the same code; the same opponent gets a new one
+	for _, tt := range []struct{ from, body, to, want string }{
+		{"+200", "RESULT Bob beat Alice 11-5 11-5 11-5", "+100", "YES 1234"},
+		{"+300", "RESULT Charlie beat Bob 11-5 11-5 11-5", "+200", "YES 1234"},
+		{"+300", "RESULT Charlie beat Alice 11-5 11-5 11-5", "+100", "YES 5678"},
+	} {
+		h.handleMessage(ctx, smsFrom(tt.from, tt.body))
+		if text := <-sent; text.Get("To") != tt.to || !strings.Contains(text.Get("Body"), tt.want) {
+			t.Fatalf("%s: expected %q texted to %s, got %v", tt.body, tt.want, tt.to, text)
+		}
+	}
+	for _, tt := range []struct{ from, code string }{{"+100", "1234"}, {"+200", "1234"}, {"+100", "5678"}} {
+		if reply := h.handleMessage(ctx, smsFrom(tt.from, "YES "+tt.code)); !strings.HasPrefix(reply, "Recorded") {
+			t.Errorf("%s confirming %s: expected the result to be recorded, got %q", tt.from, tt.code, reply)
+		}
+	}
+	if matches, _ := m.GetRecentMatches(5); len(matches) != 3 {
+		t.Errorf("expected 3 matches, got %d", len(matches))
+	}
+}
+
+func TestSMSHandler_Club(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	r, _ := NewClubRegistry(t.TempDir(), nil)
+	defer r.Close()
+	r.CreateClub("riverside", "Riverside SC", nil)
+	club, _ := r.Model("riverside")
+	club.AddPlayer("Alice", "alice")
+	club.AddPlayer("Bob", "bob")
+
+	svc := NewLadderService(m)
+	svc.clubs = r
+	h, sent := smsTestHandler(t, svc, "riverside", map[string]string{"alice": "+100", "bob": "+200"})
+	ctx := context.Background()
+
+	h.handleMessage(ctx, smsFrom("+200", "RESULT Bob beat Alice 11-5 11-5 11-5"))
+	code := smsCode.FindStringSubmatch((<-sent).Get("Body"))
+	if code == nil {
+		t.Fatal("expected a confirmation code to be texted")
+	}
+	if reply := h.handleMessage(ctx, smsFrom("+100", "YES "+code[1])); !strings.HasPrefix(reply, "Recorded") {
+		t.Fatalf("expected result to be recorded, got %q", reply)
+	}
+	if matches, _ := club.GetRecentMatches(1); len(matches) != 1 {
+		t.Error("the result should be recorded on the players' club ladder")
+	}
+	if matches, _ := m.GetRecentMatches(1); len(matches) != 0 {
+		t.Error("the default ladder should be left alone")
+	}
+}
+
+func TestSMSHandler_ParseErrors(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	h, _ := smsTestHandler(t, NewLadderService(m), "", map[string]string{"alice": "+100", "bob": "+200"})
+	for _, body := range []string{
+		"RESULT Bob Alice 11-5 11-5 11-5",
+		"RESULT Bob beat Zed 11-5 11-5 11-5",
+		"RESULT Bob beat Alice",
+		"RESULT Bob beat Alice 11-10 11-5 11-5",
+	} {
+		if reply := h.handleMessage(context.Background(), smsFrom("+100", body)); strings.Contains(reply, "Sent to") {
+			t.Errorf("%q: expected an error reply, got %q", body, reply)
+		}
+	}
+}
+
+func TestSMSHandler_Signature(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	const webhook = "https://ladder.example.com/api/sms/twilio"
+	h := NewSMSHandler(NewLadderService(m), "token", webhook)
+
+	form := url.Values{"From": {"+100"}, "Body": {"HELP"}}
+	mac := hmac.New(sha1.New, []byte("token"))
+	mac.Write([]byte(webhook + "Body" + "HELP" + "From" + "+100"))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	for _, tt := range []struct {
+		signature string
+		want      int
+	}{
+		{signature, http.StatusOK},
+		{"bogus", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("POST", "/api/sms/twilio", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Twilio-Signature", tt.signature)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("signature %q: got status %d, want %d", tt.signature, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// sportyHQAPIBase is the default SportyHQ API endpoint
+const sportyHQAPIBase = "https://api.sportyhq.com/v1"
+
+// SportyHQAdapter pushes ladder results to a SportyHQ ladder and reads its roster
+type SportyHQAdapter struct {
+	apiBase  string
+	apiKey   string
+	ladderID string
+	client   *http.Client
+}
+
+// NewSportyHQAdapter creates an adapter for the given SportyHQ ladder. An empty
+// apiBase uses the public API.
+func NewSportyHQAdapter(apiBase, apiKey, ladderID string) *SportyHQAdapter {
+	if apiBase == "" {
+		apiBase = sportyHQAPIBase
+	}
+	return &SportyHQAdapter{
+		apiBase:  strings.TrimSuffix(apiBase, "/"),
+		apiKey:   apiKey,
+		ladderID: ladderID,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name identifies the adapter in logs and the cursor file name
+func (a *SportyHQAdapter) Name() string {
+	return "SportyHQ"
+}
+
+type sportyHQResult struct {
+	ExternalID string         `json:"external_id"` // Deduplicates retried pushes
+	PlayedAt   string         `json:"played_at"`
+	Player1    sportyHQPlayer `json:"player1"`
+	Player2    sportyHQPlayer `json:"player2"`
+	Winner     int            `json:"winner"` // 1 or 2
+	Games      []sportyHQGame `json:"games"`
+	Walkover   bool           `json:"walkover"`
+}
+
+type sportyHQPlayer struct {
+	ExternalID string `json:"external_id"`
+	Name       string `json:"name"`
+}
+
+type sportyHQGame struct {
+	Player1 int32 `json:"player1"`
+	Player2 int32 `json:"player2"`
+}
+
+// PushResult posts one match, challenger as player 1
+func (a *SportyHQAdapter) PushResult(ctx context.Context, mr *ladderpb.MatchResult, names map[string]string) error {
+	result := sportyHQResult{
+		ExternalID: mr.TransactionId,
+		PlayedAt:   time.UnixMilli(mr.PlayedAtMs).UTC().Format(time.RFC3339),
+		Player1:    sportyHQPlayer{ExternalID: mr.ChallengerId, Name: names[mr.ChallengerId]},
+		Player2:    sportyHQPlayer{ExternalID: mr.DefenderId, Name: names[mr.DefenderId]},
+		Winner:     1,
+		Games:      []sportyHQGame{},
+	}
+	if mr.WinnerId == mr.DefenderId {
+		result.Winner = 2
+	}
+	for _, s := range mr.SetScores {
+		if s.ChallengerDefault || s.DefenderDefault {
+			result.Walkover = true
+			continue
+		}
+		result.Games = append(result.Games, sportyHQGame{Player1: s.ChallengerPoints, Player2: s.DefenderPoints})
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	resp, err := a.do(ctx, "POST", "/ladders/"+a.ladderID+"/results", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// A result that was already pushed is reported as a conflict
+	if resp.StatusCode == http.StatusConflict {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("SportyHQ returned %s", resp.Status)
+	}
+	return nil
+}
+
+// PullRoster lists the players on the SportyHQ ladder
+func (a *SportyHQAdapter) PullRoster(ctx context.Context) ([]RosterEntry, error) {
+	resp, err := a.do(ctx, "GET", "/ladders/"+a.ladderID+"/players", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("SportyHQ returned %s", resp.Status)
+	}
+
+	var body struct {
+		Players []sportyHQPlayer `json:"players"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid roster response: %v", err)
+	}
+	roster := make([]RosterEntry, 0, len(body.Players))
+	for _, p := range body.Players {
+		roster = append(roster, RosterEntry{ID: p.ExternalID, Name: p.Name})
+	}
+	return roster, nil
+}
+
+func (a *SportyHQAdapter) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.apiBase+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return a.client.Do(req)
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	"squash-ladder/server/replay"
+)
+
+const (
+	// defaultSyncInterval is how often the sync job runs when nothing nudges it sooner
+	defaultSyncInterval = 5 * time.Minute
+	// syncRetryMin and syncRetryMax bound the backoff after a failed run
+	syncRetryMin = 30 * time.Second
+	syncRetryMax = 30 * time.Minute
+)
+
+var (
+	syncResultsPushed = expvar.NewInt("sync_results_pushed")
+	syncFailures      = expvar.NewInt("sync_failures")
+)
+
+// RosterEntry is a player known to an external system
+type RosterEntry struct {
+	ID   string
+	Name string
+}
+
+// SyncAdapter connects the ladder to an external results service. PushResult must be
+// idempotent on mr.TransactionId since a result is pushed again if the run fails
+// before its cursor is saved.
+type SyncAdapter interface {
+	Name() string
+	PushResult(ctx context.Context, mr *ladderpb.MatchResult, names map[string]string) error
+	// PullRoster returns the external roster; adapters that cannot provide one return nil
+	PullRoster(ctx context.Context) ([]RosterEntry, error)
+}
+
+// SyncReport summarises a single sync run
+type SyncReport struct {
+	Pushed       int
+	PlayersAdded int
+}
+
+// SyncJob pushes new match results to a SyncAdapter in the background, resuming from a
+// cursor file next to the log, and optionally adds players from the external roster
+type SyncJob struct {
+	model      *Model
+	adapter    SyncAdapter
+	interval   time.Duration
+	pullRoster bool
+	cursorPath string
+
+	mu    sync.Mutex // Serialises runs
+	nudge chan struct{}
+}
+
+// NewSyncJob creates a job for adapter that runs every interval (default 5m) and
+// whenever the ladder changes
+func NewSyncJob(m *Model, adapter SyncAdapter, interval time.Duration, pullRoster bool) *SyncJob {
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	return &SyncJob{
+		model:      m,
+		adapter:    adapter,
+		interval:   interval,
+		pullRoster: pullRoster,
+		cursorPath: m.LogFilePath + ".sync-" + strings.ToLower(adapter.Name()),
+		nudge:      make(chan struct{}, 1),
+	}
+}
+
+// Start runs the job in the background until stop is closed. A failed run is retried
+// with exponential backoff.
+func (j *SyncJob) Start(stop <-chan struct{}) {
+	j.model.OnChange(func(LadderChange) {
+		select {
+		case j.nudge <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		wait := time.Duration(0)
+		retry := syncRetryMin
+		for {
+			timer := time.NewTimer(wait)
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-j.nudge:
+				timer.Stop()
+			case <-timer.C:
+			}
+
+			if _, err := j.RunOnce(context.Background()); err != nil {
+				log.Printf("%s sync failed, retrying in %s: %v", j.adapter.Name(), retry, err)
+				wait = retry
+				retry = min(retry*2, syncRetryMax)
+				continue
+			}
+			wait, retry = j.interval, syncRetryMin
+		}
+	}()
+}
+
+// RunOnce pushes every valid match recorded since the last successful push and, if
+// enabled, adds roster players missing from the ladder
+func (j *SyncJob) RunOnce(ctx context.Context) (*SyncReport, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	report := &SyncReport{}
+	if j.pullRoster {
+		added, err := j.syncRoster(ctx)
+		report.PlayersAdded = added
+		if err != nil {
+			syncFailures.Add(1)
+			return report, fmt.Errorf("roster pull failed: %v", err)
+		}
+	}
+
+	cursor, err := j.readCursor()
+	if err != nil {
+		return report, err
+	}
+	matches, names, last, err := j.model.matchesAfter(cursor)
+	if err != nil {
+		return report, err
+	}
+
+	for _, mr := range matches {
+		if err := j.adapter.PushResult(ctx, mr, names); err != nil {
+			syncFailures.Add(1)
+			return report, fmt.Errorf("failed to push %s: %v", mr.TransactionId, err)
+		}
+		report.Pushed++
+		syncResultsPushed.Add(1)
+		if err := j.writeCursor(mr.TransactionId); err != nil {
+			return report, err
+		}
+	}
+	if last != "" && last != cursor {
+		if err := j.writeCursor(last); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (j *SyncJob) syncRoster(ctx context.Context) (int, error) {
+	roster, err := j.adapter.PullRoster(ctx)
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool)
+	for _, p := range j.model.ListPlayers() {
+		known[p.Id] = true
+	}
+	added := 0
+	for _, e := range roster {
+		if e.ID == "" || known[e.ID] {
+			continue
+		}
+		if _, err := j.model.AddPlayer(e.Name, e.ID); err != nil {
+			return added, err
+		}
+		known[e.ID] = true
+		added++
+	}
+	return added, nil
+}
+
+func (j *SyncJob) readCursor() (string, error) {
+	data, err := os.ReadFile(j.cursorPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (j *SyncJob) writeCursor(txID string) error {
+	tmp := j.cursorPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(txID+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.cursorPath)
+}
+
+// matchesAfter returns the valid matches written after the transaction cursor (all of
+// them if cursor is empty), the player names, and the ID of the last transaction in the log.
+// Friendlies are left out, as they are no ladder results.
+func (m *Model) matchesAfter(cursor string) ([]*ladderpb.MatchResult, map[string]string, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	start := 0
+	if cursor != "" {
+		idx := indexOfTransaction(txs, cursor)
+		if idx == -1 {
+			return nil, nil, "", fmt.Errorf("sync cursor %s not found in log", cursor)
+		}
+		start = idx + 1
+	}
+
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	matches := []*ladderpb.MatchResult{}
+	for _, t := range txs[start:] {
+		if mr := t.GetMatchResultPayload(); mr != nil && !mr.Friendly && !invalidated[t.Id] {
+			matches = append(matches, matchResultFromStorage(t))
+		}
+	}
+	last := ""
+	if len(txs) > 0 {
+		last = txs[len(txs)-1].Id
+	}
+	return matches, playerNames(txs), last, nil
+}
+
+// SyncNow runs the configured sync job immediately
+func (h *LadderService) SyncNow(ctx context.Context, req *ladderpb.SyncNowRequest) (*ladderpb.SyncNowResponse, error) {
+	if h.sync == nil {
+		return &ladderpb.SyncNowResponse{Success: false}, fmt.Errorf("no sync integration is configured")
+	}
+	report, err := h.sync.RunOnce(ctx)
+	resp := &ladderpb.SyncNowResponse{
+		Success:      err == nil,
+		Pushed:       int32(report.Pushed),
+		PlayersAdded: int32(report.PlayersAdded),
+	}
+	return resp, err
+}
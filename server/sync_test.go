@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// fakeSportyHQ records pushed results and serves a fixed roster
+type fakeSportyHQ struct {
+	mu      sync.Mutex
+	results []sportyHQResult
+	fail    bool
+}
+
+func (f *fakeSportyHQ) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/ladders/L1/results":
+		if f.fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var res sportyHQResult
+		json.NewDecoder(r.Body).Decode(&res)
+		f.results = append(f.results, res)
+	case r.Method == "GET" && r.URL.Path == "/ladders/L1/players":
+		w.Write([]byte(`{"players":[{"external_id":"alice","name":"Alice"},{"external_id":"dave","name":"Dave"}]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSyncJob_SportyHQ(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer os.Remove(path + ".sync-sportyhq")
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 11, DefenderPoints: 9}, {ChallengerPoints: 11, DefenderPoints: 2}})
+	invalid, _ := m.AddMatchResult("alice", "bob", "alice", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	m.InvalidateMatchResult(context.Background(), invalid)
+
+	fake := &fakeSportyHQ{}
+	api := httptest.NewServer(fake)
+	defer api.Close()
+
+	job := NewSyncJob(m, NewSportyHQAdapter(api.URL, "key", "L1"), 0, true)
+	report, err := job.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if report.Pushed != 1 || report.PlayersAdded != 1 {
+		t.Errorf("expected 1 result pushed and 1 player added, got %+v", report)
+	}
+	if len(fake.results) != 1 {
+		t.Fatalf("expected the invalidated match to be skipped, got %d results", len(fake.results))
+	}
+	res := fake.results[0]
+	if res.Player1.Name != "Bob" || res.Winner != 1 || len(res.Games) != 3 || res.Games[1].Player2 != 9 {
+		t.Errorf("unexpected pushed result: %+v", res)
+	}
+	if !containsPlayer(m.ListPlayers(), "dave") {
+		t.Error("expected dave to be added from the roster")
+	}
+
+	// Nothing new to push on the next run
+	if report, err := job.RunOnce(context.Background()); err != nil || report.Pushed != 0 {
+		t.Errorf("expected nothing to push, got %+v, %v", report, err)
+	}
+
+	// A failed push is retried on the next run
+	m.AddMatchResult("dave", "bob", "bob", []*ladderpb.SetScore{{DefenderPoints: 11}, {DefenderPoints: 11}, {DefenderPoints: 11}})
+	fake.fail = true
+	if _, err := job.RunOnce(context.Background()); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the push to fail, got %v", err)
+	}
+	fake.fail = false
+	svc := NewLadderService(m)
+	svc.sync = job
+	resp, err := svc.SyncNow(context.Background(), &ladderpb.SyncNowRequest{})
+	if err != nil || resp.Pushed != 1 {
+		t.Errorf("expected the failed result to be pushed by SyncNow, got %+v, %v", resp, err)
+	}
+	if last := fake.results[len(fake.results)-1]; last.Player1.ExternalID != "dave" || last.Winner != 2 {
+		t.Errorf("unexpected retried result: %+v", last)
+	}
+
+	if _, err := NewLadderService(m).SyncNow(context.Background(), &ladderpb.SyncNowRequest{}); err == nil {
+		t.Error("expected SyncNow to fail when no sync is configured")
+	}
+}
+
+// fakeAdapter records the results pushed to it
+type fakeAdapter struct {
+	pushed []*ladderpb.MatchResult
+}
+
+func (f *fakeAdapter) Name() string { return "fake" }
+
+func (f *fakeAdapter) PushResult(ctx context.Context, mr *ladderpb.MatchResult, names map[string]string) error {
+	f.pushed = append(f.pushed, mr)
+	return nil
+}
+
+func (f *fakeAdapter) PullRoster(ctx context.Context) ([]RosterEntry, error) { return nil, nil }
+
+func TestSyncJob_SkipsFriendlies(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer os.Remove(path + ".sync-fake")
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	sets := []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}}
+	m.AddMatchResultAt("alice", "bob", "alice", sets, time.Time{}, false, true)
+	txID, _ := m.AddMatchResult("bob", "alice", "bob", sets)
+
+	fake := &fakeAdapter{}
+	report, err := NewSyncJob(m, fake, 0, false).RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if report.Pushed != 1 || len(fake.pushed) != 1 || fake.pushed[0].TransactionId != txID {
+		t.Errorf("expected only the ladder match to be pushed, got %+v, %v", report, fake.pushed)
+	}
+}
+
+func containsPlayer(players []*ladderpb.Player, id string) bool {
+	for _, p := range players {
+		if p.Id == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,426 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/grpc/codes"
+)
+
+// teamsAndFixtures replays the TEAM and FIXTURE transactions that were not undone. Teams
+// come back in the order they were created, fixtures oldest first.
+func teamsAndFixtures(txs []*storagepb.TransactionStorage) ([]*ladderpb.Team, []*ladderpb.Fixture) {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	var teams []*ladderpb.Team
+	var fixtures []*ladderpb.Fixture
+	byID := make(map[string]*ladderpb.Team)
+	for _, t := range txs {
+		if invalidated[t.Id] {
+			continue
+		}
+		switch t.Type {
+		case storagepb.TransactionType_TEAM:
+			p := t.GetTeamPayload()
+			team, ok := byID[p.TeamId]
+			if !ok {
+				team = &ladderpb.Team{Id: p.TeamId}
+				teams = append(teams, team)
+				byID[p.TeamId] = team
+			}
+			team.Name = p.Name
+			team.PlayerIds = p.PlayerIds
+		case storagepb.TransactionType_FIXTURE:
+			f := fixtureFromStorage(t)
+			fixtures = append(fixtures, f)
+			if team, ok := byID[f.TeamId]; ok {
+				team.Played++
+				switch f.Outcome {
+				case ladderpb.FixtureOutcome_OUTCOME_WIN:
+					team.Won++
+				case ladderpb.FixtureOutcome_OUTCOME_DRAW:
+					team.Drawn++
+				case ladderpb.FixtureOutcome_OUTCOME_LOSS:
+					team.Lost++
+				}
+			}
+		}
+	}
+	return teams, fixtures
+}
+
+func fixtureFromStorage(t *storagepb.TransactionStorage) *ladderpb.Fixture {
+	p := t.GetFixturePayload()
+	f := &ladderpb.Fixture{
+		Id:         p.FixtureId,
+		TeamId:     p.TeamId,
+		Opponent:   p.Opponent,
+		Home:       p.Home,
+		PlayedAtMs: p.PlayedAtMs,
+	}
+	if f.PlayedAtMs == 0 {
+		f.PlayedAtMs = t.TimestampMs
+	}
+	for _, r := range p.Rubbers {
+		rubber := &ladderpb.Rubber{
+			Position:     r.Position,
+			PlayerId:     r.PlayerId,
+			OpponentName: r.OpponentName,
+			Won:          r.Won,
+		}
+		for _, s := range r.SetScores {
+			rubber.SetScores = append(rubber.SetScores, &ladderpb.SetScore{
+				ChallengerPoints:  s.ChallengerPoints,
+				DefenderPoints:    s.DefenderPoints,
+				ChallengerDefault: s.ChallengerDefault,
+				DefenderDefault:   s.DefenderDefault,
+			})
+		}
+		f.Rubbers = append(f.Rubbers, rubber)
+		if r.Won {
+			f.RubbersWon++
+		} else {
+			f.RubbersLost++
+		}
+	}
+	switch {
+	case f.RubbersWon > f.RubbersLost:
+		f.Outcome = ladderpb.FixtureOutcome_OUTCOME_WIN
+	case f.RubbersWon == f.RubbersLost:
+		f.Outcome = ladderpb.FixtureOutcome_OUTCOME_DRAW
+	default:
+		f.Outcome = ladderpb.FixtureOutcome_OUTCOME_LOSS
+	}
+	return f
+}
+
+func findTeam(teams []*ladderpb.Team, id string) *ladderpb.Team {
+	for _, t := range teams {
+		if t.Id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// SaveTeam creates a team, or renames it and replaces its squad when team.Id is set
+func (m *Model) SaveTeam(team *ladderpb.Team) (*ladderpb.Team, error) {
+	name := strings.TrimSpace(team.GetName())
+	if name == "" {
+		return nil, localizedStatusf(codes.InvalidArgument, "a team needs a name")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	teams, _ := teamsAndFixtures(txs)
+	id := team.Id
+	if id == "" {
+		id = m.newID()
+	} else if findTeam(teams, id) == nil {
+		return nil, localizedStatusf(codes.NotFound, "team not found: %s", id)
+	}
+	seen := make(map[string]bool)
+	for _, playerID := range team.PlayerIds {
+		if findPlayer(currentPlayers, playerID) == nil {
+			return nil, localizedStatusf(codes.NotFound, "player %s is not on the ladder", playerID)
+		}
+		if seen[playerID] {
+			return nil, localizedStatusf(codes.InvalidArgument, "player %s is listed twice", playerID)
+		}
+		seen[playerID] = true
+	}
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_TEAM,
+		TimestampMs: m.now().UnixMilli(),
+		Payload: &storagepb.TransactionStorage_TeamPayload{TeamPayload: &storagepb.TeamStorage{
+			TeamId:    id,
+			Name:      name,
+			PlayerIds: team.PlayerIds,
+		}},
+		PlayerList: ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+	teams, _ = teamsAndFixtures(append(txs, tx))
+	return findTeam(teams, id), nil
+}
+
+// Teams returns the club's teams with their fixture records
+func (m *Model) Teams() ([]*ladderpb.Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	teams, _ := teamsAndFixtures(txs)
+	return teams, nil
+}
+
+// RecordFixture records a team's fixture against another club, played at playedAt or
+// now if it is zero. Each rubber is scored with the ladder's scoring format, our
+// player taking the challenger's side.
+func (m *Model) RecordFixture(teamID, opponent string, home bool, playedAt time.Time, rubbers []*ladderpb.Rubber) (*ladderpb.Fixture, error) {
+	opponent = strings.TrimSpace(opponent)
+	if opponent == "" {
+		return nil, localizedStatusf(codes.InvalidArgument, "a fixture needs an opponent")
+	}
+	if len(rubbers) == 0 {
+		return nil, localizedStatusf(codes.InvalidArgument, "a fixture needs at least one rubber")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	teams, _ := teamsAndFixtures(txs)
+	if findTeam(teams, teamID) == nil {
+		return nil, localizedStatusf(codes.NotFound, "team not found: %s", teamID)
+	}
+
+	format := rulesAt(txs, len(txs)).ScoringFormat
+	payload := &storagepb.FixtureStorage{
+		FixtureId: m.newID(),
+		TeamId:    teamID,
+		Opponent:  opponent,
+		Home:      home,
+	}
+	if !playedAt.IsZero() {
+		payload.PlayedAtMs = playedAt.UnixMilli()
+	}
+	positions := make(map[int32]bool)
+	players := make(map[string]bool)
+	for _, r := range rubbers {
+		if r.Position < 1 || positions[r.Position] {
+			return nil, localizedStatusf(codes.InvalidArgument, "rubber positions must be distinct and start at 1")
+		}
+		positions[r.Position] = true
+		if findPlayer(currentPlayers, r.PlayerId) == nil {
+			return nil, localizedStatusf(codes.NotFound, "player %s is not on the ladder", r.PlayerId)
+		}
+		if players[r.PlayerId] {
+			return nil, localizedStatusf(codes.InvalidArgument, "player %s is listed twice", r.PlayerId)
+		}
+		players[r.PlayerId] = true
+		if len(r.SetScores) == 0 {
+			return nil, localizedStatusf(codes.InvalidArgument, "rubber %d has no scores", r.Position)
+		}
+		winner, err := ValidateScoreFormat(r.SetScores, format)
+		if err != nil {
+			return nil, err
+		}
+
+		rubber := &storagepb.RubberStorage{
+			Position:     r.Position,
+			PlayerId:     r.PlayerId,
+			OpponentName: strings.TrimSpace(r.OpponentName),
+			Won:          winner == 1,
+		}
+		for _, s := range r.SetScores {
+			rubber.SetScores = append(rubber.SetScores, &storagepb.SetScoreStorage{
+				ChallengerPoints:  s.ChallengerPoints,
+				DefenderPoints:    s.DefenderPoints,
+				ChallengerDefault: s.ChallengerDefault,
+				DefenderDefault:   s.DefenderDefault,
+			})
+		}
+		payload.Rubbers = append(payload.Rubbers, rubber)
+	}
+	sort.Slice(payload.Rubbers, func(i, j int) bool { return payload.Rubbers[i].Position < payload.Rubbers[j].Position })
+
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_FIXTURE,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_FixturePayload{FixturePayload: payload},
+		PlayerList:  ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+	return fixtureFromStorage(tx), nil
+}
+
+// Fixtures returns the recorded fixtures of teamID, or of every team if it is empty,
+// most recently played first
+func (m *Model) Fixtures(teamID string) ([]*ladderpb.Fixture, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	_, all := teamsAndFixtures(txs)
+	var fixtures []*ladderpb.Fixture
+	for _, f := range all {
+		if teamID == "" || f.TeamId == teamID {
+			fixtures = append(fixtures, f)
+		}
+	}
+	sort.SliceStable(fixtures, func(i, j int) bool { return fixtures[i].PlayedAtMs > fixtures[j].PlayedAtMs })
+	return fixtures, nil
+}
+
+// SuggestTeamSelection proposes the teamSize best placed players available on date,
+// taken from teamID's squad or the whole ladder. The ladder has no availability
+// calendar, so a player is unavailable when their holiday protection covers date.
+// Included players are always picked and excluded players never are.
+func (m *Model) SuggestTeamSelection(teamSize int, date time.Time, teamID string, include, exclude []string) (*ladderpb.SuggestTeamSelectionResponse, error) {
+	if teamSize < 1 {
+		return nil, localizedStatusf(codes.InvalidArgument, "team_size must be at least 1")
+	}
+	if len(include) > teamSize {
+		return nil, localizedStatusf(codes.InvalidArgument, "more players are included than fit in the team")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	players, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	var squad map[string]bool
+	if teamID != "" {
+		teams, _ := teamsAndFixtures(txs)
+		team := findTeam(teams, teamID)
+		if team == nil {
+			return nil, localizedStatusf(codes.NotFound, "team not found: %s", teamID)
+		}
+		squad = make(map[string]bool)
+		for _, id := range team.PlayerIds {
+			squad[id] = true
+		}
+	}
+	included := make(map[string]bool)
+	for _, id := range include {
+		if findPlayer(players, id) == nil {
+			return nil, localizedStatusf(codes.NotFound, "player %s is not on the ladder", id)
+		}
+		included[id] = true
+	}
+	excluded := make(map[string]bool)
+	for _, id := range exclude {
+		if included[id] {
+			return nil, localizedStatusf(codes.InvalidArgument, "player %s is both included and excluded", id)
+		}
+		excluded[id] = true
+	}
+
+	resp := &ladderpb.SuggestTeamSelectionResponse{}
+	open := teamSize - len(included)
+	for _, p := range players {
+		switch {
+		case included[p.Id]:
+			resp.Selected = append(resp.Selected, p)
+		case excluded[p.Id] || (squad != nil && !squad[p.Id]):
+		case protectedAt(p, date):
+			resp.Unavailable = append(resp.Unavailable, p)
+		case open > 0:
+			resp.Selected = append(resp.Selected, p)
+			open--
+		default:
+			resp.Reserves = append(resp.Reserves, p)
+		}
+	}
+	return resp, nil
+}
+
+// SaveTeam creates or updates a team
+func (h *LadderService) SaveTeam(ctx context.Context, req *ladderpb.SaveTeamRequest) (*ladderpb.SaveTeamResponse, error) {
+	if req.Team == nil {
+		return nil, localizedStatusf(codes.InvalidArgument, "a team needs a name")
+	}
+	team, err := h.modelFor(ctx).SaveTeam(req.Team)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.SaveTeamResponse{Team: team}, nil
+}
+
+// ListTeams returns the club's teams
+func (h *LadderService) ListTeams(ctx context.Context, req *ladderpb.ListTeamsRequest) (*ladderpb.ListTeamsResponse, error) {
+	teams, err := h.modelFor(ctx).Teams()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListTeamsResponse{Teams: teams}, nil
+}
+
+// RecordFixture records an inter-club fixture
+func (h *LadderService) RecordFixture(ctx context.Context, req *ladderpb.RecordFixtureRequest) (*ladderpb.RecordFixtureResponse, error) {
+	var playedAt time.Time
+	if req.PlayedAt != "" {
+		var err error
+		if playedAt, err = time.Parse(time.RFC3339, req.PlayedAt); err != nil {
+			return nil, localizedStatusf(codes.InvalidArgument, "played_at must be an RFC 3339 time with an offset, e.g. 2024-03-02T19:30:00+01:00")
+		}
+	}
+	fixture, err := h.modelFor(ctx).RecordFixture(req.TeamId, req.Opponent, req.Home, playedAt, req.Rubbers)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.RecordFixtureResponse{Fixture: fixture}, nil
+}
+
+// SuggestTeamSelection proposes a team for a fixture
+func (h *LadderService) SuggestTeamSelection(ctx context.Context, req *ladderpb.SuggestTeamSelectionRequest) (*ladderpb.SuggestTeamSelectionResponse, error) {
+	m := h.modelFor(ctx)
+	loc := m.TimeZone()
+	now := m.now().In(loc)
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if req.Date != "" {
+		var err error
+		if date, err = time.ParseInLocation("2006-01-02", req.Date, loc); err != nil {
+			return nil, localizedStatusf(codes.InvalidArgument, "date must look like 2024-03-02")
+		}
+	}
+	return m.SuggestTeamSelection(int(req.TeamSize), date, req.TeamId, req.IncludePlayerIds, req.ExcludePlayerIds)
+}
+
+// ListFixtures returns the recorded fixtures, newest first
+func (h *LadderService) ListFixtures(ctx context.Context, req *ladderpb.ListFixturesRequest) (*ladderpb.ListFixturesResponse, error) {
+	fixtures, err := h.modelFor(ctx).Fixtures(req.TeamId)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListFixturesResponse{Fixtures: fixtures}, nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLadderService_TeamsAndFixtures(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, ScoringFormat: ladderpb.ScoringFormat_BEST_OF_3_PAR_11}); err != nil {
+		t.Fatalf("SetLadderRules failed: %v", err)
+	}
+
+	svc := NewLadderService(m)
+	ctx := context.Background()
+	if _, err := svc.SaveTeam(ctx, &ladderpb.SaveTeamRequest{Team: &ladderpb.Team{Name: "Firsts", PlayerIds: []string{"alice", "dave"}}}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for someone not on the ladder, got %v", err)
+	}
+	saved, err := svc.SaveTeam(ctx, &ladderpb.SaveTeamRequest{Team: &ladderpb.Team{Name: "Firsts", PlayerIds: []string{"alice", "bob"}}})
+	if err != nil {
+		t.Fatalf("SaveTeam failed: %v", err)
+	}
+	team := saved.Team
+	team.Name = "Men's 1st team"
+	team.PlayerIds = append(team.PlayerIds, "carol")
+	if _, err := svc.SaveTeam(ctx, &ladderpb.SaveTeamRequest{Team: team}); err != nil {
+		t.Fatalf("SaveTeam failed: %v", err)
+	}
+
+	win := []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 5}, {ChallengerPoints: 11, DefenderPoints: 7}}
+	loss := []*ladderpb.SetScore{{ChallengerPoints: 5, DefenderPoints: 11}, {ChallengerPoints: 9, DefenderPoints: 11}}
+	for _, tc := range []struct {
+		name    string
+		rubbers []*ladderpb.Rubber
+		want    codes.Code
+	}{
+		{"repeated position", []*ladderpb.Rubber{{Position: 1, PlayerId: "alice", SetScores: win}, {Position: 1, PlayerId: "bob", SetScores: win}}, codes.InvalidArgument},
+		{"repeated player", []*ladderpb.Rubber{{Position: 1, PlayerId: "alice", SetScores: win}, {Position: 2, PlayerId: "alice", SetScores: win}}, codes.InvalidArgument},
+		{"no scores", []*ladderpb.Rubber{{Position: 1, PlayerId: "alice"}}, codes.InvalidArgument},
+		{"bad score", []*ladderpb.Rubber{{Position: 1, PlayerId: "alice", SetScores: []*ladderpb.SetScore{{ChallengerPoints: 11, DefenderPoints: 10}}}}, codes.Unknown},
+	} {
+		_, err := svc.RecordFixture(ctx, &ladderpb.RecordFixtureRequest{TeamId: team.Id, Opponent: "Riverside B", Rubbers: tc.rubbers})
+		if status.Code(err) != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	recorded, err := svc.RecordFixture(ctx, &ladderpb.RecordFixtureRequest{
+		TeamId:   team.Id,
+		Opponent: "Riverside B",
+		Home:     true,
+		PlayedAt: "2024-03-02T19:30:00+01:00",
+		Rubbers: []*ladderpb.Rubber{
+			{Position: 2, PlayerId: "bob", OpponentName: "Dan", SetScores: loss},
+			{Position: 1, PlayerId: "alice", OpponentName: "Eve", SetScores: win},
+			{Position: 3, PlayerId: "carol", OpponentName: "Fay", SetScores: win},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RecordFixture failed: %v", err)
+	}
+	f := recorded.Fixture
+	if f.RubbersWon != 2 || f.RubbersLost != 1 || f.Outcome != ladderpb.FixtureOutcome_OUTCOME_WIN || f.Rubbers[0].PlayerId != "alice" {
+		t.Errorf("expected a 2-1 win with the top string first, got %v", f)
+	}
+	if _, err := svc.RecordFixture(ctx, &ladderpb.RecordFixtureRequest{TeamId: team.Id, Opponent: "Hillside A", Rubbers: []*ladderpb.Rubber{{Position: 1, PlayerId: "alice", SetScores: loss}}}); err != nil {
+		t.Fatalf("RecordFixture failed: %v", err)
+	}
+
+	teams, _ := svc.ListTeams(ctx, &ladderpb.ListTeamsRequest{})
+	if len(teams.Teams) != 1 || teams.Teams[0].Name != "Men's 1st team" || len(teams.Teams[0].PlayerIds) != 3 {
+		t.Fatalf("expected the renamed team, got %v", teams.Teams)
+	}
+	if got := teams.Teams[0]; got.Played != 2 || got.Won != 1 || got.Lost != 1 {
+		t.Errorf("expected played 2, won 1, lost 1, got %v", got)
+	}
+	fixtures, _ := svc.ListFixtures(ctx, &ladderpb.ListFixturesRequest{TeamId: team.Id})
+	if len(fixtures.Fixtures) != 2 || fixtures.Fixtures[0].Opponent != "Hillside A" {
+		t.Errorf("expected the latest fixture first, got %v", fixtures.Fixtures)
+	}
+
+	// Fixtures leave the ladder alone and can be undone
+	assertOrder(t, m, "alice", "bob", "carol")
+	if _, _, err := m.UndoLastTransaction(context.Background()); err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	if teams, _ := m.Teams(); teams[0].Played != 1 {
+		t.Errorf("expected one fixture after undo, got %v", teams[0])
+	}
+}
+
+func TestLadderService_SuggestTeamSelection(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	for _, id := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		m.AddPlayer(id, id)
+	}
+	loc := m.TimeZone()
+	from, until, _ := parseProtection("2024-03-01", "2024-03-03", loc)
+	if _, err := m.SetPlayerProtection("bob", from, until); err != nil {
+		t.Fatalf("SetPlayerProtection failed: %v", err)
+	}
+
+	svc := NewLadderService(m)
+	ctx := context.Background()
+	names := func(players []*ladderpb.Player) []string {
+		var ids []string
+		for _, p := range players {
+			ids = append(ids, p.Id)
+		}
+		return ids
+	}
+
+	resp, err := svc.SuggestTeamSelection(ctx, &ladderpb.SuggestTeamSelectionRequest{TeamSize: 3, Date: "2024-03-02"})
+	if err != nil {
+		t.Fatalf("SuggestTeamSelection failed: %v", err)
+	}
+	if got := names(resp.Selected); !reflect.DeepEqual(got, []string{"alice", "carol", "dave"}) {
+		t.Errorf("expected Bob to be skipped while away, got %v", got)
+	}
+	if got := names(resp.Unavailable); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Errorf("expected Bob unavailable, got %v", got)
+	}
+
+	// Bob is back the day after the protection ends
+	resp, _ = svc.SuggestTeamSelection(ctx, &ladderpb.SuggestTeamSelectionRequest{TeamSize: 3, Date: "2024-03-04"})
+	if got := names(resp.Selected); !reflect.DeepEqual(got, []string{"alice", "bob", "carol"}) {
+		t.Errorf("expected the top three, got %v", got)
+	}
+
+	resp, _ = svc.SuggestTeamSelection(ctx, &ladderpb.SuggestTeamSelectionRequest{
+		TeamSize:         3,
+		Date:             "2024-03-02",
+		IncludePlayerIds: []string{"erin", "bob"},
+		ExcludePlayerIds: []string{"alice"},
+	})
+	if got := names(resp.Selected); !reflect.DeepEqual(got, []string{"bob", "carol", "erin"}) {
+		t.Errorf("expected the overrides to apply, got %v", got)
+	}
+	if got := names(resp.Reserves); !reflect.DeepEqual(got, []string{"dave"}) {
+		t.Errorf("expected Dave as a reserve, got %v", got)
+	}
+
+	team, _ := m.SaveTeam(&ladderpb.Team{Name: "Seconds", PlayerIds: []string{"dave", "erin"}})
+	resp, _ = svc.SuggestTeamSelection(ctx, &ladderpb.SuggestTeamSelectionRequest{TeamSize: 3, TeamId: team.Id})
+	if got := names(resp.Selected); !reflect.DeepEqual(got, []string{"dave", "erin"}) {
+		t.Errorf("expected only the squad, got %v", got)
+	}
+
+	if _, err := svc.SuggestTeamSelection(ctx, &ladderpb.SuggestTeamSelectionRequest{TeamSize: 1, IncludePlayerIds: []string{"alice", "bob"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for too many included players, got %v", err)
+	}
+}
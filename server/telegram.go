@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+const (
+	telegramAPIBase     = "https://api.telegram.org"
+	telegramPollTimeout = 30 // seconds, long polling
+	telegramRecentLimit = 5
+	// pendingTelegramTimeout is how long a /result waits for /confirm
+	pendingTelegramTimeout = 30 * time.Minute
+)
+
+// TelegramBot answers /ladder, /recent, /result, /confirm and /myid commands, announces
+// rank changes to a group chat and sends players the notifications they chose. Results
+// are only taken from the announcement chat and from chats linked to a player, and are
+// recorded once the chat confirms them.
+type TelegramBot struct {
+	service  *LadderService
+	token    string
+	chatID   string             // Chat that receives rank-change announcements; empty disables them
+	contacts *NotificationStore // Links players' chats; nil when notifications are off
+	pending  *pendingResults
+	apiBase  string
+	client   *http.Client
+}
+
+// NewTelegramBot creates a bot using the given Bot API token
+func NewTelegramBot(service *LadderService, token, announceChatID string) *TelegramBot {
+	return &TelegramBot{
+		service: service,
+		token:   token,
+		chatID:  announceChatID,
+		pending: newPendingResults(pendingTelegramTimeout),
+		apiBase: telegramAPIBase,
+		client:  &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second},
+	}
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// Start polls for updates and subscribes to ladder changes until stop is closed
+func (b *TelegramBot) Start(m *Model, stop <-chan struct{}) {
+	if b.chatID != "" {
+		m.OnChange(b.announce)
+	}
+
+	go func() {
+		var offset int64
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			updates, err := b.getUpdates(offset)
+			if err != nil {
+				log.Printf("telegram: failed to get updates: %v", err)
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			for _, u := range updates {
+				offset = u.UpdateID + 1
+				if u.Message == nil || u.Message.Text == "" {
+					continue
+				}
+				ctx := b.service.clientContext(context.Background(), clientTelegram, fmt.Sprintf("telegram:%d", u.Message.Chat.ID), "")
+				reply := b.handleCommand(ctx, u.Message.Chat.ID, u.Message.Text)
+				if reply == "" {
+					continue
+				}
+				if err := b.sendMessage(fmt.Sprint(u.Message.Chat.ID), reply); err != nil {
+					log.Printf("telegram: failed to reply: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (b *TelegramBot) handleCommand(ctx context.Context, chatID int64, text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	// Commands in groups arrive as /ladder@BotName
+	command := strings.SplitN(fields[0], "@", 2)[0]
+	args := strings.Join(fields[1:], " ")
+
+	switch command {
+	case "/myid":
+		return fmt.Sprintf("Your chat ID is %d. Enter it in the ladder app's notification settings to get your notifications here.", chatID)
+	case "/start", "/help":
+		return "Commands:\n/ladder - current standings\n/recent - latest results\n/result @winner beat @loser 11-5 11-7 11-3\n/confirm <code> - record a result\n/myid - your chat ID, for notifications"
+	case "/confirm":
+		return b.confirmResult(ctx, chatID, args)
+	case "/ladder", "/recent", "/result":
+	default:
+		return ""
+	}
+
+	// A chat a player linked uses their club's ladder
+	clubID, linked, err := b.chatClub(chatID)
+	if err == nil {
+		ctx, err = b.service.clubContext(ctx, clubID)
+	}
+	if err != nil {
+		return fmt.Sprintf("Could not load the ladder: %v", err)
+	}
+	switch command {
+	case "/ladder":
+		return b.ladderText(ctx)
+	case "/recent":
+		return b.recentText(ctx)
+	}
+	return b.readResult(ctx, chatID, clubID, linked, args)
+}
+
+func (b *TelegramBot) ladderText(ctx context.Context) string {
+	resp, err := b.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return fmt.Sprintf("Could not load the ladder: %v", err)
+	}
+	if len(resp.Players) == 0 {
+		return "The ladder is empty."
+	}
+	var sb strings.Builder
+	for _, p := range resp.Players {
+		fmt.Fprintf(&sb, "%d. %s\n", p.Rank, p.Name)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func (b *TelegramBot) recentText(ctx context.Context) string {
+	matches, err := b.service.ListRecentMatches(ctx, &ladderpb.ListRecentMatchesRequest{Limit: telegramRecentLimit})
+	if err != nil {
+		return fmt.Sprintf("Could not load recent results: %v", err)
+	}
+	if len(matches.Results) == 0 {
+		return "No results recorded yet."
+	}
+	players, err := b.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return fmt.Sprintf("Could not load the ladder: %v", err)
+	}
+	names := make(map[string]string)
+	for _, p := range players.Players {
+		names[p.Id] = p.Name
+	}
+
+	var sb strings.Builder
+	for _, mr := range matches.Results {
+		sb.WriteString(describeMatch(mr, names) + "\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// chatClub returns the club whose ladder a chat uses: the default ladder for the
+// announcement chat and unlinked chats, or the club of the player who linked it in
+// their notification settings. linked reports whether results may be entered from
+// the chat, which only the announcement chat and linked chats may do.
+func (b *TelegramBot) chatClub(chatID int64) (clubID string, linked bool, err error) {
+	chat := fmt.Sprint(chatID)
+	if b.chatID != "" && chat == b.chatID {
+		return "", true, nil
+	}
+	if b.contacts == nil {
+		return "", false, nil
+	}
+	switch clubs := b.contacts.TelegramChatClubs(chat); len(clubs) {
+	case 0:
+		return "", false, nil
+	case 1:
+		return clubs[0], true, nil
+	default:
+		return "", false, fmt.Errorf("this chat is linked to players at %d clubs; link a separate chat for each club", len(clubs))
+	}
+}
+
+// readResult keeps a result until the chat confirms it with /confirm. ctx is
+// already resolved to the chat's club.
+func (b *TelegramBot) readResult(ctx context.Context, chatID int64, clubID string, linked bool, args string) string {
+	if !linked {
+		return "Results can only be entered from the club's chat, or from a chat you linked in the ladder app's notification settings (see /myid)."
+	}
+	players, err := b.service.ListPlayers(ctx, &ladderpb.ListPlayersRequest{})
+	if err != nil {
+		return fmt.Sprintf("Could not load the ladder: %v", err)
+	}
+	req, summary, err := parseResultText(players.Players, args)
+	if err != nil {
+		return fmt.Sprintf("Could not read result: %v", err)
+	}
+	code, err := b.pending.add(fmt.Sprint(chatID), clubID, req, summary)
+	if err != nil {
+		log.Printf("telegram: failed to generate confirmation code: %v", err)
+		return "Sorry, something went wrong. Please try again."
+	}
+	return fmt.Sprintf("%s. Send /confirm %s to record it.", summary, code)
+}
+
+// confirmResult records a result this chat entered with /result on the ladder it
+// was entered for
+func (b *TelegramBot) confirmResult(ctx context.Context, chatID int64, code string) string {
+	if code == "" {
+		return "Send /confirm followed by the code you were given."
+	}
+	p, ok := b.pending.take(fmt.Sprint(chatID), code)
+	if !ok {
+		return "No pending result for that code. It may have expired."
+	}
+	ctx, err := b.service.clubContext(ctx, p.clubID)
+	if err != nil {
+		return fmt.Sprintf("Could not record result: %v", err)
+	}
+	if _, err := b.service.AddMatchResult(ctx, p.request); err != nil {
+		return fmt.Sprintf("Could not record result: %v", err)
+	}
+	return fmt.Sprintf("Recorded: %s", p.summary)
+}
+
+// announce posts rank movements to the group chat
+func (b *TelegramBot) announce(change LadderChange) {
+	moves := change.Moves()
+	if len(moves) == 0 {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("Ladder update:\n")
+	for _, mv := range moves {
+		switch {
+		case mv.FromRank == 0:
+			fmt.Fprintf(&sb, "%s joined at #%d\n", mv.Name, mv.ToRank)
+		case mv.ToRank == 0:
+			fmt.Fprintf(&sb, "%s left the ladder (was #%d)\n", mv.Name, mv.FromRank)
+		case mv.ToRank < mv.FromRank:
+			fmt.Fprintf(&sb, "%s up to #%d (from #%d)\n", mv.Name, mv.ToRank, mv.FromRank)
+		default:
+			fmt.Fprintf(&sb, "%s down to #%d (from #%d)\n", mv.Name, mv.ToRank, mv.FromRank)
+		}
+	}
+	if err := b.sendMessage(b.chatID, strings.TrimSpace(sb.String())); err != nil {
+		log.Printf("telegram: failed to announce: %v", err)
+	}
+}
+
+func (b *TelegramBot) getUpdates(offset int64) ([]telegramUpdate, error) {
+	q := url.Values{}
+	q.Set("offset", fmt.Sprint(offset))
+	q.Set("timeout", fmt.Sprint(telegramPollTimeout))
+
+	resp, err := b.client.Get(fmt.Sprintf("%s/bot%s/getUpdates?%s", b.apiBase, b.token, q.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []telegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if !body.OK {
+		return nil, fmt.Errorf("telegram API error: %s", body.Description)
+	}
+	return body.Result, nil
+}
+
+func (b *TelegramBot) sendMessage(chatID, text string) error {
+	data, err := json.Marshal(map[string]string{"chat_id": chatID, "text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(fmt.Sprintf("%s/bot%s/sendMessage", b.apiBase, b.token), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sendMessage returned %s", resp.Status)
+	}
+	return nil
+}
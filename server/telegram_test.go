@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTelegramBot_Commands(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+
+	bot := NewTelegramBot(NewLadderService(m), "token", "42")
+	ctx := context.Background()
+
+	if got := bot.handleCommand(ctx, 42, "/ladder@ClubBot"); got != "1. Alice\n2. Bob" {
+		t.Errorf("unexpected /ladder reply: %q", got)
+	}
+
+	got := bot.handleCommand(ctx, 42, "/result @bob beat @alice 11-5 9-11 11-7 11-3")
+	code := regexp.MustCompile(`/confirm (\d{4})`).FindStringSubmatch(got)
+	if !strings.HasPrefix(got, "Bob beat Alice 11-5 9-11 11-7 11-3") || code == nil {
+		t.Fatalf("unexpected /result reply: %q", got)
+	}
+	if m.ListPlayers()[0].Id != "alice" {
+		t.Fatal("the result must not be recorded before it is confirmed")
+	}
+	if got := bot.handleCommand(ctx, 7, "/confirm "+code[1]); !strings.HasPrefix(got, "No pending result") {
+		t.Errorf("other chats must not confirm, got %q", got)
+	}
+	if got := bot.handleCommand(ctx, 42, "/confirm "+code[1]); !strings.HasPrefix(got, "Recorded: Bob beat Alice 11-5 9-11 11-7 11-3") {
+		t.Fatalf("unexpected /confirm reply: %q", got)
+	}
+	if m.ListPlayers()[0].Id != "bob" {
+		t.Error("Bob should be #1 after the result")
+	}
+
+	if got := bot.handleCommand(ctx, 42, "/recent"); got != "Bob beat Alice (11-5, 9-11, 11-7, 11-3)" {
+		t.Errorf("unexpected /recent reply: %q", got)
+	}
+
+	if got := bot.handleCommand(ctx, 42, "/myid"); !strings.HasPrefix(got, "Your chat ID is 42.") {
+		t.Errorf("unexpected /myid reply: %q", got)
+	}
+	if got := bot.handleCommand(ctx, 42, "hello"); got != "" {
+		t.Errorf("non-commands should be ignored, got %q", got)
+	}
+}
+
+func TestTelegramBot_ResultChats(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	store, err := NewNotificationStore(filepath.Join(t.TempDir(), "notifications.json"))
+	if err != nil {
+		t.Fatalf("NewNotificationStore failed: %v", err)
+	}
+	store.Update("", "bob", nil, "", "7", "")
+
+	bot := NewTelegramBot(NewLadderService(m), "token", "")
+	ctx := context.Background()
+	const result = "/result bob beat alice 11-5 11-5 11-5"
+	if got := bot.handleCommand(ctx, 7, result); !strings.HasPrefix(got, "Results can only be entered") {
+		t.Errorf("expected results to be refused without linked chats, got %q", got)
+	}
+
+	NewNotifier(store).EnableTelegram(bot)
+	if got := bot.handleCommand(ctx, 8, result); !strings.HasPrefix(got, "Results can only be entered") {
+		t.Errorf("expected an unlinked chat to be refused, got %q", got)
+	}
+	if got := bot.handleCommand(ctx, 7, result); !strings.Contains(got, "/confirm ") {
+		t.Errorf("expected Bob's chat to be asked to confirm, got %q", got)
+	}
+}
+
+func TestTelegramBot_Announce(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	sent := make(chan map[string]string, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			sent <- body
+		}
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	}))
+	defer api.Close()
+
+	bot := NewTelegramBot(NewLadderService(m), "token", "-100")
+	bot.apiBase = api.URL
+	m.OnChange(bot.announce)
+
+	m.AddPlayer("Alice", "alice")
+
+	select {
+	case body := <-sent:
+		if body["chat_id"] != "-100" || body["text"] != "Ladder update:\nAlice joined at #1" {
+			t.Errorf("unexpected announcement: %v", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an announcement")
+	}
+}
+
+func TestTelegramBot_Club(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	r, _ := NewClubRegistry(t.TempDir(), nil)
+	defer r.Close()
+	r.CreateClub("riverside", "Riverside SC", nil)
+	club, _ := r.Model("riverside")
+	club.AddPlayer("Alice", "alice")
+	club.AddPlayer("Bob", "bob")
+	m.AddPlayer("Carol", "carol")
+
+	store, err := NewNotificationStore(filepath.Join(t.TempDir(), "notifications.json"))
+	if err != nil {
+		t.Fatalf("NewNotificationStore failed: %v", err)
+	}
+	store.Update("riverside", "bob", nil, "", "7", "")
+
+	svc := NewLadderService(m)
+	svc.clubs = r
+	bot := NewTelegramBot(svc, "token", "42")
+	NewNotifier(store).EnableTelegram(bot)
+	ctx := context.Background()
+
+	if got := bot.handleCommand(ctx, 7, "/ladder"); got != "1. Alice\n2. Bob" {
+		t.Errorf("expected Bob's chat to see his club's ladder, got %q", got)
+	}
+	if got := bot.handleCommand(ctx, 42, "/ladder"); got != "1. Carol" {
+		t.Errorf("expected the announcement chat to see the default ladder, got %q", got)
+	}
+
+	got := bot.handleCommand(ctx, 7, "/result bob beat alice 11-5 11-5 11-5")
+	code := regexp.MustCompile(`/confirm (\d{4})`).FindStringSubmatch(got)
+	if code == nil {
+		t.Fatalf("unexpected /result reply: %q", got)
+	}
+	if got := bot.handleCommand(ctx, 7, "/confirm "+code[1]); !strings.HasPrefix(got, "Recorded") {
+		t.Fatalf("unexpected /confirm reply: %q", got)
+	}
+	if matches, _ := club.GetRecentMatches(1); len(matches) != 1 {
+		t.Error("the result should be recorded on the club's ladder")
+	}
+	if matches, _ := m.GetRecentMatches(1); len(matches) != 0 {
+		t.Error("the default ladder should be left alone")
+	}
+
+	// A chat linked at two clubs cannot tell which ladder it means
+	store.Update("", "carol", nil, "", "7", "")
+	if got := bot.handleCommand(ctx, 7, "/ladder"); !strings.Contains(got, "linked to players at 2 clubs") {
+		t.Errorf("expected an ambiguous chat to be refused, got %q", got)
+	}
+}
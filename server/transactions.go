@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+)
+
+// defaultTransactionPageSize is used when ListTransactions is called without a limit
+const defaultTransactionPageSize = 50
+
+// ListTransactions returns up to limit transactions, newest first, starting after the
+// transaction identified by cursor. Only the given types are returned if any are set.
+// The returned cursor is empty once the start of the log is reached.
+func (m *Model) ListTransactions(ctx context.Context, limit int32, cursor string, types []storagepb.TransactionType) ([]*ladderpb.TransactionSummary, string, error) {
+	if limit <= 0 {
+		limit = defaultTransactionPageSize
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	wanted := make(map[storagepb.TransactionType]bool)
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	names := playerNames(txs)
+	invalidatedBy := make(map[string]string)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidatedBy[id] = t.Id
+			}
+		}
+	}
+
+	start := len(txs) - 1
+	if cursor != "" {
+		idx := indexOfTransaction(txs, cursor)
+		if idx == -1 {
+			return nil, "", fmt.Errorf("unknown cursor: %s", cursor)
+		}
+		start = idx - 1
+	}
+
+	summaries := []*ladderpb.TransactionSummary{}
+	next := ""
+	for i := start; i >= 0; i-- {
+		t := txs[i]
+		if len(wanted) > 0 && !wanted[t.Type] {
+			continue
+		}
+		if int32(len(summaries)) == limit {
+			next = summaries[len(summaries)-1].Id
+			break
+		}
+		summaries = append(summaries, summarizeTransaction(t, names, invalidatedBy[t.Id]))
+	}
+
+	return summaries, next, nil
+}
+
+// GetTransaction returns the full detail of a single transaction
+func (m *Model) GetTransaction(ctx context.Context, txID string) (*ladderpb.TransactionDetail, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs, err := m.readTransactionsContextLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := indexOfTransaction(txs, txID)
+	if idx == -1 {
+		return nil, fmt.Errorf("transaction not found")
+	}
+	t := txs[idx]
+
+	invalidatedBy := ""
+	for _, later := range txs[idx+1:] {
+		if inv := later.GetInvalidateMatchPayload(); inv != nil && slices.Contains(replay.InvalidatedIDs(inv), txID) {
+			invalidatedBy = later.Id
+			break
+		}
+	}
+
+	names := playerNames(txs)
+	detail := &ladderpb.TransactionDetail{
+		Summary:     summarizeTransaction(t, names, invalidatedBy),
+		Invalidated: invalidatedBy != "",
+		PlayerList:  storageToLadder(t.PlayerList),
+	}
+	previous := []*ladderpb.Player{}
+	if idx > 0 {
+		detail.PreviousTransactionId = txs[idx-1].Id
+		previous = storageToLadder(txs[idx-1].PlayerList)
+	}
+	detail.Movements = movementSteps(previous, detail.PlayerList)
+	if idx < len(txs)-1 {
+		detail.NextTransactionId = txs[idx+1].Id
+	}
+
+	switch t.Type {
+	case storagepb.TransactionType_MATCH_RESULT, storagepb.TransactionType_RETROACTIVE_MATCH:
+		detail.Match = matchResultFromStorage(t)
+		detail.Match.Attachments = matchAttachments(txs)[t.Id]
+		computeRatings(txs).annotate(detail.Match)
+	case storagepb.TransactionType_ADD_PLAYER:
+		p := t.GetAddPlayerPayload()
+		detail.Player = &ladderpb.Player{Id: p.GetPlayerId(), Name: p.GetName(), Category: ladderpb.PlayerCategory(p.GetCategory())}
+	case storagepb.TransactionType_REMOVE_PLAYER:
+		p := t.GetRemovePlayerPayload()
+		detail.Player = &ladderpb.Player{Id: p.GetPlayerId(), Name: names[p.GetPlayerId()]}
+	}
+	if detail.Player != nil {
+		for _, p := range detail.PlayerList {
+			if p.Id == detail.Player.Id {
+				detail.Player.Rank = p.Rank
+			}
+		}
+	}
+
+	return detail, nil
+}
+
+// playerNames maps every player ID that ever joined the ladder to its latest name
+func playerNames(txs []*storagepb.TransactionStorage) map[string]string {
+	names := make(map[string]string)
+	for _, t := range txs {
+		if p := t.GetAddPlayerPayload(); p != nil {
+			names[p.PlayerId] = p.Name
+		}
+		if p := t.GetWaitingListPayload(); p != nil {
+			names[p.PlayerId] = p.Name
+		}
+		if p := t.GetJoinRequestPayload(); p != nil {
+			names[p.PlayerId] = p.Name
+		}
+		for _, p := range t.PlayerList {
+			names[p.Id] = p.Name
+		}
+	}
+	return names
+}
+
+func summarizeTransaction(t *storagepb.TransactionStorage, names map[string]string, invalidatedBy string) *ladderpb.TransactionSummary {
+	s := &ladderpb.TransactionSummary{
+		Id:            t.Id,
+		Type:          t.Type.String(),
+		TimestampMs:   t.TimestampMs,
+		InvalidatedBy: invalidatedBy,
+		ServerVersion: t.ServerVersion,
+
+		ClientPrincipal: t.GetClient().GetPrincipal(),
+		ClientType:      t.GetClient().GetClientType(),
+		ClientAddr:      t.GetClient().GetRemoteAddr(),
+	}
+
+	name := func(id string) string {
+		if n, ok := names[id]; ok && n != "" {
+			return n
+		}
+		return id
+	}
+
+	switch t.Type {
+	case storagepb.TransactionType_ADD_PLAYER:
+		p := t.GetAddPlayerPayload()
+		s.Summary = fmt.Sprintf("Added player %s (%s)", p.GetName(), p.GetPlayerId())
+		if p.GetFromWaitingList() {
+			s.Summary += " from the waiting list"
+		}
+	case storagepb.TransactionType_WAITING_LIST_JOIN:
+		p := t.GetWaitingListPayload()
+		s.Summary = fmt.Sprintf("%s (%s) joined the waiting list", p.GetName(), p.GetPlayerId())
+	case storagepb.TransactionType_JOIN_REQUEST:
+		p := t.GetJoinRequestPayload()
+		s.Summary = fmt.Sprintf("%s (%s) asked to join", p.GetName(), p.GetPlayerId())
+	case storagepb.TransactionType_JOIN_REJECTED:
+		s.Summary = fmt.Sprintf("Rejected the request of %s to join", name(t.GetJoinRejectedPayload().GetPlayerId()))
+	case storagepb.TransactionType_TEAM:
+		p := t.GetTeamPayload()
+		s.Summary = fmt.Sprintf("Saved team %s with %d players", p.GetName(), len(p.GetPlayerIds()))
+	case storagepb.TransactionType_FIXTURE:
+		p := t.GetFixturePayload()
+		won := 0
+		for _, r := range p.GetRubbers() {
+			if r.GetWon() {
+				won++
+			}
+		}
+		s.Summary = fmt.Sprintf("Recorded a fixture against %s, %d-%d", p.GetOpponent(), won, len(p.GetRubbers())-won)
+	case storagepb.TransactionType_ATTACHMENT:
+		p := t.GetAttachmentPayload()
+		s.Summary = fmt.Sprintf("Attached a %s file to match %s", p.GetContentType(), p.GetMatchTransactionId())
+		if p.GetUploadedBy() != "" {
+			s.Summary += " for " + name(p.GetUploadedBy())
+		}
+	case storagepb.TransactionType_REMOVE_PLAYER:
+		p := t.GetRemovePlayerPayload()
+		s.Summary = fmt.Sprintf("Removed player %s (%s)", name(p.GetPlayerId()), p.GetPlayerId())
+	case storagepb.TransactionType_MATCH_RESULT, storagepb.TransactionType_RETROACTIVE_MATCH:
+		p := t.GetMatchResultPayload()
+		loser := p.GetDefenderId()
+		if p.GetWinnerId() == p.GetDefenderId() {
+			loser = p.GetChallengerId()
+		}
+		s.Summary = fmt.Sprintf("%s beat %s (%s)", name(p.GetWinnerId()), name(loser), formatSetScores(p.GetSetScores()))
+		if p.GetLateEntry() {
+			s.Summary += ", entered late"
+		}
+		if p.GetFriendly() {
+			s.Summary += ", friendly"
+		}
+		if p.GetInsertBeforeId() != "" {
+			s.Summary += ", inserted before " + p.GetInsertBeforeId()
+		}
+	case storagepb.TransactionType_INVALIDATE_MATCH:
+		p := t.GetInvalidateMatchPayload()
+		s.Invalidates = p.GetInvalidatedTransactionId()
+		s.AlsoInvalidates = p.GetAlsoInvalidatedTransactionIds()
+		if len(s.AlsoInvalidates) == 0 {
+			s.Summary = fmt.Sprintf("Invalidated transaction %s", s.Invalidates)
+		} else {
+			s.Summary = fmt.Sprintf("Invalidated transactions %s", strings.Join(replay.InvalidatedIDs(p), ", "))
+		}
+	case storagepb.TransactionType_SET_HANDICAP:
+		p := t.GetSetHandicapPayload()
+		s.Summary = fmt.Sprintf("Set handicap of %s to %d", name(p.GetPlayerId()), p.GetHandicap())
+	case storagepb.TransactionType_SET_PROTECTION:
+		p := t.GetSetProtectionPayload()
+		if p.GetFromMs() == 0 && p.GetUntilMs() == 0 {
+			s.Summary = fmt.Sprintf("Cleared the protection of %s", name(p.GetPlayerId()))
+		} else {
+			s.Summary = fmt.Sprintf("Protected %s from %s until %s UTC", name(p.GetPlayerId()),
+				time.UnixMilli(p.GetFromMs()).UTC().Format("2006-01-02 15:04"), time.UnixMilli(p.GetUntilMs()).UTC().Format("2006-01-02 15:04"))
+		}
+	case storagepb.TransactionType_SET_CATEGORY:
+		p := t.GetSetCategoryPayload()
+		s.Summary = fmt.Sprintf("Moved %s to category %s", name(p.GetPlayerId()), p.GetCategory())
+	case storagepb.TransactionType_REORDER:
+		p := t.GetReorderPayload()
+		s.Summary = fmt.Sprintf("Ladder reordered from %s (%d players seeded)", p.GetSource(), len(p.GetPlayerIds()))
+	case storagepb.TransactionType_ERASE_PLAYER:
+		p := t.GetErasePlayerPayload()
+		s.Summary = fmt.Sprintf("Erased the personal data of %s (%s)", p.GetPseudonym(), p.GetPlayerId())
+	case storagepb.TransactionType_RENAME_PLAYERS:
+		renames := t.GetRenamePlayersPayload().GetRenames()
+		changes := make([]string, len(renames))
+		for i, r := range renames {
+			changes[i] = fmt.Sprintf("%q to %q", r.GetOldName(), r.GetNewName())
+		}
+		s.Summary = fmt.Sprintf("Renamed %d players: %s", len(renames), strings.Join(changes, ", "))
+	case storagepb.TransactionType_PLACE_PLAYER:
+		p := t.GetPlacePlayerPayload()
+		s.Summary = fmt.Sprintf("Placed %s at #%d after qualifying", name(p.GetPlayerId()), p.GetRank())
+	case storagepb.TransactionType_SESSION_OPEN:
+		s.Summary = fmt.Sprintf("Opened session %s", t.GetSessionPayload().GetName())
+	case storagepb.TransactionType_SESSION_CLOSE:
+		s.Summary = fmt.Sprintf("Closed session %s", t.GetSessionPayload().GetName())
+	case storagepb.TransactionType_ATTENDANCE:
+		ids := t.GetAttendancePayload().GetPlayerIds()
+		attended := make([]string, len(ids))
+		for i, id := range ids {
+			attended[i] = name(id)
+		}
+		s.Summary = fmt.Sprintf("Recorded attendance: %s", strings.Join(attended, ", "))
+	case storagepb.TransactionType_RULES_CHANGE:
+		r := t.GetRulesChangePayload().GetRules()
+		s.Summary = fmt.Sprintf("Rules changed: challenge window %d, deadline %d days, %s, %s",
+			r.GetChallengeWindow(), r.GetResponseDeadlineDays(), r.GetScoringFormat(), r.GetDecayPolicy())
+	default:
+		s.Summary = "Unknown transaction"
+	}
+
+	return s
+}
+
+// formatSetScores renders set scores from the challenger's perspective, e.g. "11-5, 9-11, defender defaulted"
+func formatSetScores(sets []*storagepb.SetScoreStorage) string {
+	parts := make([]string, len(sets))
+	for i, set := range sets {
+		switch {
+		case set.ChallengerDefault:
+			parts[i] = "challenger defaulted"
+		case set.DefenderDefault:
+			parts[i] = "defender defaulted"
+		default:
+			parts[i] = fmt.Sprintf("%d-%d", set.ChallengerPoints, set.DefenderPoints)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeMatch renders a result as "Bob beat Alice (11-5, 11-7, 11-3)" using names to resolve player IDs
+func describeMatch(mr *ladderpb.MatchResult, names map[string]string) string {
+	return describeMatchIn("", mr, names)
+}
+
+// describeMatchIn renders a result like describeMatch in locale
+func describeMatchIn(locale string, mr *ladderpb.MatchResult, names map[string]string) string {
+	name := func(id string) string {
+		if n, ok := names[id]; ok {
+			return n
+		}
+		return id
+	}
+	loser := mr.DefenderId
+	if mr.WinnerId == mr.DefenderId {
+		loser = mr.ChallengerId
+	}
+	sets := make([]*storagepb.SetScoreStorage, len(mr.SetScores))
+	for i, s := range mr.SetScores {
+		sets[i] = &storagepb.SetScoreStorage{
+			ChallengerPoints:  s.ChallengerPoints,
+			DefenderPoints:    s.DefenderPoints,
+			ChallengerDefault: s.ChallengerDefault,
+			DefenderDefault:   s.DefenderDefault,
+		}
+	}
+	return trf(locale, "%s beat %s (%s)", name(mr.WinnerId), name(loser), formatSetScores(sets))
+}
+
+// indexOfTransaction returns the log position of txID, or -1 if it is not present
+func indexOfTransaction(txs []*storagepb.TransactionStorage, txID string) int {
+	for i, t := range txs {
+		if t.Id == txID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestModel_ListTransactions(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	txID, _ := m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 7},
+		{ChallengerPoints: 11, DefenderPoints: 3},
+	})
+	m.InvalidateMatchResult(context.Background(), txID)
+
+	txs, next, err := m.ListTransactions(context.Background(), 2, "", nil)
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if len(txs) != 2 || next == "" {
+		t.Fatalf("expected a page of 2 with a cursor, got %d (next=%q)", len(txs), next)
+	}
+	if txs[0].Type != "INVALIDATE_MATCH" || txs[0].Invalidates != txID {
+		t.Errorf("expected newest transaction to be the invalidation, got %+v", txs[0])
+	}
+	if txs[1].Id != txID || txs[1].InvalidatedBy != txs[0].Id {
+		t.Errorf("expected match to link to its invalidation, got %+v", txs[1])
+	}
+	if txs[1].Summary != "Bob beat Alice (11-5, 11-7, 11-3)" {
+		t.Errorf("unexpected summary: %q", txs[1].Summary)
+	}
+
+	rest, next, err := m.ListTransactions(context.Background(), 10, next, nil)
+	if err != nil {
+		t.Fatalf("ListTransactions page 2 failed: %v", err)
+	}
+	if len(rest) != 2 || next != "" {
+		t.Errorf("expected final page of 2, got %d (next=%q)", len(rest), next)
+	}
+
+	adds, _, _ := m.ListTransactions(context.Background(), 10, "", []storagepb.TransactionType{storagepb.TransactionType_ADD_PLAYER})
+	if len(adds) != 2 || adds[0].Summary != "Added player Bob (bob)" {
+		t.Errorf("unexpected filtered result: %+v", adds)
+	}
+
+	if _, _, err := m.ListTransactions(context.Background(), 10, "missing", nil); err == nil {
+		t.Error("expected error for unknown cursor")
+	}
+}
+
+func TestModel_GetTransaction(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	txID, _ := m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{
+		{ChallengerPoints: 11, DefenderPoints: 5},
+		{ChallengerPoints: 11, DefenderPoints: 7},
+		{ChallengerPoints: 11, DefenderPoints: 3},
+	})
+
+	detail, err := m.GetTransaction(context.Background(), txID)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if detail.Invalidated || detail.Match == nil || detail.Match.WinnerId != "bob" {
+		t.Errorf("unexpected detail: %+v", detail)
+	}
+	if detail.NextTransactionId != "" || detail.PreviousTransactionId == "" {
+		t.Errorf("unexpected neighbours: prev=%q next=%q", detail.PreviousTransactionId, detail.NextTransactionId)
+	}
+	if len(detail.Movements) != 1 || detail.Movements[0].PlayerId != "bob" || detail.Movements[0].FromRank != 2 || detail.Movements[0].ToRank != 1 {
+		t.Errorf("expected bob to move from 2 to 1, got %v", detail.Movements)
+	}
+
+	m.InvalidateMatchResult(context.Background(), txID)
+
+	detail, err = m.GetTransaction(context.Background(), txID)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if !detail.Invalidated || detail.Summary.InvalidatedBy != detail.NextTransactionId {
+		t.Errorf("expected invalidation link to next transaction, got %+v", detail)
+	}
+
+	inv, err := m.GetTransaction(context.Background(), detail.Summary.InvalidatedBy)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if inv.Summary.Invalidates != txID {
+		t.Errorf("expected invalidation to point back at %s, got %+v", txID, inv.Summary)
+	}
+	if len(inv.Movements) != 1 || inv.PlayerList[0].Id != "alice" {
+		t.Errorf("expected the undo to swap the two back in one step, got %v", inv.Movements)
+	}
+
+	if _, err := m.GetTransaction(context.Background(), "missing"); err == nil {
+		t.Error("expected error for unknown transaction")
+	}
+}
+
+func TestLadderService_ListTransactions_TypeFilter(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+
+	m.AddPlayer("Alice", "alice")
+	svc := NewLadderService(m)
+
+	resp, err := svc.ListTransactions(context.Background(), &ladderpb.ListTransactionsRequest{Limit: 10, TypeFilter: []string{"ADD_PLAYER"}})
+	if err != nil || len(resp.Transactions) != 1 {
+		t.Fatalf("unexpected filtered result: %+v, %v", resp, err)
+	}
+	if _, err := svc.ListTransactions(context.Background(), &ladderpb.ListTransactionsRequest{TypeFilter: []string{"NOT_A_TYPE"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an unknown type, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+// Package version holds the version, commit and build date of the binaries. Release
+// builds set them with -ldflags "-X squash-ladder/server/version.Version=v1.2.0 ...",
+// or Bazel with --stamp; otherwise the commit comes from the VCS details that go build
+// records.
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+var (
+	// Version is the release, e.g. v1.2.0, or "dev" for an unreleased build
+	Version = "dev"
+	// Commit is the git commit the binary was built from
+	Commit = ""
+	// BuildDate is when the binary was built, in RFC 3339
+	BuildDate = ""
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && Commit == "":
+			Commit = s.Value
+		case s.Key == "vcs.time" && BuildDate == "":
+			BuildDate = s.Value
+		}
+	}
+}
+
+// String describes the build in one line, for --version and the server log
+func String() string {
+	s := Version
+	if Commit != "" {
+		s += fmt.Sprintf(" (commit %.12s", Commit)
+		if BuildDate != "" {
+			s += ", built " + BuildDate
+		}
+		s += ")"
+	}
+	return s
+}
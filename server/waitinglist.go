@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+	storagepb "squash-ladder/server/gen/storage"
+	"squash-ladder/server/replay"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// waitingList returns the players waiting for a place, next in line first: everyone
+// who joined the list and has not been added to the ladder since
+func waitingList(txs []*storagepb.TransactionStorage) []*ladderpb.WaitingListEntry {
+	invalidated := make(map[string]bool)
+	for _, t := range txs {
+		if inv := t.GetInvalidateMatchPayload(); inv != nil {
+			for _, id := range replay.InvalidatedIDs(inv) {
+				invalidated[id] = true
+			}
+		}
+	}
+
+	var entries []*ladderpb.WaitingListEntry
+	for _, t := range txs {
+		if invalidated[t.Id] {
+			continue
+		}
+		if p := t.GetWaitingListPayload(); p != nil {
+			entries = append(entries, &ladderpb.WaitingListEntry{
+				PlayerId:   p.PlayerId,
+				Name:       p.Name,
+				Category:   ladderpb.PlayerCategory(p.Category),
+				JoinedAtMs: t.TimestampMs,
+			})
+		}
+		if p := t.GetAddPlayerPayload(); p != nil {
+			for i, e := range entries {
+				if e.PlayerId == p.PlayerId {
+					entries = append(entries[:i], entries[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	for i, e := range entries {
+		e.Position = int32(i + 1)
+	}
+	return entries
+}
+
+// waitingCache holds the waiting list at the end of the log, which is checked whenever a
+// player joins or leaves a capped ladder. Like the rules cache it follows appends by
+// size, and is dropped by an invalidation or when the log on disk no longer has the
+// size it expects.
+type waitingCache struct {
+	mu      sync.Mutex
+	entries []*ladderpb.WaitingListEntry
+	read    bool  // Whether entries hold the list
+	size    int64 // Bytes of the log the list holds for
+}
+
+// get returns a copy of the cached list, or false if it is not current
+func (c *waitingCache) get(path string) ([]*ladderpb.WaitingListEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.read {
+		return nil, false
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != c.size {
+		c.read, c.entries = false, nil
+		return nil, false
+	}
+	entries := make([]*ladderpb.WaitingListEntry, len(c.entries))
+	for i, e := range c.entries {
+		entries[i] = proto.Clone(e).(*ladderpb.WaitingListEntry)
+		entries[i].Position = int32(i + 1)
+	}
+	return entries, true
+}
+
+// set caches the list read from the log as it is now. The caller must hold the model's
+// lock, so that nothing is appended in between.
+func (c *waitingCache) set(path string, entries []*ladderpb.WaitingListEntry) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make([]*ladderpb.WaitingListEntry, len(entries))
+	for i, e := range entries {
+		c.entries[i] = proto.Clone(e).(*ladderpb.WaitingListEntry)
+	}
+	c.read, c.size = true, info.Size()
+}
+
+// appended follows a transaction of n bytes just written to the end of the log
+func (c *waitingCache) appended(tx *storagepb.TransactionStorage, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.read {
+		return
+	}
+	if tx.GetInvalidateMatchPayload() != nil {
+		c.read, c.entries = false, nil
+		return
+	}
+	c.size += int64(n)
+	if p := tx.GetWaitingListPayload(); p != nil {
+		c.entries = append(c.entries, &ladderpb.WaitingListEntry{
+			PlayerId:   p.PlayerId,
+			Name:       p.Name,
+			Category:   ladderpb.PlayerCategory(p.Category),
+			JoinedAtMs: tx.TimestampMs,
+		})
+	}
+	if p := tx.GetAddPlayerPayload(); p != nil {
+		for i, e := range c.entries {
+			if e.PlayerId == p.PlayerId {
+				c.entries = append(c.entries[:i:i], c.entries[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (c *waitingCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.read, c.entries = false, nil
+}
+
+// waitingListLocked returns the waiting list, from the cache when it is current. The
+// caller must hold m.mu.
+func (m *Model) waitingListLocked() ([]*ladderpb.WaitingListEntry, error) {
+	if entries, ok := m.waiting.get(m.LogFilePath); ok {
+		return entries, nil
+	}
+	txs, err := m.readTransactionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	entries := waitingList(txs)
+	m.waiting.set(m.LogFilePath, entries)
+	return entries, nil
+}
+
+// JoinWaitingList queues a player for a full ladder
+func (m *Model) JoinWaitingList(name, playerID string, category ladderpb.PlayerCategory) (*ladderpb.WaitingListEntry, error) {
+	if playerID == "" {
+		playerID = m.newID()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.joinWaitingListLocked(name, playerID, category)
+}
+
+// joinWaitingListLocked queues a player if the ladder is full. The caller must hold m.mu.
+func (m *Model) joinWaitingListLocked(name, playerID string, category ladderpb.PlayerCategory) (*ladderpb.WaitingListEntry, error) {
+	rules, err := m.currentRulesLocked()
+	if err != nil {
+		return nil, err
+	}
+	currentPlayers, err := m.CurrentState()
+	if err != nil {
+		return nil, err
+	}
+	if limit := rules.MaxPlayers; limit == 0 || len(currentPlayers) < int(limit) {
+		return nil, localizedStatusf(codes.FailedPrecondition, "the ladder has room; join it directly")
+	}
+	if findPlayer(currentPlayers, playerID) != nil {
+		return nil, localizedErrorf("player ID already exists")
+	}
+	waiting, err := m.waitingListLocked()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range waiting {
+		if e.PlayerId == playerID {
+			return nil, localizedStatusf(codes.AlreadyExists, "already on the waiting list")
+		}
+	}
+
+	payload := &storagepb.WaitingListStorage{
+		PlayerId: playerID,
+		Name:     name,
+		Category: storagepb.PlayerCategoryStorage(category),
+	}
+	tx := &storagepb.TransactionStorage{
+		Id:          m.newID(),
+		Type:        storagepb.TransactionType_WAITING_LIST_JOIN,
+		TimestampMs: m.now().UnixMilli(),
+		Payload:     &storagepb.TransactionStorage_WaitingListPayload{WaitingListPayload: payload},
+		PlayerList:  ladderToStorage(currentPlayers),
+	}
+	if err := m.writeTransactionLocked(tx); err != nil {
+		return nil, err
+	}
+
+	return &ladderpb.WaitingListEntry{
+		PlayerId:   playerID,
+		Name:       name,
+		Category:   category,
+		JoinedAtMs: tx.TimestampMs,
+		Position:   int32(len(waiting) + 1),
+	}, nil
+}
+
+// WaitingList returns the players waiting for a place, next in line first
+func (m *Model) WaitingList() ([]*ladderpb.WaitingListEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.waitingListLocked()
+}
+
+// PromoteFromWaitingList adds a waiting player, or whoever is next in line if playerID
+// is empty, to the ladder if it has room
+func (m *Model) PromoteFromWaitingList(playerID string) (*ladderpb.Player, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	waiting, err := m.waitingListLocked()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range waiting {
+		if playerID == "" || e.PlayerId == playerID {
+			return m.addPlayerLocked(e.Name, e.PlayerId, e.Category, true)
+		}
+	}
+	return nil, localizedStatusf(codes.NotFound, "not on the waiting list")
+}
+
+// promoteWaitingLocked fills any free places from the waiting list, in order. The
+// caller must hold m.mu.
+func (m *Model) promoteWaitingLocked() {
+	for {
+		waiting, err := m.waitingListLocked()
+		if err != nil {
+			log.Printf("Failed to read the waiting list: %v", err)
+			return
+		}
+		if len(waiting) == 0 {
+			return
+		}
+		rules, err := m.currentRulesLocked()
+		if err != nil {
+			log.Printf("Failed to read the waiting list: %v", err)
+			return
+		}
+		players, err := m.CurrentState()
+		if err != nil {
+			log.Printf("Failed to read the waiting list: %v", err)
+			return
+		}
+		if limit := rules.MaxPlayers; limit > 0 && len(players) >= int(limit) {
+			return
+		}
+		next := waiting[0]
+		if _, err := m.addPlayerLocked(next.Name, next.PlayerId, next.Category, true); err != nil {
+			log.Printf("Failed to promote %s from the waiting list: %v", next.PlayerId, err)
+			return
+		}
+	}
+}
+
+// JoinWaitingList queues a player for a full ladder
+func (h *LadderService) JoinWaitingList(ctx context.Context, req *ladderpb.JoinWaitingListRequest) (*ladderpb.JoinWaitingListResponse, error) {
+	m := h.modelFor(ctx)
+	pending, err := h.checkJoinPolicy(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		r, err := m.RequestToJoin(req.Name, req.PlayerId, req.Category)
+		if err != nil {
+			return nil, err
+		}
+		return &ladderpb.JoinWaitingListResponse{
+			Entry:           &ladderpb.WaitingListEntry{PlayerId: r.PlayerId, Name: r.Name, Category: r.Category},
+			PendingApproval: true,
+		}, nil
+	}
+	entry, err := m.JoinWaitingList(req.Name, req.PlayerId, req.Category)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.JoinWaitingListResponse{Entry: entry}, nil
+}
+
+// ListWaitingList returns the waiting list
+func (h *LadderService) ListWaitingList(ctx context.Context, req *ladderpb.ListWaitingListRequest) (*ladderpb.ListWaitingListResponse, error) {
+	entries, err := h.modelFor(ctx).WaitingList()
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.ListWaitingListResponse{Entries: entries}, nil
+}
+
+// PromoteFromWaitingList adds a waiting player to the ladder
+func (h *LadderService) PromoteFromWaitingList(ctx context.Context, req *ladderpb.PromoteFromWaitingListRequest) (*ladderpb.PromoteFromWaitingListResponse, error) {
+	player, err := h.modelFor(ctx).PromoteFromWaitingList(req.PlayerId)
+	if err != nil {
+		return nil, err
+	}
+	return &ladderpb.PromoteFromWaitingListResponse{Player: player}, nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestModel_WaitingList(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	if _, err := m.JoinWaitingList("Charlie", "charlie", ladderpb.PlayerCategory_CATEGORY_NONE); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition while the ladder has room, got %v", err)
+	}
+	if _, err := m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, MaxPlayers: 2}); err != nil {
+		t.Fatalf("SetLadderRules failed: %v", err)
+	}
+	if _, err := m.AddPlayer("Charlie", "charlie"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for a full ladder, got %v", err)
+	}
+
+	entry, err := m.JoinWaitingList("Charlie", "charlie", ladderpb.PlayerCategory_CATEGORY_JUNIOR)
+	if err != nil {
+		t.Fatalf("JoinWaitingList failed: %v", err)
+	}
+	if entry.Position != 1 || entry.Name != "Charlie" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	if _, err := m.JoinWaitingList("Charlie", "charlie", ladderpb.PlayerCategory_CATEGORY_NONE); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists, got %v", err)
+	}
+	m.JoinWaitingList("Dave", "dave", ladderpb.PlayerCategory_CATEGORY_NONE)
+	m.JoinWaitingList("Erin", "erin", ladderpb.PlayerCategory_CATEGORY_NONE)
+
+	if _, err := m.PromoteFromWaitingList(""); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition promoting onto a full ladder, got %v", err)
+	}
+
+	// A free place goes to whoever is next in line
+	if err := m.RemovePlayer("bob"); err != nil {
+		t.Fatalf("RemovePlayer failed: %v", err)
+	}
+	assertOrder(t, m, "alice", "charlie")
+	if p := m.ListPlayers()[1]; p.Category != ladderpb.PlayerCategory_CATEGORY_JUNIOR {
+		t.Errorf("expected the category to be kept, got %v", p)
+	}
+	waiting, _ := m.WaitingList()
+	if len(waiting) != 2 || waiting[0].PlayerId != "dave" || waiting[0].Position != 1 {
+		t.Errorf("unexpected waiting list %v", waiting)
+	}
+
+	// Raising the cap promotes as many as fit; an admin can promote out of order
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, MaxPlayers: 4})
+	assertOrder(t, m, "alice", "charlie", "dave", "erin")
+	if _, err := m.PromoteFromWaitingList("erin"); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a promoted player, got %v", err)
+	}
+
+	history, _, _ := m.ListTransactions(context.Background(), 1, "", nil)
+	if history[0].Summary != "Added player Erin (erin) from the waiting list" {
+		t.Errorf("unexpected summary %q", history[0].Summary)
+	}
+}
+
+func TestModel_WaitingListCache(t *testing.T) {
+	m, path := createTempModel(t)
+	defer os.Remove(path)
+	defer m.Close()
+
+	check := func(when string) {
+		t.Helper()
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		txs, _ := m.readTransactionsLocked()
+		want := waitingList(txs)
+		got, err := m.waitingListLocked()
+		if err != nil {
+			t.Fatalf("%s: waitingListLocked failed: %v", when, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %v, got %v", when, want, got)
+		}
+		for i := range want {
+			if !proto.Equal(got[i], want[i]) {
+				t.Errorf("%s: entry %d: expected %v, got %v", when, i, want[i], got[i])
+			}
+		}
+	}
+
+	m.AddPlayer("Alice", "alice")
+	m.SetLadderRules(&ladderpb.LadderRules{ChallengeWindow: 3, ResponseDeadlineDays: 7, MaxPlayers: 1})
+	check("empty")
+	m.JoinWaitingList("Bob", "bob", ladderpb.PlayerCategory_CATEGORY_NONE)
+	m.JoinWaitingList("Carol", "carol", ladderpb.PlayerCategory_CATEGORY_NONE)
+	if !m.waiting.read {
+		t.Error("expected the list to stay cached across joins")
+	}
+	check("after joins")
+
+	m.RemovePlayer("alice")
+	check("after a promotion")
+	if _, _, err := m.UndoLastTransaction(context.Background()); err != nil {
+		t.Fatalf("UndoLastTransaction failed: %v", err)
+	}
+	check("after an undo")
+
+	before, _ := os.ReadFile(path)
+	m.JoinWaitingList("Dave", "dave", ladderpb.PlayerCategory_CATEGORY_NONE)
+	check("after another join")
+	if err := os.WriteFile(path, before, 0644); err != nil {
+		t.Fatal(err)
+	}
+	check("after the log was replaced")
+}
@@ -0,0 +1,854 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	walletPath      = "/wallet/"
+	walletStoreFile = "wallet_passes.json"
+
+	appleAPNsURL        = "https://api.push.apple.com"
+	googleWalletAPIBase = "https://walletobjects.googleapis.com/walletobjects/v1"
+	googleWalletScope   = "https://www.googleapis.com/auth/wallet_object.issuer"
+	googleWalletSaveURL = "https://pay.google.com/gp/v/save/"
+)
+
+// Pass colours, those of the web client's header
+var (
+	walletBackground = color.RGBA{0x28, 0x2c, 0x34, 0xff}
+	walletForeground = "rgb(255, 255, 255)"
+	walletLabel      = "rgb(144, 202, 249)"
+)
+
+// WalletConfig enables membership cards that show a player's rank in Apple Wallet,
+// Google Wallet or both, and update when it changes
+type WalletConfig struct {
+	// PassTypeID (such as "pass.org.example.ladder") and TeamID identify Apple passes.
+	// CertFile holds the pass type certificate and its private key in PEM; WWDRFile
+	// holds Apple's WWDR intermediate certificate.
+	PassTypeID string
+	TeamID     string
+	CertFile   string
+	WWDRFile   string
+
+	// GoogleIssuerID and the JSON key file of a service account with access to the
+	// issuer enable Google Wallet passes
+	GoogleIssuerID        string
+	GoogleCredentialsFile string
+
+	// Organization is shown on the cards; the default is "Squash Ladder"
+	Organization string
+}
+
+func (c WalletConfig) enabled() bool {
+	return c.PassTypeID != "" || c.GoogleIssuerID != ""
+}
+
+// WalletPasses issues players' membership cards and keeps them up to date: Apple
+// devices register with its web service at /wallet/v1 and are pushed a notice to
+// fetch the pass again, and Google Wallet objects are patched in place
+type WalletPasses struct {
+	service   *LadderService
+	clubs     *ClubRegistry
+	publicURL string
+	secret    []byte
+	org       string
+	store     *walletStore
+	apple     *appleWallet  // nil unless Apple passes are configured
+	google    *googleWallet // nil unless Google passes are configured
+	now       func() time.Time
+}
+
+type appleWallet struct {
+	passTypeID string
+	teamID     string
+	cert       tls.Certificate
+	chain      []*x509.Certificate
+	apnsURL    string
+	client     *http.Client
+}
+
+type googleWallet struct {
+	issuerID string
+	auth     *googleServiceAccount
+	apiBase  string
+	client   *http.Client
+}
+
+// NewWalletPasses creates the card issuer. Cards link back to publicURL, and their
+// update tokens are derived from secret.
+func NewWalletPasses(service *LadderService, clubs *ClubRegistry, cfg WalletConfig, publicURL, secret, dataDir string) (*WalletPasses, error) {
+	if publicURL == "" {
+		return nil, fmt.Errorf("wallet passes need a public URL")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("wallet passes need a player token secret")
+	}
+	store, err := openWalletStore(filepath.Join(dataDir, walletStoreFile))
+	if err != nil {
+		return nil, err
+	}
+	w := &WalletPasses{
+		service:   service,
+		clubs:     clubs,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		secret:    []byte(secret),
+		org:       cfg.Organization,
+		store:     store,
+		now:       time.Now,
+	}
+	if w.org == "" {
+		w.org = "Squash Ladder"
+	}
+	if cfg.PassTypeID != "" {
+		if w.apple, err = newAppleWallet(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.GoogleIssuerID != "" {
+		creds, err := os.ReadFile(cfg.GoogleCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Google Wallet credentials: %v", err)
+		}
+		auth, err := newGoogleServiceAccount(creds, googleWalletScope)
+		if err != nil {
+			return nil, err
+		}
+		w.google = &googleWallet{issuerID: cfg.GoogleIssuerID, auth: auth, apiBase: googleWalletAPIBase, client: &http.Client{Timeout: 30 * time.Second}}
+	}
+	return w, nil
+}
+
+func newAppleWallet(cfg WalletConfig) (*appleWallet, error) {
+	if cfg.TeamID == "" || cfg.CertFile == "" || cfg.WWDRFile == "" {
+		return nil, fmt.Errorf("Apple Wallet passes need a team ID, a pass certificate and the WWDR certificate")
+	}
+	pemData, err := os.ReadFile(cfg.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the pass certificate: %v", err)
+	}
+	cert, err := tls.X509KeyPair(pemData, pemData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pass certificate: %v", err)
+	}
+	wwdrData, err := os.ReadFile(cfg.WWDRFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the WWDR certificate: %v", err)
+	}
+	block, _ := pem.Decode(wwdrData)
+	if block == nil {
+		return nil, fmt.Errorf("the WWDR certificate is not PEM")
+	}
+	wwdr, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WWDR certificate: %v", err)
+	}
+	// The pass certificate is also the APNs client certificate for pass updates
+	transport := &http.Transport{TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{cert}}, ForceAttemptHTTP2: true}
+	return &appleWallet{
+		passTypeID: cfg.PassTypeID,
+		teamID:     cfg.TeamID,
+		cert:       cert,
+		chain:      []*x509.Certificate{wwdr},
+		apnsURL:    appleAPNsURL,
+		client:     &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// walletSerial identifies a player's card; it is URL-safe
+func walletSerial(clubID, playerID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(notificationKey(clubID, playerID)))
+}
+
+func parseWalletSerial(serial string) (clubID, playerID string, err error) {
+	key, err := base64.RawURLEncoding.DecodeString(serial)
+	if err != nil || !strings.Contains(string(key), "/") {
+		return "", "", fmt.Errorf("invalid serial number")
+	}
+	clubID, playerID = splitNotificationKey(string(key))
+	return clubID, playerID, nil
+}
+
+// authToken is the secret a card carries to fetch its updates
+func (w *WalletPasses) authToken(serial string) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write([]byte("wallet:" + serial))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *WalletPasses) checkAuth(serial, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(w.authToken(serial))) == 1
+}
+
+// walletCard is what a card shows
+type walletCard struct {
+	serial string
+	name   string
+	club   string
+	rank   int32 // 0 once the player has left the ladder
+}
+
+func (c *walletCard) rankText() string {
+	if c.rank == 0 {
+		return "–"
+	}
+	return fmt.Sprintf("#%d", c.rank)
+}
+
+// card looks up a player's current standing
+func (w *WalletPasses) card(serial string) (*walletCard, error) {
+	clubID, playerID, err := parseWalletSerial(serial)
+	if err != nil {
+		return nil, err
+	}
+	m, club := w.service.model, w.org
+	if clubID != "" {
+		if w.clubs == nil {
+			return nil, fmt.Errorf("multi-club mode is not enabled")
+		}
+		if m, err = w.clubs.Model(clubID); err != nil {
+			return nil, err
+		}
+		if info, err := w.clubs.readInfo(clubID); err == nil && info.Name != "" {
+			club = info.Name
+		}
+	}
+	card := &walletCard{serial: serial, club: club}
+	if p := findPlayer(m.ListPlayers(), playerID); p != nil {
+		card.name, card.rank = p.Name, p.Rank
+		return card, nil
+	}
+	// Players who left keep their card, which shows no rank
+	if card.name = w.store.name(serial); card.name != "" {
+		return card, nil
+	}
+	return nil, fmt.Errorf("player not found")
+}
+
+// Attach updates the cards of players whose rank changes on a club's ladder;
+// clubID is empty for the default ladder
+func (w *WalletPasses) Attach(clubID string, m *Model) {
+	m.OnChange(func(change LadderChange) {
+		for _, mv := range change.Moves() {
+			w.update(walletSerial(clubID, mv.PlayerID), mv.Name)
+		}
+	})
+}
+
+// update tells the devices holding a card that it changed, and patches its Google
+// Wallet object
+func (w *WalletPasses) update(serial, name string) {
+	pushTokens, google, ok := w.store.touch(serial, name, w.now().UnixMilli())
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	if w.apple != nil {
+		for _, token := range pushTokens {
+			err := w.apple.push(ctx, token)
+			switch {
+			case err == errPushGone:
+				w.store.dropPushToken(token)
+			case err != nil:
+				log.Printf("wallet: failed to push an update of %s: %v", serial, err)
+			}
+		}
+	}
+	if w.google != nil && google {
+		card, err := w.card(serial)
+		if err == nil {
+			err = w.google.patch(ctx, card, w.org)
+		}
+		if err != nil {
+			log.Printf("wallet: failed to update the Google Wallet object of %s: %v", serial, err)
+		}
+	}
+}
+
+// GetWalletPass returns links that add the calling player's membership card to Apple
+// Wallet and Google Wallet
+func (h *LadderService) GetWalletPass(ctx context.Context, req *ladderpb.GetWalletPassRequest) (*ladderpb.GetWalletPassResponse, error) {
+	w := h.wallet
+	if w == nil {
+		return nil, status.Error(codes.FailedPrecondition, "wallet passes are not enabled on this server")
+	}
+	m, playerID, err := h.currentPlayer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	serial := walletSerial(h.clubIDFor(m), playerID)
+	card, err := w.card(serial)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	resp := &ladderpb.GetWalletPassResponse{}
+	if w.apple != nil {
+		resp.ApplePassUrl = w.publicURL + walletPath + "pass/" + serial + "?auth=" + w.authToken(serial)
+	}
+	if w.google != nil {
+		if resp.GoogleSaveUrl, err = w.google.saveURL(card, w.org, w.publicURL, w.now()); err != nil {
+			return nil, err
+		}
+		if err := w.store.markGoogle(serial); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// ServeHTTP serves card downloads at /wallet/pass/<serial> and the Apple Wallet web
+// service at /wallet/v1
+func (w *WalletPasses) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, walletPath), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "pass" && r.Method == "GET":
+		if !w.checkAuth(parts[1], r.URL.Query().Get("auth")) {
+			http.Error(rw, "invalid pass link", http.StatusUnauthorized)
+			return
+		}
+		w.servePass(rw, r, parts[1])
+	case len(parts) == 4 && parts[0] == "v1" && parts[1] == "passes" && r.Method == "GET":
+		if !w.appleAuthorized(r, parts[2], parts[3]) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.servePass(rw, r, parts[3])
+	case len(parts) == 6 && parts[0] == "v1" && parts[1] == "devices" && parts[3] == "registrations":
+		if !w.appleAuthorized(r, parts[4], parts[5]) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.serveRegistration(rw, r, parts[2], parts[5])
+	case len(parts) == 5 && parts[0] == "v1" && parts[1] == "devices" && parts[3] == "registrations" && r.Method == "GET":
+		if w.apple == nil || parts[4] != w.apple.passTypeID {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.serveUpdated(rw, r, parts[2])
+	case len(parts) == 2 && parts[0] == "v1" && parts[1] == "log" && r.Method == "POST":
+		var body struct {
+			Logs []string `json:"logs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil {
+			for _, msg := range body.Logs {
+				log.Printf("wallet: device reported: %s", msg)
+			}
+		}
+		rw.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+// appleAuthorized checks the "ApplePass <token>" header Wallet sends for a card
+func (w *WalletPasses) appleAuthorized(r *http.Request, passTypeID, serial string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApplePass ")
+	return ok && w.apple != nil && passTypeID == w.apple.passTypeID && w.checkAuth(serial, token)
+}
+
+// servePass sends the current card, or 304 if the device has it already
+func (w *WalletPasses) servePass(rw http.ResponseWriter, r *http.Request, serial string) {
+	if w.apple == nil {
+		http.NotFound(rw, r)
+		return
+	}
+	card, err := w.card(serial)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	}
+	modified := time.UnixMilli(w.store.updatedMs(serial)).UTC().Truncate(time.Second)
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	pass, err := w.apple.build(card, w.org, w.authToken(serial), w.publicURL+strings.TrimSuffix(walletPath, "/"), w.now())
+	if err != nil {
+		log.Printf("wallet: failed to build the pass %s: %v", serial, err)
+		http.Error(rw, "failed to build the pass", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/vnd.apple.pkpass")
+	rw.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Write(pass)
+}
+
+// serveRegistration registers a device for a card's updates, or unregisters it
+func (w *WalletPasses) serveRegistration(rw http.ResponseWriter, r *http.Request, device, serial string) {
+	switch r.Method {
+	case "POST":
+		var body struct {
+			PushToken string `json:"pushToken"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.PushToken == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		created, err := w.store.register(device, body.PushToken, serial)
+		switch {
+		case err != nil:
+			log.Printf("wallet: failed to register a device: %v", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+		case created:
+			rw.WriteHeader(http.StatusCreated)
+		default:
+			rw.WriteHeader(http.StatusOK)
+		}
+	case "DELETE":
+		if err := w.store.unregister(device, serial); err != nil {
+			log.Printf("wallet: failed to unregister a device: %v", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveUpdated lists the cards on a device that changed since the tag it sends
+func (w *WalletPasses) serveUpdated(rw http.ResponseWriter, r *http.Request, device string) {
+	since, _ := strconv.ParseInt(r.URL.Query().Get("passesUpdatedSince"), 10, 64)
+	serials, last := w.store.updatedSince(device, since)
+	if len(serials) == 0 {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"serialNumbers": serials,
+		"lastUpdated":   strconv.FormatInt(last, 10),
+	})
+}
+
+// build returns a signed .pkpass bundle of the card
+func (a *appleWallet) build(card *walletCard, org, authToken, webServiceURL string, now time.Time) ([]byte, error) {
+	passJSON, err := json.MarshalIndent(map[string]interface{}{
+		"formatVersion":       1,
+		"passTypeIdentifier":  a.passTypeID,
+		"teamIdentifier":      a.teamID,
+		"serialNumber":        card.serial,
+		"organizationName":    org,
+		"description":         org + " membership card",
+		"authenticationToken": authToken,
+		"webServiceURL":       webServiceURL,
+		"backgroundColor":     fmt.Sprintf("rgb(%d, %d, %d)", walletBackground.R, walletBackground.G, walletBackground.B),
+		"foregroundColor":     walletForeground,
+		"labelColor":          walletLabel,
+		"generic": map[string]interface{}{
+			"primaryFields": []map[string]string{
+				{"key": "rank", "label": "RANK", "value": card.rankText(), "changeMessage": "You are now %@ on the ladder"},
+			},
+			"secondaryFields": []map[string]string{
+				{"key": "player", "label": "PLAYER", "value": card.name},
+			},
+			"auxiliaryFields": []map[string]string{
+				{"key": "club", "label": "CLUB", "value": card.club},
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		"pass.json":   passJSON,
+		"icon.png":    walletIcon(29),
+		"icon@2x.png": walletIcon(58),
+	}
+	manifest := make(map[string]string, len(files))
+	for name, data := range files {
+		sum := sha1.Sum(data)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(a.cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := a.cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("the pass certificate's key cannot sign")
+	}
+	signature, err := signDetachedPKCS7(manifestJSON, leaf, signer, a.chain, now)
+	if err != nil {
+		return nil, err
+	}
+	files["manifest.json"] = manifestJSON
+	files["signature"] = signature
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// push tells a device to fetch its updated cards. Wallet pushes carry no content.
+func (a *appleWallet) push(ctx context.Context, pushToken string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", a.apnsURL+"/3/device/"+pushToken, strings.NewReader("{}"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apns-topic", a.passTypeID)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusGone:
+		return errPushGone
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("APNs returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// walletIcon is a plain square of the card's colour; Wallet needs an icon
+func walletIcon(size int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, walletBackground)
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// object is the Google Wallet generic object of a card
+func (g *googleWallet) object(card *walletCard, org string) map[string]interface{} {
+	text := func(s string) map[string]interface{} {
+		return map[string]interface{}{"defaultValue": map[string]string{"language": "en", "value": s}}
+	}
+	return map[string]interface{}{
+		"id":                 g.issuerID + "." + card.serial,
+		"classId":            g.issuerID + ".ladder",
+		"state":              "ACTIVE",
+		"cardTitle":          text(card.club),
+		"header":             text(card.name),
+		"subheader":          text(org),
+		"hexBackgroundColor": fmt.Sprintf("#%02x%02x%02x", walletBackground.R, walletBackground.G, walletBackground.B),
+		"textModulesData":    []map[string]string{{"id": "rank", "header": "Rank", "body": card.rankText()}},
+	}
+}
+
+// saveURL returns a "Save to Google Wallet" link carrying the card, signed by the
+// service account
+func (g *googleWallet) saveURL(card *walletCard, org, origin string, now time.Time) (string, error) {
+	jwt, err := g.auth.signJWT(map[string]interface{}{
+		"iss":     g.auth.email,
+		"aud":     "google",
+		"typ":     "savetowallet",
+		"iat":     now.Unix(),
+		"origins": []string{origin},
+		"payload": map[string]interface{}{
+			"genericClasses": []map[string]string{{"id": g.issuerID + ".ladder"}},
+			"genericObjects": []map[string]interface{}{g.object(card, org)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return googleWalletSaveURL + jwt, nil
+}
+
+// patch updates a saved card. A card that was never saved has no object, which is
+// not an error.
+func (g *googleWallet) patch(ctx context.Context, card *walletCard, org string) error {
+	access, err := g.auth.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	obj := g.object(card, org)
+	data, err := json.Marshal(map[string]interface{}{"header": obj["header"], "textModulesData": obj["textModulesData"]})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PATCH", g.apiBase+"/genericObject/"+obj["id"].(string), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("Google Wallet returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// walletStore keeps the devices registered for card updates and when each card last
+// changed, in a JSON file
+type walletStore struct {
+	path string
+
+	mu      sync.Mutex
+	devices map[string]*walletDevice // By device library ID
+	passes  map[string]*walletPass   // By serial number
+}
+
+type walletDevice struct {
+	PushToken string   `json:"push_token"`
+	Serials   []string `json:"serials"`
+}
+
+type walletPass struct {
+	Name      string `json:"name,omitempty"` // As of the last change, for players who leave
+	UpdatedMs int64  `json:"updated_ms,omitempty"`
+	Google    bool   `json:"google,omitempty"` // Offered to Google Wallet, so it may have an object there
+}
+
+func openWalletStore(path string) (*walletStore, error) {
+	s := &walletStore{path: path, devices: make(map[string]*walletDevice), passes: make(map[string]*walletPass)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Devices map[string]*walletDevice `json:"devices"`
+		Passes  map[string]*walletPass   `json:"passes"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid wallet store %s: %v", path, err)
+	}
+	for id, d := range file.Devices {
+		s.devices[id] = d
+	}
+	for serial, p := range file.Passes {
+		s.passes[serial] = p
+	}
+	return s, nil
+}
+
+// register adds a card to a device, reporting whether it is new there
+func (s *walletStore) register(device, pushToken, serial string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.devices[device]
+	if d == nil {
+		d = &walletDevice{}
+		s.devices[device] = d
+	}
+	d.PushToken = pushToken
+	for _, existing := range d.Serials {
+		if existing == serial {
+			return false, s.saveLocked()
+		}
+	}
+	d.Serials = append(d.Serials, serial)
+	if s.passes[serial] == nil {
+		s.passes[serial] = &walletPass{}
+	}
+	return true, s.saveLocked()
+}
+
+// unregister removes a card from a device, and the device once it has none
+func (s *walletStore) unregister(device, serial string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.devices[device]
+	if d == nil {
+		return nil
+	}
+	for i, existing := range d.Serials {
+		if existing == serial {
+			d.Serials = append(d.Serials[:i], d.Serials[i+1:]...)
+			break
+		}
+	}
+	if len(d.Serials) == 0 {
+		delete(s.devices, device)
+	}
+	return s.saveLocked()
+}
+
+// updatedSince lists a device's cards that changed after sinceMs, and the latest
+// change among them
+func (s *walletStore) updatedSince(device string, sinceMs int64) ([]string, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.devices[device]
+	if d == nil {
+		return nil, 0
+	}
+	var serials []string
+	var last int64
+	for _, serial := range d.Serials {
+		updated := s.passes[serial].updatedAt()
+		if sinceMs == 0 || updated > sinceMs {
+			serials = append(serials, serial)
+		}
+		last = max(last, updated)
+	}
+	return serials, last
+}
+
+// touch records that a card changed at nowMs, when its player was called name, and
+// returns the push tokens of the devices holding it and whether it was offered to
+// Google Wallet. It reports false, and records nothing, for cards nobody holds.
+func (s *walletStore) touch(serial, name string, nowMs int64) ([]string, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.passes[serial]
+	if p == nil {
+		return nil, false, false
+	}
+	p.Name, p.UpdatedMs = name, nowMs
+	var tokens []string
+	for _, d := range s.devices {
+		for _, existing := range d.Serials {
+			if existing == serial {
+				tokens = append(tokens, d.PushToken)
+			}
+		}
+	}
+	if err := s.saveLocked(); err != nil {
+		log.Printf("wallet: failed to save the wallet store: %v", err)
+	}
+	return tokens, p.Google, true
+}
+
+// markGoogle records that a card was offered to Google Wallet
+func (s *walletStore) markGoogle(serial string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.passes[serial]
+	if p == nil {
+		p = &walletPass{}
+		s.passes[serial] = p
+	}
+	if p.Google {
+		return nil
+	}
+	p.Google = true
+	return s.saveLocked()
+}
+
+// forget removes a card from every device and drops what is kept about it, and the
+// devices left without cards
+func (s *walletStore) forget(serial string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, d := range s.devices {
+		d.Serials = slices.DeleteFunc(d.Serials, func(existing string) bool { return existing == serial })
+		if len(d.Serials) == 0 {
+			delete(s.devices, id)
+		}
+	}
+	delete(s.passes, serial)
+	return s.saveLocked()
+}
+
+// dropPushToken forgets the devices of a push token APNs no longer accepts
+func (s *walletStore) dropPushToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, d := range s.devices {
+		if d.PushToken == token {
+			delete(s.devices, id)
+		}
+	}
+	if err := s.saveLocked(); err != nil {
+		log.Printf("wallet: failed to save the wallet store: %v", err)
+	}
+}
+
+func (s *walletStore) name(serial string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.passes[serial]; p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+func (s *walletStore) updatedMs(serial string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.passes[serial].updatedAt()
+}
+
+func (p *walletPass) updatedAt() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.UpdatedMs
+}
+
+// saveLocked writes the store through a temporary file. The caller must hold s.mu.
+func (s *walletStore) saveLocked() error {
+	data, err := json.MarshalIndent(map[string]interface{}{"devices": s.devices, "passes": s.passes}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
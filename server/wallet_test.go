@@ -0,0 +1,389 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ladderpb "squash-ladder/server/gen/ladder"
+)
+
+// newTestWallet sets up a ladder with alice at #1 and bob at #2, and wallet passes
+// signed by a self-signed pass certificate
+func newTestWallet(t *testing.T, cfg WalletConfig) (*WalletPasses, *Model) {
+	t.Helper()
+	m, path := createTempModel(t)
+	t.Cleanup(func() { m.Close(); os.Remove(path) })
+	m.AddPlayer("Alice", "alice")
+	m.AddPlayer("Bob", "bob")
+	svc := NewLadderService(m)
+
+	dir := t.TempDir()
+	if cfg.PassTypeID != "" {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(42),
+			Subject:      pkix.Name{CommonName: "Pass Type ID: " + cfg.PassTypeID},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		cfg.CertFile = filepath.Join(dir, "pass.pem")
+		cfg.WWDRFile = filepath.Join(dir, "wwdr.pem")
+		os.WriteFile(cfg.CertFile, append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...), 0600)
+		os.WriteFile(cfg.WWDRFile, certPEM, 0600)
+	}
+	if cfg.GoogleIssuerID != "" {
+		key, _ := rsa.GenerateKey(rand.Reader, 2048)
+		der, _ := x509.MarshalPKCS8PrivateKey(key)
+		creds, _ := json.Marshal(map[string]string{
+			"client_email": "wallet@example.iam.gserviceaccount.com",
+			"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			"token_uri":    cfg.GoogleCredentialsFile + "/token",
+		})
+		cfg.GoogleCredentialsFile = filepath.Join(dir, "google.json")
+		os.WriteFile(cfg.GoogleCredentialsFile, creds, 0600)
+	}
+
+	w, err := NewWalletPasses(svc, nil, cfg, "https://ladder.example.org/", "wallet-secret", dir)
+	if err != nil {
+		t.Fatalf("NewWalletPasses failed: %v", err)
+	}
+	svc.wallet = w
+	return w, m
+}
+
+func walletRequest(w *WalletPasses, method, target, token string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "ApplePass "+token)
+	}
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestWalletApplePass(t *testing.T) {
+	var mu sync.Mutex
+	var pushed []string
+	apns := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apns-topic") != "pass.org.example.ladder" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/3/device/stale" {
+			rw.WriteHeader(http.StatusGone)
+			return
+		}
+		mu.Lock()
+		pushed = append(pushed, strings.TrimPrefix(r.URL.Path, "/3/device/"))
+		mu.Unlock()
+	}))
+	defer apns.Close()
+
+	w, m := newTestWallet(t, WalletConfig{PassTypeID: "pass.org.example.ladder", TeamID: "TEAM123"})
+	w.apple.apnsURL = apns.URL
+	w.apple.client = apns.Client()
+	w.Attach("", m)
+
+	ctx := context.WithValue(context.Background(), playerClaimsKey{}, &playerClaims{PlayerID: "bob"})
+	resp, err := w.service.GetWalletPass(ctx, &ladderpb.GetWalletPassRequest{})
+	if err != nil {
+		t.Fatalf("GetWalletPass failed: %v", err)
+	}
+	if resp.GoogleSaveUrl != "" {
+		t.Errorf("expected no Google link without Google Wallet, got %q", resp.GoogleSaveUrl)
+	}
+	link, err := url.Parse(resp.ApplePassUrl)
+	if err != nil || link.Host != "ladder.example.org" {
+		t.Fatalf("unexpected pass URL %q", resp.ApplePassUrl)
+	}
+	serial := strings.TrimPrefix(link.Path, walletPath+"pass/")
+	token := link.Query().Get("auth")
+
+	if rec := walletRequest(w, "GET", link.Path+"?auth=forged", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a forged link, got %d", rec.Code)
+	}
+	rec := walletRequest(w, "GET", link.RequestURI(), "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/vnd.apple.pkpass" {
+		t.Fatalf("expected a pass, got %d %q", rec.Code, rec.Body.String())
+	}
+	files := readPass(t, rec.Body.Bytes())
+	var pass struct {
+		SerialNumber        string `json:"serialNumber"`
+		AuthenticationToken string `json:"authenticationToken"`
+		WebServiceURL       string `json:"webServiceURL"`
+		Generic             struct {
+			PrimaryFields []struct{ Value string } `json:"primaryFields"`
+		} `json:"generic"`
+	}
+	if err := json.Unmarshal(files["pass.json"], &pass); err != nil {
+		t.Fatalf("invalid pass.json: %v", err)
+	}
+	if pass.SerialNumber != serial || pass.AuthenticationToken != token || pass.WebServiceURL != "https://ladder.example.org/wallet" {
+		t.Errorf("unexpected pass %s", files["pass.json"])
+	}
+	if len(pass.Generic.PrimaryFields) != 1 || pass.Generic.PrimaryFields[0].Value != "#2" {
+		t.Errorf("expected bob's card to show #2, got %s", files["pass.json"])
+	}
+
+	// The manifest lists every other file, and its signature checks out against the
+	// pass certificate
+	var manifest map[string]string
+	json.Unmarshal(files["manifest.json"], &manifest)
+	for name, data := range files {
+		if name == "manifest.json" || name == "signature" {
+			continue
+		}
+		sum := sha1.Sum(data)
+		if manifest[name] != hex.EncodeToString(sum[:]) {
+			t.Errorf("manifest hash of %s is wrong", name)
+		}
+	}
+	verifyPKCS7(t, files["signature"], files["manifest.json"], &w.apple.cert.PrivateKey.(*ecdsa.PrivateKey).PublicKey)
+
+	// The phone registers for updates
+	registration := walletPath + "v1/devices/phone/registrations/pass.org.example.ladder/" + serial
+	if rec := walletRequest(w, "POST", registration, "forged", `{"pushToken":"tok"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a forged token, got %d", rec.Code)
+	}
+	if rec := walletRequest(w, "POST", registration, token, `{"pushToken":"tok"}`); rec.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", rec.Code)
+	}
+	if rec := walletRequest(w, "POST", registration, token, `{"pushToken":"tok"}`); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for a repeated registration, got %d", rec.Code)
+	}
+	stale := walletPath + "v1/devices/old-phone/registrations/pass.org.example.ladder/" + serial
+	walletRequest(w, "POST", stale, token, `{"pushToken":"stale"}`)
+
+	// bob beats alice, and his phones are told to fetch the pass again
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(pushed) == 1
+		mu.Unlock()
+		w.store.mu.Lock()
+		devices := len(w.store.devices)
+		w.store.mu.Unlock()
+		if done && devices == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out; pushed %v", pushed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pushed[0] != "tok" {
+		t.Errorf("expected a push to tok, got %v", pushed)
+	}
+
+	rec = walletRequest(w, "GET", walletPath+"v1/devices/phone/registrations/pass.org.example.ladder?passesUpdatedSince=1", "", "")
+	var updated struct {
+		SerialNumbers []string `json:"serialNumbers"`
+		LastUpdated   string   `json:"lastUpdated"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &updated)
+	if rec.Code != http.StatusOK || len(updated.SerialNumbers) != 1 || updated.SerialNumbers[0] != serial {
+		t.Fatalf("expected bob's pass to be listed as updated, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := walletRequest(w, "GET", walletPath+"v1/devices/phone/registrations/pass.org.example.ladder?passesUpdatedSince="+updated.LastUpdated, "", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected nothing newer than lastUpdated, got %d", rec.Code)
+	}
+
+	passURL := walletPath + "v1/passes/pass.org.example.ladder/" + serial
+	rec = walletRequest(w, "GET", passURL, token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the updated pass, got %d", rec.Code)
+	}
+	if files := readPass(t, rec.Body.Bytes()); !bytes.Contains(files["pass.json"], []byte(`"value": "#1"`)) {
+		t.Errorf("expected bob's card to show #1, got %s", files["pass.json"])
+	}
+	r := httptest.NewRequest("GET", passURL, nil)
+	r.Header.Set("Authorization", "ApplePass "+token)
+	r.Header.Set("If-Modified-Since", rec.Header().Get("Last-Modified"))
+	notModified := httptest.NewRecorder()
+	w.ServeHTTP(notModified, r)
+	if notModified.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", notModified.Code)
+	}
+
+	if rec := walletRequest(w, "DELETE", registration, token, ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for unregistering, got %d", rec.Code)
+	}
+	if rec := walletRequest(w, "GET", walletPath+"v1/devices/phone/registrations/pass.org.example.ladder", "", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected no passes after unregistering, got %d", rec.Code)
+	}
+
+	// The registrations survive a restart
+	walletRequest(w, "POST", registration, token, `{"pushToken":"tok"}`)
+	reopened, err := openWalletStore(w.store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serials, _ := reopened.updatedSince("phone", 0); len(serials) != 1 {
+		t.Errorf("expected the registration to be saved, got %v", serials)
+	}
+}
+
+func TestWalletGooglePass(t *testing.T) {
+	var mu sync.Mutex
+	var patched []map[string]interface{}
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			rw.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+		case r.Header.Get("Authorization") != "Bearer tok":
+			rw.WriteHeader(http.StatusUnauthorized)
+		case r.Method == "PATCH" && r.URL.Path == "/genericObject/3388000000012345."+walletSerial("", "bob"):
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			patched = append(patched, body)
+			mu.Unlock()
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	w, m := newTestWallet(t, WalletConfig{GoogleIssuerID: "3388000000012345", GoogleCredentialsFile: api.URL})
+	w.google.apiBase = api.URL
+	w.Attach("", m)
+
+	ctx := context.WithValue(context.Background(), playerClaimsKey{}, &playerClaims{PlayerID: "bob"})
+	resp, err := w.service.GetWalletPass(ctx, &ladderpb.GetWalletPassRequest{})
+	if err != nil {
+		t.Fatalf("GetWalletPass failed: %v", err)
+	}
+	if resp.ApplePassUrl != "" || !strings.HasPrefix(resp.GoogleSaveUrl, googleWalletSaveURL) {
+		t.Fatalf("expected only a Google link, got %+v", resp)
+	}
+	parts := strings.Split(strings.TrimPrefix(resp.GoogleSaveUrl, googleWalletSaveURL), ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims struct {
+		Aud     string `json:"aud"`
+		Typ     string `json:"typ"`
+		Payload struct {
+			GenericObjects []struct {
+				ID              string                  `json:"id"`
+				TextModulesData []struct{ Body string } `json:"textModulesData"`
+			} `json:"genericObjects"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || len(parts) != 3 {
+		t.Fatalf("invalid save link JWT: %v", err)
+	}
+	objects := claims.Payload.GenericObjects
+	if claims.Aud != "google" || claims.Typ != "savetowallet" || len(objects) != 1 || objects[0].TextModulesData[0].Body != "#2" {
+		t.Errorf("unexpected save link claims %s", payload)
+	}
+
+	// alice was never offered a card, so only bob's object is patched
+	m.AddMatchResult("bob", "alice", "bob", []*ladderpb.SetScore{{ChallengerPoints: 11}, {ChallengerPoints: 11}, {ChallengerPoints: 11}})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(patched) == 1
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the Google Wallet object to be patched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	modules, _ := json.Marshal(patched[0]["textModulesData"])
+	if !strings.Contains(string(modules), `"body":"#1"`) {
+		t.Errorf("expected bob's object to show #1, got %s", modules)
+	}
+}
+
+func readPass(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("the pass is not a zip: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	for _, name := range []string{"pass.json", "manifest.json", "signature", "icon.png"} {
+		if files[name] == nil {
+			t.Fatalf("the pass has no %s", name)
+		}
+	}
+	return files
+}
+
+// verifyPKCS7 checks a detached signature made by signDetachedPKCS7
+func verifyPKCS7(t *testing.T, signature, content []byte, key *ecdsa.PublicKey) {
+	t.Helper()
+	var contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(signature, &contentInfo); err != nil || !contentInfo.ContentType.Equal(oidSignedData) {
+		t.Fatalf("the signature is not PKCS #7 signed data: %v", err)
+	}
+	var signedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"tag:0"`
+		SignerInfos      []struct {
+			Version            int
+			IssuerAndSerial    asn1.RawValue
+			DigestAlgorithm    asn1.RawValue
+			SignedAttrs        asn1.RawValue
+			SignatureAlgorithm asn1.RawValue
+			Signature          []byte
+		} `asn1:"set"`
+	}
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil || len(signedData.SignerInfos) != 1 {
+		t.Fatalf("invalid signed data: %v", err)
+	}
+	signer := signedData.SignerInfos[0]
+	digest := sha256.Sum256(content)
+	if !bytes.Contains(signer.SignedAttrs.Bytes, digest[:]) {
+		t.Error("the signed attributes do not carry the content's digest")
+	}
+	// The attributes are signed with their SET tag in place of [0]
+	attrs := append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+	attrsDigest := sha256.Sum256(attrs)
+	if !ecdsa.VerifyASN1(key, attrsDigest[:], signer.Signature) {
+		t.Error("the signature does not verify")
+	}
+}
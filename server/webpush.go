@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// webPushTTL is how long a push service keeps a message for an offline browser
+	webPushTTL = 24 * time.Hour
+	// webPushRecordSize is the aes128gcm record size; payloads always fit one record
+	webPushRecordSize = 4096
+	// webPushMaxPayload leaves room in a 4096 byte message for the 86 byte header,
+	// the GCM tag and the padding delimiter
+	webPushMaxPayload = 4096 - 86 - 16 - 1
+)
+
+// errPushGone means the push service no longer knows the subscription, which should
+// be forgotten
+var errPushGone = fmt.Errorf("push subscription has expired")
+
+// webPushSender delivers Web Push messages (RFC 8030) to browsers, encrypting them
+// for the subscription (RFC 8291) and identifying the server with VAPID (RFC 8292)
+type webPushSender struct {
+	key     *ecdsa.PrivateKey
+	public  string // Uncompressed public key, base64url; browsers subscribe with it
+	subject string // mailto: or https: contact for push service operators
+	client  *http.Client
+}
+
+// newWebPushSender creates a sender from a VAPID private key given as the base64url
+// encoding of its 32 byte scalar, the format printed by common web-push tools
+func newWebPushSender(privateKey, subject string) (*webPushSender, error) {
+	d, err := decodeBase64URL(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %v", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %v", err)
+	}
+	pub := priv.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("a VAPID subject (mailto: or https: URL) is required")
+	}
+	return &webPushSender{
+		key:     key,
+		public:  base64.RawURLEncoding.EncodeToString(pub),
+		subject: subject,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// GenerateVAPIDKeys returns a new VAPID key pair as base64url strings
+func GenerateVAPIDKeys() (privateKey, publicKey string, err error) {
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(priv.Bytes()), enc.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// send encrypts payload for the subscription and posts it to its push service
+func (s *webPushSender) send(ctx context.Context, sub pushSubscription, payload []byte) error {
+	body, err := encryptWebPush(sub.P256dh, sub.Auth, payload)
+	if err != nil {
+		return err
+	}
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid push endpoint: %v", err)
+	}
+	jwt, err := s.vapidJWT(endpoint.Scheme+"://"+endpoint.Host, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Authorization", "vapid t="+jwt+", k="+s.public)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errPushGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("push service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// vapidJWT signs the claims that identify this server to the push service at audience
+func (s *webPushSender) vapidJWT(audience string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": audience,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": s.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sv, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS wants r and s as fixed width big-endian integers
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	sv.FillBytes(sig[32:])
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// encryptWebPush encrypts payload for a browser's p256dh key and auth secret, both
+// base64url, producing an aes128gcm body with a single record
+func encryptWebPush(p256dh, authSecret string, payload []byte) ([]byte, error) {
+	uaBytes, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	auth, err := decodeBase64URL(authSecret)
+	if err != nil || len(auth) != 16 {
+		return nil, fmt.Errorf("invalid auth secret")
+	}
+	if len(payload) > webPushMaxPayload {
+		return nil, fmt.Errorf("push payload too large")
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	cek, nonce := webPushKeys(secret, auth, uaBytes, asPublic, salt)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (and only) record; no further padding is added
+	padded := append(append([]byte{}, payload...), 0x02)
+
+	header := make([]byte, 0, 21+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	return gcm.Seal(header, nonce, padded, nil), nil
+}
+
+// webPushKeys derives the content encryption key and nonce from the ECDH secret
+// shared by the browser's key and the sender's (RFC 8291 section 3.4)
+func webPushKeys(secret, auth, uaPublic, asPublic, salt []byte) (cek, nonce []byte) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdfExpand(hkdfExtract(auth, secret), keyInfo, 32)
+
+	prk := hkdfExtract(salt, ikm)
+	cek = hkdfExpand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce = hkdfExpand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+	return cek, nonce
+}
+
+// hkdfExtract and hkdfExpand implement HKDF-SHA-256 (RFC 5869); every output used
+// here is at most one hash long
+func hkdfExtract(salt, ikm []byte) []byte {
+	h := hmac.New(sha256.New, salt)
+	h.Write(ikm)
+	return h.Sum(nil)
+}
+
+func hkdfExpand(prk, info []byte, length int) []byte {
+	h := hmac.New(sha256.New, prk)
+	h.Write(info)
+	h.Write([]byte{1})
+	return h.Sum(nil)[:length]
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers and tools
+// differ
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}